@@ -2,12 +2,15 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/base64"
 	"errors"
 	"fmt"
 	"io/fs"
 	"log/slog"
 	"net/http"
+	"net/netip"
 	"os"
 	"os/signal"
 	"path/filepath"
@@ -22,13 +25,19 @@ import (
 	"github.com/itsChris/wgpilot/internal/config"
 	"github.com/itsChris/wgpilot/internal/crypto"
 	"github.com/itsChris/wgpilot/internal/db"
+	"github.com/itsChris/wgpilot/internal/events"
 	"github.com/itsChris/wgpilot/internal/debug"
+	"github.com/itsChris/wgpilot/internal/geoip"
+	"github.com/itsChris/wgpilot/internal/hooks"
 	"github.com/itsChris/wgpilot/internal/logging"
+	"github.com/itsChris/wgpilot/internal/metrics"
 	"github.com/itsChris/wgpilot/internal/monitor"
 	"github.com/itsChris/wgpilot/internal/nft"
+	"github.com/itsChris/wgpilot/internal/notify"
 	"github.com/itsChris/wgpilot/internal/sdnotify"
 	"github.com/itsChris/wgpilot/internal/server"
 	wgtls "github.com/itsChris/wgpilot/internal/tls"
+	"github.com/itsChris/wgpilot/internal/tracing"
 	"github.com/itsChris/wgpilot/internal/updater"
 	"github.com/itsChris/wgpilot/internal/wg"
 	"github.com/spf13/cobra"
@@ -105,6 +114,7 @@ func runServe(cmd *cobra.Command, args []string) error {
 	if f := cmd.Flags().Lookup("data-dir"); f != nil && f.Changed {
 		dataDir, _ := cmd.Flags().GetString("data-dir")
 		cfg.Database.Path = filepath.Join(dataDir, "wgpilot.db")
+		cfg.Database.TimeSeriesPath = filepath.Join(dataDir, "wgpilot-timeseries.db")
 	}
 
 	// Dev mode forces debug logging.
@@ -132,6 +142,7 @@ func runServe(cmd *cobra.Command, args []string) error {
 		"log_level", cfg.Logging.Level,
 		"dev_mode", cfg.Server.DevMode,
 		"db_path", cfg.Database.Path,
+		"timeseries_path", cfg.Database.TimeSeriesFile(),
 		"component", "main",
 	)
 
@@ -148,6 +159,29 @@ func runServe(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("run migrations: %w", err)
 	}
 
+	// ── Open time-series database ────────────────────────────────────
+	timeSeries, err := db.NewTimeSeries(ctx, cfg.Database.TimeSeriesFile(), logger, cfg.Server.DevMode)
+	if err != nil {
+		return fmt.Errorf("open time-series database: %w", err)
+	}
+	defer timeSeries.Close()
+
+	if err := db.MigrateTimeSeries(ctx, database, timeSeries, logger); err != nil {
+		return fmt.Errorf("move snapshots to time-series database: %w", err)
+	}
+
+	if n, err := timeSeries.BackfillSessions(ctx); err != nil {
+		logger.Warn("sessions_backfill_failed",
+			"error", err,
+			"component", "main",
+		)
+	} else if n > 0 {
+		logger.Info("sessions_backfilled",
+			"sessions", n,
+			"component", "main",
+		)
+	}
+
 	// ── Load JWT secret from database ────────────────────────────────
 	jwtSecretB64, err := database.GetSetting(ctx, "jwt_secret")
 	if err != nil {
@@ -195,6 +229,55 @@ func runServe(cmd *cobra.Command, args []string) error {
 	}
 	defer rateLimiter.Stop()
 
+	// ── Create event bus ─────────────────────────────────────────────
+	// Shared by the poller, the API handlers and the reconciler; feeds the
+	// SSE endpoints and event hooks.
+	eventBus := events.NewBus(events.DefaultBufferSize)
+
+	// ── Create metrics registry ──────────────────────────────────────
+	// Served on /metrics. The poller and the HTTP server register their
+	// own series; query latency is recorded for both databases.
+	metricsRegistry := metrics.NewRegistry()
+	metricsRegistry.Register(metrics.NewGoCollector())
+	queryDuration := metrics.NewHistogramVec("wgpilot_db_query_duration_seconds",
+		"SQLite query latency by database and operation.", metrics.QueryBuckets, "db", "op")
+	metricsRegistry.Register(queryDuration)
+	database.SetQueryObserver(func(op string, d time.Duration) {
+		queryDuration.Observe(d.Seconds(), "main", op)
+	})
+	timeSeries.SetQueryObserver(func(op string, d time.Duration) {
+		queryDuration.Observe(d.Seconds(), "timeseries", op)
+	})
+
+	// ── Start tracing ────────────────────────────────────────────────
+	// Installed before the HTTP server so every request gets a span. The
+	// tracer outlives the server on shutdown so queued spans are flushed.
+	tracingCtx, tracingCancel := context.WithCancel(context.Background())
+	defer tracingCancel()
+	tracingDone := make(chan struct{})
+	if cfg.Tracing.Endpoint == "" {
+		close(tracingDone)
+	} else {
+		var tracer *tracing.Tracer
+		exporter, err := tracing.NewOTLPExporter(cfg.Tracing.Endpoint, cfg.Tracing.Headers, cfg.Tracing.ServiceName, version)
+		if err == nil {
+			tracer, err = tracing.NewTracer(exporter, logger, cfg.Tracing.SampleRate)
+		}
+		if err != nil {
+			logger.Warn("tracing_init_failed",
+				"error", err,
+				"component", "main",
+			)
+			close(tracingDone)
+		} else {
+			tracing.SetGlobal(tracer)
+			go func() {
+				tracer.Run(tracingCtx)
+				close(tracingDone)
+			}()
+		}
+	}
+
 	// ── Create WireGuard manager ─────────────────────────────────────
 	wgCtrl, err := wg.NewWireGuardController()
 	if err != nil {
@@ -213,6 +296,8 @@ func runServe(cmd *cobra.Command, args []string) error {
 				"error", err,
 				"component", "main",
 			)
+		} else {
+			wgMgr.SetEventBus(eventBus)
 		}
 	}
 
@@ -226,18 +311,129 @@ func runServe(cmd *cobra.Command, args []string) error {
 		)
 	}
 
+	// ── Open GeoIP databases ─────────────────────────────────────────
+	var geoDB *geoip.DB
+	if cfg.GeoIP.Database != "" || cfg.GeoIP.ASNDatabase != "" {
+		geoDB, err = geoip.Open(cfg.GeoIP.Database, cfg.GeoIP.ASNDatabase)
+		if err != nil {
+			logger.Warn("geoip_open_failed",
+				"error", err,
+				"component", "main",
+			)
+		} else {
+			logger.Info("geoip_loaded",
+				"databases", geoDB.DatabaseTypes(),
+				"component", "main",
+			)
+		}
+	}
+
+	// ── Configure single sign-on ─────────────────────────────────────
+	var roles map[string]bool
+	if cfg.Auth.OIDC.Enabled || cfg.Auth.LDAP.Enabled {
+		roles, err = knownRoles(ctx, database)
+		if err != nil {
+			return fmt.Errorf("list roles: %w", err)
+		}
+	}
+	var oidcCfg server.OIDCConfig
+	if cfg.Auth.OIDC.Enabled {
+		oidcCfg, err = newOIDCConfig(cfg.Auth.OIDC, roles)
+		if err != nil {
+			return fmt.Errorf("configure oidc: %w", err)
+		}
+		logger.Info("oidc_enabled",
+			"issuer", cfg.Auth.OIDC.Issuer,
+			"password_login", !cfg.Auth.OIDC.DisablePasswordLogin,
+			"component", "main",
+		)
+	}
+
+	// ── Configure LDAP login ─────────────────────────────────────────
+	var ldapCfg server.LDAPConfig
+	if cfg.Auth.LDAP.Enabled {
+		ldapCfg, err = newLDAPConfig(cfg.Auth.LDAP, roles)
+		if err != nil {
+			return fmt.Errorf("configure ldap: %w", err)
+		}
+		if cfg.Auth.LDAP.InsecureSkipVerify {
+			logger.Warn("ldap_tls_verification_disabled",
+				"url", cfg.Auth.LDAP.URL,
+				"component", "main",
+			)
+		}
+		logger.Info("ldap_enabled",
+			"url", cfg.Auth.LDAP.URL,
+			"provision_users", cfg.Auth.LDAP.ProvisionUsers,
+			"component", "main",
+		)
+	}
+
+	// ── Configure password policy and lockout ────────────────────────
+	passwords := authpkg.PasswordPolicy{
+		MinLength: cfg.Auth.PasswordPolicy.MinLength,
+		History:   cfg.Auth.PasswordPolicy.History,
+	}
+	if path := cfg.Auth.PasswordPolicy.BreachedList; path != "" {
+		n, err := passwords.LoadBreachedPasswords(path)
+		if err != nil {
+			return fmt.Errorf("load breached password list: %w", err)
+		}
+		logger.Info("breached_passwords_loaded",
+			"path", path,
+			"count", n,
+			"component", "main",
+		)
+	}
+	lockout := server.LockoutConfig{Threshold: cfg.Auth.Lockout.Threshold}
+	if lockout.Threshold > 0 {
+		lockout.Duration, err = time.ParseDuration(cfg.Auth.Lockout.Duration)
+		if err != nil {
+			return fmt.Errorf("parse lockout duration %q: %w", cfg.Auth.Lockout.Duration, err)
+		}
+	}
+
+	// Raw snapshot retention is used by the compactor and, to pick the
+	// resolution of traffic queries, by the server.
+	retention := db.RawSnapshotRetention
+	if ret, err := config.ParseDuration(cfg.Monitor.SnapshotRetention); err == nil {
+		retention = ret
+	}
+
+	// ── Create mailer (SMTP settings are read on every send) ─────────
+	mailer, err := notify.NewMailer(database)
+	if err != nil {
+		return fmt.Errorf("create mailer: %w", err)
+	}
+
 	// ── Create HTTP server ───────────────────────────────────────────
 	srv, err := server.New(server.Config{
-		DB:          database,
-		Logger:      logger,
-		JWTService:  jwtSvc,
-		Sessions:    sessions,
-		RateLimiter: rateLimiter,
-		WGManager:   wgMgr,
-		NFTManager:  nftMgr,
-		DevMode:     cfg.Server.DevMode,
-		Ring:        ring,
-		Version:     version,
+		DB:           database,
+		TimeSeries:   timeSeries,
+		Logger:       logger,
+		JWTService:   jwtSvc,
+		Sessions:     sessions,
+		RateLimiter:  rateLimiter,
+		WebAuthn:     authpkg.RelyingParty{
+			ID:      cfg.Auth.WebAuthn.RPID,
+			Origins: cfg.Auth.WebAuthn.Origins,
+		},
+		OIDC:         oidcCfg,
+		LDAP:         ldapCfg,
+		Passwords:    passwords,
+		Lockout:      lockout,
+		WGManager:    wgMgr,
+		NFTManager:   nftMgr,
+		GeoIP:        geoDB,
+		Mailer:       mailer,
+		Events:       eventBus,
+		Metrics:      metricsRegistry,
+		MetricsToken: cfg.Metrics.Token,
+		ExternalURL:  cfg.Server.ExternalURL,
+		RawRetention: retention,
+		DevMode:      cfg.Server.DevMode,
+		Ring:         ring,
+		Version:      version,
 	})
 	if err != nil {
 		return fmt.Errorf("create server: %w", err)
@@ -288,22 +484,18 @@ func runServe(cmd *cobra.Command, args []string) error {
 		compactInterval = ci
 	}
 
-	retention := 24 * time.Hour
-	if ret, err := time.ParseDuration(cfg.Monitor.SnapshotRetention); err == nil {
-		retention = ret
-	}
-
-	poller, err := monitor.NewPoller(database, wgMgr, logger, pollInterval)
+	poller, err := monitor.NewPoller(database, timeSeries, wgMgr, eventBus, logger, pollInterval)
 	if err != nil {
 		logger.Warn("monitor_poller_init_failed",
 			"error", err,
 			"component", "main",
 		)
 	} else {
+		metricsRegistry.Register(poller)
 		go poller.Run(monitorCtx)
 	}
 
-	compactor, err := monitor.NewCompactor(database, logger, compactInterval, retention)
+	compactor, err := monitor.NewCompactor(timeSeries, logger, compactInterval, retention)
 	if err != nil {
 		logger.Warn("monitor_compactor_init_failed",
 			"error", err,
@@ -324,6 +516,79 @@ func runServe(cmd *cobra.Command, args []string) error {
 		go expiryChecker.Run(monitorCtx)
 	}
 
+	// ── Start peer quota enforcer ────────────────────────────────────
+	quotaInterval := 5 * time.Minute
+	if qi, err := time.ParseDuration(cfg.Monitor.QuotaInterval); err == nil {
+		quotaInterval = qi
+	}
+	var (
+		quotaPeers     monitor.PeerManager
+		quotaThrottler monitor.PeerThrottler
+	)
+	if wgMgr != nil {
+		quotaPeers = wgMgr
+	}
+	if nftMgr != nil {
+		quotaThrottler = nftMgr
+	}
+	throttleRate := uint64(cfg.Monitor.QuotaThrottleKbps) * 1000 / 8
+	quotaEnforcer, err := monitor.NewQuotaEnforcer(database, timeSeries, quotaPeers, quotaThrottler, mailer, logger, quotaInterval, throttleRate)
+	if err != nil {
+		logger.Warn("quota_enforcer_init_failed",
+			"error", err,
+			"component", "main",
+		)
+	} else {
+		go quotaEnforcer.Run(monitorCtx)
+	}
+
+	// ── Start endpoint alerter ───────────────────────────────────────
+	var alertGeo monitor.Locator
+	if geoDB != nil {
+		alertGeo = geoDB
+	}
+	endpointAlerter, err := monitor.NewEndpointAlerter(database, timeSeries, alertGeo, mailer, logger, 1*time.Minute)
+	if err != nil {
+		logger.Warn("endpoint_alerter_init_failed",
+			"error", err,
+			"component", "main",
+		)
+	} else {
+		go endpointAlerter.Run(monitorCtx)
+	}
+
+	// ── Start webhook dispatcher ─────────────────────────────────────
+	webhookDispatcher, err := monitor.NewWebhookDispatcher(database, nil, logger, 5*time.Second)
+	if err != nil {
+		logger.Warn("webhook_dispatcher_init_failed",
+			"error", err,
+			"component", "main",
+		)
+	} else {
+		go webhookDispatcher.Run(monitorCtx)
+	}
+
+	// ── Start event hooks ────────────────────────────────────────────
+	if len(cfg.Hooks.Scripts) > 0 {
+		hookTimeout := 30 * time.Second
+		if ht, err := time.ParseDuration(cfg.Hooks.Timeout); err == nil {
+			hookTimeout = ht
+		}
+		scripts := make([]hooks.Hook, 0, len(cfg.Hooks.Scripts))
+		for _, sc := range cfg.Hooks.Scripts {
+			scripts = append(scripts, hooks.Hook{Event: sc.Event, Command: sc.Command, Args: sc.Args})
+		}
+		hookRunner, err := hooks.NewRunner(scripts, eventBus, database, database, logger, hookTimeout, cfg.Hooks.MaxConcurrent)
+		if err != nil {
+			logger.Warn("hook_runner_init_failed",
+				"error", err,
+				"component", "main",
+			)
+		} else {
+			go hookRunner.Run(monitorCtx)
+		}
+	}
+
 	// ── Signal handling ──────────────────────────────────────────────
 	sigCh := make(chan os.Signal, 1)
 	signal.Notify(sigCh, syscall.SIGTERM, syscall.SIGINT, syscall.SIGHUP)
@@ -428,6 +693,9 @@ func runServe(cmd *cobra.Command, args []string) error {
 					httpServer.Close()
 				}
 
+				tracingCancel()
+				<-tracingDone
+
 				logger.Info("shutdown_complete", "component", "main")
 				return nil
 			}
@@ -451,6 +719,114 @@ func parseLogLevel(s string) slog.Level {
 	}
 }
 
+// newOIDCConfig validates the single sign-on settings and creates the
+// provider. Discovery happens on the first login, so an unreachable issuer
+// does not prevent startup.
+func newOIDCConfig(c config.OIDCConfig, roles map[string]bool) (server.OIDCConfig, error) {
+	if c.Issuer == "" || c.ClientID == "" {
+		return server.OIDCConfig{}, fmt.Errorf("issuer and client_id are required")
+	}
+	if err := validateRoleMapping(c.RoleMapping, c.DefaultRole, roles); err != nil {
+		return server.OIDCConfig{}, err
+	}
+
+	provider, err := authpkg.NewOIDCProvider(authpkg.OIDCConfig{
+		Issuer:       c.Issuer,
+		ClientID:     c.ClientID,
+		ClientSecret: c.ClientSecret,
+		Scopes:       c.Scopes,
+	})
+	if err != nil {
+		return server.OIDCConfig{}, err
+	}
+	return server.OIDCConfig{
+		Provider:             provider,
+		RedirectURL:          c.RedirectURL,
+		UsernameClaim:        c.UsernameClaim,
+		GroupsClaim:          c.GroupsClaim,
+		RoleMapping:          c.RoleMapping,
+		DefaultRole:          c.DefaultRole,
+		DisablePasswordLogin: c.DisablePasswordLogin,
+	}, nil
+}
+
+// newLDAPConfig validates the LDAP settings and creates the authenticator.
+// The server is not contacted until the first login.
+func newLDAPConfig(c config.LDAPConfig, roles map[string]bool) (server.LDAPConfig, error) {
+	if err := validateRoleMapping(c.RoleMapping, c.DefaultRole, roles); err != nil {
+		return server.LDAPConfig{}, err
+	}
+	timeout, err := time.ParseDuration(c.Timeout)
+	if err != nil {
+		return server.LDAPConfig{}, fmt.Errorf("parse timeout %q: %w", c.Timeout, err)
+	}
+
+	tlsCfg := &tls.Config{InsecureSkipVerify: c.InsecureSkipVerify}
+	if c.CAFile != "" {
+		pem, err := os.ReadFile(c.CAFile)
+		if err != nil {
+			return server.LDAPConfig{}, fmt.Errorf("read ca_file: %w", err)
+		}
+		tlsCfg.RootCAs = x509.NewCertPool()
+		if !tlsCfg.RootCAs.AppendCertsFromPEM(pem) {
+			return server.LDAPConfig{}, fmt.Errorf("ca_file %s contains no PEM certificates", c.CAFile)
+		}
+	}
+
+	authenticator, err := authpkg.NewLDAPAuthenticator(authpkg.LDAPConfig{
+		URL:            c.URL,
+		StartTLS:       c.StartTLS,
+		TLSConfig:      tlsCfg,
+		BindDN:         c.BindDN,
+		BindPassword:   c.BindPassword,
+		BaseDN:         c.BaseDN,
+		UserFilter:     c.UserFilter,
+		GroupAttribute: c.GroupAttribute,
+		GroupBaseDN:    c.GroupBaseDN,
+		GroupFilter:    c.GroupFilter,
+		Timeout:        timeout,
+	})
+	if err != nil {
+		return server.LDAPConfig{}, err
+	}
+	return server.LDAPConfig{
+		Authenticator:  authenticator,
+		RoleMapping:    c.RoleMapping,
+		DefaultRole:    c.DefaultRole,
+		ProvisionUsers: c.ProvisionUsers,
+	}, nil
+}
+
+// validateRoleMapping checks that a group → role mapping and its default
+// role only name known roles.
+func validateRoleMapping(mapping map[string]string, defaultRole string, roles map[string]bool) error {
+	for group, role := range mapping {
+		if !roles[role] {
+			return fmt.Errorf("role_mapping: group %q maps to unknown role %q", group, role)
+		}
+	}
+	if defaultRole != "" && !roles[defaultRole] {
+		return fmt.Errorf("default_role must be a known role or empty, got %q", defaultRole)
+	}
+	return nil
+}
+
+// knownRoles returns the names of the built-in and custom roles.
+func knownRoles(ctx context.Context, database *db.DB) (map[string]bool, error) {
+	custom, err := database.ListRoles(ctx)
+	if err != nil {
+		return nil, err
+	}
+	roles := make(map[string]bool, len(custom)+2)
+	for _, name := range authpkg.BuiltinRoles() {
+		roles[name] = true
+	}
+	for _, r := range custom {
+		roles[r.Name] = true
+	}
+	return roles, nil
+}
+
 func newInitCmd() *cobra.Command {
 	return &cobra.Command{
 		Use:   "init",
@@ -752,12 +1128,24 @@ func newAPIKeyCreateCmd() *cobra.Command {
 			name, _ := cmd.Flags().GetString("name")
 			role, _ := cmd.Flags().GetString("role")
 			expiresIn, _ := cmd.Flags().GetString("expires-in")
+			scopes, _ := cmd.Flags().GetStringSlice("scopes")
+			networkIDs, _ := cmd.Flags().GetInt64Slice("networks")
+			allowedCIDRs, _ := cmd.Flags().GetStringSlice("allowed-cidrs")
 
 			if name == "" {
 				return fmt.Errorf("--name is required")
 			}
-			if role != "admin" && role != "viewer" {
-				return fmt.Errorf("--role must be 'admin' or 'viewer'")
+			for _, p := range scopes {
+				if !authpkg.ValidPermission(p) {
+					return fmt.Errorf("--scopes: unknown permission %q", p)
+				}
+			}
+			for i, cidr := range allowedCIDRs {
+				prefix, err := netip.ParsePrefix(cidr)
+				if err != nil {
+					return fmt.Errorf("--allowed-cidrs: %w", err)
+				}
+				allowedCIDRs[i] = prefix.Masked().String()
 			}
 
 			configPath, _ := cmd.Flags().GetString("config")
@@ -789,6 +1177,20 @@ func newAPIKeyCreateCmd() *cobra.Command {
 			}
 			userID := users[0].ID // Use the first (admin) user.
 
+			if roles, err := knownRoles(ctx, database); err != nil {
+				return fmt.Errorf("list roles: %w", err)
+			} else if !roles[role] {
+				return fmt.Errorf("--role %q is not a known role", role)
+			}
+
+			for _, id := range networkIDs {
+				if n, err := database.GetNetworkByID(ctx, id); err != nil {
+					return fmt.Errorf("get network %d: %w", id, err)
+				} else if n == nil {
+					return fmt.Errorf("--networks: network %d not found", id)
+				}
+			}
+
 			var expiresAt *time.Time
 			if expiresIn != "" {
 				d, err := time.ParseDuration(expiresIn)
@@ -805,12 +1207,15 @@ func newAPIKeyCreateCmd() *cobra.Command {
 			}
 
 			apiKey := &db.APIKey{
-				Name:      name,
-				KeyHash:   hash,
-				KeyPrefix: prefix,
-				UserID:    userID,
-				Role:      role,
-				ExpiresAt: expiresAt,
+				Name:         name,
+				KeyHash:      hash,
+				KeyPrefix:    prefix,
+				UserID:       userID,
+				Role:         role,
+				ExpiresAt:    expiresAt,
+				Scopes:       scopes,
+				NetworkIDs:   networkIDs,
+				AllowedCIDRs: allowedCIDRs,
 			}
 
 			id, err := database.CreateAPIKey(ctx, apiKey)
@@ -832,8 +1237,11 @@ func newAPIKeyCreateCmd() *cobra.Command {
 		},
 	}
 	cmd.Flags().String("name", "", "name for the API key (required)")
-	cmd.Flags().String("role", "admin", "role for the API key (admin or viewer)")
+	cmd.Flags().String("role", "admin", "role for the API key (admin, viewer or a custom role)")
 	cmd.Flags().String("expires-in", "", "expiry duration (e.g. 720h for 30 days)")
+	cmd.Flags().StringSlice("scopes", nil, "permissions to limit the key to (e.g. peer:read,peer:write)")
+	cmd.Flags().Int64Slice("networks", nil, "network IDs to limit the key to")
+	cmd.Flags().StringSlice("allowed-cidrs", nil, "source CIDRs the key may be used from")
 	return cmd
 }
 
@@ -871,7 +1279,7 @@ func newAPIKeyListCmd() *cobra.Command {
 				return nil
 			}
 
-			fmt.Printf("%-4s %-20s %-20s %-8s %-20s %-20s\n", "ID", "NAME", "PREFIX", "ROLE", "EXPIRES", "LAST USED")
+			fmt.Printf("%-4s %-20s %-20s %-8s %-20s %-20s %s\n", "ID", "NAME", "PREFIX", "ROLE", "EXPIRES", "LAST USED", "LAST IP")
 			for _, k := range keys {
 				expires := "never"
 				if k.ExpiresAt != nil {
@@ -881,7 +1289,7 @@ func newAPIKeyListCmd() *cobra.Command {
 				if k.LastUsed != nil {
 					lastUsed = k.LastUsed.Format("2006-01-02 15:04")
 				}
-				fmt.Printf("%-4d %-20s %-20s %-8s %-20s %-20s\n", k.ID, k.Name, k.KeyPrefix, k.Role, expires, lastUsed)
+				fmt.Printf("%-4d %-20s %-20s %-8s %-20s %-20s %s\n", k.ID, k.Name, k.KeyPrefix, k.Role, expires, lastUsed, k.LastUsedIP)
 			}
 			return nil
 		},
@@ -105,6 +105,8 @@ export interface TransferStats {
   timestamp: number;
   transfer_rx: number;
   transfer_tx: number;
+  rx_bps: number;
+  tx_bps: number;
 }
 
 // ── Bridge types ────────────────────────────────────────────────────
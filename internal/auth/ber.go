@@ -0,0 +1,200 @@
+package auth
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// BER identifier octets (X.690) used by LDAP. Application and context tags
+// are built by or-ing a class, optionally berConstructed, and a tag number.
+const (
+	berBoolean     = 0x01
+	berInteger     = 0x02
+	berOctetString = 0x04
+	berEnumerated  = 0x0a
+	berSequence    = 0x30
+	berSet         = 0x31
+
+	berConstructed = 0x20
+	berApplication = 0x40
+	berContext     = 0x80
+)
+
+// berMaxDepth bounds nesting so a malicious server cannot exhaust the stack.
+const berMaxDepth = 32
+
+// berMaxMessage caps the size of a message read from the network.
+const berMaxMessage = 4 << 20
+
+var errBERTruncated = errors.New("ber: unexpected end of data")
+
+// berElement is a decoded BER element. Primitive elements carry their
+// content in value, constructed ones their decoded children.
+type berElement struct {
+	tag      byte
+	value    []byte
+	children []*berElement
+}
+
+// berEncode encodes one element with definite length. For constructed
+// tags, content is the concatenation of the encoded children.
+func berEncode(tag byte, content ...[]byte) []byte {
+	n := 0
+	for _, c := range content {
+		n += len(c)
+	}
+	out := append([]byte{tag}, berLength(n)...)
+	for _, c := range content {
+		out = append(out, c...)
+	}
+	return out
+}
+
+func berLength(n int) []byte {
+	if n < 0x80 {
+		return []byte{byte(n)}
+	}
+	var b []byte
+	for ; n > 0; n >>= 8 {
+		b = append([]byte{byte(n)}, b...)
+	}
+	return append([]byte{0x80 | byte(len(b))}, b...)
+}
+
+// berString encodes s as a primitive element with the given tag.
+func berString(tag byte, s string) []byte {
+	return berEncode(tag, []byte(s))
+}
+
+// berInt encodes n in minimal two's complement form.
+func berInt(tag byte, n int64) []byte {
+	var b []byte
+	for {
+		b = append([]byte{byte(n)}, b...)
+		if (n >= -0x80 && n < 0x80) || len(b) == 8 {
+			break
+		}
+		n >>= 8
+	}
+	return berEncode(tag, b)
+}
+
+func berBool(v bool) []byte {
+	if v {
+		return berEncode(berBoolean, []byte{0xff})
+	}
+	return berEncode(berBoolean, []byte{0x00})
+}
+
+// berReadElement reads one complete element from r without decoding it.
+func berReadElement(r *bufio.Reader) ([]byte, error) {
+	tag, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	first, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	header := []byte{tag, first}
+	n := int(first)
+	if first&0x80 != 0 {
+		size := int(first & 0x7f)
+		if size == 0 || size > 4 {
+			return nil, fmt.Errorf("ber: unsupported length encoding 0x%02x", first)
+		}
+		n = 0
+		for range size {
+			b, err := r.ReadByte()
+			if err != nil {
+				return nil, err
+			}
+			header = append(header, b)
+			n = n<<8 | int(b)
+		}
+	}
+	if n > berMaxMessage {
+		return nil, fmt.Errorf("ber: message of %d bytes is too large", n)
+	}
+	buf := make([]byte, len(header)+n)
+	copy(buf, header)
+	if _, err := io.ReadFull(r, buf[len(header):]); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+// berDecode decodes the first element in data and returns it with the bytes
+// that follow it.
+func berDecode(data []byte) (*berElement, []byte, error) {
+	return berDecodeElement(data, 0)
+}
+
+func berDecodeElement(data []byte, depth int) (*berElement, []byte, error) {
+	if depth > berMaxDepth {
+		return nil, nil, errors.New("ber: nesting too deep")
+	}
+	if len(data) < 2 {
+		return nil, nil, errBERTruncated
+	}
+	tag := data[0]
+	if tag&0x1f == 0x1f {
+		return nil, nil, errors.New("ber: high tag numbers are not supported")
+	}
+	n, data := int(data[1]), data[2:]
+	if n&0x80 != 0 {
+		size := n & 0x7f
+		if size == 0 || size > 4 {
+			return nil, nil, fmt.Errorf("ber: unsupported length encoding 0x%02x", n)
+		}
+		if len(data) < size {
+			return nil, nil, errBERTruncated
+		}
+		n = 0
+		for _, b := range data[:size] {
+			n = n<<8 | int(b)
+		}
+		data = data[size:]
+	}
+	if n > len(data) {
+		return nil, nil, errBERTruncated
+	}
+	content, rest := data[:n], data[n:]
+
+	e := &berElement{tag: tag}
+	if tag&berConstructed == 0 {
+		e.value = content
+		return e, rest, nil
+	}
+	for len(content) > 0 {
+		child, more, err := berDecodeElement(content, depth+1)
+		if err != nil {
+			return nil, nil, err
+		}
+		e.children = append(e.children, child)
+		content = more
+	}
+	return e, rest, nil
+}
+
+// int decodes the content of an INTEGER or ENUMERATED element.
+func (e *berElement) int() (int64, error) {
+	if len(e.value) == 0 || len(e.value) > 8 {
+		return 0, fmt.Errorf("ber: invalid integer of %d bytes", len(e.value))
+	}
+	n := int64(int8(e.value[0]))
+	for _, b := range e.value[1:] {
+		n = n<<8 | int64(b)
+	}
+	return n, nil
+}
+
+// child returns the i-th child, or an error if the element has fewer.
+func (e *berElement) child(i int) (*berElement, error) {
+	if i >= len(e.children) {
+		return nil, fmt.Errorf("ber: element 0x%02x has %d children, want at least %d", e.tag, len(e.children), i+1)
+	}
+	return e.children[i], nil
+}
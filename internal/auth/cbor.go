@@ -0,0 +1,182 @@
+package auth
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// cborMaxDepth bounds nesting so a malicious attestation object cannot
+// exhaust the stack.
+const cborMaxDepth = 16
+
+var errCBORTruncated = errors.New("cbor: unexpected end of data")
+
+// cborDecode decodes the first CBOR data item in data (RFC 8949) and
+// returns it with the bytes that follow it. It supports the subset used by
+// WebAuthn: integers, byte and text strings, arrays, maps, booleans, null
+// and floats. Integers decode as int64, maps as map[any]any with int64 or
+// string keys, byte strings as []byte.
+func cborDecode(data []byte) (any, []byte, error) {
+	return cborDecodeItem(data, 0)
+}
+
+func cborDecodeItem(data []byte, depth int) (any, []byte, error) {
+	if depth > cborMaxDepth {
+		return nil, nil, errors.New("cbor: nesting too deep")
+	}
+	if len(data) == 0 {
+		return nil, nil, errCBORTruncated
+	}
+	major := data[0] >> 5
+	info := data[0] & 0x1f
+
+	if major == 7 {
+		return cborDecodeSimple(data, info)
+	}
+
+	arg, rest, err := cborArgument(data[1:], info)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	switch major {
+	case 0: // unsigned integer
+		if arg > math.MaxInt64 {
+			return nil, nil, errors.New("cbor: integer overflows int64")
+		}
+		return int64(arg), rest, nil
+	case 1: // negative integer
+		if arg > math.MaxInt64 {
+			return nil, nil, errors.New("cbor: integer overflows int64")
+		}
+		return -1 - int64(arg), rest, nil
+	case 2, 3: // byte string, text string
+		if arg > uint64(len(rest)) {
+			return nil, nil, errCBORTruncated
+		}
+		b := rest[:arg]
+		if major == 3 {
+			return string(b), rest[arg:], nil
+		}
+		return append([]byte(nil), b...), rest[arg:], nil
+	case 4: // array
+		if arg > uint64(len(rest)) {
+			return nil, nil, errCBORTruncated
+		}
+		arr := make([]any, 0, arg)
+		for range arg {
+			var v any
+			if v, rest, err = cborDecodeItem(rest, depth+1); err != nil {
+				return nil, nil, err
+			}
+			arr = append(arr, v)
+		}
+		return arr, rest, nil
+	case 5: // map
+		if arg > uint64(len(rest)) {
+			return nil, nil, errCBORTruncated
+		}
+		m := make(map[any]any, arg)
+		for range arg {
+			var k, v any
+			if k, rest, err = cborDecodeItem(rest, depth+1); err != nil {
+				return nil, nil, err
+			}
+			switch k.(type) {
+			case int64, string:
+			default:
+				return nil, nil, fmt.Errorf("cbor: unsupported map key type %T", k)
+			}
+			if v, rest, err = cborDecodeItem(rest, depth+1); err != nil {
+				return nil, nil, err
+			}
+			m[k] = v
+		}
+		return m, rest, nil
+	case 6: // tag: ignore the tag number, keep the content
+		return cborDecodeItem(rest, depth+1)
+	}
+	return nil, nil, fmt.Errorf("cbor: unsupported major type %d", major)
+}
+
+// cborArgument reads the argument that follows an initial byte with
+// additional information info. Indefinite lengths are not supported.
+func cborArgument(data []byte, info byte) (uint64, []byte, error) {
+	switch {
+	case info < 24:
+		return uint64(info), data, nil
+	case info == 24:
+		if len(data) < 1 {
+			return 0, nil, errCBORTruncated
+		}
+		return uint64(data[0]), data[1:], nil
+	case info == 25:
+		if len(data) < 2 {
+			return 0, nil, errCBORTruncated
+		}
+		return uint64(binary.BigEndian.Uint16(data)), data[2:], nil
+	case info == 26:
+		if len(data) < 4 {
+			return 0, nil, errCBORTruncated
+		}
+		return uint64(binary.BigEndian.Uint32(data)), data[4:], nil
+	case info == 27:
+		if len(data) < 8 {
+			return 0, nil, errCBORTruncated
+		}
+		return binary.BigEndian.Uint64(data), data[8:], nil
+	}
+	return 0, nil, fmt.Errorf("cbor: unsupported additional information %d", info)
+}
+
+func cborDecodeSimple(data []byte, info byte) (any, []byte, error) {
+	rest := data[1:]
+	switch info {
+	case 20:
+		return false, rest, nil
+	case 21:
+		return true, rest, nil
+	case 22, 23: // null, undefined
+		return nil, rest, nil
+	case 25, 26, 27: // half, single and double precision floats
+		n := map[byte]int{25: 2, 26: 4, 27: 8}[info]
+		if len(rest) < n {
+			return nil, nil, errCBORTruncated
+		}
+		var f float64
+		switch n {
+		case 2:
+			f = halfToFloat(binary.BigEndian.Uint16(rest))
+		case 4:
+			f = float64(math.Float32frombits(binary.BigEndian.Uint32(rest)))
+		case 8:
+			f = math.Float64frombits(binary.BigEndian.Uint64(rest))
+		}
+		return f, rest[n:], nil
+	}
+	return nil, nil, fmt.Errorf("cbor: unsupported simple value %d", info)
+}
+
+func halfToFloat(h uint16) float64 {
+	exp := int(h>>10) & 0x1f
+	mant := float64(h & 0x3ff)
+	var v float64
+	switch exp {
+	case 0:
+		v = mant * math.Pow(2, -24)
+	case 31:
+		if mant == 0 {
+			v = math.Inf(1)
+		} else {
+			v = math.NaN()
+		}
+	default:
+		v = (1 + mant/1024) * math.Pow(2, float64(exp-15))
+	}
+	if h&0x8000 != 0 {
+		return -v
+	}
+	return v
+}
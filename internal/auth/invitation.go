@@ -0,0 +1,34 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+)
+
+const (
+	invitationTokenLength = 32 // 32 bytes = 64 hex chars
+	invitationTokenPrefix = "wgi_"
+)
+
+// GenerateInvitationToken generates a random peer invitation token and
+// returns the token, its SHA-256 hash, and a display prefix.
+func GenerateInvitationToken() (token, hash, prefix string, err error) {
+	b := make([]byte, invitationTokenLength)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", "", fmt.Errorf("generate invitation token: %w", err)
+	}
+
+	token = invitationTokenPrefix + hex.EncodeToString(b)
+	hash = HashInvitationToken(token)
+	prefix = token[:len(invitationTokenPrefix)+8] + "..."
+
+	return token, hash, prefix, nil
+}
+
+// HashInvitationToken returns the SHA-256 hash of an invitation token.
+func HashInvitationToken(token string) string {
+	h := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(h[:])
+}
@@ -3,19 +3,39 @@ package auth
 import (
 	"context"
 	"crypto/rand"
+	"encoding/hex"
 	"fmt"
 	"log/slog"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 )
 
+// ChallengeTTL is how long a user has to complete the second login step.
+const ChallengeTTL = 5 * time.Minute
+
+// MaxChallengeFailures is how many wrong second factors a login challenge
+// allows before it is revoked and the login must start over.
+const MaxChallengeFailures = 3
+
+// challengeAudience marks login challenge tokens, so they cannot be used
+// as sessions.
+const challengeAudience = "wgpilot-2fa"
+
 // Claims represents the JWT payload for wgpilot sessions.
 type Claims struct {
 	jwt.RegisteredClaims
 	Username string `json:"username"`
 	Role     string `json:"role"`
+
+	// APIKeyID, APIKeyScopes and APIKeyNetworks are set by the auth
+	// middleware for requests made with an API key. They are never part of
+	// a token. Empty scopes or networks mean the key is not restricted.
+	APIKeyID       int64    `json:"-"`
+	APIKeyScopes   []string `json:"-"`
+	APIKeyNetworks []int64  `json:"-"`
 }
 
 // JWTService handles JWT generation and validation.
@@ -44,9 +64,22 @@ func (s *JWTService) TTL() time.Duration {
 
 // Generate creates a signed JWT for the given user.
 func (s *JWTService) Generate(userID int64, username, role string) (string, error) {
+	signed, _, err := s.GenerateSession(userID, username, role)
+	return signed, err
+}
+
+// GenerateSession creates a signed JWT for the given user and returns it
+// with its claims. Each token gets a random JWT ID, under which the server
+// records the session so that it can be revoked.
+func (s *JWTService) GenerateSession(userID int64, username, role string) (string, *Claims, error) {
+	jti, err := GenerateSecret(16)
+	if err != nil {
+		return "", nil, fmt.Errorf("jwt: generate id: %w", err)
+	}
 	now := time.Now()
-	claims := Claims{
+	claims := &Claims{
 		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        hex.EncodeToString(jti),
 			Subject:   strconv.FormatInt(userID, 10),
 			IssuedAt:  jwt.NewNumericDate(now),
 			ExpiresAt: jwt.NewNumericDate(now.Add(s.ttl)),
@@ -58,19 +91,115 @@ func (s *JWTService) Generate(userID int64, username, role string) (string, erro
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	signed, err := token.SignedString(s.secret)
 	if err != nil {
-		return "", fmt.Errorf("jwt: sign token: %w", err)
+		return "", nil, fmt.Errorf("jwt: sign token: %w", err)
 	}
-	return signed, nil
+	return signed, claims, nil
 }
 
-// Validate parses and validates a JWT string, returning the claims if valid.
+// Validate parses and validates a session JWT string, returning the claims
+// if valid. Challenge tokens are rejected.
 func (s *JWTService) Validate(tokenString string) (*Claims, error) {
+	claims, err := s.parse(tokenString)
+	if err != nil {
+		return nil, err
+	}
+	if len(claims.Audience) > 0 {
+		return nil, fmt.Errorf("jwt: not a session token")
+	}
+	return claims, nil
+}
+
+// GenerateChallenge creates a short-lived token proving that a user has
+// passed the password step of login. It is not a session: Validate rejects
+// it, and it can only be exchanged for one with a second factor.
+func (s *JWTService) GenerateChallenge(userID int64, username, role string) (string, error) {
+	jti, err := GenerateSecret(16)
+	if err != nil {
+		return "", fmt.Errorf("jwt: generate id: %w", err)
+	}
+	now := time.Now()
+	claims := Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        hex.EncodeToString(jti),
+			Subject:   strconv.FormatInt(userID, 10),
+			Audience:  jwt.ClaimStrings{challengeAudience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(ChallengeTTL)),
+		},
+		Username: username,
+		Role:     role,
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	signed, err := token.SignedString(s.secret)
+	if err != nil {
+		return "", fmt.Errorf("jwt: sign challenge: %w", err)
+	}
+	return signed, nil
+}
+
+// ValidateChallenge parses a token created by GenerateChallenge.
+func (s *JWTService) ValidateChallenge(tokenString string) (*Claims, error) {
+	claims, err := s.parse(tokenString, jwt.WithAudience(challengeAudience))
+	if err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// ChallengeFailures counts the failed second factors of each login
+// challenge, by token ID, until the challenge expires.
+type ChallengeFailures struct {
+	mu       sync.Mutex
+	failures map[string]challengeFailures
+}
+
+type challengeFailures struct {
+	count   int
+	expires time.Time
+}
+
+// NewChallengeFailures creates an empty failure counter.
+func NewChallengeFailures() *ChallengeFailures {
+	return &ChallengeFailures{failures: make(map[string]challengeFailures)}
+}
+
+// Fail records a failed second factor for the challenge and reports whether
+// the challenge is now revoked.
+func (c *ChallengeFailures) Fail(claims *Claims) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	for id, f := range c.failures {
+		if now.After(f.expires) {
+			delete(c.failures, id)
+		}
+	}
+	f := c.failures[claims.ID]
+	f.count++
+	f.expires = now.Add(ChallengeTTL)
+	if claims.ExpiresAt != nil {
+		f.expires = claims.ExpiresAt.Time
+	}
+	c.failures[claims.ID] = f
+	return f.count >= MaxChallengeFailures
+}
+
+// Revoked reports whether the challenge has used up its attempts.
+func (c *ChallengeFailures) Revoked(claims *Claims) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.failures[claims.ID].count >= MaxChallengeFailures
+}
+
+func (s *JWTService) parse(tokenString string, opts ...jwt.ParserOption) (*Claims, error) {
 	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(t *jwt.Token) (any, error) {
 		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, fmt.Errorf("jwt: unexpected signing method %v", t.Header["alg"])
 		}
 		return s.secret, nil
-	})
+	}, opts...)
 	if err != nil {
 		return nil, fmt.Errorf("jwt: parse token: %w", err)
 	}
@@ -222,6 +222,34 @@ func TestJWTService_TTL(t *testing.T) {
 	}
 }
 
+func TestJWTService_GenerateSession(t *testing.T) {
+	svc, err := NewJWTService(testSecret(), time.Hour, testLogger())
+	if err != nil {
+		t.Fatalf("NewJWTService: %v", err)
+	}
+
+	token, claims, err := svc.GenerateSession(7, "alice", "viewer")
+	if err != nil {
+		t.Fatalf("GenerateSession: %v", err)
+	}
+	if claims.ID == "" || claims.Subject != "7" {
+		t.Fatalf("unexpected claims %+v", claims)
+	}
+	parsed, err := svc.Validate(token)
+	if err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	if parsed.ID != claims.ID {
+		t.Errorf("jti = %q, want %q", parsed.ID, claims.ID)
+	}
+
+	// Every token gets its own ID.
+	_, other, _ := svc.GenerateSession(7, "alice", "viewer")
+	if other.ID == claims.ID {
+		t.Error("two sessions should not share an ID")
+	}
+}
+
 func TestGenerateSecret(t *testing.T) {
 	secret, err := GenerateSecret(32)
 	if err != nil {
@@ -237,3 +265,61 @@ func TestGenerateSecret(t *testing.T) {
 		t.Error("two secrets should not be equal")
 	}
 }
+
+func TestJWTService_Challenge(t *testing.T) {
+	svc, err := NewJWTService(testSecret(), 24*time.Hour, testLogger())
+	if err != nil {
+		t.Fatalf("NewJWTService: %v", err)
+	}
+
+	challenge, err := svc.GenerateChallenge(7, "alice", "admin")
+	if err != nil {
+		t.Fatalf("GenerateChallenge: %v", err)
+	}
+	claims, err := svc.ValidateChallenge(challenge)
+	if err != nil {
+		t.Fatalf("ValidateChallenge: %v", err)
+	}
+	if claims.Subject != "7" || claims.Username != "alice" {
+		t.Errorf("unexpected claims %+v", claims)
+	}
+
+	// A challenge must not be usable as a session, nor a session as a challenge.
+	if _, err := svc.Validate(challenge); err == nil {
+		t.Error("Validate should reject a challenge token")
+	}
+	session, err := svc.Generate(7, "alice", "admin")
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	if _, err := svc.ValidateChallenge(session); err == nil {
+		t.Error("ValidateChallenge should reject a session token")
+	}
+}
+
+func TestChallengeFailures(t *testing.T) {
+	svc, err := NewJWTService(testSecret(), 24*time.Hour, testLogger())
+	if err != nil {
+		t.Fatalf("NewJWTService: %v", err)
+	}
+	first, _ := svc.GenerateChallenge(7, "alice", "admin")
+	second, _ := svc.GenerateChallenge(7, "alice", "admin")
+	a, _ := svc.ValidateChallenge(first)
+	b, _ := svc.ValidateChallenge(second)
+	if a.ID == "" || a.ID == b.ID {
+		t.Fatalf("expected distinct challenge IDs, got %q and %q", a.ID, b.ID)
+	}
+
+	failures := NewChallengeFailures()
+	for i := 1; i < MaxChallengeFailures; i++ {
+		if failures.Fail(a) {
+			t.Fatalf("challenge revoked after %d failures", i)
+		}
+	}
+	if !failures.Fail(a) || !failures.Revoked(a) {
+		t.Fatalf("expected challenge revoked after %d failures", MaxChallengeFailures)
+	}
+	if failures.Revoked(b) {
+		t.Error("another challenge must not be revoked")
+	}
+}
@@ -0,0 +1,636 @@
+package auth
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// LDAP protocol operations (RFC 4511 §4.2–4.12) as BER identifier octets.
+const (
+	ldapBindRequest      = berApplication | berConstructed | 0
+	ldapBindResponse     = berApplication | berConstructed | 1
+	ldapUnbindRequest    = berApplication | 2
+	ldapSearchRequest    = berApplication | berConstructed | 3
+	ldapSearchEntry      = berApplication | berConstructed | 4
+	ldapSearchDone       = berApplication | berConstructed | 5
+	ldapSearchReference  = berApplication | berConstructed | 19
+	ldapExtendedRequest  = berApplication | berConstructed | 23
+	ldapExtendedResponse = berApplication | berConstructed | 24
+)
+
+// LDAP result codes the client acts on.
+const (
+	ldapResultSuccess            = 0
+	ldapResultSizeLimitExceeded  = 4
+	ldapResultInvalidCredentials = 49
+)
+
+// ldapStartTLSOID is the StartTLS extended operation (RFC 4511 §4.14).
+const ldapStartTLSOID = "1.3.6.1.4.1.1466.20037"
+
+// Defaults for LDAPConfig.
+const (
+	DefaultLDAPUserFilter  = "(uid={username})"
+	DefaultLDAPGroupFilter = "(member={dn})"
+	defaultLDAPGroupAttr   = "memberOf"
+	defaultLDAPTimeout     = 10 * time.Second
+)
+
+// ErrLDAPInvalidCredentials is returned when the user does not exist in the
+// directory or the password is wrong. The two are not distinguished.
+var ErrLDAPInvalidCredentials = errors.New("ldap: invalid credentials")
+
+// LDAPConfig configures an LDAP or Active Directory authentication backend.
+type LDAPConfig struct {
+	URL            string      // ldap://host[:389] or ldaps://host[:636]
+	StartTLS       bool        // upgrade an ldap:// connection before binding
+	TLSConfig      *tls.Config // optional; the server name defaults to the URL host
+	BindDN         string      // service account used to search; empty binds anonymously
+	BindPassword   string
+	BaseDN         string        // subtree searched for users
+	UserFilter     string        // default DefaultLDAPUserFilter; {username} is escaped
+	GroupAttribute string        // user attribute listing group DNs; default memberOf
+	GroupBaseDN    string        // optional; search for groups here instead of reading GroupAttribute
+	GroupFilter    string        // default DefaultLDAPGroupFilter; {dn} is the user's DN
+	Timeout        time.Duration // per login; default 10s
+}
+
+// LDAPUser is a user authenticated against the directory.
+type LDAPUser struct {
+	DN     string
+	Groups []string // group DNs
+}
+
+// LDAPAuthenticator verifies passwords against an LDAP directory: it binds
+// with the service account, searches for the user and then binds as the
+// user. Each login uses a fresh connection.
+type LDAPAuthenticator struct {
+	cfg  LDAPConfig
+	addr string
+	tls  bool // LDAPS
+}
+
+// ldapResultError is a non-success LDAPResult.
+type ldapResultError struct {
+	code    int64
+	message string
+}
+
+func (e *ldapResultError) Error() string {
+	if e.message == "" {
+		return fmt.Sprintf("ldap: result code %d", e.code)
+	}
+	return fmt.Sprintf("ldap: result code %d: %s", e.code, e.message)
+}
+
+// NewLDAPAuthenticator validates cfg and fills in defaults. It does not
+// connect; an unreachable server surfaces on the first login.
+func NewLDAPAuthenticator(cfg LDAPConfig) (*LDAPAuthenticator, error) {
+	u, err := url.Parse(cfg.URL)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("ldap: invalid url %q", cfg.URL)
+	}
+	a := &LDAPAuthenticator{addr: u.Host}
+	switch u.Scheme {
+	case "ldap":
+		if u.Port() == "" {
+			a.addr = net.JoinHostPort(u.Hostname(), "389")
+		}
+	case "ldaps":
+		if cfg.StartTLS {
+			return nil, errors.New("ldap: StartTLS cannot be combined with ldaps://")
+		}
+		a.tls = true
+		if u.Port() == "" {
+			a.addr = net.JoinHostPort(u.Hostname(), "636")
+		}
+	default:
+		return nil, fmt.Errorf("ldap: url scheme must be ldap or ldaps, got %q", u.Scheme)
+	}
+	if cfg.BaseDN == "" {
+		return nil, errors.New("ldap: base DN is required")
+	}
+
+	if cfg.UserFilter == "" {
+		cfg.UserFilter = DefaultLDAPUserFilter
+	}
+	if cfg.GroupAttribute == "" {
+		cfg.GroupAttribute = defaultLDAPGroupAttr
+	}
+	if cfg.GroupFilter == "" {
+		cfg.GroupFilter = DefaultLDAPGroupFilter
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaultLDAPTimeout
+	}
+	if cfg.TLSConfig == nil {
+		cfg.TLSConfig = &tls.Config{}
+	} else {
+		cfg.TLSConfig = cfg.TLSConfig.Clone()
+	}
+	if cfg.TLSConfig.ServerName == "" {
+		cfg.TLSConfig.ServerName = u.Hostname()
+	}
+	cfg.TLSConfig.MinVersion = max(cfg.TLSConfig.MinVersion, tls.VersionTLS12)
+
+	if _, err := compileLDAPFilter(strings.ReplaceAll(cfg.UserFilter, "{username}", "x")); err != nil {
+		return nil, fmt.Errorf("ldap: user filter: %w", err)
+	}
+	if _, err := compileLDAPFilter(strings.ReplaceAll(cfg.GroupFilter, "{dn}", "x")); err != nil {
+		return nil, fmt.Errorf("ldap: group filter: %w", err)
+	}
+	a.cfg = cfg
+	return a, nil
+}
+
+// Authenticate verifies username and password and returns the user's entry.
+// It returns ErrLDAPInvalidCredentials if the user is unknown or the password
+// is wrong, and another error if the directory could not be queried.
+func (a *LDAPAuthenticator) Authenticate(ctx context.Context, username, password string) (*LDAPUser, error) {
+	// A bind with a DN and an empty password is an "unauthenticated bind"
+	// (RFC 4513 §5.1.2) that many servers accept; it must never count as a
+	// login.
+	if username == "" || password == "" {
+		return nil, ErrLDAPInvalidCredentials
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, a.cfg.Timeout)
+	defer cancel()
+	c, err := a.dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer c.close()
+
+	if err := c.bind(a.cfg.BindDN, a.cfg.BindPassword); err != nil {
+		return nil, fmt.Errorf("ldap: service account bind: %w", err)
+	}
+
+	filter := strings.ReplaceAll(a.cfg.UserFilter, "{username}", ldapEscape(username))
+	entries, err := c.search(a.cfg.BaseDN, filter, []string{a.cfg.GroupAttribute}, 2)
+	if err != nil {
+		return nil, fmt.Errorf("ldap: search user: %w", err)
+	}
+	switch len(entries) {
+	case 0:
+		return nil, ErrLDAPInvalidCredentials
+	case 1:
+	default:
+		return nil, fmt.Errorf("ldap: user filter matches %d entries for %q", len(entries), username)
+	}
+	user := &LDAPUser{DN: entries[0].dn, Groups: entries[0].attr(a.cfg.GroupAttribute)}
+
+	// Groups are looked up before binding as the user, who may not be
+	// allowed to search.
+	if a.cfg.GroupBaseDN != "" {
+		filter := strings.ReplaceAll(a.cfg.GroupFilter, "{dn}", ldapEscape(user.DN))
+		groups, err := c.search(a.cfg.GroupBaseDN, filter, []string{"1.1"}, 0)
+		if err != nil {
+			return nil, fmt.Errorf("ldap: search groups: %w", err)
+		}
+		user.Groups = nil
+		for _, g := range groups {
+			user.Groups = append(user.Groups, g.dn)
+		}
+	}
+
+	if err := c.bind(user.DN, password); err != nil {
+		var res *ldapResultError
+		if errors.As(err, &res) && res.code == ldapResultInvalidCredentials {
+			return nil, ErrLDAPInvalidCredentials
+		}
+		return nil, fmt.Errorf("ldap: user bind: %w", err)
+	}
+	return user, nil
+}
+
+// ldapEscape escapes a value for use in a search filter (RFC 4515 §3).
+func ldapEscape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '*', '(', ')', '\\', 0:
+			fmt.Fprintf(&b, "\\%02x", c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// ── Connection ───────────────────────────────────────────────────────
+
+type ldapConn struct {
+	conn  net.Conn
+	r     *bufio.Reader
+	msgID int64
+}
+
+type ldapEntry struct {
+	dn    string
+	attrs map[string][]string // keyed by lower-case attribute name
+}
+
+func (e ldapEntry) attr(name string) []string {
+	return e.attrs[strings.ToLower(name)]
+}
+
+func (a *LDAPAuthenticator) dial(ctx context.Context) (*ldapConn, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", a.addr)
+	if err != nil {
+		return nil, fmt.Errorf("ldap: connect %s: %w", a.addr, err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	c := &ldapConn{conn: conn, r: bufio.NewReader(conn)}
+
+	if a.tls || a.cfg.StartTLS {
+		if !a.tls {
+			if err := c.startTLS(); err != nil {
+				conn.Close()
+				return nil, err
+			}
+		}
+		tlsConn := tls.Client(conn, a.cfg.TLSConfig)
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("ldap: tls handshake with %s: %w", a.addr, err)
+		}
+		c.conn = tlsConn
+		c.r = bufio.NewReader(tlsConn)
+	}
+	return c, nil
+}
+
+func (c *ldapConn) close() {
+	c.send(berEncode(ldapUnbindRequest))
+	c.conn.Close()
+}
+
+// send wraps op in an LDAPMessage and returns its message ID.
+func (c *ldapConn) send(op []byte) (int64, error) {
+	c.msgID++
+	msg := berEncode(berSequence, berInt(berInteger, c.msgID), op)
+	if _, err := c.conn.Write(msg); err != nil {
+		return 0, fmt.Errorf("ldap: write: %w", err)
+	}
+	return c.msgID, nil
+}
+
+// receive reads the next message and returns its protocol operation.
+func (c *ldapConn) receive(id int64) (*berElement, error) {
+	raw, err := berReadElement(c.r)
+	if err != nil {
+		return nil, fmt.Errorf("ldap: read: %w", err)
+	}
+	msg, _, err := berDecode(raw)
+	if err != nil {
+		return nil, fmt.Errorf("ldap: decode message: %w", err)
+	}
+	if msg.tag != berSequence || len(msg.children) < 2 {
+		return nil, errors.New("ldap: malformed message")
+	}
+	got, err := msg.children[0].int()
+	if err != nil {
+		return nil, fmt.Errorf("ldap: message id: %w", err)
+	}
+	if got != id {
+		// Message ID 0 is an unsolicited notification, e.g. Notice of
+		// Disconnection.
+		return nil, fmt.Errorf("ldap: unexpected message id %d, want %d", got, id)
+	}
+	return msg.children[1], nil
+}
+
+func (c *ldapConn) bind(dn, password string) error {
+	id, err := c.send(berEncode(ldapBindRequest,
+		berInt(berInteger, 3),
+		berString(berOctetString, dn),
+		berString(berContext|0, password),
+	))
+	if err != nil {
+		return err
+	}
+	op, err := c.receive(id)
+	if err != nil {
+		return err
+	}
+	if op.tag != ldapBindResponse {
+		return fmt.Errorf("ldap: unexpected response 0x%02x to bind", op.tag)
+	}
+	return ldapResult(op)
+}
+
+func (c *ldapConn) startTLS() error {
+	id, err := c.send(berEncode(ldapExtendedRequest, berString(berContext|0, ldapStartTLSOID)))
+	if err != nil {
+		return err
+	}
+	op, err := c.receive(id)
+	if err != nil {
+		return err
+	}
+	if op.tag != ldapExtendedResponse {
+		return fmt.Errorf("ldap: unexpected response 0x%02x to StartTLS", op.tag)
+	}
+	if err := ldapResult(op); err != nil {
+		return fmt.Errorf("ldap: StartTLS: %w", err)
+	}
+	return nil
+}
+
+// search runs a subtree search. A sizeLimit of 0 means no limit.
+func (c *ldapConn) search(baseDN, filter string, attrs []string, sizeLimit int64) ([]ldapEntry, error) {
+	f, err := compileLDAPFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+	var attrList [][]byte
+	for _, a := range attrs {
+		attrList = append(attrList, berString(berOctetString, a))
+	}
+	id, err := c.send(berEncode(ldapSearchRequest,
+		berString(berOctetString, baseDN),
+		berInt(berEnumerated, 2), // wholeSubtree
+		berInt(berEnumerated, 0), // neverDerefAliases
+		berInt(berInteger, sizeLimit),
+		berInt(berInteger, 0),
+		berBool(false),
+		f,
+		berEncode(berSequence, attrList...),
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []ldapEntry
+	for {
+		op, err := c.receive(id)
+		if err != nil {
+			return nil, err
+		}
+		switch op.tag {
+		case ldapSearchEntry:
+			entry, err := parseLDAPEntry(op)
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, entry)
+		case ldapSearchReference:
+			// Referrals to other servers are not followed.
+		case ldapSearchDone:
+			err := ldapResult(op)
+			var res *ldapResultError
+			if errors.As(err, &res) && res.code == ldapResultSizeLimitExceeded && len(entries) > 0 {
+				return entries, nil
+			}
+			return entries, err
+		default:
+			return nil, fmt.Errorf("ldap: unexpected response 0x%02x to search", op.tag)
+		}
+	}
+}
+
+func parseLDAPEntry(op *berElement) (ldapEntry, error) {
+	if len(op.children) < 2 {
+		return ldapEntry{}, errors.New("ldap: malformed search entry")
+	}
+	entry := ldapEntry{dn: string(op.children[0].value), attrs: make(map[string][]string)}
+	for _, attr := range op.children[1].children {
+		if len(attr.children) < 2 {
+			return ldapEntry{}, errors.New("ldap: malformed attribute")
+		}
+		name := strings.ToLower(string(attr.children[0].value))
+		for _, v := range attr.children[1].children {
+			entry.attrs[name] = append(entry.attrs[name], string(v.value))
+		}
+	}
+	return entry, nil
+}
+
+// ldapResult checks the LDAPResult at the start of a response.
+func ldapResult(op *berElement) error {
+	codeElem, err := op.child(0)
+	if err != nil {
+		return err
+	}
+	code, err := codeElem.int()
+	if err != nil {
+		return err
+	}
+	if code == ldapResultSuccess {
+		return nil
+	}
+	res := &ldapResultError{code: code}
+	if len(op.children) > 2 {
+		res.message = string(op.children[2].value)
+	}
+	return res
+}
+
+// ── Filters ──────────────────────────────────────────────────────────
+
+// compileLDAPFilter encodes a string search filter (RFC 4515), e.g.
+// "(&(objectClass=person)(uid=alice))", as BER.
+func compileLDAPFilter(s string) ([]byte, error) {
+	p := &ldapFilterParser{s: s}
+	f, err := p.filter(0)
+	if err != nil {
+		return nil, err
+	}
+	if p.pos != len(s) {
+		return nil, fmt.Errorf("unexpected %q after filter", s[p.pos:])
+	}
+	return f, nil
+}
+
+type ldapFilterParser struct {
+	s   string
+	pos int
+}
+
+func (p *ldapFilterParser) filter(depth int) ([]byte, error) {
+	if depth > berMaxDepth {
+		return nil, errors.New("filter nested too deeply")
+	}
+	if p.pos >= len(p.s) || p.s[p.pos] != '(' {
+		return nil, fmt.Errorf("expected '(' at offset %d", p.pos)
+	}
+	p.pos++
+	if p.pos >= len(p.s) {
+		return nil, errors.New("unterminated filter")
+	}
+
+	var f []byte
+	var err error
+	switch p.s[p.pos] {
+	case '&', '|':
+		tag := byte(berContext | berConstructed | 0)
+		if p.s[p.pos] == '|' {
+			tag = berContext | berConstructed | 1
+		}
+		p.pos++
+		var list [][]byte
+		for p.pos < len(p.s) && p.s[p.pos] == '(' {
+			sub, err := p.filter(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, sub)
+		}
+		f = berEncode(tag, list...)
+	case '!':
+		p.pos++
+		sub, err := p.filter(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		f = berEncode(berContext|berConstructed|2, sub)
+	default:
+		end := strings.IndexByte(p.s[p.pos:], ')')
+		if end < 0 {
+			return nil, errors.New("unterminated filter")
+		}
+		f, err = ldapFilterItem(p.s[p.pos : p.pos+end])
+		if err != nil {
+			return nil, err
+		}
+		p.pos += end
+	}
+
+	if p.pos >= len(p.s) || p.s[p.pos] != ')' {
+		return nil, fmt.Errorf("expected ')' at offset %d", p.pos)
+	}
+	p.pos++
+	return f, nil
+}
+
+// ldapFilterItem encodes a simple, presence, substring or extensible match.
+func ldapFilterItem(item string) ([]byte, error) {
+	eq := strings.IndexByte(item, '=')
+	if eq <= 0 {
+		return nil, fmt.Errorf("invalid filter item %q", item)
+	}
+	attr, raw := item[:eq], item[eq+1:]
+
+	tag := byte(berContext | berConstructed | 3) // equalityMatch
+	switch attr[len(attr)-1] {
+	case '~':
+		tag, attr = berContext|berConstructed|8, attr[:len(attr)-1]
+	case '>':
+		tag, attr = berContext|berConstructed|5, attr[:len(attr)-1]
+	case '<':
+		tag, attr = berContext|berConstructed|6, attr[:len(attr)-1]
+	case ':':
+		return ldapExtensibleMatch(attr[:len(attr)-1], raw)
+	}
+	if attr == "" {
+		return nil, fmt.Errorf("invalid filter item %q", item)
+	}
+
+	if tag == berContext|berConstructed|3 && strings.Contains(raw, "*") {
+		if raw == "*" {
+			return berString(berContext|7, attr), nil // present
+		}
+		parts := strings.Split(raw, "*")
+		var subs [][]byte
+		for i, part := range parts {
+			if part == "" {
+				continue
+			}
+			v, err := ldapUnescape(part)
+			if err != nil {
+				return nil, err
+			}
+			switch i {
+			case 0:
+				subs = append(subs, berString(berContext|0, v)) // initial
+			case len(parts) - 1:
+				subs = append(subs, berString(berContext|2, v)) // final
+			default:
+				subs = append(subs, berString(berContext|1, v)) // any
+			}
+		}
+		return berEncode(berContext|berConstructed|4,
+			berString(berOctetString, attr),
+			berEncode(berSequence, subs...),
+		), nil
+	}
+
+	v, err := ldapUnescape(raw)
+	if err != nil {
+		return nil, err
+	}
+	return berEncode(tag, berString(berOctetString, attr), berString(berOctetString, v)), nil
+}
+
+// ldapExtensibleMatch encodes "attr[:dn][:rule]:=value", e.g. Active
+// Directory's transitive group membership rule
+// "memberOf:1.2.840.113556.1.4.1941:=<group DN>".
+func ldapExtensibleMatch(desc, raw string) ([]byte, error) {
+	parts := strings.Split(desc, ":")
+	var fields [][]byte
+	attr, dnAttrs, rule := parts[0], false, ""
+	for _, p := range parts[1:] {
+		switch {
+		case strings.EqualFold(p, "dn"):
+			dnAttrs = true
+		case p != "" && rule == "":
+			rule = p
+		default:
+			return nil, fmt.Errorf("invalid extensible match %q", desc)
+		}
+	}
+	if attr == "" && rule == "" {
+		return nil, fmt.Errorf("invalid extensible match %q", desc)
+	}
+	v, err := ldapUnescape(raw)
+	if err != nil {
+		return nil, err
+	}
+	if rule != "" {
+		fields = append(fields, berString(berContext|1, rule))
+	}
+	if attr != "" {
+		fields = append(fields, berString(berContext|2, attr))
+	}
+	fields = append(fields, berString(berContext|3, v))
+	if dnAttrs {
+		fields = append(fields, berEncode(berContext|4, []byte{0xff}))
+	}
+	return berEncode(berContext|berConstructed|9, fields...), nil
+}
+
+// ldapUnescape decodes \XX escapes in a filter value.
+func ldapUnescape(s string) (string, error) {
+	if !strings.Contains(s, `\`) {
+		return s, nil
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' {
+			b.WriteByte(s[i])
+			continue
+		}
+		if i+2 >= len(s) {
+			return "", fmt.Errorf("invalid escape in %q", s)
+		}
+		c, err := hex.DecodeString(s[i+1 : i+3])
+		if err != nil {
+			return "", fmt.Errorf("invalid escape in %q", s)
+		}
+		b.Write(c)
+		i += 2
+	}
+	return b.String(), nil
+}
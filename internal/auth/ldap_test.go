@@ -0,0 +1,185 @@
+package auth
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/itsChris/wgpilot/internal/testutil"
+)
+
+const (
+	testBaseDN    = "dc=example,dc=com"
+	testServiceDN = "cn=svc,ou=services,dc=example,dc=com"
+	testAdminsDN  = "cn=vpn-admins,ou=groups,dc=example,dc=com"
+	testAliceDN   = "uid=alice,ou=people,dc=example,dc=com"
+)
+
+func newMockDirectory(t *testing.T, ldaps bool) *testutil.MockLDAPServer {
+	t.Helper()
+	dir, err := testutil.NewMockLDAPServer(ldaps)
+	if err != nil {
+		t.Fatalf("NewMockLDAPServer: %v", err)
+	}
+	t.Cleanup(dir.Close)
+	dir.AddEntry(testServiceDN, "svcpass", nil)
+	dir.AddEntry(testAliceDN, "alicepass", map[string][]string{
+		"objectClass": {"person"},
+		"uid":         {"alice"},
+		"memberOf":    {testAdminsDN},
+	})
+	dir.AddEntry(testAdminsDN, "", map[string][]string{
+		"objectClass": {"groupOfNames"},
+		"member":      {testAliceDN},
+	})
+	return dir
+}
+
+func newTestLDAP(t *testing.T, cfg LDAPConfig) *LDAPAuthenticator {
+	t.Helper()
+	cfg.BindDN, cfg.BindPassword, cfg.BaseDN = testServiceDN, "svcpass", testBaseDN
+	a, err := NewLDAPAuthenticator(cfg)
+	if err != nil {
+		t.Fatalf("NewLDAPAuthenticator: %v", err)
+	}
+	return a
+}
+
+func TestLDAPAuthenticator_Authenticate(t *testing.T) {
+	dir := newMockDirectory(t, false)
+	a := newTestLDAP(t, LDAPConfig{URL: dir.URL})
+	ctx := context.Background()
+
+	user, err := a.Authenticate(ctx, "alice", "alicepass")
+	if err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	if user.DN != testAliceDN || !slices.Equal(user.Groups, []string{testAdminsDN}) {
+		t.Errorf("unexpected user %+v", user)
+	}
+
+	tests := []struct {
+		name, username, password string
+	}{
+		{"wrong password", "alice", "wrong"},
+		{"unknown user", "bob", "alicepass"},
+		// The server accepts an unauthenticated bind for any DN.
+		{"empty password", "alice", ""},
+		// An unescaped "*" would match every uid.
+		{"wildcard username", "*", "alicepass"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := a.Authenticate(ctx, tt.username, tt.password); !errors.Is(err, ErrLDAPInvalidCredentials) {
+				t.Errorf("expected ErrLDAPInvalidCredentials, got %v", err)
+			}
+		})
+	}
+}
+
+func TestLDAPAuthenticator_TLS(t *testing.T) {
+	tests := []struct {
+		name     string
+		ldaps    bool
+		startTLS bool
+	}{
+		{"ldaps", true, false},
+		{"starttls", false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := newMockDirectory(t, tt.ldaps)
+			a := newTestLDAP(t, LDAPConfig{
+				URL:       dir.URL,
+				StartTLS:  tt.startTLS,
+				TLSConfig: &tls.Config{RootCAs: dir.CertPool()},
+			})
+			if _, err := a.Authenticate(context.Background(), "alice", "alicepass"); err != nil {
+				t.Fatalf("Authenticate: %v", err)
+			}
+
+			// An untrusted certificate fails the login.
+			a = newTestLDAP(t, LDAPConfig{URL: dir.URL, StartTLS: tt.startTLS})
+			if _, err := a.Authenticate(context.Background(), "alice", "alicepass"); err == nil || errors.Is(err, ErrLDAPInvalidCredentials) {
+				t.Errorf("expected a TLS error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestLDAPAuthenticator_GroupSearch(t *testing.T) {
+	dir := newMockDirectory(t, false)
+	a := newTestLDAP(t, LDAPConfig{
+		URL:            dir.URL,
+		UserFilter:     "(&(objectClass=person)(uid={username}))",
+		GroupAttribute: "none",
+		GroupBaseDN:    "ou=groups," + testBaseDN,
+		GroupFilter:    "(&(objectClass=groupOfNames)(member={dn}))",
+	})
+	user, err := a.Authenticate(context.Background(), "alice", "alicepass")
+	if err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	if !slices.Equal(user.Groups, []string{testAdminsDN}) {
+		t.Errorf("groups = %v, want [%s]", user.Groups, testAdminsDN)
+	}
+}
+
+func TestLDAPAuthenticator_Errors(t *testing.T) {
+	dir := newMockDirectory(t, false)
+	ctx := context.Background()
+
+	// A wrong service password is a configuration error, not a failed login.
+	a, _ := NewLDAPAuthenticator(LDAPConfig{URL: dir.URL, BindDN: testServiceDN, BindPassword: "wrong", BaseDN: testBaseDN})
+	if _, err := a.Authenticate(ctx, "alice", "alicepass"); err == nil || errors.Is(err, ErrLDAPInvalidCredentials) {
+		t.Errorf("expected a service bind error, got %v", err)
+	}
+
+	dir.Close()
+	a = newTestLDAP(t, LDAPConfig{URL: dir.URL})
+	if _, err := a.Authenticate(ctx, "alice", "alicepass"); err == nil || errors.Is(err, ErrLDAPInvalidCredentials) {
+		t.Errorf("expected a connection error, got %v", err)
+	}
+}
+
+func TestNewLDAPAuthenticator_Validation(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  LDAPConfig
+	}{
+		{"bad scheme", LDAPConfig{URL: "http://dc.example.com", BaseDN: testBaseDN}},
+		{"no base DN", LDAPConfig{URL: "ldap://dc.example.com"}},
+		{"starttls over ldaps", LDAPConfig{URL: "ldaps://dc.example.com", BaseDN: testBaseDN, StartTLS: true}},
+		{"bad filter", LDAPConfig{URL: "ldap://dc.example.com", BaseDN: testBaseDN, UserFilter: "(uid={username}"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewLDAPAuthenticator(tt.cfg); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestCompileLDAPFilter(t *testing.T) {
+	valid := []string{
+		"(uid=alice)",
+		"(&(objectClass=user)(sAMAccountName=alice))",
+		"(|(uid=a*)(cn=*li*e)(!(mail=*)))",
+		"(memberOf:1.2.840.113556.1.4.1941:=cn=vpn\\2c,dc=example,dc=com)",
+		"(uidNumber>=1000)",
+	}
+	for _, f := range valid {
+		if _, err := compileLDAPFilter(f); err != nil {
+			t.Errorf("compileLDAPFilter(%q): %v", f, err)
+		}
+	}
+	invalid := []string{"", "uid=alice", "(uid=alice", "(uid=alice))", "(=alice)", "(uid=\\zz)", "(&(uid=a)"}
+	for _, f := range invalid {
+		if _, err := compileLDAPFilter(f); err == nil {
+			t.Errorf("compileLDAPFilter(%q): expected an error", f)
+		}
+	}
+}
@@ -0,0 +1,395 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// OIDC timing parameters.
+const (
+	// OIDCLoginTimeout is how long a user has to complete a login at the
+	// identity provider.
+	OIDCLoginTimeout = 10 * time.Minute
+
+	// oidcMetadataTTL is how long discovery metadata is cached.
+	oidcMetadataTTL = time.Hour
+
+	// oidcKeyRefreshInterval rate-limits JWKS refetches triggered by an
+	// unknown key ID, e.g. after the provider rotated its keys.
+	oidcKeyRefreshInterval = time.Minute
+
+	// maxOIDCLogins caps pending logins, since anyone can start one.
+	maxOIDCLogins = 1000
+)
+
+// oidcSigningMethods are the ID token algorithms accepted. "none" and HMAC
+// are never accepted.
+var oidcSigningMethods = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512"}
+
+// OIDCConfig configures an OpenID Connect relying party.
+type OIDCConfig struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string       // empty for a public client
+	Scopes       []string     // "openid" is always requested
+	HTTPClient   *http.Client // optional; defaults to a client with a 10s timeout
+}
+
+// OIDCProvider runs the authorization code flow with PKCE (RFC 7636)
+// against an OpenID Connect provider and verifies the ID tokens it issues.
+// Discovery metadata and signing keys are fetched on first use and cached.
+type OIDCProvider struct {
+	cfg    OIDCConfig
+	client *http.Client
+
+	mu          sync.Mutex
+	meta        *oidcMetadata
+	metaFetched time.Time
+	keys        map[string]any // kid → *rsa.PublicKey or *ecdsa.PublicKey
+	keysFetched time.Time
+	pending     map[string]oidcLogin // keyed by state
+}
+
+type oidcMetadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// oidcLogin is a login waiting for the provider's callback.
+type oidcLogin struct {
+	redirectURL string
+	verifier    string
+	nonce       string
+	expires     time.Time
+}
+
+// NewOIDCProvider creates a provider. No request is made until the first
+// login, so an unreachable provider does not prevent startup.
+func NewOIDCProvider(cfg OIDCConfig) (*OIDCProvider, error) {
+	if cfg.Issuer == "" || cfg.ClientID == "" {
+		return nil, errors.New("oidc: issuer and client id are required")
+	}
+	u, err := url.Parse(cfg.Issuer)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return nil, fmt.Errorf("oidc: invalid issuer %q", cfg.Issuer)
+	}
+	if !slices.Contains(cfg.Scopes, "openid") {
+		cfg.Scopes = append([]string{"openid"}, cfg.Scopes...)
+	}
+	client := cfg.HTTPClient
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &OIDCProvider{
+		cfg:     cfg,
+		client:  client,
+		pending: make(map[string]oidcLogin),
+	}, nil
+}
+
+// Begin starts a login and returns the provider URL to send the browser
+// to, and the state that the callback will carry. redirectURL is this
+// server's callback URL and must be registered with the provider.
+func (p *OIDCProvider) Begin(ctx context.Context, redirectURL string) (authURL, state string, err error) {
+	meta, err := p.metadata(ctx)
+	if err != nil {
+		return "", "", err
+	}
+
+	var login oidcLogin
+	if state, err = randomToken(); err != nil {
+		return "", "", err
+	}
+	if login.nonce, err = randomToken(); err != nil {
+		return "", "", err
+	}
+	if login.verifier, err = randomToken(); err != nil {
+		return "", "", err
+	}
+	login.redirectURL = redirectURL
+	login.expires = time.Now().Add(OIDCLoginTimeout)
+
+	p.mu.Lock()
+	now := time.Now()
+	for k, v := range p.pending {
+		if now.After(v.expires) {
+			delete(p.pending, k)
+		}
+	}
+	if len(p.pending) >= maxOIDCLogins {
+		p.mu.Unlock()
+		return "", "", errors.New("oidc: too many pending logins")
+	}
+	p.pending[state] = login
+	p.mu.Unlock()
+
+	challenge := sha256.Sum256([]byte(login.verifier))
+	q := url.Values{}
+	q.Set("response_type", "code")
+	q.Set("client_id", p.cfg.ClientID)
+	q.Set("redirect_uri", redirectURL)
+	q.Set("scope", strings.Join(p.cfg.Scopes, " "))
+	q.Set("state", state)
+	q.Set("nonce", login.nonce)
+	q.Set("code_challenge", b64(challenge[:]))
+	q.Set("code_challenge_method", "S256")
+
+	sep := "?"
+	if strings.Contains(meta.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return meta.AuthorizationEndpoint + sep + q.Encode(), state, nil
+}
+
+// Finish completes the login for state: it exchanges code for tokens and
+// returns the verified ID token claims. Each state can be finished once.
+func (p *OIDCProvider) Finish(ctx context.Context, state, code string) (jwt.MapClaims, error) {
+	p.mu.Lock()
+	login, ok := p.pending[state]
+	delete(p.pending, state)
+	p.mu.Unlock()
+	if !ok || time.Now().After(login.expires) {
+		return nil, errors.New("oidc: login expired or unknown state")
+	}
+	if code == "" {
+		return nil, errors.New("oidc: missing authorization code")
+	}
+
+	meta, err := p.metadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", login.redirectURL)
+	form.Set("code_verifier", login.verifier)
+	if p.cfg.ClientSecret == "" {
+		form.Set("client_id", p.cfg.ClientID)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, meta.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("oidc: token request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.cfg.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.cfg.ClientID), url.QueryEscape(p.cfg.ClientSecret))
+	}
+
+	var tok struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	status, err := p.doJSON(req, &tok)
+	if err != nil {
+		return nil, fmt.Errorf("oidc: token request: %w", err)
+	}
+	if status != http.StatusOK || tok.Error != "" {
+		return nil, fmt.Errorf("oidc: token request failed with status %d: %s %s", status, tok.Error, tok.ErrorDescription)
+	}
+	if tok.IDToken == "" {
+		return nil, errors.New("oidc: token response has no id_token")
+	}
+	return p.verifyIDToken(ctx, meta, tok.IDToken, login.nonce)
+}
+
+// verifyIDToken checks the ID token's signature, issuer, audience, expiry
+// and nonce (OIDC Core §3.1.3.7).
+func (p *OIDCProvider) verifyIDToken(ctx context.Context, meta *oidcMetadata, raw, nonce string) (jwt.MapClaims, error) {
+	parser := jwt.NewParser(
+		jwt.WithValidMethods(oidcSigningMethods),
+		jwt.WithIssuer(meta.Issuer),
+		jwt.WithAudience(p.cfg.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(time.Minute),
+	)
+	claims := jwt.MapClaims{}
+	_, err := parser.ParseWithClaims(raw, claims, func(t *jwt.Token) (any, error) {
+		kid, _ := t.Header["kid"].(string)
+		return p.signingKey(ctx, meta, kid)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("oidc: invalid id token: %w", err)
+	}
+
+	if got, _ := claims["nonce"].(string); got != nonce {
+		return nil, errors.New("oidc: id token nonce mismatch")
+	}
+	aud, _ := claims.GetAudience()
+	if azp, _ := claims["azp"].(string); len(aud) > 1 && azp != p.cfg.ClientID {
+		return nil, errors.New("oidc: id token authorized party mismatch")
+	}
+	if sub, _ := claims.GetSubject(); sub == "" {
+		return nil, errors.New("oidc: id token has no subject")
+	}
+	return claims, nil
+}
+
+// metadata returns the provider's discovery document.
+func (p *OIDCProvider) metadata(ctx context.Context) (*oidcMetadata, error) {
+	p.mu.Lock()
+	if p.meta != nil && time.Since(p.metaFetched) < oidcMetadataTTL {
+		meta := p.meta
+		p.mu.Unlock()
+		return meta, nil
+	}
+	p.mu.Unlock()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(p.cfg.Issuer, "/")+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return nil, fmt.Errorf("oidc: discovery: %w", err)
+	}
+	var meta oidcMetadata
+	status, err := p.doJSON(req, &meta)
+	if err != nil {
+		return nil, fmt.Errorf("oidc: discovery: %w", err)
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("oidc: discovery returned status %d", status)
+	}
+	if strings.TrimSuffix(meta.Issuer, "/") != strings.TrimSuffix(p.cfg.Issuer, "/") {
+		return nil, fmt.Errorf("oidc: discovery issuer %q does not match configured issuer %q", meta.Issuer, p.cfg.Issuer)
+	}
+	if meta.AuthorizationEndpoint == "" || meta.TokenEndpoint == "" || meta.JWKSURI == "" {
+		return nil, errors.New("oidc: discovery document is missing endpoints")
+	}
+
+	p.mu.Lock()
+	p.meta = &meta
+	p.metaFetched = time.Now()
+	p.mu.Unlock()
+	return &meta, nil
+}
+
+// signingKey returns the provider key with ID kid, refetching the key set
+// if it is unknown.
+func (p *OIDCProvider) signingKey(ctx context.Context, meta *oidcMetadata, kid string) (any, error) {
+	p.mu.Lock()
+	key, ok := p.keys[kid]
+	stale := time.Since(p.keysFetched) >= oidcKeyRefreshInterval
+	p.mu.Unlock()
+	if ok {
+		return key, nil
+	}
+	if !stale {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+
+	keys, err := p.fetchKeys(ctx, meta.JWKSURI)
+	if err != nil {
+		return nil, err
+	}
+	p.mu.Lock()
+	p.keys = keys
+	p.keysFetched = time.Now()
+	p.mu.Unlock()
+
+	// Tokens without a kid are accepted when the set has a single key.
+	if kid == "" && len(keys) == 1 {
+		for _, k := range keys {
+			return k, nil
+		}
+	}
+	if key, ok := keys[kid]; ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+func (p *OIDCProvider) fetchKeys(ctx context.Context, jwksURI string) (map[string]any, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, jwksURI, nil)
+	if err != nil {
+		return nil, fmt.Errorf("oidc: jwks: %w", err)
+	}
+	var set struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+			Crv string `json:"crv"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		} `json:"keys"`
+	}
+	status, err := p.doJSON(req, &set)
+	if err != nil {
+		return nil, fmt.Errorf("oidc: jwks: %w", err)
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("oidc: jwks returned status %d", status)
+	}
+
+	keys := make(map[string]any)
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		switch k.Kty {
+		case "RSA":
+			n, errN := decodeB64(k.N)
+			e, errE := decodeB64(k.E)
+			if errN != nil || errE != nil || len(e) > 4 {
+				continue
+			}
+			keys[k.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		case "EC":
+			curve := map[string]elliptic.Curve{"P-256": elliptic.P256(), "P-384": elliptic.P384(), "P-521": elliptic.P521()}[k.Crv]
+			x, errX := decodeB64(k.X)
+			y, errY := decodeB64(k.Y)
+			if curve == nil || errX != nil || errY != nil {
+				continue
+			}
+			keys[k.Kid] = &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		}
+	}
+	return keys, nil
+}
+
+// doJSON sends req and decodes a JSON response body of up to 1 MiB.
+func (p *OIDCProvider) doJSON(req *http.Request, v any) (int, error) {
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return 0, err
+	}
+	if err := json.Unmarshal(body, v); err != nil && resp.StatusCode == http.StatusOK {
+		return 0, fmt.Errorf("decode response: %w", err)
+	}
+	return resp.StatusCode, nil
+}
+
+func randomToken() (string, error) {
+	b, err := GenerateSecret(32)
+	if err != nil {
+		return "", err
+	}
+	return b64(b), nil
+}
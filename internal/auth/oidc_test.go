@@ -0,0 +1,144 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/itsChris/wgpilot/internal/testutil"
+)
+
+const testRedirectURL = "https://vpn.example.com/api/auth/oidc/callback"
+
+func newMockIssuer(t *testing.T) *testutil.MockOIDCIssuer {
+	t.Helper()
+	issuer, err := testutil.NewMockOIDCIssuer("wgpilot", "s3cret")
+	if err != nil {
+		t.Fatalf("NewMockOIDCIssuer: %v", err)
+	}
+	t.Cleanup(issuer.Close)
+	return issuer
+}
+
+// authorize follows authURL to the mock issuer and returns the code and
+// state it redirects back with.
+func authorize(t *testing.T, authURL string) (code, state string) {
+	t.Helper()
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := client.Get(authURL)
+	if err != nil {
+		t.Fatalf("authorize: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("authorize: expected 302, got %d", resp.StatusCode)
+	}
+	loc, _ := url.Parse(resp.Header.Get("Location"))
+	return loc.Query().Get("code"), loc.Query().Get("state")
+}
+
+func TestOIDCProvider_Login(t *testing.T) {
+	issuer := newMockIssuer(t)
+	issuer.SetClaims(map[string]any{"sub": "1234", "preferred_username": "alice", "groups": []string{"vpn-admins"}})
+	ctx := context.Background()
+
+	p, err := NewOIDCProvider(OIDCConfig{Issuer: issuer.URL, ClientID: "wgpilot", ClientSecret: "s3cret", Scopes: []string{"profile"}})
+	if err != nil {
+		t.Fatalf("NewOIDCProvider: %v", err)
+	}
+	authURL, state, err := p.Begin(ctx, testRedirectURL)
+	if err != nil {
+		t.Fatalf("Begin: %v", err)
+	}
+	u, _ := url.Parse(authURL)
+	if got := u.Query().Get("scope"); got != "openid profile" {
+		t.Errorf("scope = %q, want %q", got, "openid profile")
+	}
+
+	code, gotState := authorize(t, authURL)
+	if gotState != state {
+		t.Fatalf("state = %q, want %q", gotState, state)
+	}
+	claims, err := p.Finish(ctx, state, code)
+	if err != nil {
+		t.Fatalf("Finish: %v", err)
+	}
+	if claims["sub"] != "1234" || claims["preferred_username"] != "alice" {
+		t.Errorf("unexpected claims %v", claims)
+	}
+
+	// A state can be used once.
+	if _, err := p.Finish(ctx, state, code); err == nil {
+		t.Error("expected a second Finish with the same state to fail")
+	}
+}
+
+func TestOIDCProvider_RejectsBadTokens(t *testing.T) {
+	issuer := newMockIssuer(t)
+	ctx := context.Background()
+
+	tests := []struct {
+		name   string
+		cfg    OIDCConfig
+		claims map[string]any
+	}{
+		{
+			name:   "wrong client secret",
+			cfg:    OIDCConfig{ClientID: "wgpilot", ClientSecret: "wrong"},
+			claims: map[string]any{"sub": "1"},
+		},
+		{
+			name:   "foreign issuer",
+			cfg:    OIDCConfig{ClientID: "wgpilot", ClientSecret: "s3cret"},
+			claims: map[string]any{"sub": "1", "iss": "https://evil.example.com"},
+		},
+		{
+			name:   "other audience",
+			cfg:    OIDCConfig{ClientID: "wgpilot", ClientSecret: "s3cret"},
+			claims: map[string]any{"sub": "1", "aud": "other-app"},
+		},
+		{
+			name:   "expired",
+			cfg:    OIDCConfig{ClientID: "wgpilot", ClientSecret: "s3cret"},
+			claims: map[string]any{"sub": "1", "exp": time.Now().Add(-time.Hour).Unix()},
+		},
+		{
+			name:   "replayed nonce",
+			cfg:    OIDCConfig{ClientID: "wgpilot", ClientSecret: "s3cret"},
+			claims: map[string]any{"sub": "1", "nonce": "old"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.cfg.Issuer = issuer.URL
+			p, err := NewOIDCProvider(tt.cfg)
+			if err != nil {
+				t.Fatalf("NewOIDCProvider: %v", err)
+			}
+			issuer.SetClaims(tt.claims)
+			authURL, state, err := p.Begin(ctx, testRedirectURL)
+			if err != nil {
+				t.Fatalf("Begin: %v", err)
+			}
+			code, _ := authorize(t, authURL)
+			if _, err := p.Finish(ctx, state, code); err == nil {
+				t.Error("expected Finish to fail")
+			}
+		})
+	}
+}
+
+func TestOIDCProvider_IssuerMismatch(t *testing.T) {
+	issuer := newMockIssuer(t)
+	p, err := NewOIDCProvider(OIDCConfig{Issuer: issuer.URL + "/tenant", ClientID: "wgpilot"})
+	if err != nil {
+		t.Fatalf("NewOIDCProvider: %v", err)
+	}
+	if _, _, err := p.Begin(context.Background(), testRedirectURL); err == nil {
+		t.Error("expected discovery to fail for a mismatched issuer")
+	}
+}
@@ -0,0 +1,102 @@
+package auth
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+// Password policy violations returned by PasswordPolicy.Validate.
+var (
+	ErrPasswordTooShort = errors.New("password is too short")
+	ErrPasswordBreached = errors.New("password appears in a list of breached passwords")
+	ErrPasswordReused   = errors.New("password was used recently")
+)
+
+// PasswordPolicy decides which passwords local users may set. The zero
+// value only enforces MinPasswordLength.
+type PasswordPolicy struct {
+	MinLength int // minimum length in characters; below MinPasswordLength is raised to it
+	History   int // number of previous passwords that may not be reused; 0 disables
+
+	breached map[string]struct{} // upper-case SHA-1 hex digests
+}
+
+// LoadBreachedPasswords reads a list of breached passwords into the policy,
+// replacing any loaded before. Each line holds either a password or the
+// SHA-1 hex digest of one, optionally followed by ":count" as in the Have I
+// Been Pwned downloads. Blank lines and lines starting with # are skipped.
+func (p *PasswordPolicy) LoadBreachedPasswords(path string) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, fmt.Errorf("open breached password list: %w", err)
+	}
+	defer f.Close()
+
+	breached := make(map[string]struct{})
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if digest, _, _ := strings.Cut(line, ":"); isSHA1Hex(digest) {
+			breached[strings.ToUpper(digest)] = struct{}{}
+			continue
+		}
+		breached[sha1Hex(line)] = struct{}{}
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, fmt.Errorf("read breached password list: %w", err)
+	}
+
+	p.breached = breached
+	return len(breached), nil
+}
+
+// MinimumLength returns the effective minimum password length.
+func (p *PasswordPolicy) MinimumLength() int {
+	return max(p.MinLength, MinPasswordLength)
+}
+
+// Validate checks a new password against the length and breached-password
+// rules. Reuse is checked separately with Reused, since it needs the
+// user's previous hashes.
+func (p *PasswordPolicy) Validate(password string) error {
+	if n := p.MinimumLength(); utf8.RuneCountInString(password) < n {
+		return fmt.Errorf("%w: must be at least %d characters", ErrPasswordTooShort, n)
+	}
+	if _, ok := p.breached[sha1Hex(password)]; ok {
+		return ErrPasswordBreached
+	}
+	return nil
+}
+
+// Reused reports whether password matches one of the given bcrypt hashes,
+// normally the user's current and most recent previous passwords.
+func (p *PasswordPolicy) Reused(password string, hashes []string) bool {
+	for _, hash := range hashes {
+		if hash != "" && VerifyPassword(hash, password) == nil {
+			return true
+		}
+	}
+	return false
+}
+
+func sha1Hex(s string) string {
+	h := sha1.Sum([]byte(s))
+	return strings.ToUpper(hex.EncodeToString(h[:]))
+}
+
+func isSHA1Hex(s string) bool {
+	if len(s) != 2*sha1.Size {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
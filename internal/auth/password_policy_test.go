@@ -0,0 +1,69 @@
+package auth
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPasswordPolicy_Validate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "breached.txt")
+	list := "# common passwords\npassword1234\n\n" +
+		// SHA-1 of "letmein12345" in the Have I Been Pwned format.
+		sha1Hex("letmein12345") + ":42\r\n"
+	if err := os.WriteFile(path, []byte(list), 0o600); err != nil {
+		t.Fatalf("write list: %v", err)
+	}
+
+	p := &PasswordPolicy{MinLength: 12}
+	n, err := p.LoadBreachedPasswords(path)
+	if err != nil {
+		t.Fatalf("LoadBreachedPasswords: %v", err)
+	}
+	if n != 2 {
+		t.Errorf("expected 2 breached passwords, got %d", n)
+	}
+
+	tests := []struct {
+		password string
+		want     error
+	}{
+		{"short", ErrPasswordTooShort},
+		{"elevenchars", ErrPasswordTooShort},
+		{"password1234", ErrPasswordBreached},
+		{"letmein12345", ErrPasswordBreached},
+		{"correct horse battery", nil},
+	}
+	for _, tt := range tests {
+		if err := p.Validate(tt.password); !errors.Is(err, tt.want) {
+			t.Errorf("Validate(%q) = %v, want %v", tt.password, err, tt.want)
+		}
+	}
+}
+
+func TestPasswordPolicy_MinimumLength(t *testing.T) {
+	var p PasswordPolicy
+	if got := p.MinimumLength(); got != MinPasswordLength {
+		t.Errorf("zero policy: expected %d, got %d", MinPasswordLength, got)
+	}
+	p.MinLength = 4
+	if got := p.MinimumLength(); got != MinPasswordLength {
+		t.Errorf("policy cannot go below %d, got %d", MinPasswordLength, got)
+	}
+}
+
+func TestPasswordPolicy_Reused(t *testing.T) {
+	old, err := HashPassword("oldpassword1")
+	if err != nil {
+		t.Fatalf("HashPassword failed: %v", err)
+	}
+
+	var p PasswordPolicy
+	if !p.Reused("oldpassword1", []string{"", old}) {
+		t.Error("expected a previous password to be reported as reused")
+	}
+	if p.Reused("newpassword1", []string{old}) {
+		t.Error("expected a new password not to be reported as reused")
+	}
+}
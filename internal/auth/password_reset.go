@@ -0,0 +1,31 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+)
+
+const (
+	resetTokenLength = 32 // 32 bytes = 64 hex chars
+	resetTokenPrefix = "wgr_"
+)
+
+// GenerateResetToken generates a random password reset token and returns
+// the token and its SHA-256 hash.
+func GenerateResetToken() (token, hash string, err error) {
+	b := make([]byte, resetTokenLength)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", fmt.Errorf("generate reset token: %w", err)
+	}
+
+	token = resetTokenPrefix + hex.EncodeToString(b)
+	return token, HashResetToken(token), nil
+}
+
+// HashResetToken returns the SHA-256 hash of a password reset token.
+func HashResetToken(token string) string {
+	h := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(h[:])
+}
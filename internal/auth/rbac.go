@@ -0,0 +1,272 @@
+package auth
+
+import (
+	"context"
+	"slices"
+	"strings"
+)
+
+// Permissions are "<resource>:<action>". In a grant, "<resource>:*" stands
+// for every action on a resource and "*" for every permission.
+const (
+	PermNetworkRead   = "network:read"
+	PermNetworkWrite  = "network:write" // includes exporting server configs
+	PermPeerRead      = "peer:read"
+	PermPeerWrite     = "peer:write"   // includes downloading peer configs
+	PermDeviceRead    = "device:read"  // the caller's own peers only
+	PermDeviceWrite   = "device:write" // includes creating own peers up to the network's device limit
+	PermBridgeRead    = "bridge:read"
+	PermBridgeWrite   = "bridge:write"
+	PermAlertRead     = "alert:read"
+	PermAlertWrite    = "alert:write"
+	PermWebhookRead   = "webhook:read"
+	PermWebhookWrite  = "webhook:write"
+	PermSettingsRead  = "settings:read"
+	PermSettingsWrite = "settings:write"
+	PermUserRead      = "user:read"
+	PermUserWrite     = "user:write"
+	PermRoleRead      = "role:read"
+	PermRoleWrite     = "role:write"
+	PermAPIKeyRead    = "api_key:read"
+	PermAPIKeyWrite   = "api_key:write"
+	PermAuditRead     = "audit:read"
+	PermSystemRead    = "system:read"
+	PermSystemWrite   = "system:write"
+	PermDebugRead     = "debug:read"
+)
+
+// Permissions lists every permission.
+var Permissions = []string{
+	PermNetworkRead, PermNetworkWrite,
+	PermPeerRead, PermPeerWrite,
+	PermDeviceRead, PermDeviceWrite,
+	PermBridgeRead, PermBridgeWrite,
+	PermAlertRead, PermAlertWrite,
+	PermWebhookRead, PermWebhookWrite,
+	PermSettingsRead, PermSettingsWrite,
+	PermUserRead, PermUserWrite,
+	PermRoleRead, PermRoleWrite,
+	PermAPIKeyRead, PermAPIKeyWrite,
+	PermAuditRead,
+	PermSystemRead, PermSystemWrite,
+	PermDebugRead,
+}
+
+// Built-in roles. They cannot be changed or deleted. Viewers may manage
+// their own API keys, which never grant more than the viewer role. Members
+// have no access of their own and get it from network roles. Users manage
+// only the devices they own, through the self-service portal.
+const (
+	RoleAdmin  = "admin"
+	RoleViewer = "viewer"
+	RoleMember = "member"
+	RoleUser   = "user"
+)
+
+var builtinRoles = map[string][]string{
+	RoleAdmin: {"*"},
+	RoleViewer: {
+		PermNetworkRead, PermPeerRead, PermBridgeRead, PermAlertRead,
+		PermSettingsRead, PermSystemRead, PermAPIKeyRead, PermAPIKeyWrite,
+	},
+	RoleMember: {PermAPIKeyRead, PermAPIKeyWrite},
+	RoleUser:   {PermDeviceRead, PermDeviceWrite},
+}
+
+// BuiltinRole returns the permissions of a built-in role.
+func BuiltinRole(name string) ([]string, bool) {
+	perms, ok := builtinRoles[name]
+	return perms, ok
+}
+
+// BuiltinRoles returns the names of the built-in roles.
+func BuiltinRoles() []string {
+	return []string{RoleAdmin, RoleViewer, RoleMember, RoleUser}
+}
+
+// ValidPermission reports whether p can be granted: a permission, a
+// resource wildcard or "*".
+func ValidPermission(p string) bool {
+	if p == "*" || slices.Contains(Permissions, p) {
+		return true
+	}
+	resource, action, ok := strings.Cut(p, ":")
+	if !ok || action != "*" {
+		return false
+	}
+	return slices.ContainsFunc(Permissions, func(q string) bool {
+		return strings.HasPrefix(q, resource+":")
+	})
+}
+
+// HasPermission reports whether granted includes permission p.
+func HasPermission(granted []string, p string) bool {
+	resource, _, _ := strings.Cut(p, ":")
+	for _, g := range granted {
+		if g == "*" || g == p || g == resource+":*" {
+			return true
+		}
+	}
+	return false
+}
+
+// ExpandPermissions resolves the wildcards in granted to the permissions
+// they stand for, in the order of Permissions.
+func ExpandPermissions(granted []string) []string {
+	var perms []string
+	for _, p := range Permissions {
+		if HasPermission(granted, p) {
+			perms = append(perms, p)
+		}
+	}
+	return perms
+}
+
+// CoversPermissions reports whether granted includes every permission in
+// want, so that whoever holds granted may hand want on.
+func CoversPermissions(granted, want []string) bool {
+	for _, p := range ExpandPermissions(want) {
+		if !HasPermission(granted, p) {
+			return false
+		}
+	}
+	return true
+}
+
+// IntersectPermissions returns the permissions granted by both a and b.
+func IntersectPermissions(a, b []string) []string {
+	var perms []string
+	for _, p := range ExpandPermissions(a) {
+		if HasPermission(b, p) {
+			perms = append(perms, p)
+		}
+	}
+	return perms
+}
+
+// NetworkScoped reports whether p can be granted on a single network: the
+// network, peer, device, bridge and audit permissions.
+func NetworkScoped(p string) bool {
+	resource, _, _ := strings.Cut(p, ":")
+	switch resource {
+	case "network", "peer", "device", "bridge", "audit":
+		return true
+	}
+	return false
+}
+
+// ScopePermissions returns the permissions in granted that apply when it is
+// granted on a single network.
+func ScopePermissions(granted []string) []string {
+	var perms []string
+	for _, p := range ExpandPermissions(granted) {
+		if NetworkScoped(p) {
+			perms = append(perms, p)
+		}
+	}
+	return perms
+}
+
+// Grants are a caller's permissions: Global applies everywhere, and
+// Networks holds those granted on single networks by network roles.
+type Grants struct {
+	Global   []string
+	Networks map[int64][]string
+}
+
+// Has reports whether p is granted everywhere.
+func (g *Grants) Has(p string) bool {
+	return g != nil && HasPermission(g.Global, p)
+}
+
+// HasOnNetwork reports whether p is granted on network id.
+func (g *Grants) HasOnNetwork(id int64, p string) bool {
+	return g.Has(p) || (g != nil && HasPermission(g.Networks[id], p))
+}
+
+// HasOnAnyNetwork reports whether p is granted everywhere or on at least one
+// network.
+func (g *Grants) HasOnAnyNetwork(p string) bool {
+	if g.Has(p) {
+		return true
+	}
+	if g == nil {
+		return false
+	}
+	for _, perms := range g.Networks {
+		if HasPermission(perms, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// NetworksWith returns the networks on which p is granted, or nil if it is
+// granted everywhere. The result is never nil otherwise, so that it can be
+// used as a filter.
+func (g *Grants) NetworksWith(p string) []int64 {
+	if g.Has(p) {
+		return nil
+	}
+	ids := []int64{}
+	if g != nil {
+		for id, perms := range g.Networks {
+			if HasPermission(perms, p) {
+				ids = append(ids, id)
+			}
+		}
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+// LimitToNetworks returns the grants that apply within networks ids only:
+// permissions held everywhere that can be granted on a single network are
+// narrowed to ids, and network roles on other networks are dropped.
+func (g *Grants) LimitToNetworks(ids []int64) *Grants {
+	limited := &Grants{Networks: make(map[int64][]string, len(ids))}
+	if g == nil {
+		return limited
+	}
+	for _, p := range ExpandPermissions(g.Global) {
+		if !NetworkScoped(p) {
+			limited.Global = append(limited.Global, p)
+		}
+	}
+	scoped := ScopePermissions(g.Global)
+	for _, id := range ids {
+		perms := slices.Clone(scoped)
+		for _, p := range g.Networks[id] {
+			if !HasPermission(perms, p) {
+				perms = append(perms, p)
+			}
+		}
+		if len(perms) > 0 {
+			limited.Networks[id] = perms
+		}
+	}
+	return limited
+}
+
+type grantsContextKey struct{}
+
+// WithGrants stores the caller's resolved permissions in the context.
+func WithGrants(ctx context.Context, g *Grants) context.Context {
+	return context.WithValue(ctx, grantsContextKey{}, g)
+}
+
+// GrantsFromContext returns the caller's resolved permissions, or nil if
+// they have not been resolved.
+func GrantsFromContext(ctx context.Context) *Grants {
+	g, _ := ctx.Value(grantsContextKey{}).(*Grants)
+	return g
+}
+
+// PermissionsFromContext returns the caller's global permissions, or nil if
+// they have not been resolved.
+func PermissionsFromContext(ctx context.Context) []string {
+	if g := GrantsFromContext(ctx); g != nil {
+		return g.Global
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package auth
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestHasPermission(t *testing.T) {
+	tests := []struct {
+		name    string
+		granted []string
+		perm    string
+		want    bool
+	}{
+		{"exact", []string{PermPeerRead}, PermPeerRead, true},
+		{"other action", []string{PermPeerRead}, PermPeerWrite, false},
+		{"resource wildcard", []string{"peer:*"}, PermPeerWrite, true},
+		{"other resource wildcard", []string{"network:*"}, PermPeerWrite, false},
+		{"everything", []string{"*"}, PermDebugRead, true},
+		{"nothing", nil, PermNetworkRead, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := HasPermission(tt.granted, tt.perm); got != tt.want {
+				t.Errorf("HasPermission(%v, %q) = %v, want %v", tt.granted, tt.perm, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidPermission(t *testing.T) {
+	for _, p := range []string{PermNetworkWrite, "network:*", "*"} {
+		if !ValidPermission(p) {
+			t.Errorf("expected %q to be valid", p)
+		}
+	}
+	for _, p := range []string{"", "network", "network:delete", "nothing:*", "*:read"} {
+		if ValidPermission(p) {
+			t.Errorf("expected %q to be invalid", p)
+		}
+	}
+}
+
+func TestBuiltinRoles(t *testing.T) {
+	admin, ok := BuiltinRole(RoleAdmin)
+	if !ok || !CoversPermissions(admin, Permissions) {
+		t.Errorf("expected admin to have every permission, got %v", admin)
+	}
+	viewer, ok := BuiltinRole(RoleViewer)
+	if !ok {
+		t.Fatal("expected a viewer role")
+	}
+	for _, p := range []string{PermNetworkWrite, PermPeerWrite, PermSettingsWrite, PermUserWrite, PermRoleWrite} {
+		if HasPermission(viewer, p) {
+			t.Errorf("expected viewer not to have %q", p)
+		}
+	}
+	user, ok := BuiltinRole(RoleUser)
+	if !ok || HasPermission(user, PermPeerRead) || !HasPermission(user, PermDeviceWrite) {
+		t.Errorf("expected user to manage only their own devices, got %v", user)
+	}
+	if _, ok := BuiltinRole("operator"); ok {
+		t.Error("expected operator not to be a built-in role")
+	}
+}
+
+func TestCoversPermissions(t *testing.T) {
+	granted := []string{"peer:*", PermNetworkRead}
+	if !CoversPermissions(granted, []string{PermPeerWrite, PermNetworkRead}) {
+		t.Error("expected granted to cover peer:write and network:read")
+	}
+	if !CoversPermissions(granted, []string{"peer:*"}) {
+		t.Error("expected granted to cover peer:*")
+	}
+	if CoversPermissions(granted, []string{"network:*"}) {
+		t.Error("expected granted not to cover network:*")
+	}
+	if CoversPermissions(granted, []string{"*"}) {
+		t.Error("expected granted not to cover *")
+	}
+}
+
+func TestIntersectPermissions(t *testing.T) {
+	got := IntersectPermissions([]string{"*"}, []string{PermNetworkRead, "peer:*"})
+	want := []string{PermNetworkRead, PermPeerRead, PermPeerWrite}
+	if !slices.Equal(got, want) {
+		t.Errorf("IntersectPermissions = %v, want %v", got, want)
+	}
+	if got := IntersectPermissions([]string{PermNetworkWrite}, []string{PermNetworkRead}); len(got) != 0 {
+		t.Errorf("expected no permissions, got %v", got)
+	}
+}
+
+func TestGrants_LimitToNetworks(t *testing.T) {
+	g := &Grants{
+		Global:   []string{PermNetworkRead, PermSettingsRead},
+		Networks: map[int64][]string{2: {PermPeerWrite}, 3: {PermPeerWrite}},
+	}
+	limited := g.LimitToNetworks([]int64{1, 2})
+
+	if !slices.Equal(limited.Global, []string{PermSettingsRead}) {
+		t.Errorf("Global = %v, want only settings:read", limited.Global)
+	}
+	if !limited.HasOnNetwork(1, PermNetworkRead) || !limited.HasOnNetwork(2, PermPeerWrite) {
+		t.Errorf("expected network grants to be kept on networks 1 and 2, got %v", limited.Networks)
+	}
+	if limited.HasOnNetwork(1, PermPeerWrite) || limited.HasOnNetwork(3, PermPeerWrite) || limited.HasOnNetwork(4, PermNetworkRead) {
+		t.Errorf("expected nothing beyond networks 1 and 2, got %v", limited.Networks)
+	}
+	if ids := limited.NetworksWith(PermNetworkRead); !slices.Equal(ids, []int64{1, 2}) {
+		t.Errorf("NetworksWith = %v, want [1 2]", ids)
+	}
+}
@@ -1,17 +1,38 @@
 package auth
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log/slog"
+	"net"
 	"net/http"
+	"strconv"
 )
 
 // CookieName is the name of the session cookie.
 const CookieName = "session"
 
+// LoginStateCookieName is the name of the cookie that binds an external
+// login (e.g. OIDC) to the browser that started it.
+const LoginStateCookieName = "login_state"
+
+// ErrSessionRevoked is returned by SessionManager.Verify for a session token
+// that is validly signed but has been revoked.
+var ErrSessionRevoked = errors.New("session: revoked")
+
+// SessionStore looks up the server-side record of issued session tokens.
+type SessionStore interface {
+	// ActiveSession reports whether the session with JWT ID id exists, has
+	// not expired and belongs to userID, and records that it was used from
+	// ip with userAgent.
+	ActiveSession(ctx context.Context, id string, userID int64, ip, userAgent string) (bool, error)
+}
+
 // SessionManager handles HTTP cookie-based session management.
 type SessionManager struct {
 	secure bool
+	store  SessionStore
 	logger *slog.Logger
 }
 
@@ -24,6 +45,32 @@ func NewSessionManager(secure bool, logger *slog.Logger) (*SessionManager, error
 	}, nil
 }
 
+// UseStore makes Verify check session tokens against store, so that they
+// can be revoked before they expire.
+func (m *SessionManager) UseStore(store SessionStore) {
+	m.store = store
+}
+
+// Verify checks that the session token with claims has not been revoked.
+// Without a store every validly signed token is accepted.
+func (m *SessionManager) Verify(r *http.Request, claims *Claims) error {
+	if m.store == nil {
+		return nil
+	}
+	userID, err := strconv.ParseInt(claims.Subject, 10, 64)
+	if err != nil || claims.ID == "" {
+		return ErrSessionRevoked
+	}
+	ok, err := m.store.ActiveSession(r.Context(), claims.ID, userID, ClientIP(r), r.UserAgent())
+	if err != nil {
+		return fmt.Errorf("session: lookup: %w", err)
+	}
+	if !ok {
+		return ErrSessionRevoked
+	}
+	return nil
+}
+
 // SetCookie writes the session JWT as an HttpOnly cookie.
 func (m *SessionManager) SetCookie(w http.ResponseWriter, token string, maxAge int) {
 	http.SetCookie(w, &http.Cookie{
@@ -50,6 +97,31 @@ func (m *SessionManager) ClearCookie(w http.ResponseWriter) {
 	})
 }
 
+// SetLoginStateCookie stores the state of an external login while the
+// browser is at the identity provider. It is SameSite=Lax so that it is sent
+// on the provider's redirect back; maxAge -1 removes it.
+func (m *SessionManager) SetLoginStateCookie(w http.ResponseWriter, state string, maxAge int) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     LoginStateCookieName,
+		Value:    state,
+		Path:     "/api/auth/",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   m.secure,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// LoginState returns the external login state from the request cookie, or
+// "" if there is none.
+func (m *SessionManager) LoginState(r *http.Request) string {
+	cookie, err := r.Cookie(LoginStateCookieName)
+	if err != nil {
+		return ""
+	}
+	return cookie.Value
+}
+
 // GetToken extracts the session token from the request cookie.
 func (m *SessionManager) GetToken(r *http.Request) (string, error) {
 	cookie, err := r.Cookie(CookieName)
@@ -58,3 +130,12 @@ func (m *SessionManager) GetToken(r *http.Request) (string, error) {
 	}
 	return cookie.Value, nil
 }
+
+// ClientIP returns the address of the client that sent r, without the port.
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -1,6 +1,8 @@
 package auth
 
 import (
+	"context"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -113,3 +115,55 @@ func TestGetToken_Missing(t *testing.T) {
 		t.Error("GetToken should fail when no cookie is present")
 	}
 }
+
+type fakeSessionStore struct {
+	sessions map[string]int64 // jti -> user ID
+	ip       string
+}
+
+func (f *fakeSessionStore) ActiveSession(_ context.Context, id string, userID int64, ip, _ string) (bool, error) {
+	f.ip = ip
+	owner, ok := f.sessions[id]
+	return ok && owner == userID, nil
+}
+
+func TestVerify(t *testing.T) {
+	sm, _ := NewSessionManager(false, testLogger())
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "192.0.2.1:51820"
+
+	claims := &Claims{}
+	claims.ID, claims.Subject = "abc", "1"
+
+	// Without a store every token is accepted.
+	if err := sm.Verify(req, claims); err != nil {
+		t.Fatalf("Verify without a store: %v", err)
+	}
+
+	store := &fakeSessionStore{sessions: map[string]int64{"abc": 1}}
+	sm.UseStore(store)
+	if err := sm.Verify(req, claims); err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if store.ip != "192.0.2.1" {
+		t.Errorf("ip = %q, want 192.0.2.1", store.ip)
+	}
+
+	tests := []struct {
+		name    string
+		id, sub string
+	}{
+		{"revoked", "def", "1"},
+		{"other user", "abc", "2"},
+		{"no jti", "", "1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Claims{}
+			c.ID, c.Subject = tt.id, tt.sub
+			if err := sm.Verify(req, c); !errors.Is(err, ErrSessionRevoked) {
+				t.Errorf("expected ErrSessionRevoked, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,34 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+)
+
+const (
+	shareTokenLength = 32 // 32 bytes = 64 hex chars
+	shareTokenPrefix = "wgs_"
+)
+
+// GenerateShareToken generates a random peer config share link token and
+// returns the token, its SHA-256 hash, and a display prefix.
+func GenerateShareToken() (token, hash, prefix string, err error) {
+	b := make([]byte, shareTokenLength)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", "", fmt.Errorf("generate share token: %w", err)
+	}
+
+	token = shareTokenPrefix + hex.EncodeToString(b)
+	hash = HashShareToken(token)
+	prefix = token[:len(shareTokenPrefix)+8] + "..."
+
+	return token, hash, prefix, nil
+}
+
+// HashShareToken returns the SHA-256 hash of a share link token.
+func HashShareToken(token string) string {
+	h := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(h[:])
+}
@@ -0,0 +1,163 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"net/url"
+	"strings"
+	"time"
+
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+// TOTP parameters (RFC 6238). These are the defaults every authenticator
+// app supports, so they are not configurable.
+const (
+	totpPeriod     = 30
+	totpDigits     = 6
+	totpSecretSize = 20 // 160 bits, as recommended by RFC 4226
+
+	// totpSkew is the number of periods accepted either side of the
+	// current one, to tolerate clock drift on the user's device.
+	totpSkew = 1
+
+	// TOTPIssuer is the issuer shown in authenticator apps.
+	TOTPIssuer = "wgpilot"
+
+	// RecoveryCodeCount is the number of recovery codes issued at a time.
+	RecoveryCodeCount = 10
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateTOTPSecret creates a random base32-encoded TOTP secret.
+func GenerateTOTPSecret() (string, error) {
+	b := make([]byte, totpSecretSize)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generate totp secret: %w", err)
+	}
+	return totpEncoding.EncodeToString(b), nil
+}
+
+// TOTPCode returns the code for secret at time t.
+func TOTPCode(secret string, t time.Time) (string, error) {
+	key, err := decodeTOTPSecret(secret)
+	if err != nil {
+		return "", err
+	}
+	return hotp(key, totpStep(t)), nil
+}
+
+// VerifyTOTP checks code against secret at time t, allowing for clock drift.
+// It returns the time step the code belongs to, so callers can reject a
+// code that was already used.
+func VerifyTOTP(secret, code string, t time.Time) (step int64, ok bool) {
+	code = strings.TrimSpace(code)
+	if len(code) != totpDigits {
+		return 0, false
+	}
+	key, err := decodeTOTPSecret(secret)
+	if err != nil {
+		return 0, false
+	}
+	now := totpStep(t)
+	for s := now - totpSkew; s <= now+totpSkew; s++ {
+		if subtle.ConstantTimeCompare([]byte(hotp(key, s)), []byte(code)) == 1 {
+			return s, true
+		}
+	}
+	return 0, false
+}
+
+// TOTPURI returns the otpauth:// URI that authenticator apps import, usually
+// by scanning it as a QR code.
+func TOTPURI(account, secret string) string {
+	label := url.PathEscape(TOTPIssuer + ":" + account)
+	q := url.Values{}
+	q.Set("secret", secret)
+	q.Set("issuer", TOTPIssuer)
+	q.Set("algorithm", "SHA1")
+	q.Set("digits", fmt.Sprint(totpDigits))
+	q.Set("period", fmt.Sprint(totpPeriod))
+	return "otpauth://totp/" + label + "?" + q.Encode()
+}
+
+// TOTPQRCode renders uri as a PNG QR code of the given size in pixels.
+func TOTPQRCode(uri string, size int) ([]byte, error) {
+	png, err := qrcode.Encode(uri, qrcode.Medium, size)
+	if err != nil {
+		return nil, fmt.Errorf("totp qr code: %w", err)
+	}
+	return png, nil
+}
+
+func totpStep(t time.Time) int64 {
+	return t.Unix() / totpPeriod
+}
+
+func decodeTOTPSecret(secret string) ([]byte, error) {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(strings.TrimRight(secret, "=")))
+	if err != nil {
+		return nil, fmt.Errorf("decode totp secret: %w", err)
+	}
+	return key, nil
+}
+
+// hotp computes an RFC 4226 code for counter.
+func hotp(key []byte, counter int64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(counter))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, value%1_000_000)
+}
+
+// ── Recovery codes ───────────────────────────────────────────────────
+
+// recoveryCodeAlphabet avoids characters that are easy to misread.
+const recoveryCodeAlphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+
+// GenerateRecoveryCodes creates n one-time recovery codes formatted as
+// "xxxxx-xxxxx" and returns them with their hashes. Only the hashes are
+// stored; the codes are shown to the user once.
+func GenerateRecoveryCodes(n int) (codes, hashes []string, err error) {
+	for range n {
+		b := make([]byte, 10)
+		for i := range b {
+			idx, err := rand.Int(rand.Reader, big.NewInt(int64(len(recoveryCodeAlphabet))))
+			if err != nil {
+				return nil, nil, fmt.Errorf("generate recovery code: %w", err)
+			}
+			b[i] = recoveryCodeAlphabet[idx.Int64()]
+		}
+		code := string(b[:5]) + "-" + string(b[5:])
+		codes = append(codes, code)
+		hashes = append(hashes, HashRecoveryCode(code))
+	}
+	return codes, hashes, nil
+}
+
+// HashRecoveryCode returns the SHA-256 hash of a recovery code. Case,
+// spaces and dashes are ignored so codes can be typed loosely.
+func HashRecoveryCode(code string) string {
+	normalized := strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' {
+			return -1
+		}
+		return r
+	}, strings.ToLower(strings.TrimSpace(code)))
+	h := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(h[:])
+}
@@ -0,0 +1,101 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTOTPCode_RFC6238Vectors(t *testing.T) {
+	// RFC 6238 appendix B, SHA-1 secret "12345678901234567890", 6 digits.
+	secret := totpEncoding.EncodeToString([]byte("12345678901234567890"))
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+	for _, tt := range tests {
+		got, err := TOTPCode(secret, time.Unix(tt.unix, 0))
+		if err != nil {
+			t.Fatalf("TOTPCode: %v", err)
+		}
+		if got != tt.want {
+			t.Errorf("TOTPCode at %d = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestVerifyTOTP(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatalf("GenerateTOTPSecret: %v", err)
+	}
+	now := time.Unix(1_700_000_000, 0)
+
+	code, _ := TOTPCode(secret, now)
+	step, ok := VerifyTOTP(secret, code, now)
+	if !ok || step != now.Unix()/totpPeriod {
+		t.Fatalf("expected current code to verify at its step, got step=%d ok=%v", step, ok)
+	}
+
+	// One period of drift is tolerated, two are not.
+	prev, _ := TOTPCode(secret, now.Add(-30*time.Second))
+	if _, ok := VerifyTOTP(secret, prev, now); !ok {
+		t.Error("expected previous period's code to verify")
+	}
+	old, _ := TOTPCode(secret, now.Add(-90*time.Second))
+	if _, ok := VerifyTOTP(secret, old, now); ok {
+		t.Error("expected code from three periods ago to be rejected")
+	}
+
+	for _, bad := range []string{"", "12345", "1234567", "abcdef"} {
+		if _, ok := VerifyTOTP(secret, bad, now); ok {
+			t.Errorf("expected %q to be rejected", bad)
+		}
+	}
+}
+
+func TestTOTPURI(t *testing.T) {
+	uri := TOTPURI("alice", "JBSWY3DPEHPK3PXP")
+	if !strings.HasPrefix(uri, "otpauth://totp/wgpilot:alice?") {
+		t.Errorf("unexpected URI %q", uri)
+	}
+	if !strings.Contains(uri, "secret=JBSWY3DPEHPK3PXP") || !strings.Contains(uri, "issuer=wgpilot") {
+		t.Errorf("URI missing secret or issuer: %q", uri)
+	}
+}
+
+func TestGenerateRecoveryCodes(t *testing.T) {
+	codes, hashes, err := GenerateRecoveryCodes(RecoveryCodeCount)
+	if err != nil {
+		t.Fatalf("GenerateRecoveryCodes: %v", err)
+	}
+	if len(codes) != RecoveryCodeCount || len(hashes) != RecoveryCodeCount {
+		t.Fatalf("expected %d codes, got %d", RecoveryCodeCount, len(codes))
+	}
+
+	seen := make(map[string]bool)
+	for i, code := range codes {
+		if len(code) != 11 || code[5] != '-' {
+			t.Errorf("unexpected code format %q", code)
+		}
+		if seen[code] {
+			t.Errorf("duplicate code %q", code)
+		}
+		seen[code] = true
+		if hashes[i] != HashRecoveryCode(code) {
+			t.Errorf("hash mismatch for %q", code)
+		}
+	}
+
+	// Codes typed in upper case or without the dash still match.
+	loose := strings.ToUpper(strings.ReplaceAll(codes[0], "-", " "))
+	if HashRecoveryCode(loose) != hashes[0] {
+		t.Error("expected normalized code to match its hash")
+	}
+}
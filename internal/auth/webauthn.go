@@ -0,0 +1,653 @@
+package auth
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// WebAuthnTimeout is how long a registration or login ceremony may take.
+const WebAuthnTimeout = 5 * time.Minute
+
+// maxWebAuthnSessions caps pending registration and second-factor
+// ceremonies. Passwordless ceremonies, which can be started without
+// authentication, have their own caps so they cannot crowd these out.
+const (
+	maxWebAuthnSessions      = 1000
+	maxPasswordlessSessions  = 1000
+	maxPasswordlessPerClient = 10
+)
+
+// COSE algorithm identifiers accepted for credentials, in order of
+// preference.
+const (
+	coseAlgES256 = -7
+	coseAlgEdDSA = -8
+	coseAlgRS256 = -257
+)
+
+// Authenticator data flags.
+const (
+	flagUserPresent  = 0x01
+	flagUserVerified = 0x04
+	flagAttested     = 0x40
+)
+
+// RelyingParty identifies this server to authenticators. Credentials are
+// scoped to ID, so changing it invalidates every registered credential.
+type RelyingParty struct {
+	ID      string   // effective domain, e.g. "vpn.example.com"
+	Name    string   // shown by the browser during registration
+	Origins []string // allowed client origins, e.g. "https://vpn.example.com:8443"
+}
+
+// ── Ceremony options ─────────────────────────────────────────────────
+//
+// These mirror the JSON forms of PublicKeyCredentialCreationOptions and
+// PublicKeyCredentialRequestOptions, with binary fields base64url-encoded,
+// so clients can pass them to PublicKeyCredential.parse*OptionsFromJSON.
+
+// CredentialCreationOptions are the options for navigator.credentials.create.
+type CredentialCreationOptions struct {
+	RP                     RPEntity               `json:"rp"`
+	User                   UserEntity             `json:"user"`
+	Challenge              string                 `json:"challenge"`
+	PubKeyCredParams       []CredentialParameter  `json:"pubKeyCredParams"`
+	Timeout                int64                  `json:"timeout"`
+	ExcludeCredentials     []CredentialDescriptor `json:"excludeCredentials"`
+	AuthenticatorSelection AuthenticatorSelection `json:"authenticatorSelection"`
+	Attestation            string                 `json:"attestation"`
+}
+
+// CredentialRequestOptions are the options for navigator.credentials.get.
+type CredentialRequestOptions struct {
+	Challenge        string                 `json:"challenge"`
+	Timeout          int64                  `json:"timeout"`
+	RPID             string                 `json:"rpId"`
+	AllowCredentials []CredentialDescriptor `json:"allowCredentials"`
+	UserVerification string                 `json:"userVerification"`
+}
+
+// RPEntity describes the relying party.
+type RPEntity struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// UserEntity describes the account a credential is created for.
+type UserEntity struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName"`
+}
+
+// CredentialParameter is an accepted credential type and algorithm.
+type CredentialParameter struct {
+	Type string `json:"type"`
+	Alg  int    `json:"alg"`
+}
+
+// CredentialDescriptor identifies an existing credential.
+type CredentialDescriptor struct {
+	Type       string   `json:"type"`
+	ID         string   `json:"id"`
+	Transports []string `json:"transports,omitempty"`
+}
+
+// AuthenticatorSelection states which authenticators may be used.
+type AuthenticatorSelection struct {
+	ResidentKey      string `json:"residentKey"`
+	UserVerification string `json:"userVerification"`
+}
+
+// CreationOptions returns registration options for user. userHandle is the
+// opaque account ID stored with discoverable credentials; exclude lists the
+// IDs of the user's existing credentials so they are not registered twice.
+func (rp RelyingParty) CreationOptions(userHandle []byte, username string, challenge []byte, exclude [][]byte) CredentialCreationOptions {
+	opts := CredentialCreationOptions{
+		RP:        RPEntity{ID: rp.ID, Name: rp.Name},
+		User:      UserEntity{ID: b64(userHandle), Name: username, DisplayName: username},
+		Challenge: b64(challenge),
+		PubKeyCredParams: []CredentialParameter{
+			{Type: "public-key", Alg: coseAlgES256},
+			{Type: "public-key", Alg: coseAlgEdDSA},
+			{Type: "public-key", Alg: coseAlgRS256},
+		},
+		Timeout:            WebAuthnTimeout.Milliseconds(),
+		ExcludeCredentials: descriptors(exclude),
+		AuthenticatorSelection: AuthenticatorSelection{
+			ResidentKey:      "preferred",
+			UserVerification: "preferred",
+		},
+		Attestation: "none",
+	}
+	return opts
+}
+
+// RequestOptions returns login options. An empty allow list lets the user
+// pick any discoverable credential for this relying party (passwordless
+// login); userVerification is "required" or "preferred".
+func (rp RelyingParty) RequestOptions(challenge []byte, allow [][]byte, userVerification string) CredentialRequestOptions {
+	return CredentialRequestOptions{
+		Challenge:        b64(challenge),
+		Timeout:          WebAuthnTimeout.Milliseconds(),
+		RPID:             rp.ID,
+		AllowCredentials: descriptors(allow),
+		UserVerification: userVerification,
+	}
+}
+
+func descriptors(ids [][]byte) []CredentialDescriptor {
+	out := make([]CredentialDescriptor, 0, len(ids))
+	for _, id := range ids {
+		out = append(out, CredentialDescriptor{Type: "public-key", ID: b64(id)})
+	}
+	return out
+}
+
+// UserHandle returns the WebAuthn user handle for a user ID.
+func UserHandle(userID int64) []byte {
+	return binary.BigEndian.AppendUint64(nil, uint64(userID))
+}
+
+// NewWebAuthnChallenge returns a random ceremony challenge.
+func NewWebAuthnChallenge() ([]byte, error) {
+	return GenerateSecret(32)
+}
+
+// ── Client responses ─────────────────────────────────────────────────
+
+// RegistrationResponse is the JSON form of the PublicKeyCredential returned
+// by navigator.credentials.create.
+type RegistrationResponse struct {
+	ID       string                           `json:"id"`
+	RawID    string                           `json:"rawId"`
+	Type     string                           `json:"type"`
+	Response AuthenticatorAttestationResponse `json:"response"`
+}
+
+// AuthenticatorAttestationResponse holds the registration result.
+type AuthenticatorAttestationResponse struct {
+	ClientDataJSON    string   `json:"clientDataJSON"`
+	AttestationObject string   `json:"attestationObject"`
+	Transports        []string `json:"transports,omitempty"`
+}
+
+// AssertionResponse is the JSON form of the PublicKeyCredential returned by
+// navigator.credentials.get.
+type AssertionResponse struct {
+	ID       string                         `json:"id"`
+	RawID    string                         `json:"rawId"`
+	Type     string                         `json:"type"`
+	Response AuthenticatorAssertionResponse `json:"response"`
+}
+
+// AuthenticatorAssertionResponse holds the login result.
+type AuthenticatorAssertionResponse struct {
+	ClientDataJSON    string `json:"clientDataJSON"`
+	AuthenticatorData string `json:"authenticatorData"`
+	Signature         string `json:"signature"`
+	UserHandle        string `json:"userHandle,omitempty"`
+}
+
+// CredentialID returns the decoded raw credential ID.
+func (r *AssertionResponse) CredentialID() ([]byte, error) {
+	return decodeB64(r.RawID)
+}
+
+// UserID returns the user ID encoded in the response's user handle.
+func (r *AssertionResponse) UserID() (int64, error) {
+	h, err := decodeB64(r.Response.UserHandle)
+	if err != nil || len(h) != 8 {
+		return 0, errors.New("webauthn: invalid user handle")
+	}
+	return int64(binary.BigEndian.Uint64(h)), nil
+}
+
+// clientData is the collected client data signed by the authenticator.
+type clientData struct {
+	Type        string `json:"type"`
+	Challenge   string `json:"challenge"`
+	Origin      string `json:"origin"`
+	CrossOrigin bool   `json:"crossOrigin"`
+}
+
+// ClientDataChallenge extracts the challenge from a base64url-encoded
+// clientDataJSON, so the pending ceremony can be looked up before the
+// response is verified.
+func ClientDataChallenge(clientDataJSON string) ([]byte, error) {
+	raw, err := decodeB64(clientDataJSON)
+	if err != nil {
+		return nil, fmt.Errorf("webauthn: client data: %w", err)
+	}
+	var cd clientData
+	if err := json.Unmarshal(raw, &cd); err != nil {
+		return nil, fmt.Errorf("webauthn: client data: %w", err)
+	}
+	return decodeB64(cd.Challenge)
+}
+
+// ── Verification ─────────────────────────────────────────────────────
+
+// VerifiedCredential is a newly registered credential.
+type VerifiedCredential struct {
+	ID           []byte
+	PublicKey    []byte // COSE_Key
+	SignCount    uint32
+	AAGUID       []byte
+	UserVerified bool
+}
+
+// VerifyRegistration checks a registration response against the challenge
+// it was issued for and returns the new credential. Attestation formats
+// "none" and "packed" are accepted; packed certificates are not checked
+// against trust anchors, as options always request "none".
+func (rp RelyingParty) VerifyRegistration(resp *RegistrationResponse, challenge []byte) (*VerifiedCredential, error) {
+	if resp.Type != "public-key" {
+		return nil, fmt.Errorf("webauthn: unexpected credential type %q", resp.Type)
+	}
+	clientDataHash, err := rp.verifyClientData(resp.Response.ClientDataJSON, "webauthn.create", challenge)
+	if err != nil {
+		return nil, err
+	}
+
+	rawAtt, err := decodeB64(resp.Response.AttestationObject)
+	if err != nil {
+		return nil, fmt.Errorf("webauthn: attestation object: %w", err)
+	}
+	v, _, err := cborDecode(rawAtt)
+	if err != nil {
+		return nil, fmt.Errorf("webauthn: attestation object: %w", err)
+	}
+	att, ok := v.(map[any]any)
+	if !ok {
+		return nil, errors.New("webauthn: attestation object is not a map")
+	}
+	format, _ := att["fmt"].(string)
+	stmt, _ := att["attStmt"].(map[any]any)
+	rawAuthData, _ := att["authData"].([]byte)
+
+	ad, err := parseAuthenticatorData(rawAuthData)
+	if err != nil {
+		return nil, err
+	}
+	if err := rp.checkAuthenticatorData(ad, false); err != nil {
+		return nil, err
+	}
+	if ad.flags&flagAttested == 0 || len(ad.credentialID) == 0 {
+		return nil, errors.New("webauthn: no attested credential data")
+	}
+	key, err := parseCOSEKey(ad.publicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	signed := append(append([]byte(nil), rawAuthData...), clientDataHash...)
+	switch format {
+	case "none":
+		if len(stmt) != 0 {
+			return nil, errors.New("webauthn: none attestation with a statement")
+		}
+	case "packed":
+		if err := verifyPackedAttestation(stmt, key, signed); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("webauthn: unsupported attestation format %q", format)
+	}
+
+	if id, err := decodeB64(resp.RawID); err != nil || !bytes.Equal(id, ad.credentialID) {
+		return nil, errors.New("webauthn: credential id does not match authenticator data")
+	}
+
+	return &VerifiedCredential{
+		ID:           ad.credentialID,
+		PublicKey:    ad.publicKey,
+		SignCount:    ad.signCount,
+		AAGUID:       ad.aaguid,
+		UserVerified: ad.flags&flagUserVerified != 0,
+	}, nil
+}
+
+// VerifyAssertion checks a login response against the challenge it was
+// issued for and the stored credential, and returns the new signature
+// counter. A counter that did not increase means the credential may have
+// been cloned, and is rejected unless the authenticator does not keep one.
+func (rp RelyingParty) VerifyAssertion(resp *AssertionResponse, challenge, publicKey []byte, storedSignCount uint32, requireUV bool) (uint32, error) {
+	if resp.Type != "public-key" {
+		return 0, fmt.Errorf("webauthn: unexpected credential type %q", resp.Type)
+	}
+	clientDataHash, err := rp.verifyClientData(resp.Response.ClientDataJSON, "webauthn.get", challenge)
+	if err != nil {
+		return 0, err
+	}
+
+	rawAuthData, err := decodeB64(resp.Response.AuthenticatorData)
+	if err != nil {
+		return 0, fmt.Errorf("webauthn: authenticator data: %w", err)
+	}
+	ad, err := parseAuthenticatorData(rawAuthData)
+	if err != nil {
+		return 0, err
+	}
+	if err := rp.checkAuthenticatorData(ad, requireUV); err != nil {
+		return 0, err
+	}
+
+	sig, err := decodeB64(resp.Response.Signature)
+	if err != nil {
+		return 0, fmt.Errorf("webauthn: signature: %w", err)
+	}
+	key, err := parseCOSEKey(publicKey)
+	if err != nil {
+		return 0, err
+	}
+	signed := append(append([]byte(nil), rawAuthData...), clientDataHash...)
+	if err := key.verify(signed, sig); err != nil {
+		return 0, err
+	}
+
+	if (ad.signCount != 0 || storedSignCount != 0) && ad.signCount <= storedSignCount {
+		return 0, fmt.Errorf("webauthn: signature counter %d not above stored %d, credential may be cloned", ad.signCount, storedSignCount)
+	}
+	return ad.signCount, nil
+}
+
+// verifyClientData checks the client data and returns its SHA-256 hash.
+func (rp RelyingParty) verifyClientData(encoded, ceremony string, challenge []byte) ([]byte, error) {
+	raw, err := decodeB64(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("webauthn: client data: %w", err)
+	}
+	var cd clientData
+	if err := json.Unmarshal(raw, &cd); err != nil {
+		return nil, fmt.Errorf("webauthn: client data: %w", err)
+	}
+	if cd.Type != ceremony {
+		return nil, fmt.Errorf("webauthn: client data type %q, want %q", cd.Type, ceremony)
+	}
+	got, err := decodeB64(cd.Challenge)
+	if err != nil || !bytes.Equal(got, challenge) {
+		return nil, errors.New("webauthn: challenge mismatch")
+	}
+	if !slices.Contains(rp.Origins, cd.Origin) {
+		return nil, fmt.Errorf("webauthn: origin %q not allowed", cd.Origin)
+	}
+	if cd.CrossOrigin {
+		return nil, errors.New("webauthn: cross-origin requests are not allowed")
+	}
+	sum := sha256.Sum256(raw)
+	return sum[:], nil
+}
+
+func (rp RelyingParty) checkAuthenticatorData(ad *authenticatorData, requireUV bool) error {
+	want := sha256.Sum256([]byte(rp.ID))
+	if !bytes.Equal(ad.rpIDHash, want[:]) {
+		return errors.New("webauthn: relying party id mismatch")
+	}
+	if ad.flags&flagUserPresent == 0 {
+		return errors.New("webauthn: user not present")
+	}
+	if requireUV && ad.flags&flagUserVerified == 0 {
+		return errors.New("webauthn: user not verified")
+	}
+	return nil
+}
+
+// ── Authenticator data ───────────────────────────────────────────────
+
+type authenticatorData struct {
+	rpIDHash     []byte
+	flags        byte
+	signCount    uint32
+	aaguid       []byte
+	credentialID []byte
+	publicKey    []byte // COSE_Key, raw
+}
+
+func parseAuthenticatorData(b []byte) (*authenticatorData, error) {
+	if len(b) < 37 {
+		return nil, errors.New("webauthn: authenticator data too short")
+	}
+	ad := &authenticatorData{
+		rpIDHash:  b[:32],
+		flags:     b[32],
+		signCount: binary.BigEndian.Uint32(b[33:37]),
+	}
+	if ad.flags&flagAttested == 0 {
+		return ad, nil
+	}
+
+	rest := b[37:]
+	if len(rest) < 18 {
+		return nil, errors.New("webauthn: attested credential data too short")
+	}
+	ad.aaguid = rest[:16]
+	idLen := int(binary.BigEndian.Uint16(rest[16:18]))
+	rest = rest[18:]
+	if len(rest) < idLen {
+		return nil, errors.New("webauthn: credential id truncated")
+	}
+	ad.credentialID = rest[:idLen]
+	rest = rest[idLen:]
+
+	// The key is followed by extensions, if any; decoding it tells us
+	// where it ends.
+	_, after, err := cborDecode(rest)
+	if err != nil {
+		return nil, fmt.Errorf("webauthn: credential public key: %w", err)
+	}
+	ad.publicKey = rest[:len(rest)-len(after)]
+	return ad, nil
+}
+
+// ── COSE keys ────────────────────────────────────────────────────────
+
+type coseKey struct {
+	alg int64
+	pub crypto.PublicKey
+}
+
+// parseCOSEKey decodes a COSE_Key (RFC 9053) for one of the supported
+// algorithms.
+func parseCOSEKey(b []byte) (*coseKey, error) {
+	v, _, err := cborDecode(b)
+	if err != nil {
+		return nil, fmt.Errorf("webauthn: public key: %w", err)
+	}
+	m, ok := v.(map[any]any)
+	if !ok {
+		return nil, errors.New("webauthn: public key is not a map")
+	}
+	kty, _ := m[int64(1)].(int64)
+	alg, _ := m[int64(3)].(int64)
+
+	switch {
+	case kty == 2 && alg == coseAlgES256: // EC2, P-256
+		x, _ := m[int64(-2)].([]byte)
+		y, _ := m[int64(-3)].([]byte)
+		if crv, _ := m[int64(-1)].(int64); crv != 1 || len(x) != 32 || len(y) != 32 {
+			return nil, errors.New("webauthn: invalid P-256 key")
+		}
+		point := append(append([]byte{4}, x...), y...)
+		if _, err := ecdh.P256().NewPublicKey(point); err != nil {
+			return nil, fmt.Errorf("webauthn: invalid P-256 key: %w", err)
+		}
+		return &coseKey{alg: alg, pub: &ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}}, nil
+	case kty == 1 && alg == coseAlgEdDSA: // OKP, Ed25519
+		x, _ := m[int64(-2)].([]byte)
+		if crv, _ := m[int64(-1)].(int64); crv != 6 || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("webauthn: invalid Ed25519 key")
+		}
+		return &coseKey{alg: alg, pub: ed25519.PublicKey(x)}, nil
+	case kty == 3 && alg == coseAlgRS256: // RSA
+		n, _ := m[int64(-1)].([]byte)
+		e, _ := m[int64(-2)].([]byte)
+		exp := new(big.Int).SetBytes(e)
+		if len(n)*8 < 2048 || !exp.IsInt64() || exp.Int64() < 3 || exp.Int64() > 1<<31-1 {
+			return nil, errors.New("webauthn: invalid RSA key")
+		}
+		return &coseKey{alg: alg, pub: &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exp.Int64())}}, nil
+	}
+	return nil, fmt.Errorf("webauthn: unsupported key type %d with algorithm %d", kty, alg)
+}
+
+func (k *coseKey) verify(data, sig []byte) error {
+	if !verifySignature(k.alg, k.pub, data, sig) {
+		return errors.New("webauthn: invalid signature")
+	}
+	return nil
+}
+
+func verifySignature(alg int64, pub crypto.PublicKey, data, sig []byte) bool {
+	switch alg {
+	case coseAlgES256:
+		key, ok := pub.(*ecdsa.PublicKey)
+		digest := sha256.Sum256(data)
+		return ok && ecdsa.VerifyASN1(key, digest[:], sig)
+	case coseAlgEdDSA:
+		key, ok := pub.(ed25519.PublicKey)
+		return ok && ed25519.Verify(key, data, sig)
+	case coseAlgRS256:
+		key, ok := pub.(*rsa.PublicKey)
+		digest := sha256.Sum256(data)
+		return ok && rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], sig) == nil
+	}
+	return false
+}
+
+// verifyPackedAttestation checks a "packed" attestation signature, either
+// self attestation by the credential key or by the leaf certificate in x5c.
+func verifyPackedAttestation(stmt map[any]any, key *coseKey, signed []byte) error {
+	alg, _ := stmt["alg"].(int64)
+	sig, _ := stmt["sig"].([]byte)
+	x5c, _ := stmt["x5c"].([]any)
+
+	if len(x5c) == 0 {
+		if alg != key.alg {
+			return errors.New("webauthn: packed self attestation algorithm mismatch")
+		}
+		return key.verify(signed, sig)
+	}
+
+	der, _ := x5c[0].([]byte)
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return fmt.Errorf("webauthn: attestation certificate: %w", err)
+	}
+	if !verifySignature(alg, cert.PublicKey, signed, sig) {
+		return errors.New("webauthn: invalid attestation signature")
+	}
+	return nil
+}
+
+// ── Ceremony sessions ────────────────────────────────────────────────
+
+// Ceremonies tracked by WebAuthnSessions.
+const (
+	CeremonyRegister     = "register"
+	CeremonySecondFactor = "second_factor"
+	CeremonyPasswordless = "passwordless"
+)
+
+// WebAuthnSession is a pending registration or login ceremony.
+type WebAuthnSession struct {
+	Challenge []byte
+	Ceremony  string
+	UserID    int64  // 0 for passwordless login, where the credential names the user
+	Client    string // IP address that started a passwordless login
+	expires   time.Time
+}
+
+// WebAuthnSessions holds pending ceremonies in memory, keyed by challenge.
+// Each can be completed once, within WebAuthnTimeout.
+type WebAuthnSessions struct {
+	mu       sync.Mutex
+	sessions map[string]WebAuthnSession
+}
+
+// NewWebAuthnSessions creates an empty session store.
+func NewWebAuthnSessions() *WebAuthnSessions {
+	return &WebAuthnSessions{sessions: make(map[string]WebAuthnSession)}
+}
+
+// Put records a pending ceremony. Passwordless ceremonies are capped
+// separately from the others, in total and per client.
+func (s *WebAuthnSessions) Put(sess WebAuthnSession) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	var authenticated, passwordless, fromClient int
+	for k, v := range s.sessions {
+		switch {
+		case now.After(v.expires):
+			delete(s.sessions, k)
+		case v.Ceremony != CeremonyPasswordless:
+			authenticated++
+		default:
+			passwordless++
+			if v.Client == sess.Client {
+				fromClient++
+			}
+		}
+	}
+	if sess.Ceremony != CeremonyPasswordless {
+		if authenticated >= maxWebAuthnSessions {
+			return errors.New("webauthn: too many pending ceremonies")
+		}
+	} else if passwordless >= maxPasswordlessSessions || fromClient >= maxPasswordlessPerClient {
+		return errors.New("webauthn: too many pending passwordless logins")
+	}
+	sess.expires = now.Add(WebAuthnTimeout)
+	s.sessions[string(sess.Challenge)] = sess
+	return nil
+}
+
+// Take removes and returns the pending ceremony for challenge, if it exists
+// and has not expired.
+func (s *WebAuthnSessions) Take(challenge []byte) (WebAuthnSession, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sess, ok := s.sessions[string(challenge)]
+	if !ok {
+		return WebAuthnSession{}, false
+	}
+	delete(s.sessions, string(challenge))
+	if time.Now().After(sess.expires) {
+		return WebAuthnSession{}, false
+	}
+	return sess, true
+}
+
+// ── Encoding ─────────────────────────────────────────────────────────
+
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// decodeB64 decodes base64url with or without padding.
+func decodeB64(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+}
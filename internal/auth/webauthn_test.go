@@ -0,0 +1,215 @@
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/itsChris/wgpilot/internal/testutil"
+)
+
+var testRP = RelyingParty{ID: "vpn.example.com", Name: "wgpilot", Origins: []string{"https://vpn.example.com"}}
+
+func registerSoft(t *testing.T, a *testutil.SoftAuthenticator) (*VerifiedCredential, error) {
+	t.Helper()
+	challenge, err := NewWebAuthnChallenge()
+	if err != nil {
+		t.Fatalf("NewWebAuthnChallenge: %v", err)
+	}
+	raw, err := a.Register(challenge, UserHandle(1))
+	if err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	var resp RegistrationResponse
+	if err := json.Unmarshal(raw, &resp); err != nil {
+		t.Fatalf("unmarshal registration: %v", err)
+	}
+	got, err := ClientDataChallenge(resp.Response.ClientDataJSON)
+	if err != nil || string(got) != string(challenge) {
+		t.Fatalf("ClientDataChallenge = %x, %v; want %x", got, err, challenge)
+	}
+	return testRP.VerifyRegistration(&resp, challenge)
+}
+
+func assertSoft(t *testing.T, a *testutil.SoftAuthenticator, cred *VerifiedCredential, signCount uint32, requireUV bool) (uint32, error) {
+	t.Helper()
+	challenge, _ := NewWebAuthnChallenge()
+	raw, err := a.Assert(challenge, cred.ID)
+	if err != nil {
+		t.Fatalf("Assert: %v", err)
+	}
+	var resp AssertionResponse
+	if err := json.Unmarshal(raw, &resp); err != nil {
+		t.Fatalf("unmarshal assertion: %v", err)
+	}
+	return testRP.VerifyAssertion(&resp, challenge, cred.PublicKey, signCount, requireUV)
+}
+
+func TestWebAuthn_RegisterAndAssert(t *testing.T) {
+	for _, packed := range []bool{false, true} {
+		a := testutil.NewSoftAuthenticator(testRP.ID, testRP.Origins[0])
+		a.Packed = packed
+
+		cred, err := registerSoft(t, a)
+		if err != nil {
+			t.Fatalf("VerifyRegistration (packed=%v): %v", packed, err)
+		}
+		if !cred.UserVerified || len(cred.ID) != 16 {
+			t.Errorf("unexpected credential: %+v", cred)
+		}
+
+		count, err := assertSoft(t, a, cred, cred.SignCount, true)
+		if err != nil {
+			t.Fatalf("VerifyAssertion: %v", err)
+		}
+		if count != 1 {
+			t.Errorf("sign count = %d, want 1", count)
+		}
+	}
+}
+
+func TestWebAuthn_RejectsWrongOriginAndRPID(t *testing.T) {
+	a := testutil.NewSoftAuthenticator(testRP.ID, "https://evil.example.com")
+	if _, err := registerSoft(t, a); err == nil {
+		t.Error("expected registration from a foreign origin to fail")
+	}
+
+	a = testutil.NewSoftAuthenticator("evil.example.com", testRP.Origins[0])
+	if _, err := registerSoft(t, a); err == nil {
+		t.Error("expected registration for a foreign rp id to fail")
+	}
+}
+
+func TestWebAuthn_RejectsCeremonyConfusion(t *testing.T) {
+	a := testutil.NewSoftAuthenticator(testRP.ID, testRP.Origins[0])
+	a.Type = "webauthn.get"
+	if _, err := registerSoft(t, a); err == nil {
+		t.Error("expected registration with get client data to fail")
+	}
+}
+
+func TestWebAuthn_AssertionChecks(t *testing.T) {
+	a := testutil.NewSoftAuthenticator(testRP.ID, testRP.Origins[0])
+	cred, err := registerSoft(t, a)
+	if err != nil {
+		t.Fatalf("VerifyRegistration: %v", err)
+	}
+
+	// A counter that does not increase suggests a cloned authenticator.
+	if _, err := assertSoft(t, a, cred, 100, false); err == nil {
+		t.Error("expected stale signature counter to be rejected")
+	}
+
+	a.UserVerified = false
+	if _, err := assertSoft(t, a, cred, 0, true); err == nil {
+		t.Error("expected missing user verification to be rejected when required")
+	}
+	if _, err := assertSoft(t, a, cred, 0, false); err != nil {
+		t.Errorf("expected assertion without user verification to pass: %v", err)
+	}
+
+	// A different credential's key must not verify the signature.
+	other, err := registerSoft(t, a)
+	if err != nil {
+		t.Fatalf("VerifyRegistration: %v", err)
+	}
+	challenge, _ := NewWebAuthnChallenge()
+	raw, _ := a.Assert(challenge, other.ID)
+	var resp AssertionResponse
+	json.Unmarshal(raw, &resp)
+	if _, err := testRP.VerifyAssertion(&resp, challenge, cred.PublicKey, 0, false); err == nil {
+		t.Error("expected signature from another credential to be rejected")
+	}
+	if _, err := testRP.VerifyAssertion(&resp, []byte("other challenge"), other.PublicKey, 0, false); err == nil {
+		t.Error("expected challenge mismatch to be rejected")
+	}
+}
+
+func TestWebAuthnSessions(t *testing.T) {
+	s := NewWebAuthnSessions()
+	if err := s.Put(WebAuthnSession{Challenge: []byte("c1"), Ceremony: CeremonyRegister, UserID: 7}); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+
+	sess, ok := s.Take([]byte("c1"))
+	if !ok || sess.UserID != 7 || sess.Ceremony != CeremonyRegister {
+		t.Fatalf("Take = %+v, %v", sess, ok)
+	}
+	if _, ok := s.Take([]byte("c1")); ok {
+		t.Error("expected a challenge to be usable once")
+	}
+
+	s.Put(WebAuthnSession{Challenge: []byte("c2")})
+	s.mu.Lock()
+	e := s.sessions["c2"]
+	e.expires = time.Now().Add(-time.Second)
+	s.sessions["c2"] = e
+	s.mu.Unlock()
+	if _, ok := s.Take([]byte("c2")); ok {
+		t.Error("expected expired challenge to be rejected")
+	}
+}
+
+func TestWebAuthnSessions_PasswordlessCaps(t *testing.T) {
+	s := NewWebAuthnSessions()
+	put := func(i int, ceremony, client string) error {
+		return s.Put(WebAuthnSession{Challenge: []byte(fmt.Sprintf("c%d", i)), Ceremony: ceremony, Client: client})
+	}
+
+	for i := 0; i < maxPasswordlessPerClient; i++ {
+		if err := put(i, CeremonyPasswordless, "192.0.2.1"); err != nil {
+			t.Fatalf("Put %d: %v", i, err)
+		}
+	}
+	if err := put(100, CeremonyPasswordless, "192.0.2.1"); err == nil {
+		t.Error("expected a client over its passwordless cap to be rejected")
+	}
+	if err := put(101, CeremonyPasswordless, "192.0.2.2"); err != nil {
+		t.Errorf("another client: %v", err)
+	}
+
+	// Passwordless logins do not count against other ceremonies.
+	for i := 200; len(s.sessions) < maxPasswordlessSessions; i++ {
+		s.sessions[fmt.Sprintf("p%d", i)] = WebAuthnSession{Ceremony: CeremonyPasswordless, Client: fmt.Sprint(i), expires: time.Now().Add(time.Minute)}
+	}
+	if err := put(102, CeremonyPasswordless, "192.0.2.3"); err == nil {
+		t.Error("expected the passwordless pool to be full")
+	}
+	if err := put(103, CeremonySecondFactor, ""); err != nil {
+		t.Errorf("second factor with a full passwordless pool: %v", err)
+	}
+}
+
+func TestCBORDecode(t *testing.T) {
+	// {1: -7, "a": h'0102', "b": [true, null, 1.5]}
+	data := []byte{0xa3, 0x01, 0x26, 0x61, 'a', 0x42, 1, 2, 0x61, 'b', 0x83, 0xf5, 0xf6, 0xf9, 0x3e, 0x00, 0xff}
+	v, rest, err := cborDecode(data)
+	if err != nil {
+		t.Fatalf("cborDecode: %v", err)
+	}
+	if len(rest) != 1 || rest[0] != 0xff {
+		t.Errorf("rest = %x, want ff", rest)
+	}
+	m := v.(map[any]any)
+	if m[int64(1)] != int64(-7) {
+		t.Errorf("m[1] = %v, want -7", m[int64(1)])
+	}
+	if b := m["a"].([]byte); len(b) != 2 || b[1] != 2 {
+		t.Errorf(`m["a"] = %x`, b)
+	}
+	if arr := m["b"].([]any); arr[0] != true || arr[1] != nil || arr[2] != 1.5 {
+		t.Errorf(`m["b"] = %v`, arr)
+	}
+
+	if _, _, err := cborDecode([]byte{0x5a, 0xff, 0xff, 0xff, 0xff}); err == nil {
+		t.Error("expected truncated byte string to fail")
+	}
+	deep := make([]byte, 100)
+	for i := range deep {
+		deep[i] = 0x81
+	}
+	if _, _, err := cborDecode(deep); err == nil {
+		t.Error("expected deeply nested input to fail")
+	}
+}
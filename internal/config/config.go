@@ -3,7 +3,10 @@ package config
 import (
 	"fmt"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/knadh/koanf/parsers/yaml"
 	"github.com/knadh/koanf/providers/env"
@@ -24,24 +27,106 @@ type Config struct {
 	TLS      TLSConfig      `koanf:"tls"`
 	Logging  LoggingConfig  `koanf:"logging"`
 	Monitor  MonitorConfig  `koanf:"monitor"`
+	GeoIP    GeoIPConfig    `koanf:"geoip"`
+	Hooks    HooksConfig    `koanf:"hooks"`
+	Metrics  MetricsConfig  `koanf:"metrics"`
+	Tracing  TracingConfig  `koanf:"tracing"`
 }
 
 // ServerConfig holds HTTP server settings.
 type ServerConfig struct {
-	Listen  string `koanf:"listen"`
-	DevMode bool   `koanf:"dev_mode"`
+	Listen      string `koanf:"listen"`
+	ExternalURL string `koanf:"external_url"` // base URL users reach the UI at, e.g. https://vpn.example.com; used for links in emails
+	DevMode     bool   `koanf:"dev_mode"`
 }
 
 // DatabaseConfig holds SQLite settings.
 type DatabaseConfig struct {
 	Path string `koanf:"path"`
+	// TimeSeriesPath is the SQLite file for peer snapshots and traffic
+	// totals. Empty means wgpilot-timeseries.db next to Path.
+	TimeSeriesPath string `koanf:"timeseries_path"`
+}
+
+// TimeSeriesFile returns the path of the time-series database.
+func (c DatabaseConfig) TimeSeriesFile() string {
+	if c.TimeSeriesPath != "" {
+		return c.TimeSeriesPath
+	}
+	return filepath.Join(filepath.Dir(c.Path), "wgpilot-timeseries.db")
 }
 
 // AuthConfig holds authentication settings.
 type AuthConfig struct {
-	SessionTTL    string `koanf:"session_ttl"`
-	BcryptCost    int    `koanf:"bcrypt_cost"`
-	RateLimitRPM  int    `koanf:"rate_limit_rpm"`
+	SessionTTL     string               `koanf:"session_ttl"`
+	BcryptCost     int                  `koanf:"bcrypt_cost"`
+	RateLimitRPM   int                  `koanf:"rate_limit_rpm"`
+	WebAuthn       WebAuthnConfig       `koanf:"webauthn"`
+	OIDC           OIDCConfig           `koanf:"oidc"`
+	LDAP           LDAPConfig           `koanf:"ldap"`
+	PasswordPolicy PasswordPolicyConfig `koanf:"password_policy"`
+	Lockout        LockoutConfig        `koanf:"lockout"`
+}
+
+// PasswordPolicyConfig holds the rules for local passwords. They apply
+// whenever a password is set, not to existing passwords.
+type PasswordPolicyConfig struct {
+	MinLength    int    `koanf:"min_length"`    // never below 10
+	BreachedList string `koanf:"breached_list"` // file of breached passwords or their SHA-1 hashes, one per line
+	History      int    `koanf:"history"`       // recent passwords, the current one included, that cannot be reused
+}
+
+// LockoutConfig holds per-account lockout settings for local password
+// logins. A threshold of 0 disables lockout.
+type LockoutConfig struct {
+	Threshold int    `koanf:"threshold"` // consecutive failed logins that lock the account
+	Duration  string `koanf:"duration"`  // e.g. "15m"
+}
+
+// WebAuthnConfig holds security key and passkey settings. Both default to
+// the host the UI is served from; set them when that differs between
+// requests, e.g. behind a reverse proxy that terminates TLS.
+type WebAuthnConfig struct {
+	RPID    string   `koanf:"rp_id"`   // domain credentials are bound to, e.g. vpn.example.com
+	Origins []string `koanf:"origins"` // allowed origins, e.g. https://vpn.example.com
+}
+
+// OIDCConfig holds OpenID Connect single sign-on settings. Users are
+// provisioned on first login with the role their groups map to.
+type OIDCConfig struct {
+	Enabled              bool              `koanf:"enabled"`
+	Issuer               string            `koanf:"issuer"`                 // e.g. https://login.example.com/realms/main
+	ClientID             string            `koanf:"client_id"`
+	ClientSecret         string            `koanf:"client_secret"`          // empty for a public client
+	Scopes               []string          `koanf:"scopes"`                 // "openid" is always requested
+	RedirectURL          string            `koanf:"redirect_url"`           // defaults to /api/auth/oidc/callback on the request host
+	UsernameClaim        string            `koanf:"username_claim"`         // defaults to preferred_username
+	GroupsClaim          string            `koanf:"groups_claim"`           // defaults to groups
+	RoleMapping          map[string]string `koanf:"role_mapping"`           // group → admin or viewer
+	DefaultRole          string            `koanf:"default_role"`           // role without a matching group; empty denies login
+	DisablePasswordLogin bool              `koanf:"disable_password_login"` // allow single sign-on only
+}
+
+// LDAPConfig holds LDAP / Active Directory login settings. Users marked as
+// directory users, and with ProvisionUsers any user without a local
+// account, log in with their directory password.
+type LDAPConfig struct {
+	Enabled            bool              `koanf:"enabled"`
+	URL                string            `koanf:"url"`       // ldap://host:389 or ldaps://host:636
+	StartTLS           bool              `koanf:"start_tls"` // upgrade ldap:// before binding
+	CAFile             string            `koanf:"ca_file"`   // PEM bundle; defaults to the system roots
+	InsecureSkipVerify bool              `koanf:"insecure_skip_verify"`
+	BindDN             string            `koanf:"bind_dn"` // service account used to search
+	BindPassword       string            `koanf:"bind_password"`
+	BaseDN             string            `koanf:"base_dn"`
+	UserFilter         string            `koanf:"user_filter"`     // default (uid={username}); AD: (sAMAccountName={username})
+	GroupAttribute     string            `koanf:"group_attribute"` // default memberOf
+	GroupBaseDN        string            `koanf:"group_base_dn"`   // search groups here instead of reading group_attribute
+	GroupFilter        string            `koanf:"group_filter"`    // default (member={dn})
+	RoleMapping        map[string]string `koanf:"role_mapping"`    // group DN → admin or viewer
+	DefaultRole        string            `koanf:"default_role"`    // role without a matching group; empty denies login
+	ProvisionUsers     bool              `koanf:"provision_users"` // create accounts on first login
+	Timeout            string            `koanf:"timeout"`
 }
 
 // TLSConfig holds TLS certificate settings.
@@ -64,6 +149,44 @@ type MonitorConfig struct {
 	PollInterval       string `koanf:"poll_interval"`
 	SnapshotRetention  string `koanf:"snapshot_retention"`
 	CompactionInterval string `koanf:"compaction_interval"`
+	QuotaInterval      string `koanf:"quota_interval"`
+	QuotaThrottleKbps  int    `koanf:"quota_throttle_kbps"`
+}
+
+// GeoIPConfig holds offline GeoIP enrichment settings. Both files are
+// MaxMind-format (.mmdb) databases; leaving both empty disables enrichment.
+type GeoIPConfig struct {
+	Database    string `koanf:"database"`     // country/city, e.g. GeoLite2-City.mmdb
+	ASNDatabase string `koanf:"asn_database"` // optional, e.g. GeoLite2-ASN.mmdb
+}
+
+// MetricsConfig holds Prometheus endpoint settings.
+type MetricsConfig struct {
+	Token string `koanf:"token"` // bearer token required on /metrics; empty leaves it open
+}
+
+// TracingConfig holds OpenTelemetry trace export settings. Leaving the
+// endpoint empty disables tracing.
+type TracingConfig struct {
+	Endpoint    string            `koanf:"endpoint"`     // OTLP/HTTP collector, e.g. http://localhost:4318
+	SampleRate  float64           `koanf:"sample_rate"`  // fraction of new traces recorded, 0 to 1
+	ServiceName string            `koanf:"service_name"` // service.name resource attribute
+	Headers     map[string]string `koanf:"headers"`      // sent with every export, e.g. an API key
+}
+
+// HooksConfig holds local event hook settings. Hooks can only be set in the
+// config file, not through the API.
+type HooksConfig struct {
+	Timeout       string       `koanf:"timeout"`        // per run, e.g. "30s"
+	MaxConcurrent int          `koanf:"max_concurrent"` // hooks running at once
+	Scripts       []HookScript `koanf:"scripts"`
+}
+
+// HookScript registers an executable for one event, e.g. peer_online.
+type HookScript struct {
+	Event   string   `koanf:"event"`
+	Command string   `koanf:"command"` // absolute path; not run through a shell
+	Args    []string `koanf:"args"`
 }
 
 // Load reads configuration with priority: flags > env > yaml file > defaults.
@@ -114,18 +237,31 @@ func Load(configPath string, flags *pflag.FlagSet) (*Config, error) {
 
 func loadDefaults(k *koanf.Koanf) error {
 	defaults := map[string]any{
-		"server.listen":               "0.0.0.0:443",
-		"server.dev_mode":             false,
-		"database.path":               "/var/lib/wgpilot/wgpilot.db",
-		"auth.session_ttl":            "24h",
-		"auth.bcrypt_cost":            12,
-		"auth.rate_limit_rpm":         5,
-		"tls.mode":                    "self-signed",
-		"logging.level":               "info",
-		"logging.format":              "json",
-		"monitor.poll_interval":       "30s",
-		"monitor.snapshot_retention":  "30d",
-		"monitor.compaction_interval": "24h",
+		"server.listen":                   "0.0.0.0:443",
+		"server.dev_mode":                 false,
+		"database.path":                   "/var/lib/wgpilot/wgpilot.db",
+		"auth.session_ttl":                "24h",
+		"auth.bcrypt_cost":                12,
+		"auth.rate_limit_rpm":             5,
+		"auth.oidc.scopes":                []string{"openid", "profile", "email"},
+		"auth.ldap.provision_users":       true,
+		"auth.ldap.timeout":               "10s",
+		"auth.password_policy.min_length": 10,
+		"auth.password_policy.history":    5,
+		"auth.lockout.threshold":          10,
+		"auth.lockout.duration":           "15m",
+		"tls.mode":                        "self-signed",
+		"logging.level":                   "info",
+		"logging.format":                  "json",
+		"monitor.poll_interval":           "30s",
+		"monitor.snapshot_retention":      "48h",
+		"monitor.compaction_interval":     "1h",
+		"monitor.quota_interval":          "5m",
+		"monitor.quota_throttle_kbps":     1024,
+		"tracing.sample_rate":             1.0,
+		"tracing.service_name":            "wgpilot",
+		"hooks.timeout":                   "30s",
+		"hooks.max_concurrent":            4,
 	}
 
 	for key, val := range defaults {
@@ -136,3 +272,16 @@ func loadDefaults(k *koanf.Koanf) error {
 
 	return nil
 }
+
+// ParseDuration parses a duration string like time.ParseDuration, and
+// additionally accepts a whole number of days with a "d" suffix (e.g. "30d").
+func ParseDuration(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(s)
+}
@@ -5,9 +5,63 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"net/netip"
+	"strconv"
+	"strings"
 	"time"
 )
 
+// Endpoint alert types. Their thresholds are parsed with
+// ParseFlappingThreshold and ParseCIDRThreshold.
+const (
+	// AlertTypeEndpointFlapping fires when a peer switches back and forth
+	// between two addresses, which suggests its key is used in two places.
+	AlertTypeEndpointFlapping = "endpoint_flapping"
+	// AlertTypeEndpointCIDR fires when a peer connects from an address
+	// outside the allowed CIDRs.
+	AlertTypeEndpointCIDR = "endpoint_cidr"
+)
+
+// ParseFlappingThreshold parses an endpoint_flapping threshold of the form
+// "<changes>/<window>", e.g. "4/10m": at least 4 endpoint changes within
+// 10 minutes.
+func ParseFlappingThreshold(s string) (changes int, window time.Duration, err error) {
+	count, dur, ok := strings.Cut(s, "/")
+	if !ok {
+		return 0, 0, fmt.Errorf("threshold %q must be <changes>/<window>, e.g. 4/10m", s)
+	}
+	changes, err = strconv.Atoi(strings.TrimSpace(count))
+	if err != nil || changes < 2 {
+		return 0, 0, fmt.Errorf("threshold %q: changes must be a number of at least 2", s)
+	}
+	window, err = time.ParseDuration(strings.TrimSpace(dur))
+	if err != nil || window <= 0 {
+		return 0, 0, fmt.Errorf("threshold %q: invalid window", s)
+	}
+	return changes, window, nil
+}
+
+// ParseCIDRThreshold parses an endpoint_cidr threshold: a comma-separated
+// list of allowed CIDRs, e.g. "198.51.100.0/24, 2001:db8::/32".
+func ParseCIDRThreshold(s string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		p, err := netip.ParsePrefix(part)
+		if err != nil {
+			return nil, fmt.Errorf("threshold: invalid CIDR %q", part)
+		}
+		prefixes = append(prefixes, p.Masked())
+	}
+	if len(prefixes) == 0 {
+		return nil, fmt.Errorf("threshold must list at least one CIDR")
+	}
+	return prefixes, nil
+}
+
 // Alert represents a row in the alerts table.
 type Alert struct {
 	ID        int64
@@ -5,6 +5,8 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -19,20 +21,26 @@ type APIKey struct {
 	ExpiresAt *time.Time
 	CreatedAt time.Time
 	LastUsed  *time.Time
+
+	// Scopes, NetworkIDs and AllowedCIDRs narrow what the key may do and
+	// where it may be used from. Empty means no restriction.
+	Scopes       []string
+	NetworkIDs   []int64
+	AllowedCIDRs []string
+
+	LastUsedIP string
+	ReplacedBy int64 // successor after a rotation, 0 if none
 }
 
+const apiKeyColumns = `id, name, key_hash, key_prefix, user_id, role, expires_at, created_at, last_used,
+		scopes, network_ids, allowed_cidrs, last_used_ip, COALESCE(replaced_by, 0)`
+
 // CreateAPIKey inserts a new API key and returns its ID.
 func (d *DB) CreateAPIKey(ctx context.Context, k *APIKey) (int64, error) {
-	var expiresAt *int64
-	if k.ExpiresAt != nil {
-		ts := k.ExpiresAt.Unix()
-		expiresAt = &ts
-	}
-
 	result, err := d.ExecContext(ctx, `
-		INSERT INTO api_keys (name, key_hash, key_prefix, user_id, role, expires_at)
-		VALUES (?, ?, ?, ?, ?, ?)`,
-		k.Name, k.KeyHash, k.KeyPrefix, k.UserID, k.Role, expiresAt,
+		INSERT INTO api_keys (name, key_hash, key_prefix, user_id, role, expires_at, scopes, network_ids, allowed_cidrs)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		apiKeyInsertArgs(k)...,
 	)
 	if err != nil {
 		return 0, fmt.Errorf("db: create api key: %w", err)
@@ -44,102 +52,97 @@ func (d *DB) CreateAPIKey(ctx context.Context, k *APIKey) (int64, error) {
 	return id, nil
 }
 
+// RotateAPIKey inserts successor as the replacement of key oldID, which
+// stays valid until oldExpiresAt. Returns the successor's ID.
+func (d *DB) RotateAPIKey(ctx context.Context, oldID int64, successor *APIKey, oldExpiresAt time.Time) (int64, error) {
+	tx, err := d.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("db: rotate api key %d: begin: %w", oldID, err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `
+		INSERT INTO api_keys (name, key_hash, key_prefix, user_id, role, expires_at, scopes, network_ids, allowed_cidrs)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		apiKeyInsertArgs(successor)...,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("db: rotate api key %d: insert successor: %w", oldID, err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("db: rotate api key %d: last insert id: %w", oldID, err)
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE api_keys SET replaced_by = ?, expires_at = ? WHERE id = ?`,
+		id, oldExpiresAt.Unix(), oldID,
+	); err != nil {
+		return 0, fmt.Errorf("db: rotate api key %d: retire: %w", oldID, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("db: rotate api key %d: commit: %w", oldID, err)
+	}
+	return id, nil
+}
+
 // GetAPIKeyByHash retrieves an API key by its hash.
 // Returns nil, nil if not found.
 func (d *DB) GetAPIKeyByHash(ctx context.Context, hash string) (*APIKey, error) {
-	k := &APIKey{}
-	var createdAt int64
-	var expiresAt, lastUsed sql.NullInt64
-	err := d.QueryRowContext(ctx, `
-		SELECT id, name, key_hash, key_prefix, user_id, role, expires_at, created_at, last_used
-		FROM api_keys WHERE key_hash = ?`, hash,
-	).Scan(&k.ID, &k.Name, &k.KeyHash, &k.KeyPrefix, &k.UserID, &k.Role, &expiresAt, &createdAt, &lastUsed)
+	k, err := scanAPIKey(d.QueryRowContext(ctx,
+		"SELECT "+apiKeyColumns+" FROM api_keys WHERE key_hash = ?", hash,
+	))
 	if errors.Is(err, sql.ErrNoRows) {
 		return nil, nil
 	}
 	if err != nil {
 		return nil, fmt.Errorf("db: get api key by hash: %w", err)
 	}
-	k.CreatedAt = time.Unix(createdAt, 0)
-	if expiresAt.Valid {
-		t := time.Unix(expiresAt.Int64, 0)
-		k.ExpiresAt = &t
+	return k, nil
+}
+
+// GetAPIKeyByID retrieves an API key by ID.
+// Returns nil, nil if not found.
+func (d *DB) GetAPIKeyByID(ctx context.Context, id int64) (*APIKey, error) {
+	k, err := scanAPIKey(d.QueryRowContext(ctx,
+		"SELECT "+apiKeyColumns+" FROM api_keys WHERE id = ?", id,
+	))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
 	}
-	if lastUsed.Valid {
-		t := time.Unix(lastUsed.Int64, 0)
-		k.LastUsed = &t
+	if err != nil {
+		return nil, fmt.Errorf("db: get api key %d: %w", id, err)
 	}
 	return k, nil
 }
 
 // ListAPIKeys returns all API keys for a user.
 func (d *DB) ListAPIKeys(ctx context.Context, userID int64) ([]APIKey, error) {
-	rows, err := d.QueryContext(ctx, `
-		SELECT id, name, key_hash, key_prefix, user_id, role, expires_at, created_at, last_used
-		FROM api_keys WHERE user_id = ? ORDER BY id`, userID)
+	rows, err := d.QueryContext(ctx,
+		"SELECT "+apiKeyColumns+" FROM api_keys WHERE user_id = ? ORDER BY id", userID)
 	if err != nil {
 		return nil, fmt.Errorf("db: list api keys: %w", err)
 	}
 	defer rows.Close()
-
-	var keys []APIKey
-	for rows.Next() {
-		var k APIKey
-		var createdAt int64
-		var expiresAt, lastUsed sql.NullInt64
-		if err := rows.Scan(&k.ID, &k.Name, &k.KeyHash, &k.KeyPrefix, &k.UserID, &k.Role, &expiresAt, &createdAt, &lastUsed); err != nil {
-			return nil, fmt.Errorf("db: scan api key: %w", err)
-		}
-		k.CreatedAt = time.Unix(createdAt, 0)
-		if expiresAt.Valid {
-			t := time.Unix(expiresAt.Int64, 0)
-			k.ExpiresAt = &t
-		}
-		if lastUsed.Valid {
-			t := time.Unix(lastUsed.Int64, 0)
-			k.LastUsed = &t
-		}
-		keys = append(keys, k)
-	}
-	return keys, rows.Err()
+	return scanAPIKeys(rows)
 }
 
 // ListAllAPIKeys returns all API keys.
 func (d *DB) ListAllAPIKeys(ctx context.Context) ([]APIKey, error) {
-	rows, err := d.QueryContext(ctx, `
-		SELECT id, name, key_hash, key_prefix, user_id, role, expires_at, created_at, last_used
-		FROM api_keys ORDER BY id`)
+	rows, err := d.QueryContext(ctx,
+		"SELECT "+apiKeyColumns+" FROM api_keys ORDER BY id")
 	if err != nil {
 		return nil, fmt.Errorf("db: list all api keys: %w", err)
 	}
 	defer rows.Close()
-
-	var keys []APIKey
-	for rows.Next() {
-		var k APIKey
-		var createdAt int64
-		var expiresAt, lastUsed sql.NullInt64
-		if err := rows.Scan(&k.ID, &k.Name, &k.KeyHash, &k.KeyPrefix, &k.UserID, &k.Role, &expiresAt, &createdAt, &lastUsed); err != nil {
-			return nil, fmt.Errorf("db: scan api key: %w", err)
-		}
-		k.CreatedAt = time.Unix(createdAt, 0)
-		if expiresAt.Valid {
-			t := time.Unix(expiresAt.Int64, 0)
-			k.ExpiresAt = &t
-		}
-		if lastUsed.Valid {
-			t := time.Unix(lastUsed.Int64, 0)
-			k.LastUsed = &t
-		}
-		keys = append(keys, k)
-	}
-	return keys, rows.Err()
+	return scanAPIKeys(rows)
 }
 
-// UpdateAPIKeyLastUsed updates the last_used timestamp.
-func (d *DB) UpdateAPIKeyLastUsed(ctx context.Context, id int64) error {
+// UpdateAPIKeyLastUsed records that the key was just used from ip.
+func (d *DB) UpdateAPIKeyLastUsed(ctx context.Context, id int64, ip string) error {
 	_, err := d.ExecContext(ctx, `
-		UPDATE api_keys SET last_used = unixepoch() WHERE id = ?`, id)
+		UPDATE api_keys SET last_used = unixepoch(), last_used_ip = ? WHERE id = ?`, ip, id)
 	if err != nil {
 		return fmt.Errorf("db: update api key last used %d: %w", id, err)
 	}
@@ -154,3 +157,67 @@ func (d *DB) DeleteAPIKey(ctx context.Context, id int64) error {
 	}
 	return nil
 }
+
+func apiKeyInsertArgs(k *APIKey) []any {
+	var expiresAt *int64
+	if k.ExpiresAt != nil {
+		ts := k.ExpiresAt.Unix()
+		expiresAt = &ts
+	}
+	networkIDs := make([]string, len(k.NetworkIDs))
+	for i, id := range k.NetworkIDs {
+		networkIDs[i] = strconv.FormatInt(id, 10)
+	}
+	return []any{
+		k.Name, k.KeyHash, k.KeyPrefix, k.UserID, k.Role, expiresAt,
+		strings.Join(k.Scopes, ","), strings.Join(networkIDs, ","), strings.Join(k.AllowedCIDRs, ","),
+	}
+}
+
+func scanAPIKeys(rows *sql.Rows) ([]APIKey, error) {
+	var keys []APIKey
+	for rows.Next() {
+		k, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, fmt.Errorf("db: scan api key: %w", err)
+		}
+		keys = append(keys, *k)
+	}
+	return keys, rows.Err()
+}
+
+func scanAPIKey(row interface{ Scan(...any) error }) (*APIKey, error) {
+	k := &APIKey{}
+	var createdAt int64
+	var expiresAt, lastUsed sql.NullInt64
+	var scopes, networkIDs, allowedCIDRs string
+	if err := row.Scan(&k.ID, &k.Name, &k.KeyHash, &k.KeyPrefix, &k.UserID, &k.Role, &expiresAt, &createdAt, &lastUsed,
+		&scopes, &networkIDs, &allowedCIDRs, &k.LastUsedIP, &k.ReplacedBy); err != nil {
+		return nil, err
+	}
+	k.CreatedAt = time.Unix(createdAt, 0)
+	if expiresAt.Valid {
+		t := time.Unix(expiresAt.Int64, 0)
+		k.ExpiresAt = &t
+	}
+	if lastUsed.Valid {
+		t := time.Unix(lastUsed.Int64, 0)
+		k.LastUsed = &t
+	}
+	if scopes != "" {
+		k.Scopes = strings.Split(scopes, ",")
+	}
+	if networkIDs != "" {
+		for _, s := range strings.Split(networkIDs, ",") {
+			id, err := strconv.ParseInt(s, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("parse network id %q: %w", s, err)
+			}
+			k.NetworkIDs = append(k.NetworkIDs, id)
+		}
+	}
+	if allowedCIDRs != "" {
+		k.AllowedCIDRs = strings.Split(allowedCIDRs, ",")
+	}
+	return k, nil
+}
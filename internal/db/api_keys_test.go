@@ -0,0 +1,68 @@
+package db
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestAPIKeys_RestrictionsAndRotation(t *testing.T) {
+	d := testDB(t)
+	ctx := context.Background()
+	userID, err := d.CreateUser(ctx, &User{Username: "admin", PasswordHash: "h", Role: "admin"})
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+
+	id, err := d.CreateAPIKey(ctx, &APIKey{
+		Name: "ci", KeyHash: "old", KeyPrefix: "wgp_old", UserID: userID, Role: "admin",
+		Scopes:       []string{"peer:read", "peer:write"},
+		NetworkIDs:   []int64{1, 3},
+		AllowedCIDRs: []string{"10.0.0.0/8", "2001:db8::/32"},
+	})
+	if err != nil {
+		t.Fatalf("CreateAPIKey: %v", err)
+	}
+	if err := d.UpdateAPIKeyLastUsed(ctx, id, "10.1.2.3"); err != nil {
+		t.Fatalf("UpdateAPIKeyLastUsed: %v", err)
+	}
+
+	k, err := d.GetAPIKeyByHash(ctx, "old")
+	if err != nil || k == nil {
+		t.Fatalf("GetAPIKeyByHash: %v", err)
+	}
+	if !slices.Equal(k.Scopes, []string{"peer:read", "peer:write"}) ||
+		!slices.Equal(k.NetworkIDs, []int64{1, 3}) ||
+		!slices.Equal(k.AllowedCIDRs, []string{"10.0.0.0/8", "2001:db8::/32"}) {
+		t.Errorf("restrictions not round-tripped: %+v", k)
+	}
+	if k.LastUsed == nil || k.LastUsedIP != "10.1.2.3" || k.ReplacedBy != 0 {
+		t.Errorf("unexpected last use / replacement: %+v", k)
+	}
+
+	successor := *k
+	successor.KeyHash, successor.KeyPrefix = "new", "wgp_new"
+	overlapEnd := time.Now().Add(time.Hour).Truncate(time.Second)
+	newID, err := d.RotateAPIKey(ctx, id, &successor, overlapEnd)
+	if err != nil {
+		t.Fatalf("RotateAPIKey: %v", err)
+	}
+
+	old, _ := d.GetAPIKeyByID(ctx, id)
+	if old.ReplacedBy != newID || old.ExpiresAt == nil || !old.ExpiresAt.Equal(overlapEnd) {
+		t.Errorf("old key not retired: %+v", old)
+	}
+	next, _ := d.GetAPIKeyByHash(ctx, "new")
+	if next == nil || next.ID != newID || next.LastUsed != nil || !slices.Equal(next.NetworkIDs, []int64{1, 3}) {
+		t.Errorf("unexpected successor %+v", next)
+	}
+
+	// Deleting the successor leaves the old key without one.
+	if err := d.DeleteAPIKey(ctx, newID); err != nil {
+		t.Fatalf("DeleteAPIKey: %v", err)
+	}
+	if old, _ := d.GetAPIKeyByID(ctx, id); old.ReplacedBy != 0 {
+		t.Errorf("expected replaced_by to be cleared, got %d", old.ReplacedBy)
+	}
+}
@@ -16,6 +16,7 @@ type AuditEntry struct {
 	Resource  string
 	Detail    string
 	IPAddress string
+	NetworkID int64 // 0 for entries not tied to a network
 }
 
 // AuditFilter holds optional filters for listing audit entries.
@@ -23,14 +24,17 @@ type AuditFilter struct {
 	Action   string
 	Resource string
 	UserID   int64
+	// NetworkIDs, if not nil, restricts entries to those about these
+	// networks.
+	NetworkIDs []int64
 }
 
 // InsertAuditEntry inserts a new audit log entry.
 func (d *DB) InsertAuditEntry(ctx context.Context, entry *AuditEntry) error {
 	_, err := d.ExecContext(ctx, `
-		INSERT INTO audit_log (user_id, action, resource, detail, ip_address)
-		VALUES (?, ?, ?, ?, ?)`,
-		entry.UserID, entry.Action, entry.Resource, entry.Detail, entry.IPAddress,
+		INSERT INTO audit_log (user_id, action, resource, detail, ip_address, network_id)
+		VALUES (?, ?, ?, ?, ?, NULLIF(?, 0))`,
+		entry.UserID, entry.Action, entry.Resource, entry.Detail, entry.IPAddress, entry.NetworkID,
 	)
 	if err != nil {
 		return fmt.Errorf("db: insert audit entry: %w", err)
@@ -56,6 +60,18 @@ func (d *DB) ListAuditLog(ctx context.Context, limit, offset int, filter AuditFi
 		where = append(where, "user_id = ?")
 		args = append(args, filter.UserID)
 	}
+	if filter.NetworkIDs != nil {
+		placeholders := make([]string, 0, len(filter.NetworkIDs))
+		for _, id := range filter.NetworkIDs {
+			placeholders = append(placeholders, "?")
+			args = append(args, id)
+		}
+		if len(placeholders) == 0 {
+			where = append(where, "0")
+		} else {
+			where = append(where, "network_id IN ("+strings.Join(placeholders, ", ")+")")
+		}
+	}
 
 	whereClause := ""
 	if len(where) > 0 {
@@ -71,7 +87,7 @@ func (d *DB) ListAuditLog(ctx context.Context, limit, offset int, filter AuditFi
 
 	// Get page of results.
 	query := fmt.Sprintf(`
-		SELECT id, timestamp, user_id, action, resource, detail, ip_address
+		SELECT id, timestamp, user_id, action, resource, detail, ip_address, COALESCE(network_id, 0)
 		FROM audit_log %s
 		ORDER BY id DESC
 		LIMIT ? OFFSET ?`, whereClause)
@@ -87,7 +103,7 @@ func (d *DB) ListAuditLog(ctx context.Context, limit, offset int, filter AuditFi
 	for rows.Next() {
 		var e AuditEntry
 		var ts int64
-		if err := rows.Scan(&e.ID, &ts, &e.UserID, &e.Action, &e.Resource, &e.Detail, &e.IPAddress); err != nil {
+		if err := rows.Scan(&e.ID, &ts, &e.UserID, &e.Action, &e.Resource, &e.Detail, &e.IPAddress, &e.NetworkID); err != nil {
 			return nil, 0, fmt.Errorf("db: scan audit entry: %w", err)
 		}
 		e.Timestamp = time.Unix(ts, 0)
@@ -0,0 +1,48 @@
+package db
+
+import (
+	"context"
+	"testing"
+)
+
+func TestListAuditLog_NetworkFilter(t *testing.T) {
+	d := testDB(t)
+	ctx := context.Background()
+
+	for _, e := range []AuditEntry{
+		{Action: "network.updated", Resource: "network", NetworkID: 3},
+		{Action: "peer.created", Resource: "peer", NetworkID: 5},
+		{Action: "user.created", Resource: "user"},
+	} {
+		if err := d.InsertAuditEntry(ctx, &e); err != nil {
+			t.Fatalf("InsertAuditEntry: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name       string
+		networkIDs []int64
+		want       int
+	}{
+		{"no filter", nil, 3},
+		{"one network", []int64{3}, 1},
+		{"two networks", []int64{3, 5}, 2},
+		{"no networks", []int64{}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries, total, err := d.ListAuditLog(ctx, 50, 0, AuditFilter{NetworkIDs: tt.networkIDs})
+			if err != nil {
+				t.Fatalf("ListAuditLog: %v", err)
+			}
+			if total != tt.want || len(entries) != tt.want {
+				t.Errorf("expected %d entries, got %d (total %d)", tt.want, len(entries), total)
+			}
+		})
+	}
+
+	entries, _, _ := d.ListAuditLog(ctx, 50, 0, AuditFilter{NetworkIDs: []int64{5}})
+	if len(entries) == 1 && entries[0].NetworkID != 5 {
+		t.Errorf("expected network_id 5, got %d", entries[0].NetworkID)
+	}
+}
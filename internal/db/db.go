@@ -10,6 +10,7 @@ import (
 	"time"
 
 	"github.com/itsChris/wgpilot/internal/logging"
+	"github.com/itsChris/wgpilot/internal/tracing"
 	_ "modernc.org/sqlite"
 )
 
@@ -23,8 +24,14 @@ type DB struct {
 
 	encryptionKey    *[32]byte
 	encryptionKeySet bool
+
+	observeQuery QueryObserver
 }
 
+// QueryObserver is called with the operation (exec, query, query_row, or
+// the tx_ variants) and duration of every query.
+type QueryObserver func(op string, duration time.Duration)
+
 // New opens a SQLite database and configures WAL mode, foreign keys,
 // and busy timeout.
 func New(ctx context.Context, dsn string, logger *slog.Logger, devMode bool) (*DB, error) {
@@ -158,9 +165,29 @@ func (d *DB) BeginTx(ctx context.Context, opts *sql.TxOptions) (*Tx, error) {
 	return &Tx{tx: tx, db: d, start: start, ctx: ctx}, nil
 }
 
+// SetQueryObserver registers fn to receive the timing of every query, e.g.
+// for latency metrics. It must be called before the DB is shared between
+// goroutines.
+func (d *DB) SetQueryObserver(fn QueryObserver) {
+	d.observeQuery = fn
+}
+
 func (d *DB) logQuery(ctx context.Context, op, query string, args []any, duration time.Duration, err error) {
 	requestID := logging.RequestID(ctx)
 
+	if d.observeQuery != nil {
+		d.observeQuery(op, duration)
+	}
+
+	spanErr := err
+	if errors.Is(err, sql.ErrNoRows) {
+		spanErr = nil
+	}
+	tracing.Record(ctx, "db."+op, time.Now().Add(-duration), duration, spanErr,
+		tracing.String("db.system", "sqlite"),
+		tracing.String("db.statement", query),
+	)
+
 	if d.devMode {
 		d.logger.Debug("sql_"+op,
 			"request_id", requestID,
@@ -26,6 +26,19 @@ func testDB(t *testing.T) *DB {
 	return d
 }
 
+// testTimeSeries creates an in-memory time-series database with migrations applied.
+func testTimeSeries(t *testing.T) *TimeSeries {
+	t.Helper()
+
+	ts, err := NewTimeSeries(context.Background(), ":memory:", slog.Default(), true)
+	if err != nil {
+		t.Fatalf("failed to create test time series: %v", err)
+	}
+
+	t.Cleanup(func() { ts.Close() })
+	return ts
+}
+
 func TestMigration_AppliesCleanly(t *testing.T) {
 	_ = testDB(t)
 }
@@ -159,6 +172,27 @@ func TestDB_TransactionRollback(t *testing.T) {
 	}
 }
 
+func TestDB_QueryObserver(t *testing.T) {
+	d := testDB(t)
+	ctx := context.Background()
+
+	var ops []string
+	d.SetQueryObserver(func(op string, _ time.Duration) {
+		ops = append(ops, op)
+	})
+
+	if err := d.SetSetting(ctx, "observed", "yes"); err != nil {
+		t.Fatalf("SetSetting: %v", err)
+	}
+	if _, err := d.GetSetting(ctx, "observed"); err != nil {
+		t.Fatalf("GetSetting: %v", err)
+	}
+
+	if len(ops) != 2 || ops[0] != "exec" || ops[1] != "query_row" {
+		t.Errorf("expected exec then query_row, got %v", ops)
+	}
+}
+
 func TestDB_IntegrityCheck(t *testing.T) {
 	d := testDB(t)
 	ctx := context.Background()
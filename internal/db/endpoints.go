@@ -0,0 +1,139 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// PeerEndpoint represents a row in the peer_endpoints table: the time a
+// peer was first seen at a new remote address.
+type PeerEndpoint struct {
+	PeerID    int64
+	Timestamp time.Time
+	Endpoint  string
+}
+
+// EndpointRetention is how long endpoint changes are kept in the roaming
+// history.
+const EndpointRetention = 30 * 24 * time.Hour
+
+// recordEndpoint appends the snapshot's endpoint to the peer's roaming
+// history if it differs from the last one recorded. Snapshots without an
+// endpoint (peer never connected) are ignored.
+func recordEndpoint(ctx context.Context, tx *Tx, s *PeerSnapshot) error {
+	if s.Endpoint == "" {
+		return nil
+	}
+
+	var last string
+	err := tx.QueryRowContext(ctx, `
+		SELECT endpoint FROM peer_endpoints
+		WHERE peer_id = ?
+		ORDER BY timestamp DESC LIMIT 1`, s.PeerID,
+	).Scan(&last)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("db: last endpoint for peer %d: %w", s.PeerID, err)
+	}
+	if last == s.Endpoint {
+		return nil
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO peer_endpoints (peer_id, timestamp, endpoint)
+		VALUES (?, ?, ?)
+		ON CONFLICT(peer_id, timestamp) DO UPDATE SET endpoint = excluded.endpoint`,
+		s.PeerID, s.Timestamp.Unix(), s.Endpoint,
+	); err != nil {
+		return fmt.Errorf("db: record endpoint for peer %d: %w", s.PeerID, err)
+	}
+	return nil
+}
+
+// PruneEndpoints deletes endpoint changes older than the given cutoff time.
+// Each peer's latest endpoint is kept however old, so that a peer still at
+// it is not recorded as having moved there again. Returns the number of rows
+// deleted.
+func (ts *TimeSeries) PruneEndpoints(ctx context.Context, before time.Time) (int64, error) {
+	result, err := ts.db.ExecContext(ctx, `
+		DELETE FROM peer_endpoints
+		WHERE timestamp < ?
+		  AND timestamp < (SELECT MAX(e.timestamp) FROM peer_endpoints e WHERE e.peer_id = peer_endpoints.peer_id)`,
+		before.Unix(),
+	)
+	if err != nil {
+		return 0, fmt.Errorf("db: prune endpoints: %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("db: prune endpoints rows affected: %w", err)
+	}
+	return n, nil
+}
+
+// ListPeerEndpoints returns up to limit of a peer's most recent endpoint
+// changes, newest first.
+func (ts *TimeSeries) ListPeerEndpoints(ctx context.Context, peerID int64, limit int) ([]PeerEndpoint, error) {
+	rows, err := ts.db.QueryContext(ctx, `
+		SELECT peer_id, timestamp, endpoint
+		FROM peer_endpoints
+		WHERE peer_id = ?
+		ORDER BY timestamp DESC LIMIT ?`,
+		peerID, limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("db: list endpoints for peer %d: %w", peerID, err)
+	}
+	defer rows.Close()
+	return scanPeerEndpoints(rows)
+}
+
+// ListPeerEndpointsSince returns a peer's endpoint changes at or after
+// since, oldest first.
+func (ts *TimeSeries) ListPeerEndpointsSince(ctx context.Context, peerID int64, since time.Time) ([]PeerEndpoint, error) {
+	rows, err := ts.db.QueryContext(ctx, `
+		SELECT peer_id, timestamp, endpoint
+		FROM peer_endpoints
+		WHERE peer_id = ? AND timestamp >= ?
+		ORDER BY timestamp`,
+		peerID, since.Unix(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("db: list endpoints for peer %d: %w", peerID, err)
+	}
+	defer rows.Close()
+	return scanPeerEndpoints(rows)
+}
+
+// ListEndpointChangesSince returns endpoint changes of all peers at or after
+// since, oldest first.
+func (ts *TimeSeries) ListEndpointChangesSince(ctx context.Context, since time.Time) ([]PeerEndpoint, error) {
+	rows, err := ts.db.QueryContext(ctx, `
+		SELECT peer_id, timestamp, endpoint
+		FROM peer_endpoints
+		WHERE timestamp >= ?
+		ORDER BY timestamp, peer_id`,
+		since.Unix(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("db: list endpoint changes: %w", err)
+	}
+	defer rows.Close()
+	return scanPeerEndpoints(rows)
+}
+
+func scanPeerEndpoints(rows *sql.Rows) ([]PeerEndpoint, error) {
+	var endpoints []PeerEndpoint
+	for rows.Next() {
+		var e PeerEndpoint
+		var unix int64
+		if err := rows.Scan(&e.PeerID, &unix, &e.Endpoint); err != nil {
+			return nil, fmt.Errorf("db: scan endpoint: %w", err)
+		}
+		e.Timestamp = time.Unix(unix, 0)
+		endpoints = append(endpoints, e)
+	}
+	return endpoints, rows.Err()
+}
@@ -0,0 +1,157 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestEndpoints_RecordedOnChange(t *testing.T) {
+	ts := testTimeSeries(t)
+	ctx := context.Background()
+	peerID := int64(1)
+
+	base := time.Date(2025, 3, 1, 9, 0, 0, 0, time.UTC)
+	endpoints := []string{
+		"",                   // never connected
+		"198.51.100.7:40000", // first seen
+		"198.51.100.7:40000", // unchanged
+		"",                   // offline snapshot without endpoint
+		"203.0.113.1:51820",  // roamed
+		"198.51.100.7:40000", // roamed back
+	}
+	for i, ep := range endpoints {
+		s := testSnapshot(peerID, base.Add(time.Duration(i)*time.Minute))
+		s.Endpoint = ep
+		if err := ts.InsertSnapshot(ctx, s); err != nil {
+			t.Fatalf("insert snapshot: %v", err)
+		}
+	}
+
+	history, err := ts.ListPeerEndpoints(ctx, peerID, 10)
+	if err != nil {
+		t.Fatalf("list endpoints: %v", err)
+	}
+	want := []struct {
+		offset   time.Duration
+		endpoint string
+	}{
+		{5 * time.Minute, "198.51.100.7:40000"},
+		{4 * time.Minute, "203.0.113.1:51820"},
+		{time.Minute, "198.51.100.7:40000"},
+	}
+	if len(history) != len(want) {
+		t.Fatalf("expected %d changes, got %d: %+v", len(want), len(history), history)
+	}
+	for i, w := range want {
+		if history[i].Endpoint != w.endpoint || !history[i].Timestamp.Equal(base.Add(w.offset)) {
+			t.Errorf("change %d: expected %s at +%s, got %+v", i, w.endpoint, w.offset, history[i])
+		}
+	}
+
+	limited, err := ts.ListPeerEndpoints(ctx, peerID, 1)
+	if err != nil {
+		t.Fatalf("list endpoints: %v", err)
+	}
+	if len(limited) != 1 || limited[0].Endpoint != "198.51.100.7:40000" {
+		t.Errorf("expected only the latest change, got %+v", limited)
+	}
+
+	since, err := ts.ListPeerEndpointsSince(ctx, peerID, base.Add(4*time.Minute))
+	if err != nil {
+		t.Fatalf("list endpoints since: %v", err)
+	}
+	if len(since) != 2 || since[0].Endpoint != "203.0.113.1:51820" {
+		t.Errorf("expected 2 changes oldest first, got %+v", since)
+	}
+}
+
+func TestEndpoints_ListChangesSince(t *testing.T) {
+	ts := testTimeSeries(t)
+	ctx := context.Background()
+
+	base := time.Date(2025, 3, 1, 9, 0, 0, 0, time.UTC)
+	for _, pt := range []struct {
+		peerID   int64
+		offset   time.Duration
+		endpoint string
+	}{
+		{1, 0, "198.51.100.7:40000"},
+		{2, time.Minute, "203.0.113.1:51820"},
+		{1, 2 * time.Minute, "192.0.2.5:1234"},
+	} {
+		s := testSnapshot(pt.peerID, base.Add(pt.offset))
+		s.Endpoint = pt.endpoint
+		if err := ts.InsertSnapshot(ctx, s); err != nil {
+			t.Fatalf("insert snapshot: %v", err)
+		}
+	}
+
+	changes, err := ts.ListEndpointChangesSince(ctx, base.Add(time.Minute))
+	if err != nil {
+		t.Fatalf("list changes: %v", err)
+	}
+	if len(changes) != 2 {
+		t.Fatalf("expected 2 changes, got %d: %+v", len(changes), changes)
+	}
+	if changes[0].PeerID != 2 || changes[1].PeerID != 1 {
+		t.Errorf("expected changes oldest first, got %+v", changes)
+	}
+
+	if err := ts.DeletePeer(ctx, 1); err != nil {
+		t.Fatalf("delete peer: %v", err)
+	}
+	history, err := ts.ListPeerEndpoints(ctx, 1, 10)
+	if err != nil {
+		t.Fatalf("list endpoints: %v", err)
+	}
+	if len(history) != 0 {
+		t.Errorf("expected history deleted with peer, got %+v", history)
+	}
+}
+
+func TestEndpoints_Prune(t *testing.T) {
+	ts := testTimeSeries(t)
+	ctx := context.Background()
+
+	base := time.Date(2025, 3, 1, 9, 0, 0, 0, time.UTC)
+	for _, pt := range []struct {
+		peerID   int64
+		offset   time.Duration
+		endpoint string
+	}{
+		{1, 0, "198.51.100.7:40000"},
+		{1, time.Hour, "192.0.2.5:1234"},
+		{1, 48 * time.Hour, "203.0.113.1:51820"},
+		{2, 0, "198.51.100.9:40000"}, // never moved since
+	} {
+		s := testSnapshot(pt.peerID, base.Add(pt.offset))
+		s.Endpoint = pt.endpoint
+		if err := ts.InsertSnapshot(ctx, s); err != nil {
+			t.Fatalf("insert snapshot: %v", err)
+		}
+	}
+
+	n, err := ts.PruneEndpoints(ctx, base.Add(24*time.Hour))
+	if err != nil {
+		t.Fatalf("prune endpoints: %v", err)
+	}
+	if n != 2 {
+		t.Errorf("expected 2 endpoints pruned, got %d", n)
+	}
+	history, err := ts.ListPeerEndpoints(ctx, 1, 10)
+	if err != nil {
+		t.Fatalf("list endpoints: %v", err)
+	}
+	if len(history) != 1 || history[0].Endpoint != "203.0.113.1:51820" {
+		t.Errorf("expected only the recent endpoint of peer 1, got %+v", history)
+	}
+	// A peer's latest endpoint is kept however old.
+	history, err = ts.ListPeerEndpoints(ctx, 2, 10)
+	if err != nil {
+		t.Fatalf("list endpoints: %v", err)
+	}
+	if len(history) != 1 {
+		t.Errorf("expected peer 2's endpoint kept, got %+v", history)
+	}
+}
@@ -0,0 +1,196 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Invitation represents a row in the peer_invitations table: a link that
+// lets its recipient enroll a new peer in a network.
+type Invitation struct {
+	ID          int64
+	NetworkID   int64
+	TokenHash   string
+	TokenPrefix string
+	Name        string // prefilled peer name, empty to let the recipient choose
+	Email       string
+	SingleUse   bool
+	ExpiresAt   *time.Time
+	CreatedBy   int64
+	UseCount    int
+	LastUsedAt  *time.Time
+	LastUsedIP  string
+	PeerID      int64 // last peer enrolled with it, 0 if none
+	RevokedAt   *time.Time
+	CreatedAt   time.Time
+}
+
+// Usable reports whether the invitation can still be redeemed at now.
+func (inv *Invitation) Usable(now time.Time) bool {
+	if inv.RevokedAt != nil || (inv.SingleUse && inv.UseCount > 0) {
+		return false
+	}
+	return inv.ExpiresAt == nil || now.Before(*inv.ExpiresAt)
+}
+
+const invitationColumns = `id, network_id, token_hash, token_prefix, name, email, single_use, expires_at,
+		COALESCE(created_by, 0), use_count, last_used_at, last_used_ip, COALESCE(peer_id, 0), revoked_at, created_at`
+
+// CreateInvitation inserts a new invitation and returns its ID.
+func (d *DB) CreateInvitation(ctx context.Context, inv *Invitation) (int64, error) {
+	var expiresAt *int64
+	if inv.ExpiresAt != nil {
+		ts := inv.ExpiresAt.Unix()
+		expiresAt = &ts
+	}
+	result, err := d.ExecContext(ctx, `
+		INSERT INTO peer_invitations (network_id, token_hash, token_prefix, name, email, single_use, expires_at, created_by)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		inv.NetworkID, inv.TokenHash, inv.TokenPrefix, inv.Name, inv.Email, inv.SingleUse, expiresAt, nullID(inv.CreatedBy),
+	)
+	if err != nil {
+		return 0, fmt.Errorf("db: create invitation: %w", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("db: create invitation last insert id: %w", err)
+	}
+	return id, nil
+}
+
+// GetInvitationByID retrieves an invitation by ID.
+// Returns nil, nil if not found.
+func (d *DB) GetInvitationByID(ctx context.Context, id int64) (*Invitation, error) {
+	inv, err := scanInvitation(d.QueryRowContext(ctx,
+		"SELECT "+invitationColumns+" FROM peer_invitations WHERE id = ?", id,
+	))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("db: get invitation %d: %w", id, err)
+	}
+	return inv, nil
+}
+
+// GetInvitationByHash retrieves an invitation by its token hash.
+// Returns nil, nil if not found.
+func (d *DB) GetInvitationByHash(ctx context.Context, hash string) (*Invitation, error) {
+	inv, err := scanInvitation(d.QueryRowContext(ctx,
+		"SELECT "+invitationColumns+" FROM peer_invitations WHERE token_hash = ?", hash,
+	))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("db: get invitation by hash: %w", err)
+	}
+	return inv, nil
+}
+
+// ListInvitations returns a network's invitations, newest first.
+func (d *DB) ListInvitations(ctx context.Context, networkID int64) ([]Invitation, error) {
+	rows, err := d.QueryContext(ctx,
+		"SELECT "+invitationColumns+" FROM peer_invitations WHERE network_id = ? ORDER BY id DESC", networkID)
+	if err != nil {
+		return nil, fmt.Errorf("db: list invitations for network %d: %w", networkID, err)
+	}
+	defer rows.Close()
+
+	var invitations []Invitation
+	for rows.Next() {
+		inv, err := scanInvitation(rows)
+		if err != nil {
+			return nil, fmt.Errorf("db: scan invitation: %w", err)
+		}
+		invitations = append(invitations, *inv)
+	}
+	return invitations, rows.Err()
+}
+
+// RevokeInvitation stops an invitation from being redeemed. It reports
+// whether the invitation was still unrevoked.
+func (d *DB) RevokeInvitation(ctx context.Context, id int64) (bool, error) {
+	result, err := d.ExecContext(ctx,
+		"UPDATE peer_invitations SET revoked_at = unixepoch() WHERE id = ? AND revoked_at IS NULL", id)
+	if err != nil {
+		return false, fmt.Errorf("db: revoke invitation %d: %w", id, err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("db: revoke invitation %d rows affected: %w", id, err)
+	}
+	return n > 0, nil
+}
+
+// ClaimInvitation counts a use of an invitation from ip, unless it has been
+// revoked, has expired or is single-use and already used. It reports
+// whether the claim succeeded, so that concurrent redemptions of a
+// single-use invitation cannot both succeed.
+func (d *DB) ClaimInvitation(ctx context.Context, id int64, ip string) (bool, error) {
+	result, err := d.ExecContext(ctx, `
+		UPDATE peer_invitations
+		SET use_count = use_count + 1, last_used_at = unixepoch(), last_used_ip = ?
+		WHERE id = ? AND revoked_at IS NULL
+		  AND (expires_at IS NULL OR expires_at > unixepoch())
+		  AND (single_use = 0 OR use_count = 0)`,
+		ip, id,
+	)
+	if err != nil {
+		return false, fmt.Errorf("db: claim invitation %d: %w", id, err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("db: claim invitation %d rows affected: %w", id, err)
+	}
+	return n > 0, nil
+}
+
+// ReleaseInvitation gives back a use claimed by ClaimInvitation when the
+// enrollment failed.
+func (d *DB) ReleaseInvitation(ctx context.Context, id int64) error {
+	_, err := d.ExecContext(ctx,
+		"UPDATE peer_invitations SET use_count = use_count - 1 WHERE id = ? AND use_count > 0", id)
+	if err != nil {
+		return fmt.Errorf("db: release invitation %d: %w", id, err)
+	}
+	return nil
+}
+
+// SetInvitationPeer records the peer enrolled with an invitation.
+func (d *DB) SetInvitationPeer(ctx context.Context, id, peerID int64) error {
+	_, err := d.ExecContext(ctx,
+		"UPDATE peer_invitations SET peer_id = ? WHERE id = ?", peerID, id)
+	if err != nil {
+		return fmt.Errorf("db: set invitation %d peer: %w", id, err)
+	}
+	return nil
+}
+
+func scanInvitation(row interface{ Scan(...any) error }) (*Invitation, error) {
+	inv := &Invitation{}
+	var createdAt int64
+	var expiresAt, lastUsedAt, revokedAt sql.NullInt64
+	if err := row.Scan(&inv.ID, &inv.NetworkID, &inv.TokenHash, &inv.TokenPrefix, &inv.Name, &inv.Email,
+		&inv.SingleUse, &expiresAt, &inv.CreatedBy, &inv.UseCount, &lastUsedAt, &inv.LastUsedIP,
+		&inv.PeerID, &revokedAt, &createdAt); err != nil {
+		return nil, err
+	}
+	inv.CreatedAt = time.Unix(createdAt, 0)
+	if expiresAt.Valid {
+		t := time.Unix(expiresAt.Int64, 0)
+		inv.ExpiresAt = &t
+	}
+	if lastUsedAt.Valid {
+		t := time.Unix(lastUsedAt.Int64, 0)
+		inv.LastUsedAt = &t
+	}
+	if revokedAt.Valid {
+		t := time.Unix(revokedAt.Int64, 0)
+		inv.RevokedAt = &t
+	}
+	return inv, nil
+}
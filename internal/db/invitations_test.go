@@ -0,0 +1,80 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestInvitations_ClaimSingleUse(t *testing.T) {
+	d := testDB(t)
+	ctx := context.Background()
+
+	netID, err := d.CreateNetwork(ctx, testNetwork())
+	if err != nil {
+		t.Fatalf("create network: %v", err)
+	}
+	id, err := d.CreateInvitation(ctx, &Invitation{
+		NetworkID: netID, TokenHash: "hash", TokenPrefix: "wgi_abcd...", Name: "Laptop", SingleUse: true,
+	})
+	if err != nil {
+		t.Fatalf("CreateInvitation: %v", err)
+	}
+
+	if ok, err := d.ClaimInvitation(ctx, id, "192.0.2.1"); err != nil || !ok {
+		t.Fatalf("first claim = %v, %v; want true", ok, err)
+	}
+	if ok, err := d.ClaimInvitation(ctx, id, "192.0.2.2"); err != nil || ok {
+		t.Errorf("second claim = %v, %v; want false", ok, err)
+	}
+
+	// A failed enrollment gives the use back.
+	if err := d.ReleaseInvitation(ctx, id); err != nil {
+		t.Fatalf("ReleaseInvitation: %v", err)
+	}
+	inv, err := d.GetInvitationByHash(ctx, "hash")
+	if err != nil || inv == nil {
+		t.Fatalf("GetInvitationByHash: %v", err)
+	}
+	if !inv.Usable(time.Now()) || inv.LastUsedIP != "192.0.2.1" {
+		t.Errorf("expected a usable invitation last used from 192.0.2.1, got %+v", inv)
+	}
+
+	if ok, err := d.RevokeInvitation(ctx, id); err != nil || !ok {
+		t.Fatalf("RevokeInvitation = %v, %v; want true", ok, err)
+	}
+	if ok, _ := d.RevokeInvitation(ctx, id); ok {
+		t.Error("expected revoking twice to report false")
+	}
+	if ok, err := d.ClaimInvitation(ctx, id, "192.0.2.1"); err != nil || ok {
+		t.Errorf("claim after revoke = %v, %v; want false", ok, err)
+	}
+}
+
+func TestInvitations_ClaimExpired(t *testing.T) {
+	d := testDB(t)
+	ctx := context.Background()
+
+	netID, err := d.CreateNetwork(ctx, testNetwork())
+	if err != nil {
+		t.Fatalf("create network: %v", err)
+	}
+	past := time.Now().Add(-time.Hour)
+	id, err := d.CreateInvitation(ctx, &Invitation{
+		NetworkID: netID, TokenHash: "hash", TokenPrefix: "wgi_abcd...", ExpiresAt: &past,
+	})
+	if err != nil {
+		t.Fatalf("CreateInvitation: %v", err)
+	}
+	if ok, err := d.ClaimInvitation(ctx, id, "192.0.2.1"); err != nil || ok {
+		t.Errorf("claim of expired invitation = %v, %v; want false", ok, err)
+	}
+
+	invitations, err := d.ListInvitations(ctx, netID)
+	if err != nil {
+		t.Fatalf("ListInvitations: %v", err)
+	}
+	if len(invitations) != 1 || invitations[0].Usable(time.Now()) || invitations[0].UseCount != 0 {
+		t.Errorf("expected one unused, expired invitation, got %+v", invitations)
+	}
+}
@@ -17,6 +17,12 @@ var migrationsFS embed.FS
 // Migrate runs all embedded SQL migration files against the database.
 // Migrations are tracked in a _migrations table and only applied once.
 func Migrate(ctx context.Context, d *DB, logger *slog.Logger) error {
+	return migrate(ctx, d, migrationsFS, "migrations", logger)
+}
+
+// migrate applies the .sql files in dir of fsys that have not been applied
+// to d yet, in filename order.
+func migrate(ctx context.Context, d *DB, fsys embed.FS, dir string, logger *slog.Logger) error {
 	// Create migrations tracking table.
 	_, err := d.conn.ExecContext(ctx, `
 		CREATE TABLE IF NOT EXISTS _migrations (
@@ -29,7 +35,7 @@ func Migrate(ctx context.Context, d *DB, logger *slog.Logger) error {
 	}
 
 	// Read all migration files.
-	entries, err := migrationsFS.ReadDir("migrations")
+	entries, err := fsys.ReadDir(dir)
 	if err != nil {
 		return fmt.Errorf("db: read migrations dir: %w", err)
 	}
@@ -63,7 +69,7 @@ func Migrate(ctx context.Context, d *DB, logger *slog.Logger) error {
 		}
 
 		// Read and execute the migration.
-		content, err := migrationsFS.ReadFile("migrations/" + entry.Name())
+		content, err := fsys.ReadFile(dir + "/" + entry.Name())
 		if err != nil {
 			return fmt.Errorf("db: read migration %s: %w", entry.Name(), err)
 		}
@@ -0,0 +1,20 @@
+-- +goose Up
+
+ALTER TABLE peers ADD COLUMN quota_bytes INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE peers ADD COLUMN quota_reset_day INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE peers ADD COLUMN quota_action TEXT NOT NULL DEFAULT 'disable';
+
+CREATE TABLE peer_quota_state (
+    peer_id         INTEGER PRIMARY KEY REFERENCES peers(id) ON DELETE CASCADE,
+    cycle_start     INTEGER NOT NULL,
+    warned_percent  INTEGER NOT NULL DEFAULT 0,
+    enforced_action TEXT NOT NULL DEFAULT '',
+    updated_at      INTEGER NOT NULL DEFAULT (unixepoch())
+);
+
+-- +goose Down
+
+DROP TABLE IF EXISTS peer_quota_state;
+
+-- SQLite doesn't support DROP COLUMN before 3.35.0, so the peer quota
+-- columns are left in place.
@@ -0,0 +1,72 @@
+-- +goose Up
+
+-- Bytes transferred since the previous snapshot, with kernel counter
+-- resets already accounted for.
+ALTER TABLE peer_snapshots ADD COLUMN rx_delta INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE peer_snapshots ADD COLUMN tx_delta INTEGER NOT NULL DEFAULT 0;
+
+-- Backfill existing rows from the previous snapshot of the same peer. A
+-- peer's oldest row has no baseline and keeps 0, so counters that ran up
+-- before the snapshot history started are not booked as traffic.
+UPDATE peer_snapshots SET
+    rx_delta = d.rx_delta,
+    tx_delta = d.tx_delta
+FROM (
+    SELECT peer_id, timestamp,
+        CASE WHEN prev_rx IS NULL THEN 0
+             WHEN rx_bytes >= prev_rx THEN rx_bytes - prev_rx
+             ELSE rx_bytes END AS rx_delta,
+        CASE WHEN prev_tx IS NULL THEN 0
+             WHEN tx_bytes >= prev_tx THEN tx_bytes - prev_tx
+             ELSE tx_bytes END AS tx_delta
+    FROM (
+        SELECT peer_id, timestamp, rx_bytes, tx_bytes,
+            LAG(rx_bytes) OVER w AS prev_rx,
+            LAG(tx_bytes) OVER w AS prev_tx
+        FROM peer_snapshots
+        WINDOW w AS (PARTITION BY peer_id ORDER BY timestamp)
+    )
+) AS d
+WHERE peer_snapshots.peer_id = d.peer_id AND peer_snapshots.timestamp = d.timestamp;
+
+CREATE TABLE peer_traffic (
+    peer_id     INTEGER PRIMARY KEY REFERENCES peers(id) ON DELETE CASCADE,
+    last_rx     INTEGER NOT NULL DEFAULT 0,  -- raw kernel counter at the last poll
+    last_tx     INTEGER NOT NULL DEFAULT 0,
+    lifetime_rx INTEGER NOT NULL DEFAULT 0,  -- monotonic, survives interface recreation
+    lifetime_tx INTEGER NOT NULL DEFAULT 0,
+    updated_at  INTEGER NOT NULL DEFAULT (unixepoch())
+);
+
+CREATE TABLE peer_traffic_daily (
+    peer_id  INTEGER NOT NULL REFERENCES peers(id) ON DELETE CASCADE,
+    day      INTEGER NOT NULL,  -- unix epoch of 00:00 UTC
+    rx_bytes INTEGER NOT NULL DEFAULT 0,
+    tx_bytes INTEGER NOT NULL DEFAULT 0,
+
+    PRIMARY KEY (peer_id, day)
+);
+
+-- Seed the totals from the backfilled history. last_rx/last_tx are the
+-- newest snapshot's counters, the baseline for the first poll after the
+-- upgrade.
+INSERT INTO peer_traffic (peer_id, last_rx, last_tx, lifetime_rx, lifetime_tx, updated_at)
+SELECT s.peer_id, s.rx_bytes, s.tx_bytes, t.rx, t.tx, s.timestamp
+FROM peer_snapshots s
+JOIN (
+    SELECT peer_id, MAX(timestamp) AS timestamp, SUM(rx_delta) AS rx, SUM(tx_delta) AS tx
+    FROM peer_snapshots GROUP BY peer_id
+) t ON t.peer_id = s.peer_id AND t.timestamp = s.timestamp;
+
+INSERT INTO peer_traffic_daily (peer_id, day, rx_bytes, tx_bytes)
+SELECT peer_id, timestamp - timestamp % 86400, SUM(rx_delta), SUM(tx_delta)
+FROM peer_snapshots
+WHERE rx_delta != 0 OR tx_delta != 0
+GROUP BY peer_id, timestamp - timestamp % 86400;
+
+-- +goose Down
+
+DROP TABLE IF EXISTS peer_traffic_daily;
+DROP TABLE IF EXISTS peer_traffic;
+ALTER TABLE peer_snapshots DROP COLUMN tx_delta;
+ALTER TABLE peer_snapshots DROP COLUMN rx_delta;
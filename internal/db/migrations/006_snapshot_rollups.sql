@@ -0,0 +1,49 @@
+-- +goose Up
+
+-- Downsampled peer snapshots. Each row covers one bucket starting at
+-- timestamp; rx_delta/tx_delta are the bytes transferred during the bucket
+-- and online is set if the peer was online at any point in it.
+
+CREATE TABLE peer_snapshots_5m (
+    peer_id   INTEGER NOT NULL REFERENCES peers(id) ON DELETE CASCADE,
+    timestamp INTEGER NOT NULL,  -- unix epoch of the bucket start
+    rx_delta  INTEGER NOT NULL DEFAULT 0,
+    tx_delta  INTEGER NOT NULL DEFAULT 0,
+    online    BOOLEAN NOT NULL DEFAULT 0,
+
+    PRIMARY KEY (peer_id, timestamp)
+);
+
+CREATE TABLE peer_snapshots_1h (
+    peer_id   INTEGER NOT NULL REFERENCES peers(id) ON DELETE CASCADE,
+    timestamp INTEGER NOT NULL,
+    rx_delta  INTEGER NOT NULL DEFAULT 0,
+    tx_delta  INTEGER NOT NULL DEFAULT 0,
+    online    BOOLEAN NOT NULL DEFAULT 0,
+
+    PRIMARY KEY (peer_id, timestamp)
+);
+
+CREATE TABLE peer_snapshots_1d (
+    peer_id   INTEGER NOT NULL REFERENCES peers(id) ON DELETE CASCADE,
+    timestamp INTEGER NOT NULL,
+    rx_delta  INTEGER NOT NULL DEFAULT 0,
+    tx_delta  INTEGER NOT NULL DEFAULT 0,
+    online    BOOLEAN NOT NULL DEFAULT 0,
+
+    PRIMARY KEY (peer_id, timestamp)
+);
+
+-- Rollups and compaction scan by time across all peers.
+CREATE INDEX idx_snapshots_timestamp ON peer_snapshots(timestamp);
+CREATE INDEX idx_snapshots_5m_timestamp ON peer_snapshots_5m(timestamp);
+CREATE INDEX idx_snapshots_1h_timestamp ON peer_snapshots_1h(timestamp);
+
+-- +goose Down
+
+DROP INDEX IF EXISTS idx_snapshots_1h_timestamp;
+DROP INDEX IF EXISTS idx_snapshots_5m_timestamp;
+DROP INDEX IF EXISTS idx_snapshots_timestamp;
+DROP TABLE IF EXISTS peer_snapshots_1d;
+DROP TABLE IF EXISTS peer_snapshots_1h;
+DROP TABLE IF EXISTS peer_snapshots_5m;
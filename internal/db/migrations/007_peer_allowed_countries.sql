@@ -0,0 +1,10 @@
+-- +goose Up
+
+-- Comma-separated ISO 3166-1 alpha-2 country codes a peer is expected to
+-- connect from. Empty disables the GeoIP country check.
+ALTER TABLE peers ADD COLUMN allowed_countries TEXT NOT NULL DEFAULT '';
+
+-- +goose Down
+
+-- SQLite doesn't support DROP COLUMN before 3.35.0, so the column is left
+-- in place.
@@ -0,0 +1,38 @@
+-- +goose Up
+
+-- Outbound resource-change webhooks. events is a comma-separated list of
+-- event types or "<resource>.*" patterns; empty subscribes to everything.
+CREATE TABLE webhooks (
+    id         INTEGER PRIMARY KEY AUTOINCREMENT,
+    url        TEXT    NOT NULL,
+    secret     TEXT    NOT NULL,  -- HMAC signing key, encrypted at rest
+    events     TEXT    NOT NULL DEFAULT '',
+    enabled    BOOLEAN NOT NULL DEFAULT 1,
+    created_at INTEGER NOT NULL DEFAULT (unixepoch()),
+    updated_at INTEGER NOT NULL DEFAULT (unixepoch())
+);
+
+-- Delivery queue. One row per webhook and event; retried with backoff
+-- until delivered or out of attempts.
+CREATE TABLE webhook_deliveries (
+    id              INTEGER PRIMARY KEY AUTOINCREMENT,
+    webhook_id      INTEGER NOT NULL REFERENCES webhooks(id) ON DELETE CASCADE,
+    event_id        TEXT    NOT NULL,  -- shared by all deliveries of one change
+    event_type      TEXT    NOT NULL,
+    payload         TEXT    NOT NULL,
+    status          TEXT    NOT NULL DEFAULT 'pending',  -- 'pending' | 'delivered' | 'failed'
+    attempts        INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at INTEGER NOT NULL DEFAULT (unixepoch()),
+    last_status     INTEGER NOT NULL DEFAULT 0,  -- HTTP status of the last attempt, 0 if none
+    last_error      TEXT    NOT NULL DEFAULT '',
+    created_at      INTEGER NOT NULL DEFAULT (unixepoch()),
+    delivered_at    INTEGER
+);
+
+CREATE INDEX idx_webhook_deliveries_due ON webhook_deliveries(status, next_attempt_at);
+CREATE INDEX idx_webhook_deliveries_webhook ON webhook_deliveries(webhook_id, id);
+
+-- +goose Down
+
+DROP TABLE IF EXISTS webhook_deliveries;
+DROP TABLE IF EXISTS webhooks;
@@ -0,0 +1,24 @@
+-- +goose Up
+
+-- TOTP second factor. totp_secret is set when enrollment starts and
+-- encrypted at rest; totp_enabled is only set once the user has confirmed
+-- a code. totp_last_step is the time step of the last accepted code, so a
+-- code cannot be replayed.
+ALTER TABLE users ADD COLUMN totp_secret TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN totp_enabled BOOLEAN NOT NULL DEFAULT 0;
+ALTER TABLE users ADD COLUMN totp_last_step INTEGER NOT NULL DEFAULT 0;
+
+-- One-time recovery codes, stored as SHA-256 hashes.
+CREATE TABLE user_recovery_codes (
+    id        INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id   INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    code_hash TEXT    NOT NULL,
+    used_at   INTEGER
+);
+
+CREATE INDEX idx_user_recovery_codes_user ON user_recovery_codes(user_id);
+
+-- +goose Down
+
+DROP TABLE IF EXISTS user_recovery_codes;
+-- SQLite doesn't support DROP COLUMN before 3.35.0, so the users columns stay.
@@ -0,0 +1,22 @@
+-- +goose Up
+
+-- WebAuthn credentials (security keys and passkeys). public_key is the
+-- COSE_Key from registration; sign_count is the authenticator's signature
+-- counter, used to detect cloned credentials.
+CREATE TABLE webauthn_credentials (
+    id            INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id       INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    credential_id BLOB    NOT NULL UNIQUE,
+    public_key    BLOB    NOT NULL,
+    sign_count    INTEGER NOT NULL DEFAULT 0,
+    aaguid        BLOB,
+    name          TEXT    NOT NULL DEFAULT '',
+    created_at    INTEGER NOT NULL DEFAULT (unixepoch()),
+    last_used     INTEGER
+);
+
+CREATE INDEX idx_webauthn_credentials_user ON webauthn_credentials(user_id);
+
+-- +goose Down
+
+DROP TABLE IF EXISTS webauthn_credentials;
@@ -0,0 +1,14 @@
+-- +goose Up
+
+-- Users provisioned by an external identity provider. auth_source is
+-- 'local' for password users; external_id is the provider's stable ID for
+-- the user, so a rename at the provider does not create a second account.
+ALTER TABLE users ADD COLUMN auth_source TEXT NOT NULL DEFAULT 'local';
+ALTER TABLE users ADD COLUMN external_id TEXT NOT NULL DEFAULT '';
+
+CREATE UNIQUE INDEX idx_users_external ON users(auth_source, external_id) WHERE external_id != '';
+
+-- +goose Down
+
+DROP INDEX IF EXISTS idx_users_external;
+-- SQLite doesn't support DROP COLUMN before 3.35.0, so the users columns stay.
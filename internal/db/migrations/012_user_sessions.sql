@@ -0,0 +1,22 @@
+-- +goose Up
+
+-- Login sessions. id is the JWT ID (jti) of the session token; a token is
+-- only accepted while its row exists, so deleting the row revokes it.
+-- There is no foreign key on user_id: DeleteUser removes a user's sessions
+-- itself, and a row for a missing user is never matched by a valid token.
+CREATE TABLE user_sessions (
+    id           TEXT    PRIMARY KEY,
+    user_id      INTEGER NOT NULL,
+    created_at   INTEGER NOT NULL DEFAULT (unixepoch()),
+    last_seen_at INTEGER NOT NULL DEFAULT (unixepoch()),
+    expires_at   INTEGER NOT NULL,
+    ip           TEXT    NOT NULL DEFAULT '',
+    user_agent   TEXT    NOT NULL DEFAULT ''
+);
+
+CREATE INDEX idx_user_sessions_user ON user_sessions(user_id);
+CREATE INDEX idx_user_sessions_expires ON user_sessions(expires_at);
+
+-- +goose Down
+
+DROP TABLE IF EXISTS user_sessions;
@@ -0,0 +1,16 @@
+-- +goose Up
+
+-- Custom roles. permissions is a comma-separated list of permissions such
+-- as "peer:read", resource wildcards ("peer:*") or "*". The built-in admin
+-- and viewer roles are defined in code and not stored here.
+CREATE TABLE roles (
+    name        TEXT    PRIMARY KEY,
+    description TEXT    NOT NULL DEFAULT '',
+    permissions TEXT    NOT NULL DEFAULT '',
+    created_at  INTEGER NOT NULL DEFAULT (unixepoch()),
+    updated_at  INTEGER NOT NULL DEFAULT (unixepoch())
+);
+
+-- +goose Down
+
+DROP TABLE IF EXISTS roles;
@@ -0,0 +1,28 @@
+-- +goose Up
+
+-- Network-scoped role assignments: the user holds role's network, peer,
+-- bridge and audit permissions on network_id only, in addition to their
+-- global role.
+CREATE TABLE network_roles (
+    user_id    INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    network_id INTEGER NOT NULL REFERENCES networks(id) ON DELETE CASCADE,
+    role       TEXT    NOT NULL,
+    created_at INTEGER NOT NULL DEFAULT (unixepoch()),
+    PRIMARY KEY (user_id, network_id)
+);
+
+CREATE INDEX idx_network_roles_network ON network_roles(network_id);
+
+-- The network an audit entry is about, so that network-scoped users only
+-- see entries for their networks. NULL for entries not tied to a network.
+ALTER TABLE audit_log ADD COLUMN network_id INTEGER;
+
+CREATE INDEX idx_audit_network ON audit_log(network_id);
+
+-- +goose Down
+
+DROP INDEX IF EXISTS idx_audit_network;
+DROP TABLE IF EXISTS network_roles;
+
+-- SQLite doesn't support DROP COLUMN before 3.35.0, so audit_log.network_id
+-- is left in place.
@@ -0,0 +1,17 @@
+-- +goose Up
+
+-- Restrictions on what an API key may do and where it may be used from,
+-- all comma-separated and empty for "no restriction".
+ALTER TABLE api_keys ADD COLUMN scopes TEXT NOT NULL DEFAULT '';
+ALTER TABLE api_keys ADD COLUMN network_ids TEXT NOT NULL DEFAULT '';
+ALTER TABLE api_keys ADD COLUMN allowed_cidrs TEXT NOT NULL DEFAULT '';
+
+ALTER TABLE api_keys ADD COLUMN last_used_ip TEXT NOT NULL DEFAULT '';
+
+-- The key that replaced this one when it was rotated.
+ALTER TABLE api_keys ADD COLUMN replaced_by INTEGER REFERENCES api_keys(id) ON DELETE SET NULL;
+
+-- +goose Down
+
+-- SQLite doesn't support DROP COLUMN before 3.35.0, so the columns are left
+-- in place.
@@ -0,0 +1,18 @@
+-- +goose Up
+
+-- The user a peer belongs to in the self-service portal. NULL for peers
+-- managed by administrators only.
+ALTER TABLE peers ADD COLUMN owner_id INTEGER REFERENCES users(id) ON DELETE SET NULL;
+
+CREATE INDEX idx_peers_owner ON peers(owner_id);
+
+-- How many devices each user may create on the network themselves; 0
+-- disables self-service creation.
+ALTER TABLE networks ADD COLUMN device_limit INTEGER NOT NULL DEFAULT 0;
+
+-- +goose Down
+
+DROP INDEX IF EXISTS idx_peers_owner;
+
+-- SQLite doesn't support DROP COLUMN before 3.35.0, so the columns are left
+-- in place.
@@ -0,0 +1,28 @@
+-- +goose Up
+
+-- One-time enrollment links: the recipient redeems the token with a public
+-- key generated on their device and gets a config for a new peer. Only the
+-- token's hash is stored.
+CREATE TABLE peer_invitations (
+    id            INTEGER PRIMARY KEY AUTOINCREMENT,
+    network_id    INTEGER NOT NULL REFERENCES networks(id) ON DELETE CASCADE,
+    token_hash    TEXT    NOT NULL UNIQUE,
+    token_prefix  TEXT    NOT NULL,
+    name          TEXT    NOT NULL DEFAULT '',
+    email         TEXT    NOT NULL DEFAULT '',
+    single_use    BOOLEAN NOT NULL DEFAULT 1,
+    expires_at    INTEGER,
+    created_by    INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    use_count     INTEGER NOT NULL DEFAULT 0,
+    last_used_at  INTEGER,
+    last_used_ip  TEXT    NOT NULL DEFAULT '',
+    peer_id       INTEGER REFERENCES peers(id) ON DELETE SET NULL,
+    revoked_at    INTEGER,
+    created_at    INTEGER NOT NULL DEFAULT (unixepoch())
+);
+
+CREATE INDEX idx_peer_invitations_network ON peer_invitations(network_id);
+
+-- +goose Down
+
+DROP TABLE IF EXISTS peer_invitations;
@@ -0,0 +1,10 @@
+-- +goose Up
+
+-- Whether new peers with an email address are sent their config and QR
+-- code when they are created.
+ALTER TABLE networks ADD COLUMN email_configs BOOLEAN NOT NULL DEFAULT 0;
+
+-- +goose Down
+
+-- SQLite doesn't support DROP COLUMN before 3.35.0, so the column is left
+-- in place.
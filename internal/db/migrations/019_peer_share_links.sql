@@ -0,0 +1,27 @@
+-- +goose Up
+
+-- Links that let anyone holding the token download a peer's config or QR
+-- code without a session. Only the token's hash is stored. A link is bound
+-- to the peer's public key when it was created, so rotating the peer's keys
+-- invalidates it.
+CREATE TABLE peer_share_links (
+    id            INTEGER PRIMARY KEY AUTOINCREMENT,
+    peer_id       INTEGER NOT NULL REFERENCES peers(id) ON DELETE CASCADE,
+    token_hash    TEXT    NOT NULL UNIQUE,
+    token_prefix  TEXT    NOT NULL,
+    public_key    TEXT    NOT NULL,
+    max_uses      INTEGER NOT NULL DEFAULT 1,
+    use_count     INTEGER NOT NULL DEFAULT 0,
+    expires_at    INTEGER NOT NULL,
+    created_by    INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    last_used_at  INTEGER,
+    last_used_ip  TEXT    NOT NULL DEFAULT '',
+    revoked_at    INTEGER,
+    created_at    INTEGER NOT NULL DEFAULT (unixepoch())
+);
+
+CREATE INDEX idx_peer_share_links_peer ON peer_share_links(peer_id);
+
+-- +goose Down
+
+DROP TABLE IF EXISTS peer_share_links;
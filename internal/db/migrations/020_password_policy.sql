@@ -0,0 +1,39 @@
+-- +goose Up
+
+-- Per-account lockout: failed_logins counts consecutive failed password
+-- logins and locked_until holds the end of the current lockout.
+-- must_change_password forces a new password on the next login. email is
+-- where password reset links are sent.
+ALTER TABLE users ADD COLUMN failed_logins INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE users ADD COLUMN locked_until INTEGER;
+ALTER TABLE users ADD COLUMN must_change_password BOOLEAN NOT NULL DEFAULT 0;
+ALTER TABLE users ADD COLUMN email TEXT NOT NULL DEFAULT '';
+
+-- Previous password hashes, so that recent passwords cannot be reused.
+CREATE TABLE password_history (
+    id            INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id       INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    password_hash TEXT    NOT NULL,
+    created_at    INTEGER NOT NULL DEFAULT (unixepoch())
+);
+
+CREATE INDEX idx_password_history_user ON password_history(user_id);
+
+-- One-time password reset tokens, stored as SHA-256 hashes.
+CREATE TABLE password_reset_tokens (
+    id           INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id      INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    token_hash   TEXT    NOT NULL UNIQUE,
+    expires_at   INTEGER NOT NULL,
+    requested_ip TEXT    NOT NULL DEFAULT '',
+    used_at      INTEGER,
+    created_at   INTEGER NOT NULL DEFAULT (unixepoch())
+);
+
+CREATE INDEX idx_password_reset_tokens_user ON password_reset_tokens(user_id);
+
+-- +goose Down
+
+DROP TABLE IF EXISTS password_reset_tokens;
+DROP TABLE IF EXISTS password_history;
+-- SQLite doesn't support DROP COLUMN before 3.35.0, so the users columns stay.
@@ -0,0 +1,73 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// NetworkRole represents a row in the network_roles table: a role a user
+// holds on one network only.
+type NetworkRole struct {
+	UserID    int64
+	NetworkID int64
+	Role      string
+	CreatedAt time.Time
+}
+
+// SetNetworkRole gives a user a role on a network, replacing any role they
+// already held on it.
+func (d *DB) SetNetworkRole(ctx context.Context, nr *NetworkRole) error {
+	_, err := d.ExecContext(ctx, `
+		INSERT INTO network_roles (user_id, network_id, role)
+		VALUES (?, ?, ?)
+		ON CONFLICT (user_id, network_id) DO UPDATE SET role = excluded.role`,
+		nr.UserID, nr.NetworkID, nr.Role,
+	)
+	if err != nil {
+		return fmt.Errorf("db: set network %d role for user %d: %w", nr.NetworkID, nr.UserID, err)
+	}
+	return nil
+}
+
+// ListNetworkRoles returns a user's network-scoped roles ordered by network.
+func (d *DB) ListNetworkRoles(ctx context.Context, userID int64) ([]NetworkRole, error) {
+	rows, err := d.QueryContext(ctx, `
+		SELECT user_id, network_id, role, created_at
+		FROM network_roles WHERE user_id = ? ORDER BY network_id`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("db: list network roles for user %d: %w", userID, err)
+	}
+	defer rows.Close()
+
+	var roles []NetworkRole
+	for rows.Next() {
+		var nr NetworkRole
+		var createdAt int64
+		if err := rows.Scan(&nr.UserID, &nr.NetworkID, &nr.Role, &createdAt); err != nil {
+			return nil, fmt.Errorf("db: scan network role: %w", err)
+		}
+		nr.CreatedAt = time.Unix(createdAt, 0)
+		roles = append(roles, nr)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("db: list network roles rows: %w", err)
+	}
+	return roles, nil
+}
+
+// DeleteNetworkRole removes a user's role on a network. It reports whether
+// there was one.
+func (d *DB) DeleteNetworkRole(ctx context.Context, userID, networkID int64) (bool, error) {
+	res, err := d.ExecContext(ctx,
+		"DELETE FROM network_roles WHERE user_id = ? AND network_id = ?", userID, networkID,
+	)
+	if err != nil {
+		return false, fmt.Errorf("db: delete network %d role for user %d: %w", networkID, userID, err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("db: delete network %d role for user %d: %w", networkID, userID, err)
+	}
+	return n > 0, nil
+}
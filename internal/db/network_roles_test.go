@@ -0,0 +1,64 @@
+package db
+
+import (
+	"context"
+	"testing"
+)
+
+func TestNetworkRoles_Lifecycle(t *testing.T) {
+	d := testDB(t)
+	ctx := context.Background()
+
+	userID, err := d.CreateUser(ctx, &User{Username: "alice", PasswordHash: "x", Role: "member"})
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	net3, err := d.CreateNetwork(ctx, testNetwork())
+	if err != nil {
+		t.Fatalf("CreateNetwork: %v", err)
+	}
+	other := testNetwork()
+	other.Name, other.Interface, other.ListenPort = "Other", "wg1", 51821
+	net5, err := d.CreateNetwork(ctx, other)
+	if err != nil {
+		t.Fatalf("CreateNetwork: %v", err)
+	}
+
+	if err := d.SetNetworkRole(ctx, &NetworkRole{UserID: userID, NetworkID: net3, Role: "viewer"}); err != nil {
+		t.Fatalf("SetNetworkRole: %v", err)
+	}
+	// Setting a role again replaces it.
+	if err := d.SetNetworkRole(ctx, &NetworkRole{UserID: userID, NetworkID: net3, Role: "admin"}); err != nil {
+		t.Fatalf("SetNetworkRole: %v", err)
+	}
+	if err := d.SetNetworkRole(ctx, &NetworkRole{UserID: userID, NetworkID: net5, Role: "viewer"}); err != nil {
+		t.Fatalf("SetNetworkRole: %v", err)
+	}
+
+	roles, err := d.ListNetworkRoles(ctx, userID)
+	if err != nil {
+		t.Fatalf("ListNetworkRoles: %v", err)
+	}
+	if len(roles) != 2 || roles[0].NetworkID != net3 || roles[0].Role != "admin" || roles[1].Role != "viewer" {
+		t.Fatalf("unexpected roles %+v", roles)
+	}
+	if n, _ := d.CountRoleAssignments(ctx, "viewer"); n != 1 {
+		t.Errorf("expected the network role to count as an assignment, got %d", n)
+	}
+
+	// Deleting the network removes the roles on it.
+	if err := d.DeleteNetwork(ctx, net5); err != nil {
+		t.Fatalf("DeleteNetwork: %v", err)
+	}
+	if roles, _ := d.ListNetworkRoles(ctx, userID); len(roles) != 1 {
+		t.Errorf("expected 1 role after deleting a network, got %d", len(roles))
+	}
+
+	ok, err := d.DeleteNetworkRole(ctx, userID, net3)
+	if err != nil || !ok {
+		t.Fatalf("DeleteNetworkRole: %v, %v", ok, err)
+	}
+	if ok, _ := d.DeleteNetworkRole(ctx, userID, net3); ok {
+		t.Error("expected a second delete to report no role")
+	}
+}
@@ -24,6 +24,8 @@ type Network struct {
 	NATEnabled       bool
 	InterPeerRouting bool
 	Enabled          bool
+	DeviceLimit      int  // devices each user may create in the self-service portal; 0 disables it
+	EmailConfigs     bool // email new peers their config on creation
 	CreatedAt        time.Time
 	UpdatedAt        time.Time
 }
@@ -41,11 +43,11 @@ func (d *DB) CreateNetwork(ctx context.Context, n *Network) (int64, error) {
 	}
 
 	result, err := d.ExecContext(ctx, `
-		INSERT INTO networks (name, interface, mode, subnet, listen_port, private_key, public_key, dns_servers, nat_enabled, inter_peer_routing, enabled)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		INSERT INTO networks (name, interface, mode, subnet, listen_port, private_key, public_key, dns_servers, nat_enabled, inter_peer_routing, enabled, device_limit, email_configs)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
 		n.Name, n.Interface, n.Mode, n.Subnet, n.ListenPort,
 		privateKey, n.PublicKey, n.DNSServers,
-		n.NATEnabled, n.InterPeerRouting, n.Enabled,
+		n.NATEnabled, n.InterPeerRouting, n.Enabled, n.DeviceLimit, n.EmailConfigs,
 	)
 	if err != nil {
 		return 0, fmt.Errorf("db: create network %q: %w", n.Name, err)
@@ -63,12 +65,12 @@ func (d *DB) GetNetworkByID(ctx context.Context, id int64) (*Network, error) {
 	var createdAt, updatedAt int64
 	err := d.QueryRowContext(ctx, `
 		SELECT id, name, interface, mode, subnet, listen_port, private_key, public_key,
-		       dns_servers, nat_enabled, inter_peer_routing, enabled, created_at, updated_at
+		       dns_servers, nat_enabled, inter_peer_routing, enabled, device_limit, email_configs, created_at, updated_at
 		FROM networks WHERE id = ?`, id,
 	).Scan(
 		&n.ID, &n.Name, &n.Interface, &n.Mode, &n.Subnet, &n.ListenPort,
 		&n.PrivateKey, &n.PublicKey, &n.DNSServers,
-		&n.NATEnabled, &n.InterPeerRouting, &n.Enabled,
+		&n.NATEnabled, &n.InterPeerRouting, &n.Enabled, &n.DeviceLimit, &n.EmailConfigs,
 		&createdAt, &updatedAt,
 	)
 	if errors.Is(err, sql.ErrNoRows) {
@@ -89,7 +91,7 @@ func (d *DB) GetNetworkByID(ctx context.Context, id int64) (*Network, error) {
 func (d *DB) ListNetworks(ctx context.Context) ([]Network, error) {
 	rows, err := d.QueryContext(ctx, `
 		SELECT id, name, interface, mode, subnet, listen_port, private_key, public_key,
-		       dns_servers, nat_enabled, inter_peer_routing, enabled, created_at, updated_at
+		       dns_servers, nat_enabled, inter_peer_routing, enabled, device_limit, email_configs, created_at, updated_at
 		FROM networks ORDER BY id`)
 	if err != nil {
 		return nil, fmt.Errorf("db: list networks: %w", err)
@@ -103,7 +105,7 @@ func (d *DB) ListNetworks(ctx context.Context) ([]Network, error) {
 		if err := rows.Scan(
 			&n.ID, &n.Name, &n.Interface, &n.Mode, &n.Subnet, &n.ListenPort,
 			&n.PrivateKey, &n.PublicKey, &n.DNSServers,
-			&n.NATEnabled, &n.InterPeerRouting, &n.Enabled,
+			&n.NATEnabled, &n.InterPeerRouting, &n.Enabled, &n.DeviceLimit, &n.EmailConfigs,
 			&createdAt, &updatedAt,
 		); err != nil {
 			return nil, fmt.Errorf("db: scan network: %w", err)
@@ -149,12 +151,12 @@ func (d *DB) UpdateNetwork(ctx context.Context, n *Network) error {
 		UPDATE networks SET
 			name = ?, mode = ?, subnet = ?, listen_port = ?,
 			private_key = ?, public_key = ?, dns_servers = ?,
-			nat_enabled = ?, inter_peer_routing = ?, enabled = ?,
+			nat_enabled = ?, inter_peer_routing = ?, enabled = ?, device_limit = ?, email_configs = ?,
 			updated_at = unixepoch()
 		WHERE id = ?`,
 		n.Name, n.Mode, n.Subnet, n.ListenPort,
 		privateKey, n.PublicKey, n.DNSServers,
-		n.NATEnabled, n.InterPeerRouting, n.Enabled,
+		n.NATEnabled, n.InterPeerRouting, n.Enabled, n.DeviceLimit, n.EmailConfigs,
 		n.ID,
 	)
 	if err != nil {
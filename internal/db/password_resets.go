@@ -0,0 +1,101 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// PasswordResetToken represents a row in the password_reset_tokens table.
+type PasswordResetToken struct {
+	ID          int64
+	UserID      int64
+	TokenHash   string
+	ExpiresAt   time.Time
+	RequestedIP string
+	UsedAt      *time.Time
+	CreatedAt   time.Time
+}
+
+// Usable reports whether the token can still be used at now.
+func (t *PasswordResetToken) Usable(now time.Time) bool {
+	return t.UsedAt == nil && now.Before(t.ExpiresAt)
+}
+
+// CreatePasswordResetToken inserts a new reset token and returns its ID.
+// Earlier unused tokens of the user are discarded, so only the most recent
+// email works.
+func (d *DB) CreatePasswordResetToken(ctx context.Context, t *PasswordResetToken) (int64, error) {
+	tx, err := d.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("db: begin create password reset token: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx,
+		"DELETE FROM password_reset_tokens WHERE user_id = ? AND used_at IS NULL", t.UserID,
+	); err != nil {
+		return 0, fmt.Errorf("db: discard user %d password reset tokens: %w", t.UserID, err)
+	}
+	result, err := tx.ExecContext(ctx, `
+		INSERT INTO password_reset_tokens (user_id, token_hash, expires_at, requested_ip)
+		VALUES (?, ?, ?, ?)`,
+		t.UserID, t.TokenHash, t.ExpiresAt.Unix(), t.RequestedIP,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("db: create password reset token: %w", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("db: create password reset token last insert id: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("db: commit create password reset token: %w", err)
+	}
+	return id, nil
+}
+
+// GetPasswordResetTokenByHash retrieves a reset token by its hash.
+// Returns nil, nil if not found.
+func (d *DB) GetPasswordResetTokenByHash(ctx context.Context, hash string) (*PasswordResetToken, error) {
+	t := &PasswordResetToken{}
+	var expiresAt, createdAt int64
+	var usedAt sql.NullInt64
+	err := d.QueryRowContext(ctx, `
+		SELECT id, user_id, token_hash, expires_at, requested_ip, used_at, created_at
+		FROM password_reset_tokens WHERE token_hash = ?`, hash,
+	).Scan(&t.ID, &t.UserID, &t.TokenHash, &expiresAt, &t.RequestedIP, &usedAt, &createdAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("db: get password reset token by hash: %w", err)
+	}
+	t.ExpiresAt = time.Unix(expiresAt, 0)
+	t.CreatedAt = time.Unix(createdAt, 0)
+	if usedAt.Valid {
+		ut := time.Unix(usedAt.Int64, 0)
+		t.UsedAt = &ut
+	}
+	return t, nil
+}
+
+// UsePasswordResetToken marks a reset token as used, unless it already was
+// or has expired. It reports whether the token was claimed, so that it
+// works only once.
+func (d *DB) UsePasswordResetToken(ctx context.Context, id int64) (bool, error) {
+	result, err := d.ExecContext(ctx, `
+		UPDATE password_reset_tokens SET used_at = unixepoch()
+		WHERE id = ? AND used_at IS NULL AND expires_at > unixepoch()`, id,
+	)
+	if err != nil {
+		return false, fmt.Errorf("db: use password reset token %d: %w", id, err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("db: use password reset token %d rows affected: %w", id, err)
+	}
+	return n > 0, nil
+}
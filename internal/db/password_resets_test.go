@@ -0,0 +1,70 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestPasswordResetTokens(t *testing.T) {
+	d := testDB(t)
+	ctx := context.Background()
+
+	userID, err := d.CreateUser(ctx, &User{Username: "alice", PasswordHash: "hash", Role: "admin"})
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+
+	first, err := d.CreatePasswordResetToken(ctx, &PasswordResetToken{
+		UserID: userID, TokenHash: "hash-1", ExpiresAt: time.Now().Add(time.Hour),
+	})
+	if err != nil {
+		t.Fatalf("CreatePasswordResetToken: %v", err)
+	}
+	second, err := d.CreatePasswordResetToken(ctx, &PasswordResetToken{
+		UserID: userID, TokenHash: "hash-2", ExpiresAt: time.Now().Add(time.Hour), RequestedIP: "192.0.2.1",
+	})
+	if err != nil {
+		t.Fatalf("CreatePasswordResetToken: %v", err)
+	}
+
+	// A new request discards the previous token.
+	if tok, err := d.GetPasswordResetTokenByHash(ctx, "hash-1"); err != nil || tok != nil {
+		t.Errorf("expected the first token to be discarded, got %+v, %v", tok, err)
+	}
+	if ok, err := d.UsePasswordResetToken(ctx, first); err != nil || ok {
+		t.Errorf("use discarded token = %v, %v; want false", ok, err)
+	}
+
+	for i, want := range []bool{true, false} {
+		if ok, err := d.UsePasswordResetToken(ctx, second); err != nil || ok != want {
+			t.Errorf("use %d = %v, %v; want %v", i+1, ok, err, want)
+		}
+	}
+	tok, err := d.GetPasswordResetTokenByHash(ctx, "hash-2")
+	if err != nil || tok == nil {
+		t.Fatalf("GetPasswordResetTokenByHash: %v", err)
+	}
+	if tok.RequestedIP != "192.0.2.1" || tok.UsedAt == nil || tok.Usable(time.Now()) {
+		t.Errorf("expected a used token requested from 192.0.2.1, got %+v", tok)
+	}
+}
+
+func TestPasswordResetTokens_Expired(t *testing.T) {
+	d := testDB(t)
+	ctx := context.Background()
+
+	userID, err := d.CreateUser(ctx, &User{Username: "alice", PasswordHash: "hash", Role: "admin"})
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	id, err := d.CreatePasswordResetToken(ctx, &PasswordResetToken{
+		UserID: userID, TokenHash: "hash", ExpiresAt: time.Now().Add(-time.Minute),
+	})
+	if err != nil {
+		t.Fatalf("CreatePasswordResetToken: %v", err)
+	}
+	if ok, err := d.UsePasswordResetToken(ctx, id); err != nil || ok {
+		t.Errorf("use expired token = %v, %v; want false", ok, err)
+	}
+}
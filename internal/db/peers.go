@@ -26,6 +26,11 @@ type Peer struct {
 	SiteNetworks        string
 	Enabled             bool
 	ExpiresAt           *time.Time
+	QuotaBytes          int64  // monthly transfer quota (rx+tx); 0 means unlimited
+	QuotaResetDay       int    // day of month (1-28) the quota cycle starts
+	QuotaAction         string // "disable" or "throttle" when the quota is exceeded
+	AllowedCountries    string // comma-separated ISO country codes; empty allows any
+	OwnerID             int64  // user who owns the device in the self-service portal; 0 if none
 	CreatedAt           time.Time
 	UpdatedAt           time.Time
 }
@@ -60,11 +65,13 @@ func (d *DB) CreatePeer(ctx context.Context, p *Peer) (int64, error) {
 
 	result, err := d.ExecContext(ctx, `
 		INSERT INTO peers (network_id, name, email, private_key, public_key, preshared_key,
-		                   allowed_ips, endpoint, persistent_keepalive, role, site_networks, enabled, expires_at)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		                   allowed_ips, endpoint, persistent_keepalive, role, site_networks, enabled, expires_at,
+		                   quota_bytes, quota_reset_day, quota_action, allowed_countries, owner_id)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
 		p.NetworkID, p.Name, p.Email, privateKey, p.PublicKey, presharedKey,
 		p.AllowedIPs, p.Endpoint, p.PersistentKeepalive,
 		p.Role, p.SiteNetworks, p.Enabled, expiresAt,
+		p.QuotaBytes, quotaResetDay(p.QuotaResetDay), quotaAction(p.QuotaAction), p.AllowedCountries, nullID(p.OwnerID),
 	)
 	if err != nil {
 		return 0, fmt.Errorf("db: create peer %q: %w", p.Name, err)
@@ -84,13 +91,13 @@ func (d *DB) GetPeerByID(ctx context.Context, id int64) (*Peer, error) {
 	err := d.QueryRowContext(ctx, `
 		SELECT id, network_id, name, email, private_key, public_key, preshared_key,
 		       allowed_ips, endpoint, persistent_keepalive, role, site_networks, enabled,
-		       expires_at, created_at, updated_at
+		       expires_at, quota_bytes, quota_reset_day, quota_action, allowed_countries, COALESCE(owner_id, 0), created_at, updated_at
 		FROM peers WHERE id = ?`, id,
 	).Scan(
 		&p.ID, &p.NetworkID, &p.Name, &p.Email, &p.PrivateKey, &p.PublicKey, &p.PresharedKey,
 		&p.AllowedIPs, &p.Endpoint, &p.PersistentKeepalive,
 		&p.Role, &p.SiteNetworks, &p.Enabled,
-		&expiresAt, &createdAt, &updatedAt,
+		&expiresAt, &p.QuotaBytes, &p.QuotaResetDay, &p.QuotaAction, &p.AllowedCountries, &p.OwnerID, &createdAt, &updatedAt,
 	)
 	if errors.Is(err, sql.ErrNoRows) {
 		return nil, nil
@@ -115,7 +122,7 @@ func (d *DB) ListPeersByNetworkID(ctx context.Context, networkID int64) ([]Peer,
 	rows, err := d.QueryContext(ctx, `
 		SELECT id, network_id, name, email, private_key, public_key, preshared_key,
 		       allowed_ips, endpoint, persistent_keepalive, role, site_networks, enabled,
-		       expires_at, created_at, updated_at
+		       expires_at, quota_bytes, quota_reset_day, quota_action, allowed_countries, COALESCE(owner_id, 0), created_at, updated_at
 		FROM peers WHERE network_id = ? ORDER BY id`, networkID,
 	)
 	if err != nil {
@@ -132,7 +139,7 @@ func (d *DB) ListPeersByNetworkID(ctx context.Context, networkID int64) ([]Peer,
 			&p.ID, &p.NetworkID, &p.Name, &p.Email, &p.PrivateKey, &p.PublicKey, &p.PresharedKey,
 			&p.AllowedIPs, &p.Endpoint, &p.PersistentKeepalive,
 			&p.Role, &p.SiteNetworks, &p.Enabled,
-			&expiresAt, &createdAt, &updatedAt,
+			&expiresAt, &p.QuotaBytes, &p.QuotaResetDay, &p.QuotaAction, &p.AllowedCountries, &p.OwnerID, &createdAt, &updatedAt,
 		); err != nil {
 			return nil, fmt.Errorf("db: scan peer: %w", err)
 		}
@@ -204,11 +211,13 @@ func (d *DB) UpdatePeer(ctx context.Context, p *Peer) error {
 			name = ?, email = ?, private_key = ?, public_key = ?, preshared_key = ?,
 			allowed_ips = ?, endpoint = ?, persistent_keepalive = ?,
 			role = ?, site_networks = ?, enabled = ?, expires_at = ?,
+			quota_bytes = ?, quota_reset_day = ?, quota_action = ?, allowed_countries = ?, owner_id = ?,
 			updated_at = unixepoch()
 		WHERE id = ?`,
 		p.Name, p.Email, privateKey, p.PublicKey, presharedKey,
 		p.AllowedIPs, p.Endpoint, p.PersistentKeepalive,
 		p.Role, p.SiteNetworks, p.Enabled, expiresAt,
+		p.QuotaBytes, quotaResetDay(p.QuotaResetDay), quotaAction(p.QuotaAction), p.AllowedCountries, nullID(p.OwnerID),
 		p.ID,
 	)
 	if err != nil {
@@ -223,7 +232,7 @@ func (d *DB) ListExpiredPeers(ctx context.Context) ([]Peer, error) {
 	rows, err := d.QueryContext(ctx, `
 		SELECT id, network_id, name, email, private_key, public_key, preshared_key,
 		       allowed_ips, endpoint, persistent_keepalive, role, site_networks, enabled,
-		       expires_at, created_at, updated_at
+		       expires_at, quota_bytes, quota_reset_day, quota_action, allowed_countries, COALESCE(owner_id, 0), created_at, updated_at
 		FROM peers WHERE enabled = 1 AND expires_at IS NOT NULL AND expires_at < ? ORDER BY id`, now,
 	)
 	if err != nil {
@@ -240,7 +249,7 @@ func (d *DB) ListExpiredPeers(ctx context.Context) ([]Peer, error) {
 			&p.ID, &p.NetworkID, &p.Name, &p.Email, &p.PrivateKey, &p.PublicKey, &p.PresharedKey,
 			&p.AllowedIPs, &p.Endpoint, &p.PersistentKeepalive,
 			&p.Role, &p.SiteNetworks, &p.Enabled,
-			&expiresAt, &createdAt, &updatedAt,
+			&expiresAt, &p.QuotaBytes, &p.QuotaResetDay, &p.QuotaAction, &p.AllowedCountries, &p.OwnerID, &createdAt, &updatedAt,
 		); err != nil {
 			return nil, fmt.Errorf("db: scan expired peer: %w", err)
 		}
@@ -265,3 +274,45 @@ func (d *DB) DeletePeer(ctx context.Context, id int64) error {
 	}
 	return nil
 }
+
+// CountPeersByOwner returns how many peers ownerID owns on a network.
+func (d *DB) CountPeersByOwner(ctx context.Context, networkID, ownerID int64) (int, error) {
+	var n int
+	err := d.QueryRowContext(ctx,
+		"SELECT COUNT(*) FROM peers WHERE network_id = ? AND owner_id = ?", networkID, ownerID,
+	).Scan(&n)
+	if err != nil {
+		return 0, fmt.Errorf("db: count peers of owner %d on network %d: %w", ownerID, networkID, err)
+	}
+	return n, nil
+}
+
+// ListOwnedNetworkIDs returns the networks on which ownerID owns a peer.
+func (d *DB) ListOwnedNetworkIDs(ctx context.Context, ownerID int64) ([]int64, error) {
+	rows, err := d.QueryContext(ctx,
+		"SELECT DISTINCT network_id FROM peers WHERE owner_id = ? ORDER BY network_id", ownerID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("db: list networks of owner %d: %w", ownerID, err)
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("db: scan owned network id: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// nullID maps a zero ID to NULL so that an optional foreign key is not
+// checked.
+func nullID(id int64) any {
+	if id == 0 {
+		return nil
+	}
+	return id
+}
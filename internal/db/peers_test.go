@@ -122,6 +122,7 @@ func TestPeers_Update(t *testing.T) {
 	p.ID = peerID
 	p.Name = "Updated Peer"
 	p.Enabled = false
+	p.AllowedCountries = "CH,DE"
 	if err := d.UpdatePeer(ctx, p); err != nil {
 		t.Fatalf("update peer: %v", err)
 	}
@@ -136,6 +137,9 @@ func TestPeers_Update(t *testing.T) {
 	if got.Enabled {
 		t.Error("expected disabled after update")
 	}
+	if got.AllowedCountries != "CH,DE" {
+		t.Errorf("expected allowed countries %q, got %q", "CH,DE", got.AllowedCountries)
+	}
 }
 
 func TestPeers_Delete(t *testing.T) {
@@ -223,3 +227,52 @@ func TestPeers_ForeignKeyEnforced(t *testing.T) {
 		t.Fatal("expected foreign key error for non-existent network")
 	}
 }
+
+func TestPeers_Owner(t *testing.T) {
+	d := testDB(t)
+	ctx := context.Background()
+
+	netID, err := d.CreateNetwork(ctx, testNetwork())
+	if err != nil {
+		t.Fatalf("create network: %v", err)
+	}
+	userID, err := d.CreateUser(ctx, &User{Username: "alice", PasswordHash: "$2a$12$fakehashvalue", Role: "user"})
+	if err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+
+	owned := testPeer(netID)
+	owned.OwnerID = userID
+	ownedID, err := d.CreatePeer(ctx, owned)
+	if err != nil {
+		t.Fatalf("create owned peer: %v", err)
+	}
+	unowned := testPeer(netID)
+	unowned.PublicKey = "other-public-key"
+	if _, err := d.CreatePeer(ctx, unowned); err != nil {
+		t.Fatalf("create unowned peer: %v", err)
+	}
+
+	if n, err := d.CountPeersByOwner(ctx, netID, userID); err != nil || n != 1 {
+		t.Errorf("CountPeersByOwner = %d, %v; want 1", n, err)
+	}
+	ids, err := d.ListOwnedNetworkIDs(ctx, userID)
+	if err != nil {
+		t.Fatalf("ListOwnedNetworkIDs: %v", err)
+	}
+	if len(ids) != 1 || ids[0] != netID {
+		t.Errorf("expected owned networks [%d], got %v", netID, ids)
+	}
+
+	// Deleting the owner keeps the device but clears its owner.
+	if err := d.DeleteUser(ctx, userID); err != nil {
+		t.Fatalf("delete user: %v", err)
+	}
+	got, err := d.GetPeerByID(ctx, ownedID)
+	if err != nil || got == nil {
+		t.Fatalf("get peer: %v", err)
+	}
+	if got.OwnerID != 0 {
+		t.Errorf("expected owner cleared, got %d", got.OwnerID)
+	}
+}
@@ -0,0 +1,153 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Quota actions applied when a peer exceeds its monthly quota.
+const (
+	QuotaActionDisable  = "disable"
+	QuotaActionThrottle = "throttle"
+)
+
+// PeerQuotaState represents a row in the peer_quota_state table. It tracks
+// which billing cycle was last evaluated for a peer and what has already
+// been done in that cycle, so warnings and enforcement happen only once.
+type PeerQuotaState struct {
+	PeerID         int64
+	CycleStart     time.Time
+	WarnedPercent  int
+	EnforcedAction string // quota action applied by the enforcer, empty if none
+	UpdatedAt      time.Time
+}
+
+// quotaResetDay clamps a quota reset day to 1-28 so every month has it.
+func quotaResetDay(day int) int {
+	if day < 1 {
+		return 1
+	}
+	if day > 28 {
+		return 28
+	}
+	return day
+}
+
+// quotaAction returns the stored quota action, defaulting to disable.
+func quotaAction(action string) string {
+	if action == "" {
+		return QuotaActionDisable
+	}
+	return action
+}
+
+// QuotaCycleStart returns the start of the billing cycle containing t for a
+// quota that resets on the given day of the month (UTC).
+func QuotaCycleStart(t time.Time, resetDay int) time.Time {
+	day := quotaResetDay(resetDay)
+	t = t.UTC()
+	start := time.Date(t.Year(), t.Month(), day, 0, 0, 0, 0, time.UTC)
+	if t.Before(start) {
+		start = start.AddDate(0, -1, 0)
+	}
+	return start
+}
+
+// ListQuotaPeers returns all peers that have a quota configured or are
+// currently subject to quota enforcement (so enforcement can be lifted
+// after the quota is removed).
+func (d *DB) ListQuotaPeers(ctx context.Context) ([]Peer, error) {
+	rows, err := d.QueryContext(ctx, `
+		SELECT id, network_id, name, email, private_key, public_key, preshared_key,
+		       allowed_ips, endpoint, persistent_keepalive, role, site_networks, enabled,
+		       expires_at, quota_bytes, quota_reset_day, quota_action, allowed_countries, COALESCE(owner_id, 0), created_at, updated_at
+		FROM peers
+		WHERE quota_bytes > 0
+		   OR id IN (SELECT peer_id FROM peer_quota_state WHERE enforced_action != '')
+		ORDER BY id`,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("db: list quota peers: %w", err)
+	}
+	defer rows.Close()
+
+	var peers []Peer
+	for rows.Next() {
+		var p Peer
+		var createdAt, updatedAt int64
+		var expiresAt sql.NullInt64
+		if err := rows.Scan(
+			&p.ID, &p.NetworkID, &p.Name, &p.Email, &p.PrivateKey, &p.PublicKey, &p.PresharedKey,
+			&p.AllowedIPs, &p.Endpoint, &p.PersistentKeepalive,
+			&p.Role, &p.SiteNetworks, &p.Enabled,
+			&expiresAt, &p.QuotaBytes, &p.QuotaResetDay, &p.QuotaAction, &p.AllowedCountries, &p.OwnerID, &createdAt, &updatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("db: scan quota peer: %w", err)
+		}
+		p.CreatedAt = time.Unix(createdAt, 0)
+		p.UpdatedAt = time.Unix(updatedAt, 0)
+		if expiresAt.Valid {
+			t := time.Unix(expiresAt.Int64, 0)
+			p.ExpiresAt = &t
+		}
+		if err := d.decryptPeerKeys(&p); err != nil {
+			return nil, fmt.Errorf("db: decrypt peer %d keys: %w", p.ID, err)
+		}
+		peers = append(peers, p)
+	}
+	return peers, rows.Err()
+}
+
+// GetPeerQuotaState returns the quota state for a peer, or nil if none exists.
+func (d *DB) GetPeerQuotaState(ctx context.Context, peerID int64) (*PeerQuotaState, error) {
+	s := &PeerQuotaState{}
+	var cycleStart, updatedAt int64
+	err := d.QueryRowContext(ctx, `
+		SELECT peer_id, cycle_start, warned_percent, enforced_action, updated_at
+		FROM peer_quota_state WHERE peer_id = ?`, peerID,
+	).Scan(&s.PeerID, &cycleStart, &s.WarnedPercent, &s.EnforcedAction, &updatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("db: get quota state for peer %d: %w", peerID, err)
+	}
+	s.CycleStart = time.Unix(cycleStart, 0)
+	s.UpdatedAt = time.Unix(updatedAt, 0)
+	return s, nil
+}
+
+// ClearPeerQuotaDisable forgets that the quota enforcer disabled a peer, so
+// the next billing cycle does not re-enable it. It is called when an admin
+// sets the peer's enabled state, which then takes precedence.
+func (d *DB) ClearPeerQuotaDisable(ctx context.Context, peerID int64) error {
+	_, err := d.ExecContext(ctx, `
+		UPDATE peer_quota_state SET enforced_action = '', updated_at = unixepoch()
+		WHERE peer_id = ? AND enforced_action = ?`, peerID, QuotaActionDisable,
+	)
+	if err != nil {
+		return fmt.Errorf("db: clear quota disable for peer %d: %w", peerID, err)
+	}
+	return nil
+}
+
+// UpsertPeerQuotaState inserts or replaces the quota state for a peer.
+func (d *DB) UpsertPeerQuotaState(ctx context.Context, s *PeerQuotaState) error {
+	_, err := d.ExecContext(ctx, `
+		INSERT INTO peer_quota_state (peer_id, cycle_start, warned_percent, enforced_action, updated_at)
+		VALUES (?, ?, ?, ?, unixepoch())
+		ON CONFLICT(peer_id) DO UPDATE SET
+			cycle_start = excluded.cycle_start,
+			warned_percent = excluded.warned_percent,
+			enforced_action = excluded.enforced_action,
+			updated_at = excluded.updated_at`,
+		s.PeerID, s.CycleStart.Unix(), s.WarnedPercent, s.EnforcedAction,
+	)
+	if err != nil {
+		return fmt.Errorf("db: upsert quota state for peer %d: %w", s.PeerID, err)
+	}
+	return nil
+}
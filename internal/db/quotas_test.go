@@ -0,0 +1,180 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestQuotaCycleStart(t *testing.T) {
+	tests := []struct {
+		name     string
+		now      time.Time
+		resetDay int
+		want     time.Time
+	}{
+		{
+			name:     "after reset day",
+			now:      time.Date(2025, 3, 20, 12, 0, 0, 0, time.UTC),
+			resetDay: 15,
+			want:     time.Date(2025, 3, 15, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "before reset day",
+			now:      time.Date(2025, 3, 10, 12, 0, 0, 0, time.UTC),
+			resetDay: 15,
+			want:     time.Date(2025, 2, 15, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "on reset day",
+			now:      time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC),
+			resetDay: 1,
+			want:     time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "year boundary",
+			now:      time.Date(2025, 1, 3, 0, 0, 0, 0, time.UTC),
+			resetDay: 5,
+			want:     time.Date(2024, 12, 5, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "zero day defaults to first",
+			now:      time.Date(2025, 3, 20, 0, 0, 0, 0, time.UTC),
+			resetDay: 0,
+			want:     time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := QuotaCycleStart(tt.now, tt.resetDay)
+			if !got.Equal(tt.want) {
+				t.Errorf("QuotaCycleStart(%v, %d) = %v, want %v", tt.now, tt.resetDay, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQuotas_PeerFieldsRoundTrip(t *testing.T) {
+	d := testDB(t)
+	ctx := context.Background()
+
+	netID, err := d.CreateNetwork(ctx, testNetwork())
+	if err != nil {
+		t.Fatalf("create network: %v", err)
+	}
+	p := testPeer(netID)
+	peerID, err := d.CreatePeer(ctx, p)
+	if err != nil {
+		t.Fatalf("create peer: %v", err)
+	}
+
+	got, err := d.GetPeerByID(ctx, peerID)
+	if err != nil {
+		t.Fatalf("get peer: %v", err)
+	}
+	if got.QuotaBytes != 0 || got.QuotaResetDay != 1 || got.QuotaAction != QuotaActionDisable {
+		t.Errorf("unexpected quota defaults: bytes=%d day=%d action=%q",
+			got.QuotaBytes, got.QuotaResetDay, got.QuotaAction)
+	}
+
+	got.QuotaBytes = 10 << 30
+	got.QuotaResetDay = 15
+	got.QuotaAction = QuotaActionThrottle
+	if err := d.UpdatePeer(ctx, got); err != nil {
+		t.Fatalf("update peer: %v", err)
+	}
+
+	got, err = d.GetPeerByID(ctx, peerID)
+	if err != nil {
+		t.Fatalf("get peer: %v", err)
+	}
+	if got.QuotaBytes != 10<<30 || got.QuotaResetDay != 15 || got.QuotaAction != QuotaActionThrottle {
+		t.Errorf("quota fields not persisted: bytes=%d day=%d action=%q",
+			got.QuotaBytes, got.QuotaResetDay, got.QuotaAction)
+	}
+
+	peers, err := d.ListQuotaPeers(ctx)
+	if err != nil {
+		t.Fatalf("list quota peers: %v", err)
+	}
+	if len(peers) != 1 || peers[0].ID != peerID {
+		t.Errorf("expected quota peer %d, got %+v", peerID, peers)
+	}
+}
+
+func TestQuotas_ListQuotaPeersIncludesEnforced(t *testing.T) {
+	d := testDB(t)
+	ctx := context.Background()
+
+	netID, err := d.CreateNetwork(ctx, testNetwork())
+	if err != nil {
+		t.Fatalf("create network: %v", err)
+	}
+	peerID, err := d.CreatePeer(ctx, testPeer(netID))
+	if err != nil {
+		t.Fatalf("create peer: %v", err)
+	}
+
+	peers, err := d.ListQuotaPeers(ctx)
+	if err != nil {
+		t.Fatalf("list quota peers: %v", err)
+	}
+	if len(peers) != 0 {
+		t.Fatalf("expected no quota peers, got %d", len(peers))
+	}
+
+	// A peer without a quota but still enforced must be listed so the
+	// enforcement can be lifted.
+	if err := d.UpsertPeerQuotaState(ctx, &PeerQuotaState{
+		PeerID:         peerID,
+		CycleStart:     time.Now(),
+		EnforcedAction: QuotaActionDisable,
+	}); err != nil {
+		t.Fatalf("upsert state: %v", err)
+	}
+	peers, err = d.ListQuotaPeers(ctx)
+	if err != nil {
+		t.Fatalf("list quota peers: %v", err)
+	}
+	if len(peers) != 1 {
+		t.Fatalf("expected 1 enforced peer, got %d", len(peers))
+	}
+}
+
+func TestQuotas_StateUpsert(t *testing.T) {
+	d := testDB(t)
+	ctx := context.Background()
+
+	netID, err := d.CreateNetwork(ctx, testNetwork())
+	if err != nil {
+		t.Fatalf("create network: %v", err)
+	}
+	peerID, err := d.CreatePeer(ctx, testPeer(netID))
+	if err != nil {
+		t.Fatalf("create peer: %v", err)
+	}
+
+	got, err := d.GetPeerQuotaState(ctx, peerID)
+	if err != nil {
+		t.Fatalf("get state: %v", err)
+	}
+	if got != nil {
+		t.Fatal("expected nil state for new peer")
+	}
+
+	cycle := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	if err := d.UpsertPeerQuotaState(ctx, &PeerQuotaState{PeerID: peerID, CycleStart: cycle, WarnedPercent: 80}); err != nil {
+		t.Fatalf("upsert: %v", err)
+	}
+	if err := d.UpsertPeerQuotaState(ctx, &PeerQuotaState{PeerID: peerID, CycleStart: cycle, WarnedPercent: 100, EnforcedAction: QuotaActionThrottle}); err != nil {
+		t.Fatalf("upsert: %v", err)
+	}
+
+	got, err = d.GetPeerQuotaState(ctx, peerID)
+	if err != nil {
+		t.Fatalf("get state: %v", err)
+	}
+	if got.WarnedPercent != 100 || got.EnforcedAction != QuotaActionThrottle || !got.CycleStart.Equal(cycle) {
+		t.Errorf("unexpected state: %+v", got)
+	}
+}
@@ -0,0 +1,126 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Role represents a row in the roles table: a custom role.
+type Role struct {
+	Name        string
+	Description string
+	Permissions []string
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+const roleColumns = `name, description, permissions, created_at, updated_at`
+
+// CreateRole inserts a new custom role.
+func (d *DB) CreateRole(ctx context.Context, role *Role) error {
+	_, err := d.ExecContext(ctx, `
+		INSERT INTO roles (name, description, permissions)
+		VALUES (?, ?, ?)`,
+		role.Name, role.Description, strings.Join(role.Permissions, ","),
+	)
+	if err != nil {
+		return fmt.Errorf("db: create role %q: %w", role.Name, err)
+	}
+	return nil
+}
+
+// GetRole retrieves a custom role by name.
+// Returns nil, nil if the role does not exist.
+func (d *DB) GetRole(ctx context.Context, name string) (*Role, error) {
+	role, err := scanRole(d.QueryRowContext(ctx, `
+		SELECT `+roleColumns+`
+		FROM roles WHERE name = ?`, name,
+	))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("db: get role %q: %w", name, err)
+	}
+	return role, nil
+}
+
+// ListRoles returns all custom roles ordered by name.
+func (d *DB) ListRoles(ctx context.Context) ([]Role, error) {
+	rows, err := d.QueryContext(ctx, `
+		SELECT `+roleColumns+`
+		FROM roles ORDER BY name`)
+	if err != nil {
+		return nil, fmt.Errorf("db: list roles: %w", err)
+	}
+	defer rows.Close()
+
+	var roles []Role
+	for rows.Next() {
+		role, err := scanRole(rows)
+		if err != nil {
+			return nil, fmt.Errorf("db: scan role: %w", err)
+		}
+		roles = append(roles, *role)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("db: list roles rows: %w", err)
+	}
+	return roles, nil
+}
+
+// UpdateRole updates a custom role's description and permissions.
+func (d *DB) UpdateRole(ctx context.Context, role *Role) error {
+	_, err := d.ExecContext(ctx, `
+		UPDATE roles SET description = ?, permissions = ?, updated_at = unixepoch()
+		WHERE name = ?`,
+		role.Description, strings.Join(role.Permissions, ","), role.Name,
+	)
+	if err != nil {
+		return fmt.Errorf("db: update role %q: %w", role.Name, err)
+	}
+	return nil
+}
+
+// DeleteRole deletes a custom role by name.
+func (d *DB) DeleteRole(ctx context.Context, name string) error {
+	_, err := d.ExecContext(ctx, "DELETE FROM roles WHERE name = ?", name)
+	if err != nil {
+		return fmt.Errorf("db: delete role %q: %w", name, err)
+	}
+	return nil
+}
+
+// CountRoleAssignments returns the number of users, network-scoped
+// assignments and API keys that have the named role.
+func (d *DB) CountRoleAssignments(ctx context.Context, name string) (int, error) {
+	var n int
+	err := d.QueryRowContext(ctx, `
+		SELECT (SELECT COUNT(*) FROM users WHERE role = ?)
+		     + (SELECT COUNT(*) FROM network_roles WHERE role = ?)
+		     + (SELECT COUNT(*) FROM api_keys WHERE role = ?)`, name, name, name,
+	).Scan(&n)
+	if err != nil {
+		return 0, fmt.Errorf("db: count role %q assignments: %w", name, err)
+	}
+	return n, nil
+}
+
+func scanRole(row interface{ Scan(...any) error }) (*Role, error) {
+	role := &Role{}
+	var perms string
+	var createdAt, updatedAt int64
+	if err := row.Scan(&role.Name, &role.Description, &perms, &createdAt, &updatedAt); err != nil {
+		return nil, err
+	}
+	if perms != "" {
+		role.Permissions = strings.Split(perms, ",")
+	}
+	role.CreatedAt = time.Unix(createdAt, 0)
+	role.UpdatedAt = time.Unix(updatedAt, 0)
+	return role, nil
+}
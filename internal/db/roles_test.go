@@ -0,0 +1,60 @@
+package db
+
+import (
+	"context"
+	"slices"
+	"testing"
+)
+
+func TestRoles_Lifecycle(t *testing.T) {
+	d := testDB(t)
+	ctx := context.Background()
+
+	if err := d.CreateRole(ctx, &Role{
+		Name:        "operator",
+		Description: "Manages peers",
+		Permissions: []string{"network:read", "peer:*"},
+	}); err != nil {
+		t.Fatalf("CreateRole: %v", err)
+	}
+	if err := d.CreateRole(ctx, &Role{Name: "operator"}); err == nil {
+		t.Error("expected duplicate role name to be rejected")
+	}
+
+	role, err := d.GetRole(ctx, "operator")
+	if err != nil {
+		t.Fatalf("GetRole: %v", err)
+	}
+	if role == nil || role.Description != "Manages peers" || !slices.Equal(role.Permissions, []string{"network:read", "peer:*"}) {
+		t.Fatalf("unexpected role %+v", role)
+	}
+
+	role.Permissions = []string{"peer:read"}
+	if err := d.UpdateRole(ctx, role); err != nil {
+		t.Fatalf("UpdateRole: %v", err)
+	}
+	roles, err := d.ListRoles(ctx)
+	if err != nil {
+		t.Fatalf("ListRoles: %v", err)
+	}
+	if len(roles) != 1 || !slices.Equal(roles[0].Permissions, []string{"peer:read"}) {
+		t.Errorf("unexpected roles %+v", roles)
+	}
+
+	userID, _ := d.CreateUser(ctx, &User{Username: "alice", PasswordHash: "x", Role: "operator"})
+	d.CreateAPIKey(ctx, &APIKey{Name: "ci", KeyHash: "h", KeyPrefix: "wgp_", UserID: userID, Role: "operator"})
+	n, err := d.CountRoleAssignments(ctx, "operator")
+	if err != nil {
+		t.Fatalf("CountRoleAssignments: %v", err)
+	}
+	if n != 2 {
+		t.Errorf("assignments = %d, want 2", n)
+	}
+
+	if err := d.DeleteRole(ctx, "operator"); err != nil {
+		t.Fatalf("DeleteRole: %v", err)
+	}
+	if role, _ := d.GetRole(ctx, "operator"); role != nil {
+		t.Error("expected role to be deleted")
+	}
+}
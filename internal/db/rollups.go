@@ -0,0 +1,165 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// snapshotTier is one level of snapshot downsampling. Each tier is rolled up
+// from the one before it and kept for its retention period.
+type snapshotTier struct {
+	Table      string
+	Resolution time.Duration // bucket width; 0 for raw snapshots
+	Retention  time.Duration // 0 keeps rows forever
+}
+
+// RawSnapshotRetention is how long raw snapshots are kept by default before
+// only their rollups remain.
+const RawSnapshotRetention = 48 * time.Hour
+
+// snapshotTiers lists the downsampling tiers from finest to coarsest. The
+// raw tier's retention is configurable and passed in where it matters.
+var snapshotTiers = []snapshotTier{
+	{Table: "peer_snapshots"},
+	{Table: "peer_snapshots_5m", Resolution: 5 * time.Minute, Retention: 30 * 24 * time.Hour},
+	{Table: "peer_snapshots_1h", Resolution: time.Hour, Retention: 365 * 24 * time.Hour},
+	{Table: "peer_snapshots_1d", Resolution: 24 * time.Hour},
+}
+
+// SnapshotResolution returns the finest resolution that still has data for
+// the whole window starting at from, given how long raw snapshots are kept.
+// 0 means raw snapshots.
+func SnapshotResolution(from, now time.Time, rawRetention time.Duration) time.Duration {
+	age := now.Sub(from)
+	if age <= rawRetention {
+		return 0
+	}
+	for _, tier := range snapshotTiers[1:] {
+		if tier.Retention == 0 || age <= tier.Retention {
+			return tier.Resolution
+		}
+	}
+	return snapshotTiers[len(snapshotTiers)-1].Resolution
+}
+
+func rollupTier(resolution time.Duration) (snapshotTier, bool) {
+	for _, tier := range snapshotTiers[1:] {
+		if tier.Resolution == resolution {
+			return tier, true
+		}
+	}
+	return snapshotTier{}, false
+}
+
+// RollupSnapshots aggregates every complete bucket not yet rolled up into
+// each downsampling tier, then deletes rollups past their retention. Raw
+// snapshots are left alone; CompactSnapshots removes them. Snapshots taken
+// before traffic tracking got their deltas from migration 005, so they roll
+// up like any other. Returns the number of rollup rows written and deleted.
+func (ts *TimeSeries) RollupSnapshots(ctx context.Context, now time.Time) (written, deleted int64, err error) {
+	tx, err := ts.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, 0, fmt.Errorf("db: rollup snapshots: begin: %w", err)
+	}
+	defer tx.Rollback()
+
+	for i := 1; i < len(snapshotTiers); i++ {
+		src, dst := snapshotTiers[i-1], snapshotTiers[i]
+		step := int64(dst.Resolution / time.Second)
+		// Only buckets that have fully elapsed are final.
+		end := now.Unix() / step * step
+
+		result, err := tx.ExecContext(ctx, `
+			INSERT INTO `+dst.Table+` (peer_id, timestamp, rx_delta, tx_delta, online)
+			SELECT peer_id, timestamp / ? * ? AS bucket, SUM(rx_delta), SUM(tx_delta), MAX(online)
+			FROM `+src.Table+`
+			WHERE timestamp >= (SELECT COALESCE(MAX(timestamp) + ?, 0) FROM `+dst.Table+`)
+			  AND timestamp < ?
+			GROUP BY peer_id, bucket
+			ON CONFLICT(peer_id, timestamp) DO UPDATE SET
+				rx_delta = excluded.rx_delta,
+				tx_delta = excluded.tx_delta,
+				online = excluded.online`,
+			step, step, step, end,
+		)
+		if err != nil {
+			return 0, 0, fmt.Errorf("db: rollup %s into %s: %w", src.Table, dst.Table, err)
+		}
+		n, err := result.RowsAffected()
+		if err != nil {
+			return 0, 0, fmt.Errorf("db: rollup %s rows affected: %w", dst.Table, err)
+		}
+		written += n
+	}
+
+	for _, tier := range snapshotTiers[1:] {
+		if tier.Retention == 0 {
+			continue
+		}
+		result, err := tx.ExecContext(ctx,
+			"DELETE FROM "+tier.Table+" WHERE timestamp < ?",
+			now.Add(-tier.Retention).Unix(),
+		)
+		if err != nil {
+			return 0, 0, fmt.Errorf("db: prune %s: %w", tier.Table, err)
+		}
+		n, err := result.RowsAffected()
+		if err != nil {
+			return 0, 0, fmt.Errorf("db: prune %s rows affected: %w", tier.Table, err)
+		}
+		deleted += n
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, 0, fmt.Errorf("db: rollup snapshots: commit: %w", err)
+	}
+	return written, deleted, nil
+}
+
+// ListSnapshotRollups returns downsampled snapshots for a peer within a time
+// range at the given resolution, ordered by bucket start. RxDelta and TxDelta
+// hold the bytes transferred during each bucket; RxBytes and TxBytes are
+// zero. Buckets the compactor has not rolled up yet are aggregated from raw
+// snapshots, so the most recent data is always included.
+func (ts *TimeSeries) ListSnapshotRollups(ctx context.Context, peerID int64, resolution time.Duration, from, to time.Time) ([]PeerSnapshot, error) {
+	tier, ok := rollupTier(resolution)
+	if !ok {
+		return nil, fmt.Errorf("db: no snapshot rollup at resolution %s", resolution)
+	}
+	step := int64(resolution / time.Second)
+	start := from.Unix() / step * step
+
+	rows, err := ts.db.QueryContext(ctx, `
+		SELECT timestamp, rx_delta, tx_delta, online
+		FROM `+tier.Table+`
+		WHERE peer_id = ? AND timestamp >= ? AND timestamp <= ?
+		UNION ALL
+		SELECT timestamp / ? * ? AS bucket, SUM(rx_delta), SUM(tx_delta), MAX(online)
+		FROM peer_snapshots
+		WHERE peer_id = ?
+		  AND timestamp >= MAX(?, (SELECT COALESCE(MAX(timestamp) + ?, 0) FROM `+tier.Table+` WHERE peer_id = ?))
+		  AND timestamp <= ?
+		GROUP BY bucket
+		ORDER BY 1`,
+		peerID, start, to.Unix(),
+		step, step,
+		peerID, start, step, peerID, to.Unix(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("db: list %s snapshots for peer %d: %w", tier.Table, peerID, err)
+	}
+	defer rows.Close()
+
+	var snapshots []PeerSnapshot
+	for rows.Next() {
+		s := PeerSnapshot{PeerID: peerID}
+		var unix int64
+		if err := rows.Scan(&unix, &s.RxDelta, &s.TxDelta, &s.Online); err != nil {
+			return nil, fmt.Errorf("db: scan snapshot rollup: %w", err)
+		}
+		s.Timestamp = time.Unix(unix, 0)
+		snapshots = append(snapshots, s)
+	}
+	return snapshots, rows.Err()
+}
@@ -0,0 +1,226 @@
+package db
+
+import (
+	"context"
+	"log/slog"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSnapshotResolution(t *testing.T) {
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name      string
+		from      time.Time
+		retention time.Duration
+		want      time.Duration
+	}{
+		{"last 24 hours", now.Add(-24 * time.Hour), RawSnapshotRetention, 0},
+		{"last 48 hours", now.Add(-48 * time.Hour), RawSnapshotRetention, 0},
+		{"last 48 hours, raw kept 24h", now.Add(-48 * time.Hour), 24 * time.Hour, 5 * time.Minute},
+		{"last week, raw kept 10d", now.AddDate(0, 0, -7), 10 * 24 * time.Hour, 0},
+		{"last week", now.AddDate(0, 0, -7), RawSnapshotRetention, 5 * time.Minute},
+		{"last 30 days", now.AddDate(0, 0, -30), RawSnapshotRetention, 5 * time.Minute},
+		{"last 90 days", now.AddDate(0, 0, -90), RawSnapshotRetention, time.Hour},
+		{"two years", now.AddDate(-2, 0, 0), RawSnapshotRetention, 24 * time.Hour},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := SnapshotResolution(tt.from, now, tt.retention); got != tt.want {
+				t.Errorf("SnapshotResolution = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRollupSnapshots(t *testing.T) {
+	ts := testTimeSeries(t)
+	ctx := context.Background()
+	peerID := int64(1)
+
+	// One snapshot every minute for two hours, 10 rx / 20 tx bytes each.
+	day := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 120; i++ {
+		s := testSnapshot(peerID, day.Add(time.Duration(i)*time.Minute))
+		s.RxDelta, s.TxDelta = 10, 20
+		if err := ts.InsertSnapshot(ctx, s); err != nil {
+			t.Fatalf("insert snapshot: %v", err)
+		}
+	}
+
+	now := day.Add(26 * time.Hour)
+	written, _, err := ts.RollupSnapshots(ctx, now)
+	if err != nil {
+		t.Fatalf("rollup: %v", err)
+	}
+	// 24 five-minute buckets, 2 hourly buckets, 1 daily bucket.
+	if written != 27 {
+		t.Errorf("expected 27 rollup rows, got %d", written)
+	}
+
+	fiveMin, err := ts.ListSnapshotRollups(ctx, peerID, 5*time.Minute, day, now)
+	if err != nil {
+		t.Fatalf("list 5m: %v", err)
+	}
+	if len(fiveMin) != 24 {
+		t.Fatalf("expected 24 five-minute buckets, got %d", len(fiveMin))
+	}
+	if got := fiveMin[0]; !got.Timestamp.Equal(day) || got.RxDelta != 50 || got.TxDelta != 100 || !got.Online {
+		t.Errorf("unexpected first 5m bucket: %+v", got)
+	}
+
+	hourly, err := ts.ListSnapshotRollups(ctx, peerID, time.Hour, day, now)
+	if err != nil {
+		t.Fatalf("list 1h: %v", err)
+	}
+	if len(hourly) != 2 || hourly[1].RxDelta != 600 || hourly[1].TxDelta != 1200 {
+		t.Errorf("unexpected hourly buckets: %+v", hourly)
+	}
+
+	daily, err := ts.ListSnapshotRollups(ctx, peerID, 24*time.Hour, day, now)
+	if err != nil {
+		t.Fatalf("list 1d: %v", err)
+	}
+	if len(daily) != 1 || daily[0].RxDelta != 1200 || daily[0].TxDelta != 2400 {
+		t.Errorf("unexpected daily buckets: %+v", daily)
+	}
+
+	// Rollups survive raw compaction.
+	if _, err := ts.CompactSnapshots(ctx, now); err != nil {
+		t.Fatalf("compact: %v", err)
+	}
+	daily, err = ts.ListSnapshotRollups(ctx, peerID, 24*time.Hour, day, now)
+	if err != nil {
+		t.Fatalf("list 1d: %v", err)
+	}
+	if len(daily) != 1 || daily[0].RxDelta != 1200 {
+		t.Errorf("expected daily rollup to survive compaction, got %+v", daily)
+	}
+
+	// A second run has nothing new to roll up.
+	written, _, err = ts.RollupSnapshots(ctx, now)
+	if err != nil {
+		t.Fatalf("rollup: %v", err)
+	}
+	if written != 0 {
+		t.Errorf("expected no new rollup rows, got %d", written)
+	}
+}
+
+func TestRollupSnapshots_LegacySnapshots(t *testing.T) {
+	ctx := context.Background()
+	logger := slog.Default()
+	now := time.Now().UTC().Truncate(24 * time.Hour)
+	day := now.Add(-3 * 24 * time.Hour)
+	d, peerID := legacySnapshotDB(t, day, []struct{ rx, tx int64 }{
+		{1000, 5000},
+		{1600, 5300},
+		{2000, 5400},
+	})
+
+	ts, err := NewTimeSeries(ctx, filepath.Join(t.TempDir(), "wgpilot-timeseries.db"), logger, true)
+	if err != nil {
+		t.Fatalf("open time series: %v", err)
+	}
+	defer ts.Close()
+	if err := MigrateTimeSeries(ctx, d, ts, logger); err != nil {
+		t.Fatalf("migrate time series: %v", err)
+	}
+
+	// Raw snapshots from before the upgrade are past retention: once rolled
+	// up and compacted, their traffic must survive in the rollups.
+	if _, _, err := ts.RollupSnapshots(ctx, now); err != nil {
+		t.Fatalf("rollup: %v", err)
+	}
+	if _, err := ts.CompactSnapshots(ctx, now.Add(-RawSnapshotRetention)); err != nil {
+		t.Fatalf("compact: %v", err)
+	}
+
+	rollups, err := ts.ListSnapshotRollups(ctx, peerID, 24*time.Hour, day, now)
+	if err != nil {
+		t.Fatalf("list rollups: %v", err)
+	}
+	if len(rollups) != 1 || rollups[0].RxDelta != 1000 || rollups[0].TxDelta != 400 {
+		t.Errorf("expected one daily rollup of 1000/400 bytes, got %+v", rollups)
+	}
+}
+
+func TestRollupSnapshots_PrunesExpiredTiers(t *testing.T) {
+	ts := testTimeSeries(t)
+	ctx := context.Background()
+	peerID := int64(1)
+
+	day := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	s := testSnapshot(peerID, day)
+	s.RxDelta = 100
+	if err := ts.InsertSnapshot(ctx, s); err != nil {
+		t.Fatalf("insert snapshot: %v", err)
+	}
+	if _, _, err := ts.RollupSnapshots(ctx, day.Add(48*time.Hour)); err != nil {
+		t.Fatalf("rollup: %v", err)
+	}
+
+	// Two years later only the daily rollup is left.
+	now := day.AddDate(2, 0, 0)
+	_, deleted, err := ts.RollupSnapshots(ctx, now)
+	if err != nil {
+		t.Fatalf("rollup: %v", err)
+	}
+	if deleted != 2 {
+		t.Errorf("expected 5m and hourly rollups pruned, got %d deleted", deleted)
+	}
+	if _, err := ts.CompactSnapshots(ctx, now); err != nil {
+		t.Fatalf("compact: %v", err)
+	}
+
+	daily, err := ts.ListSnapshotRollups(ctx, peerID, 24*time.Hour, day, now)
+	if err != nil {
+		t.Fatalf("list 1d: %v", err)
+	}
+	if len(daily) != 1 || daily[0].RxDelta != 100 {
+		t.Errorf("expected daily rollup kept forever, got %+v", daily)
+	}
+}
+
+func TestListSnapshotRollups_IncludesRecentRawSnapshots(t *testing.T) {
+	ts := testTimeSeries(t)
+	ctx := context.Background()
+	peerID := int64(1)
+
+	base := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	insert := func(at time.Time, rx int64) {
+		t.Helper()
+		s := testSnapshot(peerID, at)
+		s.RxDelta = rx
+		if err := ts.InsertSnapshot(ctx, s); err != nil {
+			t.Fatalf("insert snapshot: %v", err)
+		}
+	}
+
+	insert(base.Add(time.Minute), 100)
+	if _, _, err := ts.RollupSnapshots(ctx, base.Add(10*time.Minute)); err != nil {
+		t.Fatalf("rollup: %v", err)
+	}
+	// Not rolled up yet.
+	insert(base.Add(11*time.Minute), 200)
+	insert(base.Add(12*time.Minute), 300)
+
+	got, err := ts.ListSnapshotRollups(ctx, peerID, 5*time.Minute, base, base.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("expected 2 buckets, got %d: %+v", len(got), got)
+	}
+	if !got[0].Timestamp.Equal(base) || got[0].RxDelta != 100 {
+		t.Errorf("unexpected rolled-up bucket: %+v", got[0])
+	}
+	if !got[1].Timestamp.Equal(base.Add(10*time.Minute)) || got[1].RxDelta != 500 {
+		t.Errorf("unexpected raw bucket: %+v", got[1])
+	}
+
+	if _, err := ts.ListSnapshotRollups(ctx, peerID, time.Minute, base, base.Add(time.Hour)); err == nil {
+		t.Error("expected error for unsupported resolution")
+	}
+}
@@ -0,0 +1,188 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// PeerSession represents a row in the peer_sessions table: one continuous
+// period during which a peer was online. EndedAt is nil while the session
+// is still open.
+type PeerSession struct {
+	ID         int64
+	PeerID     int64
+	StartedAt  time.Time
+	LastSeenAt time.Time
+	EndedAt    *time.Time
+	Endpoint   string
+	RxBytes    int64
+	TxBytes    int64
+}
+
+// recordSession folds a snapshot into the peer's session history. An online
+// snapshot extends the open session or starts a new one; an offline snapshot
+// closes the open session at the last time the peer was seen online. The
+// snapshot's deltas are added to the session either way, since they cover
+// the interval leading up to it.
+func recordSession(ctx context.Context, tx *Tx, s *PeerSnapshot) error {
+	unix := s.Timestamp.Unix()
+
+	if !s.Online {
+		if _, err := tx.ExecContext(ctx, `
+			UPDATE peer_sessions SET
+				ended_at = last_seen_at,
+				rx_bytes = rx_bytes + ?,
+				tx_bytes = tx_bytes + ?
+			WHERE peer_id = ? AND ended_at IS NULL`,
+			s.RxDelta, s.TxDelta, s.PeerID,
+		); err != nil {
+			return fmt.Errorf("db: close session for peer %d: %w", s.PeerID, err)
+		}
+		return nil
+	}
+
+	result, err := tx.ExecContext(ctx, `
+		UPDATE peer_sessions SET
+			last_seen_at = ?,
+			endpoint = CASE WHEN endpoint = '' THEN ? ELSE endpoint END,
+			rx_bytes = rx_bytes + ?,
+			tx_bytes = tx_bytes + ?
+		WHERE peer_id = ? AND ended_at IS NULL`,
+		unix, s.Endpoint, s.RxDelta, s.TxDelta, s.PeerID,
+	)
+	if err != nil {
+		return fmt.Errorf("db: extend session for peer %d: %w", s.PeerID, err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("db: extend session rows affected: %w", err)
+	}
+	if n > 0 {
+		return nil
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO peer_sessions (peer_id, started_at, last_seen_at, endpoint, rx_bytes, tx_bytes)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		s.PeerID, unix, unix, s.Endpoint, s.RxDelta, s.TxDelta,
+	); err != nil {
+		return fmt.Errorf("db: start session for peer %d: %w", s.PeerID, err)
+	}
+	return nil
+}
+
+// CloseStaleSessions closes open sessions whose peer was last seen online
+// before the given time, at that last sighting. The poller calls it when
+// snapshots have stopped arriving for a peer, such as after downtime or when
+// its network was disabled, so that the next online snapshot starts a new
+// session instead of extending one across the gap. Returns the number of
+// sessions closed.
+func (ts *TimeSeries) CloseStaleSessions(ctx context.Context, before time.Time) (int64, error) {
+	result, err := ts.db.ExecContext(ctx, `
+		UPDATE peer_sessions SET ended_at = last_seen_at
+		WHERE ended_at IS NULL AND last_seen_at < ?`,
+		before.Unix(),
+	)
+	if err != nil {
+		return 0, fmt.Errorf("db: close stale sessions: %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("db: close stale sessions rows affected: %w", err)
+	}
+	return n, nil
+}
+
+// ListPeerSessions returns a peer's sessions that overlap the given time
+// range, most recent first. Open sessions overlap any range that ends after
+// they started.
+func (ts *TimeSeries) ListPeerSessions(ctx context.Context, peerID int64, from, to time.Time) ([]PeerSession, error) {
+	rows, err := ts.db.QueryContext(ctx, `
+		SELECT id, peer_id, started_at, last_seen_at, ended_at, endpoint, rx_bytes, tx_bytes
+		FROM peer_sessions
+		WHERE peer_id = ? AND started_at <= ? AND (ended_at IS NULL OR ended_at >= ?)
+		ORDER BY started_at DESC`,
+		peerID, to.Unix(), from.Unix(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("db: list sessions for peer %d: %w", peerID, err)
+	}
+	defer rows.Close()
+
+	var sessions []PeerSession
+	for rows.Next() {
+		var s PeerSession
+		var startedAt, lastSeenAt int64
+		var endedAt sql.NullInt64
+		if err := rows.Scan(&s.ID, &s.PeerID, &startedAt, &lastSeenAt, &endedAt, &s.Endpoint, &s.RxBytes, &s.TxBytes); err != nil {
+			return nil, fmt.Errorf("db: scan session: %w", err)
+		}
+		s.StartedAt = time.Unix(startedAt, 0)
+		s.LastSeenAt = time.Unix(lastSeenAt, 0)
+		if endedAt.Valid {
+			t := time.Unix(endedAt.Int64, 0)
+			s.EndedAt = &t
+		}
+		sessions = append(sessions, s)
+	}
+	return sessions, rows.Err()
+}
+
+// BackfillSessions reconstructs sessions from the raw snapshots of peers
+// that have no session history yet, such as after upgrading from a version
+// that did not record sessions. Only snapshots still within raw retention
+// can be replayed. Returns the number of sessions created.
+func (ts *TimeSeries) BackfillSessions(ctx context.Context) (int64, error) {
+	tx, err := ts.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("db: backfill sessions: begin: %w", err)
+	}
+	defer tx.Rollback()
+
+	var before int64
+	if err := tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM peer_sessions").Scan(&before); err != nil {
+		return 0, fmt.Errorf("db: backfill sessions: count: %w", err)
+	}
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT peer_id, timestamp, rx_delta, tx_delta, online
+		FROM peer_snapshots
+		WHERE peer_id NOT IN (SELECT peer_id FROM peer_sessions)
+		ORDER BY peer_id, timestamp`)
+	if err != nil {
+		return 0, fmt.Errorf("db: backfill sessions: list snapshots: %w", err)
+	}
+	var snapshots []PeerSnapshot
+	for rows.Next() {
+		var s PeerSnapshot
+		var unix int64
+		if err := rows.Scan(&s.PeerID, &unix, &s.RxDelta, &s.TxDelta, &s.Online); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("db: backfill sessions: scan snapshot: %w", err)
+		}
+		s.Timestamp = time.Unix(unix, 0)
+		snapshots = append(snapshots, s)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("db: backfill sessions: list snapshots: %w", err)
+	}
+
+	for i := range snapshots {
+		if err := recordSession(ctx, tx, &snapshots[i]); err != nil {
+			return 0, err
+		}
+	}
+
+	var after int64
+	if err := tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM peer_sessions").Scan(&after); err != nil {
+		return 0, fmt.Errorf("db: backfill sessions: count: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("db: backfill sessions: commit: %w", err)
+	}
+	return after - before, nil
+}
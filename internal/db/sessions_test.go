@@ -0,0 +1,176 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestSessions_RecordedFromSnapshots(t *testing.T) {
+	ts := testTimeSeries(t)
+	ctx := context.Background()
+	peerID := int64(1)
+
+	base := time.Date(2025, 3, 1, 9, 0, 0, 0, time.UTC)
+	points := []struct {
+		offset   time.Duration
+		online   bool
+		endpoint string
+		rx, tx   int64
+	}{
+		{0, true, "", 100, 10},
+		{time.Minute, true, "198.51.100.7:40000", 200, 20},
+		{2 * time.Minute, true, "198.51.100.8:40000", 300, 30},
+		{3 * time.Minute, false, "", 50, 5}, // closes the first session
+		{10 * time.Minute, false, "", 0, 0},
+		{20 * time.Minute, true, "203.0.113.1:51820", 400, 40},
+	}
+	for _, pt := range points {
+		s := testSnapshot(peerID, base.Add(pt.offset))
+		s.Online = pt.online
+		s.Endpoint = pt.endpoint
+		s.RxDelta, s.TxDelta = pt.rx, pt.tx
+		if err := ts.InsertSnapshot(ctx, s); err != nil {
+			t.Fatalf("insert snapshot: %v", err)
+		}
+	}
+
+	sessions, err := ts.ListPeerSessions(ctx, peerID, base, base.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("list sessions: %v", err)
+	}
+	if len(sessions) != 2 {
+		t.Fatalf("expected 2 sessions, got %d: %+v", len(sessions), sessions)
+	}
+
+	open := sessions[0]
+	if open.EndedAt != nil || !open.StartedAt.Equal(base.Add(20*time.Minute)) {
+		t.Errorf("expected open session starting at +20m, got %+v", open)
+	}
+	if open.Endpoint != "203.0.113.1:51820" || open.RxBytes != 400 {
+		t.Errorf("unexpected open session: %+v", open)
+	}
+
+	closed := sessions[1]
+	if !closed.StartedAt.Equal(base) || closed.EndedAt == nil || !closed.EndedAt.Equal(base.Add(2*time.Minute)) {
+		t.Errorf("expected session from +0m to +2m, got %+v", closed)
+	}
+	// The first endpoint seen is kept.
+	if closed.Endpoint != "198.51.100.7:40000" {
+		t.Errorf("expected endpoint 198.51.100.7:40000, got %q", closed.Endpoint)
+	}
+	if closed.RxBytes != 650 || closed.TxBytes != 65 {
+		t.Errorf("expected 650/65 bytes, got %d/%d", closed.RxBytes, closed.TxBytes)
+	}
+
+	// Only the closed session overlaps a window before the reconnect.
+	sessions, err = ts.ListPeerSessions(ctx, peerID, base.Add(time.Minute), base.Add(5*time.Minute))
+	if err != nil {
+		t.Fatalf("list sessions: %v", err)
+	}
+	if len(sessions) != 1 || sessions[0].ID != closed.ID {
+		t.Errorf("expected only the closed session, got %+v", sessions)
+	}
+}
+
+func TestSessions_CloseStale(t *testing.T) {
+	ts := testTimeSeries(t)
+	ctx := context.Background()
+
+	base := time.Date(2025, 3, 1, 9, 0, 0, 0, time.UTC)
+	for _, s := range []*PeerSnapshot{
+		testSnapshot(1, base),
+		testSnapshot(1, base.Add(time.Minute)),
+		testSnapshot(2, base.Add(10*time.Minute)),
+	} {
+		s.Online = true
+		if err := ts.InsertSnapshot(ctx, s); err != nil {
+			t.Fatalf("insert snapshot: %v", err)
+		}
+	}
+
+	// Peer 1's snapshots stopped; peer 2 is still being seen.
+	n, err := ts.CloseStaleSessions(ctx, base.Add(5*time.Minute))
+	if err != nil {
+		t.Fatalf("close stale sessions: %v", err)
+	}
+	if n != 1 {
+		t.Errorf("expected 1 session closed, got %d", n)
+	}
+
+	// Coming back after the gap starts a new session.
+	s := testSnapshot(1, base.Add(time.Hour))
+	s.Online = true
+	if err := ts.InsertSnapshot(ctx, s); err != nil {
+		t.Fatalf("insert snapshot: %v", err)
+	}
+	sessions, err := ts.ListPeerSessions(ctx, 1, base, base.Add(2*time.Hour))
+	if err != nil {
+		t.Fatalf("list sessions: %v", err)
+	}
+	if len(sessions) != 2 {
+		t.Fatalf("expected 2 sessions, got %d: %+v", len(sessions), sessions)
+	}
+	if closed := sessions[1]; closed.EndedAt == nil || !closed.EndedAt.Equal(base.Add(time.Minute)) {
+		t.Errorf("expected the stale session closed at its last sighting, got %+v", closed)
+	}
+	if open := sessions[0]; open.EndedAt != nil || !open.StartedAt.Equal(base.Add(time.Hour)) {
+		t.Errorf("expected a new open session, got %+v", open)
+	}
+
+	sessions, err = ts.ListPeerSessions(ctx, 2, base, base.Add(2*time.Hour))
+	if err != nil {
+		t.Fatalf("list sessions: %v", err)
+	}
+	if len(sessions) != 1 || sessions[0].EndedAt != nil {
+		t.Errorf("expected peer 2's session still open, got %+v", sessions)
+	}
+}
+
+func TestSessions_Backfill(t *testing.T) {
+	ts := testTimeSeries(t)
+	ctx := context.Background()
+
+	base := time.Date(2025, 3, 1, 9, 0, 0, 0, time.UTC)
+	online := []bool{true, true, false, true}
+	for i, on := range online {
+		if _, err := ts.db.ExecContext(ctx, `
+			INSERT INTO peer_snapshots (peer_id, timestamp, rx_bytes, tx_bytes, rx_delta, tx_delta, online)
+			VALUES (1, ?, 0, 0, 10, 20, ?)`,
+			base.Add(time.Duration(i)*time.Minute).Unix(), on,
+		); err != nil {
+			t.Fatalf("insert snapshot: %v", err)
+		}
+	}
+
+	n, err := ts.BackfillSessions(ctx)
+	if err != nil {
+		t.Fatalf("backfill: %v", err)
+	}
+	if n != 2 {
+		t.Fatalf("expected 2 sessions backfilled, got %d", n)
+	}
+
+	sessions, err := ts.ListPeerSessions(ctx, 1, base, base.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("list sessions: %v", err)
+	}
+	if len(sessions) != 2 {
+		t.Fatalf("expected 2 sessions, got %d", len(sessions))
+	}
+	if s := sessions[1]; s.EndedAt == nil || !s.EndedAt.Equal(base.Add(time.Minute)) || s.RxBytes != 30 {
+		t.Errorf("unexpected backfilled session: %+v", s)
+	}
+	if s := sessions[0]; s.EndedAt != nil {
+		t.Errorf("expected last session to stay open, got %+v", s)
+	}
+
+	// Peers that already have sessions are not replayed.
+	n, err = ts.BackfillSessions(ctx)
+	if err != nil {
+		t.Fatalf("backfill again: %v", err)
+	}
+	if n != 0 {
+		t.Errorf("expected nothing to backfill, got %d", n)
+	}
+}
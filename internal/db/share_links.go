@@ -0,0 +1,164 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ShareLink represents a row in the peer_share_links table: a link that
+// lets anyone holding its token download a peer's config without a session.
+type ShareLink struct {
+	ID          int64
+	PeerID      int64
+	TokenHash   string
+	TokenPrefix string
+	PublicKey   string // the peer's public key when the link was created
+	MaxUses     int
+	UseCount    int
+	ExpiresAt   time.Time
+	CreatedBy   int64
+	LastUsedAt  *time.Time
+	LastUsedIP  string
+	RevokedAt   *time.Time
+	CreatedAt   time.Time
+}
+
+// Usable reports whether the link can still be used at now for peer. Links
+// stop working when the peer is disabled or its keys have been rotated.
+func (l *ShareLink) Usable(peer *Peer, now time.Time) bool {
+	if l.RevokedAt != nil || l.UseCount >= l.MaxUses || !now.Before(l.ExpiresAt) {
+		return false
+	}
+	return peer != nil && peer.ID == l.PeerID && peer.Enabled && peer.PublicKey == l.PublicKey
+}
+
+const shareLinkColumns = `id, peer_id, token_hash, token_prefix, public_key, max_uses, use_count, expires_at,
+		COALESCE(created_by, 0), last_used_at, last_used_ip, revoked_at, created_at`
+
+// CreateShareLink inserts a new share link and returns its ID.
+func (d *DB) CreateShareLink(ctx context.Context, l *ShareLink) (int64, error) {
+	result, err := d.ExecContext(ctx, `
+		INSERT INTO peer_share_links (peer_id, token_hash, token_prefix, public_key, max_uses, expires_at, created_by)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		l.PeerID, l.TokenHash, l.TokenPrefix, l.PublicKey, l.MaxUses, l.ExpiresAt.Unix(), nullID(l.CreatedBy),
+	)
+	if err != nil {
+		return 0, fmt.Errorf("db: create share link: %w", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("db: create share link last insert id: %w", err)
+	}
+	return id, nil
+}
+
+// GetShareLinkByID retrieves a share link by ID.
+// Returns nil, nil if not found.
+func (d *DB) GetShareLinkByID(ctx context.Context, id int64) (*ShareLink, error) {
+	l, err := scanShareLink(d.QueryRowContext(ctx,
+		"SELECT "+shareLinkColumns+" FROM peer_share_links WHERE id = ?", id,
+	))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("db: get share link %d: %w", id, err)
+	}
+	return l, nil
+}
+
+// GetShareLinkByHash retrieves a share link by its token hash.
+// Returns nil, nil if not found.
+func (d *DB) GetShareLinkByHash(ctx context.Context, hash string) (*ShareLink, error) {
+	l, err := scanShareLink(d.QueryRowContext(ctx,
+		"SELECT "+shareLinkColumns+" FROM peer_share_links WHERE token_hash = ?", hash,
+	))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("db: get share link by hash: %w", err)
+	}
+	return l, nil
+}
+
+// ListShareLinks returns a peer's share links, newest first.
+func (d *DB) ListShareLinks(ctx context.Context, peerID int64) ([]ShareLink, error) {
+	rows, err := d.QueryContext(ctx,
+		"SELECT "+shareLinkColumns+" FROM peer_share_links WHERE peer_id = ? ORDER BY id DESC", peerID)
+	if err != nil {
+		return nil, fmt.Errorf("db: list share links for peer %d: %w", peerID, err)
+	}
+	defer rows.Close()
+
+	var links []ShareLink
+	for rows.Next() {
+		l, err := scanShareLink(rows)
+		if err != nil {
+			return nil, fmt.Errorf("db: scan share link: %w", err)
+		}
+		links = append(links, *l)
+	}
+	return links, rows.Err()
+}
+
+// RevokeShareLink stops a share link from being used. It reports whether
+// the link was still unrevoked.
+func (d *DB) RevokeShareLink(ctx context.Context, id int64) (bool, error) {
+	result, err := d.ExecContext(ctx,
+		"UPDATE peer_share_links SET revoked_at = unixepoch() WHERE id = ? AND revoked_at IS NULL", id)
+	if err != nil {
+		return false, fmt.Errorf("db: revoke share link %d: %w", id, err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("db: revoke share link %d rows affected: %w", id, err)
+	}
+	return n > 0, nil
+}
+
+// ClaimShareLink counts a use of a share link from ip, unless it has been
+// revoked, has expired or has no uses left. It reports whether the claim
+// succeeded, so that concurrent downloads cannot exceed the use limit.
+func (d *DB) ClaimShareLink(ctx context.Context, id int64, ip string) (bool, error) {
+	result, err := d.ExecContext(ctx, `
+		UPDATE peer_share_links
+		SET use_count = use_count + 1, last_used_at = unixepoch(), last_used_ip = ?
+		WHERE id = ? AND revoked_at IS NULL
+		  AND expires_at > unixepoch()
+		  AND use_count < max_uses`,
+		ip, id,
+	)
+	if err != nil {
+		return false, fmt.Errorf("db: claim share link %d: %w", id, err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("db: claim share link %d rows affected: %w", id, err)
+	}
+	return n > 0, nil
+}
+
+func scanShareLink(row interface{ Scan(...any) error }) (*ShareLink, error) {
+	l := &ShareLink{}
+	var expiresAt, createdAt int64
+	var lastUsedAt, revokedAt sql.NullInt64
+	if err := row.Scan(&l.ID, &l.PeerID, &l.TokenHash, &l.TokenPrefix, &l.PublicKey, &l.MaxUses, &l.UseCount,
+		&expiresAt, &l.CreatedBy, &lastUsedAt, &l.LastUsedIP, &revokedAt, &createdAt); err != nil {
+		return nil, err
+	}
+	l.ExpiresAt = time.Unix(expiresAt, 0)
+	l.CreatedAt = time.Unix(createdAt, 0)
+	if lastUsedAt.Valid {
+		t := time.Unix(lastUsedAt.Int64, 0)
+		l.LastUsedAt = &t
+	}
+	if revokedAt.Valid {
+		t := time.Unix(revokedAt.Int64, 0)
+		l.RevokedAt = &t
+	}
+	return l, nil
+}
@@ -0,0 +1,71 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestShareLinks_ClaimLimit(t *testing.T) {
+	d := testDB(t)
+	ctx := context.Background()
+
+	netID, err := d.CreateNetwork(ctx, testNetwork())
+	if err != nil {
+		t.Fatalf("create network: %v", err)
+	}
+	peerID, err := d.CreatePeer(ctx, testPeer(netID))
+	if err != nil {
+		t.Fatalf("create peer: %v", err)
+	}
+	peer, err := d.GetPeerByID(ctx, peerID)
+	if err != nil {
+		t.Fatalf("get peer: %v", err)
+	}
+
+	id, err := d.CreateShareLink(ctx, &ShareLink{
+		PeerID: peerID, TokenHash: "hash", TokenPrefix: "wgs_abcd...", PublicKey: peer.PublicKey,
+		MaxUses: 2, ExpiresAt: time.Now().Add(time.Hour),
+	})
+	if err != nil {
+		t.Fatalf("CreateShareLink: %v", err)
+	}
+
+	for i, want := range []bool{true, true, false} {
+		if ok, err := d.ClaimShareLink(ctx, id, "192.0.2.1"); err != nil || ok != want {
+			t.Errorf("claim %d = %v, %v; want %v", i+1, ok, err, want)
+		}
+	}
+
+	link, err := d.GetShareLinkByHash(ctx, "hash")
+	if err != nil || link == nil {
+		t.Fatalf("GetShareLinkByHash: %v", err)
+	}
+	if link.UseCount != 2 || link.LastUsedIP != "192.0.2.1" || link.Usable(peer, time.Now()) {
+		t.Errorf("expected a used-up link last used from 192.0.2.1, got %+v", link)
+	}
+}
+
+func TestShareLinks_Usable(t *testing.T) {
+	now := time.Now()
+	peer := &Peer{ID: 1, PublicKey: "pub", Enabled: true}
+	link := ShareLink{PeerID: 1, PublicKey: "pub", MaxUses: 1, ExpiresAt: now.Add(time.Hour)}
+
+	if !link.Usable(peer, now) {
+		t.Fatal("expected a fresh link to be usable")
+	}
+	if link.Usable(peer, now.Add(2*time.Hour)) {
+		t.Error("expected an expired link to be unusable")
+	}
+	if link.Usable(&Peer{ID: 1, PublicKey: "pub"}, now) {
+		t.Error("expected a link to a disabled peer to be unusable")
+	}
+	if link.Usable(&Peer{ID: 1, PublicKey: "rotated", Enabled: true}, now) {
+		t.Error("expected a link to a rotated peer to be unusable")
+	}
+	revoked := link
+	revoked.RevokedAt = &now
+	if revoked.Usable(peer, now) {
+		t.Error("expected a revoked link to be unusable")
+	}
+}
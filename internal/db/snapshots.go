@@ -2,35 +2,108 @@ package db
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
 	"time"
 )
 
 // PeerSnapshot represents a row in the peer_snapshots table.
+// RxBytes and TxBytes are the raw kernel counters, which reset whenever the
+// interface is recreated. RxDelta and TxDelta are the bytes transferred since
+// the previous snapshot, with counter resets already accounted for.
+// Endpoint is the peer's remote address at the time; it is recorded in the
+// peer's session and roaming history rather than on the snapshot row.
 type PeerSnapshot struct {
 	PeerID    int64
 	Timestamp time.Time
 	RxBytes   int64
 	TxBytes   int64
+	RxDelta   int64
+	TxDelta   int64
 	Online    bool
+	Endpoint  string
 }
 
-// InsertSnapshot inserts a peer snapshot record.
-func (d *DB) InsertSnapshot(ctx context.Context, s *PeerSnapshot) error {
-	_, err := d.ExecContext(ctx,
-		"INSERT INTO peer_snapshots (peer_id, timestamp, rx_bytes, tx_bytes, online) VALUES (?, ?, ?, ?, ?)",
-		s.PeerID, s.Timestamp.Unix(), s.RxBytes, s.TxBytes, s.Online,
-	)
+// InsertSnapshots inserts a batch of peer snapshots in a single transaction,
+// adds their deltas to each peer's lifetime and daily traffic totals, records
+// endpoint changes, and opens, extends or closes each peer's session.
+// The poller writes one batch per poll cycle.
+func (ts *TimeSeries) InsertSnapshots(ctx context.Context, snapshots []PeerSnapshot) error {
+	if len(snapshots) == 0 {
+		return nil
+	}
+
+	tx, err := ts.db.BeginTx(ctx, nil)
 	if err != nil {
-		return fmt.Errorf("db: insert snapshot for peer %d: %w", s.PeerID, err)
+		return fmt.Errorf("db: insert %d snapshots: begin: %w", len(snapshots), err)
+	}
+	defer tx.Rollback()
+
+	for i := range snapshots {
+		if err := insertSnapshot(ctx, tx, &snapshots[i]); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("db: insert %d snapshots: commit: %w", len(snapshots), err)
 	}
 	return nil
 }
 
+// InsertSnapshot inserts a single peer snapshot. Use InsertSnapshots to
+// write many at once.
+func (ts *TimeSeries) InsertSnapshot(ctx context.Context, s *PeerSnapshot) error {
+	return ts.InsertSnapshots(ctx, []PeerSnapshot{*s})
+}
+
+func insertSnapshot(ctx context.Context, tx *Tx, s *PeerSnapshot) error {
+	unix := s.Timestamp.Unix()
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO peer_snapshots (peer_id, timestamp, rx_bytes, tx_bytes, rx_delta, tx_delta, online)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		s.PeerID, unix, s.RxBytes, s.TxBytes, s.RxDelta, s.TxDelta, s.Online,
+	); err != nil {
+		return fmt.Errorf("db: insert snapshot for peer %d: %w", s.PeerID, err)
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO peer_traffic (peer_id, last_rx, last_tx, lifetime_rx, lifetime_tx, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT(peer_id) DO UPDATE SET
+			last_rx = excluded.last_rx,
+			last_tx = excluded.last_tx,
+			lifetime_rx = lifetime_rx + excluded.lifetime_rx,
+			lifetime_tx = lifetime_tx + excluded.lifetime_tx,
+			updated_at = excluded.updated_at`,
+		s.PeerID, s.RxBytes, s.TxBytes, s.RxDelta, s.TxDelta, unix,
+	); err != nil {
+		return fmt.Errorf("db: update lifetime traffic for peer %d: %w", s.PeerID, err)
+	}
+
+	if s.RxDelta != 0 || s.TxDelta != 0 {
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO peer_traffic_daily (peer_id, day, rx_bytes, tx_bytes)
+			VALUES (?, ?, ?, ?)
+			ON CONFLICT(peer_id, day) DO UPDATE SET
+				rx_bytes = rx_bytes + excluded.rx_bytes,
+				tx_bytes = tx_bytes + excluded.tx_bytes`,
+			s.PeerID, trafficDay(s.Timestamp), s.RxDelta, s.TxDelta,
+		); err != nil {
+			return fmt.Errorf("db: update daily traffic for peer %d: %w", s.PeerID, err)
+		}
+	}
+	if err := recordEndpoint(ctx, tx, s); err != nil {
+		return err
+	}
+	return recordSession(ctx, tx, s)
+}
+
 // ListSnapshots returns snapshots for a peer within a time range, ordered by timestamp.
-func (d *DB) ListSnapshots(ctx context.Context, peerID int64, from, to time.Time) ([]PeerSnapshot, error) {
-	rows, err := d.QueryContext(ctx, `
-		SELECT peer_id, timestamp, rx_bytes, tx_bytes, online
+func (ts *TimeSeries) ListSnapshots(ctx context.Context, peerID int64, from, to time.Time) ([]PeerSnapshot, error) {
+	rows, err := ts.db.QueryContext(ctx, `
+		SELECT peer_id, timestamp, rx_bytes, tx_bytes, rx_delta, tx_delta, online
 		FROM peer_snapshots
 		WHERE peer_id = ? AND timestamp >= ? AND timestamp <= ?
 		ORDER BY timestamp`,
@@ -44,20 +117,42 @@ func (d *DB) ListSnapshots(ctx context.Context, peerID int64, from, to time.Time
 	var snapshots []PeerSnapshot
 	for rows.Next() {
 		var s PeerSnapshot
-		var ts int64
-		if err := rows.Scan(&s.PeerID, &ts, &s.RxBytes, &s.TxBytes, &s.Online); err != nil {
+		var unix int64
+		if err := rows.Scan(&s.PeerID, &unix, &s.RxBytes, &s.TxBytes, &s.RxDelta, &s.TxDelta, &s.Online); err != nil {
 			return nil, fmt.Errorf("db: scan snapshot: %w", err)
 		}
-		s.Timestamp = time.Unix(ts, 0)
+		s.Timestamp = time.Unix(unix, 0)
 		snapshots = append(snapshots, s)
 	}
 	return snapshots, rows.Err()
 }
 
+// GetLastSnapshotBefore returns the most recent snapshot for a peer taken
+// strictly before t, or nil if there is none.
+func (ts *TimeSeries) GetLastSnapshotBefore(ctx context.Context, peerID int64, t time.Time) (*PeerSnapshot, error) {
+	s := &PeerSnapshot{}
+	var unix int64
+	err := ts.db.QueryRowContext(ctx, `
+		SELECT peer_id, timestamp, rx_bytes, tx_bytes, rx_delta, tx_delta, online
+		FROM peer_snapshots
+		WHERE peer_id = ? AND timestamp < ?
+		ORDER BY timestamp DESC LIMIT 1`,
+		peerID, t.Unix(),
+	).Scan(&s.PeerID, &unix, &s.RxBytes, &s.TxBytes, &s.RxDelta, &s.TxDelta, &s.Online)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("db: last snapshot for peer %d: %w", peerID, err)
+	}
+	s.Timestamp = time.Unix(unix, 0)
+	return s, nil
+}
+
 // CompactSnapshots deletes snapshots older than the given cutoff time.
 // Returns the number of rows deleted.
-func (d *DB) CompactSnapshots(ctx context.Context, before time.Time) (int64, error) {
-	result, err := d.ExecContext(ctx,
+func (ts *TimeSeries) CompactSnapshots(ctx context.Context, before time.Time) (int64, error) {
+	result, err := ts.db.ExecContext(ctx,
 		"DELETE FROM peer_snapshots WHERE timestamp < ?",
 		before.Unix(),
 	)
@@ -0,0 +1,152 @@
+package db
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"log/slog"
+	"slices"
+)
+
+//go:embed timeseries/*.sql
+var timeSeriesFS embed.FS
+
+// timeSeriesTables lists the tables kept in the time-series database, with
+// the columns copied when moving them out of the main database.
+var timeSeriesTables = []struct {
+	name    string
+	columns string
+}{
+	{"peer_snapshots", "peer_id, timestamp, rx_bytes, tx_bytes, rx_delta, tx_delta, online"},
+	{"peer_snapshots_5m", "peer_id, timestamp, rx_delta, tx_delta, online"},
+	{"peer_snapshots_1h", "peer_id, timestamp, rx_delta, tx_delta, online"},
+	{"peer_snapshots_1d", "peer_id, timestamp, rx_delta, tx_delta, online"},
+	{"peer_traffic", "peer_id, last_rx, last_tx, lifetime_rx, lifetime_tx, updated_at"},
+	{"peer_traffic_daily", "peer_id, day, rx_bytes, tx_bytes"},
+	{"peer_sessions", "id, peer_id, started_at, last_seen_at, ended_at, endpoint, rx_bytes, tx_bytes"},
+	{"peer_endpoints", "peer_id, timestamp, endpoint"},
+}
+
+// TimeSeries stores peer snapshots, their rollups and traffic totals in a
+// SQLite file separate from the main database. It has its own WAL, so the
+// poller's writes never wait on API writes, and it is left out of backups.
+type TimeSeries struct {
+	db  *DB
+	dsn string
+}
+
+// NewTimeSeries opens the time-series database at dsn, creating it if needed,
+// and applies its migrations.
+func NewTimeSeries(ctx context.Context, dsn string, logger *slog.Logger, devMode bool) (*TimeSeries, error) {
+	d, err := New(ctx, dsn, logger, devMode)
+	if err != nil {
+		return nil, err
+	}
+	// NORMAL is safe in WAL mode and avoids an fsync on every commit; at
+	// worst the last few snapshots are lost on power failure.
+	if _, err := d.conn.ExecContext(ctx, "PRAGMA synchronous=NORMAL"); err != nil {
+		d.Close()
+		return nil, fmt.Errorf("db: exec synchronous pragma: %w", err)
+	}
+	if err := migrate(ctx, d, timeSeriesFS, "timeseries", logger); err != nil {
+		d.Close()
+		return nil, err
+	}
+	return &TimeSeries{db: d, dsn: dsn}, nil
+}
+
+// Close closes the time-series database.
+func (ts *TimeSeries) Close() error {
+	return ts.db.Close()
+}
+
+// SetQueryObserver registers fn to receive the timing of every time-series
+// query. See DB.SetQueryObserver.
+func (ts *TimeSeries) SetQueryObserver(fn QueryObserver) {
+	ts.db.SetQueryObserver(fn)
+}
+
+// TableCounts returns row counts for the given time-series tables.
+func (ts *TimeSeries) TableCounts(ctx context.Context, tables []string) map[string]int64 {
+	return ts.db.TableCounts(ctx, tables)
+}
+
+// DeletePeer removes all time-series data for a peer.
+func (ts *TimeSeries) DeletePeer(ctx context.Context, peerID int64) error {
+	tx, err := ts.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("db: delete time series for peer %d: begin: %w", peerID, err)
+	}
+	defer tx.Rollback()
+
+	for _, table := range timeSeriesTables {
+		if _, err := tx.ExecContext(ctx, "DELETE FROM "+table.name+" WHERE peer_id = ?", peerID); err != nil {
+			return fmt.Errorf("db: delete %s for peer %d: %w", table.name, peerID, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("db: delete time series for peer %d: commit: %w", peerID, err)
+	}
+	return nil
+}
+
+// MigrateTimeSeries moves snapshot and traffic tables created by earlier
+// versions from the main database into the time-series database, then drops
+// them from the main database. Tables already moved are skipped, so it is
+// safe to run on every start.
+func MigrateTimeSeries(ctx context.Context, d *DB, ts *TimeSeries, logger *slog.Logger) error {
+	var legacy []string
+	for _, table := range timeSeriesTables {
+		var n int
+		if err := d.conn.QueryRowContext(ctx,
+			"SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?", table.name,
+		).Scan(&n); err != nil {
+			return fmt.Errorf("migrate time series: check %s: %w", table.name, err)
+		}
+		if n > 0 {
+			legacy = append(legacy, table.name)
+		}
+	}
+	if len(legacy) == 0 {
+		return nil
+	}
+	if ts.dsn == ":memory:" {
+		return fmt.Errorf("migrate time series: cannot attach an in-memory database")
+	}
+
+	// ATTACH is per connection, so pin one for the whole move.
+	conn, err := d.conn.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("migrate time series: get connection: %w", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, "ATTACH DATABASE ? AS ts", ts.dsn); err != nil {
+		return fmt.Errorf("migrate time series: attach %s: %w", ts.dsn, err)
+	}
+	defer conn.ExecContext(context.WithoutCancel(ctx), "DETACH DATABASE ts")
+
+	for _, table := range timeSeriesTables {
+		if !slices.Contains(legacy, table.name) {
+			continue
+		}
+		result, err := conn.ExecContext(ctx,
+			"INSERT OR IGNORE INTO ts."+table.name+" ("+table.columns+") SELECT "+table.columns+" FROM main."+table.name,
+		)
+		if err != nil {
+			return fmt.Errorf("migrate time series: copy %s: %w", table.name, err)
+		}
+		// Only drop once the copy is durable in the time-series file.
+		if _, err := conn.ExecContext(ctx, "DROP TABLE main."+table.name); err != nil {
+			return fmt.Errorf("migrate time series: drop %s: %w", table.name, err)
+		}
+		n, _ := result.RowsAffected()
+		logger.Info("time_series_table_moved",
+			"table", table.name,
+			"rows", n,
+			"component", "db",
+		)
+	}
+	return nil
+}
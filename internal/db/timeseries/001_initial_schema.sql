@@ -0,0 +1,82 @@
+-- +goose Up
+
+-- Time-series tables live in their own database file so that high-frequency
+-- writes do not contend with the main database and stay out of its backups.
+-- Peers live in the main database, so there are no foreign keys; rows are
+-- removed explicitly when a peer is deleted.
+
+CREATE TABLE peer_snapshots (
+    peer_id    INTEGER NOT NULL,
+    timestamp  INTEGER NOT NULL,  -- unix epoch
+    rx_bytes   INTEGER NOT NULL,  -- raw kernel counter, resets with the interface
+    tx_bytes   INTEGER NOT NULL,
+    rx_delta   INTEGER NOT NULL DEFAULT 0,  -- bytes since the previous snapshot
+    tx_delta   INTEGER NOT NULL DEFAULT 0,
+    online     BOOLEAN NOT NULL,
+
+    PRIMARY KEY (peer_id, timestamp)
+);
+
+CREATE INDEX idx_snapshots_timestamp ON peer_snapshots(timestamp);
+
+-- Downsampled snapshots. Each row covers one bucket starting at timestamp.
+
+CREATE TABLE peer_snapshots_5m (
+    peer_id   INTEGER NOT NULL,
+    timestamp INTEGER NOT NULL,  -- unix epoch of the bucket start
+    rx_delta  INTEGER NOT NULL DEFAULT 0,
+    tx_delta  INTEGER NOT NULL DEFAULT 0,
+    online    BOOLEAN NOT NULL DEFAULT 0,
+
+    PRIMARY KEY (peer_id, timestamp)
+);
+
+CREATE TABLE peer_snapshots_1h (
+    peer_id   INTEGER NOT NULL,
+    timestamp INTEGER NOT NULL,
+    rx_delta  INTEGER NOT NULL DEFAULT 0,
+    tx_delta  INTEGER NOT NULL DEFAULT 0,
+    online    BOOLEAN NOT NULL DEFAULT 0,
+
+    PRIMARY KEY (peer_id, timestamp)
+);
+
+CREATE TABLE peer_snapshots_1d (
+    peer_id   INTEGER NOT NULL,
+    timestamp INTEGER NOT NULL,
+    rx_delta  INTEGER NOT NULL DEFAULT 0,
+    tx_delta  INTEGER NOT NULL DEFAULT 0,
+    online    BOOLEAN NOT NULL DEFAULT 0,
+
+    PRIMARY KEY (peer_id, timestamp)
+);
+
+CREATE INDEX idx_snapshots_5m_timestamp ON peer_snapshots_5m(timestamp);
+CREATE INDEX idx_snapshots_1h_timestamp ON peer_snapshots_1h(timestamp);
+
+CREATE TABLE peer_traffic (
+    peer_id     INTEGER PRIMARY KEY,
+    last_rx     INTEGER NOT NULL DEFAULT 0,  -- raw kernel counter at the last poll
+    last_tx     INTEGER NOT NULL DEFAULT 0,
+    lifetime_rx INTEGER NOT NULL DEFAULT 0,  -- monotonic, survives interface recreation
+    lifetime_tx INTEGER NOT NULL DEFAULT 0,
+    updated_at  INTEGER NOT NULL DEFAULT (unixepoch())
+);
+
+CREATE TABLE peer_traffic_daily (
+    peer_id  INTEGER NOT NULL,
+    day      INTEGER NOT NULL,  -- unix epoch of 00:00 UTC
+    rx_bytes INTEGER NOT NULL DEFAULT 0,
+    tx_bytes INTEGER NOT NULL DEFAULT 0,
+
+    PRIMARY KEY (peer_id, day)
+);
+
+-- +goose Down
+
+DROP TABLE IF EXISTS peer_traffic_daily;
+DROP TABLE IF EXISTS peer_traffic;
+DROP TABLE IF EXISTS peer_snapshots_1d;
+DROP TABLE IF EXISTS peer_snapshots_1h;
+DROP TABLE IF EXISTS peer_snapshots_5m;
+DROP TABLE IF EXISTS peer_snapshots;
@@ -0,0 +1,23 @@
+-- +goose Up
+
+-- One row per continuous online period of a peer. ended_at is NULL while the
+-- session is still open; last_seen_at is the last snapshot in which the peer
+-- was online and becomes ended_at when the peer goes offline.
+
+CREATE TABLE peer_sessions (
+    id           INTEGER PRIMARY KEY AUTOINCREMENT,
+    peer_id      INTEGER NOT NULL,
+    started_at   INTEGER NOT NULL,  -- unix epoch
+    last_seen_at INTEGER NOT NULL,
+    ended_at     INTEGER,
+    endpoint     TEXT NOT NULL DEFAULT '',
+    rx_bytes     INTEGER NOT NULL DEFAULT 0,
+    tx_bytes     INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE INDEX idx_sessions_peer ON peer_sessions(peer_id, started_at);
+CREATE UNIQUE INDEX idx_sessions_open ON peer_sessions(peer_id) WHERE ended_at IS NULL;
+
+-- +goose Down
+
+DROP TABLE IF EXISTS peer_sessions;
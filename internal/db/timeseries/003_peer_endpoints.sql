@@ -0,0 +1,18 @@
+-- +goose Up
+
+-- Endpoint roaming history: one row each time a peer's remote address
+-- differs from the previous one seen.
+
+CREATE TABLE peer_endpoints (
+    peer_id   INTEGER NOT NULL,
+    timestamp INTEGER NOT NULL,  -- unix epoch the new endpoint was first seen
+    endpoint  TEXT    NOT NULL,  -- host:port
+
+    PRIMARY KEY (peer_id, timestamp)
+);
+
+CREATE INDEX idx_endpoints_timestamp ON peer_endpoints(timestamp);
+
+-- +goose Down
+
+DROP TABLE IF EXISTS peer_endpoints;
@@ -0,0 +1,275 @@
+package db
+
+import (
+	"context"
+	"log/slog"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestInsertSnapshots_Batch(t *testing.T) {
+	ts := testTimeSeries(t)
+	ctx := context.Background()
+
+	now := time.Now().Truncate(time.Second)
+	batch := make([]PeerSnapshot, 0, 3)
+	for peerID := int64(1); peerID <= 3; peerID++ {
+		s := testSnapshot(peerID, now)
+		s.RxDelta, s.TxDelta = 10*peerID, 20*peerID
+		batch = append(batch, *s)
+	}
+	if err := ts.InsertSnapshots(ctx, batch); err != nil {
+		t.Fatalf("insert batch: %v", err)
+	}
+	if err := ts.InsertSnapshots(ctx, nil); err != nil {
+		t.Fatalf("insert empty batch: %v", err)
+	}
+
+	traffic, err := ts.ListPeerTraffic(ctx)
+	if err != nil {
+		t.Fatalf("list traffic: %v", err)
+	}
+	if len(traffic) != 3 {
+		t.Fatalf("expected 3 peers, got %d", len(traffic))
+	}
+	if got := traffic[3]; got.LifetimeRx != 30 || got.LifetimeTx != 60 {
+		t.Errorf("unexpected totals for peer 3: %+v", got)
+	}
+
+	// A failing row rolls back the whole batch.
+	bad := []PeerSnapshot{*testSnapshot(4, now), *testSnapshot(1, now)}
+	if err := ts.InsertSnapshots(ctx, bad); err == nil {
+		t.Fatal("expected duplicate snapshot to fail the batch")
+	}
+	if got, err := ts.GetPeerTraffic(ctx, 4); err != nil || got != nil {
+		t.Errorf("expected no traffic for peer 4 after rollback, got %+v (err %v)", got, err)
+	}
+}
+
+func TestMigrateTimeSeries(t *testing.T) {
+	ctx := context.Background()
+	logger := slog.Default()
+	dir := t.TempDir()
+
+	d, err := New(ctx, filepath.Join(dir, "wgpilot.db"), logger, true)
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer d.Close()
+	if err := Migrate(ctx, d, logger); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+
+	netID, err := d.CreateNetwork(ctx, testNetwork())
+	if err != nil {
+		t.Fatalf("create network: %v", err)
+	}
+	peerID, err := d.CreatePeer(ctx, testPeer(netID))
+	if err != nil {
+		t.Fatalf("create peer: %v", err)
+	}
+	now := time.Now().Truncate(time.Second)
+	if _, err := d.ExecContext(ctx, `
+		INSERT INTO peer_snapshots (peer_id, timestamp, rx_bytes, tx_bytes, rx_delta, tx_delta, online)
+		VALUES (?, ?, 1000, 2000, 1000, 2000, 1)`, peerID, now.Unix()); err != nil {
+		t.Fatalf("insert legacy snapshot: %v", err)
+	}
+	if _, err := d.ExecContext(ctx, `
+		INSERT INTO peer_traffic (peer_id, last_rx, last_tx, lifetime_rx, lifetime_tx, updated_at)
+		VALUES (?, 1000, 2000, 5000, 6000, ?)`, peerID, now.Unix()); err != nil {
+		t.Fatalf("insert legacy traffic: %v", err)
+	}
+
+	ts, err := NewTimeSeries(ctx, filepath.Join(dir, "wgpilot-timeseries.db"), logger, true)
+	if err != nil {
+		t.Fatalf("open time series: %v", err)
+	}
+	defer ts.Close()
+
+	if err := MigrateTimeSeries(ctx, d, ts, logger); err != nil {
+		t.Fatalf("migrate time series: %v", err)
+	}
+
+	snapshots, err := ts.ListSnapshots(ctx, peerID, now.Add(-time.Minute), now.Add(time.Minute))
+	if err != nil {
+		t.Fatalf("list snapshots: %v", err)
+	}
+	if len(snapshots) != 1 || snapshots[0].RxDelta != 1000 {
+		t.Errorf("expected moved snapshot, got %+v", snapshots)
+	}
+	traffic, err := ts.GetPeerTraffic(ctx, peerID)
+	if err != nil {
+		t.Fatalf("get traffic: %v", err)
+	}
+	if traffic == nil || traffic.LifetimeRx != 5000 {
+		t.Errorf("expected moved traffic totals, got %+v", traffic)
+	}
+
+	var n int
+	if err := d.QueryRowContext(ctx,
+		"SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name LIKE 'peer_snapshots%'",
+	).Scan(&n); err != nil {
+		t.Fatalf("check main tables: %v", err)
+	}
+	if n != 0 {
+		t.Errorf("expected snapshot tables dropped from main database, %d left", n)
+	}
+
+	// Running again is a no-op.
+	if err := MigrateTimeSeries(ctx, d, ts, logger); err != nil {
+		t.Fatalf("migrate time series again: %v", err)
+	}
+}
+
+// legacySnapshotDB returns a migrated main database holding snapshots of one
+// peer, hourly from day, that were taken before migration 005 added traffic
+// deltas.
+func legacySnapshotDB(t *testing.T, day time.Time, counters []struct{ rx, tx int64 }) (*DB, int64) {
+	t.Helper()
+	ctx := context.Background()
+	logger := slog.Default()
+
+	d, err := New(ctx, filepath.Join(t.TempDir(), "wgpilot.db"), logger, true)
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { d.Close() })
+	if err := Migrate(ctx, d, logger); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	netID, err := d.CreateNetwork(ctx, testNetwork())
+	if err != nil {
+		t.Fatalf("create network: %v", err)
+	}
+	peerID, err := d.CreatePeer(ctx, testPeer(netID))
+	if err != nil {
+		t.Fatalf("create peer: %v", err)
+	}
+
+	// Roll the schema back to before 005, with snapshots taken back then.
+	if _, err := d.ExecContext(ctx, `
+		DROP TABLE peer_traffic_daily;
+		DROP TABLE peer_traffic;
+		ALTER TABLE peer_snapshots DROP COLUMN rx_delta;
+		ALTER TABLE peer_snapshots DROP COLUMN tx_delta;
+		DELETE FROM _migrations WHERE filename = '005_traffic_counters.sql';`,
+	); err != nil {
+		t.Fatalf("roll back 005: %v", err)
+	}
+	for i, c := range counters {
+		if _, err := d.ExecContext(ctx, `
+			INSERT INTO peer_snapshots (peer_id, timestamp, rx_bytes, tx_bytes, online)
+			VALUES (?, ?, ?, ?, 1)`, peerID, day.Add(time.Duration(i)*time.Hour).Unix(), c.rx, c.tx); err != nil {
+			t.Fatalf("insert legacy snapshot: %v", err)
+		}
+	}
+
+	if err := Migrate(ctx, d, logger); err != nil {
+		t.Fatalf("migrate again: %v", err)
+	}
+	return d, peerID
+}
+
+func TestMigrate_BackfillsTrafficDeltas(t *testing.T) {
+	ctx := context.Background()
+	day := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	d, peerID := legacySnapshotDB(t, day, []struct{ rx, tx int64 }{
+		{1000, 5000}, // history starts here: no baseline
+		{1600, 5300},
+		{200, 100}, // counter reset
+		{700, 400},
+	})
+
+	rows, err := d.QueryContext(ctx, "SELECT rx_delta, tx_delta FROM peer_snapshots WHERE peer_id = ? ORDER BY timestamp", peerID)
+	if err != nil {
+		t.Fatalf("query deltas: %v", err)
+	}
+	defer rows.Close()
+	want := []struct{ rx, tx int64 }{{0, 0}, {600, 300}, {200, 100}, {500, 300}}
+	for i := 0; rows.Next(); i++ {
+		var rx, tx int64
+		if err := rows.Scan(&rx, &tx); err != nil {
+			t.Fatalf("scan: %v", err)
+		}
+		if rx != want[i].rx || tx != want[i].tx {
+			t.Errorf("snapshot %d: expected delta %d/%d, got %d/%d", i, want[i].rx, want[i].tx, rx, tx)
+		}
+	}
+
+	var lastRx, lifetimeRx, dailyRx int64
+	if err := d.QueryRowContext(ctx, "SELECT last_rx, lifetime_rx FROM peer_traffic WHERE peer_id = ?", peerID).Scan(&lastRx, &lifetimeRx); err != nil {
+		t.Fatalf("query traffic: %v", err)
+	}
+	if lastRx != 700 || lifetimeRx != 1300 {
+		t.Errorf("expected baseline 700 and lifetime 1300, got %d and %d", lastRx, lifetimeRx)
+	}
+	if err := d.QueryRowContext(ctx, "SELECT rx_bytes FROM peer_traffic_daily WHERE peer_id = ? AND day = ?", peerID, day.Unix()).Scan(&dailyRx); err != nil {
+		t.Fatalf("query daily traffic: %v", err)
+	}
+	if dailyRx != 1300 {
+		t.Errorf("expected 1300 bytes on the day, got %d", dailyRx)
+	}
+}
+
+// benchmarkPeers is the number of peers written per simulated poll cycle.
+const benchmarkPeers = 2000
+
+func benchmarkTimeSeries(b *testing.B) *TimeSeries {
+	b.Helper()
+	ts, err := NewTimeSeries(context.Background(), filepath.Join(b.TempDir(), "ts.db"), slog.New(slog.DiscardHandler), false)
+	if err != nil {
+		b.Fatalf("open time series: %v", err)
+	}
+	b.Cleanup(func() { ts.Close() })
+	return ts
+}
+
+func benchmarkCycle(cycle int) []PeerSnapshot {
+	at := time.Unix(1_700_000_000+int64(cycle)*30, 0)
+	batch := make([]PeerSnapshot, benchmarkPeers)
+	for i := range batch {
+		batch[i] = PeerSnapshot{
+			PeerID:    int64(i + 1),
+			Timestamp: at,
+			RxBytes:   int64(cycle) * 1000,
+			TxBytes:   int64(cycle) * 2000,
+			RxDelta:   1000,
+			TxDelta:   2000,
+			Online:    true,
+		}
+	}
+	return batch
+}
+
+// BenchmarkInsertSnapshot_PerPeer writes one poll cycle with a transaction
+// per peer, as the poller did before batching.
+func BenchmarkInsertSnapshot_PerPeer(b *testing.B) {
+	ts := benchmarkTimeSeries(b)
+	ctx := context.Background()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		batch := benchmarkCycle(i)
+		for j := range batch {
+			if err := ts.InsertSnapshot(ctx, &batch[j]); err != nil {
+				b.Fatalf("insert: %v", err)
+			}
+		}
+	}
+	b.ReportMetric(float64(b.N*benchmarkPeers)/b.Elapsed().Seconds(), "snapshots/s")
+}
+
+// BenchmarkInsertSnapshots_Batched writes one poll cycle in a single transaction.
+func BenchmarkInsertSnapshots_Batched(b *testing.B) {
+	ts := benchmarkTimeSeries(b)
+	ctx := context.Background()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := ts.InsertSnapshots(ctx, benchmarkCycle(i)); err != nil {
+			b.Fatalf("insert batch: %v", err)
+		}
+	}
+	b.ReportMetric(float64(b.N*benchmarkPeers)/b.Elapsed().Seconds(), "snapshots/s")
+}
@@ -0,0 +1,86 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// PeerTraffic represents a row in the peer_traffic table: the last raw
+// kernel counters seen for a peer and its monotonic lifetime totals.
+type PeerTraffic struct {
+	PeerID     int64
+	LastRx     int64
+	LastTx     int64
+	LifetimeRx int64
+	LifetimeTx int64
+	UpdatedAt  time.Time
+}
+
+// trafficDay returns the unix timestamp of 00:00 UTC on t's day.
+func trafficDay(t time.Time) int64 {
+	y, m, d := t.UTC().Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC).Unix()
+}
+
+// GetPeerTraffic returns the traffic counters for a peer, or nil if the
+// peer has never been polled.
+func (ts *TimeSeries) GetPeerTraffic(ctx context.Context, peerID int64) (*PeerTraffic, error) {
+	t := &PeerTraffic{}
+	var updatedAt int64
+	err := ts.db.QueryRowContext(ctx, `
+		SELECT peer_id, last_rx, last_tx, lifetime_rx, lifetime_tx, updated_at
+		FROM peer_traffic WHERE peer_id = ?`, peerID,
+	).Scan(&t.PeerID, &t.LastRx, &t.LastTx, &t.LifetimeRx, &t.LifetimeTx, &updatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("db: get traffic for peer %d: %w", peerID, err)
+	}
+	t.UpdatedAt = time.Unix(updatedAt, 0)
+	return t, nil
+}
+
+// ListPeerTraffic returns traffic counters for all polled peers, keyed by
+// peer ID.
+func (ts *TimeSeries) ListPeerTraffic(ctx context.Context) (map[int64]PeerTraffic, error) {
+	rows, err := ts.db.QueryContext(ctx, `
+		SELECT peer_id, last_rx, last_tx, lifetime_rx, lifetime_tx, updated_at
+		FROM peer_traffic`,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("db: list peer traffic: %w", err)
+	}
+	defer rows.Close()
+
+	result := make(map[int64]PeerTraffic)
+	for rows.Next() {
+		var t PeerTraffic
+		var updatedAt int64
+		if err := rows.Scan(&t.PeerID, &t.LastRx, &t.LastTx, &t.LifetimeRx, &t.LifetimeTx, &updatedAt); err != nil {
+			return nil, fmt.Errorf("db: scan peer traffic: %w", err)
+		}
+		t.UpdatedAt = time.Unix(updatedAt, 0)
+		result[t.PeerID] = t
+	}
+	return result, rows.Err()
+}
+
+// PeerUsageSince returns the bytes received and transmitted by a peer from
+// the start of since's UTC day onwards, summed from the daily totals. Daily
+// totals are never compacted, so usage is available for any period.
+func (ts *TimeSeries) PeerUsageSince(ctx context.Context, peerID int64, since time.Time) (rx, tx int64, err error) {
+	err = ts.db.QueryRowContext(ctx, `
+		SELECT COALESCE(SUM(rx_bytes), 0), COALESCE(SUM(tx_bytes), 0)
+		FROM peer_traffic_daily
+		WHERE peer_id = ? AND day >= ?`,
+		peerID, trafficDay(since),
+	).Scan(&rx, &tx)
+	if err != nil {
+		return 0, 0, fmt.Errorf("db: peer %d usage since %d: %w", peerID, since.Unix(), err)
+	}
+	return rx, tx, nil
+}
@@ -0,0 +1,149 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestTraffic_LifetimeAndDaily(t *testing.T) {
+	ts := testTimeSeries(t)
+	ctx := context.Background()
+	peerID := int64(1)
+
+	got, err := ts.GetPeerTraffic(ctx, peerID)
+	if err != nil {
+		t.Fatalf("get traffic: %v", err)
+	}
+	if got != nil {
+		t.Fatal("expected nil traffic for a peer that was never polled")
+	}
+
+	day1 := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	day2 := day1.Add(24 * time.Hour)
+	points := []struct {
+		ts               time.Time
+		rx, tx           int64
+		rxDelta, txDelta int64
+	}{
+		{day1.Add(time.Hour), 500, 1000, 500, 1000},
+		{day1.Add(2 * time.Hour), 700, 1500, 200, 500},
+		{day2.Add(time.Hour), 100, 50, 100, 50}, // counter reset
+		{day2.Add(2 * time.Hour), 400, 250, 300, 200},
+	}
+	for _, pt := range points {
+		s := testSnapshot(peerID, pt.ts)
+		s.RxBytes, s.TxBytes = pt.rx, pt.tx
+		s.RxDelta, s.TxDelta = pt.rxDelta, pt.txDelta
+		if err := ts.InsertSnapshot(ctx, s); err != nil {
+			t.Fatalf("insert snapshot: %v", err)
+		}
+	}
+
+	got, err = ts.GetPeerTraffic(ctx, peerID)
+	if err != nil {
+		t.Fatalf("get traffic: %v", err)
+	}
+	if got.LastRx != 400 || got.LastTx != 250 {
+		t.Errorf("expected last counters 400/250, got %d/%d", got.LastRx, got.LastTx)
+	}
+	if got.LifetimeRx != 1100 || got.LifetimeTx != 1750 {
+		t.Errorf("expected lifetime 1100/1750, got %d/%d", got.LifetimeRx, got.LifetimeTx)
+	}
+
+	rx, tx, err := ts.PeerUsageSince(ctx, peerID, day1)
+	if err != nil {
+		t.Fatalf("usage: %v", err)
+	}
+	if rx != 1100 || tx != 1750 {
+		t.Errorf("expected usage 1100/1750 since day 1, got %d/%d", rx, tx)
+	}
+
+	// Usage is counted per UTC day, so any time on day 2 covers all of it.
+	rx, tx, err = ts.PeerUsageSince(ctx, peerID, day2.Add(12*time.Hour))
+	if err != nil {
+		t.Fatalf("usage: %v", err)
+	}
+	if rx != 400 || tx != 250 {
+		t.Errorf("expected usage 400/250 since day 2, got %d/%d", rx, tx)
+	}
+
+	rx, tx, err = ts.PeerUsageSince(ctx, peerID, day2.Add(24*time.Hour))
+	if err != nil {
+		t.Fatalf("usage: %v", err)
+	}
+	if rx != 0 || tx != 0 {
+		t.Errorf("expected zero usage, got rx=%d tx=%d", rx, tx)
+	}
+}
+
+func TestTraffic_ListAndDeletePeer(t *testing.T) {
+	ts := testTimeSeries(t)
+	ctx := context.Background()
+
+	for _, peerID := range []int64{1, 2} {
+		s := testSnapshot(peerID, time.Now())
+		s.RxDelta, s.TxDelta = s.RxBytes, s.TxBytes
+		if err := ts.InsertSnapshot(ctx, s); err != nil {
+			t.Fatalf("insert snapshot: %v", err)
+		}
+	}
+
+	traffic, err := ts.ListPeerTraffic(ctx)
+	if err != nil {
+		t.Fatalf("list traffic: %v", err)
+	}
+	if len(traffic) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(traffic))
+	}
+	if got := traffic[1]; got.LifetimeRx != 1000 || got.LifetimeTx != 2000 {
+		t.Errorf("unexpected lifetime totals: %+v", got)
+	}
+
+	if err := ts.DeletePeer(ctx, 1); err != nil {
+		t.Fatalf("delete peer: %v", err)
+	}
+	traffic, err = ts.ListPeerTraffic(ctx)
+	if err != nil {
+		t.Fatalf("list traffic: %v", err)
+	}
+	if _, ok := traffic[1]; ok || len(traffic) != 1 {
+		t.Errorf("expected only peer 2 left, got %+v", traffic)
+	}
+	snapshots, err := ts.ListSnapshots(ctx, 1, time.Now().Add(-time.Hour), time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("list snapshots: %v", err)
+	}
+	if len(snapshots) != 0 {
+		t.Errorf("expected snapshots removed with the peer, got %d", len(snapshots))
+	}
+}
+
+func TestSnapshots_GetLastBefore(t *testing.T) {
+	ts := testTimeSeries(t)
+	ctx := context.Background()
+	peerID := int64(1)
+
+	base := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	got, err := ts.GetLastSnapshotBefore(ctx, peerID, base)
+	if err != nil {
+		t.Fatalf("get last snapshot: %v", err)
+	}
+	if got != nil {
+		t.Fatal("expected nil when no snapshots exist")
+	}
+
+	for i := 0; i < 3; i++ {
+		if err := ts.InsertSnapshot(ctx, testSnapshot(peerID, base.Add(time.Duration(i)*time.Minute))); err != nil {
+			t.Fatalf("insert snapshot: %v", err)
+		}
+	}
+
+	got, err = ts.GetLastSnapshotBefore(ctx, peerID, base.Add(2*time.Minute))
+	if err != nil {
+		t.Fatalf("get last snapshot: %v", err)
+	}
+	if got == nil || !got.Timestamp.Equal(base.Add(time.Minute)) {
+		t.Errorf("expected snapshot at +1m, got %+v", got)
+	}
+}
@@ -0,0 +1,183 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// UserTOTP is a user's TOTP enrollment state.
+type UserTOTP struct {
+	Secret   string // base32, decrypted; empty if never enrolled
+	Enabled  bool   // false while enrollment is pending confirmation
+	LastStep int64  // time step of the last accepted code
+}
+
+// GetUserTOTP returns the TOTP state of a user.
+// Returns nil, nil if the user does not exist.
+func (d *DB) GetUserTOTP(ctx context.Context, userID int64) (*UserTOTP, error) {
+	t := &UserTOTP{}
+	err := d.QueryRowContext(ctx, `
+		SELECT totp_secret, totp_enabled, totp_last_step
+		FROM users WHERE id = ?`, userID,
+	).Scan(&t.Secret, &t.Enabled, &t.LastStep)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("db: get user %d totp: %w", userID, err)
+	}
+	if t.Secret != "" {
+		secret, err := d.decryptSecret(t.Secret)
+		if err != nil {
+			return nil, fmt.Errorf("db: decrypt user %d totp secret: %w", userID, err)
+		}
+		t.Secret = secret
+	}
+	return t, nil
+}
+
+// SetUserTOTPSecret starts (or restarts) TOTP enrollment with a new secret.
+// The second factor stays disabled until EnableUserTOTP confirms it.
+func (d *DB) SetUserTOTPSecret(ctx context.Context, userID int64, secret string) error {
+	enc, err := d.encryptSecret(secret)
+	if err != nil {
+		return fmt.Errorf("db: encrypt user %d totp secret: %w", userID, err)
+	}
+	_, err = d.ExecContext(ctx, `
+		UPDATE users SET totp_secret = ?, totp_enabled = 0, totp_last_step = 0, updated_at = unixepoch()
+		WHERE id = ?`, enc, userID,
+	)
+	if err != nil {
+		return fmt.Errorf("db: set user %d totp secret: %w", userID, err)
+	}
+	return nil
+}
+
+// EnableUserTOTP turns on the second factor after the user confirmed a code
+// from step, and replaces their recovery codes with codeHashes.
+func (d *DB) EnableUserTOTP(ctx context.Context, userID, step int64, codeHashes []string) error {
+	tx, err := d.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("db: begin enable user %d totp: %w", userID, err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE users SET totp_enabled = 1, totp_last_step = ?, updated_at = unixepoch()
+		WHERE id = ? AND totp_secret != ''`, step, userID,
+	); err != nil {
+		return fmt.Errorf("db: enable user %d totp: %w", userID, err)
+	}
+	if err := replaceRecoveryCodes(ctx, tx, userID, codeHashes); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("db: commit enable user %d totp: %w", userID, err)
+	}
+	return nil
+}
+
+// DisableUserTOTP removes a user's TOTP secret and recovery codes.
+func (d *DB) DisableUserTOTP(ctx context.Context, userID int64) error {
+	tx, err := d.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("db: begin disable user %d totp: %w", userID, err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE users SET totp_secret = '', totp_enabled = 0, totp_last_step = 0, updated_at = unixepoch()
+		WHERE id = ?`, userID,
+	); err != nil {
+		return fmt.Errorf("db: disable user %d totp: %w", userID, err)
+	}
+	if err := replaceRecoveryCodes(ctx, tx, userID, nil); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("db: commit disable user %d totp: %w", userID, err)
+	}
+	return nil
+}
+
+// UseTOTPStep records that a code from step was accepted. It returns false
+// if a code from that step or a later one was already used, so each code
+// works only once.
+func (d *DB) UseTOTPStep(ctx context.Context, userID, step int64) (bool, error) {
+	result, err := d.ExecContext(ctx, `
+		UPDATE users SET totp_last_step = ?
+		WHERE id = ? AND totp_last_step < ?`, step, userID, step,
+	)
+	if err != nil {
+		return false, fmt.Errorf("db: use user %d totp step: %w", userID, err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("db: use user %d totp step rows affected: %w", userID, err)
+	}
+	return n > 0, nil
+}
+
+// ReplaceRecoveryCodes discards a user's recovery codes and stores
+// codeHashes instead.
+func (d *DB) ReplaceRecoveryCodes(ctx context.Context, userID int64, codeHashes []string) error {
+	tx, err := d.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("db: begin replace user %d recovery codes: %w", userID, err)
+	}
+	defer tx.Rollback()
+
+	if err := replaceRecoveryCodes(ctx, tx, userID, codeHashes); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("db: commit replace user %d recovery codes: %w", userID, err)
+	}
+	return nil
+}
+
+func replaceRecoveryCodes(ctx context.Context, tx *Tx, userID int64, codeHashes []string) error {
+	if _, err := tx.ExecContext(ctx, "DELETE FROM user_recovery_codes WHERE user_id = ?", userID); err != nil {
+		return fmt.Errorf("db: delete user %d recovery codes: %w", userID, err)
+	}
+	for _, h := range codeHashes {
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO user_recovery_codes (user_id, code_hash) VALUES (?, ?)`, userID, h,
+		); err != nil {
+			return fmt.Errorf("db: insert user %d recovery code: %w", userID, err)
+		}
+	}
+	return nil
+}
+
+// UseRecoveryCode marks the unused recovery code with codeHash as used.
+// It returns false if the user has no such unused code.
+func (d *DB) UseRecoveryCode(ctx context.Context, userID int64, codeHash string) (bool, error) {
+	result, err := d.ExecContext(ctx, `
+		UPDATE user_recovery_codes SET used_at = unixepoch()
+		WHERE user_id = ? AND code_hash = ? AND used_at IS NULL`, userID, codeHash,
+	)
+	if err != nil {
+		return false, fmt.Errorf("db: use user %d recovery code: %w", userID, err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("db: use user %d recovery code rows affected: %w", userID, err)
+	}
+	return n > 0, nil
+}
+
+// CountRecoveryCodes returns the number of unused recovery codes a user has.
+func (d *DB) CountRecoveryCodes(ctx context.Context, userID int64) (int, error) {
+	var n int
+	err := d.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM user_recovery_codes
+		WHERE user_id = ? AND used_at IS NULL`, userID,
+	).Scan(&n)
+	if err != nil {
+		return 0, fmt.Errorf("db: count user %d recovery codes: %w", userID, err)
+	}
+	return n, nil
+}
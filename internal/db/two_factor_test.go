@@ -0,0 +1,77 @@
+package db
+
+import (
+	"context"
+	"testing"
+)
+
+func TestUserTOTP_Lifecycle(t *testing.T) {
+	d := testDB(t)
+	d.SetEncryptionKey([32]byte{1, 2, 3})
+	ctx := context.Background()
+
+	id, err := d.CreateUser(ctx, &User{Username: "alice", PasswordHash: "x", Role: "admin"})
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+
+	if err := d.SetUserTOTPSecret(ctx, id, "JBSWY3DPEHPK3PXP"); err != nil {
+		t.Fatalf("SetUserTOTPSecret: %v", err)
+	}
+	var stored string
+	if err := d.QueryRowContext(ctx, "SELECT totp_secret FROM users WHERE id = ?", id).Scan(&stored); err != nil {
+		t.Fatalf("read secret: %v", err)
+	}
+	if stored == "JBSWY3DPEHPK3PXP" {
+		t.Error("expected TOTP secret to be encrypted at rest")
+	}
+
+	totp, err := d.GetUserTOTP(ctx, id)
+	if err != nil {
+		t.Fatalf("GetUserTOTP: %v", err)
+	}
+	if totp.Secret != "JBSWY3DPEHPK3PXP" || totp.Enabled {
+		t.Errorf("expected pending enrollment with decrypted secret, got %+v", totp)
+	}
+
+	if err := d.EnableUserTOTP(ctx, id, 100, []string{"h1", "h2"}); err != nil {
+		t.Fatalf("EnableUserTOTP: %v", err)
+	}
+	user, err := d.GetUserByID(ctx, id)
+	if err != nil {
+		t.Fatalf("GetUserByID: %v", err)
+	}
+	if !user.TOTPEnabled {
+		t.Error("expected TOTPEnabled after EnableUserTOTP")
+	}
+
+	// Codes from the confirmed step or earlier are replays.
+	if ok, _ := d.UseTOTPStep(ctx, id, 100); ok {
+		t.Error("expected step 100 to be rejected as already used")
+	}
+	if ok, _ := d.UseTOTPStep(ctx, id, 101); !ok {
+		t.Error("expected step 101 to be accepted")
+	}
+
+	// Recovery codes work once.
+	if ok, _ := d.UseRecoveryCode(ctx, id, "h1"); !ok {
+		t.Error("expected recovery code to be accepted")
+	}
+	if ok, _ := d.UseRecoveryCode(ctx, id, "h1"); ok {
+		t.Error("expected used recovery code to be rejected")
+	}
+	if n, _ := d.CountRecoveryCodes(ctx, id); n != 1 {
+		t.Errorf("expected 1 remaining recovery code, got %d", n)
+	}
+
+	if err := d.DisableUserTOTP(ctx, id); err != nil {
+		t.Fatalf("DisableUserTOTP: %v", err)
+	}
+	totp, _ = d.GetUserTOTP(ctx, id)
+	if totp.Secret != "" || totp.Enabled {
+		t.Errorf("expected TOTP cleared, got %+v", totp)
+	}
+	if n, _ := d.CountRecoveryCodes(ctx, id); n != 0 {
+		t.Errorf("expected recovery codes removed, got %d", n)
+	}
+}
@@ -0,0 +1,133 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// UserSession represents a row in the user_sessions table: one issued
+// session token, identified by its JWT ID.
+type UserSession struct {
+	ID         string // JWT ID of the session token
+	UserID     int64
+	CreatedAt  time.Time
+	LastSeenAt time.Time
+	ExpiresAt  time.Time
+	IP         string
+	UserAgent  string
+}
+
+const userSessionColumns = `id, user_id, created_at, last_seen_at, expires_at, ip, user_agent`
+
+// CreateUserSession records a newly issued session token. Expired sessions
+// are pruned at the same time.
+func (d *DB) CreateUserSession(ctx context.Context, s *UserSession) error {
+	if _, err := d.ExecContext(ctx, `
+		DELETE FROM user_sessions WHERE expires_at <= unixepoch()`,
+	); err != nil {
+		return fmt.Errorf("db: prune user sessions: %w", err)
+	}
+	_, err := d.ExecContext(ctx, `
+		INSERT INTO user_sessions (id, user_id, expires_at, ip, user_agent)
+		VALUES (?, ?, ?, ?, ?)`,
+		s.ID, s.UserID, s.ExpiresAt.Unix(), s.IP, s.UserAgent,
+	)
+	if err != nil {
+		return fmt.Errorf("db: create user session: %w", err)
+	}
+	return nil
+}
+
+// GetUserSession retrieves an unexpired session by ID.
+// Returns nil, nil if the session does not exist or has expired.
+func (d *DB) GetUserSession(ctx context.Context, id string) (*UserSession, error) {
+	s, err := scanUserSession(d.QueryRowContext(ctx, `
+		SELECT `+userSessionColumns+`
+		FROM user_sessions WHERE id = ? AND expires_at > unixepoch()`, id,
+	))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("db: get user session: %w", err)
+	}
+	return s, nil
+}
+
+// ListUserSessions returns a user's unexpired sessions, most recently used
+// first.
+func (d *DB) ListUserSessions(ctx context.Context, userID int64) ([]UserSession, error) {
+	rows, err := d.QueryContext(ctx, `
+		SELECT `+userSessionColumns+`
+		FROM user_sessions WHERE user_id = ? AND expires_at > unixepoch()
+		ORDER BY last_seen_at DESC, created_at DESC`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("db: list user %d sessions: %w", userID, err)
+	}
+	defer rows.Close()
+
+	var sessions []UserSession
+	for rows.Next() {
+		s, err := scanUserSession(rows)
+		if err != nil {
+			return nil, fmt.Errorf("db: scan user session: %w", err)
+		}
+		sessions = append(sessions, *s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("db: list user %d sessions rows: %w", userID, err)
+	}
+	return sessions, nil
+}
+
+// TouchUserSession records that a session was just used from ip with
+// userAgent.
+func (d *DB) TouchUserSession(ctx context.Context, id, ip, userAgent string) error {
+	_, err := d.ExecContext(ctx, `
+		UPDATE user_sessions SET last_seen_at = unixepoch(), ip = ?, user_agent = ?
+		WHERE id = ?`, ip, userAgent, id)
+	if err != nil {
+		return fmt.Errorf("db: touch user session: %w", err)
+	}
+	return nil
+}
+
+// DeleteUserSession revokes a single session.
+func (d *DB) DeleteUserSession(ctx context.Context, id string) error {
+	_, err := d.ExecContext(ctx, "DELETE FROM user_sessions WHERE id = ?", id)
+	if err != nil {
+		return fmt.Errorf("db: delete user session: %w", err)
+	}
+	return nil
+}
+
+// DeleteUserSessions revokes all of a user's sessions except keepID (which
+// may be empty) and returns the number revoked.
+func (d *DB) DeleteUserSessions(ctx context.Context, userID int64, keepID string) (int64, error) {
+	result, err := d.ExecContext(ctx, `
+		DELETE FROM user_sessions WHERE user_id = ? AND id != ?`, userID, keepID)
+	if err != nil {
+		return 0, fmt.Errorf("db: delete user %d sessions: %w", userID, err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("db: delete user %d sessions rows affected: %w", userID, err)
+	}
+	return n, nil
+}
+
+func scanUserSession(row interface{ Scan(...any) error }) (*UserSession, error) {
+	s := &UserSession{}
+	var createdAt, lastSeenAt, expiresAt int64
+	if err := row.Scan(&s.ID, &s.UserID, &createdAt, &lastSeenAt, &expiresAt,
+		&s.IP, &s.UserAgent); err != nil {
+		return nil, err
+	}
+	s.CreatedAt = time.Unix(createdAt, 0)
+	s.LastSeenAt = time.Unix(lastSeenAt, 0)
+	s.ExpiresAt = time.Unix(expiresAt, 0)
+	return s, nil
+}
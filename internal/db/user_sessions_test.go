@@ -0,0 +1,103 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestUserSessions_Lifecycle(t *testing.T) {
+	d := testDB(t)
+	ctx := context.Background()
+
+	userID, err := d.CreateUser(ctx, &User{Username: "alice", PasswordHash: "x", Role: "admin"})
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	expires := time.Now().Add(time.Hour)
+	for _, id := range []string{"s1", "s2", "s3"} {
+		if err := d.CreateUserSession(ctx, &UserSession{
+			ID: id, UserID: userID, ExpiresAt: expires, IP: "192.0.2.1", UserAgent: "curl",
+		}); err != nil {
+			t.Fatalf("CreateUserSession(%s): %v", id, err)
+		}
+	}
+
+	s, err := d.GetUserSession(ctx, "s1")
+	if err != nil {
+		t.Fatalf("GetUserSession: %v", err)
+	}
+	if s == nil || s.UserID != userID || s.IP != "192.0.2.1" || s.ExpiresAt.Unix() != expires.Unix() {
+		t.Fatalf("unexpected session %+v", s)
+	}
+
+	if err := d.TouchUserSession(ctx, "s1", "198.51.100.7", "firefox"); err != nil {
+		t.Fatalf("TouchUserSession: %v", err)
+	}
+	s, _ = d.GetUserSession(ctx, "s1")
+	if s.IP != "198.51.100.7" || s.UserAgent != "firefox" {
+		t.Errorf("touch not recorded: %+v", s)
+	}
+
+	if err := d.DeleteUserSession(ctx, "s2"); err != nil {
+		t.Fatalf("DeleteUserSession: %v", err)
+	}
+	if s, _ := d.GetUserSession(ctx, "s2"); s != nil {
+		t.Error("expected s2 to be revoked")
+	}
+
+	n, err := d.DeleteUserSessions(ctx, userID, "s1")
+	if err != nil {
+		t.Fatalf("DeleteUserSessions: %v", err)
+	}
+	if n != 1 {
+		t.Errorf("revoked %d sessions, want 1", n)
+	}
+	sessions, err := d.ListUserSessions(ctx, userID)
+	if err != nil {
+		t.Fatalf("ListUserSessions: %v", err)
+	}
+	if len(sessions) != 1 || sessions[0].ID != "s1" {
+		t.Errorf("expected only s1 to remain, got %+v", sessions)
+	}
+}
+
+func TestUserSessions_Expired(t *testing.T) {
+	d := testDB(t)
+	ctx := context.Background()
+
+	if err := d.CreateUserSession(ctx, &UserSession{ID: "old", UserID: 1, ExpiresAt: time.Now().Add(-time.Minute)}); err != nil {
+		t.Fatalf("CreateUserSession: %v", err)
+	}
+	if s, _ := d.GetUserSession(ctx, "old"); s != nil {
+		t.Error("expected an expired session not to be returned")
+	}
+	if sessions, _ := d.ListUserSessions(ctx, 1); len(sessions) != 0 {
+		t.Errorf("expected no sessions, got %d", len(sessions))
+	}
+
+	// Creating a session prunes expired ones.
+	if err := d.CreateUserSession(ctx, &UserSession{ID: "new", UserID: 1, ExpiresAt: time.Now().Add(time.Hour)}); err != nil {
+		t.Fatalf("CreateUserSession: %v", err)
+	}
+	var n int
+	d.QueryRowContext(ctx, "SELECT COUNT(*) FROM user_sessions").Scan(&n)
+	if n != 1 {
+		t.Errorf("expected the expired session to be pruned, %d rows left", n)
+	}
+}
+
+func TestDeleteUser_RevokesSessions(t *testing.T) {
+	d := testDB(t)
+	ctx := context.Background()
+
+	userID, _ := d.CreateUser(ctx, &User{Username: "alice", PasswordHash: "x", Role: "admin"})
+	d.CreateUserSession(ctx, &UserSession{ID: "s1", UserID: userID, ExpiresAt: time.Now().Add(time.Hour)})
+
+	if err := d.DeleteUser(ctx, userID); err != nil {
+		t.Fatalf("DeleteUser: %v", err)
+	}
+	if s, _ := d.GetUserSession(ctx, "s1"); s != nil {
+		t.Error("expected the session to be revoked with the user")
+	}
+}
@@ -14,16 +14,40 @@ type User struct {
 	Username     string
 	PasswordHash string
 	Role         string
-	CreatedAt    time.Time
-	UpdatedAt    time.Time
+	TOTPEnabled  bool
+	AuthSource   string // "local", or the identity provider that provisioned the user
+	ExternalID   string // the provider's stable ID for the user; empty for local users
+	Email        string // where password reset links are sent; may be empty
+
+	FailedLogins       int        // consecutive failed password logins
+	LockedUntil        *time.Time // set while the account is locked out
+	MustChangePassword bool       // a new password must be set on the next login
+
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// Locked reports whether the account is locked out at now.
+func (u *User) Locked(now time.Time) bool {
+	return u.LockedUntil != nil && now.Before(*u.LockedUntil)
 }
 
+// Authentication sources of a user account.
+const (
+	AuthSourceLocal = "local" // local password
+	AuthSourceOIDC  = "oidc"  // OpenID Connect single sign-on
+	AuthSourceLDAP  = "ldap"  // LDAP or Active Directory bind
+)
+
+const userColumns = `id, username, password_hash, role, totp_enabled, auth_source, external_id, email,
+		failed_logins, locked_until, must_change_password, created_at, updated_at`
+
 // CreateUser inserts a new user and returns its ID.
 func (d *DB) CreateUser(ctx context.Context, u *User) (int64, error) {
 	result, err := d.ExecContext(ctx, `
-		INSERT INTO users (username, password_hash, role)
-		VALUES (?, ?, ?)`,
-		u.Username, u.PasswordHash, u.Role,
+		INSERT INTO users (username, password_hash, role, auth_source, external_id, email, must_change_password)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		u.Username, u.PasswordHash, u.Role, authSource(u.AuthSource), u.ExternalID, u.Email, u.MustChangePassword,
 	)
 	if err != nil {
 		return 0, fmt.Errorf("db: create user %q: %w", u.Username, err)
@@ -38,31 +62,155 @@ func (d *DB) CreateUser(ctx context.Context, u *User) (int64, error) {
 // GetUserByUsername retrieves a user by username.
 // Returns nil, nil if the user does not exist.
 func (d *DB) GetUserByUsername(ctx context.Context, username string) (*User, error) {
-	u := &User{}
-	var createdAt, updatedAt int64
-	err := d.QueryRowContext(ctx, `
-		SELECT id, username, password_hash, role, created_at, updated_at
+	u, err := scanUser(d.QueryRowContext(ctx, `
+		SELECT `+userColumns+`
 		FROM users WHERE username = ?`, username,
-	).Scan(&u.ID, &u.Username, &u.PasswordHash, &u.Role, &createdAt, &updatedAt)
+	))
 	if errors.Is(err, sql.ErrNoRows) {
 		return nil, nil
 	}
 	if err != nil {
 		return nil, fmt.Errorf("db: get user by username %q: %w", username, err)
 	}
-	u.CreatedAt = time.Unix(createdAt, 0)
-	u.UpdatedAt = time.Unix(updatedAt, 0)
 	return u, nil
 }
 
-// UpdateUserPassword updates a user's password hash.
-func (d *DB) UpdateUserPassword(ctx context.Context, userID int64, passwordHash string) error {
-	_, err := d.ExecContext(ctx, `
-		UPDATE users SET password_hash = ?, updated_at = unixepoch()
+// UpdateUserPassword replaces a user's password hash and clears any pending
+// forced change. The previous hash is kept in the password history, which
+// is trimmed to the keepHistory most recent entries.
+func (d *DB) UpdateUserPassword(ctx context.Context, userID int64, passwordHash string, keepHistory int) error {
+	tx, err := d.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("db: begin update user %d password: %w", userID, err)
+	}
+	defer tx.Rollback()
+
+	if keepHistory > 0 {
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO password_history (user_id, password_hash)
+			SELECT id, password_hash FROM users WHERE id = ? AND password_hash != ''`, userID,
+		); err != nil {
+			return fmt.Errorf("db: record user %d password history: %w", userID, err)
+		}
+	}
+	if _, err := tx.ExecContext(ctx, `
+		DELETE FROM password_history
+		WHERE user_id = ? AND id NOT IN (
+			SELECT id FROM password_history WHERE user_id = ? ORDER BY id DESC LIMIT ?
+		)`, userID, userID, keepHistory,
+	); err != nil {
+		return fmt.Errorf("db: trim user %d password history: %w", userID, err)
+	}
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE users SET password_hash = ?, must_change_password = 0, updated_at = unixepoch()
 		WHERE id = ?`, passwordHash, userID,
+	); err != nil {
+		return fmt.Errorf("db: update user %d password: %w", userID, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("db: commit update user %d password: %w", userID, err)
+	}
+	return nil
+}
+
+// ListPasswordHistory returns up to limit of a user's previous password
+// hashes, newest first.
+func (d *DB) ListPasswordHistory(ctx context.Context, userID int64, limit int) ([]string, error) {
+	rows, err := d.QueryContext(ctx, `
+		SELECT password_hash FROM password_history
+		WHERE user_id = ? ORDER BY id DESC LIMIT ?`, userID, limit,
 	)
 	if err != nil {
-		return fmt.Errorf("db: update user %d password: %w", userID, err)
+		return nil, fmt.Errorf("db: list user %d password history: %w", userID, err)
+	}
+	defer rows.Close()
+
+	var hashes []string
+	for rows.Next() {
+		var h string
+		if err := rows.Scan(&h); err != nil {
+			return nil, fmt.Errorf("db: scan password history: %w", err)
+		}
+		hashes = append(hashes, h)
+	}
+	return hashes, rows.Err()
+}
+
+// RecordFailedLogin counts a failed password login. Once threshold
+// consecutive failures are reached the account is locked until lockFor
+// from now; a threshold of 0 never locks. Counting starts over after a
+// lockout has expired. It reports whether the account is now locked.
+func (d *DB) RecordFailedLogin(ctx context.Context, userID int64, threshold int, lockFor time.Duration) (bool, error) {
+	tx, err := d.BeginTx(ctx, nil)
+	if err != nil {
+		return false, fmt.Errorf("db: begin record user %d failed login: %w", userID, err)
+	}
+	defer tx.Rollback()
+
+	var failed int
+	var lockedUntil sql.NullInt64
+	now := time.Now().Unix()
+	err = tx.QueryRowContext(ctx, "SELECT failed_logins, locked_until FROM users WHERE id = ?", userID).
+		Scan(&failed, &lockedUntil)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("db: get user %d failed logins: %w", userID, err)
+	}
+	if lockedUntil.Valid && lockedUntil.Int64 <= now {
+		failed, lockedUntil = 0, sql.NullInt64{}
+	}
+	failed++
+	if threshold > 0 && failed >= threshold {
+		lockedUntil = sql.NullInt64{Int64: now + int64(lockFor.Seconds()), Valid: true}
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE users SET failed_logins = ?, locked_until = ?
+		WHERE id = ?`, failed, lockedUntil, userID,
+	); err != nil {
+		return false, fmt.Errorf("db: record user %d failed login: %w", userID, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("db: commit record user %d failed login: %w", userID, err)
+	}
+	return lockedUntil.Valid && lockedUntil.Int64 > now, nil
+}
+
+// UnlockUser clears a user's failed login count and any lockout.
+func (d *DB) UnlockUser(ctx context.Context, userID int64) error {
+	_, err := d.ExecContext(ctx, `
+		UPDATE users SET failed_logins = 0, locked_until = NULL
+		WHERE id = ?`, userID,
+	)
+	if err != nil {
+		return fmt.Errorf("db: unlock user %d: %w", userID, err)
+	}
+	return nil
+}
+
+// SetPasswordChangeRequired sets whether a user must choose a new password
+// on their next login.
+func (d *DB) SetPasswordChangeRequired(ctx context.Context, userID int64, required bool) error {
+	_, err := d.ExecContext(ctx, `
+		UPDATE users SET must_change_password = ?, updated_at = unixepoch()
+		WHERE id = ?`, required, userID,
+	)
+	if err != nil {
+		return fmt.Errorf("db: set user %d must change password: %w", userID, err)
+	}
+	return nil
+}
+
+// UpdateUserEmail changes a user's email address.
+func (d *DB) UpdateUserEmail(ctx context.Context, userID int64, email string) error {
+	_, err := d.ExecContext(ctx, `
+		UPDATE users SET email = ?, updated_at = unixepoch()
+		WHERE id = ?`, email, userID,
+	)
+	if err != nil {
+		return fmt.Errorf("db: update user %d email: %w", userID, err)
 	}
 	return nil
 }
@@ -70,7 +218,7 @@ func (d *DB) UpdateUserPassword(ctx context.Context, userID int64, passwordHash
 // ListUsers returns all users.
 func (d *DB) ListUsers(ctx context.Context) ([]User, error) {
 	rows, err := d.QueryContext(ctx, `
-		SELECT id, username, password_hash, role, created_at, updated_at
+		SELECT `+userColumns+`
 		FROM users ORDER BY id`)
 	if err != nil {
 		return nil, fmt.Errorf("db: list users: %w", err)
@@ -79,43 +227,100 @@ func (d *DB) ListUsers(ctx context.Context) ([]User, error) {
 
 	var users []User
 	for rows.Next() {
-		var u User
-		var createdAt, updatedAt int64
-		if err := rows.Scan(&u.ID, &u.Username, &u.PasswordHash, &u.Role, &createdAt, &updatedAt); err != nil {
+		u, err := scanUser(rows)
+		if err != nil {
 			return nil, fmt.Errorf("db: scan user: %w", err)
 		}
-		u.CreatedAt = time.Unix(createdAt, 0)
-		u.UpdatedAt = time.Unix(updatedAt, 0)
-		users = append(users, u)
+		users = append(users, *u)
 	}
 	return users, rows.Err()
 }
 
-// DeleteUser deletes a user by ID.
+// DeleteUser deletes a user by ID and revokes their sessions.
 func (d *DB) DeleteUser(ctx context.Context, id int64) error {
-	_, err := d.ExecContext(ctx, "DELETE FROM users WHERE id = ?", id)
+	tx, err := d.BeginTx(ctx, nil)
 	if err != nil {
+		return fmt.Errorf("db: begin delete user %d: %w", id, err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM user_sessions WHERE user_id = ?", id); err != nil {
+		return fmt.Errorf("db: delete user %d sessions: %w", id, err)
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM users WHERE id = ?", id); err != nil {
 		return fmt.Errorf("db: delete user %d: %w", id, err)
 	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("db: commit delete user %d: %w", id, err)
+	}
 	return nil
 }
 
 // GetUserByID retrieves a user by ID.
 // Returns nil, nil if the user does not exist.
 func (d *DB) GetUserByID(ctx context.Context, id int64) (*User, error) {
-	u := &User{}
-	var createdAt, updatedAt int64
-	err := d.QueryRowContext(ctx, `
-		SELECT id, username, password_hash, role, created_at, updated_at
+	u, err := scanUser(d.QueryRowContext(ctx, `
+		SELECT `+userColumns+`
 		FROM users WHERE id = ?`, id,
-	).Scan(&u.ID, &u.Username, &u.PasswordHash, &u.Role, &createdAt, &updatedAt)
+	))
 	if errors.Is(err, sql.ErrNoRows) {
 		return nil, nil
 	}
 	if err != nil {
 		return nil, fmt.Errorf("db: get user by id %d: %w", id, err)
 	}
+	return u, nil
+}
+
+// GetUserByExternalID retrieves a user provisioned by an identity provider.
+// Returns nil, nil if the user does not exist.
+func (d *DB) GetUserByExternalID(ctx context.Context, source, externalID string) (*User, error) {
+	u, err := scanUser(d.QueryRowContext(ctx, `
+		SELECT `+userColumns+`
+		FROM users WHERE auth_source = ? AND external_id = ?`, source, externalID,
+	))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("db: get %s user %q: %w", source, externalID, err)
+	}
+	return u, nil
+}
+
+// UpdateUserRole changes a user's role.
+func (d *DB) UpdateUserRole(ctx context.Context, userID int64, role string) error {
+	_, err := d.ExecContext(ctx, `
+		UPDATE users SET role = ?, updated_at = unixepoch()
+		WHERE id = ?`, role, userID,
+	)
+	if err != nil {
+		return fmt.Errorf("db: update user %d role: %w", userID, err)
+	}
+	return nil
+}
+
+func scanUser(row interface{ Scan(...any) error }) (*User, error) {
+	u := &User{}
+	var createdAt, updatedAt int64
+	var lockedUntil sql.NullInt64
+	if err := row.Scan(&u.ID, &u.Username, &u.PasswordHash, &u.Role, &u.TOTPEnabled,
+		&u.AuthSource, &u.ExternalID, &u.Email, &u.FailedLogins, &lockedUntil, &u.MustChangePassword,
+		&createdAt, &updatedAt); err != nil {
+		return nil, err
+	}
 	u.CreatedAt = time.Unix(createdAt, 0)
 	u.UpdatedAt = time.Unix(updatedAt, 0)
+	if lockedUntil.Valid {
+		t := time.Unix(lockedUntil.Int64, 0)
+		u.LockedUntil = &t
+	}
 	return u, nil
 }
+
+func authSource(s string) string {
+	if s == "" {
+		return AuthSourceLocal
+	}
+	return s
+}
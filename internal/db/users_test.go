@@ -3,6 +3,7 @@ package db
 import (
 	"context"
 	"testing"
+	"time"
 )
 
 func TestCreateUser(t *testing.T) {
@@ -113,3 +114,112 @@ func TestCreateUser_DuplicateUsername(t *testing.T) {
 		t.Error("expected error for duplicate username")
 	}
 }
+
+func TestGetUserByExternalID(t *testing.T) {
+	d := testDB(t)
+	ctx := context.Background()
+
+	id, err := d.CreateUser(ctx, &User{
+		Username:   "alice",
+		Role:       "viewer",
+		AuthSource: "oidc",
+		ExternalID: "https://idp.example.com#1234",
+	})
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+
+	user, err := d.GetUserByExternalID(ctx, "oidc", "https://idp.example.com#1234")
+	if err != nil {
+		t.Fatalf("GetUserByExternalID: %v", err)
+	}
+	if user == nil || user.ID != id || user.AuthSource != "oidc" {
+		t.Fatalf("unexpected user %+v", user)
+	}
+	if u, _ := d.GetUserByExternalID(ctx, "ldap", "https://idp.example.com#1234"); u != nil {
+		t.Error("expected lookup to be scoped to the auth source")
+	}
+
+	// External IDs are unique per source.
+	if _, err := d.CreateUser(ctx, &User{
+		Username: "alice2", Role: "viewer", AuthSource: "oidc", ExternalID: "https://idp.example.com#1234",
+	}); err == nil {
+		t.Error("expected duplicate external id to be rejected")
+	}
+
+	if err := d.UpdateUserRole(ctx, id, "admin"); err != nil {
+		t.Fatalf("UpdateUserRole: %v", err)
+	}
+	user, _ = d.GetUserByID(ctx, id)
+	if user.Role != "admin" {
+		t.Errorf("role = %q, want admin", user.Role)
+	}
+
+	local, _ := d.CreateUser(ctx, &User{Username: "bob", PasswordHash: "x", Role: "admin"})
+	if u, _ := d.GetUserByID(ctx, local); u.AuthSource != AuthSourceLocal {
+		t.Errorf("auth source = %q, want local", u.AuthSource)
+	}
+}
+
+func TestRecordFailedLogin_Lockout(t *testing.T) {
+	d := testDB(t)
+	ctx := context.Background()
+
+	id, err := d.CreateUser(ctx, &User{Username: "alice", PasswordHash: "$2a$12$fakehash", Role: "admin"})
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+
+	for i, want := range []bool{false, false, true} {
+		if locked, err := d.RecordFailedLogin(ctx, id, 3, time.Hour); err != nil || locked != want {
+			t.Errorf("failure %d = %v, %v; want %v", i+1, locked, err, want)
+		}
+	}
+	user, err := d.GetUserByID(ctx, id)
+	if err != nil {
+		t.Fatalf("GetUserByID: %v", err)
+	}
+	if user.FailedLogins != 3 || !user.Locked(time.Now()) || user.Locked(time.Now().Add(2*time.Hour)) {
+		t.Errorf("expected a locked account for an hour, got %+v", user)
+	}
+
+	if err := d.UnlockUser(ctx, id); err != nil {
+		t.Fatalf("UnlockUser: %v", err)
+	}
+	user, _ = d.GetUserByID(ctx, id)
+	if user.FailedLogins != 0 || user.LockedUntil != nil {
+		t.Errorf("expected the lockout cleared, got %+v", user)
+	}
+
+	// Without a threshold failures are counted but never lock.
+	if locked, err := d.RecordFailedLogin(ctx, id, 0, time.Hour); err != nil || locked {
+		t.Errorf("no threshold = %v, %v; want false", locked, err)
+	}
+}
+
+func TestUpdateUserPassword_History(t *testing.T) {
+	d := testDB(t)
+	ctx := context.Background()
+
+	id, err := d.CreateUser(ctx, &User{Username: "alice", PasswordHash: "hash-1", Role: "admin", MustChangePassword: true})
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	for _, h := range []string{"hash-2", "hash-3", "hash-4"} {
+		if err := d.UpdateUserPassword(ctx, id, h, 2); err != nil {
+			t.Fatalf("UpdateUserPassword: %v", err)
+		}
+	}
+
+	history, err := d.ListPasswordHistory(ctx, id, 10)
+	if err != nil {
+		t.Fatalf("ListPasswordHistory: %v", err)
+	}
+	if len(history) != 2 || history[0] != "hash-3" || history[1] != "hash-2" {
+		t.Errorf("expected the two previous hashes newest first, got %v", history)
+	}
+	user, _ := d.GetUserByID(ctx, id)
+	if user.PasswordHash != "hash-4" || user.MustChangePassword {
+		t.Errorf("expected the new hash and no pending change, got %+v", user)
+	}
+}
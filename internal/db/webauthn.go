@@ -0,0 +1,155 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// WebAuthnCredential represents a row in the webauthn_credentials table.
+type WebAuthnCredential struct {
+	ID           int64
+	UserID       int64
+	CredentialID []byte
+	PublicKey    []byte // COSE_Key
+	SignCount    uint32
+	AAGUID       []byte
+	Name         string
+	CreatedAt    time.Time
+	LastUsed     *time.Time
+}
+
+const webauthnColumns = `id, user_id, credential_id, public_key, sign_count, aaguid, name, created_at, last_used`
+
+// CreateWebAuthnCredential inserts a new credential and returns its ID.
+func (d *DB) CreateWebAuthnCredential(ctx context.Context, c *WebAuthnCredential) (int64, error) {
+	result, err := d.ExecContext(ctx, `
+		INSERT INTO webauthn_credentials (user_id, credential_id, public_key, sign_count, aaguid, name)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		c.UserID, c.CredentialID, c.PublicKey, c.SignCount, c.AAGUID, c.Name,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("db: create webauthn credential: %w", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("db: create webauthn credential last insert id: %w", err)
+	}
+	return id, nil
+}
+
+// GetWebAuthnCredential retrieves a credential by its authenticator-assigned
+// credential ID. Returns nil, nil if not found.
+func (d *DB) GetWebAuthnCredential(ctx context.Context, credentialID []byte) (*WebAuthnCredential, error) {
+	c, err := scanWebAuthnCredential(d.QueryRowContext(ctx, `
+		SELECT `+webauthnColumns+`
+		FROM webauthn_credentials WHERE credential_id = ?`, credentialID,
+	))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("db: get webauthn credential: %w", err)
+	}
+	return c, nil
+}
+
+// GetWebAuthnCredentialByID retrieves a credential by row ID.
+// Returns nil, nil if not found.
+func (d *DB) GetWebAuthnCredentialByID(ctx context.Context, id int64) (*WebAuthnCredential, error) {
+	c, err := scanWebAuthnCredential(d.QueryRowContext(ctx, `
+		SELECT `+webauthnColumns+`
+		FROM webauthn_credentials WHERE id = ?`, id,
+	))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("db: get webauthn credential %d: %w", id, err)
+	}
+	return c, nil
+}
+
+// ListWebAuthnCredentials returns a user's credentials, oldest first.
+func (d *DB) ListWebAuthnCredentials(ctx context.Context, userID int64) ([]WebAuthnCredential, error) {
+	rows, err := d.QueryContext(ctx, `
+		SELECT `+webauthnColumns+`
+		FROM webauthn_credentials WHERE user_id = ? ORDER BY id`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("db: list user %d webauthn credentials: %w", userID, err)
+	}
+	defer rows.Close()
+
+	var creds []WebAuthnCredential
+	for rows.Next() {
+		c, err := scanWebAuthnCredential(rows)
+		if err != nil {
+			return nil, fmt.Errorf("db: scan webauthn credential: %w", err)
+		}
+		creds = append(creds, *c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("db: list user %d webauthn credentials rows: %w", userID, err)
+	}
+	return creds, nil
+}
+
+// CountWebAuthnCredentials returns the number of credentials a user has.
+func (d *DB) CountWebAuthnCredentials(ctx context.Context, userID int64) (int, error) {
+	var n int
+	err := d.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM webauthn_credentials WHERE user_id = ?`, userID,
+	).Scan(&n)
+	if err != nil {
+		return 0, fmt.Errorf("db: count user %d webauthn credentials: %w", userID, err)
+	}
+	return n, nil
+}
+
+// UpdateWebAuthnCredentialUsage records a successful login with the
+// credential and its new signature counter.
+func (d *DB) UpdateWebAuthnCredentialUsage(ctx context.Context, id int64, signCount uint32) error {
+	_, err := d.ExecContext(ctx, `
+		UPDATE webauthn_credentials SET sign_count = ?, last_used = unixepoch()
+		WHERE id = ?`, signCount, id)
+	if err != nil {
+		return fmt.Errorf("db: update webauthn credential %d usage: %w", id, err)
+	}
+	return nil
+}
+
+// DeleteWebAuthnCredential deletes a credential by row ID.
+func (d *DB) DeleteWebAuthnCredential(ctx context.Context, id int64) error {
+	_, err := d.ExecContext(ctx, "DELETE FROM webauthn_credentials WHERE id = ?", id)
+	if err != nil {
+		return fmt.Errorf("db: delete webauthn credential %d: %w", id, err)
+	}
+	return nil
+}
+
+// DeleteUserWebAuthnCredentials deletes all of a user's credentials.
+func (d *DB) DeleteUserWebAuthnCredentials(ctx context.Context, userID int64) error {
+	_, err := d.ExecContext(ctx, "DELETE FROM webauthn_credentials WHERE user_id = ?", userID)
+	if err != nil {
+		return fmt.Errorf("db: delete user %d webauthn credentials: %w", userID, err)
+	}
+	return nil
+}
+
+func scanWebAuthnCredential(row interface{ Scan(...any) error }) (*WebAuthnCredential, error) {
+	c := &WebAuthnCredential{}
+	var createdAt int64
+	var lastUsed sql.NullInt64
+	if err := row.Scan(&c.ID, &c.UserID, &c.CredentialID, &c.PublicKey, &c.SignCount,
+		&c.AAGUID, &c.Name, &createdAt, &lastUsed); err != nil {
+		return nil, err
+	}
+	c.CreatedAt = time.Unix(createdAt, 0)
+	if lastUsed.Valid {
+		t := time.Unix(lastUsed.Int64, 0)
+		c.LastUsed = &t
+	}
+	return c, nil
+}
@@ -0,0 +1,89 @@
+package db
+
+import (
+	"bytes"
+	"context"
+	"testing"
+)
+
+func TestWebAuthnCredentials_Lifecycle(t *testing.T) {
+	d := testDB(t)
+	ctx := context.Background()
+
+	userID, err := d.CreateUser(ctx, &User{Username: "alice", PasswordHash: "x", Role: "admin"})
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+
+	id, err := d.CreateWebAuthnCredential(ctx, &WebAuthnCredential{
+		UserID:       userID,
+		CredentialID: []byte{1, 2, 3},
+		PublicKey:    []byte{0xa0},
+		SignCount:    5,
+		Name:         "yubikey",
+	})
+	if err != nil {
+		t.Fatalf("CreateWebAuthnCredential: %v", err)
+	}
+
+	// Credential IDs are globally unique.
+	if _, err := d.CreateWebAuthnCredential(ctx, &WebAuthnCredential{
+		UserID: userID, CredentialID: []byte{1, 2, 3}, PublicKey: []byte{0xa0},
+	}); err == nil {
+		t.Error("expected duplicate credential id to be rejected")
+	}
+
+	c, err := d.GetWebAuthnCredential(ctx, []byte{1, 2, 3})
+	if err != nil {
+		t.Fatalf("GetWebAuthnCredential: %v", err)
+	}
+	if c == nil || c.ID != id || c.UserID != userID || c.SignCount != 5 || c.Name != "yubikey" || c.LastUsed != nil {
+		t.Fatalf("unexpected credential: %+v", c)
+	}
+	if !bytes.Equal(c.PublicKey, []byte{0xa0}) {
+		t.Errorf("public key = %x, want a0", c.PublicKey)
+	}
+
+	if err := d.UpdateWebAuthnCredentialUsage(ctx, id, 9); err != nil {
+		t.Fatalf("UpdateWebAuthnCredentialUsage: %v", err)
+	}
+	c, _ = d.GetWebAuthnCredentialByID(ctx, id)
+	if c.SignCount != 9 || c.LastUsed == nil {
+		t.Errorf("expected updated usage, got %+v", c)
+	}
+
+	if n, _ := d.CountWebAuthnCredentials(ctx, userID); n != 1 {
+		t.Errorf("count = %d, want 1", n)
+	}
+	if creds, _ := d.ListWebAuthnCredentials(ctx, userID); len(creds) != 1 {
+		t.Errorf("list returned %d credentials, want 1", len(creds))
+	}
+
+	if err := d.DeleteUserWebAuthnCredentials(ctx, userID); err != nil {
+		t.Fatalf("DeleteUserWebAuthnCredentials: %v", err)
+	}
+	if c, _ := d.GetWebAuthnCredential(ctx, []byte{1, 2, 3}); c != nil {
+		t.Error("expected credential to be deleted")
+	}
+}
+
+func TestWebAuthnCredentials_DeletedWithUser(t *testing.T) {
+	d := testDB(t)
+	ctx := context.Background()
+
+	userID, err := d.CreateUser(ctx, &User{Username: "alice", PasswordHash: "x", Role: "admin"})
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	if _, err := d.CreateWebAuthnCredential(ctx, &WebAuthnCredential{
+		UserID: userID, CredentialID: []byte{9}, PublicKey: []byte{0xa0},
+	}); err != nil {
+		t.Fatalf("CreateWebAuthnCredential: %v", err)
+	}
+	if err := d.DeleteUser(ctx, userID); err != nil {
+		t.Fatalf("DeleteUser: %v", err)
+	}
+	if c, _ := d.GetWebAuthnCredential(ctx, []byte{9}); c != nil {
+		t.Error("expected credential to be deleted with its user")
+	}
+}
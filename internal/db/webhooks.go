@@ -0,0 +1,354 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/itsChris/wgpilot/internal/crypto"
+)
+
+// Webhook delivery states.
+const (
+	WebhookDeliveryPending   = "pending"
+	WebhookDeliveryDelivered = "delivered"
+	WebhookDeliveryFailed    = "failed" // out of attempts; can be redelivered
+)
+
+// Webhook represents a row in the webhooks table.
+type Webhook struct {
+	ID        int64
+	URL       string
+	Secret    string // HMAC signing key, decrypted
+	Events    string // comma-separated event filters; empty matches all
+	Enabled   bool
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// Matches reports whether the webhook subscribes to eventType. Filters are
+// event types ("peer.created"), resource wildcards ("peer.*") or "*".
+func (w *Webhook) Matches(eventType string) bool {
+	if strings.TrimSpace(w.Events) == "" {
+		return true
+	}
+	resource, _, _ := strings.Cut(eventType, ".")
+	for _, f := range strings.Split(w.Events, ",") {
+		f = strings.TrimSpace(f)
+		if f == "*" || f == eventType || f == resource+".*" {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookDelivery represents a row in the webhook_deliveries table.
+type WebhookDelivery struct {
+	ID            int64
+	WebhookID     int64
+	EventID       string
+	EventType     string
+	Payload       string
+	Status        string
+	Attempts      int
+	NextAttemptAt time.Time
+	LastStatus    int // HTTP status of the last attempt, 0 if none
+	LastError     string
+	CreatedAt     time.Time
+	DeliveredAt   time.Time // zero until delivered
+}
+
+// encryptSecret encrypts a stored secret, such as a webhook signing key or
+// a TOTP secret, if an encryption key is set.
+func (d *DB) encryptSecret(secret string) (string, error) {
+	if !d.encryptionKeySet {
+		return secret, nil
+	}
+	return crypto.Encrypt(secret, *d.encryptionKey)
+}
+
+// decryptSecret reverses encryptSecret.
+func (d *DB) decryptSecret(secret string) (string, error) {
+	if !d.encryptionKeySet {
+		return secret, nil
+	}
+	return crypto.Decrypt(secret, *d.encryptionKey)
+}
+
+// CreateWebhook inserts a new webhook and returns its ID. The secret is
+// encrypted at rest if an encryption key is set.
+func (d *DB) CreateWebhook(ctx context.Context, w *Webhook) (int64, error) {
+	secret, err := d.encryptSecret(w.Secret)
+	if err != nil {
+		return 0, fmt.Errorf("db: encrypt webhook secret: %w", err)
+	}
+	result, err := d.ExecContext(ctx, `
+		INSERT INTO webhooks (url, secret, events, enabled)
+		VALUES (?, ?, ?, ?)`,
+		w.URL, secret, w.Events, w.Enabled,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("db: create webhook: %w", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("db: create webhook last insert id: %w", err)
+	}
+	return id, nil
+}
+
+// GetWebhookByID retrieves a webhook by ID.
+// Returns nil, nil if not found.
+func (d *DB) GetWebhookByID(ctx context.Context, id int64) (*Webhook, error) {
+	row := d.QueryRowContext(ctx, `
+		SELECT id, url, secret, events, enabled, created_at, updated_at
+		FROM webhooks WHERE id = ?`, id)
+	w, err := d.scanWebhook(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("db: get webhook %d: %w", id, err)
+	}
+	return w, nil
+}
+
+// ListWebhooks returns all webhooks.
+func (d *DB) ListWebhooks(ctx context.Context) ([]Webhook, error) {
+	rows, err := d.QueryContext(ctx, `
+		SELECT id, url, secret, events, enabled, created_at, updated_at
+		FROM webhooks ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("db: list webhooks: %w", err)
+	}
+	defer rows.Close()
+
+	var webhooks []Webhook
+	for rows.Next() {
+		w, err := d.scanWebhook(rows)
+		if err != nil {
+			return nil, fmt.Errorf("db: scan webhook: %w", err)
+		}
+		webhooks = append(webhooks, *w)
+	}
+	return webhooks, rows.Err()
+}
+
+// UpdateWebhook updates a webhook's mutable fields.
+func (d *DB) UpdateWebhook(ctx context.Context, w *Webhook) error {
+	secret, err := d.encryptSecret(w.Secret)
+	if err != nil {
+		return fmt.Errorf("db: encrypt webhook %d secret: %w", w.ID, err)
+	}
+	_, err = d.ExecContext(ctx, `
+		UPDATE webhooks SET url = ?, secret = ?, events = ?, enabled = ?, updated_at = unixepoch()
+		WHERE id = ?`,
+		w.URL, secret, w.Events, w.Enabled, w.ID,
+	)
+	if err != nil {
+		return fmt.Errorf("db: update webhook %d: %w", w.ID, err)
+	}
+	return nil
+}
+
+// DeleteWebhook deletes a webhook and its queued deliveries.
+func (d *DB) DeleteWebhook(ctx context.Context, id int64) error {
+	_, err := d.ExecContext(ctx, "DELETE FROM webhooks WHERE id = ?", id)
+	if err != nil {
+		return fmt.Errorf("db: delete webhook %d: %w", id, err)
+	}
+	return nil
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func (d *DB) scanWebhook(row rowScanner) (*Webhook, error) {
+	w := &Webhook{}
+	var createdAt, updatedAt int64
+	if err := row.Scan(&w.ID, &w.URL, &w.Secret, &w.Events, &w.Enabled, &createdAt, &updatedAt); err != nil {
+		return nil, err
+	}
+	secret, err := d.decryptSecret(w.Secret)
+	if err != nil {
+		return nil, fmt.Errorf("decrypt webhook %d secret: %w", w.ID, err)
+	}
+	w.Secret = secret
+	w.CreatedAt = time.Unix(createdAt, 0)
+	w.UpdatedAt = time.Unix(updatedAt, 0)
+	return w, nil
+}
+
+// EnqueueWebhookEvent queues a delivery of payload to every enabled webhook
+// subscribed to eventType and returns the number queued. All deliveries share
+// eventID so receivers can discard duplicates.
+func (d *DB) EnqueueWebhookEvent(ctx context.Context, eventID, eventType, payload string) (int, error) {
+	webhooks, err := d.ListWebhooks(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := d.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("db: begin enqueue webhook event: %w", err)
+	}
+	defer tx.Rollback()
+
+	queued := 0
+	for _, w := range webhooks {
+		if !w.Enabled || !w.Matches(eventType) {
+			continue
+		}
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO webhook_deliveries (webhook_id, event_id, event_type, payload)
+			VALUES (?, ?, ?, ?)`,
+			w.ID, eventID, eventType, payload,
+		); err != nil {
+			return 0, fmt.Errorf("db: enqueue webhook %d delivery: %w", w.ID, err)
+		}
+		queued++
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("db: commit enqueue webhook event: %w", err)
+	}
+	return queued, nil
+}
+
+const webhookDeliveryColumns = `id, webhook_id, event_id, event_type, payload, status, attempts,
+		next_attempt_at, last_status, last_error, created_at, delivered_at`
+
+// GetWebhookDelivery retrieves a delivery by ID.
+// Returns nil, nil if not found.
+func (d *DB) GetWebhookDelivery(ctx context.Context, id int64) (*WebhookDelivery, error) {
+	row := d.QueryRowContext(ctx, `
+		SELECT `+webhookDeliveryColumns+`
+		FROM webhook_deliveries WHERE id = ?`, id)
+	del, err := scanWebhookDelivery(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("db: get webhook delivery %d: %w", id, err)
+	}
+	return del, nil
+}
+
+// ListWebhookDeliveries returns up to limit of a webhook's most recent
+// deliveries, newest first.
+func (d *DB) ListWebhookDeliveries(ctx context.Context, webhookID int64, limit int) ([]WebhookDelivery, error) {
+	return d.queryWebhookDeliveries(ctx, "list webhook deliveries", `
+		SELECT `+webhookDeliveryColumns+`
+		FROM webhook_deliveries WHERE webhook_id = ?
+		ORDER BY id DESC LIMIT ?`, webhookID, limit)
+}
+
+// ListDueWebhookDeliveries returns up to limit pending deliveries of enabled
+// webhooks whose next attempt is due at now, oldest first. Deliveries of a
+// disabled webhook wait until it is enabled again.
+func (d *DB) ListDueWebhookDeliveries(ctx context.Context, now time.Time, limit int) ([]WebhookDelivery, error) {
+	return d.queryWebhookDeliveries(ctx, "list due webhook deliveries", `
+		SELECT `+webhookDeliveryColumns+`
+		FROM webhook_deliveries
+		WHERE status = 'pending' AND next_attempt_at <= ?
+			AND webhook_id IN (SELECT id FROM webhooks WHERE enabled = 1)
+		ORDER BY id LIMIT ?`, now.Unix(), limit)
+}
+
+func (d *DB) queryWebhookDeliveries(ctx context.Context, op, query string, args ...any) ([]WebhookDelivery, error) {
+	rows, err := d.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("db: %s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var deliveries []WebhookDelivery
+	for rows.Next() {
+		del, err := scanWebhookDelivery(rows)
+		if err != nil {
+			return nil, fmt.Errorf("db: scan webhook delivery: %w", err)
+		}
+		deliveries = append(deliveries, *del)
+	}
+	return deliveries, rows.Err()
+}
+
+func scanWebhookDelivery(row rowScanner) (*WebhookDelivery, error) {
+	del := &WebhookDelivery{}
+	var nextAttemptAt, createdAt int64
+	var deliveredAt sql.NullInt64
+	if err := row.Scan(&del.ID, &del.WebhookID, &del.EventID, &del.EventType, &del.Payload,
+		&del.Status, &del.Attempts, &nextAttemptAt, &del.LastStatus, &del.LastError,
+		&createdAt, &deliveredAt); err != nil {
+		return nil, err
+	}
+	del.NextAttemptAt = time.Unix(nextAttemptAt, 0)
+	del.CreatedAt = time.Unix(createdAt, 0)
+	if deliveredAt.Valid {
+		del.DeliveredAt = time.Unix(deliveredAt.Int64, 0)
+	}
+	return del, nil
+}
+
+// MarkWebhookDelivered records a successful attempt.
+func (d *DB) MarkWebhookDelivered(ctx context.Context, id int64, statusCode int, at time.Time) error {
+	_, err := d.ExecContext(ctx, `
+		UPDATE webhook_deliveries
+		SET status = 'delivered', attempts = attempts + 1, last_status = ?, last_error = '', delivered_at = ?
+		WHERE id = ?`,
+		statusCode, at.Unix(), id,
+	)
+	if err != nil {
+		return fmt.Errorf("db: mark webhook delivery %d delivered: %w", id, err)
+	}
+	return nil
+}
+
+// MarkWebhookAttemptFailed records a failed attempt. The delivery is retried
+// at next, or marked failed if next is zero.
+func (d *DB) MarkWebhookAttemptFailed(ctx context.Context, id int64, statusCode int, errMsg string, next time.Time) error {
+	status, nextAt := WebhookDeliveryPending, next.Unix()
+	if next.IsZero() {
+		status, nextAt = WebhookDeliveryFailed, 0
+	}
+	_, err := d.ExecContext(ctx, `
+		UPDATE webhook_deliveries
+		SET status = ?, attempts = attempts + 1, last_status = ?, last_error = ?, next_attempt_at = ?
+		WHERE id = ?`,
+		status, statusCode, errMsg, nextAt, id,
+	)
+	if err != nil {
+		return fmt.Errorf("db: mark webhook delivery %d failed: %w", id, err)
+	}
+	return nil
+}
+
+// RedeliverWebhookDelivery queues a delivery again with a fresh set of
+// attempts, whatever its current state.
+func (d *DB) RedeliverWebhookDelivery(ctx context.Context, id int64, at time.Time) error {
+	_, err := d.ExecContext(ctx, `
+		UPDATE webhook_deliveries
+		SET status = 'pending', attempts = 0, next_attempt_at = ?, delivered_at = NULL
+		WHERE id = ?`,
+		at.Unix(), id,
+	)
+	if err != nil {
+		return fmt.Errorf("db: redeliver webhook delivery %d: %w", id, err)
+	}
+	return nil
+}
+
+// PruneWebhookDeliveries deletes delivered and failed deliveries created
+// before the given time. Pending deliveries are kept.
+func (d *DB) PruneWebhookDeliveries(ctx context.Context, before time.Time) (int64, error) {
+	result, err := d.ExecContext(ctx, `
+		DELETE FROM webhook_deliveries
+		WHERE status != 'pending' AND created_at < ?`, before.Unix())
+	if err != nil {
+		return 0, fmt.Errorf("db: prune webhook deliveries: %w", err)
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,154 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestWebhooks_CRUDEncryptsSecret(t *testing.T) {
+	d := testDB(t)
+	d.SetEncryptionKey([32]byte{1, 2, 3})
+	ctx := context.Background()
+
+	id, err := d.CreateWebhook(ctx, &Webhook{
+		URL: "https://cmdb.example.com/hook", Secret: "s3cret", Events: "peer.*", Enabled: true,
+	})
+	if err != nil {
+		t.Fatalf("create webhook: %v", err)
+	}
+
+	var stored string
+	if err := d.QueryRowContext(ctx, "SELECT secret FROM webhooks WHERE id = ?", id).Scan(&stored); err != nil {
+		t.Fatalf("read secret: %v", err)
+	}
+	if stored == "s3cret" {
+		t.Error("expected secret to be encrypted at rest")
+	}
+
+	w, err := d.GetWebhookByID(ctx, id)
+	if err != nil || w == nil {
+		t.Fatalf("get webhook: %v", err)
+	}
+	if w.Secret != "s3cret" || w.URL != "https://cmdb.example.com/hook" || !w.Enabled {
+		t.Errorf("unexpected webhook: %+v", w)
+	}
+
+	w.Events = "network.deleted"
+	w.Enabled = false
+	if err := d.UpdateWebhook(ctx, w); err != nil {
+		t.Fatalf("update webhook: %v", err)
+	}
+	list, err := d.ListWebhooks(ctx)
+	if err != nil {
+		t.Fatalf("list webhooks: %v", err)
+	}
+	if len(list) != 1 || list[0].Events != "network.deleted" || list[0].Enabled || list[0].Secret != "s3cret" {
+		t.Errorf("unexpected webhooks after update: %+v", list)
+	}
+
+	if err := d.DeleteWebhook(ctx, id); err != nil {
+		t.Fatalf("delete webhook: %v", err)
+	}
+	if w, _ := d.GetWebhookByID(ctx, id); w != nil {
+		t.Error("expected webhook to be deleted")
+	}
+}
+
+func TestWebhook_Matches(t *testing.T) {
+	tests := []struct {
+		events string
+		want   bool
+	}{
+		{"", true},
+		{"*", true},
+		{"peer.*", true},
+		{"network.*, peer.updated", true},
+		{"peer.created,peer.deleted", false},
+		{"network.*", false},
+	}
+	for _, tt := range tests {
+		w := &Webhook{Events: tt.events}
+		if got := w.Matches("peer.updated"); got != tt.want {
+			t.Errorf("Matches(%q) with events %q = %v, want %v", "peer.updated", tt.events, got, tt.want)
+		}
+	}
+}
+
+func TestWebhookDeliveries_Queue(t *testing.T) {
+	d := testDB(t)
+	ctx := context.Background()
+
+	peerHook, _ := d.CreateWebhook(ctx, &Webhook{URL: "https://a.example.com", Secret: "a", Events: "peer.*", Enabled: true})
+	d.CreateWebhook(ctx, &Webhook{URL: "https://b.example.com", Secret: "b", Events: "network.*", Enabled: true})
+	d.CreateWebhook(ctx, &Webhook{URL: "https://c.example.com", Secret: "c", Enabled: false})
+
+	n, err := d.EnqueueWebhookEvent(ctx, "evt_1", "peer.created", `{"type":"peer.created"}`)
+	if err != nil {
+		t.Fatalf("enqueue: %v", err)
+	}
+	if n != 1 {
+		t.Fatalf("expected 1 delivery for the subscribed, enabled webhook, got %d", n)
+	}
+
+	now := time.Now()
+	due, err := d.ListDueWebhookDeliveries(ctx, now, 10)
+	if err != nil {
+		t.Fatalf("list due: %v", err)
+	}
+	if len(due) != 1 || due[0].WebhookID != peerHook || due[0].EventID != "evt_1" || due[0].Status != WebhookDeliveryPending {
+		t.Fatalf("unexpected due deliveries: %+v", due)
+	}
+	id := due[0].ID
+
+	// A failed attempt is retried later.
+	if err := d.MarkWebhookAttemptFailed(ctx, id, 503, "service unavailable", now.Add(time.Minute)); err != nil {
+		t.Fatalf("mark failed: %v", err)
+	}
+	if due, _ := d.ListDueWebhookDeliveries(ctx, now, 10); len(due) != 0 {
+		t.Errorf("expected no due deliveries before the retry time, got %d", len(due))
+	}
+	if due, _ := d.ListDueWebhookDeliveries(ctx, now.Add(time.Minute), 10); len(due) != 1 || due[0].Attempts != 1 || due[0].LastStatus != 503 {
+		t.Errorf("expected retry after backoff, got %+v", due)
+	}
+
+	// Out of attempts.
+	if err := d.MarkWebhookAttemptFailed(ctx, id, 0, "connection refused", time.Time{}); err != nil {
+		t.Fatalf("mark failed: %v", err)
+	}
+	del, err := d.GetWebhookDelivery(ctx, id)
+	if err != nil || del == nil {
+		t.Fatalf("get delivery: %v", err)
+	}
+	if del.Status != WebhookDeliveryFailed || del.Attempts != 2 || del.LastError != "connection refused" {
+		t.Errorf("expected failed delivery, got %+v", del)
+	}
+
+	// Redelivery queues it again.
+	if err := d.RedeliverWebhookDelivery(ctx, id, now); err != nil {
+		t.Fatalf("redeliver: %v", err)
+	}
+	if err := d.MarkWebhookDelivered(ctx, id, 200, now); err != nil {
+		t.Fatalf("mark delivered: %v", err)
+	}
+	list, err := d.ListWebhookDeliveries(ctx, peerHook, 10)
+	if err != nil {
+		t.Fatalf("list deliveries: %v", err)
+	}
+	if len(list) != 1 || list[0].Status != WebhookDeliveryDelivered || list[0].Attempts != 1 || list[0].DeliveredAt.IsZero() {
+		t.Errorf("expected delivered after redelivery, got %+v", list)
+	}
+
+	// Finished deliveries are pruned, pending ones kept.
+	d.EnqueueWebhookEvent(ctx, "evt_2", "peer.deleted", `{}`)
+	pruned, err := d.PruneWebhookDeliveries(ctx, now.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("prune: %v", err)
+	}
+	if pruned != 1 {
+		t.Errorf("expected 1 pruned delivery, got %d", pruned)
+	}
+	if list, _ := d.ListWebhookDeliveries(ctx, peerHook, 10); len(list) != 1 || list[0].EventID != "evt_2" {
+		t.Errorf("expected pending delivery to remain, got %+v", list)
+	}
+}
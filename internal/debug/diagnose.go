@@ -264,7 +264,7 @@ func checkDatabase(path string) DBStats {
 	}
 
 	// Table row counts.
-	tables := []string{"networks", "peers", "peer_snapshots", "settings", "users", "audit_log", "alerts"}
+	tables := []string{"networks", "peers", "settings", "users", "audit_log", "alerts"}
 	for _, table := range tables {
 		var n int
 		if err := conn.QueryRowContext(ctx, "SELECT COUNT(*) FROM "+table).Scan(&n); err == nil {
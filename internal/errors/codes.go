@@ -11,22 +11,35 @@ const (
 	ErrPortInUse             = "PORT_IN_USE"
 
 	// Peer errors
-	ErrPeerNotFound      = "PEER_NOT_FOUND"
-	ErrPeerAlreadyExists = "PEER_ALREADY_EXISTS"
-	ErrPeerAddFailed     = "WG_PEER_ADD_FAILED"
-	ErrIPExhausted       = "IP_POOL_EXHAUSTED"
-	ErrInvalidAllowedIPs = "INVALID_ALLOWED_IPS"
+	ErrPeerNotFound          = "PEER_NOT_FOUND"
+	ErrPeerAlreadyExists     = "PEER_ALREADY_EXISTS"
+	ErrPeerAddFailed         = "WG_PEER_ADD_FAILED"
+	ErrIPExhausted           = "IP_POOL_EXHAUSTED"
+	ErrInvalidAllowedIPs     = "INVALID_ALLOWED_IPS"
+	ErrDeviceLimit           = "DEVICE_LIMIT_REACHED"
+	ErrPrivateKeyUnavailable = "PRIVATE_KEY_UNAVAILABLE"
 
 	// Auth errors
-	ErrForbidden          = "FORBIDDEN"
-	ErrUnauthorized       = "UNAUTHORIZED"
-	ErrSessionExpired     = "SESSION_EXPIRED"
-	ErrInvalidCredentials = "INVALID_CREDENTIALS"
-	ErrSetupComplete      = "SETUP_ALREADY_COMPLETE"
-	ErrSetupRequired      = "SETUP_REQUIRED"
-	ErrStepOrderViolation = "STEP_ORDER_VIOLATION"
-	ErrInvalidOTP         = "INVALID_OTP"
-	ErrRateLimited        = "RATE_LIMITED"
+	ErrForbidden              = "FORBIDDEN"
+	ErrUnauthorized           = "UNAUTHORIZED"
+	ErrSessionExpired         = "SESSION_EXPIRED"
+	ErrInvalidCredentials     = "INVALID_CREDENTIALS"
+	ErrSetupComplete          = "SETUP_ALREADY_COMPLETE"
+	ErrSetupRequired          = "SETUP_REQUIRED"
+	ErrStepOrderViolation     = "STEP_ORDER_VIOLATION"
+	ErrInvalidOTP             = "INVALID_OTP"
+	ErrRateLimited            = "RATE_LIMITED"
+	ErrInvalid2FACode         = "INVALID_2FA_CODE"
+	Err2FAAlreadyEnabled      = "2FA_ALREADY_ENABLED"
+	Err2FANotEnabled          = "2FA_NOT_ENABLED"
+	Err2FARequired            = "2FA_REQUIRED"
+	ErrWebAuthnFailed         = "WEBAUTHN_VERIFICATION_FAILED"
+	ErrCredentialNotFound     = "CREDENTIAL_NOT_FOUND"
+	ErrSSORequired            = "SSO_REQUIRED"
+	ErrSessionNotFound        = "SESSION_NOT_FOUND"
+	ErrPasswordChangeRequired = "PASSWORD_CHANGE_REQUIRED"
+	ErrWeakPassword           = "WEAK_PASSWORD"
+	ErrResetTokenInvalid      = "RESET_TOKEN_INVALID"
 
 	// System errors
 	ErrWGModuleNotLoaded   = "WG_MODULE_NOT_LOADED"
@@ -42,6 +55,23 @@ const (
 	// Alert errors
 	ErrAlertNotFound = "ALERT_NOT_FOUND"
 
+	// Webhook errors
+	ErrWebhookNotFound = "WEBHOOK_NOT_FOUND"
+
+	// Role errors
+	ErrRoleNotFound = "ROLE_NOT_FOUND"
+	ErrRoleInUse    = "ROLE_IN_USE"
+
+	// Invitation errors
+	ErrInvitationNotFound = "INVITATION_NOT_FOUND"
+
+	// Share link errors
+	ErrShareLinkNotFound = "SHARE_LINK_NOT_FOUND"
+
+	// Email errors
+	ErrSMTPNotConfigured = "SMTP_NOT_CONFIGURED"
+	ErrEmailSendFailed   = "EMAIL_SEND_FAILED"
+
 	// General
 	ErrValidation = "VALIDATION_ERROR"
 	ErrInternal   = "INTERNAL_ERROR"
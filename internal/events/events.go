@@ -0,0 +1,254 @@
+// Package events provides the in-process event bus that carries state changes
+// from the poller, the API handlers and the reconciler to SSE clients and
+// integrations.
+package events
+
+import (
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Event types. The part before the first dot is the event's topic.
+const (
+	TypeNetworkCreated  = "network.created"
+	TypeNetworkUpdated  = "network.updated"
+	TypeNetworkDeleted  = "network.deleted"
+	TypeNetworkEnabled  = "network.enabled"
+	TypeNetworkDisabled = "network.disabled"
+	TypeNetworkImported = "network.imported"
+	TypeNetworkStatus   = "network.status" // live peer status after each poll
+
+	TypePeerCreated  = "peer.created"
+	TypePeerUpdated  = "peer.updated"
+	TypePeerDeleted  = "peer.deleted"
+	TypePeerEnabled  = "peer.enabled"
+	TypePeerDisabled = "peer.disabled"
+	TypePeerOnline   = "peer.online"
+	TypePeerOffline  = "peer.offline"
+
+	TypeReconcileCorrected = "reconcile.corrected" // kernel state fixed to match the database
+	TypeReconcileCompleted = "reconcile.completed"
+)
+
+// types lists every event type, for validating subscription filters.
+var types = []string{
+	TypeNetworkCreated, TypeNetworkUpdated, TypeNetworkDeleted, TypeNetworkEnabled,
+	TypeNetworkDisabled, TypeNetworkImported, TypeNetworkStatus,
+	TypePeerCreated, TypePeerUpdated, TypePeerDeleted, TypePeerEnabled,
+	TypePeerDisabled, TypePeerOnline, TypePeerOffline,
+	TypeReconcileCorrected, TypeReconcileCompleted,
+}
+
+// ValidTopic reports whether t is a known topic or event type.
+func ValidTopic(t string) bool {
+	for _, typ := range types {
+		if t == typ || t == (Event{Type: typ}).Topic() {
+			return true
+		}
+	}
+	return false
+}
+
+// DefaultBufferSize is the default number of events kept for replay.
+const DefaultBufferSize = 1024
+
+// subscriberBuffer is the number of events a subscriber may fall behind
+// before it is dropped.
+const subscriberBuffer = 64
+
+// Event is a single state change published on the bus.
+type Event struct {
+	ID        uint64 // assigned by Publish, increasing from 1
+	Type      string
+	Time      time.Time
+	NetworkID int64 // 0 for events not tied to a network
+	PeerID    int64 // 0 for events not tied to a peer
+	Data      any   // JSON-encodable payload
+}
+
+// Topic returns the event's topic, e.g. "peer" for "peer.created".
+func (e Event) Topic() string {
+	topic, _, _ := strings.Cut(e.Type, ".")
+	return topic
+}
+
+// Filter selects the events a subscriber receives.
+type Filter struct {
+	// Topics holds topics ("peer") or full event types ("peer.online").
+	// An empty list matches every event.
+	Topics []string
+	// NetworkID restricts events to one network. 0 matches all networks.
+	NetworkID int64
+	// NetworkIDs, if not nil, restricts events to these networks. Events
+	// not tied to a network are excluded too.
+	NetworkIDs []int64
+}
+
+// Match reports whether e passes the filter.
+func (f Filter) Match(e Event) bool {
+	if f.NetworkID != 0 && e.NetworkID != f.NetworkID {
+		return false
+	}
+	if f.NetworkIDs != nil && !slices.Contains(f.NetworkIDs, e.NetworkID) {
+		return false
+	}
+	if len(f.Topics) == 0 {
+		return true
+	}
+	for _, t := range f.Topics {
+		if t == e.Type || t == e.Topic() {
+			return true
+		}
+	}
+	return false
+}
+
+// Bus fans published events out to subscribers and keeps the most recent
+// ones in a bounded buffer so reconnecting clients can catch up.
+//
+// A nil *Bus is valid: Publish is a no-op, so publishers need no checks.
+type Bus struct {
+	mu     sync.Mutex
+	events []Event
+	size   int
+	lastID uint64
+	subs   map[*Subscription]struct{}
+	now    func() time.Time
+}
+
+// NewBus creates a bus that keeps the last size events for replay. A size of
+// zero or less uses DefaultBufferSize.
+func NewBus(size int) *Bus {
+	if size <= 0 {
+		size = DefaultBufferSize
+	}
+	return &Bus{
+		events: make([]Event, size),
+		size:   size,
+		subs:   make(map[*Subscription]struct{}),
+		now:    time.Now,
+	}
+}
+
+// Publish assigns e its ID and timestamp, stores it for replay and delivers
+// it to matching subscribers. It never blocks: a subscriber whose channel is
+// full is dropped and must resubscribe from its last seen ID.
+func (b *Bus) Publish(e Event) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.lastID++
+	e.ID = b.lastID
+	if e.Time.IsZero() {
+		e.Time = b.now()
+	}
+	b.events[(e.ID-1)%uint64(b.size)] = e
+
+	for sub := range b.subs {
+		if !sub.filter.Match(e) {
+			continue
+		}
+		select {
+		case sub.ch <- e:
+		default:
+			b.removeLocked(sub)
+		}
+	}
+}
+
+// Subscribe registers a subscriber for events matching f. When after is
+// non-zero, buffered events with a higher ID are returned for replay, and
+// complete reports whether all of them were still buffered. A client that
+// missed events should reload its state instead of relying on the replay.
+func (b *Bus) Subscribe(f Filter, after uint64) (sub *Subscription, replay []Event, complete bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	sub = &Subscription{
+		bus:    b,
+		ch:     make(chan Event, subscriberBuffer),
+		filter: f,
+	}
+	sub.C = sub.ch
+	b.subs[sub] = struct{}{}
+
+	if after == 0 {
+		return sub, nil, true
+	}
+	complete = true
+	// An ID ahead of the bus was issued before a restart.
+	if after > b.lastID {
+		after, complete = 0, false
+	}
+	oldest := b.oldestLocked()
+	if after+1 < oldest {
+		complete = false
+	}
+	for id := max(after+1, oldest); id <= b.lastID; id++ {
+		e := b.events[(id-1)%uint64(b.size)]
+		if f.Match(e) {
+			replay = append(replay, e)
+		}
+	}
+	return sub, replay, complete
+}
+
+// Latest returns the most recent buffered event matching f.
+func (b *Bus) Latest(f Filter) (Event, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for id := b.lastID; id >= b.oldestLocked() && id > 0; id-- {
+		e := b.events[(id-1)%uint64(b.size)]
+		if f.Match(e) {
+			return e, true
+		}
+	}
+	return Event{}, false
+}
+
+// Subscribers returns the number of active subscriptions.
+func (b *Bus) Subscribers() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.subs)
+}
+
+// oldestLocked returns the ID of the oldest buffered event.
+func (b *Bus) oldestLocked() uint64 {
+	if b.lastID < uint64(b.size) {
+		return 1
+	}
+	return b.lastID - uint64(b.size) + 1
+}
+
+func (b *Bus) removeLocked(sub *Subscription) {
+	if _, ok := b.subs[sub]; !ok {
+		return
+	}
+	delete(b.subs, sub)
+	close(sub.ch)
+}
+
+// Subscription receives events from a Bus.
+type Subscription struct {
+	// C delivers matching events. It is closed when the subscription is
+	// closed or dropped for falling behind.
+	C <-chan Event
+
+	bus    *Bus
+	ch     chan Event
+	filter Filter
+}
+
+// Close unsubscribes from the bus. It is safe to call more than once.
+func (s *Subscription) Close() {
+	s.bus.mu.Lock()
+	defer s.bus.mu.Unlock()
+	s.bus.removeLocked(s)
+}
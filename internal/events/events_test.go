@@ -0,0 +1,127 @@
+package events
+
+import (
+	"testing"
+)
+
+func TestBus_PublishSubscribe(t *testing.T) {
+	b := NewBus(10)
+	sub, replay, complete := b.Subscribe(Filter{Topics: []string{"peer"}, NetworkID: 1}, 0)
+	defer sub.Close()
+	if len(replay) != 0 || !complete {
+		t.Fatalf("expected empty complete replay, got %d events, complete=%v", len(replay), complete)
+	}
+
+	b.Publish(Event{Type: TypeNetworkUpdated, NetworkID: 1})
+	b.Publish(Event{Type: TypePeerCreated, NetworkID: 2, PeerID: 7})
+	b.Publish(Event{Type: TypePeerCreated, NetworkID: 1, PeerID: 5})
+
+	select {
+	case e := <-sub.C:
+		if e.ID != 3 || e.Type != TypePeerCreated || e.PeerID != 5 {
+			t.Errorf("unexpected event: %+v", e)
+		}
+		if e.Time.IsZero() {
+			t.Error("expected publish time to be set")
+		}
+	default:
+		t.Fatal("expected a matching event")
+	}
+	select {
+	case e := <-sub.C:
+		t.Errorf("expected no further events, got %+v", e)
+	default:
+	}
+}
+
+func TestBus_Replay(t *testing.T) {
+	b := NewBus(3)
+	for i := 0; i < 5; i++ {
+		b.Publish(Event{Type: TypePeerUpdated})
+	}
+
+	// Events 4 and 5 are still buffered.
+	sub, replay, complete := b.Subscribe(Filter{}, 3)
+	sub.Close()
+	if !complete || len(replay) != 2 || replay[0].ID != 4 || replay[1].ID != 5 {
+		t.Errorf("expected complete replay of 4-5, got %+v complete=%v", replay, complete)
+	}
+
+	// Event 2 has been evicted.
+	sub, replay, complete = b.Subscribe(Filter{}, 1)
+	sub.Close()
+	if complete || len(replay) != 3 || replay[0].ID != 3 {
+		t.Errorf("expected incomplete replay of 3-5, got %+v complete=%v", replay, complete)
+	}
+
+	// An ID from before a restart replays everything buffered.
+	sub, replay, complete = b.Subscribe(Filter{}, 99)
+	sub.Close()
+	if complete || len(replay) != 3 {
+		t.Errorf("expected incomplete replay of 3 events, got %d complete=%v", len(replay), complete)
+	}
+}
+
+func TestBus_Latest(t *testing.T) {
+	b := NewBus(10)
+	if _, ok := b.Latest(Filter{}); ok {
+		t.Fatal("expected no event on empty bus")
+	}
+	b.Publish(Event{Type: TypeNetworkStatus, NetworkID: 1, Data: "first"})
+	b.Publish(Event{Type: TypeNetworkStatus, NetworkID: 2})
+	b.Publish(Event{Type: TypeNetworkStatus, NetworkID: 1, Data: "second"})
+	b.Publish(Event{Type: TypePeerOnline, NetworkID: 1})
+
+	e, ok := b.Latest(Filter{Topics: []string{TypeNetworkStatus}, NetworkID: 1})
+	if !ok || e.Data != "second" {
+		t.Errorf("expected latest status of network 1, got %+v", e)
+	}
+}
+
+func TestBus_DropsSlowSubscriber(t *testing.T) {
+	b := NewBus(0)
+	sub, _, _ := b.Subscribe(Filter{}, 0)
+	for i := 0; i < subscriberBuffer+1; i++ {
+		b.Publish(Event{Type: TypePeerUpdated})
+	}
+	if n := b.Subscribers(); n != 0 {
+		t.Fatalf("expected slow subscriber to be dropped, got %d subscribers", n)
+	}
+	count := 0
+	for range sub.C {
+		count++
+	}
+	if count != subscriberBuffer {
+		t.Errorf("expected %d buffered events before close, got %d", subscriberBuffer, count)
+	}
+	sub.Close() // closing a dropped subscription is a no-op
+}
+
+func TestFilter_Match(t *testing.T) {
+	e := Event{Type: TypePeerOnline, NetworkID: 3}
+	tests := []struct {
+		filter Filter
+		want   bool
+	}{
+		{Filter{}, true},
+		{Filter{Topics: []string{"peer"}}, true},
+		{Filter{Topics: []string{"peer.online"}}, true},
+		{Filter{Topics: []string{"peer.offline", "network"}}, false},
+		{Filter{Topics: []string{"pe"}}, false},
+		{Filter{NetworkID: 3}, true},
+		{Filter{NetworkID: 4}, false},
+		{Filter{NetworkIDs: []int64{3, 5}}, true},
+		{Filter{NetworkIDs: []int64{5}}, false},
+		{Filter{NetworkIDs: []int64{}}, false},
+	}
+	for _, tt := range tests {
+		if got := tt.filter.Match(e); got != tt.want {
+			t.Errorf("%+v.Match(%s) = %v, want %v", tt.filter, e.Type, got, tt.want)
+		}
+	}
+}
+
+func TestBus_NilPublish(t *testing.T) {
+	var b *Bus
+	b.Publish(Event{Type: TypePeerCreated}) // must not panic
+}
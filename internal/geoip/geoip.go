@@ -0,0 +1,154 @@
+// Package geoip resolves IP addresses to country, city and autonomous
+// system using local MaxMind-format (.mmdb) databases. No lookups leave the
+// host.
+package geoip
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+)
+
+// Location is what the configured databases know about an address. Fields
+// the databases do not provide are left empty.
+type Location struct {
+	Country     string // ISO 3166-1 alpha-2 code, e.g. "CH"
+	CountryName string // English name
+	City        string // English name
+	ASN         uint32
+	ASOrg       string
+}
+
+// DB looks up addresses in one or more MaxMind databases, e.g. GeoLite2-City
+// together with GeoLite2-ASN. Each database contributes the fields it has.
+// DB is safe for concurrent use.
+type DB struct {
+	readers []*reader
+	types   []string
+}
+
+// Open loads the databases at paths into memory. Empty paths are skipped;
+// at least one database is required.
+func Open(paths ...string) (*DB, error) {
+	d := &DB{}
+	for _, path := range paths {
+		if path == "" {
+			continue
+		}
+		r, err := openReader(path)
+		if err != nil {
+			return nil, fmt.Errorf("geoip: open: %w", err)
+		}
+		d.readers = append(d.readers, r)
+		d.types = append(d.types, r.meta.DatabaseType)
+	}
+	if len(d.readers) == 0 {
+		return nil, fmt.Errorf("geoip: open: no database configured")
+	}
+	return d, nil
+}
+
+// DatabaseTypes returns the database_type of each loaded database, e.g.
+// "GeoLite2-City".
+func (d *DB) DatabaseTypes() []string {
+	return d.types
+}
+
+// Lookup returns the location of addr, or nil if no database has a record
+// for it (e.g. private addresses).
+func (d *DB) Lookup(addr netip.Addr) (*Location, error) {
+	var loc Location
+	found := false
+	for _, r := range d.readers {
+		rec, err := r.lookup(addr)
+		if err != nil {
+			return nil, fmt.Errorf("geoip: lookup %s: %w", addr, err)
+		}
+		m, ok := rec.(map[string]any)
+		if !ok {
+			continue
+		}
+		found = true
+		mergeRecord(&loc, m)
+	}
+	if !found {
+		return nil, nil
+	}
+	return &loc, nil
+}
+
+// LookupEndpoint looks up the host of a WireGuard endpoint ("ip:port").
+// It returns nil for empty or unparsable endpoints.
+func (d *DB) LookupEndpoint(endpoint string) (*Location, error) {
+	addr, ok := EndpointAddr(endpoint)
+	if !ok {
+		return nil, nil
+	}
+	return d.Lookup(addr)
+}
+
+// EndpointAddr returns the IP address of an "ip:port" endpoint, or a bare
+// IP address such as an audit log remote address without port.
+func EndpointAddr(endpoint string) (netip.Addr, bool) {
+	if ap, err := netip.ParseAddrPort(endpoint); err == nil {
+		return ap.Addr().Unmap(), true
+	}
+	if addr, err := netip.ParseAddr(endpoint); err == nil {
+		return addr.Unmap(), true
+	}
+	return netip.Addr{}, false
+}
+
+// ParseCountries parses a comma-separated list of ISO country codes,
+// normalising them to upper case. It rejects anything that is not two
+// letters.
+func ParseCountries(s string) ([]string, error) {
+	var codes []string
+	for _, part := range strings.Split(s, ",") {
+		code := strings.ToUpper(strings.TrimSpace(part))
+		if code == "" {
+			continue
+		}
+		if len(code) != 2 || code[0] < 'A' || code[0] > 'Z' || code[1] < 'A' || code[1] > 'Z' {
+			return nil, fmt.Errorf("invalid country code %q", part)
+		}
+		codes = append(codes, code)
+	}
+	return codes, nil
+}
+
+// mergeRecord copies the fields of a GeoIP2 City/Country or ASN record into
+// loc, keeping values already set by an earlier database.
+func mergeRecord(loc *Location, m map[string]any) {
+	country := path(m, "country")
+	if country == nil {
+		country = path(m, "registered_country")
+	}
+	if loc.Country == "" {
+		loc.Country, _ = country["iso_code"].(string)
+	}
+	if loc.CountryName == "" {
+		loc.CountryName, _ = path(country, "names")["en"].(string)
+	}
+	if loc.City == "" {
+		loc.City, _ = path(m, "city", "names")["en"].(string)
+	}
+	if loc.ASN == 0 {
+		loc.ASN = uint32(toUint(m["autonomous_system_number"]))
+	}
+	if loc.ASOrg == "" {
+		loc.ASOrg, _ = m["autonomous_system_organization"].(string)
+	}
+}
+
+// path follows nested map keys and returns the map at the end, or nil.
+func path(m map[string]any, keys ...string) map[string]any {
+	for _, k := range keys {
+		next, ok := m[k].(map[string]any)
+		if !ok {
+			return nil
+		}
+		m = next
+	}
+	return m
+}
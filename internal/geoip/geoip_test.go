@@ -0,0 +1,180 @@
+package geoip
+
+import (
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/itsChris/wgpilot/internal/testutil"
+)
+
+func cityData(iso, country, city string) map[string]any {
+	return map[string]any{
+		"country": map[string]any{
+			"iso_code": iso,
+			"names":    map[string]any{"en": country, "de": country + " (de)"},
+		},
+		"city": map[string]any{
+			"names": map[string]any{"en": city},
+		},
+		"location": map[string]any{"time_zone": "Europe/Zurich"},
+	}
+}
+
+func writeCityDB(t *testing.T, recordSize int) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "city.mmdb")
+	err := testutil.WriteMMDB(path, "GeoLite2-City", recordSize, []testutil.MMDBRecord{
+		{Prefix: netip.MustParsePrefix("81.2.69.0/24"), Data: cityData("CH", "Switzerland", "Zurich")},
+		{Prefix: netip.MustParsePrefix("2001:db8::/32"), Data: cityData("DE", "Germany", "Berlin")},
+		{Prefix: netip.MustParsePrefix("198.51.100.0/24"), Data: testutil.MMDBPointer(0)},
+		{Prefix: netip.MustParsePrefix("203.0.113.0/24"), Data: map[string]any{
+			"registered_country": map[string]any{"iso_code": "FR", "names": map[string]any{"en": "France"}},
+		}},
+	})
+	if err != nil {
+		t.Fatalf("write mmdb: %v", err)
+	}
+	return path
+}
+
+func TestLookup(t *testing.T) {
+	for _, size := range []int{24, 28, 32} {
+		db, err := Open(writeCityDB(t, size))
+		if err != nil {
+			t.Fatalf("record size %d: open: %v", size, err)
+		}
+
+		tests := []struct {
+			addr          string
+			country, city string
+		}{
+			{"81.2.69.160", "CH", "Zurich"},
+			{"::ffff:81.2.69.1", "CH", "Zurich"},
+			{"2001:db8::1", "DE", "Berlin"},
+			{"198.51.100.7", "CH", "Zurich"}, // via pointer
+			{"203.0.113.1", "FR", ""},        // registered country only
+			{"10.0.0.1", "", ""},
+			{"2001:db9::1", "", ""},
+		}
+		for _, tt := range tests {
+			loc, err := db.Lookup(netip.MustParseAddr(tt.addr))
+			if err != nil {
+				t.Fatalf("record size %d: lookup %s: %v", size, tt.addr, err)
+			}
+			if tt.country == "" {
+				if loc != nil {
+					t.Errorf("record size %d: expected no record for %s, got %+v", size, tt.addr, loc)
+				}
+				continue
+			}
+			if loc == nil || loc.Country != tt.country || loc.City != tt.city {
+				t.Errorf("record size %d: %s: expected %s/%s, got %+v", size, tt.addr, tt.country, tt.city, loc)
+			}
+		}
+	}
+}
+
+func TestLookup_MergesASNDatabase(t *testing.T) {
+	asnPath := filepath.Join(t.TempDir(), "asn.mmdb")
+	err := testutil.WriteMMDB(asnPath, "GeoLite2-ASN", 24, []testutil.MMDBRecord{
+		{Prefix: netip.MustParsePrefix("81.2.64.0/20"), Data: map[string]any{
+			"autonomous_system_number":       uint32(20712),
+			"autonomous_system_organization": "Andrews & Arnold Ltd",
+		}},
+	})
+	if err != nil {
+		t.Fatalf("write mmdb: %v", err)
+	}
+
+	db, err := Open(writeCityDB(t, 24), "", asnPath)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	if got := db.DatabaseTypes(); len(got) != 2 || got[0] != "GeoLite2-City" || got[1] != "GeoLite2-ASN" {
+		t.Errorf("unexpected database types %v", got)
+	}
+
+	loc, err := db.LookupEndpoint("81.2.69.160:51820")
+	if err != nil {
+		t.Fatalf("lookup: %v", err)
+	}
+	want := Location{Country: "CH", CountryName: "Switzerland", City: "Zurich", ASN: 20712, ASOrg: "Andrews & Arnold Ltd"}
+	if loc == nil || *loc != want {
+		t.Errorf("expected %+v, got %+v", want, loc)
+	}
+
+	// Covered by the ASN database only.
+	loc, err = db.LookupEndpoint("81.2.70.1:51820")
+	if err != nil {
+		t.Fatalf("lookup: %v", err)
+	}
+	if loc == nil || loc.Country != "" || loc.ASN != 20712 {
+		t.Errorf("expected ASN-only location, got %+v", loc)
+	}
+}
+
+func TestLookupEndpoint(t *testing.T) {
+	db, err := Open(writeCityDB(t, 24))
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+
+	tests := []struct {
+		endpoint string
+		country  string
+	}{
+		{"81.2.69.160:51820", "CH"},
+		{"[2001:db8::1]:51820", "DE"},
+		{"81.2.69.160", "CH"},
+		{"", ""},
+		{"not-an-endpoint", ""},
+	}
+	for _, tt := range tests {
+		loc, err := db.LookupEndpoint(tt.endpoint)
+		if err != nil {
+			t.Fatalf("lookup %q: %v", tt.endpoint, err)
+		}
+		got := ""
+		if loc != nil {
+			got = loc.Country
+		}
+		if got != tt.country {
+			t.Errorf("%q: expected country %q, got %q", tt.endpoint, tt.country, got)
+		}
+	}
+}
+
+func TestOpen_Invalid(t *testing.T) {
+	if _, err := Open(); err == nil {
+		t.Error("expected error without databases")
+	}
+	if _, err := Open(filepath.Join(t.TempDir(), "missing.mmdb")); err == nil {
+		t.Error("expected error for missing file")
+	}
+
+	path := filepath.Join(t.TempDir(), "bogus.mmdb")
+	if err := os.WriteFile(path, []byte("not a database"), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if _, err := Open(path); err == nil {
+		t.Error("expected error for file without metadata")
+	}
+}
+
+func TestParseCountries(t *testing.T) {
+	got, err := ParseCountries(" ch, de ,,AT")
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if len(got) != 3 || got[0] != "CH" || got[1] != "DE" || got[2] != "AT" {
+		t.Errorf("unexpected codes %v", got)
+	}
+
+	for _, bad := range []string{"CHE", "C1", "switzerland"} {
+		if _, err := ParseCountries(bad); err == nil {
+			t.Errorf("expected error for %q", bad)
+		}
+	}
+}
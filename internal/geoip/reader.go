@@ -0,0 +1,368 @@
+package geoip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"net/netip"
+	"os"
+)
+
+// metadataStart marks the beginning of the metadata section, which sits at
+// the end of every MaxMind DB file.
+var metadataStart = []byte("\xab\xcd\xefMaxMind.com")
+
+// dataSectionSeparator is the number of zero bytes between the search tree
+// and the data section.
+const dataSectionSeparator = 16
+
+// maxDepth bounds nested maps and arrays so a corrupt file cannot recurse
+// without limit.
+const maxDepth = 32
+
+// Data section field types, as defined by the MaxMind DB format spec.
+const (
+	typeExtended = iota
+	typePointer
+	typeString
+	typeDouble
+	typeBytes
+	typeUint16
+	typeUint32
+	typeMap
+	typeInt32
+	typeUint64
+	typeUint128
+	typeArray
+	typeContainer
+	typeEndMarker
+	typeBool
+	typeFloat
+)
+
+// metadata holds the fields of the metadata section the reader needs.
+type metadata struct {
+	NodeCount    uint
+	RecordSize   uint
+	IPVersion    uint
+	DatabaseType string
+}
+
+// reader looks up addresses in a MaxMind DB (.mmdb) file held in memory.
+// It implements the subset of the format needed for GeoIP2/GeoLite2 City,
+// Country and ASN databases; all lookups are local.
+type reader struct {
+	buf       []byte
+	meta      metadata
+	data      []byte // data section
+	ipv4Start uint   // node reached after the 96 zero bits of ::/96
+}
+
+// openReader reads and validates the database at path.
+func openReader(path string) (*reader, error) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", path, err)
+	}
+	r, err := newReader(buf)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return r, nil
+}
+
+func newReader(buf []byte) (*reader, error) {
+	i := bytes.LastIndex(buf, metadataStart)
+	if i < 0 {
+		return nil, fmt.Errorf("not a MaxMind DB file: metadata marker not found")
+	}
+	metaBuf := buf[i+len(metadataStart):]
+	raw, _, err := (&decoder{buf: metaBuf}).decode(0, 0)
+	if err != nil {
+		return nil, fmt.Errorf("decode metadata: %w", err)
+	}
+	m, ok := raw.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("decode metadata: not a map")
+	}
+
+	meta := metadata{
+		NodeCount:  uint(toUint(m["node_count"])),
+		RecordSize: uint(toUint(m["record_size"])),
+		IPVersion:  uint(toUint(m["ip_version"])),
+	}
+	meta.DatabaseType, _ = m["database_type"].(string)
+
+	switch meta.RecordSize {
+	case 24, 28, 32:
+	default:
+		return nil, fmt.Errorf("unsupported record size %d", meta.RecordSize)
+	}
+	if meta.IPVersion != 4 && meta.IPVersion != 6 {
+		return nil, fmt.Errorf("unsupported IP version %d", meta.IPVersion)
+	}
+
+	treeSize := meta.NodeCount * meta.RecordSize / 4
+	if treeSize+dataSectionSeparator > uint(i) {
+		return nil, fmt.Errorf("search tree exceeds file size")
+	}
+
+	r := &reader{
+		buf:  buf,
+		meta: meta,
+		data: buf[treeSize+dataSectionSeparator : i],
+	}
+	if meta.IPVersion == 6 {
+		node := uint(0)
+		for n := 0; n < 96 && node < meta.NodeCount; n++ {
+			node = r.readNode(node, 0)
+		}
+		r.ipv4Start = node
+	}
+	return r, nil
+}
+
+// lookup returns the decoded record for addr, or nil if the address is not
+// in the database.
+func (r *reader) lookup(addr netip.Addr) (any, error) {
+	addr = addr.Unmap()
+
+	var ip []byte
+	node := uint(0)
+	switch {
+	case addr.Is4():
+		a := addr.As4()
+		ip = a[:]
+		if r.meta.IPVersion == 6 {
+			node = r.ipv4Start
+		}
+	case r.meta.IPVersion == 4:
+		return nil, nil
+	default:
+		a := addr.As16()
+		ip = a[:]
+	}
+
+	for i := 0; i < len(ip)*8 && node < r.meta.NodeCount; i++ {
+		bit := uint(ip[i/8]>>(7-i%8)) & 1
+		node = r.readNode(node, bit)
+	}
+
+	switch {
+	case node == r.meta.NodeCount:
+		return nil, nil
+	case node < r.meta.NodeCount:
+		return nil, fmt.Errorf("invalid search tree: no record after %d bits", len(ip)*8)
+	}
+
+	offset := node - r.meta.NodeCount - dataSectionSeparator
+	if offset >= uint(len(r.data)) {
+		return nil, fmt.Errorf("invalid search tree: data pointer %d out of range", offset)
+	}
+	v, _, err := (&decoder{buf: r.data}).decode(offset, 0)
+	if err != nil {
+		return nil, fmt.Errorf("decode record: %w", err)
+	}
+	return v, nil
+}
+
+// readNode returns the left (bit 0) or right (bit 1) record of a node.
+func (r *reader) readNode(node, bit uint) uint {
+	switch r.meta.RecordSize {
+	case 24:
+		b := r.buf[node*6+bit*3:]
+		return uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+	case 28:
+		b := r.buf[node*7:]
+		if bit == 0 {
+			return uint(b[3]&0xf0)<<20 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+		}
+		return uint(b[3]&0x0f)<<24 | uint(b[4])<<16 | uint(b[5])<<8 | uint(b[6])
+	default:
+		return uint(binary.BigEndian.Uint32(r.buf[node*8+bit*4:]))
+	}
+}
+
+// decoder decodes values from a data or metadata section.
+type decoder struct {
+	buf []byte
+}
+
+// decode decodes the value at offset and returns it with the offset of the
+// next value. Maps decode to map[string]any, arrays to []any, unsigned
+// integers to uint64 and uint128 values to their big-endian bytes.
+func (d *decoder) decode(offset uint, depth int) (any, uint, error) {
+	if depth > maxDepth {
+		return nil, 0, fmt.Errorf("data nested deeper than %d levels", maxDepth)
+	}
+	typ, size, offset, err := d.decodeControl(offset)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if typ == typePointer {
+		target, next, err := d.decodePointer(size, offset)
+		if err != nil {
+			return nil, 0, err
+		}
+		v, _, err := d.decode(target, depth+1)
+		return v, next, err
+	}
+
+	switch typ {
+	case typeMap:
+		m := make(map[string]any, size)
+		for i := uint(0); i < size; i++ {
+			k, next, err := d.decode(offset, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			key, ok := k.(string)
+			if !ok {
+				return nil, 0, fmt.Errorf("map key at offset %d is not a string", offset)
+			}
+			v, next, err := d.decode(next, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			m[key] = v
+			offset = next
+		}
+		return m, offset, nil
+	case typeArray:
+		a := make([]any, 0, min(size, 1024))
+		for i := uint(0); i < size; i++ {
+			v, next, err := d.decode(offset, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			a = append(a, v)
+			offset = next
+		}
+		return a, offset, nil
+	case typeBool:
+		return size != 0, offset, nil
+	}
+
+	if offset+size > uint(len(d.buf)) {
+		return nil, 0, fmt.Errorf("value at offset %d exceeds section", offset)
+	}
+	b := d.buf[offset : offset+size]
+	next := offset + size
+
+	switch typ {
+	case typeString:
+		return string(b), next, nil
+	case typeBytes, typeUint128:
+		return bytes.Clone(b), next, nil
+	case typeDouble:
+		if size != 8 {
+			return nil, 0, fmt.Errorf("invalid double size %d", size)
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), next, nil
+	case typeFloat:
+		if size != 4 {
+			return nil, 0, fmt.Errorf("invalid float size %d", size)
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(b))), next, nil
+	case typeUint16, typeUint32, typeUint64:
+		if size > 8 {
+			return nil, 0, fmt.Errorf("invalid integer size %d", size)
+		}
+		var n uint64
+		for _, c := range b {
+			n = n<<8 | uint64(c)
+		}
+		return n, next, nil
+	case typeInt32:
+		if size > 4 {
+			return nil, 0, fmt.Errorf("invalid int32 size %d", size)
+		}
+		var n uint32
+		for _, c := range b {
+			n = n<<8 | uint32(c)
+		}
+		return int64(int32(n)), next, nil
+	default:
+		return nil, 0, fmt.Errorf("unsupported data type %d at offset %d", typ, offset)
+	}
+}
+
+// decodeControl parses the control byte (and any extended type and size
+// bytes) at offset and returns the field type, its payload size and the
+// offset of the payload.
+func (d *decoder) decodeControl(offset uint) (typ int, size, next uint, err error) {
+	if offset >= uint(len(d.buf)) {
+		return 0, 0, 0, fmt.Errorf("offset %d exceeds section", offset)
+	}
+	ctrl := d.buf[offset]
+	offset++
+
+	typ = int(ctrl >> 5)
+	if typ == typePointer {
+		return typ, uint(ctrl & 0x1f), offset, nil
+	}
+	if typ == typeExtended {
+		if offset >= uint(len(d.buf)) {
+			return 0, 0, 0, fmt.Errorf("extended type at offset %d exceeds section", offset)
+		}
+		typ = 7 + int(d.buf[offset])
+		offset++
+	}
+
+	size = uint(ctrl & 0x1f)
+	if size >= 29 {
+		n := size - 28
+		if offset+n > uint(len(d.buf)) {
+			return 0, 0, 0, fmt.Errorf("size at offset %d exceeds section", offset)
+		}
+		var ext uint
+		for _, c := range d.buf[offset : offset+n] {
+			ext = ext<<8 | uint(c)
+		}
+		switch size {
+		case 29:
+			size = 29 + ext
+		case 30:
+			size = 285 + ext
+		default:
+			size = 65821 + ext
+		}
+		offset += n
+	}
+	return typ, size, offset, nil
+}
+
+// decodePointer resolves a pointer whose control bits are ctrl and whose
+// remaining bytes start at offset. It returns the target offset and the
+// offset after the pointer.
+func (d *decoder) decodePointer(ctrl, offset uint) (target, next uint, err error) {
+	n := (ctrl >> 3) + 1
+	if offset+n > uint(len(d.buf)) {
+		return 0, 0, fmt.Errorf("pointer at offset %d exceeds section", offset)
+	}
+	b := d.buf[offset : offset+n]
+
+	var p uint
+	if n != 4 {
+		p = ctrl & 0x7
+	}
+	for _, c := range b {
+		p = p<<8 | uint(c)
+	}
+	switch n {
+	case 2:
+		p += 2048
+	case 3:
+		p += 526336
+	}
+	return p, offset + n, nil
+}
+
+// toUint converts a decoded unsigned integer to uint64, returning 0 for any
+// other type.
+func toUint(v any) uint64 {
+	n, _ := v.(uint64)
+	return n
+}
@@ -0,0 +1,438 @@
+// Package hooks runs admin-registered local executables when peers and
+// networks change, in the spirit of wg-quick's PostUp/PostDown. Hooks are
+// driven by the event bus and receive the event as environment variables and
+// as JSON on stdin.
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/itsChris/wgpilot/internal/db"
+	"github.com/itsChris/wgpilot/internal/events"
+	"github.com/itsChris/wgpilot/internal/logging"
+)
+
+// Hook events.
+const (
+	EventPeerOnline     = "peer_online"
+	EventPeerOffline    = "peer_offline"
+	EventPeerCreated    = "peer_created"
+	EventPeerUpdated    = "peer_updated"
+	EventPeerDeleted    = "peer_deleted"
+	EventPeerEnabled    = "peer_enabled"
+	EventPeerDisabled   = "peer_disabled"
+	EventNetworkCreated = "network_created"
+	EventNetworkUpdated = "network_updated"
+	EventNetworkDeleted = "network_deleted"
+	EventNetworkUp      = "network_up"   // interface created or enabled
+	EventNetworkDown    = "network_down" // interface disabled or deleted
+)
+
+// busEvents maps event bus types to the hook events they trigger.
+var busEvents = map[string][]string{
+	events.TypePeerOnline:      {EventPeerOnline},
+	events.TypePeerOffline:     {EventPeerOffline},
+	events.TypePeerCreated:     {EventPeerCreated},
+	events.TypePeerUpdated:     {EventPeerUpdated},
+	events.TypePeerDeleted:     {EventPeerDeleted},
+	events.TypePeerEnabled:     {EventPeerEnabled},
+	events.TypePeerDisabled:    {EventPeerDisabled},
+	events.TypeNetworkCreated:  {EventNetworkCreated, EventNetworkUp},
+	events.TypeNetworkUpdated:  {EventNetworkUpdated},
+	events.TypeNetworkDeleted:  {EventNetworkDeleted, EventNetworkDown},
+	events.TypeNetworkEnabled:  {EventNetworkUp},
+	events.TypeNetworkDisabled: {EventNetworkDown},
+}
+
+// ValidEvent reports whether name is a hook event.
+func ValidEvent(name string) bool {
+	for _, hookEvents := range busEvents {
+		for _, e := range hookEvents {
+			if e == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+const (
+	queueSize    = 256      // runs waiting for a free slot before new ones are dropped
+	outputLimit  = 64 << 10 // captured stdout+stderr per run
+	auditLimit   = 1000     // output kept in the audit entry
+	killDelay    = 5 * time.Second
+	hookPathEnv  = "PATH=/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin"
+	envVarPrefix = "WGPILOT_"
+)
+
+// Hook is an executable registered for one hook event.
+type Hook struct {
+	Event   string
+	Command string // absolute path, executed directly without a shell
+	Args    []string
+}
+
+// AuditStore records hook runs in the audit log.
+type AuditStore interface {
+	InsertAuditEntry(ctx context.Context, entry *db.AuditEntry) error
+}
+
+// NetworkStore looks up the network an event belongs to, to pass its
+// interface name to the hook.
+type NetworkStore interface {
+	GetNetworkByID(ctx context.Context, id int64) (*db.Network, error)
+}
+
+// Result is the outcome of a single hook run.
+type Result struct {
+	ExitCode int // -1 if the process did not exit normally
+	Output   string
+	Duration time.Duration
+	Err      error
+}
+
+// invocation is a queued hook run.
+type invocation struct {
+	hook  Hook
+	event string
+	env   []string
+	stdin []byte
+}
+
+// Runner subscribes to the event bus and runs the matching hooks.
+type Runner struct {
+	hooks         map[string][]Hook
+	bus           *events.Bus
+	audit         AuditStore
+	networks      NetworkStore
+	logger        *slog.Logger
+	timeout       time.Duration
+	maxConcurrent int
+	queue         chan invocation
+}
+
+// NewRunner validates the hooks and creates a Runner. networks is optional.
+func NewRunner(hooks []Hook, bus *events.Bus, audit AuditStore, networks NetworkStore, logger *slog.Logger, timeout time.Duration, maxConcurrent int) (*Runner, error) {
+	if bus == nil {
+		return nil, fmt.Errorf("new hook runner: event bus is required")
+	}
+	if audit == nil {
+		return nil, fmt.Errorf("new hook runner: audit store is required")
+	}
+	if logger == nil {
+		return nil, fmt.Errorf("new hook runner: logger is required")
+	}
+	if timeout <= 0 {
+		return nil, fmt.Errorf("new hook runner: timeout must be positive")
+	}
+	if maxConcurrent <= 0 {
+		return nil, fmt.Errorf("new hook runner: max concurrent must be positive")
+	}
+
+	byEvent := make(map[string][]Hook)
+	for i, h := range hooks {
+		if !ValidEvent(h.Event) {
+			return nil, fmt.Errorf("new hook runner: hook %d: unknown event %q", i, h.Event)
+		}
+		if !filepath.IsAbs(h.Command) {
+			return nil, fmt.Errorf("new hook runner: hook %d: command %q must be an absolute path", i, h.Command)
+		}
+		byEvent[h.Event] = append(byEvent[h.Event], h)
+	}
+
+	return &Runner{
+		hooks:         byEvent,
+		bus:           bus,
+		audit:         audit,
+		networks:      networks,
+		logger:        logger.With("component", "hooks"),
+		timeout:       timeout,
+		maxConcurrent: maxConcurrent,
+		queue:         make(chan invocation, queueSize),
+	}, nil
+}
+
+// Run subscribes to the event bus and runs hooks until ctx is cancelled.
+// Hooks still running at that point are killed.
+func (r *Runner) Run(ctx context.Context) {
+	taskID := logging.GenerateTaskID("hooks")
+	ctx = logging.WithTaskID(ctx, taskID)
+
+	r.logger.Info("hook_runner_started",
+		"hooks", r.count(),
+		"max_concurrent", r.maxConcurrent,
+		"timeout", r.timeout.String(),
+		"task_id", taskID,
+	)
+
+	for i := 0; i < r.maxConcurrent; i++ {
+		go func() {
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case inv := <-r.queue:
+					r.Execute(ctx, inv.hook, inv.event, inv.env, inv.stdin)
+				}
+			}
+		}()
+	}
+
+	filter := events.Filter{Topics: r.topics()}
+	sub, _, _ := r.bus.Subscribe(filter, 0)
+	var lastID uint64
+	for {
+		select {
+		case <-ctx.Done():
+			sub.Close()
+			r.logger.Info("hook_runner_stopped", "task_id", taskID)
+			return
+		case e, ok := <-sub.C:
+			if ok {
+				lastID = e.ID
+				r.Dispatch(ctx, e)
+				continue
+			}
+
+			// The bus dropped us for falling behind; catch up from the
+			// replay buffer.
+			var replay []events.Event
+			var complete bool
+			sub, replay, complete = r.bus.Subscribe(filter, lastID)
+			if !complete {
+				r.logger.Warn("hook_events_missed",
+					"after_event_id", lastID,
+					"operation", "hook_subscribe",
+				)
+			}
+			for _, e := range replay {
+				lastID = e.ID
+				r.Dispatch(ctx, e)
+			}
+		}
+	}
+}
+
+// Dispatch queues the hooks registered for a bus event. If the queue is
+// full the run is dropped and logged. Exported for testing.
+func (r *Runner) Dispatch(ctx context.Context, e events.Event) {
+	for _, hookEvent := range busEvents[e.Type] {
+		hooks := r.hooks[hookEvent]
+		if len(hooks) == 0 {
+			continue
+		}
+		env, stdin := r.payload(ctx, hookEvent, e)
+		for _, h := range hooks {
+			select {
+			case r.queue <- invocation{hook: h, event: hookEvent, env: env, stdin: stdin}:
+			default:
+				r.logger.Error("hook_dropped",
+					"event", hookEvent,
+					"command", h.Command,
+					"reason", "queue full",
+					"operation", "hook_dispatch",
+				)
+			}
+		}
+	}
+}
+
+// Execute runs one hook to completion, logs the outcome and records it in
+// the audit log. Exported for testing.
+func (r *Runner) Execute(ctx context.Context, h Hook, event string, env []string, stdin []byte) Result {
+	runCtx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	out := &limitedBuffer{limit: outputLimit}
+	cmd := exec.CommandContext(runCtx, h.Command, h.Args...)
+	cmd.Env = append([]string{hookPathEnv}, env...)
+	cmd.Stdin = bytes.NewReader(stdin)
+	cmd.Stdout = out
+	cmd.Stderr = out
+	cmd.WaitDelay = killDelay
+
+	start := time.Now()
+	err := cmd.Run()
+	res := Result{ExitCode: -1, Output: out.String(), Duration: time.Since(start)}
+	if cmd.ProcessState != nil {
+		res.ExitCode = cmd.ProcessState.ExitCode()
+	}
+	if errors.Is(runCtx.Err(), context.DeadlineExceeded) {
+		err = fmt.Errorf("timed out after %s", r.timeout)
+	}
+	res.Err = err
+
+	command := strings.Join(append([]string{h.Command}, h.Args...), " ")
+	if err != nil {
+		r.logger.Error("hook_failed",
+			"error", err,
+			"error_type", fmt.Sprintf("%T", err),
+			"event", event,
+			"command", command,
+			"exit_code", res.ExitCode,
+			"duration_ms", res.Duration.Milliseconds(),
+			"output", res.Output,
+			"operation", "hook_exec",
+		)
+	} else {
+		r.logger.Info("hook_executed",
+			"event", event,
+			"command", command,
+			"exit_code", res.ExitCode,
+			"duration_ms", res.Duration.Milliseconds(),
+			"output", res.Output,
+			"operation", "hook_exec",
+		)
+	}
+
+	action := "hook.executed"
+	detail := fmt.Sprintf("ran %s for %s (exit=%d, %dms)", command, event, res.ExitCode, res.Duration.Milliseconds())
+	if err != nil {
+		action = "hook.failed"
+		detail = fmt.Sprintf("%s for %s failed: %v (exit=%d, %dms)", command, event, err, res.ExitCode, res.Duration.Milliseconds())
+	}
+	if output := strings.TrimSpace(res.Output); output != "" {
+		if len(output) > auditLimit {
+			output = output[:auditLimit] + "..."
+		}
+		detail += ": " + output
+	}
+	if err := r.audit.InsertAuditEntry(context.WithoutCancel(ctx), &db.AuditEntry{
+		Action:   action,
+		Resource: "hook",
+		Detail:   detail,
+	}); err != nil {
+		r.logger.Error("hook_audit_failed",
+			"error", err,
+			"event", event,
+			"operation", "hook_exec",
+		)
+	}
+
+	return res
+}
+
+// payload builds the environment and stdin JSON for a hook run. Scalar
+// top-level fields of the event data are exported as WGPILOT_<FIELD>; the
+// fixed variables below take precedence.
+func (r *Runner) payload(ctx context.Context, hookEvent string, e events.Event) ([]string, []byte) {
+	vars := make(map[string]string)
+
+	var data map[string]any
+	if raw, err := json.Marshal(e.Data); err == nil {
+		json.Unmarshal(raw, &data)
+	}
+	for k, v := range data {
+		switch v := v.(type) {
+		case string:
+			vars[envName(k)] = v
+		case float64:
+			vars[envName(k)] = strconv.FormatFloat(v, 'f', -1, 64)
+		case bool:
+			vars[envName(k)] = strconv.FormatBool(v)
+		}
+	}
+
+	iface, _ := data["interface"].(string)
+	if iface == "" && e.NetworkID != 0 && r.networks != nil {
+		if n, err := r.networks.GetNetworkByID(ctx, e.NetworkID); err == nil && n != nil {
+			iface = n.Interface
+		}
+	}
+
+	vars[envVarPrefix+"EVENT"] = hookEvent
+	vars[envVarPrefix+"EVENT_TYPE"] = e.Type
+	vars[envVarPrefix+"EVENT_ID"] = strconv.FormatUint(e.ID, 10)
+	vars[envVarPrefix+"TIMESTAMP"] = strconv.FormatInt(e.Time.Unix(), 10)
+	vars[envVarPrefix+"NETWORK_ID"] = strconv.FormatInt(e.NetworkID, 10)
+	vars[envVarPrefix+"PEER_ID"] = strconv.FormatInt(e.PeerID, 10)
+	vars[envVarPrefix+"INTERFACE"] = iface
+
+	env := make([]string, 0, len(vars))
+	for k, v := range vars {
+		env = append(env, k+"="+v)
+	}
+	sort.Strings(env)
+
+	stdin, _ := json.Marshal(map[string]any{
+		"event":      hookEvent,
+		"type":       e.Type,
+		"id":         e.ID,
+		"timestamp":  e.Time.Unix(),
+		"network_id": e.NetworkID,
+		"peer_id":    e.PeerID,
+		"interface":  iface,
+		"data":       e.Data,
+	})
+	return env, stdin
+}
+
+// topics returns the bus event types that have at least one hook.
+func (r *Runner) topics() []string {
+	var topics []string
+	for typ, hookEvents := range busEvents {
+		for _, e := range hookEvents {
+			if len(r.hooks[e]) > 0 {
+				topics = append(topics, typ)
+				break
+			}
+		}
+	}
+	sort.Strings(topics)
+	return topics
+}
+
+func (r *Runner) count() int {
+	n := 0
+	for _, hooks := range r.hooks {
+		n += len(hooks)
+	}
+	return n
+}
+
+// envName converts a JSON field name to an environment variable name.
+func envName(field string) string {
+	return envVarPrefix + strings.ToUpper(strings.Map(func(c rune) rune {
+		if (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') {
+			return c
+		}
+		return '_'
+	}, field))
+}
+
+// limitedBuffer keeps the first limit bytes written to it and discards the
+// rest, so a chatty hook cannot exhaust memory.
+type limitedBuffer struct {
+	buf       bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := b.limit - b.buf.Len(); room < len(p) {
+		b.truncated = true
+		if room > 0 {
+			b.buf.Write(p[:room])
+		}
+		return len(p), nil
+	}
+	return b.buf.Write(p)
+}
+
+func (b *limitedBuffer) String() string {
+	if b.truncated {
+		return b.buf.String() + "\n[output truncated]"
+	}
+	return b.buf.String()
+}
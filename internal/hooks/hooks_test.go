@@ -0,0 +1,209 @@
+package hooks
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/itsChris/wgpilot/internal/db"
+	"github.com/itsChris/wgpilot/internal/events"
+)
+
+type mockAudit struct {
+	mu      sync.Mutex
+	entries []db.AuditEntry
+}
+
+func (m *mockAudit) InsertAuditEntry(_ context.Context, e *db.AuditEntry) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.entries = append(m.entries, *e)
+	return nil
+}
+
+func (m *mockAudit) all() []db.AuditEntry {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]db.AuditEntry(nil), m.entries...)
+}
+
+type mockNetworks struct{}
+
+func (mockNetworks) GetNetworkByID(_ context.Context, id int64) (*db.Network, error) {
+	return &db.Network{ID: id, Interface: "wg3"}, nil
+}
+
+func testLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+// writeScript creates an executable shell script in a temp dir.
+func writeScript(t *testing.T, body string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "hook.sh")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+body), 0o755); err != nil {
+		t.Fatalf("write script: %v", err)
+	}
+	return path
+}
+
+func TestNewRunner_Validation(t *testing.T) {
+	bus := events.NewBus(0)
+	tests := []struct {
+		name string
+		hook Hook
+	}{
+		{"unknown event", Hook{Event: "peer_exploded", Command: "/bin/true"}},
+		{"relative command", Hook{Event: EventPeerOnline, Command: "notify.sh"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewRunner([]Hook{tt.hook}, bus, &mockAudit{}, nil, testLogger(), time.Second, 1); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+	if _, err := NewRunner(nil, bus, &mockAudit{}, nil, testLogger(), 0, 1); err == nil {
+		t.Error("expected error for zero timeout")
+	}
+	if _, err := NewRunner(nil, bus, &mockAudit{}, nil, testLogger(), time.Second, 0); err == nil {
+		t.Error("expected error for zero concurrency")
+	}
+}
+
+func TestRunner_PassesEnvAndStdin(t *testing.T) {
+	dir := t.TempDir()
+	script := writeScript(t, `env > "$1/env"; cat > "$1/stdin"; echo done`)
+	hook := Hook{Event: EventPeerOnline, Command: script, Args: []string{dir}}
+	audit := &mockAudit{}
+	r, err := NewRunner([]Hook{hook}, events.NewBus(0), audit, mockNetworks{}, testLogger(), 5*time.Second, 1)
+	if err != nil {
+		t.Fatalf("NewRunner: %v", err)
+	}
+
+	e := events.Event{
+		ID: 7, Type: events.TypePeerOnline, Time: time.Unix(1700000000, 0),
+		NetworkID: 2, PeerID: 5,
+		Data: map[string]any{"name": "Laptop", "public_key": "abc=", "online": true},
+	}
+	env, stdin := r.payload(context.Background(), EventPeerOnline, e)
+	res := r.Execute(context.Background(), hook, EventPeerOnline, env, stdin)
+	if res.Err != nil || res.ExitCode != 0 {
+		t.Fatalf("expected success, got %+v", res)
+	}
+	if strings.TrimSpace(res.Output) != "done" {
+		t.Errorf("expected captured output, got %q", res.Output)
+	}
+
+	gotEnv, _ := os.ReadFile(filepath.Join(dir, "env"))
+	for _, want := range []string{
+		"WGPILOT_EVENT=peer_online",
+		"WGPILOT_EVENT_TYPE=peer.online",
+		"WGPILOT_EVENT_ID=7",
+		"WGPILOT_TIMESTAMP=1700000000",
+		"WGPILOT_NETWORK_ID=2",
+		"WGPILOT_PEER_ID=5",
+		"WGPILOT_INTERFACE=wg3",
+		"WGPILOT_NAME=Laptop",
+		"WGPILOT_PUBLIC_KEY=abc=",
+		"WGPILOT_ONLINE=true",
+	} {
+		if !strings.Contains(string(gotEnv), want+"\n") {
+			t.Errorf("env missing %q:\n%s", want, gotEnv)
+		}
+	}
+
+	var payload map[string]any
+	gotStdin, _ := os.ReadFile(filepath.Join(dir, "stdin"))
+	if err := json.Unmarshal(gotStdin, &payload); err != nil {
+		t.Fatalf("stdin is not JSON: %v: %s", err, gotStdin)
+	}
+	if payload["event"] != "peer_online" || payload["interface"] != "wg3" || payload["data"].(map[string]any)["name"] != "Laptop" {
+		t.Errorf("unexpected stdin payload: %v", payload)
+	}
+
+	entries := audit.all()
+	if len(entries) != 1 || entries[0].Action != "hook.executed" || !strings.Contains(entries[0].Detail, "done") {
+		t.Errorf("expected audit entry with output, got %+v", entries)
+	}
+}
+
+func TestRunner_FailureAndTimeout(t *testing.T) {
+	audit := &mockAudit{}
+	r, err := NewRunner(nil, events.NewBus(0), audit, nil, testLogger(), 200*time.Millisecond, 1)
+	if err != nil {
+		t.Fatalf("NewRunner: %v", err)
+	}
+
+	failing := Hook{Event: EventPeerOffline, Command: writeScript(t, "echo boom >&2; exit 3")}
+	res := r.Execute(context.Background(), failing, EventPeerOffline, nil, nil)
+	if res.Err == nil || res.ExitCode != 3 || !strings.Contains(res.Output, "boom") {
+		t.Errorf("expected exit 3 with stderr captured, got %+v", res)
+	}
+
+	slow := Hook{Event: EventPeerOffline, Command: writeScript(t, "exec sleep 10")}
+	start := time.Now()
+	res = r.Execute(context.Background(), slow, EventPeerOffline, nil, nil)
+	if res.Err == nil || !strings.Contains(res.Err.Error(), "timed out") {
+		t.Errorf("expected timeout error, got %+v", res)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Errorf("hook was not killed at the timeout")
+	}
+
+	entries := audit.all()
+	if len(entries) != 2 || entries[0].Action != "hook.failed" || entries[1].Action != "hook.failed" {
+		t.Errorf("expected two hook.failed audit entries, got %+v", entries)
+	}
+}
+
+func TestRunner_RunFromBus(t *testing.T) {
+	dir := t.TempDir()
+	script := writeScript(t, `echo "$WGPILOT_EVENT" >> "$1/events"`)
+	hooks := []Hook{
+		{Event: EventNetworkUp, Command: script, Args: []string{dir}},
+		{Event: EventNetworkCreated, Command: script, Args: []string{dir}},
+	}
+	bus := events.NewBus(0)
+	audit := &mockAudit{}
+	r, err := NewRunner(hooks, bus, audit, nil, testLogger(), 5*time.Second, 1)
+	if err != nil {
+		t.Fatalf("NewRunner: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go r.Run(ctx)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for bus.Subscribers() == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	bus.Publish(events.Event{Type: events.TypePeerCreated, NetworkID: 1}) // no hook
+	bus.Publish(events.Event{Type: events.TypeNetworkCreated, NetworkID: 1, Data: map[string]any{"interface": "wg0"}})
+
+	for len(audit.all()) < 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	got, _ := os.ReadFile(filepath.Join(dir, "events"))
+	lines := strings.Fields(string(got))
+	if len(lines) != 2 || lines[0] != "network_created" || lines[1] != "network_up" {
+		t.Errorf("expected network_created then network_up, got %q", got)
+	}
+}
+
+func TestLimitedBuffer(t *testing.T) {
+	b := &limitedBuffer{limit: 4}
+	b.Write([]byte("ab"))
+	b.Write([]byte("cdef"))
+	if got := b.String(); got != "abcd\n[output truncated]" {
+		t.Errorf("unexpected buffer contents %q", got)
+	}
+}
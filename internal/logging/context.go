@@ -7,6 +7,8 @@ import (
 	"fmt"
 	"log/slog"
 	"time"
+
+	"github.com/itsChris/wgpilot/internal/tracing"
 )
 
 type contextKey string
@@ -53,8 +55,9 @@ func GenerateTaskID(name string) string {
 	return fmt.Sprintf("task_%s_%d", name, time.Now().Unix())
 }
 
-// LogAttrsFromContext extracts request_id and task_id from context
-// and returns them as slog attributes. Only non-empty values are included.
+// LogAttrsFromContext extracts request_id, task_id and trace_id from
+// context and returns them as slog attributes. Only non-empty values are
+// included.
 func LogAttrsFromContext(ctx context.Context) []slog.Attr {
 	var attrs []slog.Attr
 	if id := RequestID(ctx); id != "" {
@@ -63,5 +66,8 @@ func LogAttrsFromContext(ctx context.Context) []slog.Attr {
 	if id := TaskID(ctx); id != "" {
 		attrs = append(attrs, slog.String("task_id", id))
 	}
+	if sc, ok := tracing.SpanContextFromContext(ctx); ok && sc.IsValid() {
+		attrs = append(attrs, slog.String("trace_id", sc.TraceID.String()))
+	}
 	return attrs
 }
@@ -1,9 +1,13 @@
 package logging
 
 import (
+	"bytes"
 	"context"
+	"log/slog"
 	"strings"
 	"testing"
+
+	"github.com/itsChris/wgpilot/internal/tracing"
 )
 
 func TestRequestID_RoundTrip(t *testing.T) {
@@ -66,6 +70,37 @@ func TestLogAttrsFromContext_Both(t *testing.T) {
 	}
 }
 
+func TestLogAttrsFromContext_TraceID(t *testing.T) {
+	sc, err := tracing.ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	if err != nil {
+		t.Fatalf("ParseTraceparent: %v", err)
+	}
+	ctx := tracing.ContextWithSpanContext(context.Background(), sc)
+
+	attrs := LogAttrsFromContext(ctx)
+	if len(attrs) != 1 || attrs[0].Key != "trace_id" || attrs[0].Value.String() != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("expected trace_id attr, got %v", attrs)
+	}
+}
+
+func TestTraceHandler_AddsTraceIDs(t *testing.T) {
+	sc, _ := tracing.ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	ctx := tracing.ContextWithSpanContext(context.Background(), sc)
+
+	var buf bytes.Buffer
+	logger := slog.New(traceHandler{slog.NewJSONHandler(&buf, nil)})
+	logger.InfoContext(ctx, "peer_created")
+	logger.Info("no_context")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if !strings.Contains(lines[0], `"trace_id":"4bf92f3577b34da6a3ce929d0e0e4736"`) || !strings.Contains(lines[0], `"span_id":"00f067aa0ba902b7"`) {
+		t.Errorf("expected trace and span IDs, got %s", lines[0])
+	}
+	if strings.Contains(lines[1], "trace_id") {
+		t.Errorf("expected no trace_id without a span, got %s", lines[1])
+	}
+}
+
 func TestGenerateRequestID_Unique(t *testing.T) {
 	seen := make(map[string]bool)
 	for i := 0; i < 100; i++ {
@@ -1,8 +1,11 @@
 package logging
 
 import (
+	"context"
 	"log/slog"
 	"os"
+
+	"github.com/itsChris/wgpilot/internal/tracing"
 )
 
 // Config controls logger behavior.
@@ -27,7 +30,7 @@ func New(cfg Config) *slog.Logger {
 		handler = slog.NewJSONHandler(os.Stdout, opts)
 	}
 
-	return slog.New(handler)
+	return slog.New(traceHandler{handler})
 }
 
 // NewWithRing creates a logger that writes to both the normal output
@@ -51,5 +54,29 @@ func NewWithRing(cfg Config, ring *RingBuffer) *slog.Logger {
 		level:   cfg.Level,
 	}
 
-	return slog.New(handler)
+	return slog.New(traceHandler{handler})
+}
+
+// traceHandler adds trace_id and span_id to records logged with a context
+// that carries a span, so log lines can be matched to their trace.
+type traceHandler struct {
+	slog.Handler
+}
+
+func (h traceHandler) Handle(ctx context.Context, r slog.Record) error {
+	if sc, ok := tracing.SpanContextFromContext(ctx); ok && sc.IsValid() {
+		r.AddAttrs(
+			slog.String("trace_id", sc.TraceID.String()),
+			slog.String("span_id", sc.SpanID.String()),
+		)
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h traceHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return traceHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h traceHandler) WithGroup(name string) slog.Handler {
+	return traceHandler{h.Handler.WithGroup(name)}
 }
@@ -0,0 +1,97 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+)
+
+func scrape(t *testing.T, r *Registry) string {
+	t.Helper()
+	var b strings.Builder
+	if err := r.WriteText(&b); err != nil {
+		t.Fatalf("WriteText: %v", err)
+	}
+	return b.String()
+}
+
+func TestCounterVec(t *testing.T) {
+	r := NewRegistry()
+	c := NewCounterVec("http_requests_total", "Requests.", "method", "status")
+	r.Register(c)
+
+	c.Inc("GET", "200")
+	c.Add(2, "GET", "200")
+	c.Inc("POST", "500")
+	c.Add(-5, "POST", "500") // ignored
+
+	want := `# HELP http_requests_total Requests.
+# TYPE http_requests_total counter
+http_requests_total{method="GET",status="200"} 3
+http_requests_total{method="POST",status="500"} 1
+`
+	if got := scrape(t, r); got != want {
+		t.Errorf("unexpected output:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestHistogramVec(t *testing.T) {
+	r := NewRegistry()
+	h := NewHistogramVec("poll_seconds", "Poll time.", []float64{0.1, 1})
+	r.Register(h)
+
+	h.Observe(0.1) // le is inclusive
+	h.Observe(0.5)
+	h.Observe(3)
+
+	want := `# HELP poll_seconds Poll time.
+# TYPE poll_seconds histogram
+poll_seconds_bucket{le="0.1"} 1
+poll_seconds_bucket{le="1"} 2
+poll_seconds_bucket{le="+Inf"} 3
+poll_seconds_sum 3.6
+poll_seconds_count 3
+`
+	if got := scrape(t, r); got != want {
+		t.Errorf("unexpected output:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestRegistry_SortsFamiliesAndEscapes(t *testing.T) {
+	r := NewRegistry()
+	r.Register(CollectorFunc(func() []Family {
+		return []Family{
+			{Name: "b_gauge", Help: "Second.", Type: TypeGauge, Samples: []Sample{
+				{Labels: []Label{{Name: "peer", Value: "Bob's \"phone\"\n"}}, Value: 1},
+			}},
+			{Name: "a_gauge", Help: "First\nline.", Type: TypeGauge},
+		}
+	}))
+
+	got := scrape(t, r)
+	if !strings.HasPrefix(got, "# HELP a_gauge First\\nline.\n") {
+		t.Errorf("expected a_gauge first with escaped help, got:\n%s", got)
+	}
+	if !strings.Contains(got, `b_gauge{peer="Bob's \"phone\"\n"} 1`) {
+		t.Errorf("expected escaped label value, got:\n%s", got)
+	}
+}
+
+func TestCounterVec_LabelMismatchPanics(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("expected panic for wrong label count")
+		}
+	}()
+	NewCounterVec("x_total", "X.", "a").Inc()
+}
+
+func TestGoCollector(t *testing.T) {
+	r := NewRegistry()
+	r.Register(NewGoCollector())
+	got := scrape(t, r)
+	for _, want := range []string{"# TYPE go_goroutines gauge", "go_memstats_alloc_bytes ", "go_info{version=\"go"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("expected %q in output", want)
+		}
+	}
+}
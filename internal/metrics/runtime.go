@@ -0,0 +1,39 @@
+package metrics
+
+import (
+	"runtime"
+	"time"
+)
+
+// NewGoCollector returns a collector for Go runtime statistics: goroutines,
+// memory, garbage collection and the process start time.
+func NewGoCollector() Collector {
+	start := float64(time.Now().Unix())
+	return CollectorFunc(func() []Family {
+		var ms runtime.MemStats
+		runtime.ReadMemStats(&ms)
+
+		gauge := func(name, help string, v float64) Family {
+			return Family{Name: name, Help: help, Type: TypeGauge, Samples: []Sample{{Value: v}}}
+		}
+		counter := func(name, help string, v float64) Family {
+			return Family{Name: name, Help: help, Type: TypeCounter, Samples: []Sample{{Value: v}}}
+		}
+
+		return []Family{
+			{
+				Name: "go_info", Help: "Information about the Go environment.", Type: TypeGauge,
+				Samples: []Sample{{Labels: []Label{{Name: "version", Value: runtime.Version()}}, Value: 1}},
+			},
+			gauge("go_goroutines", "Number of goroutines that currently exist.", float64(runtime.NumGoroutine())),
+			gauge("go_memstats_alloc_bytes", "Bytes of allocated heap objects.", float64(ms.Alloc)),
+			gauge("go_memstats_heap_inuse_bytes", "Bytes in in-use heap spans.", float64(ms.HeapInuse)),
+			gauge("go_memstats_heap_objects", "Number of allocated heap objects.", float64(ms.HeapObjects)),
+			gauge("go_memstats_sys_bytes", "Bytes of memory obtained from the OS.", float64(ms.Sys)),
+			counter("go_memstats_mallocs_total", "Cumulative count of heap objects allocated.", float64(ms.Mallocs)),
+			counter("go_gc_cycles_total", "Number of completed GC cycles.", float64(ms.NumGC)),
+			counter("go_gc_pause_seconds_total", "Cumulative time spent in GC stop-the-world pauses.", float64(ms.PauseTotalNs)/1e9),
+			gauge("process_start_time_seconds", "Start time of the process since unix epoch in seconds.", start),
+		}
+	})
+}
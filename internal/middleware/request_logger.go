@@ -5,15 +5,22 @@ import (
 	"io"
 	"log/slog"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/itsChris/wgpilot/internal/auth"
 	"github.com/itsChris/wgpilot/internal/logging"
 )
 
+// RequestObserver receives the outcome of every request, e.g. for latency
+// metrics. Route is the matched mux pattern without its method, such as
+// "/api/networks/{id}", or "unmatched" when no route matched.
+type RequestObserver func(method, route string, status int, duration time.Duration)
+
 // RequestLogger logs every HTTP request and response. In dev mode,
-// request and response bodies are included for debugging.
-func RequestLogger(logger *slog.Logger, devMode bool) func(http.Handler) http.Handler {
+// request and response bodies are included for debugging. If observe is
+// non-nil it is called after each request.
+func RequestLogger(logger *slog.Logger, devMode bool, observe RequestObserver) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			start := time.Now()
@@ -39,6 +46,9 @@ func RequestLogger(logger *slog.Logger, devMode bool) func(http.Handler) http.Ha
 			next.ServeHTTP(wrapped, r)
 
 			duration := time.Since(start)
+			if observe != nil {
+				observe(r.Method, routePattern(r), wrapped.statusCode, duration)
+			}
 			attrs = append(attrs,
 				"status", wrapped.statusCode,
 				"duration_ms", duration.Milliseconds(),
@@ -65,6 +75,21 @@ func RequestLogger(logger *slog.Logger, devMode bool) func(http.Handler) http.Ha
 	}
 }
 
+// routePattern returns the path part of the pattern the mux matched. The
+// mux records it on the request it was handed, which is r as long as no
+// middleware between the logger and the mux replaces the request. Raw paths
+// are never used, so metrics cardinality stays bounded.
+func routePattern(r *http.Request) string {
+	pattern := r.Pattern
+	if i := strings.IndexByte(pattern, ' '); i >= 0 {
+		pattern = pattern[i+1:]
+	}
+	if pattern == "" {
+		return "unmatched"
+	}
+	return pattern
+}
+
 // responseWriter wraps http.ResponseWriter to capture status code, bytes written,
 // and optionally the response body.
 type responseWriter struct {
@@ -5,12 +5,13 @@ import (
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestRequestLogger_LogsRequest(t *testing.T) {
 	logger := discardLogger()
 
-	handler := RequestLogger(logger, false)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	handler := RequestLogger(logger, false, nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
 		w.Write([]byte(`{"ok":true}`))
 	}))
@@ -28,7 +29,7 @@ func TestRequestLogger_LogsRequest(t *testing.T) {
 func TestRequestLogger_CapturesStatusCode(t *testing.T) {
 	logger := discardLogger()
 
-	handler := RequestLogger(logger, false)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	handler := RequestLogger(logger, false, nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusNotFound)
 	}))
 
@@ -46,7 +47,7 @@ func TestRequestLogger_DevMode_PreservesBody(t *testing.T) {
 	logger := discardLogger()
 
 	var receivedBody string
-	handler := RequestLogger(logger, true)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	handler := RequestLogger(logger, true, nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		b := make([]byte, 128)
 		n, _ := r.Body.Read(b)
 		receivedBody = string(b[:n])
@@ -64,3 +65,26 @@ func TestRequestLogger_DevMode_PreservesBody(t *testing.T) {
 		t.Errorf("expected body %q, got %q", body, receivedBody)
 	}
 }
+
+func TestRequestLogger_ObservesMatchedRoute(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/networks/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+
+	var method, route string
+	var status int
+	handler := RequestLogger(discardLogger(), false, func(m, rt string, s int, _ time.Duration) {
+		method, route, status = m, rt, s
+	})(mux)
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/networks/42", nil))
+	if method != "GET" || route != "/api/networks/{id}" || status != http.StatusTeapot {
+		t.Errorf("unexpected observation: %s %s %d", method, route, status)
+	}
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/nope/123", nil))
+	if route != "unmatched" || status != http.StatusNotFound {
+		t.Errorf("expected unmatched 404, got %s %d", route, status)
+	}
+}
@@ -0,0 +1,71 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/itsChris/wgpilot/internal/tracing"
+)
+
+// Tracing starts a server span for every request, continuing the trace from
+// an incoming W3C traceparent header when there is one. The span is named
+// after the matched route once the mux has run. Handlers, queries and
+// kernel operations called with the request context become its children.
+func Tracing(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		if sc, err := tracing.ParseTraceparent(r.Header.Get("traceparent")); err == nil {
+			ctx = tracing.ContextWithSpanContext(ctx, sc)
+		}
+		ctx, span := tracing.Start(ctx, r.Method, tracing.KindServer,
+			tracing.String("http.request.method", r.Method),
+			tracing.String("url.path", r.URL.Path),
+		)
+		if span == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		wrapped := &statusRecorder{ResponseWriter: w, statusCode: http.StatusOK}
+		r = r.WithContext(ctx)
+		next.ServeHTTP(wrapped, r)
+
+		// The mux records the matched pattern on the request it was given.
+		route := routePattern(r)
+		span.SetName(r.Method + " " + route)
+		span.SetAttributes(
+			tracing.String("http.route", route),
+			tracing.Int("http.response.status_code", wrapped.statusCode),
+		)
+		if wrapped.statusCode >= 500 {
+			span.RecordError(httpStatusError(wrapped.statusCode))
+		}
+		span.End()
+	})
+}
+
+// statusRecorder captures the response status code.
+type statusRecorder struct {
+	http.ResponseWriter
+	statusCode  int
+	wroteHeader bool
+}
+
+func (w *statusRecorder) WriteHeader(code int) {
+	if !w.wroteHeader {
+		w.statusCode = code
+		w.wroteHeader = true
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+// Unwrap lets http.ResponseController access the underlying ResponseWriter.
+func (w *statusRecorder) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// httpStatusError marks a span failed with the response status text.
+type httpStatusError int
+
+func (e httpStatusError) Error() string {
+	return http.StatusText(int(e))
+}
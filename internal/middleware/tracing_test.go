@@ -0,0 +1,57 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/itsChris/wgpilot/internal/tracing"
+)
+
+type discardExporter struct{}
+
+func (discardExporter) Export(context.Context, []*tracing.Span) error { return nil }
+
+func TestTracing_ContinuesIncomingTrace(t *testing.T) {
+	tr, err := tracing.NewTracer(discardExporter{}, discardLogger(), 1)
+	if err != nil {
+		t.Fatalf("NewTracer: %v", err)
+	}
+	tracing.SetGlobal(tr)
+	t.Cleanup(func() { tracing.SetGlobal(nil) })
+
+	var got tracing.SpanContext
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/networks/{id}", func(w http.ResponseWriter, r *http.Request) {
+		got, _ = tracing.SpanContextFromContext(r.Context())
+	})
+
+	req := httptest.NewRequest("GET", "/api/networks/1", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	Tracing(mux).ServeHTTP(httptest.NewRecorder(), req)
+
+	if got.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("expected handler in the incoming trace, got %s", got.TraceID)
+	}
+	if got.SpanID.String() == "00f067aa0ba902b7" || !got.Sampled {
+		t.Errorf("expected a new sampled server span, got %+v", got)
+	}
+}
+
+func TestTracing_DisabledPassesThrough(t *testing.T) {
+	tracing.SetGlobal(nil)
+
+	called := false
+	handler := Tracing(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+		if _, ok := tracing.SpanContextFromContext(r.Context()); ok {
+			t.Error("expected no span when tracing is disabled")
+		}
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	if !called {
+		t.Error("expected handler to be called")
+	}
+}
@@ -1 +1,382 @@
 package monitor
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/netip"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/itsChris/wgpilot/internal/db"
+	"github.com/itsChris/wgpilot/internal/geoip"
+	"github.com/itsChris/wgpilot/internal/logging"
+	"github.com/itsChris/wgpilot/internal/notify"
+)
+
+// AlertStore abstracts database operations needed by the endpoint alerter.
+type AlertStore interface {
+	ListEnabledAlerts(ctx context.Context) ([]db.Alert, error)
+	GetPeerByID(ctx context.Context, id int64) (*db.Peer, error)
+	GetSetting(ctx context.Context, key string) (string, error)
+}
+
+// EndpointHistoryStore abstracts the roaming history read by the endpoint
+// alerter.
+type EndpointHistoryStore interface {
+	ListEndpointChangesSince(ctx context.Context, since time.Time) ([]db.PeerEndpoint, error)
+	ListPeerEndpointsSince(ctx context.Context, peerID int64, since time.Time) ([]db.PeerEndpoint, error)
+}
+
+// Locator resolves addresses to locations using an offline GeoIP database.
+type Locator interface {
+	Lookup(addr netip.Addr) (*geoip.Location, error)
+}
+
+// alertTypeEndpointCountry is logged for endpoints outside a peer's country
+// allowlist. It is driven by the peer's allowed_countries, not an alert rule.
+const alertTypeEndpointCountry = "endpoint_country"
+
+// flapKey identifies a flapping alert that has fired for a peer.
+type flapKey struct {
+	alertID, peerID int64
+}
+
+// EndpointAlerter periodically checks new peer endpoint changes against the
+// endpoint_flapping and endpoint_cidr alert rules and, with a GeoIP
+// database, against each peer's country allowlist. Flapping between two
+// addresses suggests a key shared between devices or stolen; an address
+// outside the allowed CIDRs or countries suggests a peer connecting from
+// somewhere unexpected.
+type EndpointAlerter struct {
+	store    AlertStore
+	history  EndpointHistoryStore
+	geo      Locator
+	mailer   Mailer
+	logger   *slog.Logger
+	interval time.Duration
+	now      func() time.Time
+
+	since time.Time             // changes before this have been checked
+	fired map[flapKey]time.Time // last flapping alert per rule and peer
+}
+
+// NewEndpointAlerter creates an EndpointAlerter that runs at the given
+// interval. geo and mailer are optional; without geo, country allowlists
+// are not checked, and without mailer, alerts are only logged.
+func NewEndpointAlerter(store AlertStore, history EndpointHistoryStore, geo Locator, mailer Mailer, logger *slog.Logger, interval time.Duration) (*EndpointAlerter, error) {
+	if store == nil {
+		return nil, fmt.Errorf("new endpoint alerter: store is required")
+	}
+	if history == nil {
+		return nil, fmt.Errorf("new endpoint alerter: history store is required")
+	}
+	if logger == nil {
+		return nil, fmt.Errorf("new endpoint alerter: logger is required")
+	}
+	if interval <= 0 {
+		return nil, fmt.Errorf("new endpoint alerter: interval must be positive")
+	}
+	return &EndpointAlerter{
+		store:    store,
+		history:  history,
+		geo:      geo,
+		mailer:   mailer,
+		logger:   logger.With("component", "alerts"),
+		interval: interval,
+		now:      time.Now,
+		fired:    make(map[flapKey]time.Time),
+	}, nil
+}
+
+// Run starts the alert check loop. It blocks until ctx is cancelled.
+func (a *EndpointAlerter) Run(ctx context.Context) {
+	taskID := logging.GenerateTaskID("alerts")
+	ctx = logging.WithTaskID(ctx, taskID)
+
+	a.logger.Info("endpoint_alerter_started",
+		"interval", a.interval.String(),
+		"task_id", taskID,
+	)
+
+	a.Check(ctx)
+
+	ticker := time.NewTicker(a.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			a.logger.Info("endpoint_alerter_stopped", "task_id", taskID)
+			return
+		case <-ticker.C:
+			a.Check(ctx)
+		}
+	}
+}
+
+// Check evaluates endpoint changes recorded since the previous check.
+// Exported for testing.
+func (a *EndpointAlerter) Check(ctx context.Context) {
+	now := a.now()
+	if a.since.IsZero() {
+		a.since = now.Add(-a.interval)
+	}
+
+	changes, err := a.history.ListEndpointChangesSince(ctx, a.since)
+	if err != nil {
+		a.logger.Error("alerts_list_changes_failed",
+			"error", err,
+			"error_type", fmt.Sprintf("%T", err),
+			"operation", "check",
+		)
+		return
+	}
+	if len(changes) == 0 {
+		return
+	}
+	// Timestamps have second resolution; continue after the newest change.
+	a.since = changes[len(changes)-1].Timestamp.Add(time.Second)
+
+	if a.geo != nil {
+		a.checkCountries(ctx, changes)
+	}
+
+	alerts, err := a.store.ListEnabledAlerts(ctx)
+	if err != nil {
+		a.logger.Error("alerts_list_rules_failed",
+			"error", err,
+			"error_type", fmt.Sprintf("%T", err),
+			"operation", "check",
+		)
+		return
+	}
+
+	for _, rule := range alerts {
+		switch rule.Type {
+		case db.AlertTypeEndpointCIDR:
+			a.checkCIDR(ctx, rule, changes)
+		case db.AlertTypeEndpointFlapping:
+			a.checkFlapping(ctx, rule, changes, now)
+		}
+	}
+}
+
+func (a *EndpointAlerter) checkCIDR(ctx context.Context, rule db.Alert, changes []db.PeerEndpoint) {
+	allowed, err := db.ParseCIDRThreshold(rule.Threshold)
+	if err != nil {
+		a.logger.Warn("alerts_invalid_threshold",
+			"error", err,
+			"alert_id", rule.ID,
+			"type", rule.Type,
+			"operation", "check",
+		)
+		return
+	}
+
+	for _, c := range changes {
+		addr, ok := geoip.EndpointAddr(c.Endpoint)
+		if !ok || addrAllowed(addr, allowed) {
+			continue
+		}
+		peer := a.peer(ctx, c.PeerID)
+		if peer == nil {
+			continue
+		}
+		a.fire(ctx, peer, rule.Type, rule.Notify == "email", c.Endpoint,
+			fmt.Sprintf("connected from %s, outside the allowed ranges %s", c.Endpoint, rule.Threshold))
+	}
+}
+
+func (a *EndpointAlerter) checkFlapping(ctx context.Context, rule db.Alert, changes []db.PeerEndpoint, now time.Time) {
+	threshold, window, err := db.ParseFlappingThreshold(rule.Threshold)
+	if err != nil {
+		a.logger.Warn("alerts_invalid_threshold",
+			"error", err,
+			"alert_id", rule.ID,
+			"type", rule.Type,
+			"operation", "check",
+		)
+		return
+	}
+
+	for _, c := range changes {
+		key := flapKey{alertID: rule.ID, peerID: c.PeerID}
+		if last, ok := a.fired[key]; ok && now.Sub(last) < window {
+			continue
+		}
+
+		history, err := a.history.ListPeerEndpointsSince(ctx, c.PeerID, c.Timestamp.Add(-window))
+		if err != nil {
+			a.logger.Error("alerts_list_history_failed",
+				"error", err,
+				"error_type", fmt.Sprintf("%T", err),
+				"operation", "check",
+				"peer_id", c.PeerID,
+			)
+			continue
+		}
+
+		count := 0
+		hosts := make(map[netip.Addr]bool)
+		for _, h := range history {
+			if h.Timestamp.After(c.Timestamp) {
+				break
+			}
+			count++
+			if addr, ok := geoip.EndpointAddr(h.Endpoint); ok {
+				hosts[addr] = true
+			}
+		}
+		// Roaming through many networks is normal; bouncing between the
+		// same two addresses is not. Port changes alone are NAT rebinding.
+		if count < threshold || len(hosts) != 2 {
+			continue
+		}
+
+		peer := a.peer(ctx, c.PeerID)
+		if peer == nil {
+			continue
+		}
+		a.fired[key] = now
+		a.fire(ctx, peer, rule.Type, rule.Notify == "email", c.Endpoint,
+			fmt.Sprintf("switched endpoints %d times within %s between two addresses", count, window))
+	}
+}
+
+// checkCountries alerts on endpoints located outside the peer's
+// allowed_countries. Peers without an allowlist and addresses the GeoIP
+// database does not know are skipped.
+func (a *EndpointAlerter) checkCountries(ctx context.Context, changes []db.PeerEndpoint) {
+	for _, c := range changes {
+		peer := a.peer(ctx, c.PeerID)
+		if peer == nil || peer.AllowedCountries == "" {
+			continue
+		}
+		allowed, err := geoip.ParseCountries(peer.AllowedCountries)
+		if err != nil || len(allowed) == 0 {
+			continue
+		}
+		loc := a.locate(c.Endpoint)
+		if loc == nil || loc.Country == "" || slices.Contains(allowed, loc.Country) {
+			continue
+		}
+		a.fire(ctx, peer, alertTypeEndpointCountry, true, c.Endpoint,
+			fmt.Sprintf("connected from %s in %s, outside the allowed countries %s", c.Endpoint, loc.Country, peer.AllowedCountries))
+	}
+}
+
+// peer returns the peer with the given ID, or nil if it was deleted or the
+// lookup failed.
+func (a *EndpointAlerter) peer(ctx context.Context, peerID int64) *db.Peer {
+	peer, err := a.store.GetPeerByID(ctx, peerID)
+	if err != nil {
+		a.logger.Error("alerts_get_peer_failed",
+			"error", err,
+			"error_type", fmt.Sprintf("%T", err),
+			"operation", "check",
+			"peer_id", peerID,
+		)
+		return nil
+	}
+	return peer
+}
+
+// locate returns the GeoIP location of an endpoint, or nil without a GeoIP
+// database or record.
+func (a *EndpointAlerter) locate(endpoint string) *geoip.Location {
+	if a.geo == nil {
+		return nil
+	}
+	addr, ok := geoip.EndpointAddr(endpoint)
+	if !ok {
+		return nil
+	}
+	loc, err := a.geo.Lookup(addr)
+	if err != nil {
+		a.logger.Warn("alerts_geoip_lookup_failed",
+			"error", err,
+			"endpoint", endpoint,
+			"operation", "check",
+		)
+		return nil
+	}
+	return loc
+}
+
+// fire logs an endpoint alert and, if email is set, mails the configured
+// alert address. Failures are logged, not returned.
+func (a *EndpointAlerter) fire(ctx context.Context, peer *db.Peer, alertType string, email bool, endpoint, detail string) {
+	location := describeLocation(a.locate(endpoint))
+
+	a.logger.Warn("endpoint_alert",
+		"type", alertType,
+		"peer_id", peer.ID,
+		"peer_name", peer.Name,
+		"endpoint", endpoint,
+		"location", location,
+		"detail", detail,
+		"operation", "fire",
+	)
+
+	if !email || a.mailer == nil {
+		return
+	}
+	alertEmail, err := a.store.GetSetting(ctx, "alert_email")
+	if err != nil {
+		a.logger.Error("alerts_notify_failed",
+			"error", err,
+			"peer_id", peer.ID,
+			"operation", "notify",
+		)
+		return
+	}
+	to := notify.SplitRecipients(alertEmail)
+	if len(to) == 0 {
+		return
+	}
+	subject := fmt.Sprintf("wgpilot: suspicious endpoint for peer %q", peer.Name)
+	body := notify.EndpointAlert(peer.Name, detail, alertType, location)
+	if err := a.mailer.Send(ctx, to, subject, body); err != nil {
+		a.logger.Warn("alerts_notify_failed",
+			"error", err,
+			"error_type", fmt.Sprintf("%T", err),
+			"peer_id", peer.ID,
+			"operation", "notify",
+		)
+	}
+}
+
+// describeLocation formats a location for logs and emails, e.g.
+// "Zurich, CH (AS20712 Andrews & Arnold Ltd)".
+func describeLocation(loc *geoip.Location) string {
+	if loc == nil {
+		return ""
+	}
+	var parts []string
+	if loc.City != "" {
+		parts = append(parts, loc.City)
+	}
+	if loc.Country != "" {
+		parts = append(parts, loc.Country)
+	}
+	s := strings.Join(parts, ", ")
+	if loc.ASN != 0 {
+		as := fmt.Sprintf("AS%d %s", loc.ASN, loc.ASOrg)
+		if s == "" {
+			return strings.TrimSpace(as)
+		}
+		s += " (" + strings.TrimSpace(as) + ")"
+	}
+	return s
+}
+
+func addrAllowed(addr netip.Addr, allowed []netip.Prefix) bool {
+	for _, p := range allowed {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
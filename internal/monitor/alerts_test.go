@@ -0,0 +1,263 @@
+package monitor
+
+import (
+	"context"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/itsChris/wgpilot/internal/db"
+	"github.com/itsChris/wgpilot/internal/geoip"
+)
+
+// mockLocator maps addresses to country codes.
+type mockLocator map[string]string
+
+func (m mockLocator) Lookup(addr netip.Addr) (*geoip.Location, error) {
+	country, ok := m[addr.String()]
+	if !ok {
+		return nil, nil
+	}
+	return &geoip.Location{Country: country}, nil
+}
+
+// endpointAlertFixture creates a network, a peer and an alert rule, and
+// returns the peer ID.
+func endpointAlertFixture(t *testing.T, d *db.DB, alertType, threshold string) int64 {
+	t.Helper()
+	ctx := context.Background()
+
+	netID, err := d.CreateNetwork(ctx, &db.Network{
+		Name: "Roaming", Interface: "wg0", Mode: "gateway", Subnet: "10.0.0.0/24",
+		ListenPort: 51820, PrivateKey: "priv", PublicKey: "pub", Enabled: true,
+	})
+	if err != nil {
+		t.Fatalf("create network: %v", err)
+	}
+	peerID, err := d.CreatePeer(ctx, &db.Peer{
+		NetworkID: netID, Name: "phone", PublicKey: "peer-pub",
+		AllowedIPs: "10.0.0.2/32", Role: "client", Enabled: true,
+	})
+	if err != nil {
+		t.Fatalf("create peer: %v", err)
+	}
+	if _, err := d.CreateAlert(ctx, &db.Alert{
+		Type: alertType, Threshold: threshold, Notify: "email", Enabled: true,
+	}); err != nil {
+		t.Fatalf("create alert: %v", err)
+	}
+	if err := d.SetSetting(ctx, "alert_email", "ops@example.com"); err != nil {
+		t.Fatalf("set setting: %v", err)
+	}
+	return peerID
+}
+
+// insertEndpoint records an online snapshot of the peer at endpoint.
+func insertEndpoint(t *testing.T, ts *db.TimeSeries, peerID int64, at time.Time, endpoint string) {
+	t.Helper()
+	if err := ts.InsertSnapshot(context.Background(), &db.PeerSnapshot{
+		PeerID: peerID, Timestamp: at, Online: true, Endpoint: endpoint,
+	}); err != nil {
+		t.Fatalf("insert snapshot: %v", err)
+	}
+}
+
+func TestNewEndpointAlerter_Validation(t *testing.T) {
+	d := testDBForMonitor(t)
+	ts := testTimeSeriesForMonitor(t)
+	if _, err := NewEndpointAlerter(nil, ts, nil, nil, testLogger(), time.Minute); err == nil {
+		t.Error("expected error for nil store")
+	}
+	if _, err := NewEndpointAlerter(d, nil, nil, nil, testLogger(), time.Minute); err == nil {
+		t.Error("expected error for nil history store")
+	}
+	if _, err := NewEndpointAlerter(d, ts, nil, nil, nil, time.Minute); err == nil {
+		t.Error("expected error for nil logger")
+	}
+	if _, err := NewEndpointAlerter(d, ts, nil, nil, testLogger(), 0); err == nil {
+		t.Error("expected error for zero interval")
+	}
+}
+
+func TestEndpointAlerter_Flapping(t *testing.T) {
+	d := testDBForMonitor(t)
+	ts := testTimeSeriesForMonitor(t)
+	ctx := context.Background()
+	peerID := endpointAlertFixture(t, d, db.AlertTypeEndpointFlapping, "4/10m")
+
+	mailer := &mockMailer{}
+	a, err := NewEndpointAlerter(d, ts, nil, mailer, testLogger(), time.Minute)
+	if err != nil {
+		t.Fatalf("NewEndpointAlerter: %v", err)
+	}
+	start := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	a.now = func() time.Time { return start }
+
+	// Three changes between two hosts stay below the threshold.
+	endpoints := []string{"198.51.100.7:40000", "203.0.113.1:51820", "198.51.100.7:40001"}
+	for i, ep := range endpoints {
+		insertEndpoint(t, ts, peerID, start.Add(time.Duration(i)*time.Minute), ep)
+	}
+	a.now = func() time.Time { return start.Add(3 * time.Minute) }
+	a.Check(ctx)
+	if len(mailer.subjects) != 0 {
+		t.Fatalf("expected no alert below threshold, got %d", len(mailer.subjects))
+	}
+
+	// The fourth change crosses it.
+	insertEndpoint(t, ts, peerID, start.Add(3*time.Minute), "203.0.113.1:51820")
+	a.now = func() time.Time { return start.Add(4 * time.Minute) }
+	a.Check(ctx)
+	if len(mailer.subjects) != 1 {
+		t.Fatalf("expected 1 flapping alert, got %d", len(mailer.subjects))
+	}
+	if got := mailer.to[0]; len(got) != 1 || got[0] != "ops@example.com" {
+		t.Errorf("unexpected recipients: %v", got)
+	}
+
+	// Further flapping within the window does not alert again.
+	insertEndpoint(t, ts, peerID, start.Add(4*time.Minute), "198.51.100.7:40000")
+	a.now = func() time.Time { return start.Add(5 * time.Minute) }
+	a.Check(ctx)
+	if len(mailer.subjects) != 1 {
+		t.Errorf("expected no repeat alert within window, got %d", len(mailer.subjects))
+	}
+}
+
+func TestEndpointAlerter_RoamingIsNotFlapping(t *testing.T) {
+	d := testDBForMonitor(t)
+	ts := testTimeSeriesForMonitor(t)
+	ctx := context.Background()
+	peerID := endpointAlertFixture(t, d, db.AlertTypeEndpointFlapping, "3/10m")
+
+	mailer := &mockMailer{}
+	a, err := NewEndpointAlerter(d, ts, nil, mailer, testLogger(), time.Minute)
+	if err != nil {
+		t.Fatalf("NewEndpointAlerter: %v", err)
+	}
+	start := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	a.now = func() time.Time { return start }
+
+	// Moving through three networks, and NAT rebinding the port on one.
+	endpoints := []string{"198.51.100.7:40000", "203.0.113.1:51820", "192.0.2.5:1234", "192.0.2.5:1235"}
+	for i, ep := range endpoints {
+		insertEndpoint(t, ts, peerID, start.Add(time.Duration(i)*time.Minute), ep)
+	}
+	a.now = func() time.Time { return start.Add(5 * time.Minute) }
+	a.Check(ctx)
+	if len(mailer.subjects) != 0 {
+		t.Errorf("expected no alert for roaming, got %d", len(mailer.subjects))
+	}
+}
+
+func TestEndpointAlerter_CIDR(t *testing.T) {
+	d := testDBForMonitor(t)
+	ts := testTimeSeriesForMonitor(t)
+	ctx := context.Background()
+	peerID := endpointAlertFixture(t, d, db.AlertTypeEndpointCIDR, "198.51.100.0/24, 2001:db8::/32")
+
+	mailer := &mockMailer{}
+	a, err := NewEndpointAlerter(d, ts, nil, mailer, testLogger(), time.Minute)
+	if err != nil {
+		t.Fatalf("NewEndpointAlerter: %v", err)
+	}
+	start := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	a.now = func() time.Time { return start }
+
+	insertEndpoint(t, ts, peerID, start, "198.51.100.7:40000")
+	insertEndpoint(t, ts, peerID, start.Add(time.Minute), "[2001:db8::1]:51820")
+	a.now = func() time.Time { return start.Add(2 * time.Minute) }
+	a.Check(ctx)
+	if len(mailer.subjects) != 0 {
+		t.Fatalf("expected no alert inside allowed ranges, got %d", len(mailer.subjects))
+	}
+
+	insertEndpoint(t, ts, peerID, start.Add(2*time.Minute), "203.0.113.1:51820")
+	a.now = func() time.Time { return start.Add(3 * time.Minute) }
+	a.Check(ctx)
+	if len(mailer.subjects) != 1 {
+		t.Fatalf("expected 1 CIDR alert, got %d", len(mailer.subjects))
+	}
+
+	// An already checked change is not reported again.
+	a.now = func() time.Time { return start.Add(4 * time.Minute) }
+	a.Check(ctx)
+	if len(mailer.subjects) != 1 {
+		t.Errorf("expected no repeat alert, got %d", len(mailer.subjects))
+	}
+}
+
+func TestEndpointAlerter_CountryAllowlist(t *testing.T) {
+	d := testDBForMonitor(t)
+	ts := testTimeSeriesForMonitor(t)
+	ctx := context.Background()
+	peerID := endpointAlertFixture(t, d, db.AlertTypeEndpointCIDR, "0.0.0.0/0, ::/0")
+
+	peer, err := d.GetPeerByID(ctx, peerID)
+	if err != nil {
+		t.Fatalf("get peer: %v", err)
+	}
+	peer.AllowedCountries = "CH,DE"
+	if err := d.UpdatePeer(ctx, peer); err != nil {
+		t.Fatalf("update peer: %v", err)
+	}
+
+	geo := mockLocator{"198.51.100.7": "CH", "203.0.113.1": "US"}
+	mailer := &mockMailer{}
+	a, err := NewEndpointAlerter(d, ts, geo, mailer, testLogger(), time.Minute)
+	if err != nil {
+		t.Fatalf("NewEndpointAlerter: %v", err)
+	}
+	start := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	a.now = func() time.Time { return start }
+
+	// An allowed country and an address the database doesn't know.
+	insertEndpoint(t, ts, peerID, start, "198.51.100.7:40000")
+	insertEndpoint(t, ts, peerID, start.Add(time.Minute), "192.0.2.5:1234")
+	a.now = func() time.Time { return start.Add(2 * time.Minute) }
+	a.Check(ctx)
+	if len(mailer.subjects) != 0 {
+		t.Fatalf("expected no alert for allowed or unknown countries, got %d", len(mailer.subjects))
+	}
+
+	insertEndpoint(t, ts, peerID, start.Add(2*time.Minute), "203.0.113.1:51820")
+	a.now = func() time.Time { return start.Add(3 * time.Minute) }
+	a.Check(ctx)
+	if len(mailer.subjects) != 1 {
+		t.Fatalf("expected 1 country alert, got %d", len(mailer.subjects))
+	}
+	if body := mailer.bodies[0]; !strings.HasPrefix(body, "<html>") || !strings.Contains(body, "<p>Location: US</p>") {
+		t.Errorf("expected an HTML body with the location, got %q", body)
+	}
+
+	// Without an allowlist the peer may connect from anywhere.
+	peer.AllowedCountries = ""
+	if err := d.UpdatePeer(ctx, peer); err != nil {
+		t.Fatalf("update peer: %v", err)
+	}
+	insertEndpoint(t, ts, peerID, start.Add(3*time.Minute), "198.51.100.7:40000")
+	insertEndpoint(t, ts, peerID, start.Add(4*time.Minute), "203.0.113.1:51820")
+	a.now = func() time.Time { return start.Add(5 * time.Minute) }
+	a.Check(ctx)
+	if len(mailer.subjects) != 1 {
+		t.Errorf("expected no alert without allowlist, got %d", len(mailer.subjects))
+	}
+}
+
+func TestDescribeLocation(t *testing.T) {
+	tests := []struct {
+		loc  *geoip.Location
+		want string
+	}{
+		{nil, ""},
+		{&geoip.Location{Country: "CH", City: "Zurich", ASN: 20712, ASOrg: "Andrews & Arnold Ltd"}, "Zurich, CH (AS20712 Andrews & Arnold Ltd)"},
+		{&geoip.Location{Country: "FR"}, "FR"},
+		{&geoip.Location{ASN: 64496}, "AS64496"},
+	}
+	for _, tt := range tests {
+		if got := describeLocation(tt.loc); got != tt.want {
+			t.Errorf("describeLocation(%+v) = %q, want %q", tt.loc, got, tt.want)
+		}
+	}
+}
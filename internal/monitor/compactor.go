@@ -6,10 +6,14 @@ import (
 	"log/slog"
 	"time"
 
+	"github.com/itsChris/wgpilot/internal/db"
 	"github.com/itsChris/wgpilot/internal/logging"
 )
 
-// Compactor periodically deletes old peer snapshots.
+// Compactor periodically downsamples peer snapshots into 5-minute, hourly
+// and daily rollups, and deletes raw snapshots once they are older than the
+// retention period. Rollups are pruned according to their tier's retention,
+// and endpoint history after db.EndpointRetention.
 type Compactor struct {
 	store     SnapshotStore
 	logger    *slog.Logger
@@ -18,7 +22,7 @@ type Compactor struct {
 }
 
 // NewCompactor creates a Compactor that runs at the given interval
-// and deletes snapshots older than retention.
+// and deletes raw snapshots older than retention.
 func NewCompactor(store SnapshotStore, logger *slog.Logger, interval, retention time.Duration) (*Compactor, error) {
 	if store == nil {
 		return nil, fmt.Errorf("new compactor: store is required")
@@ -65,8 +69,40 @@ func (c *Compactor) Compact(ctx context.Context) {
 }
 
 func (c *Compactor) compact(ctx context.Context) {
-	cutoff := time.Now().Add(-c.retention)
+	now := time.Now()
 
+	written, pruned, err := c.store.RollupSnapshots(ctx, now)
+	if err != nil {
+		// Keep raw snapshots until they have been rolled up.
+		c.logger.Error("rollup_failed",
+			"error", err,
+			"error_type", fmt.Sprintf("%T", err),
+			"operation", "compact",
+		)
+		return
+	}
+	if written > 0 || pruned > 0 {
+		c.logger.Info("rollup_complete",
+			"written", written,
+			"pruned", pruned,
+			"operation", "compact",
+		)
+	}
+
+	if n, err := c.store.PruneEndpoints(ctx, now.Add(-db.EndpointRetention)); err != nil {
+		c.logger.Error("endpoint_prune_failed",
+			"error", err,
+			"error_type", fmt.Sprintf("%T", err),
+			"operation", "compact",
+		)
+	} else if n > 0 {
+		c.logger.Info("endpoint_prune_complete",
+			"deleted", n,
+			"operation", "compact",
+		)
+	}
+
+	cutoff := now.Add(-c.retention)
 	deleted, err := c.store.CompactSnapshots(ctx, cutoff)
 	if err != nil {
 		c.logger.Error("compaction_failed",
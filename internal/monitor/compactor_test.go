@@ -34,37 +34,28 @@ func TestCompactor_Compact_CallsStore(t *testing.T) {
 
 	store.mu.Lock()
 	defer store.mu.Unlock()
+	if store.rolledUp != 1 {
+		t.Fatalf("expected RollupSnapshots called once, got %d", store.rolledUp)
+	}
 	if store.compacted != 1 {
 		t.Fatalf("expected CompactSnapshots called once, got %d", store.compacted)
 	}
+	if store.endpointsPruned != 1 {
+		t.Fatalf("expected PruneEndpoints called once, got %d", store.endpointsPruned)
+	}
 }
 
-func TestCompactor_Compact_WithRealDB(t *testing.T) {
-	d := testDBForMonitor(t)
+func TestCompactor_Compact_WithTimeSeries(t *testing.T) {
+	ts := testTimeSeriesForMonitor(t)
 	ctx := context.Background()
 
-	// Create network and peer.
-	netID, err := d.CreateNetwork(ctx, &db.Network{
-		Name: "Test", Interface: "wg0", Mode: "gateway",
-		Subnet: "10.0.0.0/24", ListenPort: 51820,
-		PrivateKey: "priv", PublicKey: "pub", Enabled: true,
-	})
-	if err != nil {
-		t.Fatalf("create network: %v", err)
-	}
-	peerID, err := d.CreatePeer(ctx, &db.Peer{
-		NetworkID: netID, Name: "P1", PublicKey: "pk1",
-		PrivateKey: "priv1", AllowedIPs: "10.0.0.2/32", Enabled: true,
-	})
-	if err != nil {
-		t.Fatalf("create peer: %v", err)
-	}
+	peerID := int64(1)
 
 	now := time.Now().Truncate(time.Second)
 
 	// Insert old snapshots (48h ago).
 	for i := 0; i < 5; i++ {
-		err := d.InsertSnapshot(ctx, &db.PeerSnapshot{
+		err := ts.InsertSnapshot(ctx, &db.PeerSnapshot{
 			PeerID:    peerID,
 			Timestamp: now.Add(-48*time.Hour + time.Duration(i)*time.Minute),
 			RxBytes:   int64(i * 1000),
@@ -78,7 +69,7 @@ func TestCompactor_Compact_WithRealDB(t *testing.T) {
 
 	// Insert recent snapshots.
 	for i := 0; i < 3; i++ {
-		err := d.InsertSnapshot(ctx, &db.PeerSnapshot{
+		err := ts.InsertSnapshot(ctx, &db.PeerSnapshot{
 			PeerID:    peerID,
 			Timestamp: now.Add(time.Duration(i) * time.Minute),
 			RxBytes:   int64(i * 2000),
@@ -91,7 +82,7 @@ func TestCompactor_Compact_WithRealDB(t *testing.T) {
 	}
 
 	// Compact with 24h retention.
-	compactor, err := NewCompactor(d, testLogger(), time.Hour, 24*time.Hour)
+	compactor, err := NewCompactor(ts, testLogger(), time.Hour, 24*time.Hour)
 	if err != nil {
 		t.Fatalf("NewCompactor: %v", err)
 	}
@@ -99,7 +90,7 @@ func TestCompactor_Compact_WithRealDB(t *testing.T) {
 	compactor.Compact(ctx)
 
 	// Verify old snapshots were deleted.
-	remaining, err := d.ListSnapshots(ctx, peerID, now.Add(-72*time.Hour), now.Add(time.Hour))
+	remaining, err := ts.ListSnapshots(ctx, peerID, now.Add(-72*time.Hour), now.Add(time.Hour))
 	if err != nil {
 		t.Fatalf("list remaining: %v", err)
 	}
@@ -108,6 +99,48 @@ func TestCompactor_Compact_WithRealDB(t *testing.T) {
 	}
 }
 
+func TestCompactor_Compact_KeepsRollups(t *testing.T) {
+	ts := testTimeSeriesForMonitor(t)
+	ctx := context.Background()
+
+	peerID := int64(1)
+
+	old := time.Now().Add(-72 * time.Hour).Truncate(time.Hour)
+	for i := 0; i < 3; i++ {
+		if err := ts.InsertSnapshot(ctx, &db.PeerSnapshot{
+			PeerID:    peerID,
+			Timestamp: old.Add(time.Duration(i) * time.Minute),
+			RxDelta:   100,
+			TxDelta:   50,
+			Online:    true,
+		}); err != nil {
+			t.Fatalf("insert snapshot: %v", err)
+		}
+	}
+
+	compactor, err := NewCompactor(ts, testLogger(), time.Hour, 48*time.Hour)
+	if err != nil {
+		t.Fatalf("NewCompactor: %v", err)
+	}
+	compactor.Compact(ctx)
+
+	raw, err := ts.ListSnapshots(ctx, peerID, old.Add(-time.Hour), old.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("list raw: %v", err)
+	}
+	if len(raw) != 0 {
+		t.Fatalf("expected raw snapshots deleted, got %d", len(raw))
+	}
+
+	rollups, err := ts.ListSnapshotRollups(ctx, peerID, 5*time.Minute, old.Add(-time.Hour), old.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("list rollups: %v", err)
+	}
+	if len(rollups) != 1 || rollups[0].RxDelta != 300 || rollups[0].TxDelta != 150 {
+		t.Fatalf("expected one 5m rollup of 300/150 bytes, got %+v", rollups)
+	}
+}
+
 func TestCompactor_Run_CancelsCleanly(t *testing.T) {
 	store := &mockSnapshotStore{}
 	compactor, err := NewCompactor(store, testLogger(), 50*time.Millisecond, 24*time.Hour)
@@ -147,3 +180,15 @@ func testDBForMonitor(t *testing.T) *db.DB {
 	t.Cleanup(func() { d.Close() })
 	return d
 }
+
+// testTimeSeriesForMonitor creates an in-memory time-series DB for monitor tests.
+func testTimeSeriesForMonitor(t *testing.T) *db.TimeSeries {
+	t.Helper()
+
+	ts, err := db.NewTimeSeries(context.Background(), ":memory:", testLogger(), true)
+	if err != nil {
+		t.Fatalf("db.NewTimeSeries: %v", err)
+	}
+	t.Cleanup(func() { ts.Close() })
+	return ts
+}
@@ -1 +1,90 @@
 package monitor
+
+import (
+	"time"
+
+	"github.com/itsChris/wgpilot/internal/metrics"
+)
+
+// pollBuckets are the histogram bounds, in seconds, for poll cycle duration.
+var pollBuckets = []float64{0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+// networkMetrics is the state of one network as of the last poll.
+type networkMetrics struct {
+	iface      string
+	up         bool
+	configured int // peers in the database
+	peers      []peerMetrics
+}
+
+// peerMetrics is the kernel status of one peer as of the last poll.
+type peerMetrics struct {
+	name          string
+	publicKey     string
+	online        bool
+	lastHandshake time.Time
+	rx, tx        int64
+}
+
+// Collect implements metrics.Collector. It serves the state cached by the
+// last poll, so a scrape never queries the kernel or the database.
+func (p *Poller) Collect() []metrics.Family {
+	p.mu.Lock()
+	networks := p.netMetrics
+	lastPoll := p.lastPoll
+	p.mu.Unlock()
+
+	interfaceUp := metrics.Family{Name: "wg_interface_up", Help: "Whether the WireGuard interface was up at the last poll.", Type: metrics.TypeGauge}
+	peersTotal := metrics.Family{Name: "wg_peers_total", Help: "Number of configured peers per network.", Type: metrics.TypeGauge}
+	peersOnline := metrics.Family{Name: "wg_peers_online", Help: "Number of online peers per network.", Type: metrics.TypeGauge}
+	rx := metrics.Family{Name: "wg_peer_receive_bytes_total", Help: "Bytes received from the peer, as counted by the kernel.", Type: metrics.TypeCounter}
+	tx := metrics.Family{Name: "wg_peer_transmit_bytes_total", Help: "Bytes sent to the peer, as counted by the kernel.", Type: metrics.TypeCounter}
+	online := metrics.Family{Name: "wg_peer_online", Help: "Whether the peer has a recent handshake.", Type: metrics.TypeGauge}
+	handshake := metrics.Family{Name: "wg_peer_last_handshake_seconds", Help: "Seconds since the peer's last handshake.", Type: metrics.TypeGauge}
+	lastPollTime := metrics.Family{Name: "wg_last_poll_timestamp_seconds", Help: "Unix time of the last completed poll.", Type: metrics.TypeGauge}
+
+	now := time.Now()
+	for _, n := range networks {
+		network := []metrics.Label{{Name: "network", Value: n.iface}}
+		interfaceUp.Samples = append(interfaceUp.Samples, metrics.Sample{Labels: network, Value: boolValue(n.up)})
+		if !n.up {
+			continue
+		}
+
+		var onlineCount int
+		for _, peer := range n.peers {
+			labels := []metrics.Label{
+				{Name: "network", Value: n.iface},
+				{Name: "peer", Value: peer.name},
+				{Name: "public_key", Value: peer.publicKey},
+			}
+			if peer.online {
+				onlineCount++
+			}
+			rx.Samples = append(rx.Samples, metrics.Sample{Labels: labels, Value: float64(peer.rx)})
+			tx.Samples = append(tx.Samples, metrics.Sample{Labels: labels, Value: float64(peer.tx)})
+			online.Samples = append(online.Samples, metrics.Sample{Labels: labels, Value: boolValue(peer.online)})
+			if !peer.lastHandshake.IsZero() {
+				handshake.Samples = append(handshake.Samples, metrics.Sample{
+					Labels: labels,
+					Value:  now.Sub(peer.lastHandshake).Truncate(time.Second).Seconds(),
+				})
+			}
+		}
+		peersTotal.Samples = append(peersTotal.Samples, metrics.Sample{Labels: network, Value: float64(n.configured)})
+		peersOnline.Samples = append(peersOnline.Samples, metrics.Sample{Labels: network, Value: float64(onlineCount)})
+	}
+	if !lastPoll.IsZero() {
+		lastPollTime.Samples = []metrics.Sample{{Value: float64(lastPoll.Unix())}}
+	}
+
+	families := []metrics.Family{interfaceUp, peersTotal, peersOnline, rx, tx, online, handshake, lastPollTime}
+	return append(families, p.pollDuration.Collect()...)
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -8,7 +8,9 @@ import (
 	"time"
 
 	"github.com/itsChris/wgpilot/internal/db"
+	"github.com/itsChris/wgpilot/internal/events"
 	"github.com/itsChris/wgpilot/internal/logging"
+	"github.com/itsChris/wgpilot/internal/metrics"
 	"github.com/itsChris/wgpilot/internal/wg"
 )
 
@@ -17,18 +19,34 @@ type StatusProvider interface {
 	PeerStatus(iface string) ([]wg.PeerStatus, error)
 }
 
-// SnapshotStore abstracts database operations needed by the monitor.
-type SnapshotStore interface {
+// staleSessionPolls is how many poll intervals a peer may go unseen before
+// its open session is closed.
+const staleSessionPolls = 3
+
+// PeerStore abstracts the network and peer lookups needed by the poller.
+type PeerStore interface {
 	ListNetworks(ctx context.Context) ([]db.Network, error)
 	ListPeersByNetworkID(ctx context.Context, networkID int64) ([]db.Peer, error)
-	InsertSnapshot(ctx context.Context, s *db.PeerSnapshot) error
+}
+
+// SnapshotStore abstracts time-series operations needed by the monitor.
+type SnapshotStore interface {
+	InsertSnapshots(ctx context.Context, snapshots []db.PeerSnapshot) error
+	GetPeerTraffic(ctx context.Context, peerID int64) (*db.PeerTraffic, error)
+	GetLastSnapshotBefore(ctx context.Context, peerID int64, t time.Time) (*db.PeerSnapshot, error)
+	CloseStaleSessions(ctx context.Context, before time.Time) (int64, error)
+	PruneEndpoints(ctx context.Context, before time.Time) (int64, error)
+	RollupSnapshots(ctx context.Context, now time.Time) (written, deleted int64, err error)
 	CompactSnapshots(ctx context.Context, before time.Time) (int64, error)
 }
 
-// PeerEvent represents a peer status update for SSE subscribers.
+// PeerEvent represents a peer status update for SSE subscribers. A
+// network.status event carries one per peer of the network.
 type PeerEvent struct {
 	PeerID        int64  `json:"peer_id"`
 	Name          string `json:"name"`
+	PublicKey     string `json:"public_key"`
+	Endpoint      string `json:"endpoint"`
 	Online        bool   `json:"online"`
 	LastHandshake int64  `json:"last_handshake"`
 	TransferRx    int64  `json:"transfer_rx"`
@@ -36,19 +54,38 @@ type PeerEvent struct {
 }
 
 // Poller periodically polls WireGuard peer status, stores snapshots,
-// and detects online/offline transitions.
+// and detects online/offline transitions. The status of the last poll is
+// cached for the metrics endpoint; see Collect.
 type Poller struct {
+	peers    PeerStore
 	store    SnapshotStore
 	status   StatusProvider
+	bus      *events.Bus
 	logger   *slog.Logger
 	interval time.Duration
 
 	mu        sync.Mutex
-	prevState map[int64]bool // peer ID -> online
+	prevState map[int64]bool            // peer ID -> online
+	counters  map[int64]transferCounter // peer ID -> raw counters at last poll
+
+	netMetrics   []networkMetrics
+	lastPoll     time.Time
+	pollDuration *metrics.HistogramVec
+}
+
+// transferCounter holds raw kernel transfer counters for a peer.
+type transferCounter struct {
+	rx, tx int64
 }
 
-// NewPoller creates a Poller that polls at the given interval.
-func NewPoller(store SnapshotStore, status StatusProvider, logger *slog.Logger, interval time.Duration) (*Poller, error) {
+// NewPoller creates a Poller that polls at the given interval. Peers are
+// read from peers and each cycle's snapshots are written to store in a
+// single batch. If bus is non-nil, each cycle publishes the live status of
+// every network and the peers' online/offline transitions.
+func NewPoller(peers PeerStore, store SnapshotStore, status StatusProvider, bus *events.Bus, logger *slog.Logger, interval time.Duration) (*Poller, error) {
+	if peers == nil {
+		return nil, fmt.Errorf("new poller: peer store is required")
+	}
 	if store == nil {
 		return nil, fmt.Errorf("new poller: store is required")
 	}
@@ -59,11 +96,16 @@ func NewPoller(store SnapshotStore, status StatusProvider, logger *slog.Logger,
 		return nil, fmt.Errorf("new poller: logger is required")
 	}
 	return &Poller{
+		peers:     peers,
 		store:     store,
 		status:    status,
+		bus:       bus,
 		logger:    logger.With("component", "monitor"),
 		interval:  interval,
 		prevState: make(map[int64]bool),
+		counters:  make(map[int64]transferCounter),
+		pollDuration: metrics.NewHistogramVec("wg_poll_duration_seconds",
+			"Time taken by a WireGuard status poll cycle.", pollBuckets),
 	}, nil
 }
 
@@ -99,7 +141,10 @@ func (p *Poller) Poll(ctx context.Context) {
 }
 
 func (p *Poller) poll(ctx context.Context) {
-	networks, err := p.store.ListNetworks(ctx)
+	start := time.Now()
+	defer func() { p.pollDuration.Observe(time.Since(start).Seconds()) }()
+
+	networks, err := p.peers.ListNetworks(ctx)
 	if err != nil {
 		p.logger.Error("poll_list_networks_failed",
 			"error", err,
@@ -110,9 +155,12 @@ func (p *Poller) poll(ctx context.Context) {
 	}
 
 	now := time.Now()
+	var batch []db.PeerSnapshot
+	netMetrics := make([]networkMetrics, 0, len(networks))
 
 	for _, net := range networks {
 		if !net.Enabled {
+			netMetrics = append(netMetrics, networkMetrics{iface: net.Interface})
 			continue
 		}
 
@@ -125,10 +173,11 @@ func (p *Poller) poll(ctx context.Context) {
 				"network_id", net.ID,
 				"interface", net.Interface,
 			)
+			netMetrics = append(netMetrics, networkMetrics{iface: net.Interface})
 			continue
 		}
 
-		peers, err := p.store.ListPeersByNetworkID(ctx, net.ID)
+		peers, err := p.peers.ListPeersByNetworkID(ctx, net.ID)
 		if err != nil {
 			p.logger.Error("poll_list_peers_failed",
 				"error", err,
@@ -136,6 +185,7 @@ func (p *Poller) poll(ctx context.Context) {
 				"operation", "poll",
 				"network_id", net.ID,
 			)
+			netMetrics = append(netMetrics, networkMetrics{iface: net.Interface, up: true})
 			continue
 		}
 
@@ -144,21 +194,35 @@ func (p *Poller) poll(ctx context.Context) {
 			peerByKey[peer.PublicKey] = peer
 		}
 
+		peerEvents := make([]PeerEvent, 0, len(statuses))
+		nm := networkMetrics{iface: net.Interface, up: true, configured: len(peers)}
 		for _, s := range statuses {
 			peer, ok := peerByKey[s.PublicKey]
 			if !ok {
 				continue
 			}
+			nm.peers = append(nm.peers, peerMetrics{
+				name:          peer.Name,
+				publicKey:     s.PublicKey,
+				online:        s.Online,
+				lastHandshake: s.LastHandshake,
+				rx:            s.TransferRx,
+				tx:            s.TransferTx,
+			})
+			peerEvents = append(peerEvents, PeerEvent{
+				PeerID:        peer.ID,
+				Name:          peer.Name,
+				PublicKey:     s.PublicKey,
+				Endpoint:      s.Endpoint,
+				Online:        s.Online,
+				LastHandshake: s.LastHandshake.Unix(),
+				TransferRx:    s.TransferRx,
+				TransferTx:    s.TransferTx,
+			})
 
-			snapshot := &db.PeerSnapshot{
-				PeerID:    peer.ID,
-				Timestamp: now,
-				RxBytes:   s.TransferRx,
-				TxBytes:   s.TransferTx,
-				Online:    s.Online,
-			}
-			if err := p.store.InsertSnapshot(ctx, snapshot); err != nil {
-				p.logger.Error("poll_insert_snapshot_failed",
+			last, err := p.lastCounter(ctx, peer.ID)
+			if err != nil {
+				p.logger.Error("poll_get_traffic_failed",
 					"error", err,
 					"error_type", fmt.Sprintf("%T", err),
 					"operation", "poll",
@@ -167,9 +231,40 @@ func (p *Poller) poll(ctx context.Context) {
 				continue
 			}
 
+			batch = append(batch, db.PeerSnapshot{
+				PeerID:    peer.ID,
+				Timestamp: now,
+				RxBytes:   s.TransferRx,
+				TxBytes:   s.TransferTx,
+				RxDelta:   counterDelta(last.rx, s.TransferRx),
+				TxDelta:   counterDelta(last.tx, s.TransferTx),
+				Online:    s.Online,
+				Endpoint:  s.Endpoint,
+			})
+			if s.TransferRx < last.rx || s.TransferTx < last.tx {
+				p.logger.Info("peer_counter_reset",
+					"peer_id", peer.ID,
+					"peer_name", peer.Name,
+					"network", net.Interface,
+					"prev_rx", last.rx,
+					"prev_tx", last.tx,
+					"operation", "poll",
+				)
+			}
 			p.mu.Lock()
 			prev, known := p.prevState[peer.ID]
 			if known && prev != s.Online {
+				eventType := events.TypePeerOffline
+				if s.Online {
+					eventType = events.TypePeerOnline
+				}
+				p.bus.Publish(events.Event{
+					Type:      eventType,
+					Time:      now,
+					NetworkID: net.ID,
+					PeerID:    peer.ID,
+					Data:      map[string]any{"name": peer.Name, "endpoint": s.Endpoint},
+				})
 				if s.Online {
 					p.logger.Info("peer_online",
 						"peer_id", peer.ID,
@@ -189,5 +284,94 @@ func (p *Poller) poll(ctx context.Context) {
 			p.prevState[peer.ID] = s.Online
 			p.mu.Unlock()
 		}
+
+		netMetrics = append(netMetrics, nm)
+
+		p.bus.Publish(events.Event{
+			Type:      events.TypeNetworkStatus,
+			Time:      now,
+			NetworkID: net.ID,
+			Data:      peerEvents,
+		})
+	}
+
+	p.mu.Lock()
+	p.netMetrics = netMetrics
+	p.lastPoll = now
+	p.mu.Unlock()
+
+	if n, err := p.store.CloseStaleSessions(ctx, now.Add(-staleSessionPolls*p.interval)); err != nil {
+		p.logger.Error("poll_close_stale_sessions_failed",
+			"error", err,
+			"error_type", fmt.Sprintf("%T", err),
+			"operation", "poll",
+		)
+	} else if n > 0 {
+		p.logger.Info("peer_sessions_closed_stale",
+			"sessions", n,
+			"operation", "poll",
+		)
+	}
+
+	if err := p.store.InsertSnapshots(ctx, batch); err != nil {
+		// Counters stay at their previous values, so the next cycle's
+		// deltas still cover the traffic from this one.
+		p.logger.Error("poll_insert_snapshots_failed",
+			"error", err,
+			"error_type", fmt.Sprintf("%T", err),
+			"operation", "poll",
+			"snapshots", len(batch),
+		)
+		return
+	}
+
+	p.mu.Lock()
+	for _, s := range batch {
+		p.counters[s.PeerID] = transferCounter{rx: s.RxBytes, tx: s.TxBytes}
+	}
+	p.mu.Unlock()
+}
+
+// lastCounter returns the raw counters recorded at the peer's previous poll.
+// After a restart the baseline is loaded from the store, so traffic that
+// happened while wgpilot was down is still counted.
+func (p *Poller) lastCounter(ctx context.Context, peerID int64) (transferCounter, error) {
+	p.mu.Lock()
+	c, ok := p.counters[peerID]
+	p.mu.Unlock()
+	if ok {
+		return c, nil
+	}
+
+	t, err := p.store.GetPeerTraffic(ctx, peerID)
+	if err != nil {
+		return transferCounter{}, err
+	}
+	if t != nil {
+		return transferCounter{rx: t.LastRx, tx: t.LastTx}, nil
+	}
+
+	// No totals yet, but snapshots from before traffic tracking: their
+	// counters are the baseline, not new traffic.
+	s, err := p.store.GetLastSnapshotBefore(ctx, peerID, time.Now())
+	if err != nil {
+		return transferCounter{}, err
+	}
+	if s == nil {
+		// Never polled: the kernel counters started at zero when the peer
+		// was added, so everything counted so far is new traffic.
+		return transferCounter{}, nil
+	}
+	return transferCounter{rx: s.RxBytes, tx: s.TxBytes}, nil
+}
+
+// counterDelta returns the bytes transferred between two readings of a
+// monotonic kernel counter. A reading lower than the previous one means the
+// counter was reset (interface recreated or peer re-added), so the current
+// value is all new traffic.
+func counterDelta(prev, cur int64) int64 {
+	if cur >= prev {
+		return cur - prev
 	}
+	return cur
 }
@@ -2,6 +2,7 @@ package monitor
 
 import (
 	"context"
+	"errors"
 	"io"
 	"log/slog"
 	"sync"
@@ -9,6 +10,7 @@ import (
 	"time"
 
 	"github.com/itsChris/wgpilot/internal/db"
+	"github.com/itsChris/wgpilot/internal/events"
 	"github.com/itsChris/wgpilot/internal/wg"
 )
 
@@ -17,7 +19,14 @@ type mockSnapshotStore struct {
 	networks  []db.Network
 	peers     map[int64][]db.Peer // networkID -> peers
 	snapshots []*db.PeerSnapshot
+	traffic   map[int64]*db.PeerTraffic
+	insertErr error
+	batches   int
+	rolledUp  int64
 	compacted int64
+
+	staleBefore     time.Time
+	endpointsPruned int64
 }
 
 func (m *mockSnapshotStore) ListNetworks(ctx context.Context) ([]db.Network, error) {
@@ -32,13 +41,58 @@ func (m *mockSnapshotStore) ListPeersByNetworkID(ctx context.Context, networkID
 	return m.peers[networkID], nil
 }
 
-func (m *mockSnapshotStore) InsertSnapshot(ctx context.Context, s *db.PeerSnapshot) error {
+func (m *mockSnapshotStore) InsertSnapshots(ctx context.Context, snapshots []db.PeerSnapshot) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
-	m.snapshots = append(m.snapshots, s)
+	if m.insertErr != nil {
+		return m.insertErr
+	}
+	m.batches++
+	for i := range snapshots {
+		m.snapshots = append(m.snapshots, &snapshots[i])
+	}
 	return nil
 }
 
+func (m *mockSnapshotStore) GetPeerTraffic(ctx context.Context, peerID int64) (*db.PeerTraffic, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.traffic[peerID], nil
+}
+
+func (m *mockSnapshotStore) GetLastSnapshotBefore(ctx context.Context, peerID int64, t time.Time) (*db.PeerSnapshot, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var last *db.PeerSnapshot
+	for _, s := range m.snapshots {
+		if s.PeerID == peerID && s.Timestamp.Before(t) && (last == nil || s.Timestamp.After(last.Timestamp)) {
+			last = s
+		}
+	}
+	return last, nil
+}
+
+func (m *mockSnapshotStore) CloseStaleSessions(ctx context.Context, before time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.staleBefore = before
+	return 0, nil
+}
+
+func (m *mockSnapshotStore) PruneEndpoints(ctx context.Context, before time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.endpointsPruned++
+	return 0, nil
+}
+
+func (m *mockSnapshotStore) RollupSnapshots(ctx context.Context, now time.Time) (int64, int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.rolledUp++
+	return 0, 0, nil
+}
+
 func (m *mockSnapshotStore) CompactSnapshots(ctx context.Context, before time.Time) (int64, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -67,22 +121,29 @@ func testLogger() *slog.Logger {
 	return slog.New(slog.NewTextHandler(io.Discard, nil))
 }
 
+func TestNewPoller_NilPeerStore(t *testing.T) {
+	_, err := NewPoller(nil, &mockSnapshotStore{}, &mockStatusProvider{}, nil, testLogger(), time.Second)
+	if err == nil {
+		t.Fatal("expected error for nil peer store")
+	}
+}
+
 func TestNewPoller_NilStore(t *testing.T) {
-	_, err := NewPoller(nil, &mockStatusProvider{}, testLogger(), time.Second)
+	_, err := NewPoller(&mockSnapshotStore{}, nil, &mockStatusProvider{}, nil, testLogger(), time.Second)
 	if err == nil {
 		t.Fatal("expected error for nil store")
 	}
 }
 
 func TestNewPoller_NilStatus(t *testing.T) {
-	_, err := NewPoller(&mockSnapshotStore{}, nil, testLogger(), time.Second)
+	_, err := NewPoller(&mockSnapshotStore{}, &mockSnapshotStore{}, nil, nil, testLogger(), time.Second)
 	if err == nil {
 		t.Fatal("expected error for nil status provider")
 	}
 }
 
 func TestNewPoller_NilLogger(t *testing.T) {
-	_, err := NewPoller(&mockSnapshotStore{}, &mockStatusProvider{}, nil, time.Second)
+	_, err := NewPoller(&mockSnapshotStore{}, &mockSnapshotStore{}, &mockStatusProvider{}, nil, nil, time.Second)
 	if err == nil {
 		t.Fatal("expected error for nil logger")
 	}
@@ -104,13 +165,13 @@ func TestPoller_Poll_StoresSnapshots(t *testing.T) {
 	status := &mockStatusProvider{
 		statuses: map[string][]wg.PeerStatus{
 			"wg0": {
-				{PublicKey: "pubkey1", Online: true, TransferRx: 1000, TransferTx: 2000, LastHandshake: time.Now()},
+				{PublicKey: "pubkey1", Endpoint: "203.0.113.5:51820", Online: true, TransferRx: 1000, TransferTx: 2000, LastHandshake: time.Now()},
 				{PublicKey: "pubkey2", Online: false, TransferRx: 500, TransferTx: 100},
 			},
 		},
 	}
 
-	poller, err := NewPoller(store, status, testLogger(), time.Second)
+	poller, err := NewPoller(store, store, status, nil, testLogger(), time.Second)
 	if err != nil {
 		t.Fatalf("NewPoller: %v", err)
 	}
@@ -124,6 +185,14 @@ func TestPoller_Poll_StoresSnapshots(t *testing.T) {
 	store.mu.Lock()
 	defer store.mu.Unlock()
 
+	if store.batches != 1 {
+		t.Errorf("expected snapshots written in 1 batch, got %d", store.batches)
+	}
+	// Sessions unseen for a few poll intervals are closed.
+	if age := time.Since(store.staleBefore); age < staleSessionPolls*time.Second || age > time.Minute {
+		t.Errorf("expected sessions older than %d intervals closed, got cutoff %s ago", staleSessionPolls, age)
+	}
+
 	// Verify first snapshot.
 	s := store.snapshots[0]
 	if s.PeerID != 10 {
@@ -132,6 +201,9 @@ func TestPoller_Poll_StoresSnapshots(t *testing.T) {
 	if s.RxBytes != 1000 {
 		t.Errorf("expected rx=1000, got %d", s.RxBytes)
 	}
+	if s.Endpoint != "203.0.113.5:51820" {
+		t.Errorf("expected endpoint 203.0.113.5:51820, got %q", s.Endpoint)
+	}
 	if !s.Online {
 		t.Error("expected online=true for first peer")
 	}
@@ -166,7 +238,7 @@ func TestPoller_Poll_DetectsTransitions(t *testing.T) {
 		},
 	}
 
-	poller, err := NewPoller(store, status, testLogger(), time.Second)
+	poller, err := NewPoller(store, store, status, nil, testLogger(), time.Second)
 	if err != nil {
 		t.Fatalf("NewPoller: %v", err)
 	}
@@ -195,6 +267,219 @@ func TestPoller_Poll_DetectsTransitions(t *testing.T) {
 	poller.mu.Unlock()
 }
 
+func TestPoller_Poll_PublishesEvents(t *testing.T) {
+	store := &mockSnapshotStore{
+		networks: []db.Network{
+			{ID: 1, Name: "Test", Interface: "wg0", Enabled: true},
+		},
+		peers: map[int64][]db.Peer{
+			1: {
+				{ID: 10, NetworkID: 1, PublicKey: "pubkey1", Name: "Peer1"},
+			},
+		},
+	}
+
+	status := &mockStatusProvider{
+		statuses: map[string][]wg.PeerStatus{
+			"wg0": {
+				{PublicKey: "pubkey1", Online: true, TransferRx: 1000, TransferTx: 2000},
+			},
+		},
+	}
+
+	bus := events.NewBus(0)
+	poller, err := NewPoller(store, store, status, bus, testLogger(), time.Second)
+	if err != nil {
+		t.Fatalf("NewPoller: %v", err)
+	}
+
+	poller.Poll(context.Background())
+
+	e, ok := bus.Latest(events.Filter{Topics: []string{events.TypeNetworkStatus}, NetworkID: 1})
+	if !ok {
+		t.Fatal("expected a network.status event")
+	}
+	peers, ok := e.Data.([]PeerEvent)
+	if !ok || len(peers) != 1 || peers[0].PeerID != 10 || peers[0].PublicKey != "pubkey1" || !peers[0].Online {
+		t.Errorf("unexpected status payload: %+v", e.Data)
+	}
+
+	status.mu.Lock()
+	status.statuses["wg0"][0].Online = false
+	status.mu.Unlock()
+	poller.Poll(context.Background())
+
+	e, ok = bus.Latest(events.Filter{Topics: []string{"peer"}})
+	if !ok || e.Type != events.TypePeerOffline || e.PeerID != 10 || e.NetworkID != 1 {
+		t.Errorf("expected peer.offline for peer 10, got %+v", e)
+	}
+}
+
+func TestPoller_Poll_ComputesDeltas(t *testing.T) {
+	store := &mockSnapshotStore{
+		networks: []db.Network{
+			{ID: 1, Name: "Test", Interface: "wg0", Enabled: true},
+		},
+		peers: map[int64][]db.Peer{
+			1: {
+				{ID: 10, NetworkID: 1, PublicKey: "pubkey1", Name: "Peer1"},
+			},
+		},
+		// Counters persisted before a restart.
+		traffic: map[int64]*db.PeerTraffic{
+			10: {PeerID: 10, LastRx: 400, LastTx: 900},
+		},
+	}
+
+	status := &mockStatusProvider{
+		statuses: map[string][]wg.PeerStatus{
+			"wg0": {
+				{PublicKey: "pubkey1", Online: true, TransferRx: 1000, TransferTx: 2000},
+			},
+		},
+	}
+
+	poller, err := NewPoller(store, store, status, nil, testLogger(), time.Second)
+	if err != nil {
+		t.Fatalf("NewPoller: %v", err)
+	}
+
+	poller.Poll(context.Background())
+
+	// Interface recreated: counters drop back towards zero.
+	status.mu.Lock()
+	status.statuses["wg0"][0].TransferRx = 300
+	status.statuses["wg0"][0].TransferTx = 50
+	status.mu.Unlock()
+	poller.Poll(context.Background())
+
+	status.mu.Lock()
+	status.statuses["wg0"][0].TransferRx = 500
+	status.statuses["wg0"][0].TransferTx = 150
+	status.mu.Unlock()
+	poller.Poll(context.Background())
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	want := []struct{ rx, tx int64 }{
+		{600, 1100}, // relative to the stored baseline
+		{300, 50},   // counter reset
+		{200, 100},
+	}
+	if len(store.snapshots) != len(want) {
+		t.Fatalf("expected %d snapshots, got %d", len(want), len(store.snapshots))
+	}
+	for i, w := range want {
+		s := store.snapshots[i]
+		if s.RxDelta != w.rx || s.TxDelta != w.tx {
+			t.Errorf("snapshot %d: expected delta %d/%d, got %d/%d", i, w.rx, w.tx, s.RxDelta, s.TxDelta)
+		}
+	}
+}
+
+func TestPoller_Poll_BaselineFromLegacySnapshot(t *testing.T) {
+	// A snapshot written before traffic totals were tracked.
+	store := &mockSnapshotStore{
+		networks: []db.Network{
+			{ID: 1, Name: "Test", Interface: "wg0", Enabled: true},
+		},
+		peers: map[int64][]db.Peer{
+			1: {
+				{ID: 10, NetworkID: 1, PublicKey: "pubkey1", Name: "Peer1"},
+			},
+		},
+		snapshots: []*db.PeerSnapshot{
+			{PeerID: 10, Timestamp: time.Now().Add(-time.Minute), RxBytes: 1000, TxBytes: 2000},
+		},
+	}
+	status := &mockStatusProvider{
+		statuses: map[string][]wg.PeerStatus{
+			"wg0": {
+				{PublicKey: "pubkey1", Online: true, TransferRx: 1500, TransferTx: 2100},
+			},
+		},
+	}
+
+	poller, err := NewPoller(store, store, status, nil, testLogger(), time.Second)
+	if err != nil {
+		t.Fatalf("NewPoller: %v", err)
+	}
+	poller.Poll(context.Background())
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if len(store.snapshots) != 2 {
+		t.Fatalf("expected 2 snapshots, got %d", len(store.snapshots))
+	}
+	if s := store.snapshots[1]; s.RxDelta != 500 || s.TxDelta != 100 {
+		t.Errorf("expected delta 500/100 from the stored snapshot, got %d/%d", s.RxDelta, s.TxDelta)
+	}
+}
+
+func TestPoller_Poll_FailedBatchKeepsCounters(t *testing.T) {
+	store := &mockSnapshotStore{
+		networks: []db.Network{
+			{ID: 1, Name: "Test", Interface: "wg0", Enabled: true},
+		},
+		peers: map[int64][]db.Peer{
+			1: {
+				{ID: 10, NetworkID: 1, PublicKey: "pubkey1", Name: "Peer1"},
+			},
+		},
+		insertErr: errors.New("disk full"),
+	}
+
+	status := &mockStatusProvider{
+		statuses: map[string][]wg.PeerStatus{
+			"wg0": {
+				{PublicKey: "pubkey1", Online: true, TransferRx: 1000, TransferTx: 2000},
+			},
+		},
+	}
+
+	poller, err := NewPoller(store, store, status, nil, testLogger(), time.Second)
+	if err != nil {
+		t.Fatalf("NewPoller: %v", err)
+	}
+	poller.Poll(context.Background())
+
+	store.mu.Lock()
+	store.insertErr = nil
+	store.mu.Unlock()
+	status.mu.Lock()
+	status.statuses["wg0"][0].TransferRx = 1500
+	status.mu.Unlock()
+	poller.Poll(context.Background())
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if len(store.snapshots) != 1 {
+		t.Fatalf("expected 1 stored snapshot, got %d", len(store.snapshots))
+	}
+	// The failed cycle's traffic is carried into the next one.
+	if s := store.snapshots[0]; s.RxDelta != 1500 || s.TxDelta != 2000 {
+		t.Errorf("expected delta 1500/2000, got %d/%d", s.RxDelta, s.TxDelta)
+	}
+}
+
+func TestCounterDelta(t *testing.T) {
+	tests := []struct {
+		prev, cur, want int64
+	}{
+		{0, 0, 0},
+		{0, 500, 500},
+		{100, 500, 400},
+		{500, 500, 0},
+		{500, 200, 200}, // reset
+	}
+	for _, tt := range tests {
+		if got := counterDelta(tt.prev, tt.cur); got != tt.want {
+			t.Errorf("counterDelta(%d, %d) = %d, want %d", tt.prev, tt.cur, got, tt.want)
+		}
+	}
+}
+
 func TestPoller_Poll_SkipsDisabledNetworks(t *testing.T) {
 	store := &mockSnapshotStore{
 		networks: []db.Network{
@@ -208,7 +493,7 @@ func TestPoller_Poll_SkipsDisabledNetworks(t *testing.T) {
 		},
 	}
 
-	poller, err := NewPoller(store, status, testLogger(), time.Second)
+	poller, err := NewPoller(store, store, status, nil, testLogger(), time.Second)
 	if err != nil {
 		t.Fatalf("NewPoller: %v", err)
 	}
@@ -241,7 +526,7 @@ func TestPoller_Poll_SkipsUnknownPeers(t *testing.T) {
 		},
 	}
 
-	poller, err := NewPoller(store, status, testLogger(), time.Second)
+	poller, err := NewPoller(store, store, status, nil, testLogger(), time.Second)
 	if err != nil {
 		t.Fatalf("NewPoller: %v", err)
 	}
@@ -259,7 +544,7 @@ func TestPoller_Run_CancelsCleanly(t *testing.T) {
 	}
 	status := &mockStatusProvider{}
 
-	poller, err := NewPoller(store, status, testLogger(), 50*time.Millisecond)
+	poller, err := NewPoller(store, store, status, nil, testLogger(), 50*time.Millisecond)
 	if err != nil {
 		t.Fatalf("NewPoller: %v", err)
 	}
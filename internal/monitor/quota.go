@@ -0,0 +1,389 @@
+package monitor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/itsChris/wgpilot/internal/db"
+	"github.com/itsChris/wgpilot/internal/logging"
+	"github.com/itsChris/wgpilot/internal/notify"
+	"github.com/itsChris/wgpilot/internal/wg"
+)
+
+// Quota warning thresholds, in percent of the monthly quota.
+const (
+	quotaWarnPercent     = 80
+	quotaExceededPercent = 100
+)
+
+// QuotaStore abstracts database operations needed by the quota enforcer.
+type QuotaStore interface {
+	ListQuotaPeers(ctx context.Context) ([]db.Peer, error)
+	GetPeerQuotaState(ctx context.Context, peerID int64) (*db.PeerQuotaState, error)
+	UpsertPeerQuotaState(ctx context.Context, s *db.PeerQuotaState) error
+	UpdatePeer(ctx context.Context, p *db.Peer) error
+	GetNetworkByID(ctx context.Context, id int64) (*db.Network, error)
+	GetSetting(ctx context.Context, key string) (string, error)
+}
+
+// UsageStore abstracts the traffic totals the quota enforcer checks
+// against each peer's quota.
+type UsageStore interface {
+	PeerUsageSince(ctx context.Context, peerID int64, since time.Time) (rx, tx int64, err error)
+}
+
+// PeerManager abstracts adding and removing WireGuard peers.
+type PeerManager interface {
+	AddPeer(ctx context.Context, iface string, cfg wg.PeerConfig) error
+	RemovePeer(ctx context.Context, iface, publicKey string) error
+}
+
+// PeerThrottler abstracts per-peer bandwidth limiting.
+type PeerThrottler interface {
+	ThrottlePeer(ctx context.Context, iface, address string, bytesPerSec uint64) error
+	UnthrottlePeer(ctx context.Context, iface, address string) error
+}
+
+// Mailer abstracts outbound email notifications.
+type Mailer interface {
+	Send(ctx context.Context, to []string, subject, body string) error
+}
+
+// QuotaEnforcer periodically compares each peer's usage in the current
+// billing cycle against its monthly quota. It warns at 80% and 100%,
+// disables or throttles peers past the limit, and lifts the restriction
+// when a new cycle starts.
+type QuotaEnforcer struct {
+	store        QuotaStore
+	usage        UsageStore
+	peers        PeerManager
+	throttler    PeerThrottler
+	mailer       Mailer
+	logger       *slog.Logger
+	interval     time.Duration
+	throttleRate uint64
+	now          func() time.Time
+}
+
+// NewQuotaEnforcer creates a QuotaEnforcer that runs at the given interval.
+// peers, throttler and mailer are optional. throttleRate is the bandwidth
+// in bytes per second applied to peers whose quota action is "throttle".
+func NewQuotaEnforcer(store QuotaStore, usage UsageStore, peers PeerManager, throttler PeerThrottler, mailer Mailer, logger *slog.Logger, interval time.Duration, throttleRate uint64) (*QuotaEnforcer, error) {
+	if store == nil {
+		return nil, fmt.Errorf("new quota enforcer: store is required")
+	}
+	if usage == nil {
+		return nil, fmt.Errorf("new quota enforcer: usage store is required")
+	}
+	if logger == nil {
+		return nil, fmt.Errorf("new quota enforcer: logger is required")
+	}
+	if interval <= 0 {
+		return nil, fmt.Errorf("new quota enforcer: interval must be positive")
+	}
+	return &QuotaEnforcer{
+		store:        store,
+		usage:        usage,
+		peers:        peers,
+		throttler:    throttler,
+		mailer:       mailer,
+		logger:       logger.With("component", "quota"),
+		interval:     interval,
+		throttleRate: throttleRate,
+		now:          time.Now,
+	}, nil
+}
+
+// Run starts the quota enforcement loop. It blocks until ctx is cancelled.
+func (q *QuotaEnforcer) Run(ctx context.Context) {
+	taskID := logging.GenerateTaskID("quota")
+	ctx = logging.WithTaskID(ctx, taskID)
+
+	q.logger.Info("quota_enforcer_started",
+		"interval", q.interval.String(),
+		"task_id", taskID,
+	)
+
+	q.Check(ctx)
+
+	ticker := time.NewTicker(q.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			q.logger.Info("quota_enforcer_stopped", "task_id", taskID)
+			return
+		case <-ticker.C:
+			q.Check(ctx)
+		}
+	}
+}
+
+// Check evaluates every peer with a quota once. Exported for testing.
+func (q *QuotaEnforcer) Check(ctx context.Context) {
+	peers, err := q.store.ListQuotaPeers(ctx)
+	if err != nil {
+		q.logger.Error("quota_list_failed",
+			"error", err,
+			"error_type", fmt.Sprintf("%T", err),
+			"operation", "check",
+		)
+		return
+	}
+
+	now := q.now()
+	for i := range peers {
+		if err := q.evaluate(ctx, &peers[i], now); err != nil {
+			q.logger.Error("quota_evaluate_failed",
+				"error", err,
+				"error_type", fmt.Sprintf("%T", err),
+				"peer_id", peers[i].ID,
+				"peer_name", peers[i].Name,
+				"operation", "check",
+			)
+		}
+	}
+}
+
+func (q *QuotaEnforcer) evaluate(ctx context.Context, peer *db.Peer, now time.Time) error {
+	cycleStart := db.QuotaCycleStart(now, peer.QuotaResetDay)
+	cycleEnd := cycleStart.AddDate(0, 1, 0)
+
+	state, err := q.store.GetPeerQuotaState(ctx, peer.ID)
+	if err != nil {
+		return err
+	}
+	if state == nil {
+		state = &db.PeerQuotaState{PeerID: peer.ID, CycleStart: cycleStart}
+	}
+
+	network, err := q.store.GetNetworkByID(ctx, peer.NetworkID)
+	if err != nil {
+		return err
+	}
+
+	// New cycle, or quota removed: lift any enforcement and start over.
+	if !state.CycleStart.Equal(cycleStart) || peer.QuotaBytes <= 0 {
+		if state.EnforcedAction != "" {
+			if err := q.lift(ctx, peer, network, state.EnforcedAction); err != nil {
+				return err
+			}
+			q.logger.Info("peer_quota_reset",
+				"peer_id", peer.ID,
+				"peer_name", peer.Name,
+				"network_id", peer.NetworkID,
+				"quota_action", state.EnforcedAction,
+				"operation", "check",
+			)
+		}
+		state.CycleStart = cycleStart
+		state.WarnedPercent = 0
+		state.EnforcedAction = ""
+		if peer.QuotaBytes <= 0 {
+			return q.store.UpsertPeerQuotaState(ctx, state)
+		}
+	}
+
+	rx, tx, err := q.usage.PeerUsageSince(ctx, peer.ID, cycleStart)
+	if err != nil {
+		return err
+	}
+	used := rx + tx
+	percent := int(used * 100 / peer.QuotaBytes)
+
+	switch {
+	case percent >= quotaExceededPercent && state.WarnedPercent < quotaExceededPercent:
+		applied, err := q.enforce(ctx, peer, network)
+		if err != nil {
+			return err
+		}
+		state.EnforcedAction = applied
+		state.WarnedPercent = quotaExceededPercent
+		q.logger.Warn("peer_quota_exceeded",
+			"peer_id", peer.ID,
+			"peer_name", peer.Name,
+			"network_id", peer.NetworkID,
+			"used_bytes", used,
+			"quota_bytes", peer.QuotaBytes,
+			"quota_action", peer.QuotaAction,
+			"enforced_action", applied,
+			"operation", "check",
+		)
+		q.notify(ctx, peer, "Data quota exceeded: "+peer.Name,
+			notify.QuotaExceededAlert(peer.Name, networkName(network), peer.QuotaAction, used, peer.QuotaBytes, cycleEnd.Format("2006-01-02")))
+
+	case percent >= quotaWarnPercent && state.WarnedPercent < quotaWarnPercent:
+		state.WarnedPercent = quotaWarnPercent
+		q.logger.Info("peer_quota_warning",
+			"peer_id", peer.ID,
+			"peer_name", peer.Name,
+			"network_id", peer.NetworkID,
+			"used_bytes", used,
+			"quota_bytes", peer.QuotaBytes,
+			"percent", percent,
+			"operation", "check",
+		)
+		q.notify(ctx, peer, fmt.Sprintf("Data quota at %d%%: %s", quotaWarnPercent, peer.Name),
+			notify.QuotaWarningAlert(peer.Name, networkName(network), quotaWarnPercent, used, peer.QuotaBytes, cycleEnd.Format("2006-01-02")))
+
+	case state.EnforcedAction == db.QuotaActionThrottle:
+		// Firewall rules live in memory; re-assert the throttle so it
+		// survives restarts. ThrottlePeer is idempotent.
+		if err := q.throttle(ctx, peer, network); err != nil {
+			return err
+		}
+	}
+
+	return q.store.UpsertPeerQuotaState(ctx, state)
+}
+
+// enforce applies the peer's quota action and returns the action actually
+// taken, so that only restrictions added by the enforcer are lifted again.
+// An empty result means nothing was changed.
+func (q *QuotaEnforcer) enforce(ctx context.Context, peer *db.Peer, network *db.Network) (string, error) {
+	if peer.QuotaAction == db.QuotaActionThrottle {
+		if q.throttler != nil {
+			return db.QuotaActionThrottle, q.throttle(ctx, peer, network)
+		}
+		q.logger.Warn("quota_throttle_unavailable",
+			"peer_id", peer.ID,
+			"operation", "enforce",
+		)
+	}
+
+	if !peer.Enabled {
+		return "", nil
+	}
+	peer.Enabled = false
+	if err := q.store.UpdatePeer(ctx, peer); err != nil {
+		return "", err
+	}
+	if q.peers != nil && network != nil && network.Enabled {
+		if err := q.peers.RemovePeer(ctx, network.Interface, peer.PublicKey); err != nil {
+			q.logger.Error("quota_remove_peer_failed",
+				"error", err,
+				"peer_id", peer.ID,
+				"interface", network.Interface,
+				"operation", "enforce",
+			)
+		}
+	}
+	return db.QuotaActionDisable, nil
+}
+
+// lift undoes a restriction previously applied by enforce. A peer that
+// has expired since it was disabled stays disabled.
+func (q *QuotaEnforcer) lift(ctx context.Context, peer *db.Peer, network *db.Network, action string) error {
+	if action == db.QuotaActionThrottle {
+		if q.throttler == nil || network == nil {
+			return nil
+		}
+		var errs []error
+		for _, addr := range peerAddresses(peer) {
+			errs = append(errs, q.throttler.UnthrottlePeer(ctx, network.Interface, addr))
+		}
+		return errors.Join(errs...)
+	}
+
+	if peer.Enabled {
+		return nil
+	}
+	if peer.ExpiresAt != nil && !peer.ExpiresAt.After(q.now()) {
+		q.logger.Info("quota_lift_skipped_expired",
+			"peer_id", peer.ID,
+			"peer_name", peer.Name,
+			"operation", "lift",
+		)
+		return nil
+	}
+	peer.Enabled = true
+	if err := q.store.UpdatePeer(ctx, peer); err != nil {
+		return err
+	}
+	if q.peers != nil && network != nil && network.Enabled {
+		cfg := wg.PeerConfig{
+			Name:                peer.Name,
+			PublicKey:           peer.PublicKey,
+			PresharedKey:        peer.PresharedKey,
+			AllowedIPs:          peer.AllowedIPs,
+			Endpoint:            peer.Endpoint,
+			PersistentKeepalive: peer.PersistentKeepalive,
+		}
+		if err := q.peers.AddPeer(ctx, network.Interface, cfg); err != nil {
+			q.logger.Error("quota_add_peer_failed",
+				"error", err,
+				"peer_id", peer.ID,
+				"interface", network.Interface,
+				"operation", "lift",
+			)
+		}
+	}
+	return nil
+}
+
+func (q *QuotaEnforcer) throttle(ctx context.Context, peer *db.Peer, network *db.Network) error {
+	if q.throttler == nil || network == nil {
+		return nil
+	}
+	var errs []error
+	for _, addr := range peerAddresses(peer) {
+		errs = append(errs, q.throttler.ThrottlePeer(ctx, network.Interface, addr, q.throttleRate))
+	}
+	return errors.Join(errs...)
+}
+
+// notify emails the configured alert address and the peer's own address.
+// Failures are logged, not returned, so they never block enforcement.
+func (q *QuotaEnforcer) notify(ctx context.Context, peer *db.Peer, subject, body string) {
+	if q.mailer == nil {
+		return
+	}
+	alertEmail, err := q.store.GetSetting(ctx, "alert_email")
+	if err != nil {
+		q.logger.Error("quota_notify_failed",
+			"error", err,
+			"peer_id", peer.ID,
+			"operation", "notify",
+		)
+		return
+	}
+	to := notify.SplitRecipients(alertEmail)
+	if peer.Email != "" {
+		to = append(to, peer.Email)
+	}
+	if len(to) == 0 {
+		return
+	}
+	if err := q.mailer.Send(ctx, to, subject, body); err != nil {
+		q.logger.Warn("quota_notify_failed",
+			"error", err,
+			"error_type", fmt.Sprintf("%T", err),
+			"peer_id", peer.ID,
+			"operation", "notify",
+		)
+	}
+}
+
+// peerAddresses returns every entry of the peer's allowed IPs: its tunnel
+// addresses and, for a site peer, the networks behind it.
+func peerAddresses(peer *db.Peer) []string {
+	var addrs []string
+	for _, addr := range strings.Split(peer.AllowedIPs, ",") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			addrs = append(addrs, addr)
+		}
+	}
+	return addrs
+}
+
+func networkName(n *db.Network) string {
+	if n == nil {
+		return ""
+	}
+	return n.Name
+}
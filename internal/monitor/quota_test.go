@@ -0,0 +1,324 @@
+package monitor
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/itsChris/wgpilot/internal/db"
+	"github.com/itsChris/wgpilot/internal/testutil"
+	"github.com/itsChris/wgpilot/internal/wg"
+)
+
+type mockPeerManager struct {
+	mu      sync.Mutex
+	added   []string
+	removed []string
+}
+
+func (m *mockPeerManager) AddPeer(ctx context.Context, iface string, cfg wg.PeerConfig) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.added = append(m.added, cfg.PublicKey)
+	return nil
+}
+
+func (m *mockPeerManager) RemovePeer(ctx context.Context, iface, publicKey string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.removed = append(m.removed, publicKey)
+	return nil
+}
+
+type mockMailer struct {
+	mu       sync.Mutex
+	subjects []string
+	bodies   []string
+	to       [][]string
+}
+
+func (m *mockMailer) Send(ctx context.Context, to []string, subject, body string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.subjects = append(m.subjects, subject)
+	m.bodies = append(m.bodies, body)
+	m.to = append(m.to, to)
+	return nil
+}
+
+// quotaFixture creates a network and a peer with a 1000-byte quota that
+// resets on the 1st, and returns the peer ID.
+func quotaFixture(t *testing.T, d *db.DB, action string) int64 {
+	t.Helper()
+	ctx := context.Background()
+
+	netID, err := d.CreateNetwork(ctx, &db.Network{
+		Name: "Quota", Interface: "wg0", Mode: "gateway", Subnet: "10.0.0.0/24",
+		ListenPort: 51820, PrivateKey: "priv", PublicKey: "pub", Enabled: true,
+	})
+	if err != nil {
+		t.Fatalf("create network: %v", err)
+	}
+	peerID, err := d.CreatePeer(ctx, &db.Peer{
+		NetworkID: netID, Name: "metered", Email: "user@example.com",
+		PublicKey: "peer-pub", AllowedIPs: "10.0.0.2/32", Role: "client", Enabled: true,
+		QuotaBytes: 1000, QuotaResetDay: 1, QuotaAction: action,
+	})
+	if err != nil {
+		t.Fatalf("create peer: %v", err)
+	}
+	if err := d.SetSetting(ctx, "alert_email", "ops@example.com"); err != nil {
+		t.Fatalf("set setting: %v", err)
+	}
+	return peerID
+}
+
+// insertUsage records a snapshot in which the peer transferred n bytes.
+func insertUsage(t *testing.T, ts *db.TimeSeries, peerID int64, at time.Time, n int64) {
+	t.Helper()
+	if err := ts.InsertSnapshot(context.Background(), &db.PeerSnapshot{
+		PeerID: peerID, Timestamp: at, RxBytes: n, RxDelta: n, Online: true,
+	}); err != nil {
+		t.Fatalf("insert snapshot: %v", err)
+	}
+}
+
+func TestNewQuotaEnforcer_Validation(t *testing.T) {
+	ts := testTimeSeriesForMonitor(t)
+	if _, err := NewQuotaEnforcer(nil, ts, nil, nil, nil, testLogger(), time.Minute, 1000); err == nil {
+		t.Error("expected error for nil store")
+	}
+	d := testDBForMonitor(t)
+	if _, err := NewQuotaEnforcer(d, nil, nil, nil, nil, testLogger(), time.Minute, 1000); err == nil {
+		t.Error("expected error for nil usage store")
+	}
+	if _, err := NewQuotaEnforcer(d, ts, nil, nil, nil, nil, time.Minute, 1000); err == nil {
+		t.Error("expected error for nil logger")
+	}
+	if _, err := NewQuotaEnforcer(d, ts, nil, nil, nil, testLogger(), 0, 1000); err == nil {
+		t.Error("expected error for zero interval")
+	}
+}
+
+func TestQuotaEnforcer_WarnDisableAndReset(t *testing.T) {
+	d := testDBForMonitor(t)
+	ts := testTimeSeriesForMonitor(t)
+	ctx := context.Background()
+	peerID := quotaFixture(t, d, db.QuotaActionDisable)
+
+	peers := &mockPeerManager{}
+	mailer := &mockMailer{}
+	q, err := NewQuotaEnforcer(d, ts, peers, nil, mailer, testLogger(), time.Minute, 0)
+	if err != nil {
+		t.Fatalf("NewQuotaEnforcer: %v", err)
+	}
+
+	cycle := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	q.now = func() time.Time { return cycle.Add(48 * time.Hour) }
+
+	insertUsage(t, ts, peerID, cycle.Add(-time.Hour), 5000) // previous cycle
+	insertUsage(t, ts, peerID, cycle.Add(time.Hour), 850)   // 85%
+
+	q.Check(ctx)
+	if len(mailer.subjects) != 1 {
+		t.Fatalf("expected 1 warning email, got %d", len(mailer.subjects))
+	}
+	if got := mailer.to[0]; len(got) != 2 || got[0] != "ops@example.com" || got[1] != "user@example.com" {
+		t.Errorf("unexpected recipients: %v", got)
+	}
+
+	// A second check in the same state must not warn again.
+	q.Check(ctx)
+	if len(mailer.subjects) != 1 {
+		t.Fatalf("expected warning to be sent once, got %d emails", len(mailer.subjects))
+	}
+
+	insertUsage(t, ts, peerID, cycle.Add(2*time.Hour), 250) // 110%
+	q.Check(ctx)
+
+	peer, err := d.GetPeerByID(ctx, peerID)
+	if err != nil {
+		t.Fatalf("get peer: %v", err)
+	}
+	if peer.Enabled {
+		t.Fatal("expected peer to be disabled after exceeding quota")
+	}
+	if len(peers.removed) != 1 || peers.removed[0] != "peer-pub" {
+		t.Errorf("expected peer removed from WireGuard, got %v", peers.removed)
+	}
+	if len(mailer.subjects) != 2 {
+		t.Fatalf("expected exceeded email, got %d emails", len(mailer.subjects))
+	}
+
+	// Next cycle: the peer is re-enabled and re-added.
+	q.now = func() time.Time { return cycle.AddDate(0, 1, 1) }
+	q.Check(ctx)
+
+	peer, err = d.GetPeerByID(ctx, peerID)
+	if err != nil {
+		t.Fatalf("get peer: %v", err)
+	}
+	if !peer.Enabled {
+		t.Fatal("expected peer to be re-enabled in the new cycle")
+	}
+	if len(peers.added) != 1 {
+		t.Errorf("expected peer re-added to WireGuard, got %v", peers.added)
+	}
+	state, err := d.GetPeerQuotaState(ctx, peerID)
+	if err != nil {
+		t.Fatalf("get state: %v", err)
+	}
+	if state.EnforcedAction != "" || state.WarnedPercent != 0 {
+		t.Errorf("expected state reset, got %+v", state)
+	}
+}
+
+func TestQuotaEnforcer_ManuallyDisabledPeerStaysDisabled(t *testing.T) {
+	d := testDBForMonitor(t)
+	ts := testTimeSeriesForMonitor(t)
+	ctx := context.Background()
+	peerID := quotaFixture(t, d, db.QuotaActionDisable)
+
+	peer, _ := d.GetPeerByID(ctx, peerID)
+	peer.Enabled = false
+	if err := d.UpdatePeer(ctx, peer); err != nil {
+		t.Fatalf("update peer: %v", err)
+	}
+
+	q, err := NewQuotaEnforcer(d, ts, &mockPeerManager{}, nil, nil, testLogger(), time.Minute, 0)
+	if err != nil {
+		t.Fatalf("NewQuotaEnforcer: %v", err)
+	}
+	cycle := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	q.now = func() time.Time { return cycle.Add(48 * time.Hour) }
+
+	insertUsage(t, ts, peerID, cycle.Add(time.Hour), 2000)
+	q.Check(ctx)
+
+	q.now = func() time.Time { return cycle.AddDate(0, 1, 1) }
+	q.Check(ctx)
+
+	peer, _ = d.GetPeerByID(ctx, peerID)
+	if peer.Enabled {
+		t.Error("quota reset must not re-enable a peer the enforcer did not disable")
+	}
+}
+
+func TestQuotaEnforcer_ResetLeavesOtherDisablesAlone(t *testing.T) {
+	cycle := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name  string
+		after func(t *testing.T, d *db.DB, peer *db.Peer)
+	}{
+		{"expired", func(t *testing.T, d *db.DB, peer *db.Peer) {
+			expired := cycle.AddDate(0, 0, 10)
+			peer.ExpiresAt = &expired
+			if err := d.UpdatePeer(context.Background(), peer); err != nil {
+				t.Fatalf("update peer: %v", err)
+			}
+		}},
+		{"disabled by admin", func(t *testing.T, d *db.DB, peer *db.Peer) {
+			if err := d.ClearPeerQuotaDisable(context.Background(), peer.ID); err != nil {
+				t.Fatalf("ClearPeerQuotaDisable: %v", err)
+			}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := testDBForMonitor(t)
+			ts := testTimeSeriesForMonitor(t)
+			ctx := context.Background()
+			peerID := quotaFixture(t, d, db.QuotaActionDisable)
+
+			peers := &mockPeerManager{}
+			q, err := NewQuotaEnforcer(d, ts, peers, nil, nil, testLogger(), time.Minute, 0)
+			if err != nil {
+				t.Fatalf("NewQuotaEnforcer: %v", err)
+			}
+			q.now = func() time.Time { return cycle.Add(48 * time.Hour) }
+			insertUsage(t, ts, peerID, cycle.Add(time.Hour), 2000)
+			q.Check(ctx)
+
+			peer, _ := d.GetPeerByID(ctx, peerID)
+			if peer.Enabled {
+				t.Fatal("expected peer to be disabled after exceeding quota")
+			}
+			tt.after(t, d, peer)
+
+			q.now = func() time.Time { return cycle.AddDate(0, 1, 1) }
+			q.Check(ctx)
+
+			peer, _ = d.GetPeerByID(ctx, peerID)
+			if peer.Enabled || len(peers.added) != 0 {
+				t.Error("quota reset must not re-enable the peer")
+			}
+		})
+	}
+}
+
+func TestQuotaEnforcer_Throttle(t *testing.T) {
+	d := testDBForMonitor(t)
+	ts := testTimeSeriesForMonitor(t)
+	ctx := context.Background()
+	peerID := quotaFixture(t, d, db.QuotaActionThrottle)
+
+	nft := testutil.NewMockNFTManager()
+	q, err := NewQuotaEnforcer(d, ts, &mockPeerManager{}, nft, nil, testLogger(), time.Minute, 16000)
+	if err != nil {
+		t.Fatalf("NewQuotaEnforcer: %v", err)
+	}
+	cycle := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	q.now = func() time.Time { return cycle.Add(48 * time.Hour) }
+
+	insertUsage(t, ts, peerID, cycle.Add(time.Hour), 1500)
+	q.Check(ctx)
+
+	peer, _ := d.GetPeerByID(ctx, peerID)
+	if !peer.Enabled {
+		t.Error("throttled peer should stay enabled")
+	}
+	if rate := nft.Throttles["wg0:10.0.0.2/32"]; rate != 16000 {
+		t.Fatalf("expected throttle at 16000 B/s, got %d", rate)
+	}
+
+	q.now = func() time.Time { return cycle.AddDate(0, 1, 1) }
+	q.Check(ctx)
+	if _, ok := nft.Throttles["wg0:10.0.0.2/32"]; ok {
+		t.Error("expected throttle removed in the new cycle")
+	}
+}
+
+func TestQuotaEnforcer_ThrottleDualStack(t *testing.T) {
+	d := testDBForMonitor(t)
+	ts := testTimeSeriesForMonitor(t)
+	ctx := context.Background()
+	peerID := quotaFixture(t, d, db.QuotaActionThrottle)
+	peer, _ := d.GetPeerByID(ctx, peerID)
+	peer.AllowedIPs = "10.0.0.2/32, fd00::2/128"
+	if err := d.UpdatePeer(ctx, peer); err != nil {
+		t.Fatalf("update peer: %v", err)
+	}
+
+	nft := testutil.NewMockNFTManager()
+	q, err := NewQuotaEnforcer(d, ts, &mockPeerManager{}, nft, nil, testLogger(), time.Minute, 16000)
+	if err != nil {
+		t.Fatalf("NewQuotaEnforcer: %v", err)
+	}
+	cycle := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	q.now = func() time.Time { return cycle.Add(48 * time.Hour) }
+
+	insertUsage(t, ts, peerID, cycle.Add(time.Hour), 1500)
+	q.Check(ctx)
+	for _, key := range []string{"wg0:10.0.0.2/32", "wg0:fd00::2/128"} {
+		if rate := nft.Throttles[key]; rate != 16000 {
+			t.Errorf("expected %s throttled at 16000 B/s, got %d", key, rate)
+		}
+	}
+
+	q.now = func() time.Time { return cycle.AddDate(0, 1, 1) }
+	q.Check(ctx)
+	if len(nft.Throttles) != 0 {
+		t.Errorf("expected every throttle removed in the new cycle, got %v", nft.Throttles)
+	}
+}
@@ -0,0 +1,274 @@
+package monitor
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/itsChris/wgpilot/internal/db"
+	"github.com/itsChris/wgpilot/internal/logging"
+)
+
+// Webhook delivery tuning.
+const (
+	webhookBatchSize   = 50
+	webhookMaxAttempts = 8 // about two hours of retries
+	webhookBaseBackoff = 30 * time.Second
+	webhookMaxBackoff  = time.Hour
+	webhookTimeout     = 10 * time.Second
+	webhookRetention   = 30 * 24 * time.Hour
+	webhookErrorLimit  = 500
+)
+
+// Webhook request headers.
+const (
+	WebhookEventHeader     = "X-Wgpilot-Event"
+	WebhookDeliveryHeader  = "X-Wgpilot-Delivery"
+	WebhookSignatureHeader = "X-Wgpilot-Signature"
+)
+
+// WebhookStore abstracts the webhook queue operations needed by the
+// dispatcher.
+type WebhookStore interface {
+	GetWebhookByID(ctx context.Context, id int64) (*db.Webhook, error)
+	ListDueWebhookDeliveries(ctx context.Context, now time.Time, limit int) ([]db.WebhookDelivery, error)
+	MarkWebhookDelivered(ctx context.Context, id int64, statusCode int, at time.Time) error
+	MarkWebhookAttemptFailed(ctx context.Context, id int64, statusCode int, errMsg string, next time.Time) error
+	PruneWebhookDeliveries(ctx context.Context, before time.Time) (int64, error)
+}
+
+// WebhookDispatcher sends queued resource-change events to webhook
+// subscribers. A delivery is only marked delivered after a 2xx response, so
+// every event arrives at least once; failed attempts are retried with
+// exponential backoff.
+type WebhookDispatcher struct {
+	store     WebhookStore
+	client    *http.Client
+	logger    *slog.Logger
+	interval  time.Duration
+	now       func() time.Time
+	lastPrune time.Time
+}
+
+// NewWebhookDispatcher creates a WebhookDispatcher that checks the queue at
+// the given interval. client is optional.
+func NewWebhookDispatcher(store WebhookStore, client *http.Client, logger *slog.Logger, interval time.Duration) (*WebhookDispatcher, error) {
+	if store == nil {
+		return nil, fmt.Errorf("new webhook dispatcher: store is required")
+	}
+	if logger == nil {
+		return nil, fmt.Errorf("new webhook dispatcher: logger is required")
+	}
+	if interval <= 0 {
+		return nil, fmt.Errorf("new webhook dispatcher: interval must be positive")
+	}
+	if client == nil {
+		client = &http.Client{Timeout: webhookTimeout}
+	}
+	return &WebhookDispatcher{
+		store:    store,
+		client:   client,
+		logger:   logger.With("component", "webhooks"),
+		interval: interval,
+		now:      time.Now,
+	}, nil
+}
+
+// Run starts the dispatch loop. It blocks until ctx is cancelled.
+func (d *WebhookDispatcher) Run(ctx context.Context) {
+	taskID := logging.GenerateTaskID("webhooks")
+	ctx = logging.WithTaskID(ctx, taskID)
+
+	d.logger.Info("webhook_dispatcher_started",
+		"interval", d.interval.String(),
+		"task_id", taskID,
+	)
+
+	d.Dispatch(ctx)
+
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			d.logger.Info("webhook_dispatcher_stopped", "task_id", taskID)
+			return
+		case <-ticker.C:
+			d.Dispatch(ctx)
+		}
+	}
+}
+
+// Dispatch sends up to one batch of due deliveries and prunes old finished
+// ones. Exported for testing.
+func (d *WebhookDispatcher) Dispatch(ctx context.Context) {
+	now := d.now()
+
+	due, err := d.store.ListDueWebhookDeliveries(ctx, now, webhookBatchSize)
+	if err != nil {
+		d.logger.Error("webhook_list_due_failed",
+			"error", err,
+			"error_type", fmt.Sprintf("%T", err),
+			"operation", "webhook_dispatch",
+		)
+		return
+	}
+	webhooks := make(map[int64]*db.Webhook)
+	for _, del := range due {
+		w, ok := webhooks[del.WebhookID]
+		if !ok {
+			w, err = d.store.GetWebhookByID(ctx, del.WebhookID)
+			if err != nil {
+				d.logger.Error("webhook_get_failed",
+					"error", err,
+					"webhook_id", del.WebhookID,
+					"operation", "webhook_dispatch",
+				)
+				continue
+			}
+			webhooks[del.WebhookID] = w
+		}
+		if w == nil {
+			continue
+		}
+		d.deliver(ctx, w, del)
+	}
+
+	if now.Sub(d.lastPrune) >= time.Hour {
+		d.lastPrune = now
+		pruned, err := d.store.PruneWebhookDeliveries(ctx, now.Add(-webhookRetention))
+		if err != nil {
+			d.logger.Error("webhook_prune_failed",
+				"error", err,
+				"operation", "webhook_dispatch",
+			)
+		} else if pruned > 0 {
+			d.logger.Info("webhook_deliveries_pruned",
+				"deleted", pruned,
+				"operation", "webhook_dispatch",
+			)
+		}
+	}
+}
+
+// deliver makes one attempt to send a delivery and records the outcome.
+func (d *WebhookDispatcher) deliver(ctx context.Context, w *db.Webhook, del db.WebhookDelivery) {
+	statusCode, err := d.send(ctx, w, del)
+	now := d.now()
+
+	if err == nil {
+		if err := d.store.MarkWebhookDelivered(ctx, del.ID, statusCode, now); err != nil {
+			d.logger.Error("webhook_mark_delivered_failed",
+				"error", err,
+				"delivery_id", del.ID,
+				"operation", "webhook_dispatch",
+			)
+			return
+		}
+		d.logger.Debug("webhook_delivered",
+			"webhook_id", w.ID,
+			"delivery_id", del.ID,
+			"event_type", del.EventType,
+			"status_code", statusCode,
+			"operation", "webhook_dispatch",
+		)
+		return
+	}
+
+	attempts := del.Attempts + 1
+	var next time.Time
+	if attempts < webhookMaxAttempts {
+		next = now.Add(webhookBackoff(attempts))
+	}
+	msg := err.Error()
+	if len(msg) > webhookErrorLimit {
+		msg = msg[:webhookErrorLimit]
+	}
+	if err := d.store.MarkWebhookAttemptFailed(ctx, del.ID, statusCode, msg, next); err != nil {
+		d.logger.Error("webhook_mark_failed_failed",
+			"error", err,
+			"delivery_id", del.ID,
+			"operation", "webhook_dispatch",
+		)
+		return
+	}
+
+	if next.IsZero() {
+		d.logger.Error("webhook_delivery_failed",
+			"error", msg,
+			"webhook_id", w.ID,
+			"delivery_id", del.ID,
+			"event_type", del.EventType,
+			"attempts", attempts,
+			"operation", "webhook_dispatch",
+		)
+		return
+	}
+	d.logger.Warn("webhook_attempt_failed",
+		"error", msg,
+		"webhook_id", w.ID,
+		"delivery_id", del.ID,
+		"event_type", del.EventType,
+		"attempts", attempts,
+		"next_attempt_at", next.Unix(),
+		"operation", "webhook_dispatch",
+	)
+}
+
+// send POSTs the signed payload. It returns the response status code, and an
+// error for transport failures and non-2xx responses.
+func (d *WebhookDispatcher) send(ctx context.Context, w *db.Webhook, del db.WebhookDelivery) (int, error) {
+	body := []byte(del.Payload)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, fmt.Errorf("build request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "wgpilot-webhooks")
+	req.Header.Set(WebhookEventHeader, del.EventType)
+	req.Header.Set(WebhookDeliveryHeader, del.EventID)
+	req.Header.Set(WebhookSignatureHeader, SignWebhookPayload(w.Secret, d.now().Unix(), body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// SignWebhookPayload returns the X-Wgpilot-Signature header value for body:
+// "t=<unix timestamp>,v1=<hex HMAC-SHA256 of "<timestamp>.<body>">". Receivers
+// recompute the HMAC with the shared secret and reject stale timestamps.
+func SignWebhookPayload(secret string, timestamp int64, body []byte) string {
+	ts := strconv.FormatInt(timestamp, 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(ts))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "t=" + ts + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// webhookBackoff returns the delay before the next attempt after the given
+// number of failed attempts: 30s, 1m, 2m, ... capped at an hour.
+func webhookBackoff(attempts int) time.Duration {
+	delay := webhookBaseBackoff << (attempts - 1)
+	if delay > webhookMaxBackoff || delay <= 0 {
+		return webhookMaxBackoff
+	}
+	return delay
+}
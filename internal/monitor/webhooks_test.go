@@ -0,0 +1,207 @@
+package monitor
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/itsChris/wgpilot/internal/db"
+)
+
+// webhookReceiver records requests and answers with the configured status.
+type webhookReceiver struct {
+	mu       sync.Mutex
+	status   int
+	requests []*http.Request
+	bodies   []string
+}
+
+func (rcv *webhookReceiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	rcv.mu.Lock()
+	defer rcv.mu.Unlock()
+	rcv.requests = append(rcv.requests, r)
+	rcv.bodies = append(rcv.bodies, string(body))
+	w.WriteHeader(rcv.status)
+}
+
+func (rcv *webhookReceiver) count() int {
+	rcv.mu.Lock()
+	defer rcv.mu.Unlock()
+	return len(rcv.requests)
+}
+
+func TestNewWebhookDispatcher_Validation(t *testing.T) {
+	d := testDBForMonitor(t)
+	if _, err := NewWebhookDispatcher(nil, nil, testLogger(), time.Second); err == nil {
+		t.Error("expected error for nil store")
+	}
+	if _, err := NewWebhookDispatcher(d, nil, nil, time.Second); err == nil {
+		t.Error("expected error for nil logger")
+	}
+	if _, err := NewWebhookDispatcher(d, nil, testLogger(), 0); err == nil {
+		t.Error("expected error for zero interval")
+	}
+}
+
+func TestWebhookDispatcher_SignsAndDelivers(t *testing.T) {
+	d := testDBForMonitor(t)
+	ctx := context.Background()
+
+	rcv := &webhookReceiver{status: http.StatusNoContent}
+	srv := httptest.NewServer(rcv)
+	defer srv.Close()
+
+	id, err := d.CreateWebhook(ctx, &db.Webhook{URL: srv.URL, Secret: "s3cret", Enabled: true})
+	if err != nil {
+		t.Fatalf("create webhook: %v", err)
+	}
+	payload := `{"id":"evt_1","type":"peer.created"}`
+	if _, err := d.EnqueueWebhookEvent(ctx, "evt_1", "peer.created", payload); err != nil {
+		t.Fatalf("enqueue: %v", err)
+	}
+
+	disp, err := NewWebhookDispatcher(d, srv.Client(), testLogger(), time.Second)
+	if err != nil {
+		t.Fatalf("NewWebhookDispatcher: %v", err)
+	}
+	now := time.Now().Add(time.Second)
+	disp.now = func() time.Time { return now }
+	disp.Dispatch(ctx)
+
+	if rcv.count() != 1 {
+		t.Fatalf("expected 1 request, got %d", rcv.count())
+	}
+	req := rcv.requests[0]
+	if req.Header.Get(WebhookEventHeader) != "peer.created" || req.Header.Get(WebhookDeliveryHeader) != "evt_1" {
+		t.Errorf("unexpected event headers: %v", req.Header)
+	}
+	want := SignWebhookPayload("s3cret", now.Unix(), []byte(payload))
+	if got := req.Header.Get(WebhookSignatureHeader); got != want {
+		t.Errorf("signature = %q, want %q", got, want)
+	}
+	if rcv.bodies[0] != payload {
+		t.Errorf("unexpected body: %s", rcv.bodies[0])
+	}
+
+	list, _ := d.ListWebhookDeliveries(ctx, id, 10)
+	if len(list) != 1 || list[0].Status != db.WebhookDeliveryDelivered || list[0].LastStatus != http.StatusNoContent {
+		t.Errorf("expected delivered, got %+v", list)
+	}
+
+	// Delivered events are not sent again.
+	disp.Dispatch(ctx)
+	if rcv.count() != 1 {
+		t.Errorf("expected no resend, got %d requests", rcv.count())
+	}
+}
+
+func TestWebhookDispatcher_RetriesWithBackoff(t *testing.T) {
+	d := testDBForMonitor(t)
+	ctx := context.Background()
+
+	rcv := &webhookReceiver{status: http.StatusServiceUnavailable}
+	srv := httptest.NewServer(rcv)
+	defer srv.Close()
+
+	id, _ := d.CreateWebhook(ctx, &db.Webhook{URL: srv.URL, Secret: "s", Enabled: true})
+	d.EnqueueWebhookEvent(ctx, "evt_1", "network.deleted", `{}`)
+
+	disp, err := NewWebhookDispatcher(d, srv.Client(), testLogger(), time.Second)
+	if err != nil {
+		t.Fatalf("NewWebhookDispatcher: %v", err)
+	}
+	now := time.Now()
+	disp.now = func() time.Time { return now }
+
+	disp.Dispatch(ctx)
+	list, _ := d.ListWebhookDeliveries(ctx, id, 10)
+	if len(list) != 1 || list[0].Status != db.WebhookDeliveryPending || list[0].Attempts != 1 || list[0].LastStatus != 503 {
+		t.Fatalf("expected pending retry, got %+v", list)
+	}
+	if got := list[0].NextAttemptAt.Unix(); got != now.Add(webhookBaseBackoff).Unix() {
+		t.Errorf("expected retry after %s, got %d", webhookBaseBackoff, got-now.Unix())
+	}
+
+	// Not due yet.
+	disp.Dispatch(ctx)
+	if rcv.count() != 1 {
+		t.Fatalf("expected no attempt before backoff, got %d", rcv.count())
+	}
+
+	// Exhaust the remaining attempts.
+	for i := 1; i < webhookMaxAttempts; i++ {
+		now = now.Add(webhookMaxBackoff)
+		disp.Dispatch(ctx)
+	}
+	if rcv.count() != webhookMaxAttempts {
+		t.Errorf("expected %d attempts, got %d", webhookMaxAttempts, rcv.count())
+	}
+	del, _ := d.GetWebhookDelivery(ctx, list[0].ID)
+	if del.Status != db.WebhookDeliveryFailed || !strings.Contains(del.LastError, "503") {
+		t.Errorf("expected failed delivery, got %+v", del)
+	}
+}
+
+func TestWebhookDispatcher_DisabledWebhookWaits(t *testing.T) {
+	d := testDBForMonitor(t)
+	ctx := context.Background()
+
+	rcv := &webhookReceiver{status: http.StatusOK}
+	srv := httptest.NewServer(rcv)
+	defer srv.Close()
+
+	id, _ := d.CreateWebhook(ctx, &db.Webhook{URL: srv.URL, Secret: "s", Enabled: true})
+	d.EnqueueWebhookEvent(ctx, "evt_1", "peer.updated", `{}`)
+	w, _ := d.GetWebhookByID(ctx, id)
+	w.Enabled = false
+	d.UpdateWebhook(ctx, w)
+
+	disp, _ := NewWebhookDispatcher(d, srv.Client(), testLogger(), time.Second)
+	disp.Dispatch(ctx)
+	if rcv.count() != 0 {
+		t.Fatalf("expected no delivery while disabled, got %d", rcv.count())
+	}
+
+	w.Enabled = true
+	d.UpdateWebhook(ctx, w)
+	disp.Dispatch(ctx)
+	if rcv.count() != 1 {
+		t.Errorf("expected delivery after re-enabling, got %d", rcv.count())
+	}
+}
+
+func TestSignWebhookPayload(t *testing.T) {
+	// HMAC-SHA256("key", "1700000000.{}")
+	got := SignWebhookPayload("key", 1700000000, []byte("{}"))
+	if !strings.HasPrefix(got, "t="+strconv.Itoa(1700000000)+",v1=") || len(got) != len("t=1700000000,v1=")+64 {
+		t.Errorf("unexpected signature format: %s", got)
+	}
+	if SignWebhookPayload("other", 1700000000, []byte("{}")) == got {
+		t.Error("expected signature to depend on the secret")
+	}
+}
+
+func TestWebhookBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, 30 * time.Second},
+		{2, time.Minute},
+		{4, 4 * time.Minute},
+		{8, time.Hour},
+		{70, time.Hour},
+	}
+	for _, tt := range tests {
+		if got := webhookBackoff(tt.attempts); got != tt.want {
+			t.Errorf("webhookBackoff(%d) = %s, want %s", tt.attempts, got, tt.want)
+		}
+	}
+}
@@ -3,6 +3,8 @@ package nft
 import (
 	"encoding/binary"
 	"fmt"
+	"net"
+	"net/netip"
 
 	"github.com/google/nftables"
 	"github.com/google/nftables/expr"
@@ -26,18 +28,17 @@ func (a *nftApplier) Apply(rules []Rule) error {
 		return fmt.Errorf("nftables connect: %w", err)
 	}
 
-	// Delete existing wgpilot table if it exists.
+	// Delete existing wgpilot tables if they exist.
 	tables, err := conn.ListTables()
 	if err != nil {
 		return fmt.Errorf("nftables list tables: %w", err)
 	}
 	for _, t := range tables {
-		if t.Name == tableName && t.Family == nftables.TableFamilyIPv4 {
+		if t.Name == tableName && (t.Family == nftables.TableFamilyIPv4 || t.Family == nftables.TableFamilyIPv6) {
 			conn.DelTable(t)
 			if err := conn.Flush(); err != nil {
 				return fmt.Errorf("nftables delete table: %w", err)
 			}
-			break
 		}
 	}
 
@@ -51,8 +52,9 @@ func (a *nftApplier) Apply(rules []Rule) error {
 		Family: nftables.TableFamilyIPv4,
 	})
 
-	// Separate rules by chain type.
-	var natRules, forwardRules, inputRules []Rule
+	// Separate rules by chain type. IPv6 throttles go to their own table,
+	// since an ip table only sees IPv4 packets.
+	var natRules, forwardRules, inputRules, throttleRules, throttle6Rules []Rule
 	for _, r := range rules {
 		switch r.Kind {
 		case RuleNATMasquerade:
@@ -61,6 +63,12 @@ func (a *nftApplier) Apply(rules []Rule) error {
 			forwardRules = append(forwardRules, r)
 		case RuleUDPInput:
 			inputRules = append(inputRules, r)
+		case RulePeerThrottle:
+			if isIPv6(r.Address) {
+				throttle6Rules = append(throttle6Rules, r)
+			} else {
+				throttleRules = append(throttleRules, r)
+			}
 		}
 	}
 
@@ -100,8 +108,9 @@ func (a *nftApplier) Apply(rules []Rule) error {
 		}
 	}
 
-	// Forward chain for inter-peer and bridge rules.
-	if len(forwardRules) > 0 {
+	// Forward chain for throttles, inter-peer and bridge rules. Throttle
+	// drops are added first so they apply before any accept verdict.
+	if len(forwardRules) > 0 || len(throttleRules) > 0 {
 		chain := conn.AddChain(&nftables.Chain{
 			Name:     "forward",
 			Table:    table,
@@ -109,6 +118,9 @@ func (a *nftApplier) Apply(rules []Rule) error {
 			Hooknum:  nftables.ChainHookForward,
 			Priority: nftables.ChainPriorityFilter,
 		})
+		if err := addThrottleRules(conn, table, chain, throttleRules); err != nil {
+			return err
+		}
 		for _, r := range forwardRules {
 			for _, exprs := range buildForwardExprs(r) {
 				conn.AddRule(&nftables.Rule{
@@ -120,12 +132,53 @@ func (a *nftApplier) Apply(rules []Rule) error {
 		}
 	}
 
+	if len(throttle6Rules) > 0 {
+		table6 := conn.AddTable(&nftables.Table{
+			Name:   tableName,
+			Family: nftables.TableFamilyIPv6,
+		})
+		chain := conn.AddChain(&nftables.Chain{
+			Name:     "forward",
+			Table:    table6,
+			Type:     nftables.ChainTypeFilter,
+			Hooknum:  nftables.ChainHookForward,
+			Priority: nftables.ChainPriorityFilter,
+		})
+		if err := addThrottleRules(conn, table6, chain, throttle6Rules); err != nil {
+			return err
+		}
+	}
+
 	if err := conn.Flush(); err != nil {
 		return fmt.Errorf("nftables flush: %w", err)
 	}
 	return nil
 }
 
+// addThrottleRules adds the drop rules for each peer throttle to chain.
+func addThrottleRules(conn *nftables.Conn, table *nftables.Table, chain *nftables.Chain, rules []Rule) error {
+	for _, r := range rules {
+		exprsList, err := throttleExprs(r)
+		if err != nil {
+			return err
+		}
+		for _, exprs := range exprsList {
+			conn.AddRule(&nftables.Rule{
+				Table: table,
+				Chain: chain,
+				Exprs: exprs,
+			})
+		}
+	}
+	return nil
+}
+
+// isIPv6 reports whether address is an IPv6 prefix.
+func isIPv6(address string) bool {
+	prefix, err := netip.ParsePrefix(address)
+	return err == nil && prefix.Addr().Is6()
+}
+
 // masqueradeExprs builds nftables expressions for:
 //
 //	iifname <iface> oifname != <iface> masquerade
@@ -175,6 +228,65 @@ func forwardPairExprs(ifaceIn, ifaceOut string) []expr.Any {
 	}
 }
 
+// throttleExprs builds expressions for a peer throttle:
+//
+//	iifname <iface> ip saddr <addr> limit rate over <rate> bytes/second drop
+//	oifname <iface> ip daddr <addr> limit rate over <rate> bytes/second drop
+//
+// For an IPv6 address it matches ip6 saddr/daddr instead, for a rule in an
+// ip6 table.
+func throttleExprs(r Rule) ([][]expr.Any, error) {
+	prefix, err := netip.ParsePrefix(r.Address)
+	if err != nil {
+		return nil, fmt.Errorf("throttle %s: parse address %q: %w", r.Iface, r.Address, err)
+	}
+	prefix = prefix.Masked()
+	addr := prefix.Addr().AsSlice()
+	mask := net.CIDRMask(prefix.Bits(), prefix.Addr().BitLen())
+	size := uint32(len(addr))
+
+	// IPv4 source address is at offset 12, destination at 16; IPv6 source
+	// at 8, destination at 24.
+	srcOffset, dstOffset := uint32(12), uint32(16)
+	if prefix.Addr().Is6() {
+		srcOffset, dstOffset = 8, 24
+	}
+
+	build := func(metaKey expr.MetaKey, offset uint32) []expr.Any {
+		return []expr.Any{
+			&expr.Meta{Key: metaKey, Register: 1},
+			&expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: ifaceBytes(r.Iface)},
+			&expr.Payload{
+				DestRegister: 1,
+				Base:         expr.PayloadBaseNetworkHeader,
+				Offset:       offset,
+				Len:          size,
+			},
+			&expr.Bitwise{
+				SourceRegister: 1,
+				DestRegister:   1,
+				Len:            size,
+				Mask:           mask,
+				Xor:            make([]byte, size),
+			},
+			&expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: addr},
+			&expr.Limit{
+				Type:  expr.LimitTypePktBytes,
+				Rate:  r.Rate,
+				Over:  true,
+				Unit:  expr.LimitTimeSecond,
+				Burst: uint32(min(r.Rate, 1<<20)),
+			},
+			&expr.Verdict{Kind: expr.VerdictDrop},
+		}
+	}
+
+	return [][]expr.Any{
+		build(expr.MetaKeyIIFNAME, srcOffset),
+		build(expr.MetaKeyOIFNAME, dstOffset),
+	}, nil
+}
+
 // ifaceBytes returns the interface name as a null-terminated byte slice
 // for use in nftables comparison expressions.
 func ifaceBytes(iface string) []byte {
@@ -1,5 +1,7 @@
 package nft
 
+import "context"
+
 // NFTableManager manages nftables firewall rules for WireGuard interfaces.
 // All rules are managed in a dedicated "wgpilot" nftables table to avoid
 // conflicts with existing firewall rules.
@@ -7,37 +9,46 @@ type NFTableManager interface {
 	// AddNATMasquerade adds a masquerade rule for the given interface and subnet.
 	// Packets entering via iface and leaving via any other interface are masqueraded.
 	// Calling this with an already-configured interface is idempotent.
-	AddNATMasquerade(iface, subnet string) error
+	AddNATMasquerade(ctx context.Context, iface, subnet string) error
 
 	// RemoveNATMasquerade removes the masquerade rule for the given interface.
 	// Returns nil if no rule exists for the interface.
-	RemoveNATMasquerade(iface string) error
+	RemoveNATMasquerade(ctx context.Context, iface string) error
 
 	// EnableInterPeerForwarding allows peers on the same interface to route
 	// traffic through the server to each other (hub-routed mode).
 	// Calling this with an already-configured interface is idempotent.
-	EnableInterPeerForwarding(iface string) error
+	EnableInterPeerForwarding(ctx context.Context, iface string) error
 
 	// DisableInterPeerForwarding removes the inter-peer forwarding rule.
 	// Returns nil if no rule exists for the interface.
-	DisableInterPeerForwarding(iface string) error
+	DisableInterPeerForwarding(ctx context.Context, iface string) error
 
 	// AddNetworkBridge adds forwarding rules between two WireGuard interfaces.
 	// Direction must be "a_to_b", "b_to_a", or "bidirectional".
 	// If a bridge already exists for the same interface pair, it is updated.
-	AddNetworkBridge(ifaceA, ifaceB, direction string) error
+	AddNetworkBridge(ctx context.Context, ifaceA, ifaceB, direction string) error
 
 	// RemoveNetworkBridge removes forwarding rules between two interfaces.
 	// The order of interfaces does not matter. Returns nil if no bridge exists.
-	RemoveNetworkBridge(ifaceA, ifaceB string) error
+	RemoveNetworkBridge(ctx context.Context, ifaceA, ifaceB string) error
 
 	// OpenUDPPort adds an input rule allowing UDP traffic on the given port.
 	// Used to open WireGuard listen ports in the firewall. Idempotent.
-	OpenUDPPort(port int) error
+	OpenUDPPort(ctx context.Context, port int) error
 
 	// CloseUDPPort removes the input rule for the given UDP port.
 	// Returns nil if no rule exists for the port.
-	CloseUDPPort(port int) error
+	CloseUDPPort(ctx context.Context, port int) error
+
+	// ThrottlePeer limits forwarded traffic to and from a peer's tunnel
+	// address on iface to bytesPerSec in each direction. Calling it again
+	// for the same peer updates the rate.
+	ThrottlePeer(ctx context.Context, iface, address string, bytesPerSec uint64) error
+
+	// UnthrottlePeer removes the throttle for the peer address on iface.
+	// Returns nil if the peer is not throttled.
+	UnthrottlePeer(ctx context.Context, iface, address string) error
 
 	// DumpRules returns a human-readable nftables-style representation
 	// of all active rules in the wgpilot table.
@@ -1,9 +1,13 @@
 package nft
 
 import (
+	"context"
 	"fmt"
 	"log/slog"
+	"net/netip"
 	"sync"
+
+	"github.com/itsChris/wgpilot/internal/tracing"
 )
 
 // Manager implements NFTableManager by tracking rules in memory and
@@ -39,7 +43,7 @@ func NewTestManager(logger *slog.Logger, devMode bool) (*Manager, error) {
 }
 
 // AddNATMasquerade adds a masquerade rule for the given interface and subnet.
-func (m *Manager) AddNATMasquerade(iface, subnet string) error {
+func (m *Manager) AddNATMasquerade(ctx context.Context, iface, subnet string) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
@@ -67,7 +71,7 @@ func (m *Manager) AddNATMasquerade(iface, subnet string) error {
 
 	m.rules[key] = rule
 
-	if err := m.apply(); err != nil {
+	if err := m.apply(ctx); err != nil {
 		delete(m.rules, key)
 		m.logger.Error("nft_apply_failed",
 			"error", err,
@@ -89,7 +93,7 @@ func (m *Manager) AddNATMasquerade(iface, subnet string) error {
 }
 
 // RemoveNATMasquerade removes the masquerade rule for the given interface.
-func (m *Manager) RemoveNATMasquerade(iface string) error {
+func (m *Manager) RemoveNATMasquerade(ctx context.Context, iface string) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
@@ -110,7 +114,7 @@ func (m *Manager) RemoveNATMasquerade(iface string) error {
 
 	delete(m.rules, key)
 
-	if err := m.apply(); err != nil {
+	if err := m.apply(ctx); err != nil {
 		m.rules[key] = old
 		m.logger.Error("nft_apply_failed",
 			"error", err,
@@ -130,7 +134,7 @@ func (m *Manager) RemoveNATMasquerade(iface string) error {
 }
 
 // EnableInterPeerForwarding allows peers on the same interface to reach each other.
-func (m *Manager) EnableInterPeerForwarding(iface string) error {
+func (m *Manager) EnableInterPeerForwarding(ctx context.Context, iface string) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
@@ -155,7 +159,7 @@ func (m *Manager) EnableInterPeerForwarding(iface string) error {
 
 	m.rules[key] = rule
 
-	if err := m.apply(); err != nil {
+	if err := m.apply(ctx); err != nil {
 		delete(m.rules, key)
 		m.logger.Error("nft_apply_failed",
 			"error", err,
@@ -175,7 +179,7 @@ func (m *Manager) EnableInterPeerForwarding(iface string) error {
 }
 
 // DisableInterPeerForwarding removes the inter-peer forwarding rule.
-func (m *Manager) DisableInterPeerForwarding(iface string) error {
+func (m *Manager) DisableInterPeerForwarding(ctx context.Context, iface string) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
@@ -196,7 +200,7 @@ func (m *Manager) DisableInterPeerForwarding(iface string) error {
 
 	delete(m.rules, key)
 
-	if err := m.apply(); err != nil {
+	if err := m.apply(ctx); err != nil {
 		m.rules[key] = old
 		m.logger.Error("nft_apply_failed",
 			"error", err,
@@ -216,7 +220,7 @@ func (m *Manager) DisableInterPeerForwarding(iface string) error {
 }
 
 // AddNetworkBridge adds forwarding rules between two WireGuard interfaces.
-func (m *Manager) AddNetworkBridge(ifaceA, ifaceB, direction string) error {
+func (m *Manager) AddNetworkBridge(ctx context.Context, ifaceA, ifaceB, direction string) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
@@ -241,7 +245,7 @@ func (m *Manager) AddNetworkBridge(ifaceA, ifaceB, direction string) error {
 	old, hadOld := m.rules[key]
 	m.rules[key] = rule
 
-	if err := m.apply(); err != nil {
+	if err := m.apply(ctx); err != nil {
 		if hadOld {
 			m.rules[key] = old
 		} else {
@@ -269,7 +273,7 @@ func (m *Manager) AddNetworkBridge(ifaceA, ifaceB, direction string) error {
 }
 
 // RemoveNetworkBridge removes forwarding rules between two interfaces.
-func (m *Manager) RemoveNetworkBridge(ifaceA, ifaceB string) error {
+func (m *Manager) RemoveNetworkBridge(ctx context.Context, ifaceA, ifaceB string) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
@@ -292,7 +296,7 @@ func (m *Manager) RemoveNetworkBridge(ifaceA, ifaceB string) error {
 
 	delete(m.rules, key)
 
-	if err := m.apply(); err != nil {
+	if err := m.apply(ctx); err != nil {
 		m.rules[key] = old
 		m.logger.Error("nft_apply_failed",
 			"error", err,
@@ -314,7 +318,7 @@ func (m *Manager) RemoveNetworkBridge(ifaceA, ifaceB string) error {
 }
 
 // OpenUDPPort adds an input rule allowing UDP traffic on the given port.
-func (m *Manager) OpenUDPPort(port int) error {
+func (m *Manager) OpenUDPPort(ctx context.Context, port int) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
@@ -339,7 +343,7 @@ func (m *Manager) OpenUDPPort(port int) error {
 
 	m.rules[key] = rule
 
-	if err := m.apply(); err != nil {
+	if err := m.apply(ctx); err != nil {
 		delete(m.rules, key)
 		m.logger.Error("nft_apply_failed",
 			"error", err,
@@ -359,7 +363,7 @@ func (m *Manager) OpenUDPPort(port int) error {
 }
 
 // CloseUDPPort removes the input rule for the given UDP port.
-func (m *Manager) CloseUDPPort(port int) error {
+func (m *Manager) CloseUDPPort(ctx context.Context, port int) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
@@ -380,7 +384,7 @@ func (m *Manager) CloseUDPPort(port int) error {
 
 	delete(m.rules, key)
 
-	if err := m.apply(); err != nil {
+	if err := m.apply(ctx); err != nil {
 		m.rules[key] = old
 		m.logger.Error("nft_apply_failed",
 			"error", err,
@@ -399,6 +403,114 @@ func (m *Manager) CloseUDPPort(port int) error {
 	return nil
 }
 
+// ThrottlePeer limits forwarded traffic for a peer address on iface.
+func (m *Manager) ThrottlePeer(ctx context.Context, iface, address string, bytesPerSec uint64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.logger.Debug("nft_throttle_peer_start",
+		"interface", iface,
+		"address", address,
+		"bytes_per_sec", bytesPerSec,
+		"operation", "throttle_peer",
+	)
+
+	if bytesPerSec == 0 {
+		return fmt.Errorf("throttle peer %s on %s: rate must be positive", address, iface)
+	}
+	if _, err := netip.ParsePrefix(address); err != nil {
+		return fmt.Errorf("throttle peer %s on %s: %w", address, iface, err)
+	}
+
+	rule := Rule{
+		Kind:    RulePeerThrottle,
+		Iface:   iface,
+		Address: address,
+		Rate:    bytesPerSec,
+	}
+	key := ruleKey(rule)
+	old, hadOld := m.rules[key]
+	if hadOld && old == rule {
+		m.logger.Debug("nft_throttle_peer_idempotent",
+			"interface", iface,
+			"address", address,
+			"operation", "throttle_peer",
+		)
+		return nil
+	}
+	m.rules[key] = rule
+
+	if err := m.apply(ctx); err != nil {
+		if hadOld {
+			m.rules[key] = old
+		} else {
+			delete(m.rules, key)
+		}
+		m.logger.Error("nft_apply_failed",
+			"error", err,
+			"error_type", fmt.Sprintf("%T", err),
+			"operation", "throttle_peer",
+			"interface", iface,
+			"address", address,
+		)
+		return fmt.Errorf("throttle peer %s on %s: %w", address, iface, err)
+	}
+
+	m.logDevDump("throttle_peer", iface)
+	m.logger.Info("nft_peer_throttled",
+		"interface", iface,
+		"address", address,
+		"bytes_per_sec", bytesPerSec,
+		"operation", "throttle_peer",
+	)
+	return nil
+}
+
+// UnthrottlePeer removes the throttle rule for a peer address on iface.
+func (m *Manager) UnthrottlePeer(ctx context.Context, iface, address string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.logger.Debug("nft_unthrottle_peer_start",
+		"interface", iface,
+		"address", address,
+		"operation", "unthrottle_peer",
+	)
+
+	key := throttleKey(iface, address)
+	old, exists := m.rules[key]
+	if !exists {
+		m.logger.Debug("nft_unthrottle_peer_not_found",
+			"interface", iface,
+			"address", address,
+			"operation", "unthrottle_peer",
+		)
+		return nil
+	}
+
+	delete(m.rules, key)
+
+	if err := m.apply(ctx); err != nil {
+		m.rules[key] = old
+		m.logger.Error("nft_apply_failed",
+			"error", err,
+			"error_type", fmt.Sprintf("%T", err),
+			"operation", "unthrottle_peer",
+			"interface", iface,
+			"address", address,
+		)
+		return fmt.Errorf("unthrottle peer %s on %s: %w", address, iface, err)
+	}
+
+	m.logDevDump("unthrottle_peer", iface)
+	m.logger.Info("nft_peer_unthrottled",
+		"interface", iface,
+		"address", address,
+		"operation", "unthrottle_peer",
+	)
+	return nil
+}
+
 // DumpRules returns a human-readable nftables-style representation of all active rules.
 func (m *Manager) DumpRules() (string, error) {
 	m.mu.Lock()
@@ -408,12 +520,15 @@ func (m *Manager) DumpRules() (string, error) {
 
 // apply sends the current rule set to the kernel via the Applier.
 // Must be called with m.mu held.
-func (m *Manager) apply() error {
+func (m *Manager) apply(ctx context.Context) error {
 	rules := make([]Rule, 0, len(m.rules))
 	for _, r := range m.rules {
 		rules = append(rules, r)
 	}
-	return m.applier.Apply(rules)
+	_, span := tracing.StartChild(ctx, "nft.apply", tracing.Int("nft.rules", len(rules)))
+	err := m.applier.Apply(rules)
+	span.EndWithError(err)
+	return err
 }
 
 // dumpRules formats the current rule set. Must be called with m.mu held.
@@ -1,6 +1,7 @@
 package nft
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
@@ -8,8 +9,13 @@ import (
 	"strings"
 	"sync"
 	"testing"
+
+	"github.com/google/nftables/expr"
 )
 
+// ctx is the context passed to every rule change in these tests.
+var ctx = context.Background()
+
 func testLogger() *slog.Logger {
 	return slog.New(slog.NewTextHandler(io.Discard, nil))
 }
@@ -64,7 +70,7 @@ func TestNewManager_NilLogger(t *testing.T) {
 func TestAddNATMasquerade_Success(t *testing.T) {
 	m := newTestManager(t)
 
-	if err := m.AddNATMasquerade("wg0", "10.0.0.0/24"); err != nil {
+	if err := m.AddNATMasquerade(ctx, "wg0", "10.0.0.0/24"); err != nil {
 		t.Fatalf("AddNATMasquerade: %v", err)
 	}
 
@@ -83,10 +89,10 @@ func TestAddNATMasquerade_Success(t *testing.T) {
 func TestAddNATMasquerade_MultipleInterfaces(t *testing.T) {
 	m := newTestManager(t)
 
-	if err := m.AddNATMasquerade("wg0", "10.0.0.0/24"); err != nil {
+	if err := m.AddNATMasquerade(ctx, "wg0", "10.0.0.0/24"); err != nil {
 		t.Fatal(err)
 	}
-	if err := m.AddNATMasquerade("wg1", "10.1.0.0/24"); err != nil {
+	if err := m.AddNATMasquerade(ctx, "wg1", "10.1.0.0/24"); err != nil {
 		t.Fatal(err)
 	}
 
@@ -99,10 +105,10 @@ func TestAddNATMasquerade_MultipleInterfaces(t *testing.T) {
 func TestAddNATMasquerade_Idempotent(t *testing.T) {
 	m := newTestManager(t)
 
-	if err := m.AddNATMasquerade("wg0", "10.0.0.0/24"); err != nil {
+	if err := m.AddNATMasquerade(ctx, "wg0", "10.0.0.0/24"); err != nil {
 		t.Fatal(err)
 	}
-	if err := m.AddNATMasquerade("wg0", "10.0.0.0/24"); err != nil {
+	if err := m.AddNATMasquerade(ctx, "wg0", "10.0.0.0/24"); err != nil {
 		t.Fatal(err)
 	}
 
@@ -119,7 +125,7 @@ func TestAddNATMasquerade_ApplyError(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	err = m.AddNATMasquerade("wg0", "10.0.0.0/24")
+	err = m.AddNATMasquerade(ctx, "wg0", "10.0.0.0/24")
 	if err == nil {
 		t.Fatal("expected error from failing applier")
 	}
@@ -136,10 +142,10 @@ func TestAddNATMasquerade_ApplyError(t *testing.T) {
 func TestRemoveNATMasquerade_Success(t *testing.T) {
 	m := newTestManager(t)
 
-	if err := m.AddNATMasquerade("wg0", "10.0.0.0/24"); err != nil {
+	if err := m.AddNATMasquerade(ctx, "wg0", "10.0.0.0/24"); err != nil {
 		t.Fatal(err)
 	}
-	if err := m.RemoveNATMasquerade("wg0"); err != nil {
+	if err := m.RemoveNATMasquerade(ctx, "wg0"); err != nil {
 		t.Fatalf("RemoveNATMasquerade: %v", err)
 	}
 
@@ -152,14 +158,14 @@ func TestRemoveNATMasquerade_Success(t *testing.T) {
 func TestRemoveNATMasquerade_NotFound(t *testing.T) {
 	m := newTestManager(t)
 
-	if err := m.RemoveNATMasquerade("wg99"); err != nil {
+	if err := m.RemoveNATMasquerade(ctx, "wg99"); err != nil {
 		t.Errorf("RemoveNATMasquerade for non-existent should return nil, got: %v", err)
 	}
 }
 
 func TestRemoveNATMasquerade_ApplyError(t *testing.T) {
 	m := newTestManager(t)
-	if err := m.AddNATMasquerade("wg0", "10.0.0.0/24"); err != nil {
+	if err := m.AddNATMasquerade(ctx, "wg0", "10.0.0.0/24"); err != nil {
 		t.Fatal(err)
 	}
 
@@ -168,7 +174,7 @@ func TestRemoveNATMasquerade_ApplyError(t *testing.T) {
 	m.applier = failApplier{}
 	m.mu.Unlock()
 
-	if err := m.RemoveNATMasquerade("wg0"); err == nil {
+	if err := m.RemoveNATMasquerade(ctx, "wg0"); err == nil {
 		t.Fatal("expected error from failing applier")
 	}
 
@@ -186,7 +192,7 @@ func TestRemoveNATMasquerade_ApplyError(t *testing.T) {
 func TestEnableInterPeerForwarding_Success(t *testing.T) {
 	m := newTestManager(t)
 
-	if err := m.EnableInterPeerForwarding("wg0"); err != nil {
+	if err := m.EnableInterPeerForwarding(ctx, "wg0"); err != nil {
 		t.Fatalf("EnableInterPeerForwarding: %v", err)
 	}
 
@@ -202,10 +208,10 @@ func TestEnableInterPeerForwarding_Success(t *testing.T) {
 func TestEnableInterPeerForwarding_Idempotent(t *testing.T) {
 	m := newTestManager(t)
 
-	if err := m.EnableInterPeerForwarding("wg0"); err != nil {
+	if err := m.EnableInterPeerForwarding(ctx, "wg0"); err != nil {
 		t.Fatal(err)
 	}
-	if err := m.EnableInterPeerForwarding("wg0"); err != nil {
+	if err := m.EnableInterPeerForwarding(ctx, "wg0"); err != nil {
 		t.Fatal(err)
 	}
 
@@ -222,7 +228,7 @@ func TestEnableInterPeerForwarding_ApplyError(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	if err := m.EnableInterPeerForwarding("wg0"); err == nil {
+	if err := m.EnableInterPeerForwarding(ctx, "wg0"); err == nil {
 		t.Fatal("expected error from failing applier")
 	}
 
@@ -237,10 +243,10 @@ func TestEnableInterPeerForwarding_ApplyError(t *testing.T) {
 func TestDisableInterPeerForwarding_Success(t *testing.T) {
 	m := newTestManager(t)
 
-	if err := m.EnableInterPeerForwarding("wg0"); err != nil {
+	if err := m.EnableInterPeerForwarding(ctx, "wg0"); err != nil {
 		t.Fatal(err)
 	}
-	if err := m.DisableInterPeerForwarding("wg0"); err != nil {
+	if err := m.DisableInterPeerForwarding(ctx, "wg0"); err != nil {
 		t.Fatalf("DisableInterPeerForwarding: %v", err)
 	}
 
@@ -253,7 +259,7 @@ func TestDisableInterPeerForwarding_Success(t *testing.T) {
 func TestDisableInterPeerForwarding_NotFound(t *testing.T) {
 	m := newTestManager(t)
 
-	if err := m.DisableInterPeerForwarding("wg99"); err != nil {
+	if err := m.DisableInterPeerForwarding(ctx, "wg99"); err != nil {
 		t.Errorf("DisableInterPeerForwarding for non-existent should return nil, got: %v", err)
 	}
 }
@@ -263,7 +269,7 @@ func TestDisableInterPeerForwarding_NotFound(t *testing.T) {
 func TestAddNetworkBridge_AToB(t *testing.T) {
 	m := newTestManager(t)
 
-	if err := m.AddNetworkBridge("wg0", "wg1", "a_to_b"); err != nil {
+	if err := m.AddNetworkBridge(ctx, "wg0", "wg1", "a_to_b"); err != nil {
 		t.Fatalf("AddNetworkBridge: %v", err)
 	}
 
@@ -280,7 +286,7 @@ func TestAddNetworkBridge_AToB(t *testing.T) {
 func TestAddNetworkBridge_BToA(t *testing.T) {
 	m := newTestManager(t)
 
-	if err := m.AddNetworkBridge("wg0", "wg1", "b_to_a"); err != nil {
+	if err := m.AddNetworkBridge(ctx, "wg0", "wg1", "b_to_a"); err != nil {
 		t.Fatalf("AddNetworkBridge: %v", err)
 	}
 
@@ -297,7 +303,7 @@ func TestAddNetworkBridge_BToA(t *testing.T) {
 func TestAddNetworkBridge_Bidirectional(t *testing.T) {
 	m := newTestManager(t)
 
-	if err := m.AddNetworkBridge("wg0", "wg1", "bidirectional"); err != nil {
+	if err := m.AddNetworkBridge(ctx, "wg0", "wg1", "bidirectional"); err != nil {
 		t.Fatalf("AddNetworkBridge: %v", err)
 	}
 
@@ -313,7 +319,7 @@ func TestAddNetworkBridge_Bidirectional(t *testing.T) {
 func TestAddNetworkBridge_InvalidDirection(t *testing.T) {
 	m := newTestManager(t)
 
-	err := m.AddNetworkBridge("wg0", "wg1", "invalid")
+	err := m.AddNetworkBridge(ctx, "wg0", "wg1", "invalid")
 	if err == nil {
 		t.Fatal("expected error for invalid direction")
 	}
@@ -325,7 +331,7 @@ func TestAddNetworkBridge_InvalidDirection(t *testing.T) {
 func TestAddNetworkBridge_UpdateDirection(t *testing.T) {
 	m := newTestManager(t)
 
-	if err := m.AddNetworkBridge("wg0", "wg1", "a_to_b"); err != nil {
+	if err := m.AddNetworkBridge(ctx, "wg0", "wg1", "a_to_b"); err != nil {
 		t.Fatal(err)
 	}
 
@@ -336,7 +342,7 @@ func TestAddNetworkBridge_UpdateDirection(t *testing.T) {
 	}
 
 	// Update to bidirectional.
-	if err := m.AddNetworkBridge("wg0", "wg1", "bidirectional"); err != nil {
+	if err := m.AddNetworkBridge(ctx, "wg0", "wg1", "bidirectional"); err != nil {
 		t.Fatal(err)
 	}
 
@@ -355,7 +361,7 @@ func TestAddNetworkBridge_ApplyError(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	if err := m.AddNetworkBridge("wg0", "wg1", "bidirectional"); err == nil {
+	if err := m.AddNetworkBridge(ctx, "wg0", "wg1", "bidirectional"); err == nil {
 		t.Fatal("expected error from failing applier")
 	}
 
@@ -370,10 +376,10 @@ func TestAddNetworkBridge_ApplyError(t *testing.T) {
 func TestRemoveNetworkBridge_Success(t *testing.T) {
 	m := newTestManager(t)
 
-	if err := m.AddNetworkBridge("wg0", "wg1", "bidirectional"); err != nil {
+	if err := m.AddNetworkBridge(ctx, "wg0", "wg1", "bidirectional"); err != nil {
 		t.Fatal(err)
 	}
-	if err := m.RemoveNetworkBridge("wg0", "wg1"); err != nil {
+	if err := m.RemoveNetworkBridge(ctx, "wg0", "wg1"); err != nil {
 		t.Fatalf("RemoveNetworkBridge: %v", err)
 	}
 
@@ -387,10 +393,10 @@ func TestRemoveNetworkBridge_ReverseOrder(t *testing.T) {
 	m := newTestManager(t)
 
 	// Add with (wg0, wg1) but remove with (wg1, wg0).
-	if err := m.AddNetworkBridge("wg0", "wg1", "a_to_b"); err != nil {
+	if err := m.AddNetworkBridge(ctx, "wg0", "wg1", "a_to_b"); err != nil {
 		t.Fatal(err)
 	}
-	if err := m.RemoveNetworkBridge("wg1", "wg0"); err != nil {
+	if err := m.RemoveNetworkBridge(ctx, "wg1", "wg0"); err != nil {
 		t.Fatalf("RemoveNetworkBridge reverse order: %v", err)
 	}
 
@@ -403,11 +409,146 @@ func TestRemoveNetworkBridge_ReverseOrder(t *testing.T) {
 func TestRemoveNetworkBridge_NotFound(t *testing.T) {
 	m := newTestManager(t)
 
-	if err := m.RemoveNetworkBridge("wg0", "wg1"); err != nil {
+	if err := m.RemoveNetworkBridge(ctx, "wg0", "wg1"); err != nil {
 		t.Errorf("RemoveNetworkBridge for non-existent should return nil, got: %v", err)
 	}
 }
 
+// --- Peer Throttle Tests ---
+
+func TestThrottlePeer_Success(t *testing.T) {
+	m := newTestManager(t)
+
+	if err := m.ThrottlePeer(ctx, "wg0", "10.0.0.2/32", 32000); err != nil {
+		t.Fatalf("ThrottlePeer: %v", err)
+	}
+	if err := m.EnableInterPeerForwarding(ctx, "wg0"); err != nil {
+		t.Fatal(err)
+	}
+
+	dump, _ := m.DumpRules()
+	if !strings.Contains(dump, `iifname "wg0" ip saddr 10.0.0.2/32 limit rate over 32000 bytes/second drop`) {
+		t.Errorf("dump missing upload throttle:\n%s", dump)
+	}
+	if !strings.Contains(dump, `oifname "wg0" ip daddr 10.0.0.2/32 limit rate over 32000 bytes/second drop`) {
+		t.Errorf("dump missing download throttle:\n%s", dump)
+	}
+	if strings.Index(dump, "drop") > strings.Index(dump, "accept") {
+		t.Errorf("throttle drops should precede accept rules:\n%s", dump)
+	}
+}
+
+func TestThrottlePeer_IPv6(t *testing.T) {
+	m := newTestManager(t)
+
+	if err := m.ThrottlePeer(ctx, "wg0", "10.0.0.2/32", 32000); err != nil {
+		t.Fatalf("ThrottlePeer IPv4: %v", err)
+	}
+	if err := m.ThrottlePeer(ctx, "wg0", "fd00::2/128", 32000); err != nil {
+		t.Fatalf("ThrottlePeer IPv6: %v", err)
+	}
+
+	dump, _ := m.DumpRules()
+	ip6 := strings.Index(dump, "table ip6 wgpilot {")
+	if ip6 < 0 {
+		t.Fatalf("dump missing ip6 table:\n%s", dump)
+	}
+	if i := strings.Index(dump, `iifname "wg0" ip6 saddr fd00::2/128 limit rate over 32000 bytes/second drop`); i < ip6 {
+		t.Errorf("expected the IPv6 throttle in the ip6 table:\n%s", dump)
+	}
+	if i := strings.Index(dump, `iifname "wg0" ip saddr 10.0.0.2/32`); i < 0 || i > ip6 {
+		t.Errorf("expected the IPv4 throttle in the ip table:\n%s", dump)
+	}
+
+	// Both families build kernel expressions matching the full address.
+	for _, tt := range []struct {
+		address string
+		offsets []uint32
+		size    uint32
+	}{
+		{"10.0.0.2/32", []uint32{12, 16}, 4},
+		{"fd00::2/128", []uint32{8, 24}, 16},
+	} {
+		exprsList, err := throttleExprs(Rule{Kind: RulePeerThrottle, Iface: "wg0", Address: tt.address, Rate: 1000})
+		if err != nil {
+			t.Fatalf("throttleExprs(%s): %v", tt.address, err)
+		}
+		for i, exprs := range exprsList {
+			payload := exprs[2].(*expr.Payload)
+			if payload.Offset != tt.offsets[i] || payload.Len != tt.size {
+				t.Errorf("%s rule %d: expected %d bytes at offset %d, got %d at %d", tt.address, i, tt.size, tt.offsets[i], payload.Len, payload.Offset)
+			}
+		}
+	}
+}
+
+func TestThrottlePeer_UpdatesRate(t *testing.T) {
+	m := newTestManager(t)
+
+	if err := m.ThrottlePeer(ctx, "wg0", "10.0.0.2/32", 1000); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.ThrottlePeer(ctx, "wg0", "10.0.0.2/32", 2000); err != nil {
+		t.Fatal(err)
+	}
+
+	dump, _ := m.DumpRules()
+	if strings.Contains(dump, "over 1000 ") {
+		t.Errorf("old rate should be replaced:\n%s", dump)
+	}
+	if !strings.Contains(dump, "over 2000 ") {
+		t.Errorf("new rate missing:\n%s", dump)
+	}
+}
+
+func TestThrottlePeer_InvalidInput(t *testing.T) {
+	m := newTestManager(t)
+
+	if err := m.ThrottlePeer(ctx, "wg0", "not-an-ip", 1000); err == nil {
+		t.Error("expected error for invalid address")
+	}
+	if err := m.ThrottlePeer(ctx, "wg0", "10.0.0.2/32", 0); err == nil {
+		t.Error("expected error for zero rate")
+	}
+}
+
+func TestThrottlePeer_ApplyError(t *testing.T) {
+	m, err := NewManager(failApplier{}, testLogger(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.ThrottlePeer(ctx, "wg0", "10.0.0.2/32", 1000); err == nil {
+		t.Fatal("expected error from failing applier")
+	}
+
+	m.mu.Lock()
+	ruleCount := len(m.rules)
+	m.mu.Unlock()
+	if ruleCount != 0 {
+		t.Errorf("expected 0 rules after rollback, got %d", ruleCount)
+	}
+}
+
+func TestUnthrottlePeer(t *testing.T) {
+	m := newTestManager(t)
+
+	if err := m.UnthrottlePeer(ctx, "wg0", "10.0.0.2/32"); err != nil {
+		t.Errorf("UnthrottlePeer for non-existent should return nil, got: %v", err)
+	}
+	if err := m.ThrottlePeer(ctx, "wg0", "10.0.0.2/32", 1000); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.UnthrottlePeer(ctx, "wg0", "10.0.0.2/32"); err != nil {
+		t.Fatalf("UnthrottlePeer: %v", err)
+	}
+
+	dump, _ := m.DumpRules()
+	if strings.Contains(dump, "throttle") {
+		t.Errorf("dump should not contain throttle rules after removal:\n%s", dump)
+	}
+}
+
 // --- DumpRules Tests ---
 
 func TestDumpRules_Empty(t *testing.T) {
@@ -427,13 +568,13 @@ func TestDumpRules_Empty(t *testing.T) {
 func TestDumpRules_MultipleTypes(t *testing.T) {
 	m := newTestManager(t)
 
-	if err := m.AddNATMasquerade("wg0", "10.0.0.0/24"); err != nil {
+	if err := m.AddNATMasquerade(ctx, "wg0", "10.0.0.0/24"); err != nil {
 		t.Fatal(err)
 	}
-	if err := m.EnableInterPeerForwarding("wg1"); err != nil {
+	if err := m.EnableInterPeerForwarding(ctx, "wg1"); err != nil {
 		t.Fatal(err)
 	}
-	if err := m.AddNetworkBridge("wg0", "wg1", "a_to_b"); err != nil {
+	if err := m.AddNetworkBridge(ctx, "wg0", "wg1", "a_to_b"); err != nil {
 		t.Fatal(err)
 	}
 
@@ -467,13 +608,13 @@ func TestDumpRules_Deterministic(t *testing.T) {
 	m := newTestManager(t)
 
 	// Add rules in different orders and verify output is the same.
-	if err := m.AddNATMasquerade("wg1", "10.1.0.0/24"); err != nil {
+	if err := m.AddNATMasquerade(ctx, "wg1", "10.1.0.0/24"); err != nil {
 		t.Fatal(err)
 	}
-	if err := m.AddNATMasquerade("wg0", "10.0.0.0/24"); err != nil {
+	if err := m.AddNATMasquerade(ctx, "wg0", "10.0.0.0/24"); err != nil {
 		t.Fatal(err)
 	}
-	if err := m.EnableInterPeerForwarding("wg0"); err != nil {
+	if err := m.EnableInterPeerForwarding(ctx, "wg0"); err != nil {
 		t.Fatal(err)
 	}
 
@@ -481,13 +622,13 @@ func TestDumpRules_Deterministic(t *testing.T) {
 
 	// Create a second manager with same rules in different order.
 	m2 := newTestManager(t)
-	if err := m2.AddNATMasquerade("wg0", "10.0.0.0/24"); err != nil {
+	if err := m2.AddNATMasquerade(ctx, "wg0", "10.0.0.0/24"); err != nil {
 		t.Fatal(err)
 	}
-	if err := m2.EnableInterPeerForwarding("wg0"); err != nil {
+	if err := m2.EnableInterPeerForwarding(ctx, "wg0"); err != nil {
 		t.Fatal(err)
 	}
-	if err := m2.AddNATMasquerade("wg1", "10.1.0.0/24"); err != nil {
+	if err := m2.AddNATMasquerade(ctx, "wg1", "10.1.0.0/24"); err != nil {
 		t.Fatal(err)
 	}
 
@@ -504,22 +645,22 @@ func TestDevMode_DumpsAfterChange(t *testing.T) {
 	// Verify that dev mode doesn't panic during all operations.
 	m := newDevTestManager(t)
 
-	if err := m.AddNATMasquerade("wg0", "10.0.0.0/24"); err != nil {
+	if err := m.AddNATMasquerade(ctx, "wg0", "10.0.0.0/24"); err != nil {
 		t.Fatal(err)
 	}
-	if err := m.EnableInterPeerForwarding("wg0"); err != nil {
+	if err := m.EnableInterPeerForwarding(ctx, "wg0"); err != nil {
 		t.Fatal(err)
 	}
-	if err := m.AddNetworkBridge("wg0", "wg1", "bidirectional"); err != nil {
+	if err := m.AddNetworkBridge(ctx, "wg0", "wg1", "bidirectional"); err != nil {
 		t.Fatal(err)
 	}
-	if err := m.RemoveNATMasquerade("wg0"); err != nil {
+	if err := m.RemoveNATMasquerade(ctx, "wg0"); err != nil {
 		t.Fatal(err)
 	}
-	if err := m.DisableInterPeerForwarding("wg0"); err != nil {
+	if err := m.DisableInterPeerForwarding(ctx, "wg0"); err != nil {
 		t.Fatal(err)
 	}
-	if err := m.RemoveNetworkBridge("wg0", "wg1"); err != nil {
+	if err := m.RemoveNetworkBridge(ctx, "wg0", "wg1"); err != nil {
 		t.Fatal(err)
 	}
 }
@@ -537,12 +678,12 @@ func TestConcurrentAccess(t *testing.T) {
 		go func(i int) {
 			defer wg.Done()
 			iface := fmt.Sprintf("wg%d", i)
-			_ = m.AddNATMasquerade(iface, fmt.Sprintf("10.%d.0.0/24", i))
+			_ = m.AddNATMasquerade(ctx, iface, fmt.Sprintf("10.%d.0.0/24", i))
 		}(i)
 		go func(i int) {
 			defer wg.Done()
 			iface := fmt.Sprintf("wg%d", i)
-			_ = m.EnableInterPeerForwarding(iface)
+			_ = m.EnableInterPeerForwarding(ctx, iface)
 		}(i)
 		go func(i int) {
 			defer wg.Done()
@@ -555,7 +696,7 @@ func TestConcurrentAccess(t *testing.T) {
 			defer wg.Done()
 			a := fmt.Sprintf("wg%d", i)
 			b := fmt.Sprintf("wg%d", i+5)
-			_ = m.AddNetworkBridge(a, b, "bidirectional")
+			_ = m.AddNetworkBridge(ctx, a, b, "bidirectional")
 		}(i)
 	}
 	wg.Wait()
@@ -566,12 +707,12 @@ func TestConcurrentAccess(t *testing.T) {
 		go func(i int) {
 			defer wg.Done()
 			iface := fmt.Sprintf("wg%d", i)
-			_ = m.RemoveNATMasquerade(iface)
+			_ = m.RemoveNATMasquerade(ctx, iface)
 		}(i)
 		go func(i int) {
 			defer wg.Done()
 			iface := fmt.Sprintf("wg%d", i)
-			_ = m.DisableInterPeerForwarding(iface)
+			_ = m.DisableInterPeerForwarding(ctx, iface)
 		}(i)
 	}
 	for i := 0; i < 5; i++ {
@@ -580,7 +721,7 @@ func TestConcurrentAccess(t *testing.T) {
 			defer wg.Done()
 			a := fmt.Sprintf("wg%d", i)
 			b := fmt.Sprintf("wg%d", i+5)
-			_ = m.RemoveNetworkBridge(a, b)
+			_ = m.RemoveNetworkBridge(ctx, a, b)
 		}(i)
 	}
 	wg.Wait()
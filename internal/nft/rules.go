@@ -14,6 +14,7 @@ const (
 	RuleInterPeerForward RuleKind = "inter_peer_forward"
 	RuleBridgeForward    RuleKind = "bridge_forward"
 	RuleUDPInput         RuleKind = "udp_input"
+	RulePeerThrottle     RuleKind = "peer_throttle"
 )
 
 // Rule represents a managed nftables rule in the wgpilot table.
@@ -24,6 +25,8 @@ type Rule struct {
 	Subnet    string // subnet CIDR, for NAT rules
 	Direction string // "a_to_b", "b_to_a", "bidirectional" for bridge rules
 	Port      int    // UDP port for input rules
+	Address   string // peer tunnel address (CIDR), for throttle rules
+	Rate      uint64 // bytes per second, for throttle rules
 }
 
 // ruleKey returns a unique identifier for the rule, used for deduplication.
@@ -37,6 +40,8 @@ func ruleKey(r Rule) string {
 		return "bridge:" + sortedPair(r.Iface, r.IfaceB)
 	case RuleUDPInput:
 		return fmt.Sprintf("udp:%d", r.Port)
+	case RulePeerThrottle:
+		return throttleKey(r.Iface, r.Address)
 	default:
 		return fmt.Sprintf("unknown:%s:%s", r.Kind, r.Iface)
 	}
@@ -47,6 +52,11 @@ func bridgeKey(ifaceA, ifaceB string) string {
 	return "bridge:" + sortedPair(ifaceA, ifaceB)
 }
 
+// throttleKey returns the canonical key for a peer throttle rule.
+func throttleKey(iface, address string) string {
+	return "throttle:" + iface + ":" + address
+}
+
 // sortedPair returns "a:b" where a <= b lexicographically.
 func sortedPair(a, b string) string {
 	if a > b {
@@ -124,6 +134,7 @@ func formatRuleset(rules map[string]Rule) string {
 	var natLines []string
 	var fwdEntries []forwardEntry
 	var inputLines []string
+	var throttleLines, throttle6Lines []string
 
 	for _, k := range keys {
 		r := rules[k]
@@ -137,6 +148,20 @@ func formatRuleset(rules map[string]Rule) string {
 		case RuleUDPInput:
 			inputLines = append(inputLines, fmt.Sprintf(
 				"    udp dport %d accept  # WireGuard", r.Port))
+		case RulePeerThrottle:
+			if isIPv6(r.Address) {
+				throttle6Lines = append(throttle6Lines,
+					fmt.Sprintf("    iifname %q ip6 saddr %s limit rate over %d bytes/second drop  # throttle",
+						r.Iface, r.Address, r.Rate),
+					fmt.Sprintf("    oifname %q ip6 daddr %s limit rate over %d bytes/second drop  # throttle",
+						r.Iface, r.Address, r.Rate))
+				continue
+			}
+			throttleLines = append(throttleLines,
+				fmt.Sprintf("    iifname %q ip saddr %s limit rate over %d bytes/second drop  # throttle",
+					r.Iface, r.Address, r.Rate),
+				fmt.Sprintf("    oifname %q ip daddr %s limit rate over %d bytes/second drop  # throttle",
+					r.Iface, r.Address, r.Rate))
 		}
 	}
 
@@ -171,9 +196,14 @@ func formatRuleset(rules map[string]Rule) string {
 		b.WriteString("  }\n")
 	}
 
-	if len(fwdEntries) > 0 {
+	if len(fwdEntries) > 0 || len(throttleLines) > 0 {
 		b.WriteString("  chain forward {\n")
 		b.WriteString("    type filter hook forward priority 0;\n")
+		// Throttle drops must precede accepts so they are evaluated first.
+		for _, line := range throttleLines {
+			b.WriteString(line)
+			b.WriteByte('\n')
+		}
 		for _, e := range fwdEntries {
 			fmt.Fprintf(&b, "    iifname %q oifname %q accept  # %s\n",
 				e.ifaceIn, e.ifaceOut, e.comment)
@@ -182,5 +212,16 @@ func formatRuleset(rules map[string]Rule) string {
 	}
 
 	b.WriteByte('}')
+
+	if len(throttle6Lines) > 0 {
+		b.WriteString("\ntable ip6 wgpilot {\n")
+		b.WriteString("  chain forward {\n")
+		b.WriteString("    type filter hook forward priority 0;\n")
+		for _, line := range throttle6Lines {
+			b.WriteString(line)
+			b.WriteByte('\n')
+		}
+		b.WriteString("  }\n}")
+	}
 	return b.String()
 }
@@ -0,0 +1,71 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrNotConfigured is returned when SMTP settings have not been set.
+var ErrNotConfigured = errors.New("smtp: not configured")
+
+// SettingsStore abstracts reading the settings table.
+type SettingsStore interface {
+	ListSettings(ctx context.Context) (map[string]string, error)
+}
+
+// Mailer sends email using the SMTP settings stored in the database.
+// Settings are read on every send so changes made through the settings
+// API take effect without a restart.
+type Mailer struct {
+	store SettingsStore
+}
+
+// NewMailer creates a Mailer backed by the given settings store.
+func NewMailer(store SettingsStore) (*Mailer, error) {
+	if store == nil {
+		return nil, fmt.Errorf("new mailer: store is required")
+	}
+	return &Mailer{store: store}, nil
+}
+
+// Send sends an email to the given recipients.
+func (m *Mailer) Send(ctx context.Context, to []string, subject, body string) error {
+	return m.SendWithAttachments(ctx, to, subject, body, nil)
+}
+
+// SendWithAttachments sends an email with attachments to the given
+// recipients.
+func (m *Mailer) SendWithAttachments(ctx context.Context, to []string, subject, body string, attachments []Attachment) error {
+	settings, err := m.store.ListSettings(ctx)
+	if err != nil {
+		return fmt.Errorf("mailer: load settings: %w", err)
+	}
+	if settings["smtp_host"] == "" {
+		return ErrNotConfigured
+	}
+	n, err := NewSMTPNotifier(SMTPConfig{
+		Host:     settings["smtp_host"],
+		Port:     settings["smtp_port"],
+		Username: settings["smtp_user"],
+		Password: settings["smtp_pass"],
+		From:     settings["smtp_from"],
+		TLS:      settings["smtp_tls"] == "true",
+	})
+	if err != nil {
+		return fmt.Errorf("mailer: %w", err)
+	}
+	return n.SendWithAttachments(to, subject, body, attachments)
+}
+
+// SplitRecipients parses a comma-separated address list, dropping blanks.
+func SplitRecipients(list string) []string {
+	var out []string
+	for _, addr := range strings.Split(list, ",") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			out = append(out, addr)
+		}
+	}
+	return out
+}
@@ -1,8 +1,14 @@
 package notify
 
 import (
+	"encoding/base64"
 	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
 	"net/smtp"
+	"net/textproto"
 	"strings"
 )
 
@@ -35,15 +41,34 @@ func NewSMTPNotifier(cfg SMTPConfig) (*SMTPNotifier, error) {
 	return &SMTPNotifier{cfg: cfg}, nil
 }
 
+// Attachment is a file attached to an email. Inline attachments are
+// referenced from the HTML body as "cid:<ContentID>".
+type Attachment struct {
+	Filename    string
+	ContentType string
+	Data        []byte
+	Inline      bool
+	ContentID   string // required for inline attachments
+}
+
 // Send sends an email to the given recipients.
 func (n *SMTPNotifier) Send(to []string, subject, body string) error {
+	return n.SendWithAttachments(to, subject, body, nil)
+}
+
+// SendWithAttachments sends an email with attachments to the given
+// recipients.
+func (n *SMTPNotifier) SendWithAttachments(to []string, subject, body string, attachments []Attachment) error {
 	if len(to) == 0 {
 		return fmt.Errorf("smtp: no recipients specified")
 	}
 
 	addr := fmt.Sprintf("%s:%s", n.cfg.Host, n.cfg.Port)
 
-	msg := buildMessage(n.cfg.From, to, subject, body)
+	msg, err := buildMessage(n.cfg.From, to, subject, body, attachments)
+	if err != nil {
+		return fmt.Errorf("smtp: build message: %w", err)
+	}
 
 	var auth smtp.Auth
 	if n.cfg.Username != "" {
@@ -57,14 +82,115 @@ func (n *SMTPNotifier) Send(to []string, subject, body string) error {
 	return nil
 }
 
-func buildMessage(from string, to []string, subject, body string) string {
+// buildMessage renders an HTML email. Without attachments it is a single
+// text/html part; with them it is multipart/mixed, with the body and any
+// inline attachments grouped in a multipart/related part.
+func buildMessage(from string, to []string, subject, body string, attachments []Attachment) (string, error) {
 	var sb strings.Builder
 	sb.WriteString(fmt.Sprintf("From: %s\r\n", from))
 	sb.WriteString(fmt.Sprintf("To: %s\r\n", strings.Join(to, ", ")))
-	sb.WriteString(fmt.Sprintf("Subject: %s\r\n", subject))
+	sb.WriteString(fmt.Sprintf("Subject: %s\r\n", mime.QEncoding.Encode("UTF-8", subject)))
 	sb.WriteString("MIME-Version: 1.0\r\n")
-	sb.WriteString("Content-Type: text/html; charset=\"UTF-8\"\r\n")
+	if len(attachments) == 0 {
+		sb.WriteString("Content-Type: text/html; charset=\"UTF-8\"\r\n")
+		sb.WriteString("\r\n")
+		sb.WriteString(body)
+		return sb.String(), nil
+	}
+
+	var inline, attached []Attachment
+	for _, a := range attachments {
+		if a.Inline {
+			inline = append(inline, a)
+		} else {
+			attached = append(attached, a)
+		}
+	}
+
+	mixed := multipart.NewWriter(&sb)
+	sb.WriteString(fmt.Sprintf("Content-Type: multipart/mixed; boundary=%q\r\n", mixed.Boundary()))
 	sb.WriteString("\r\n")
-	sb.WriteString(body)
-	return sb.String()
+
+	if len(inline) == 0 {
+		if err := writeHTMLPart(mixed, body); err != nil {
+			return "", err
+		}
+	} else {
+		var rel strings.Builder
+		related := multipart.NewWriter(&rel)
+		if err := writeHTMLPart(related, body); err != nil {
+			return "", err
+		}
+		for _, a := range inline {
+			if err := writeAttachmentPart(related, a); err != nil {
+				return "", err
+			}
+		}
+		if err := related.Close(); err != nil {
+			return "", err
+		}
+		h := textproto.MIMEHeader{}
+		h.Set("Content-Type", fmt.Sprintf("multipart/related; boundary=%q", related.Boundary()))
+		w, err := mixed.CreatePart(h)
+		if err != nil {
+			return "", err
+		}
+		if _, err := io.WriteString(w, rel.String()); err != nil {
+			return "", err
+		}
+	}
+
+	for _, a := range attached {
+		if err := writeAttachmentPart(mixed, a); err != nil {
+			return "", err
+		}
+	}
+	if err := mixed.Close(); err != nil {
+		return "", err
+	}
+	return sb.String(), nil
+}
+
+func writeHTMLPart(mw *multipart.Writer, body string) error {
+	h := textproto.MIMEHeader{}
+	h.Set("Content-Type", "text/html; charset=\"UTF-8\"")
+	h.Set("Content-Transfer-Encoding", "quoted-printable")
+	w, err := mw.CreatePart(h)
+	if err != nil {
+		return err
+	}
+	qp := quotedprintable.NewWriter(w)
+	if _, err := io.WriteString(qp, body); err != nil {
+		return err
+	}
+	return qp.Close()
+}
+
+func writeAttachmentPart(mw *multipart.Writer, a Attachment) error {
+	disposition := "attachment"
+	if a.Inline {
+		disposition = "inline"
+	}
+	h := textproto.MIMEHeader{}
+	h.Set("Content-Type", a.ContentType)
+	h.Set("Content-Transfer-Encoding", "base64")
+	h.Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": a.Filename}))
+	if a.ContentID != "" {
+		h.Set("Content-ID", "<"+a.ContentID+">")
+	}
+	w, err := mw.CreatePart(h)
+	if err != nil {
+		return err
+	}
+
+	// Base64 lines are limited to 76 characters (RFC 2045).
+	encoded := base64.StdEncoding.EncodeToString(a.Data)
+	for len(encoded) > 76 {
+		if _, err := io.WriteString(w, encoded[:76]+"\r\n"); err != nil {
+			return err
+		}
+		encoded = encoded[76:]
+	}
+	_, err = io.WriteString(w, encoded+"\r\n")
+	return err
 }
@@ -0,0 +1,110 @@
+package notify
+
+import (
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"strings"
+	"testing"
+)
+
+func TestBuildMessage_Plain(t *testing.T) {
+	msg, err := buildMessage("wgpilot@example.com", []string{"a@example.com"}, "Hello", "<p>hi</p>", nil)
+	if err != nil {
+		t.Fatalf("buildMessage: %v", err)
+	}
+	if !strings.Contains(msg, "Content-Type: text/html; charset=\"UTF-8\"\r\n\r\n<p>hi</p>") {
+		t.Errorf("expected a single HTML part, got:\n%s", msg)
+	}
+}
+
+func TestBuildMessage_Attachments(t *testing.T) {
+	msg, err := buildMessage("wgpilot@example.com", []string{"a@example.com"}, "Config\r\nBcc: x@example.com", `<img src="cid:qr">`, []Attachment{
+		{Filename: "qr.png", ContentType: "image/png", Data: []byte("png-bytes"), Inline: true, ContentID: "qr"},
+		{Filename: "laptop.conf", ContentType: "text/plain", Data: []byte("[Interface]\n")},
+	})
+	if err != nil {
+		t.Fatalf("buildMessage: %v", err)
+	}
+
+	m, err := mail.ReadMessage(strings.NewReader(msg))
+	if err != nil {
+		t.Fatalf("parse message: %v", err)
+	}
+	if m.Header.Get("Bcc") != "" {
+		t.Error("subject must not inject headers")
+	}
+	mediaType, params, err := mime.ParseMediaType(m.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/mixed" {
+		t.Fatalf("expected multipart/mixed, got %q (%v)", mediaType, err)
+	}
+
+	mixed := multipart.NewReader(m.Body, params["boundary"])
+	related, err := mixed.NextPart()
+	if err != nil {
+		t.Fatalf("related part: %v", err)
+	}
+	mediaType, params, _ = mime.ParseMediaType(related.Header.Get("Content-Type"))
+	if mediaType != "multipart/related" {
+		t.Fatalf("expected multipart/related first, got %q", mediaType)
+	}
+	inner := multipart.NewReader(related, params["boundary"])
+	html, err := inner.NextPart()
+	if err != nil {
+		t.Fatalf("html part: %v", err)
+	}
+	if b, _ := io.ReadAll(html); string(b) != `<img src="cid:qr">` {
+		t.Errorf("unexpected HTML body %q", b)
+	}
+	img, err := inner.NextPart()
+	if err != nil {
+		t.Fatalf("image part: %v", err)
+	}
+	if img.Header.Get("Content-ID") != "<qr>" || !strings.HasPrefix(img.Header.Get("Content-Disposition"), "inline") {
+		t.Errorf("expected an inline image with a Content-ID, got %v", img.Header)
+	}
+
+	conf, err := mixed.NextPart()
+	if err != nil {
+		t.Fatalf("attachment part: %v", err)
+	}
+	if conf.FileName() != "laptop.conf" || !strings.HasPrefix(conf.Header.Get("Content-Disposition"), "attachment") {
+		t.Errorf("expected the config as an attachment, got %v", conf.Header)
+	}
+	if _, err := mixed.NextPart(); err != io.EOF {
+		t.Errorf("expected two top-level parts, got %v", err)
+	}
+}
+
+func TestPeerConfigEmail(t *testing.T) {
+	subject, body, err := PeerConfigEmail("", "", PeerConfigData{PeerName: "<Laptop>", NetworkName: "Office", Filename: "wgpilot-Laptop.conf"})
+	if err != nil {
+		t.Fatalf("PeerConfigEmail: %v", err)
+	}
+	if subject != "Your WireGuard config for Office" {
+		t.Errorf("unexpected subject %q", subject)
+	}
+	if !strings.Contains(body, "&lt;Laptop&gt;") || !strings.Contains(body, `src="cid:`+PeerConfigQRContentID+`"`) {
+		t.Errorf("expected an escaped name and the inline QR code, got:\n%s", body)
+	}
+
+	if _, _, err := PeerConfigEmail("", "{{.Nope}}", PeerConfigData{}); err == nil {
+		t.Error("expected an error for an unknown field")
+	}
+}
+
+func TestEndpointAlert(t *testing.T) {
+	body := EndpointAlert("<b>phone</b>", "connected from 203.0.113.1:51820", "endpoint_country", "Zurich, CH (AS20712 Andrews & Arnold Ltd)")
+	for _, want := range []string{
+		"<strong>&lt;b&gt;phone&lt;/b&gt;</strong> connected from 203.0.113.1:51820.",
+		"<p>Location: Zurich, CH (AS20712 Andrews &amp; Arnold Ltd)</p>",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected %q in body:\n%s", want, body)
+		}
+	}
+	if strings.Contains(body, "\n") {
+		t.Errorf("expected an HTML body without plain-text line breaks:\n%s", body)
+	}
+}
@@ -2,7 +2,10 @@ package notify
 
 import (
 	"fmt"
+	"html"
+	htmltemplate "html/template"
 	"strings"
+	"text/template"
 )
 
 // PeerOfflineAlert formats an email body for a peer-offline alert.
@@ -16,3 +19,154 @@ func PeerOfflineAlert(peerName, networkName string, offlineSince string) string
 	sb.WriteString("</body></html>")
 	return sb.String()
 }
+
+// EndpointAlert formats an email body for a suspicious peer endpoint. detail
+// completes the sentence "Peer X ...", and location is the endpoint's GeoIP
+// location, if known.
+func EndpointAlert(peerName, detail, alertType, location string) string {
+	var sb strings.Builder
+	sb.WriteString("<html><body>")
+	sb.WriteString("<h2>Suspicious Endpoint</h2>")
+	sb.WriteString(fmt.Sprintf("<p>Peer <strong>%s</strong> %s.</p>",
+		html.EscapeString(peerName), html.EscapeString(detail)))
+	sb.WriteString(fmt.Sprintf("<p>Alert: %s</p>", html.EscapeString(alertType)))
+	if location != "" {
+		sb.WriteString(fmt.Sprintf("<p>Location: %s</p>", html.EscapeString(location)))
+	}
+	sb.WriteString("<p>This is an automated notification from wgpilot.</p>")
+	sb.WriteString("</body></html>")
+	return sb.String()
+}
+
+// QuotaWarningAlert formats an email body for a peer reaching a percentage
+// of its monthly data quota.
+func QuotaWarningAlert(peerName, networkName string, percent int, used, quota int64, resetsAt string) string {
+	var sb strings.Builder
+	sb.WriteString("<html><body>")
+	sb.WriteString(fmt.Sprintf("<h2>Data Quota at %d%%</h2>", percent))
+	sb.WriteString(fmt.Sprintf("<p>Peer <strong>%s</strong> on network <strong>%s</strong> has used %s of its %s monthly quota.</p>",
+		html.EscapeString(peerName), html.EscapeString(networkName), formatBytes(used), formatBytes(quota)))
+	sb.WriteString(fmt.Sprintf("<p>The quota resets on %s.</p>", resetsAt))
+	sb.WriteString("<p>This is an automated notification from wgpilot.</p>")
+	sb.WriteString("</body></html>")
+	return sb.String()
+}
+
+// QuotaExceededAlert formats an email body for a peer that exceeded its
+// monthly data quota and had the quota action applied.
+func QuotaExceededAlert(peerName, networkName, action string, used, quota int64, resetsAt string) string {
+	var sb strings.Builder
+	sb.WriteString("<html><body>")
+	sb.WriteString("<h2>Data Quota Exceeded</h2>")
+	sb.WriteString(fmt.Sprintf("<p>Peer <strong>%s</strong> on network <strong>%s</strong> has used %s of its %s monthly quota and has been %s.</p>",
+		html.EscapeString(peerName), html.EscapeString(networkName), formatBytes(used), formatBytes(quota), actionPastTense(action)))
+	sb.WriteString(fmt.Sprintf("<p>Full access will be restored automatically on %s.</p>", resetsAt))
+	sb.WriteString("<p>This is an automated notification from wgpilot.</p>")
+	sb.WriteString("</body></html>")
+	return sb.String()
+}
+
+// PasswordResetEmail formats an email body carrying a one-time password
+// reset token, and a link to use it when resetURL is not empty.
+func PasswordResetEmail(username, resetURL, token, expiresAt string) string {
+	var sb strings.Builder
+	sb.WriteString("<html><body>")
+	sb.WriteString("<h2>Password Reset</h2>")
+	sb.WriteString(fmt.Sprintf("<p>A password reset was requested for the wgpilot account <strong>%s</strong>.</p>",
+		html.EscapeString(username)))
+	if resetURL != "" {
+		sb.WriteString(fmt.Sprintf("<p><a href=\"%s\">Choose a new password</a>, or use this reset token: <code>%s</code></p>",
+			html.EscapeString(resetURL), html.EscapeString(token)))
+	} else {
+		sb.WriteString(fmt.Sprintf("<p>Enter this reset token on the wgpilot password reset page: <code>%s</code></p>",
+			html.EscapeString(token)))
+	}
+	sb.WriteString(fmt.Sprintf("<p>The token can be used once and expires at %s. If you did not request a reset, you can ignore this email.</p>", expiresAt))
+	sb.WriteString("<p>This is an automated notification from wgpilot.</p>")
+	sb.WriteString("</body></html>")
+	return sb.String()
+}
+
+// PeerConfigQRContentID is the Content-ID of the inline QR code image in
+// peer config emails.
+const PeerConfigQRContentID = "wgpilot-qr"
+
+// Default templates for peer config emails, used when the
+// peer_config_email_subject and peer_config_email_body settings are empty.
+const (
+	DefaultPeerConfigSubject = `Your WireGuard config for {{.NetworkName}}`
+	DefaultPeerConfigBody    = `<html><body>
+<h2>WireGuard Config for {{.PeerName}}</h2>
+<p>Your device <strong>{{.PeerName}}</strong> has been added to network <strong>{{.NetworkName}}</strong> with address {{.Address}}.</p>
+<p>Scan this QR code with the WireGuard mobile app, or import the attached {{.Filename}} into the WireGuard desktop app:</p>
+<p><img src="{{.QRCode}}" alt="WireGuard config QR code" width="256" height="256"></p>
+<p>The config contains your private key. Do not share it.</p>
+<p>This is an automated notification from wgpilot.</p>
+</body></html>`
+)
+
+// PeerConfigData is the data available to peer config email templates.
+type PeerConfigData struct {
+	PeerName    string
+	NetworkName string
+	Address     string
+	Filename    string           // name of the attached .conf file
+	QRCode      htmltemplate.URL // image URL of the inline QR code
+}
+
+// PeerConfigEmail renders the subject and body of an email carrying a peer's
+// config. Empty templates fall back to the defaults. The subject is a
+// text/template and the body an html/template, so values in the body are
+// escaped.
+func PeerConfigEmail(subjectTmpl, bodyTmpl string, data PeerConfigData) (subject, body string, err error) {
+	if subjectTmpl == "" {
+		subjectTmpl = DefaultPeerConfigSubject
+	}
+	if bodyTmpl == "" {
+		bodyTmpl = DefaultPeerConfigBody
+	}
+	if data.QRCode == "" {
+		data.QRCode = htmltemplate.URL("cid:" + PeerConfigQRContentID)
+	}
+
+	st, err := template.New("subject").Parse(subjectTmpl)
+	if err != nil {
+		return "", "", fmt.Errorf("parse subject template: %w", err)
+	}
+	var sb strings.Builder
+	if err := st.Execute(&sb, data); err != nil {
+		return "", "", fmt.Errorf("render subject template: %w", err)
+	}
+
+	bt, err := htmltemplate.New("body").Parse(bodyTmpl)
+	if err != nil {
+		return "", "", fmt.Errorf("parse body template: %w", err)
+	}
+	var bb strings.Builder
+	if err := bt.Execute(&bb, data); err != nil {
+		return "", "", fmt.Errorf("render body template: %w", err)
+	}
+
+	return sb.String(), bb.String(), nil
+}
+
+func actionPastTense(action string) string {
+	if action == "throttle" {
+		return "throttled"
+	}
+	return "disabled"
+}
+
+// formatBytes renders a byte count using binary units.
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -3,7 +3,7 @@ package server
 import (
 	"context"
 	"fmt"
-	"time"
+	"net/netip"
 
 	"github.com/itsChris/wgpilot/internal/db"
 	servermw "github.com/itsChris/wgpilot/internal/server/middleware"
@@ -17,17 +17,32 @@ type apiKeyStoreAdapter struct {
 	db *db.DB
 }
 
-func (a *apiKeyStoreAdapter) GetAPIKeyByHash(ctx context.Context, hash string) (id int64, userID int64, role string, expiresAt *time.Time, err error) {
+func (a *apiKeyStoreAdapter) GetAPIKeyByHash(ctx context.Context, hash string) (*servermw.APIKey, error) {
 	k, err := a.db.GetAPIKeyByHash(ctx, hash)
 	if err != nil {
-		return 0, 0, "", nil, fmt.Errorf("get api key by hash: %w", err)
+		return nil, fmt.Errorf("get api key by hash: %w", err)
 	}
 	if k == nil {
-		return 0, 0, "", nil, fmt.Errorf("api key not found")
+		return nil, nil
 	}
-	return k.ID, k.UserID, k.Role, k.ExpiresAt, nil
+	key := &servermw.APIKey{
+		ID:         k.ID,
+		UserID:     k.UserID,
+		Role:       k.Role,
+		ExpiresAt:  k.ExpiresAt,
+		Scopes:     k.Scopes,
+		NetworkIDs: k.NetworkIDs,
+	}
+	for _, cidr := range k.AllowedCIDRs {
+		prefix, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("api key %d: parse allowed cidr %q: %w", k.ID, cidr, err)
+		}
+		key.AllowedCIDRs = append(key.AllowedCIDRs, prefix)
+	}
+	return key, nil
 }
 
-func (a *apiKeyStoreAdapter) UpdateAPIKeyLastUsed(ctx context.Context, id int64) error {
-	return a.db.UpdateAPIKeyLastUsed(ctx, id)
+func (a *apiKeyStoreAdapter) UpdateAPIKeyLastUsed(ctx context.Context, id int64, ip string) error {
+	return a.db.UpdateAPIKeyLastUsed(ctx, id, ip)
 }
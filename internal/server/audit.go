@@ -13,6 +13,12 @@ import (
 // the request context and the IP address from the request. Errors are logged
 // but do not affect the request outcome.
 func (s *Server) auditLog(r *http.Request, action, resource, detail string) {
+	s.auditNetworkLog(r, 0, action, resource, detail)
+}
+
+// auditNetworkLog is like auditLog for an action on network networkID, so
+// that users with a role on that network can see the entry.
+func (s *Server) auditNetworkLog(r *http.Request, networkID int64, action, resource, detail string) {
 	ctx := r.Context()
 
 	var userID int64
@@ -28,6 +34,7 @@ func (s *Server) auditLog(r *http.Request, action, resource, detail string) {
 		Resource:  resource,
 		Detail:    detail,
 		IPAddress: r.RemoteAddr,
+		NetworkID: networkID,
 	}
 
 	if err := s.db.InsertAuditEntry(ctx, entry); err != nil {
@@ -44,3 +51,8 @@ func (s *Server) auditLog(r *http.Request, action, resource, detail string) {
 func (s *Server) auditf(r *http.Request, action, resource, format string, args ...any) {
 	s.auditLog(r, action, resource, fmt.Sprintf(format, args...))
 }
+
+// auditNetworkf is like auditf for an action on network networkID.
+func (s *Server) auditNetworkf(r *http.Request, networkID int64, action, resource, format string, args ...any) {
+	s.auditNetworkLog(r, networkID, action, resource, fmt.Sprintf(format, args...))
+}
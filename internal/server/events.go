@@ -0,0 +1,151 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/itsChris/wgpilot/internal/auth"
+	apperr "github.com/itsChris/wgpilot/internal/errors"
+	"github.com/itsChris/wgpilot/internal/events"
+)
+
+// sseKeepaliveInterval is how often an idle event stream sends a comment so
+// proxies don't close the connection.
+const sseKeepaliveInterval = 30 * time.Second
+
+// ── Request/Response types ──────────────────────────────────────────
+
+// eventResponse is the JSON shape of an event on GET /api/events.
+type eventResponse struct {
+	ID        uint64 `json:"id"`
+	Type      string `json:"type"`
+	Timestamp int64  `json:"timestamp"`
+	NetworkID int64  `json:"network_id,omitempty"`
+	PeerID    int64  `json:"peer_id,omitempty"`
+	Data      any    `json:"data,omitempty"`
+}
+
+func eventToResponse(e events.Event) eventResponse {
+	return eventResponse{
+		ID:        e.ID,
+		Type:      e.Type,
+		Timestamp: e.Time.Unix(),
+		NetworkID: e.NetworkID,
+		PeerID:    e.PeerID,
+		Data:      e.Data,
+	}
+}
+
+// ── Handlers ────────────────────────────────────────────────────────
+
+// handleEvents streams typed events from the event bus via Server-Sent Events.
+// Query params: topics (comma-separated topics or event types, e.g.
+// "peer,network.status"; default all), network_id (optional).
+// A client reconnecting with a Last-Event-ID header first receives the
+// buffered events it missed. If some were no longer buffered, a "reset" event
+// is sent before the replay and the client should reload its state.
+// Callers whose network:read comes from network roles only receive events
+// for those networks.
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	var filter events.Filter
+	var errs []fieldError
+
+	if v := r.URL.Query().Get("topics"); v != "" {
+		for _, t := range strings.Split(v, ",") {
+			t = strings.TrimSpace(t)
+			if t == "" {
+				continue
+			}
+			if !events.ValidTopic(t) {
+				errs = append(errs, fieldError{Field: "topics", Message: fmt.Sprintf("unknown topic %q", t)})
+				continue
+			}
+			filter.Topics = append(filter.Topics, t)
+		}
+	}
+	if v := r.URL.Query().Get("network_id"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || id <= 0 {
+			errs = append(errs, fieldError{Field: "network_id", Message: "must be a positive integer"})
+		}
+		filter.NetworkID = id
+	}
+	filter.NetworkIDs = auth.GrantsFromContext(r.Context()).NetworksWith(auth.PermNetworkRead)
+	var lastID uint64
+	if v := r.Header.Get("Last-Event-ID"); v != "" {
+		id, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			writeError(w, r, fmt.Errorf("invalid Last-Event-ID"), apperr.ErrValidation, http.StatusBadRequest, s.devMode)
+			return
+		}
+		lastID = id
+	}
+	if len(errs) > 0 {
+		writeValidationError(w, r, errs)
+		return
+	}
+
+	sub, replay, complete := s.events.Subscribe(filter, lastID)
+	defer sub.Close()
+
+	rc := http.NewResponseController(w)
+	setSSEHeaders(w)
+	w.WriteHeader(http.StatusOK)
+
+	if !complete {
+		fmt.Fprint(w, "event: reset\ndata: {}\n\n")
+	}
+	for _, e := range replay {
+		writeSSEEvent(w, e.ID, e.Type, eventToResponse(e))
+	}
+	rc.Flush()
+
+	keepalive := time.NewTicker(sseKeepaliveInterval)
+	defer keepalive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case e, ok := <-sub.C:
+			if !ok {
+				// Dropped for falling behind; the client reconnects
+				// with Last-Event-ID and catches up from the buffer.
+				s.logger.Warn("sse_subscriber_dropped",
+					"operation", "sse_events",
+					"component", "handler",
+				)
+				return
+			}
+			writeSSEEvent(w, e.ID, e.Type, eventToResponse(e))
+			rc.Flush()
+		case <-keepalive.C:
+			fmt.Fprint(w, ": keepalive\n\n")
+			rc.Flush()
+		}
+	}
+}
+
+// setSSEHeaders sets the response headers for an event stream.
+func setSSEHeaders(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+}
+
+// writeSSEEvent writes a single SSE event with a JSON payload. An id of 0
+// omits the id field.
+func writeSSEEvent(w http.ResponseWriter, id uint64, eventType string, data any) {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return
+	}
+	if id > 0 {
+		fmt.Fprintf(w, "id: %d\n", id)
+	}
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", eventType, payload)
+}
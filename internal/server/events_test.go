@@ -0,0 +1,195 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/itsChris/wgpilot/internal/events"
+)
+
+// sseEvent is one event read from an SSE stream.
+type sseEvent struct {
+	id, event, data string
+}
+
+// openEventStream connects to path on a real HTTP server and returns a reader
+// for its events. The stream is closed when the test ends.
+func openEventStream(t *testing.T, srv *Server, path string, header http.Header) func() sseEvent {
+	t.Helper()
+	ts := httptest.NewServer(srv)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	t.Cleanup(func() {
+		cancel()
+		ts.Close()
+	})
+
+	req, err := http.NewRequestWithContext(ctx, "GET", ts.URL+path, nil)
+	if err != nil {
+		t.Fatalf("new request: %v", err)
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.AddCookie(authCookie(t, srv))
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("do request: %v", err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	return func() sseEvent {
+		t.Helper()
+		var e sseEvent
+		for scanner.Scan() {
+			line := scanner.Text()
+			switch {
+			case line == "" && e.event != "":
+				return e
+			case strings.HasPrefix(line, "id: "):
+				e.id = strings.TrimPrefix(line, "id: ")
+			case strings.HasPrefix(line, "event: "):
+				e.event = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "data: "):
+				e.data = strings.TrimPrefix(line, "data: ")
+			}
+		}
+		t.Fatalf("stream ended before next event: %v", scanner.Err())
+		return e
+	}
+}
+
+func TestHandleEvents_StreamsHandlerEvents(t *testing.T) {
+	srv, _, _ := newTestServerWithWG(t)
+	netID := createTestNetwork(t, srv)
+
+	next := openEventStream(t, srv, "/api/events?topics=peer", nil)
+
+	body := `{"name": "My Phone", "role": "client"}`
+	req := httptest.NewRequest("POST", fmt.Sprintf("/api/networks/%d/peers", netID), strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req = authRequest(t, srv, req)
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+
+	e := next()
+	if e.event != events.TypePeerCreated || e.id == "" {
+		t.Fatalf("expected peer.created with id, got %+v", e)
+	}
+	var resp eventResponse
+	if err := json.Unmarshal([]byte(e.data), &resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if resp.NetworkID != netID || resp.PeerID == 0 || resp.Timestamp == 0 {
+		t.Errorf("unexpected event: %+v", resp)
+	}
+	if data, _ := resp.Data.(map[string]any); data["name"] != "My Phone" {
+		t.Errorf("expected peer in data, got %v", resp.Data)
+	}
+}
+
+func TestHandleEvents_LastEventIDReplay(t *testing.T) {
+	srv := newTestServerForMonitoring(t)
+	srv.events.Publish(events.Event{Type: events.TypePeerCreated, NetworkID: 1, PeerID: 1})
+	srv.events.Publish(events.Event{Type: events.TypeNetworkUpdated, NetworkID: 1})
+	srv.events.Publish(events.Event{Type: events.TypePeerUpdated, NetworkID: 1, PeerID: 1})
+
+	header := http.Header{"Last-Event-Id": []string{"1"}}
+	next := openEventStream(t, srv, "/api/events?topics=peer&network_id=1", header)
+
+	e := next()
+	if e.id != "3" || e.event != events.TypePeerUpdated {
+		t.Errorf("expected replay of event 3, got %+v", e)
+	}
+
+	srv.events.Publish(events.Event{Type: events.TypePeerDeleted, NetworkID: 1, PeerID: 1})
+	if e := next(); e.id != "4" || e.event != events.TypePeerDeleted {
+		t.Errorf("expected live event 4, got %+v", e)
+	}
+}
+
+func TestHandleEvents_ResetWhenReplayIncomplete(t *testing.T) {
+	srv := newTestServerForMonitoring(t)
+	srv.events.Publish(events.Event{Type: events.TypePeerCreated})
+
+	// An ID from before a restart.
+	header := http.Header{"Last-Event-Id": []string{"500"}}
+	next := openEventStream(t, srv, "/api/events", header)
+
+	if e := next(); e.event != "reset" {
+		t.Errorf("expected reset event, got %+v", e)
+	}
+	if e := next(); e.id != "1" {
+		t.Errorf("expected buffered event 1 after reset, got %+v", e)
+	}
+}
+
+func TestHandleEvents_Validation(t *testing.T) {
+	srv := newTestServerForMonitoring(t)
+
+	tests := []struct {
+		name   string
+		url    string
+		header string
+	}{
+		{"unknown topic", "/api/events?topics=peer,weather", ""},
+		{"invalid network id", "/api/events?network_id=abc", ""},
+		{"invalid last event id", "/api/events", "abc"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tt.url, nil)
+			if tt.header != "" {
+				req.Header.Set("Last-Event-ID", tt.header)
+			}
+			req.AddCookie(authCookie(t, srv))
+			w := httptest.NewRecorder()
+			srv.ServeHTTP(w, req)
+
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("expected 400, got %d", w.Code)
+			}
+		})
+	}
+}
+
+func TestHandleSSEEvents_UsesPolledStatus(t *testing.T) {
+	srv := newTestServerForMonitoring(t)
+	netID := createTestNetwork(t, srv)
+
+	srv.events.Publish(events.Event{
+		Type:      events.TypeNetworkStatus,
+		NetworkID: netID,
+		Data:      []map[string]any{{"peer_id": 7, "online": true, "public_key": "polled"}},
+	})
+
+	next := openEventStream(t, srv, fmt.Sprintf("/api/networks/%d/events", netID), nil)
+
+	e := next()
+	if e.event != "status" || !strings.Contains(e.data, `"polled"`) {
+		t.Fatalf("expected last polled status, got %+v", e)
+	}
+
+	srv.events.Publish(events.Event{
+		Type:      events.TypeNetworkStatus,
+		NetworkID: netID,
+		Data:      []map[string]any{{"peer_id": 7, "online": false, "public_key": "polled"}},
+	})
+	if e := next(); e.event != "status" || !strings.Contains(e.data, `"online":false`) {
+		t.Errorf("expected status update from the bus, got %+v", e)
+	}
+}
@@ -0,0 +1,39 @@
+package server
+
+// locationResponse is the GeoIP enrichment attached to endpoints and
+// client addresses when a GeoIP database is configured.
+type locationResponse struct {
+	Country     string `json:"country,omitempty"`
+	CountryName string `json:"country_name,omitempty"`
+	City        string `json:"city,omitempty"`
+	ASN         uint32 `json:"asn,omitempty"`
+	ASOrg       string `json:"as_org,omitempty"`
+}
+
+// locate returns the location of an endpoint ("ip:port") or bare IP address.
+// It returns nil when no GeoIP database is configured or the address is not
+// in it. Lookup errors are logged and treated as an unknown location.
+func (s *Server) locate(endpoint string) *locationResponse {
+	if s.geo == nil || endpoint == "" {
+		return nil
+	}
+	loc, err := s.geo.LookupEndpoint(endpoint)
+	if err != nil {
+		s.logger.Warn("geoip_lookup_failed",
+			"error", err,
+			"endpoint", endpoint,
+			"component", "geoip",
+		)
+		return nil
+	}
+	if loc == nil {
+		return nil
+	}
+	return &locationResponse{
+		Country:     loc.Country,
+		CountryName: loc.CountryName,
+		City:        loc.City,
+		ASN:         loc.ASN,
+		ASOrg:       loc.ASOrg,
+	}
+}
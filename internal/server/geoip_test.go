@@ -0,0 +1,147 @@
+package server
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/itsChris/wgpilot/internal/db"
+	"github.com/itsChris/wgpilot/internal/geoip"
+	"github.com/itsChris/wgpilot/internal/testutil"
+)
+
+// withTestGeoIP attaches a GeoIP database that places 203.0.113.0/24 in
+// Zurich and 198.51.100.0/24 in Berlin.
+func withTestGeoIP(t *testing.T, srv *Server) {
+	t.Helper()
+	city := func(iso, country, name string) map[string]any {
+		return map[string]any{
+			"country": map[string]any{"iso_code": iso, "names": map[string]any{"en": country}},
+			"city":    map[string]any{"names": map[string]any{"en": name}},
+		}
+	}
+	path := filepath.Join(t.TempDir(), "city.mmdb")
+	err := testutil.WriteMMDB(path, "GeoLite2-City", 24, []testutil.MMDBRecord{
+		{Prefix: netip.MustParsePrefix("203.0.113.0/24"), Data: city("CH", "Switzerland", "Zurich")},
+		{Prefix: netip.MustParsePrefix("198.51.100.0/24"), Data: city("DE", "Germany", "Berlin")},
+	})
+	if err != nil {
+		t.Fatalf("write mmdb: %v", err)
+	}
+	geo, err := geoip.Open(path)
+	if err != nil {
+		t.Fatalf("open geoip: %v", err)
+	}
+	srv.geo = geo
+}
+
+func TestGeoIP_Sessions(t *testing.T) {
+	srv, _, _ := newTestServerWithWG(t)
+	withTestGeoIP(t, srv)
+	netID := createTestNetwork(t, srv)
+	peerID := createSessionFixture(t, srv, netID, time.Now().Truncate(time.Second))
+
+	req := httptest.NewRequest("GET", fmt.Sprintf("/api/networks/%d/peers/%d/sessions", netID, peerID), nil)
+	req = authRequest(t, srv, req)
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp []peerSessionResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(resp) != 2 {
+		t.Fatalf("expected 2 sessions, got %d", len(resp))
+	}
+	if loc := resp[0].Location; loc == nil || loc.Country != "CH" || loc.City != "Zurich" {
+		t.Errorf("expected Zurich for open session, got %+v", loc)
+	}
+	if loc := resp[1].Location; loc == nil || loc.Country != "DE" {
+		t.Errorf("expected DE for closed session, got %+v", loc)
+	}
+
+	req = httptest.NewRequest("GET", fmt.Sprintf("/api/networks/%d/peers/%d/sessions?format=csv", netID, peerID), nil)
+	req = authRequest(t, srv, req)
+	w = httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+
+	records, err := csv.NewReader(w.Body).ReadAll()
+	if err != nil {
+		t.Fatalf("parse csv: %v", err)
+	}
+	if len(records) != 3 || records[0][6] != "country" || records[1][6] != "CH" || records[1][7] != "Zurich" {
+		t.Errorf("unexpected csv location columns: %v", records)
+	}
+}
+
+func TestGeoIP_PeerDetailAndAudit(t *testing.T) {
+	srv, _, _ := newTestServerWithWG(t)
+	withTestGeoIP(t, srv)
+	netID := createTestNetwork(t, srv)
+	peerID := createSessionFixture(t, srv, netID, time.Now().Truncate(time.Second))
+
+	req := httptest.NewRequest("GET", fmt.Sprintf("/api/networks/%d/peers/%d", netID, peerID), nil)
+	req = authRequest(t, srv, req)
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+
+	var peer peerDetailResponse
+	if err := json.NewDecoder(w.Body).Decode(&peer); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(peer.EndpointHistory) == 0 || peer.EndpointHistory[0].Location == nil || peer.EndpointHistory[0].Location.Country != "CH" {
+		t.Errorf("expected located endpoint history, got %+v", peer.EndpointHistory)
+	}
+
+	if err := srv.db.InsertAuditEntry(context.Background(), &db.AuditEntry{
+		Action: "peer.updated", Resource: "peer:1", IPAddress: "198.51.100.20:41234",
+	}); err != nil {
+		t.Fatalf("insert audit entry: %v", err)
+	}
+	req = httptest.NewRequest("GET", "/api/audit-log?action=peer.updated", nil)
+	req = authRequest(t, srv, req)
+	w = httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var audit auditLogResponse
+	if err := json.NewDecoder(w.Body).Decode(&audit); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(audit.Entries) != 1 || audit.Entries[0].Location == nil || audit.Entries[0].Location.City != "Berlin" {
+		t.Errorf("expected audit entry located in Berlin, got %+v", audit.Entries)
+	}
+}
+
+func TestGeoIP_DisabledOmitsLocation(t *testing.T) {
+	srv, _, _ := newTestServerWithWG(t)
+	netID := createTestNetwork(t, srv)
+	peerID := createSessionFixture(t, srv, netID, time.Now().Truncate(time.Second))
+
+	req := httptest.NewRequest("GET", fmt.Sprintf("/api/networks/%d/peers/%d/sessions", netID, peerID), nil)
+	req = authRequest(t, srv, req)
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+
+	var resp []map[string]any
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	for _, sess := range resp {
+		if _, ok := sess["location"]; ok {
+			t.Errorf("expected no location without GeoIP database, got %v", sess)
+		}
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"log/slog"
 	"net/http"
+	"net/netip"
 	"strconv"
 	"strings"
 	"time"
@@ -12,15 +13,32 @@ import (
 	"github.com/itsChris/wgpilot/internal/auth"
 )
 
+// APIKey is what the auth middleware needs to know about an API key.
+type APIKey struct {
+	ID        int64
+	UserID    int64
+	Role      string
+	ExpiresAt *time.Time
+	// Scopes and NetworkIDs narrow the key's permissions; AllowedCIDRs the
+	// addresses it may be used from. Empty means no restriction.
+	Scopes       []string
+	NetworkIDs   []int64
+	AllowedCIDRs []netip.Prefix
+}
+
 // APIKeyStore abstracts API key lookups for the auth middleware.
 type APIKeyStore interface {
-	GetAPIKeyByHash(ctx context.Context, hash string) (id int64, userID int64, role string, expiresAt *time.Time, err error)
-	UpdateAPIKeyLastUsed(ctx context.Context, id int64) error
+	// GetAPIKeyByHash returns nil, nil if no key has the hash.
+	GetAPIKeyByHash(ctx context.Context, hash string) (*APIKey, error)
+	UpdateAPIKeyLastUsed(ctx context.Context, id int64, ip string) error
 }
 
 // RequireAuth returns middleware that validates the JWT from the session cookie
 // or an API key from the Authorization header, and injects the user claims
-// into the request context.
+// into the request context. Session tokens must also pass sessions.Verify,
+// so revoked sessions are rejected. API keys must be unexpired and used from
+// one of their allowed addresses; their scopes and networks are passed on in
+// the claims.
 func RequireAuth(jwtSvc *auth.JWTService, sessions *auth.SessionManager, logger *slog.Logger, apiKeyStore ...APIKeyStore) func(http.Handler) http.Handler {
 	var keyStore APIKeyStore
 	if len(apiKeyStore) > 0 {
@@ -35,26 +53,41 @@ func RequireAuth(jwtSvc *auth.JWTService, sessions *auth.SessionManager, logger
 					apiKey := strings.TrimPrefix(bearer, "Bearer ")
 					hash := auth.HashAPIKey(apiKey)
 
-					id, userID, role, expiresAt, err := keyStore.GetAPIKeyByHash(r.Context(), hash)
-					if err == nil && id > 0 {
+					key, err := keyStore.GetAPIKeyByHash(r.Context(), hash)
+					if err == nil && key != nil {
 						// Check expiry.
-						if expiresAt != nil && expiresAt.Before(time.Now()) {
+						if key.ExpiresAt != nil && key.ExpiresAt.Before(time.Now()) {
 							writeAuthError(w, "api key expired", "SESSION_EXPIRED", http.StatusUnauthorized)
 							return
 						}
 
+						ip := auth.ClientIP(r)
+						if !addrAllowed(ip, key.AllowedCIDRs) {
+							logger.Warn("auth_api_key_address_denied",
+								"api_key_id", key.ID,
+								"remote_addr", ip,
+								"path", r.URL.Path,
+								"component", "auth",
+							)
+							writeAuthError(w, "api key not allowed from this address", "FORBIDDEN", http.StatusForbidden)
+							return
+						}
+
 						// Update last used (non-blocking).
 						go func() {
 							ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 							defer cancel()
-							keyStore.UpdateAPIKeyLastUsed(ctx, id)
+							keyStore.UpdateAPIKeyLastUsed(ctx, key.ID, ip)
 						}()
 
 						claims := &auth.Claims{
-							Username: "api-key",
-							Role:     role,
+							Username:       "api-key",
+							Role:           key.Role,
+							APIKeyID:       key.ID,
+							APIKeyScopes:   key.Scopes,
+							APIKeyNetworks: key.NetworkIDs,
 						}
-						claims.Subject = strconv.FormatInt(userID, 10)
+						claims.Subject = strconv.FormatInt(key.UserID, 10)
 
 						ctx := auth.WithUser(r.Context(), claims)
 						next.ServeHTTP(w, r.WithContext(ctx))
@@ -87,12 +120,106 @@ func RequireAuth(jwtSvc *auth.JWTService, sessions *auth.SessionManager, logger
 				return
 			}
 
+			if err := sessions.Verify(r, claims); err != nil {
+				logger.Warn("auth_session_revoked",
+					"remote_addr", r.RemoteAddr,
+					"path", r.URL.Path,
+					"user", claims.Username,
+					"error", err,
+					"component", "auth",
+				)
+				writeAuthError(w, "session expired or invalid", "SESSION_EXPIRED", http.StatusUnauthorized)
+				return
+			}
+
 			ctx := auth.WithUser(r.Context(), claims)
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
 }
 
+// PermissionStore resolves what an authenticated caller may do.
+type PermissionStore interface {
+	Grants(ctx context.Context, claims *auth.Claims) (*auth.Grants, error)
+}
+
+// RequirePermission returns middleware that checks the authenticated caller
+// holds perm everywhere, and stores the caller's permissions in the request
+// context. Must be chained after RequireAuth.
+func RequirePermission(store PermissionStore, logger *slog.Logger, perm string) func(http.Handler) http.Handler {
+	return requireGrant(store, logger, perm, func(r *http.Request, g *auth.Grants) bool {
+		return g.Has(perm)
+	})
+}
+
+// RequireNetworkPermission is like RequirePermission, but also accepts perm
+// granted by a network role. With a pathKey, the network is the one whose ID
+// is in that path value; without, perm on any network will do and the
+// handler must limit the response to the networks the caller may see.
+func RequireNetworkPermission(store PermissionStore, logger *slog.Logger, perm, pathKey string) func(http.Handler) http.Handler {
+	return requireGrant(store, logger, perm, func(r *http.Request, g *auth.Grants) bool {
+		return hasNetworkGrant(r, g, perm, pathKey)
+	})
+}
+
+// RequireNetworkOrOwnPermission is like RequireNetworkPermission, but also
+// accepts own, the permission on the caller's own devices. The handler must
+// limit callers without perm to the peers they own.
+func RequireNetworkOrOwnPermission(store PermissionStore, logger *slog.Logger, perm, own, pathKey string) func(http.Handler) http.Handler {
+	return requireGrant(store, logger, perm, func(r *http.Request, g *auth.Grants) bool {
+		return hasNetworkGrant(r, g, perm, pathKey) || hasNetworkGrant(r, g, own, pathKey)
+	})
+}
+
+func hasNetworkGrant(r *http.Request, g *auth.Grants, perm, pathKey string) bool {
+	if pathKey == "" {
+		return g.HasOnAnyNetwork(perm)
+	}
+	if g.Has(perm) {
+		return true
+	}
+	id, err := strconv.ParseInt(r.PathValue(pathKey), 10, 64)
+	return err == nil && g.HasOnNetwork(id, perm)
+}
+
+func requireGrant(store PermissionStore, logger *slog.Logger, perm string, allowed func(*http.Request, *auth.Grants) bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims := auth.UserFromContext(r.Context())
+			if claims == nil {
+				writeAuthError(w, "unauthorized", "UNAUTHORIZED", http.StatusUnauthorized)
+				return
+			}
+			grants := auth.GrantsFromContext(r.Context())
+			if grants == nil {
+				var err error
+				if grants, err = store.Grants(r.Context(), claims); err != nil {
+					logger.Error("auth_permissions_failed",
+						"user", claims.Username,
+						"error", err,
+						"component", "auth",
+					)
+					writeAuthError(w, "internal error", "INTERNAL_ERROR", http.StatusInternalServerError)
+					return
+				}
+			}
+			if !allowed(r, grants) {
+				logger.Warn("auth_permission_denied",
+					"user", claims.Username,
+					"role", claims.Role,
+					"permission", perm,
+					"path", r.URL.Path,
+					"component", "auth",
+				)
+				writeAuthError(w, "insufficient permissions", "FORBIDDEN", http.StatusForbidden)
+				return
+			}
+			ctx := auth.WithGrants(r.Context(), grants)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
 // RequireRole returns middleware that checks the authenticated user has one of
 // the allowed roles. Must be chained after RequireAuth.
 func RequireRole(roles ...string) func(http.Handler) http.Handler {
@@ -116,6 +243,25 @@ func RequireRole(roles ...string) func(http.Handler) http.Handler {
 	}
 }
 
+// addrAllowed reports whether ip is in one of cidrs. Every address is
+// allowed when cidrs is empty.
+func addrAllowed(ip string, cidrs []netip.Prefix) bool {
+	if len(cidrs) == 0 {
+		return true
+	}
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range cidrs {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
 func writeAuthError(w http.ResponseWriter, msg, code string, status int) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
@@ -1,10 +1,13 @@
 package middleware
 
 import (
+	"context"
 	"io"
 	"log/slog"
 	"net/http"
 	"net/http/httptest"
+	"net/netip"
+	"slices"
 	"testing"
 	"time"
 
@@ -141,3 +144,256 @@ func TestRequireAuth_InvalidToken(t *testing.T) {
 		t.Errorf("expected 401, got %d", w.Code)
 	}
 }
+
+type revokedSessionStore struct{}
+
+func (revokedSessionStore) ActiveSession(context.Context, string, int64, string, string) (bool, error) {
+	return false, nil
+}
+
+func TestRequireAuth_RevokedSession(t *testing.T) {
+	logger := testLogger()
+	jwtSvc, err := auth.NewJWTService(testSecret(), 24*time.Hour, logger)
+	if err != nil {
+		t.Fatalf("NewJWTService: %v", err)
+	}
+	sessions, err := auth.NewSessionManager(false, logger)
+	if err != nil {
+		t.Fatalf("NewSessionManager: %v", err)
+	}
+	sessions.UseStore(revokedSessionStore{})
+
+	token, err := jwtSvc.Generate(1, "admin", "admin")
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+
+	handler := RequireAuth(jwtSvc, sessions, logger)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("handler should not be called with a revoked session")
+	}))
+
+	req := httptest.NewRequest("GET", "/api/networks", nil)
+	req.AddCookie(&http.Cookie{Name: auth.CookieName, Value: token})
+	w := httptest.NewRecorder()
+
+	handler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401, got %d", w.Code)
+	}
+}
+
+type staticPermissionStore auth.Grants
+
+func (s staticPermissionStore) Grants(context.Context, *auth.Claims) (*auth.Grants, error) {
+	g := auth.Grants(s)
+	return &g, nil
+}
+
+func TestRequirePermission(t *testing.T) {
+	tests := []struct {
+		name  string
+		perms []string
+		want  int
+	}{
+		{"granted", []string{auth.PermNetworkWrite}, http.StatusOK},
+		{"wildcard", []string{"network:*"}, http.StatusOK},
+		{"read only", []string{auth.PermNetworkRead}, http.StatusForbidden},
+		{"none", nil, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotPerms []string
+			handler := RequirePermission(staticPermissionStore{Global: tt.perms}, testLogger(), auth.PermNetworkWrite)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotPerms = auth.PermissionsFromContext(r.Context())
+				w.WriteHeader(http.StatusOK)
+			}))
+
+			req := httptest.NewRequest("POST", "/api/networks", nil)
+			req = req.WithContext(auth.WithUser(req.Context(), &auth.Claims{Username: "alice", Role: "operator"}))
+			w := httptest.NewRecorder()
+
+			handler.ServeHTTP(w, req)
+
+			if w.Code != tt.want {
+				t.Errorf("expected %d, got %d", tt.want, w.Code)
+			}
+			if tt.want == http.StatusOK && len(gotPerms) != len(tt.perms) {
+				t.Errorf("expected permissions %v in context, got %v", tt.perms, gotPerms)
+			}
+		})
+	}
+}
+
+func TestRequireNetworkPermission(t *testing.T) {
+	store := staticPermissionStore{
+		Global:   []string{auth.PermSettingsRead},
+		Networks: map[int64][]string{3: {auth.PermNetworkRead, auth.PermNetworkWrite}, 5: {auth.PermNetworkRead}},
+	}
+	tests := []struct {
+		name    string
+		pathKey string
+		path    string
+		perm    string
+		want    int
+	}{
+		{"write on scoped network", "id", "/api/networks/3", auth.PermNetworkWrite, http.StatusOK},
+		{"read on scoped network", "id", "/api/networks/5", auth.PermNetworkRead, http.StatusOK},
+		{"write on read-only network", "id", "/api/networks/5", auth.PermNetworkWrite, http.StatusForbidden},
+		{"other network", "id", "/api/networks/7", auth.PermNetworkRead, http.StatusForbidden},
+		{"invalid id", "id", "/api/networks/x", auth.PermNetworkRead, http.StatusForbidden},
+		{"any network", "", "/api/networks", auth.PermNetworkWrite, http.StatusOK},
+		{"no network", "", "/api/networks", auth.PermPeerRead, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mux := http.NewServeMux()
+			handler := RequireNetworkPermission(store, testLogger(), tt.perm, tt.pathKey)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}))
+			mux.Handle("GET /api/networks/{id}", handler)
+			mux.Handle("GET /api/networks", handler)
+
+			req := httptest.NewRequest("GET", tt.path, nil)
+			req = req.WithContext(auth.WithUser(req.Context(), &auth.Claims{Username: "alice", Role: "member"}))
+			w := httptest.NewRecorder()
+
+			mux.ServeHTTP(w, req)
+
+			if w.Code != tt.want {
+				t.Errorf("expected %d, got %d", tt.want, w.Code)
+			}
+		})
+	}
+}
+
+func TestRequireNetworkOrOwnPermission(t *testing.T) {
+	store := staticPermissionStore{
+		Global:   []string{auth.PermDeviceRead},
+		Networks: map[int64][]string{3: {auth.PermPeerRead}},
+	}
+	tests := []struct {
+		name      string
+		path      string
+		perm, own string
+		want      int
+	}{
+		{"network permission", "/api/networks/3/peers", auth.PermPeerRead, auth.PermDeviceRead, http.StatusOK},
+		{"own devices", "/api/networks/5/peers", auth.PermPeerRead, auth.PermDeviceRead, http.StatusOK},
+		{"neither", "/api/networks/5/peers", auth.PermPeerWrite, auth.PermDeviceWrite, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mux := http.NewServeMux()
+			mux.Handle("GET /api/networks/{id}/peers", RequireNetworkOrOwnPermission(store, testLogger(), tt.perm, tt.own, "id")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})))
+
+			req := httptest.NewRequest("GET", tt.path, nil)
+			req = req.WithContext(auth.WithUser(req.Context(), &auth.Claims{Username: "alice", Role: "user"}))
+			w := httptest.NewRecorder()
+
+			mux.ServeHTTP(w, req)
+
+			if w.Code != tt.want {
+				t.Errorf("expected %d, got %d", tt.want, w.Code)
+			}
+		})
+	}
+}
+
+// fakeAPIKeyStore serves a single API key and records where it was last
+// used from.
+type fakeAPIKeyStore struct {
+	key    *APIKey
+	usedIP chan string
+}
+
+func (s *fakeAPIKeyStore) GetAPIKeyByHash(context.Context, string) (*APIKey, error) {
+	return s.key, nil
+}
+
+func (s *fakeAPIKeyStore) UpdateAPIKeyLastUsed(_ context.Context, _ int64, ip string) error {
+	s.usedIP <- ip
+	return nil
+}
+
+func TestRequireAuth_APIKeyRestrictions(t *testing.T) {
+	logger := testLogger()
+	jwtSvc, err := auth.NewJWTService(testSecret(), 24*time.Hour, logger)
+	if err != nil {
+		t.Fatalf("NewJWTService: %v", err)
+	}
+	sessions, err := auth.NewSessionManager(false, logger)
+	if err != nil {
+		t.Fatalf("NewSessionManager: %v", err)
+	}
+	store := &fakeAPIKeyStore{
+		key: &APIKey{
+			ID: 7, UserID: 1, Role: "admin",
+			Scopes:       []string{auth.PermPeerRead},
+			NetworkIDs:   []int64{2},
+			AllowedCIDRs: []netip.Prefix{netip.MustParsePrefix("10.1.0.0/16")},
+		},
+		usedIP: make(chan string, 1),
+	}
+
+	var gotClaims *auth.Claims
+	handler := RequireAuth(jwtSvc, sessions, logger, store)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotClaims = auth.UserFromContext(r.Context())
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		want       int
+	}{
+		{"allowed address", "10.1.2.3:4000", http.StatusOK},
+		{"other address", "192.0.2.1:4000", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotClaims = nil
+			req := httptest.NewRequest("GET", "/api/networks", nil)
+			req.Header.Set("Authorization", "Bearer wgp_test")
+			req.RemoteAddr = tt.remoteAddr
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+			if w.Code != tt.want {
+				t.Fatalf("expected %d, got %d", tt.want, w.Code)
+			}
+			if tt.want != http.StatusOK {
+				if gotClaims != nil {
+					t.Error("handler should not be called")
+				}
+				return
+			}
+			if gotClaims == nil || gotClaims.APIKeyID != 7 ||
+				!slices.Equal(gotClaims.APIKeyScopes, []string{auth.PermPeerRead}) ||
+				!slices.Equal(gotClaims.APIKeyNetworks, []int64{2}) {
+				t.Errorf("unexpected claims %+v", gotClaims)
+			}
+			select {
+			case ip := <-store.usedIP:
+				if ip != "10.1.2.3" {
+					t.Errorf("expected last used ip 10.1.2.3, got %q", ip)
+				}
+			case <-time.After(time.Second):
+				t.Error("last use was not recorded")
+			}
+		})
+	}
+
+	// Expired keys are rejected before the address check.
+	past := time.Now().Add(-time.Hour)
+	store.key.ExpiresAt = &past
+	req := httptest.NewRequest("GET", "/api/networks", nil)
+	req.Header.Set("Authorization", "Bearer wgp_test")
+	req.RemoteAddr = "10.1.2.3:4000"
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("expired key: expected 401, got %d", w.Code)
+	}
+}
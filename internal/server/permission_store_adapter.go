@@ -0,0 +1,93 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/itsChris/wgpilot/internal/auth"
+	"github.com/itsChris/wgpilot/internal/db"
+	servermw "github.com/itsChris/wgpilot/internal/server/middleware"
+)
+
+// Compile-time check that permissionStoreAdapter implements servermw.PermissionStore.
+var _ servermw.PermissionStore = (*permissionStoreAdapter)(nil)
+
+// permissionStoreAdapter adapts *db.DB to the middleware.PermissionStore
+// interface.
+type permissionStoreAdapter struct {
+	db *db.DB
+}
+
+// Grants resolves the caller's permissions from their current global and
+// network roles, so a role change applies to existing sessions. An API key's
+// global permissions are limited to both its own role and its creator's
+// role; on networks it keeps its creator's network roles. Both are further
+// limited to the key's scopes and networks.
+func (a *permissionStoreAdapter) Grants(ctx context.Context, claims *auth.Claims) (*auth.Grants, error) {
+	userID, err := strconv.ParseInt(claims.Subject, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("parse user id: %w", err)
+	}
+	user, err := a.db.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("get user: %w", err)
+	}
+	if user == nil {
+		return &auth.Grants{}, nil
+	}
+
+	grants := &auth.Grants{}
+	if grants.Global, err = rolePermissions(ctx, a.db, user.Role); err != nil {
+		return nil, err
+	}
+	networkRoles, err := a.db.ListNetworkRoles(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("list network roles: %w", err)
+	}
+	if len(networkRoles) > 0 {
+		grants.Networks = make(map[int64][]string, len(networkRoles))
+		for _, nr := range networkRoles {
+			perms, err := rolePermissions(ctx, a.db, nr.Role)
+			if err != nil {
+				return nil, err
+			}
+			grants.Networks[nr.NetworkID] = auth.ScopePermissions(perms)
+		}
+	}
+	if claims.APIKeyID == 0 {
+		return grants, nil
+	}
+
+	keyPerms, err := rolePermissions(ctx, a.db, claims.Role)
+	if err != nil {
+		return nil, err
+	}
+	grants.Global = auth.IntersectPermissions(keyPerms, grants.Global)
+	if len(claims.APIKeyScopes) > 0 {
+		grants.Global = auth.IntersectPermissions(grants.Global, claims.APIKeyScopes)
+		for id, perms := range grants.Networks {
+			grants.Networks[id] = auth.IntersectPermissions(perms, claims.APIKeyScopes)
+		}
+	}
+	if len(claims.APIKeyNetworks) > 0 {
+		grants = grants.LimitToNetworks(claims.APIKeyNetworks)
+	}
+	return grants, nil
+}
+
+// rolePermissions returns the permissions of a built-in or custom role, or
+// nil if there is no such role.
+func rolePermissions(ctx context.Context, d *db.DB, name string) ([]string, error) {
+	if perms, ok := auth.BuiltinRole(name); ok {
+		return perms, nil
+	}
+	role, err := d.GetRole(ctx, name)
+	if err != nil {
+		return nil, fmt.Errorf("get role: %w", err)
+	}
+	if role == nil {
+		return nil, nil
+	}
+	return role.Permissions, nil
+}
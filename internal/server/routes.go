@@ -5,6 +5,7 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/itsChris/wgpilot/internal/auth"
 	apperr "github.com/itsChris/wgpilot/internal/errors"
 	servermw "github.com/itsChris/wgpilot/internal/server/middleware"
 )
@@ -15,16 +16,30 @@ func (s *Server) registerRoutes() {
 	apiKeys := &apiKeyStoreAdapter{db: s.db}
 	protected := servermw.RequireAuth(s.jwtService, s.sessions, s.logger, apiKeys)
 
-	// guarded wraps a handler with both auth and setup guard: the request
-	// must be authenticated AND setup must be complete.
-	guarded := func(h http.Handler) http.Handler {
-		return protected(s.setupGuard(h))
+	// can wraps a handler with auth + setup guard + a permission check: the
+	// request must be authenticated, setup must be complete and the caller
+	// must hold perm.
+	perms := &permissionStoreAdapter{db: s.db}
+	can := func(perm string, h http.HandlerFunc) http.Handler {
+		return protected(s.setupGuard(servermw.RequirePermission(perms, s.logger, perm)(h)))
 	}
-
-	// adminOnly wraps a handler with auth + setup guard + admin role check.
-	adminGuard := servermw.RequireRole("admin")
-	adminOnly := func(h http.Handler) http.Handler {
-		return protected(s.setupGuard(adminGuard(h)))
+	// canOnNetwork also accepts perm granted by a role on the network in
+	// the {id} path value.
+	canOnNetwork := func(perm string, h http.HandlerFunc) http.Handler {
+		return protected(s.setupGuard(servermw.RequireNetworkPermission(perms, s.logger, perm, "id")(h)))
+	}
+	// canOnSomeNetwork accepts perm granted on any network; the handler
+	// shows only the networks the caller may see.
+	canOnSomeNetwork := func(perm string, h http.HandlerFunc) http.Handler {
+		return protected(s.setupGuard(servermw.RequireNetworkPermission(perms, s.logger, perm, "")(h)))
+	}
+	// canOnNetworkOrOwn also accepts own, the permission on the caller's own
+	// devices; the handler limits such callers to the peers they own.
+	canOnNetworkOrOwn := func(perm, own string, h http.HandlerFunc) http.Handler {
+		return protected(s.setupGuard(servermw.RequireNetworkOrOwnPermission(perms, s.logger, perm, own, "id")(h)))
+	}
+	canOnSomeNetworkOrOwn := func(perm, own string, h http.HandlerFunc) http.Handler {
+		return protected(s.setupGuard(servermw.RequireNetworkOrOwnPermission(perms, s.logger, perm, own, "")(h)))
 	}
 
 	// ── Public routes (no auth) ───────────────────────────────────────
@@ -32,13 +47,46 @@ func (s *Server) registerRoutes() {
 	// Health check.
 	s.mux.HandleFunc("GET /health", s.handleHealth)
 
-	// Prometheus metrics (unauthenticated).
-	s.mux.HandleFunc("GET /metrics", s.handleMetrics)
+	// Prometheus metrics (optionally gated by a bearer token; per-peer
+	// series need the token or a user). Users and API keys may scrape them
+	// too, limited to the networks they can see.
+	userMetrics := protected(servermw.RequireNetworkPermission(perms, s.logger, auth.PermNetworkRead, "")(http.HandlerFunc(s.handleMetrics)))
+	s.mux.HandleFunc("GET /metrics", func(w http.ResponseWriter, r *http.Request) {
+		if hasUserCredentials(r) {
+			userMetrics.ServeHTTP(w, r)
+			return
+		}
+		s.handleMetrics(w, r)
+	})
 
 	// Auth.
 	s.mux.HandleFunc("POST /api/auth/login", s.handleLogin)
 	s.mux.HandleFunc("POST /api/auth/setup", s.handleSetup)
 	s.mux.HandleFunc("POST /api/auth/logout", s.handleLogout)
+	s.mux.HandleFunc("GET /api/auth/providers", s.handleAuthProviders)
+
+	// Single sign-on (browser redirects to and from the identity provider).
+	s.mux.HandleFunc("GET /api/auth/oidc/login", s.handleOIDCLogin)
+	s.mux.HandleFunc("GET /api/auth/oidc/callback", s.handleOIDCCallback)
+
+	// Second login step (gated by the challenge token from login).
+	s.mux.HandleFunc("POST /api/auth/login/2fa", s.handleLogin2FA)
+	s.mux.HandleFunc("POST /api/auth/login/2fa/setup", s.handleLogin2FASetup)
+	s.mux.HandleFunc("POST /api/auth/login/2fa/enable", s.handleLogin2FAEnable)
+	s.mux.HandleFunc("POST /api/auth/webauthn/login/begin", s.handleWebAuthnLoginBegin)
+	s.mux.HandleFunc("POST /api/auth/webauthn/login/finish", s.handleWebAuthnLoginFinish)
+
+	// Password reset (the emailed token is the credential).
+	s.mux.HandleFunc("POST /api/auth/password-reset", s.handleRequestPasswordReset)
+	s.mux.HandleFunc("POST /api/auth/password-reset/confirm", s.handleConfirmPasswordReset)
+
+	// Peer invitations (the token in the path is the credential).
+	s.mux.HandleFunc("GET /api/invitations/{token}", s.handleGetInvitation)
+	s.mux.HandleFunc("POST /api/invitations/{token}/redeem", s.handleRedeemInvitation)
+
+	// Peer config share links (the token in the path is the credential).
+	s.mux.HandleFunc("GET /api/share/{token}/config", s.handleSharedConfig)
+	s.mux.HandleFunc("GET /api/share/{token}/qr", s.handleSharedQR)
 
 	// ── Setup routes (no auth — gated internally by OTP/step checks) ─
 	s.mux.HandleFunc("GET /api/setup/status", s.handleSetupStatus)
@@ -47,78 +95,130 @@ func (s *Server) registerRoutes() {
 	s.mux.Handle("POST /api/setup/step/3", protected(http.HandlerFunc(s.handleSetupStep3)))
 	s.mux.Handle("POST /api/setup/step/4", protected(http.HandlerFunc(s.handleSetupStep4)))
 	s.mux.HandleFunc("GET /api/setup/detect-ip", s.handleDetectPublicIP)
-	s.mux.Handle("POST /api/setup/import", protected(http.HandlerFunc(s.handleImportConfig)))
+	s.mux.Handle("POST /api/setup/import", protected(servermw.RequirePermission(perms, s.logger, auth.PermNetworkWrite)(http.HandlerFunc(s.handleImportConfig))))
 
-	// ── Protected + guarded routes (require auth + setup complete) ────
+	// ── Protected routes (require auth + setup complete + permission) ──
 
-	// Auth (protected only — no setup guard needed).
+	// Auth (the caller's own account — no setup guard or permission needed).
 	s.mux.Handle("GET /api/auth/me", protected(http.HandlerFunc(s.handleMe)))
 	s.mux.Handle("PUT /api/auth/password", protected(http.HandlerFunc(s.handleChangePassword)))
+	s.mux.Handle("GET /api/auth/sessions", protected(http.HandlerFunc(s.handleListSessions)))
+	s.mux.Handle("DELETE /api/auth/sessions", protected(http.HandlerFunc(s.handleRevokeAllSessions)))
+	s.mux.Handle("DELETE /api/auth/sessions/{id}", protected(http.HandlerFunc(s.handleRevokeSession)))
+	s.mux.Handle("GET /api/auth/2fa", protected(http.HandlerFunc(s.handleGet2FAStatus)))
+	s.mux.Handle("POST /api/auth/2fa/setup", protected(http.HandlerFunc(s.handle2FASetup)))
+	s.mux.Handle("POST /api/auth/2fa/enable", protected(http.HandlerFunc(s.handle2FAEnable)))
+	s.mux.Handle("POST /api/auth/2fa/disable", protected(http.HandlerFunc(s.handle2FADisable)))
+	s.mux.Handle("POST /api/auth/2fa/recovery-codes", protected(http.HandlerFunc(s.handleRegenerateRecoveryCodes)))
+	s.mux.Handle("POST /api/auth/webauthn/register/begin", protected(http.HandlerFunc(s.handleWebAuthnRegisterBegin)))
+	s.mux.Handle("POST /api/auth/webauthn/register/finish", protected(http.HandlerFunc(s.handleWebAuthnRegisterFinish)))
+	s.mux.Handle("GET /api/auth/webauthn/credentials", protected(http.HandlerFunc(s.handleListWebAuthnCredentials)))
+	s.mux.Handle("DELETE /api/auth/webauthn/credentials/{id}", protected(http.HandlerFunc(s.handleDeleteWebAuthnCredential)))
 
 	// Networks.
-	s.mux.Handle("GET /api/networks", guarded(http.HandlerFunc(s.handleListNetworks)))
-	s.mux.Handle("POST /api/networks", guarded(http.HandlerFunc(s.handleCreateNetwork)))
-	s.mux.Handle("GET /api/networks/{id}", guarded(http.HandlerFunc(s.handleGetNetwork)))
-	s.mux.Handle("PUT /api/networks/{id}", guarded(http.HandlerFunc(s.handleUpdateNetwork)))
-	s.mux.Handle("DELETE /api/networks/{id}", guarded(http.HandlerFunc(s.handleDeleteNetwork)))
-	s.mux.Handle("POST /api/networks/{id}/enable", guarded(http.HandlerFunc(s.handleEnableNetwork)))
-	s.mux.Handle("POST /api/networks/{id}/disable", guarded(http.HandlerFunc(s.handleDisableNetwork)))
-	s.mux.Handle("GET /api/networks/{id}/export", guarded(http.HandlerFunc(s.handleExportNetwork)))
-
-	// Peers.
-	s.mux.Handle("GET /api/networks/{id}/peers", guarded(http.HandlerFunc(s.handleListPeers)))
-	s.mux.Handle("POST /api/networks/{id}/peers", guarded(http.HandlerFunc(s.handleCreatePeer)))
-	s.mux.Handle("GET /api/networks/{id}/peers/{pid}", guarded(http.HandlerFunc(s.handleGetPeer)))
-	s.mux.Handle("PUT /api/networks/{id}/peers/{pid}", guarded(http.HandlerFunc(s.handleUpdatePeer)))
-	s.mux.Handle("DELETE /api/networks/{id}/peers/{pid}", guarded(http.HandlerFunc(s.handleDeletePeer)))
-	s.mux.Handle("POST /api/networks/{id}/peers/{pid}/enable", guarded(http.HandlerFunc(s.handleEnablePeer)))
-	s.mux.Handle("POST /api/networks/{id}/peers/{pid}/disable", guarded(http.HandlerFunc(s.handleDisablePeer)))
-	s.mux.Handle("GET /api/networks/{id}/peers/{pid}/config", guarded(http.HandlerFunc(s.handlePeerConfig)))
-	s.mux.Handle("GET /api/networks/{id}/peers/{pid}/qr", guarded(http.HandlerFunc(s.handlePeerQR)))
+	s.mux.Handle("GET /api/networks", canOnSomeNetworkOrOwn(auth.PermNetworkRead, auth.PermDeviceRead, s.handleListNetworks))
+	s.mux.Handle("POST /api/networks", can(auth.PermNetworkWrite, s.handleCreateNetwork))
+	s.mux.Handle("GET /api/networks/{id}", canOnNetwork(auth.PermNetworkRead, s.handleGetNetwork))
+	s.mux.Handle("PUT /api/networks/{id}", canOnNetwork(auth.PermNetworkWrite, s.handleUpdateNetwork))
+	s.mux.Handle("DELETE /api/networks/{id}", canOnNetwork(auth.PermNetworkWrite, s.handleDeleteNetwork))
+	s.mux.Handle("POST /api/networks/{id}/enable", canOnNetwork(auth.PermNetworkWrite, s.handleEnableNetwork))
+	s.mux.Handle("POST /api/networks/{id}/disable", canOnNetwork(auth.PermNetworkWrite, s.handleDisableNetwork))
+	s.mux.Handle("GET /api/networks/{id}/export", canOnNetwork(auth.PermNetworkWrite, s.handleExportNetwork))
+
+	// Peers. Users with the device permissions reach the same handlers for
+	// the peers they own.
+	s.mux.Handle("GET /api/networks/{id}/peers", canOnNetworkOrOwn(auth.PermPeerRead, auth.PermDeviceRead, s.handleListPeers))
+	s.mux.Handle("POST /api/networks/{id}/peers", canOnNetworkOrOwn(auth.PermPeerWrite, auth.PermDeviceWrite, s.handleCreatePeer))
+	s.mux.Handle("GET /api/networks/{id}/peers/{pid}", canOnNetworkOrOwn(auth.PermPeerRead, auth.PermDeviceRead, s.handleGetPeer))
+	s.mux.Handle("PUT /api/networks/{id}/peers/{pid}", canOnNetwork(auth.PermPeerWrite, s.handleUpdatePeer))
+	s.mux.Handle("DELETE /api/networks/{id}/peers/{pid}", canOnNetwork(auth.PermPeerWrite, s.handleDeletePeer))
+	s.mux.Handle("POST /api/networks/{id}/peers/{pid}/enable", canOnNetwork(auth.PermPeerWrite, s.handleEnablePeer))
+	s.mux.Handle("POST /api/networks/{id}/peers/{pid}/disable", canOnNetwork(auth.PermPeerWrite, s.handleDisablePeer))
+	s.mux.Handle("GET /api/networks/{id}/peers/{pid}/config", canOnNetworkOrOwn(auth.PermPeerWrite, auth.PermDeviceWrite, s.handlePeerConfig))
+	s.mux.Handle("GET /api/networks/{id}/peers/{pid}/qr", canOnNetworkOrOwn(auth.PermPeerWrite, auth.PermDeviceWrite, s.handlePeerQR))
+	s.mux.Handle("POST /api/networks/{id}/peers/{pid}/rotate-keys", canOnNetworkOrOwn(auth.PermPeerWrite, auth.PermDeviceWrite, s.handleRotatePeerKeys))
+	s.mux.Handle("POST /api/networks/{id}/peers/{pid}/send-config", canOnNetworkOrOwn(auth.PermPeerWrite, auth.PermDeviceWrite, s.handleSendPeerConfig))
+	s.mux.Handle("GET /api/networks/{id}/peers/{pid}/share-links", canOnNetworkOrOwn(auth.PermPeerWrite, auth.PermDeviceWrite, s.handleListShareLinks))
+	s.mux.Handle("POST /api/networks/{id}/peers/{pid}/share-links", canOnNetworkOrOwn(auth.PermPeerWrite, auth.PermDeviceWrite, s.handleCreateShareLink))
+	s.mux.Handle("DELETE /api/networks/{id}/peers/{pid}/share-links/{lid}", canOnNetworkOrOwn(auth.PermPeerWrite, auth.PermDeviceWrite, s.handleRevokeShareLink))
+	s.mux.Handle("GET /api/networks/{id}/peers/{pid}/quota", canOnNetworkOrOwn(auth.PermPeerRead, auth.PermDeviceRead, s.handlePeerQuota))
+	s.mux.Handle("GET /api/networks/{id}/peers/{pid}/sessions", canOnNetworkOrOwn(auth.PermPeerRead, auth.PermDeviceRead, s.handlePeerSessions))
+
+	// Peer invitations.
+	s.mux.Handle("GET /api/networks/{id}/invitations", canOnNetwork(auth.PermPeerRead, s.handleListInvitations))
+	s.mux.Handle("POST /api/networks/{id}/invitations", canOnNetwork(auth.PermPeerWrite, s.handleCreateInvitation))
+	s.mux.Handle("DELETE /api/networks/{id}/invitations/{iid}", canOnNetwork(auth.PermPeerWrite, s.handleRevokeInvitation))
 
 	// Network bridges.
-	s.mux.Handle("GET /api/bridges", guarded(http.HandlerFunc(s.handleListBridges)))
-	s.mux.Handle("POST /api/bridges", guarded(http.HandlerFunc(s.handleCreateBridge)))
-	s.mux.Handle("GET /api/bridges/{id}", guarded(http.HandlerFunc(s.handleGetBridge)))
-	s.mux.Handle("PUT /api/bridges/{id}", guarded(http.HandlerFunc(s.handleUpdateBridge)))
-	s.mux.Handle("DELETE /api/bridges/{id}", guarded(http.HandlerFunc(s.handleDeleteBridge)))
+	s.mux.Handle("GET /api/bridges", canOnSomeNetwork(auth.PermBridgeRead, s.handleListBridges))
+	s.mux.Handle("POST /api/bridges", canOnSomeNetwork(auth.PermBridgeWrite, s.handleCreateBridge))
+	s.mux.Handle("GET /api/bridges/{id}", canOnSomeNetwork(auth.PermBridgeRead, s.handleGetBridge))
+	s.mux.Handle("PUT /api/bridges/{id}", canOnSomeNetwork(auth.PermBridgeWrite, s.handleUpdateBridge))
+	s.mux.Handle("DELETE /api/bridges/{id}", canOnSomeNetwork(auth.PermBridgeWrite, s.handleDeleteBridge))
 
 	// Status & Monitoring.
-	s.mux.Handle("GET /api/status", guarded(http.HandlerFunc(s.handleStatus)))
-	s.mux.Handle("GET /api/networks/{id}/events", guarded(http.HandlerFunc(s.handleSSEEvents)))
-	s.mux.Handle("GET /api/networks/{id}/stats", guarded(http.HandlerFunc(s.handleNetworkStats)))
+	s.mux.Handle("GET /api/status", canOnSomeNetwork(auth.PermNetworkRead, s.handleStatus))
+	s.mux.Handle("GET /api/networks/{id}/events", canOnNetwork(auth.PermNetworkRead, s.handleSSEEvents))
+	s.mux.Handle("GET /api/events", canOnSomeNetwork(auth.PermNetworkRead, s.handleEvents))
+	s.mux.Handle("GET /api/networks/{id}/stats", canOnNetwork(auth.PermNetworkRead, s.handleNetworkStats))
+	s.mux.Handle("GET /api/networks/{id}/traffic", canOnNetwork(auth.PermNetworkRead, s.handleNetworkTraffic))
+
+	// Debug.
+	s.mux.Handle("GET /api/debug/info", can(auth.PermDebugRead, s.handleDebugInfo))
+	s.mux.Handle("GET /api/debug/logs", can(auth.PermDebugRead, s.handleDebugLogs))
 
-	// Debug (admin-only).
-	s.mux.Handle("GET /api/debug/info", adminOnly(http.HandlerFunc(s.handleDebugInfo)))
-	s.mux.Handle("GET /api/debug/logs", adminOnly(http.HandlerFunc(s.handleDebugLogs)))
+	// User management.
+	s.mux.Handle("GET /api/users", can(auth.PermUserRead, s.handleListUsers))
+	s.mux.Handle("POST /api/users", can(auth.PermUserWrite, s.handleCreateUser))
+	s.mux.Handle("PUT /api/users/{id}", can(auth.PermUserWrite, s.handleUpdateUser))
+	s.mux.Handle("DELETE /api/users/{id}", can(auth.PermUserWrite, s.handleDeleteUser))
+	s.mux.Handle("DELETE /api/users/{id}/2fa", can(auth.PermUserWrite, s.handleReset2FA))
+	s.mux.Handle("DELETE /api/users/{id}/sessions", can(auth.PermUserWrite, s.handleRevokeUserSessions))
+	s.mux.Handle("POST /api/users/{id}/unlock", can(auth.PermUserWrite, s.handleUnlockUser))
+	s.mux.Handle("GET /api/users/{id}/networks", can(auth.PermUserRead, s.handleListNetworkRoles))
+	s.mux.Handle("PUT /api/users/{id}/networks/{networkID}", can(auth.PermUserWrite, s.handleSetNetworkRole))
+	s.mux.Handle("DELETE /api/users/{id}/networks/{networkID}", can(auth.PermUserWrite, s.handleDeleteNetworkRole))
 
-	// User management (admin-only).
-	s.mux.Handle("GET /api/users", adminOnly(http.HandlerFunc(s.handleListUsers)))
-	s.mux.Handle("POST /api/users", adminOnly(http.HandlerFunc(s.handleCreateUser)))
-	s.mux.Handle("DELETE /api/users/{id}", adminOnly(http.HandlerFunc(s.handleDeleteUser)))
+	// Roles.
+	s.mux.Handle("GET /api/roles", can(auth.PermRoleRead, s.handleListRoles))
+	s.mux.Handle("POST /api/roles", can(auth.PermRoleWrite, s.handleCreateRole))
+	s.mux.Handle("PUT /api/roles/{name}", can(auth.PermRoleWrite, s.handleUpdateRole))
+	s.mux.Handle("DELETE /api/roles/{name}", can(auth.PermRoleWrite, s.handleDeleteRole))
+	s.mux.Handle("GET /api/permissions", can(auth.PermRoleRead, s.handleListPermissions))
 
 	// Settings.
-	s.mux.Handle("GET /api/settings", guarded(http.HandlerFunc(s.handleGetSettings)))
-	s.mux.Handle("PUT /api/settings", guarded(http.HandlerFunc(s.handleUpdateSettings)))
-	s.mux.Handle("GET /api/settings/tls", guarded(http.HandlerFunc(s.notImplemented)))
-	s.mux.Handle("POST /api/settings/tls/test", guarded(http.HandlerFunc(s.notImplemented)))
+	s.mux.Handle("GET /api/settings", can(auth.PermSettingsRead, s.handleGetSettings))
+	s.mux.Handle("PUT /api/settings", can(auth.PermSettingsWrite, s.handleUpdateSettings))
+	s.mux.Handle("GET /api/settings/2fa", can(auth.PermSettingsRead, s.handleGet2FAPolicy))
+	s.mux.Handle("PUT /api/settings/2fa", can(auth.PermSettingsWrite, s.handleUpdate2FAPolicy))
+	s.mux.Handle("GET /api/settings/tls", can(auth.PermSettingsRead, s.notImplemented))
+	s.mux.Handle("POST /api/settings/tls/test", can(auth.PermSettingsWrite, s.notImplemented))
 
 	// Alerts.
-	s.mux.Handle("GET /api/alerts", guarded(http.HandlerFunc(s.handleListAlerts)))
-	s.mux.Handle("POST /api/alerts", guarded(http.HandlerFunc(s.handleCreateAlert)))
-	s.mux.Handle("PUT /api/alerts/{id}", guarded(http.HandlerFunc(s.handleUpdateAlert)))
-	s.mux.Handle("DELETE /api/alerts/{id}", guarded(http.HandlerFunc(s.handleDeleteAlert)))
+	s.mux.Handle("GET /api/alerts", can(auth.PermAlertRead, s.handleListAlerts))
+	s.mux.Handle("POST /api/alerts", can(auth.PermAlertWrite, s.handleCreateAlert))
+	s.mux.Handle("PUT /api/alerts/{id}", can(auth.PermAlertWrite, s.handleUpdateAlert))
+	s.mux.Handle("DELETE /api/alerts/{id}", can(auth.PermAlertWrite, s.handleDeleteAlert))
+
+	// Webhooks.
+	s.mux.Handle("GET /api/webhooks", can(auth.PermWebhookRead, s.handleListWebhooks))
+	s.mux.Handle("POST /api/webhooks", can(auth.PermWebhookWrite, s.handleCreateWebhook))
+	s.mux.Handle("PUT /api/webhooks/{id}", can(auth.PermWebhookWrite, s.handleUpdateWebhook))
+	s.mux.Handle("DELETE /api/webhooks/{id}", can(auth.PermWebhookWrite, s.handleDeleteWebhook))
+	s.mux.Handle("GET /api/webhooks/{id}/deliveries", can(auth.PermWebhookRead, s.handleListWebhookDeliveries))
+	s.mux.Handle("POST /api/webhooks/{id}/deliveries/{deliveryID}/redeliver", can(auth.PermWebhookWrite, s.handleRedeliverWebhookDelivery))
 
 	// API Keys.
-	s.mux.Handle("GET /api/api-keys", guarded(http.HandlerFunc(s.handleListAPIKeys)))
-	s.mux.Handle("POST /api/api-keys", guarded(http.HandlerFunc(s.handleCreateAPIKey)))
-	s.mux.Handle("DELETE /api/api-keys/{id}", guarded(http.HandlerFunc(s.handleDeleteAPIKey)))
+	s.mux.Handle("GET /api/api-keys", can(auth.PermAPIKeyRead, s.handleListAPIKeys))
+	s.mux.Handle("POST /api/api-keys", can(auth.PermAPIKeyWrite, s.handleCreateAPIKey))
+	s.mux.Handle("DELETE /api/api-keys/{id}", can(auth.PermAPIKeyWrite, s.handleDeleteAPIKey))
+	s.mux.Handle("POST /api/api-keys/{id}/rotate", can(auth.PermAPIKeyWrite, s.handleRotateAPIKey))
 
 	// System.
-	s.mux.Handle("GET /api/system/info", guarded(http.HandlerFunc(s.handleSystemInfo)))
-	s.mux.Handle("POST /api/system/backup", guarded(http.HandlerFunc(s.notImplemented)))
-	s.mux.Handle("POST /api/system/restore", guarded(http.HandlerFunc(s.notImplemented)))
-	s.mux.Handle("GET /api/audit-log", guarded(http.HandlerFunc(s.handleAuditLog)))
+	s.mux.Handle("GET /api/system/info", can(auth.PermSystemRead, s.handleSystemInfo))
+	s.mux.Handle("POST /api/system/backup", can(auth.PermSystemWrite, s.notImplemented))
+	s.mux.Handle("POST /api/system/restore", can(auth.PermSystemWrite, s.notImplemented))
+	s.mux.Handle("GET /api/audit-log", canOnSomeNetwork(auth.PermAuditRead, s.handleAuditLog))
 }
 
 // handleHealth is the unauthenticated health check endpoint.
@@ -37,9 +37,25 @@ type alertResponse struct {
 // ── Validation ───────────────────────────────────────────────────────
 
 var validAlertTypes = map[string]bool{
-	"peer_offline":    true,
-	"high_latency":    true,
-	"bandwidth_limit": true,
+	"peer_offline":               true,
+	"high_latency":               true,
+	"bandwidth_limit":            true,
+	db.AlertTypeEndpointFlapping: true,
+	db.AlertTypeEndpointCIDR:     true,
+}
+
+// validateAlertThreshold checks the threshold format for alert types that
+// wgpilot evaluates itself.
+func validateAlertThreshold(alertType, threshold string) error {
+	switch alertType {
+	case db.AlertTypeEndpointFlapping:
+		_, _, err := db.ParseFlappingThreshold(threshold)
+		return err
+	case db.AlertTypeEndpointCIDR:
+		_, err := db.ParseCIDRThreshold(threshold)
+		return err
+	}
+	return nil
 }
 
 var validNotifyMethods = map[string]bool{
@@ -88,6 +104,10 @@ func (s *Server) handleCreateAlert(w http.ResponseWriter, r *http.Request) {
 		writeError(w, r, fmt.Errorf("threshold is required"), apperr.ErrValidation, http.StatusBadRequest, s.devMode)
 		return
 	}
+	if err := validateAlertThreshold(req.Type, req.Threshold); err != nil {
+		writeError(w, r, err, apperr.ErrValidation, http.StatusBadRequest, s.devMode)
+		return
+	}
 
 	notify := "email"
 	if req.Notify != "" {
@@ -167,6 +187,10 @@ func (s *Server) handleUpdateAlert(w http.ResponseWriter, r *http.Request) {
 	if req.Threshold != nil {
 		alert.Threshold = *req.Threshold
 	}
+	if err := validateAlertThreshold(alert.Type, alert.Threshold); err != nil {
+		writeError(w, r, err, apperr.ErrValidation, http.StatusBadRequest, s.devMode)
+		return
+	}
 	if req.Notify != nil {
 		if !validNotifyMethods[*req.Notify] {
 			writeError(w, r, fmt.Errorf("invalid notify method %q", *req.Notify), apperr.ErrValidation, http.StatusBadRequest, s.devMode)
@@ -3,6 +3,7 @@ package server
 import (
 	"fmt"
 	"net/http"
+	"net/netip"
 	"strconv"
 	"time"
 
@@ -11,29 +12,49 @@ import (
 	apperr "github.com/itsChris/wgpilot/internal/errors"
 )
 
+// defaultRotationOverlap is how long a rotated key keeps working unless
+// the request says otherwise.
+const defaultRotationOverlap = 24 * time.Hour
+
 type createAPIKeyRequest struct {
-	Name      string `json:"name"`
-	Role      string `json:"role"`
-	ExpiresIn string `json:"expires_in"` // e.g. "720h" for 30 days, empty for never
+	Name         string   `json:"name"`
+	Role         string   `json:"role"`
+	ExpiresIn    string   `json:"expires_in"`    // e.g. "720h" for 30 days, empty for never
+	Scopes       []string `json:"scopes"`        // permissions the key is limited to, empty for all of its role's
+	NetworkIDs   []int64  `json:"network_ids"`   // networks the key is limited to, empty for all
+	AllowedCIDRs []string `json:"allowed_cidrs"` // source addresses the key may be used from, empty for any
+}
+
+type rotateAPIKeyRequest struct {
+	Overlap   string `json:"overlap"`    // how long the old key keeps working, default 24h
+	ExpiresIn string `json:"expires_in"` // empty to keep the old key's lifetime
 }
 
 type createAPIKeyResponse struct {
-	ID        int64   `json:"id"`
-	Key       string  `json:"key"` // only returned on creation
-	Name      string  `json:"name"`
-	KeyPrefix string  `json:"key_prefix"`
-	Role      string  `json:"role"`
-	ExpiresAt *string `json:"expires_at"`
+	ID           int64    `json:"id"`
+	Key          string   `json:"key"` // only returned on creation
+	Name         string   `json:"name"`
+	KeyPrefix    string   `json:"key_prefix"`
+	Role         string   `json:"role"`
+	ExpiresAt    *string  `json:"expires_at"`
+	Scopes       []string `json:"scopes"`
+	NetworkIDs   []int64  `json:"network_ids"`
+	AllowedCIDRs []string `json:"allowed_cidrs"`
 }
 
 type apiKeyResponse struct {
-	ID        int64   `json:"id"`
-	Name      string  `json:"name"`
-	KeyPrefix string  `json:"key_prefix"`
-	Role      string  `json:"role"`
-	ExpiresAt *string `json:"expires_at"`
-	CreatedAt string  `json:"created_at"`
-	LastUsed  *string `json:"last_used"`
+	ID           int64    `json:"id"`
+	Name         string   `json:"name"`
+	KeyPrefix    string   `json:"key_prefix"`
+	Role         string   `json:"role"`
+	ExpiresAt    *string  `json:"expires_at"`
+	CreatedAt    string   `json:"created_at"`
+	LastUsed     *string  `json:"last_used"`
+	LastUsedIP   string   `json:"last_used_ip"`
+	Scopes       []string `json:"scopes"`
+	NetworkIDs   []int64  `json:"network_ids"`
+	AllowedCIDRs []string `json:"allowed_cidrs"`
+	ReplacedBy   *int64   `json:"replaced_by"`
 }
 
 func (s *Server) handleListAPIKeys(w http.ResponseWriter, r *http.Request) {
@@ -49,9 +70,9 @@ func (s *Server) handleListAPIKeys(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Admins see all keys, viewers see only their own.
+	// User managers see all keys, everyone else only their own.
 	var keys []db.APIKey
-	if claims.Role == "admin" {
+	if auth.HasPermission(auth.PermissionsFromContext(r.Context()), auth.PermUserWrite) {
 		keys, err = s.db.ListAllAPIKeys(r.Context())
 	} else {
 		keys, err = s.db.ListAPIKeys(r.Context(), userID)
@@ -63,22 +84,7 @@ func (s *Server) handleListAPIKeys(w http.ResponseWriter, r *http.Request) {
 
 	resp := make([]apiKeyResponse, 0, len(keys))
 	for _, k := range keys {
-		item := apiKeyResponse{
-			ID:        k.ID,
-			Name:      k.Name,
-			KeyPrefix: k.KeyPrefix,
-			Role:      k.Role,
-			CreatedAt: k.CreatedAt.Format(time.RFC3339),
-		}
-		if k.ExpiresAt != nil {
-			s := k.ExpiresAt.Format(time.RFC3339)
-			item.ExpiresAt = &s
-		}
-		if k.LastUsed != nil {
-			s := k.LastUsed.Format(time.RFC3339)
-			item.LastUsed = &s
-		}
-		resp = append(resp, item)
+		resp = append(resp, apiKeyToResponse(&k))
 	}
 
 	writeJSON(w, http.StatusOK, resp)
@@ -108,17 +114,25 @@ func (s *Server) handleCreateAPIKey(w http.ResponseWriter, r *http.Request) {
 	if req.Name == "" {
 		fields = append(fields, fieldError{Field: "name", Message: "name is required"})
 	}
-	if req.Role == "" {
-		req.Role = "admin"
-	}
-	if req.Role != "admin" && req.Role != "viewer" {
-		fields = append(fields, fieldError{Field: "role", Message: "role must be 'admin' or 'viewer'"})
-	}
+	fields = append(fields, s.validateAPIKeyRestrictions(r, &req)...)
 	if len(fields) > 0 {
 		writeValidationError(w, r, fields)
 		return
 	}
 
+	// A key defaults to its creator's role and can never be given more.
+	if req.Role == "" {
+		user, err := s.db.GetUserByID(r.Context(), userID)
+		if err != nil || user == nil {
+			writeError(w, r, fmt.Errorf("get user: %w", err), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
+			return
+		}
+		req.Role = user.Role
+	}
+	if !s.canGrantRole(w, r, "role", req.Role) {
+		return
+	}
+
 	// Parse expiry.
 	var expiresAt *time.Time
 	if req.ExpiresIn != "" {
@@ -139,12 +153,15 @@ func (s *Server) handleCreateAPIKey(w http.ResponseWriter, r *http.Request) {
 	}
 
 	apiKey := &db.APIKey{
-		Name:      req.Name,
-		KeyHash:   hash,
-		KeyPrefix: prefix,
-		UserID:    userID,
-		Role:      req.Role,
-		ExpiresAt: expiresAt,
+		Name:         req.Name,
+		KeyHash:      hash,
+		KeyPrefix:    prefix,
+		UserID:       userID,
+		Role:         req.Role,
+		ExpiresAt:    expiresAt,
+		Scopes:       req.Scopes,
+		NetworkIDs:   req.NetworkIDs,
+		AllowedCIDRs: req.AllowedCIDRs,
 	}
 
 	id, err := s.db.CreateAPIKey(r.Context(), apiKey)
@@ -154,29 +171,114 @@ func (s *Server) handleCreateAPIKey(w http.ResponseWriter, r *http.Request) {
 	}
 
 	s.auditf(r, "api_key.created", "api_key", "created API key %q (id=%d)", req.Name, id)
+	if created, _ := s.db.GetAPIKeyByID(r.Context(), id); created != nil {
+		s.resourceChanged(r, "api_key.created", "api_key", id, nil, apiKeyToResponse(created))
+	}
 
-	resp := createAPIKeyResponse{
-		ID:        id,
-		Key:       key,
-		Name:      req.Name,
-		KeyPrefix: prefix,
-		Role:      req.Role,
-	}
-	if expiresAt != nil {
-		s := expiresAt.Format(time.RFC3339)
-		resp.ExpiresAt = &s
+	apiKey.ID = id
+	writeJSON(w, http.StatusCreated, createdAPIKeyToResponse(apiKey, key))
+}
+
+// handleRotateAPIKey issues a successor to an API key with the same name,
+// role and restrictions. The old key keeps working for an overlap window
+// so that its users can switch without downtime.
+func (s *Server) handleRotateAPIKey(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	old, ok := s.apiKeyFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	var req rotateAPIKeyRequest
+	if r.ContentLength != 0 {
+		if code, status, err := decodeJSON(r, &req); err != nil {
+			writeError(w, r, err, code, status, s.devMode)
+			return
+		}
+	}
+
+	now := time.Now()
+	if old.ReplacedBy != 0 {
+		writeError(w, r, fmt.Errorf("api key %d was already rotated", old.ID), apperr.ErrValidation, http.StatusConflict, s.devMode)
+		return
+	}
+	if old.ExpiresAt != nil && old.ExpiresAt.Before(now) {
+		writeError(w, r, fmt.Errorf("api key %d has expired", old.ID), apperr.ErrValidation, http.StatusBadRequest, s.devMode)
+		return
+	}
+
+	overlap := defaultRotationOverlap
+	if req.Overlap != "" {
+		d, err := time.ParseDuration(req.Overlap)
+		if err != nil || d < 0 {
+			writeValidationError(w, r, []fieldError{{Field: "overlap", Message: "invalid duration format (e.g. '24h')"}})
+			return
+		}
+		overlap = d
+	}
+	oldExpiresAt := now.Add(overlap)
+	if old.ExpiresAt != nil && old.ExpiresAt.Before(oldExpiresAt) {
+		oldExpiresAt = *old.ExpiresAt
+	}
+
+	var expiresAt *time.Time
+	if req.ExpiresIn != "" {
+		d, err := time.ParseDuration(req.ExpiresIn)
+		if err != nil {
+			writeValidationError(w, r, []fieldError{{Field: "expires_in", Message: "invalid duration format (e.g. '720h')"}})
+			return
+		}
+		t := now.Add(d)
+		expiresAt = &t
+	} else if old.ExpiresAt != nil {
+		t := now.Add(old.ExpiresAt.Sub(old.CreatedAt))
+		expiresAt = &t
+	}
+
+	key, hash, prefix, err := auth.GenerateAPIKey()
+	if err != nil {
+		writeError(w, r, fmt.Errorf("generate api key: %w", err), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
+		return
+	}
+	successor := &db.APIKey{
+		Name:         old.Name,
+		KeyHash:      hash,
+		KeyPrefix:    prefix,
+		UserID:       old.UserID,
+		Role:         old.Role,
+		ExpiresAt:    expiresAt,
+		Scopes:       old.Scopes,
+		NetworkIDs:   old.NetworkIDs,
+		AllowedCIDRs: old.AllowedCIDRs,
+	}
+
+	id, err := s.db.RotateAPIKey(ctx, old.ID, successor, oldExpiresAt)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("rotate api key: %w", err), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
+		return
 	}
 
-	writeJSON(w, http.StatusCreated, resp)
+	s.auditf(r, "api_key.rotated", "api_key", "rotated API key %q (id=%d) to id=%d; old key expires %s",
+		old.Name, old.ID, id, oldExpiresAt.Format(time.RFC3339))
+	if created, _ := s.db.GetAPIKeyByID(ctx, id); created != nil {
+		s.resourceChanged(r, "api_key.created", "api_key", id, nil, apiKeyToResponse(created))
+	}
+	// The old key now expires at the end of the overlap.
+	if rotated, _ := s.db.GetAPIKeyByID(ctx, old.ID); rotated != nil {
+		s.resourceChanged(r, "api_key.updated", "api_key", old.ID, apiKeyToResponse(old), apiKeyToResponse(rotated))
+	}
+
+	successor.ID = id
+	writeJSON(w, http.StatusCreated, createdAPIKeyToResponse(successor, key))
 }
 
 func (s *Server) handleDeleteAPIKey(w http.ResponseWriter, r *http.Request) {
-	idStr := r.PathValue("id")
-	id, err := strconv.ParseInt(idStr, 10, 64)
-	if err != nil {
-		writeError(w, r, fmt.Errorf("invalid api key id"), apperr.ErrValidation, http.StatusBadRequest, s.devMode)
+	key, ok := s.apiKeyFromPath(w, r)
+	if !ok {
 		return
 	}
+	id := key.ID
 
 	if err := s.db.DeleteAPIKey(r.Context(), id); err != nil {
 		writeError(w, r, fmt.Errorf("delete api key: %w", err), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
@@ -184,6 +286,119 @@ func (s *Server) handleDeleteAPIKey(w http.ResponseWriter, r *http.Request) {
 	}
 
 	s.auditf(r, "api_key.deleted", "api_key", "deleted API key id=%d", id)
+	s.resourceChanged(r, "api_key.deleted", "api_key", id, apiKeyToResponse(key), nil)
 
 	writeJSON(w, http.StatusOK, map[string]string{"status": "deleted"})
 }
+
+// apiKeyFromPath loads the API key whose ID is in the path. Only user
+// managers may act on other users' keys; to anyone else they do not exist.
+func (s *Server) apiKeyFromPath(w http.ResponseWriter, r *http.Request) (*db.APIKey, bool) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("invalid api key id"), apperr.ErrValidation, http.StatusBadRequest, s.devMode)
+		return nil, false
+	}
+
+	key, err := s.db.GetAPIKeyByID(r.Context(), id)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("get api key: %w", err), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
+		return nil, false
+	}
+
+	claims := auth.UserFromContext(r.Context())
+	if key != nil && claims != nil && claims.Subject != strconv.FormatInt(key.UserID, 10) &&
+		!auth.HasPermission(auth.PermissionsFromContext(r.Context()), auth.PermUserWrite) {
+		key = nil
+	}
+	if key == nil {
+		writeError(w, r, fmt.Errorf("api key %d not found", id), apperr.ErrValidation, http.StatusNotFound, s.devMode)
+		return nil, false
+	}
+	return key, true
+}
+
+// validateAPIKeyRestrictions checks the scopes, networks and source
+// addresses of a new key, and normalizes the addresses to CIDRs.
+func (s *Server) validateAPIKeyRestrictions(r *http.Request, req *createAPIKeyRequest) []fieldError {
+	var fields []fieldError
+	for _, p := range req.Scopes {
+		if !auth.ValidPermission(p) {
+			fields = append(fields, fieldError{Field: "scopes", Message: fmt.Sprintf("unknown permission %q", p)})
+			break
+		}
+	}
+	for _, id := range req.NetworkIDs {
+		network, err := s.db.GetNetworkByID(r.Context(), id)
+		if err != nil || network == nil {
+			fields = append(fields, fieldError{Field: "network_ids", Message: fmt.Sprintf("network %d not found", id)})
+			break
+		}
+	}
+	for i, cidr := range req.AllowedCIDRs {
+		prefix, err := parseSourcePrefix(cidr)
+		if err != nil {
+			fields = append(fields, fieldError{Field: "allowed_cidrs", Message: fmt.Sprintf("invalid CIDR %q", cidr)})
+			break
+		}
+		req.AllowedCIDRs[i] = prefix.String()
+	}
+	return fields
+}
+
+// parseSourcePrefix parses a CIDR or a single address, which stands for
+// itself alone.
+func parseSourcePrefix(s string) (netip.Prefix, error) {
+	if prefix, err := netip.ParsePrefix(s); err == nil {
+		return prefix.Masked(), nil
+	}
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+func createdAPIKeyToResponse(k *db.APIKey, key string) createAPIKeyResponse {
+	resp := createAPIKeyResponse{
+		ID:           k.ID,
+		Key:          key,
+		Name:         k.Name,
+		KeyPrefix:    k.KeyPrefix,
+		Role:         k.Role,
+		Scopes:       k.Scopes,
+		NetworkIDs:   k.NetworkIDs,
+		AllowedCIDRs: k.AllowedCIDRs,
+	}
+	if k.ExpiresAt != nil {
+		s := k.ExpiresAt.Format(time.RFC3339)
+		resp.ExpiresAt = &s
+	}
+	return resp
+}
+
+func apiKeyToResponse(k *db.APIKey) apiKeyResponse {
+	resp := apiKeyResponse{
+		ID:           k.ID,
+		Name:         k.Name,
+		KeyPrefix:    k.KeyPrefix,
+		Role:         k.Role,
+		CreatedAt:    k.CreatedAt.Format(time.RFC3339),
+		LastUsedIP:   k.LastUsedIP,
+		Scopes:       k.Scopes,
+		NetworkIDs:   k.NetworkIDs,
+		AllowedCIDRs: k.AllowedCIDRs,
+	}
+	if k.ReplacedBy != 0 {
+		resp.ReplacedBy = &k.ReplacedBy
+	}
+	if k.ExpiresAt != nil {
+		s := k.ExpiresAt.Format(time.RFC3339)
+		resp.ExpiresAt = &s
+	}
+	if k.LastUsed != nil {
+		s := k.LastUsed.Format(time.RFC3339)
+		resp.LastUsed = &s
+	}
+	return resp
+}
@@ -0,0 +1,155 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/itsChris/wgpilot/internal/db"
+)
+
+func sendWithAPIKey(t *testing.T, srv *Server, method, path, key, remoteAddr string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, path, nil)
+	req.Header.Set("Authorization", "Bearer "+key)
+	if remoteAddr != "" {
+		req.RemoteAddr = remoteAddr
+	}
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+	return w
+}
+
+func TestAPIKey_Restrictions(t *testing.T) {
+	srv := newTestServerFor2FA(t)
+	admin := loginSession(t, srv, "admin", "correctpassword")
+	ctx := context.Background()
+
+	var ids []int64
+	for i, name := range []string{"alpha", "beta"} {
+		id, err := srv.db.CreateNetwork(ctx, &db.Network{
+			Name: name, Interface: fmt.Sprintf("wg%d", i), Mode: "gateway",
+			Subnet: fmt.Sprintf("10.%d.0.0/24", i), ListenPort: 51820 + i,
+			PrivateKey: "priv", PublicKey: "pub", Enabled: true,
+		})
+		if err != nil {
+			t.Fatalf("create network: %v", err)
+		}
+		ids = append(ids, id)
+	}
+
+	validation := []struct {
+		name, body string
+	}{
+		{"unknown scope", `{"name":"x","scopes":["peer:fly"]}`},
+		{"unknown network", `{"name":"x","network_ids":[999]}`},
+		{"bad cidr", `{"name":"x","allowed_cidrs":["10.0.0.0/33"]}`},
+	}
+	for _, tt := range validation {
+		if w := sendJSON(t, srv, "POST", "/api/api-keys", tt.body, admin); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d: %s", tt.name, w.Code, w.Body.String())
+		}
+	}
+
+	// httptest requests come from 192.0.2.1; a bare address stands for itself.
+	body := fmt.Sprintf(`{"name":"ci","scopes":["network:read"],"network_ids":[%d],"allowed_cidrs":["192.0.2.1"]}`, ids[0])
+	w := sendJSON(t, srv, "POST", "/api/api-keys", body, admin)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create: expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var key createAPIKeyResponse
+	json.NewDecoder(w.Body).Decode(&key)
+	if len(key.AllowedCIDRs) != 1 || key.AllowedCIDRs[0] != "192.0.2.1/32" {
+		t.Errorf("expected the address to be stored as a /32, got %v", key.AllowedCIDRs)
+	}
+
+	w = sendWithAPIKey(t, srv, "GET", "/api/networks", key.Key, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("list networks: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var networks []struct {
+		ID int64 `json:"id"`
+	}
+	json.NewDecoder(w.Body).Decode(&networks)
+	if len(networks) != 1 || networks[0].ID != ids[0] {
+		t.Errorf("expected only network %d, got %+v", ids[0], networks)
+	}
+
+	tests := []struct {
+		name, path, remoteAddr string
+		want                   int
+	}{
+		{"other network", fmt.Sprintf("/api/networks/%d", ids[1]), "", http.StatusForbidden},
+		{"out of scope", "/api/users", "", http.StatusForbidden},
+		{"other address", "/api/networks", "198.51.100.7:1234", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		if w := sendWithAPIKey(t, srv, "GET", tt.path, key.Key, tt.remoteAddr); w.Code != tt.want {
+			t.Errorf("%s: expected %d, got %d", tt.name, tt.want, w.Code)
+		}
+	}
+
+	// The last use is recorded in the background.
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		k, _ := srv.db.GetAPIKeyByID(ctx, key.ID)
+		if k != nil && k.LastUsedIP == "192.0.2.1" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected last_used_ip 192.0.2.1, got %+v", k)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestAPIKey_Rotate(t *testing.T) {
+	srv := newTestServerFor2FA(t)
+	admin := loginSession(t, srv, "admin", "correctpassword")
+	viewer := loginWithRole(t, srv, "val", "viewer")
+
+	w := sendJSON(t, srv, "POST", "/api/api-keys", `{"name":"deploy","expires_in":"720h","allowed_cidrs":["192.0.2.0/24"]}`, admin)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create: expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var old createAPIKeyResponse
+	json.NewDecoder(w.Body).Decode(&old)
+	rotatePath := "/api/api-keys/" + strconv.FormatInt(old.ID, 10) + "/rotate"
+
+	if w := sendJSON(t, srv, "POST", rotatePath, `{}`, viewer); w.Code != http.StatusNotFound {
+		t.Errorf("viewer rotating another user's key: expected 404, got %d", w.Code)
+	}
+	if w := sendJSON(t, srv, "POST", rotatePath, `{"overlap":"soon"}`, admin); w.Code != http.StatusBadRequest {
+		t.Errorf("bad overlap: expected 400, got %d", w.Code)
+	}
+
+	w = sendJSON(t, srv, "POST", rotatePath, `{"overlap":"1h"}`, admin)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("rotate: expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var next createAPIKeyResponse
+	json.NewDecoder(w.Body).Decode(&next)
+	if next.Key == "" || next.Key == old.Key || next.Name != "deploy" || len(next.AllowedCIDRs) != 1 || next.ExpiresAt == nil {
+		t.Errorf("unexpected successor %+v", next)
+	}
+
+	// Both keys work during the overlap.
+	for _, key := range []string{old.Key, next.Key} {
+		if w := sendWithAPIKey(t, srv, "GET", "/api/networks", key, ""); w.Code != http.StatusOK {
+			t.Errorf("key during overlap: expected 200, got %d", w.Code)
+		}
+	}
+
+	retired, _ := srv.db.GetAPIKeyByID(context.Background(), old.ID)
+	if retired.ReplacedBy != next.ID || retired.ExpiresAt == nil || retired.ExpiresAt.After(time.Now().Add(time.Hour+time.Minute)) {
+		t.Errorf("old key not retired after the overlap: %+v", retired)
+	}
+	if w := sendJSON(t, srv, "POST", rotatePath, `{}`, admin); w.Code != http.StatusConflict {
+		t.Errorf("rotating twice: expected 409, got %d", w.Code)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"net/http"
 	"strconv"
 
+	"github.com/itsChris/wgpilot/internal/auth"
 	"github.com/itsChris/wgpilot/internal/db"
 	apperr "github.com/itsChris/wgpilot/internal/errors"
 )
@@ -24,9 +25,14 @@ type auditEntryJSON struct {
 	Resource  string `json:"resource"`
 	Detail    string `json:"detail"`
 	IPAddress string `json:"ip_address"`
+	NetworkID int64  `json:"network_id,omitempty"`
+
+	Location *locationResponse `json:"location,omitempty"`
 }
 
-// handleAuditLog returns a paginated list of audit log entries.
+// handleAuditLog returns a paginated list of audit log entries. Callers
+// whose audit:read comes from network roles only see entries about those
+// networks.
 // Query params: limit (default 50, max 200), offset (default 0), action, resource.
 func (s *Server) handleAuditLog(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
@@ -50,8 +56,9 @@ func (s *Server) handleAuditLog(w http.ResponseWriter, r *http.Request) {
 	}
 
 	filter := db.AuditFilter{
-		Action:   q.Get("action"),
-		Resource: q.Get("resource"),
+		Action:     q.Get("action"),
+		Resource:   q.Get("resource"),
+		NetworkIDs: auth.GrantsFromContext(ctx).NetworksWith(auth.PermAuditRead),
 	}
 
 	entries, total, err := s.db.ListAuditLog(ctx, limit, offset, filter)
@@ -76,6 +83,8 @@ func (s *Server) handleAuditLog(w http.ResponseWriter, r *http.Request) {
 			Resource:  e.Resource,
 			Detail:    e.Detail,
 			IPAddress: e.IPAddress,
+			NetworkID: e.NetworkID,
+			Location:  s.locate(e.IPAddress),
 		})
 	}
 
@@ -3,6 +3,7 @@ package server
 import (
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/itsChris/wgpilot/internal/auth"
 	"github.com/itsChris/wgpilot/internal/db"
@@ -10,8 +11,9 @@ import (
 )
 
 type loginRequest struct {
-	Username string `json:"username"`
-	Password string `json:"password"`
+	Username    string `json:"username"`
+	Password    string `json:"password"`
+	NewPassword string `json:"new_password"` // sets a new password when a change is required
 }
 
 type loginResponse struct {
@@ -29,16 +31,21 @@ type setupRequest struct {
 	Password string `json:"password"`
 }
 
-// handleLogin authenticates a user and issues a session cookie.
+// handleLogin authenticates a user and issues a session cookie. Users with
+// two-factor authentication enabled, or required by policy, get a challenge
+// token instead and complete the login under /api/auth/login/2fa or
+// /api/auth/webauthn/login. Directory users are checked against LDAP
+// instead of a local hash. Password login can be turned off in favour of
+// single sign-on. Local accounts are locked after repeated failures, and
+// users who must change their password send new_password with the last
+// step of the login.
 func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
 	ip := r.RemoteAddr
-	if !s.rateLimiter.Allow(ip) {
-		s.logger.Warn("auth_rate_limited",
-			"remote_addr", ip,
-			"component", "auth",
-		)
-		w.Header().Set("Retry-After", "60")
-		writeError(w, r, fmt.Errorf("too many login attempts"), apperr.ErrRateLimited, http.StatusTooManyRequests, s.devMode)
+	if s.oidc.Provider != nil && s.oidc.DisablePasswordLogin {
+		writeError(w, r, fmt.Errorf("password login is disabled, sign in with single sign-on"), apperr.ErrSSORequired, http.StatusForbidden, s.devMode)
+		return
+	}
+	if !s.allowAuthAttempt(w, r) {
 		return
 	}
 
@@ -62,7 +69,12 @@ func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
 		writeError(w, r, fmt.Errorf("internal error"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
 		return
 	}
-	if user == nil {
+	if s.usesLDAP(user) {
+		var ok bool
+		if user, ok = s.ldapLogin(w, r, user, req.Username, req.Password); !ok {
+			return
+		}
+	} else if user == nil {
 		s.logger.Warn("auth_login_failed",
 			"user", req.Username,
 			"remote_addr", ip,
@@ -71,37 +83,58 @@ func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
 		)
 		writeError(w, r, fmt.Errorf("invalid credentials"), apperr.ErrInvalidCredentials, http.StatusUnauthorized, s.devMode)
 		return
-	}
-
-	if err := auth.VerifyPassword(user.PasswordHash, req.Password); err != nil {
+	} else if user.Locked(time.Now()) {
+		// Refused like a wrong password, so neither the lock nor the
+		// account it reveals can be seen from outside.
+		s.logger.Warn("auth_login_failed",
+			"user", req.Username,
+			"remote_addr", ip,
+			"reason", "account_locked",
+			"locked_until", user.LockedUntil.UTC().Format(time.RFC3339),
+			"component", "auth",
+		)
+		writeError(w, r, fmt.Errorf("invalid credentials"), apperr.ErrInvalidCredentials, http.StatusUnauthorized, s.devMode)
+		return
+	} else if err := auth.VerifyPassword(user.PasswordHash, req.Password); err != nil {
 		s.logger.Warn("auth_login_failed",
 			"user", req.Username,
 			"remote_addr", ip,
 			"reason", "invalid_password",
 			"component", "auth",
 		)
+		s.recordFailedLogin(r, user)
 		writeError(w, r, fmt.Errorf("invalid credentials"), apperr.ErrInvalidCredentials, http.StatusUnauthorized, s.devMode)
 		return
 	}
 
-	token, err := s.jwtService.Generate(user.ID, user.Username, user.Role)
+	required, err := s.twoFactorRequired(r.Context(), user.Role)
 	if err != nil {
-		s.logger.Error("auth_token_generation_failed",
+		s.logger.Error("auth_login_db_error",
 			"error", err,
 			"component", "auth",
 		)
 		writeError(w, r, fmt.Errorf("internal error"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
 		return
 	}
+	methods, err := s.secondFactors(r.Context(), user)
+	if err != nil {
+		s.logger.Error("auth_login_db_error",
+			"error", err,
+			"component", "auth",
+		)
+		writeError(w, r, fmt.Errorf("internal error"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
+		return
+	}
+	// A required password change waits for the second factor, so the
+	// password alone cannot replace itself or revoke the user's sessions.
+	if len(methods) > 0 || required {
+		s.writeTwoFactorChallenge(w, r, user, methods)
+		return
+	}
 
-	s.sessions.SetCookie(w, token, int(s.jwtService.TTL().Seconds()))
-
-	s.logger.Info("auth_login_success",
-		"user", user.Username,
-		"remote_addr", ip,
-		"component", "auth",
-	)
-	s.auditf(r, "auth.login", "user", "user %q logged in", user.Username)
+	if !s.checkRequiredPassword(w, r, user, req.NewPassword) || !s.finishLogin(w, r, user, req.NewPassword) {
+		return
+	}
 
 	writeJSON(w, http.StatusOK, loginResponse{
 		User: userInfo{ID: user.ID, Username: user.Username},
@@ -137,8 +170,8 @@ func (s *Server) handleSetup(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if len(req.Password) < auth.MinPasswordLength {
-		writeError(w, r, fmt.Errorf("password must be at least 10 characters"), apperr.ErrValidation, http.StatusBadRequest, s.devMode)
+	if err := s.passwords.Validate(req.Password); err != nil {
+		writeError(w, r, err, apperr.ErrWeakPassword, http.StatusBadRequest, s.devMode)
 		return
 	}
 
@@ -202,7 +235,7 @@ func (s *Server) handleSetup(w http.ResponseWriter, r *http.Request) {
 		)
 	}
 
-	token, err := s.jwtService.Generate(userID, req.Username, "admin")
+	token, err := s.issueSession(r, userID, req.Username, "admin")
 	if err != nil {
 		s.logger.Error("setup_token_generation_failed",
 			"error", err,
@@ -227,8 +260,9 @@ func (s *Server) handleSetup(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-// handleLogout clears the session cookie.
+// handleLogout revokes the current session and clears the session cookie.
 func (s *Server) handleLogout(w http.ResponseWriter, r *http.Request) {
+	s.revokeSessionFromCookie(r)
 	s.sessions.ClearCookie(w)
 
 	s.logger.Info("auth_logout",
@@ -263,11 +297,6 @@ func (s *Server) handleChangePassword(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if len(req.NewPassword) < auth.MinPasswordLength {
-		writeError(w, r, fmt.Errorf("password must be at least %d characters", auth.MinPasswordLength), apperr.ErrValidation, http.StatusBadRequest, s.devMode)
-		return
-	}
-
 	// Parse user ID from claims.
 	var userID int64
 	if _, err := fmt.Sscanf(claims.Subject, "%d", &userID); err != nil {
@@ -289,21 +318,21 @@ func (s *Server) handleChangePassword(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Hash and store new password.
-	hash, err := auth.HashPassword(req.NewPassword)
-	if err != nil {
-		s.logger.Error("change_password_hash_failed", "error", err, "component", "auth")
-		writeError(w, r, fmt.Errorf("internal error"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
+	if !s.checkNewPassword(w, r, user, req.NewPassword) {
 		return
 	}
 
-	if err := s.db.UpdateUserPassword(ctx, userID, hash); err != nil {
+	// Hash and store new password.
+	if err := s.setPassword(r, user, req.NewPassword); err != nil {
 		s.logger.Error("change_password_update_failed", "error", err, "user_id", userID, "component", "auth")
 		writeError(w, r, fmt.Errorf("failed to update password"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
 		return
 	}
 
-	// Clear current session cookie so the user must re-login.
+	// Revoke every session, including this one, so the user must re-login.
+	if _, err := s.db.DeleteUserSessions(ctx, userID, ""); err != nil {
+		s.logger.Error("change_password_revoke_sessions_failed", "error", err, "user_id", userID, "component", "auth")
+	}
 	s.sessions.ClearCookie(w)
 
 	s.logger.Info("password_changed", "user", user.Username, "user_id", userID, "remote_addr", r.RemoteAddr, "component", "auth")
@@ -149,6 +149,7 @@ func TestHandleLogin_RateLimit(t *testing.T) {
 
 	srv, err := New(Config{
 		DB:          database,
+		TimeSeries:  newTestTimeSeries(t),
 		Logger:      logger,
 		JWTService:  jwtSvc,
 		Sessions:    sessions,
@@ -386,6 +387,7 @@ func TestExpiredJWT_ProtectedEndpoint(t *testing.T) {
 
 	srv, err := New(Config{
 		DB:          database,
+		TimeSeries:  newTestTimeSeries(t),
 		Logger:      logger,
 		JWTService:  jwtSvc,
 		Sessions:    sessions,
@@ -5,6 +5,7 @@ import (
 	"net/http"
 	"strconv"
 
+	"github.com/itsChris/wgpilot/internal/auth"
 	"github.com/itsChris/wgpilot/internal/db"
 	apperr "github.com/itsChris/wgpilot/internal/errors"
 )
@@ -67,6 +68,16 @@ func (s *Server) handleCreateBridge(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// A bridge opens each network to the other, so it takes rights on both.
+	// Check it before looking the networks up, so callers cannot probe
+	// which network IDs exist.
+	if !bridgeAllowed(r, req.NetworkAID, req.NetworkBID, auth.PermBridgeWrite) {
+		writeError(w, r,
+			fmt.Errorf("bridge:write is required on both networks"),
+			apperr.ErrForbidden, http.StatusForbidden, s.devMode)
+		return
+	}
+
 	// Verify both networks exist.
 	networkA, err := s.db.GetNetworkByID(ctx, req.NetworkAID)
 	if err != nil {
@@ -124,7 +135,7 @@ func (s *Server) handleCreateBridge(w http.ResponseWriter, r *http.Request) {
 
 	// Apply nftables rules.
 	if s.nftManager != nil {
-		if err := s.nftManager.AddNetworkBridge(networkA.Interface, networkB.Interface, req.Direction); err != nil {
+		if err := s.nftManager.AddNetworkBridge(ctx, networkA.Interface, networkB.Interface, req.Direction); err != nil {
 			s.logger.Error("add_bridge_nft_failed",
 				"error", err,
 				"operation", "create_bridge",
@@ -155,7 +166,7 @@ func (s *Server) handleCreateBridge(w http.ResponseWriter, r *http.Request) {
 		)
 		// Clean up nftables rules on DB failure.
 		if s.nftManager != nil {
-			s.nftManager.RemoveNetworkBridge(networkA.Interface, networkB.Interface)
+			s.nftManager.RemoveNetworkBridge(ctx, networkA.Interface, networkB.Interface)
 		}
 		writeError(w, r, fmt.Errorf("failed to create bridge"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
 		return
@@ -184,6 +195,7 @@ func (s *Server) handleCreateBridge(w http.ResponseWriter, r *http.Request) {
 		"component", "handler",
 	)
 	s.auditf(r, "bridge.created", "bridge", "created bridge (id=%d) between networks %d and %d", id, req.NetworkAID, req.NetworkBID)
+	s.resourceChanged(r, "bridge.created", "bridge", id, nil, bridgeToResponse(created, networkA, networkB))
 
 	writeJSON(w, http.StatusCreated, bridgeToResponse(created, networkA, networkB))
 }
@@ -221,6 +233,9 @@ func (s *Server) handleListBridges(w http.ResponseWriter, r *http.Request) {
 
 	result := make([]bridgeResponse, 0, len(bridges))
 	for _, b := range bridges {
+		if !bridgeAllowed(r, b.NetworkAID, b.NetworkBID, auth.PermBridgeRead) {
+			continue
+		}
 		netA := networkMap[b.NetworkAID]
 		netB := networkMap[b.NetworkBID]
 		result = append(result, bridgeToResponse(&b, netA, netB))
@@ -250,7 +265,7 @@ func (s *Server) handleGetBridge(w http.ResponseWriter, r *http.Request) {
 		writeError(w, r, fmt.Errorf("failed to get bridge"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
 		return
 	}
-	if bridge == nil {
+	if bridge == nil || !bridgeAllowed(r, bridge.NetworkAID, bridge.NetworkBID, auth.PermBridgeRead) {
 		writeError(w, r, fmt.Errorf("bridge %d not found", id), apperr.ErrBridgeNotFound, http.StatusNotFound, s.devMode)
 		return
 	}
@@ -277,10 +292,14 @@ func (s *Server) handleUpdateBridge(w http.ResponseWriter, r *http.Request) {
 		writeError(w, r, fmt.Errorf("failed to get bridge"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
 		return
 	}
-	if bridge == nil {
+	if bridge == nil || !bridgeAllowed(r, bridge.NetworkAID, bridge.NetworkBID, auth.PermBridgeRead) {
 		writeError(w, r, fmt.Errorf("bridge %d not found", id), apperr.ErrBridgeNotFound, http.StatusNotFound, s.devMode)
 		return
 	}
+	if !bridgeAllowed(r, bridge.NetworkAID, bridge.NetworkBID, auth.PermBridgeWrite) {
+		writeError(w, r, fmt.Errorf("bridge:write is required on both networks"), apperr.ErrForbidden, http.StatusForbidden, s.devMode)
+		return
+	}
 
 	var req struct {
 		Direction    *string `json:"direction"`
@@ -292,6 +311,7 @@ func (s *Server) handleUpdateBridge(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	before := *bridge
 	oldDirection := bridge.Direction
 	if req.Direction != nil {
 		if !isValidDirection(*req.Direction) {
@@ -313,10 +333,10 @@ func (s *Server) handleUpdateBridge(w http.ResponseWriter, r *http.Request) {
 		networkB, _ := s.db.GetNetworkByID(ctx, bridge.NetworkBID)
 		if networkA != nil && networkB != nil {
 			// Remove old rules, add new ones.
-			if err := s.nftManager.RemoveNetworkBridge(networkA.Interface, networkB.Interface); err != nil {
+			if err := s.nftManager.RemoveNetworkBridge(ctx, networkA.Interface, networkB.Interface); err != nil {
 				s.logger.Error("remove_bridge_nft_failed", "error", err, "operation", "update_bridge", "component", "handler", "bridge_id", id)
 			}
-			if err := s.nftManager.AddNetworkBridge(networkA.Interface, networkB.Interface, bridge.Direction); err != nil {
+			if err := s.nftManager.AddNetworkBridge(ctx, networkA.Interface, networkB.Interface, bridge.Direction); err != nil {
 				s.logger.Error("add_bridge_nft_failed", "error", err, "operation", "update_bridge", "component", "handler", "bridge_id", id)
 				writeError(w, r, fmt.Errorf("failed to update bridge firewall rules"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
 				return
@@ -340,6 +360,7 @@ func (s *Server) handleUpdateBridge(w http.ResponseWriter, r *http.Request) {
 
 	s.logger.Info("bridge_updated", "bridge_id", id, "component", "handler")
 	s.auditf(r, "bridge.updated", "bridge", "updated bridge (id=%d)", id)
+	s.resourceChanged(r, "bridge.updated", "bridge", id, bridgeToResponse(&before, networkA, networkB), bridgeToResponse(updated, networkA, networkB))
 
 	writeJSON(w, http.StatusOK, bridgeToResponse(updated, networkA, networkB))
 }
@@ -365,17 +386,21 @@ func (s *Server) handleDeleteBridge(w http.ResponseWriter, r *http.Request) {
 		writeError(w, r, fmt.Errorf("failed to get bridge"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
 		return
 	}
-	if bridge == nil {
+	if bridge == nil || !bridgeAllowed(r, bridge.NetworkAID, bridge.NetworkBID, auth.PermBridgeRead) {
 		writeError(w, r, fmt.Errorf("bridge %d not found", id), apperr.ErrBridgeNotFound, http.StatusNotFound, s.devMode)
 		return
 	}
+	if !bridgeAllowed(r, bridge.NetworkAID, bridge.NetworkBID, auth.PermBridgeWrite) {
+		writeError(w, r, fmt.Errorf("bridge:write is required on both networks"), apperr.ErrForbidden, http.StatusForbidden, s.devMode)
+		return
+	}
 
 	// Remove nftables rules.
 	if s.nftManager != nil {
 		networkA, _ := s.db.GetNetworkByID(ctx, bridge.NetworkAID)
 		networkB, _ := s.db.GetNetworkByID(ctx, bridge.NetworkBID)
 		if networkA != nil && networkB != nil {
-			if err := s.nftManager.RemoveNetworkBridge(networkA.Interface, networkB.Interface); err != nil {
+			if err := s.nftManager.RemoveNetworkBridge(ctx, networkA.Interface, networkB.Interface); err != nil {
 				s.logger.Error("remove_bridge_nft_failed",
 					"error", err,
 					"operation", "delete_bridge",
@@ -405,12 +430,25 @@ func (s *Server) handleDeleteBridge(w http.ResponseWriter, r *http.Request) {
 		"component", "handler",
 	)
 	s.auditf(r, "bridge.deleted", "bridge", "deleted bridge (id=%d) between networks %d and %d", id, bridge.NetworkAID, bridge.NetworkBID)
+	networkA, _ := s.db.GetNetworkByID(ctx, bridge.NetworkAID)
+	networkB, _ := s.db.GetNetworkByID(ctx, bridge.NetworkBID)
+	s.resourceChanged(r, "bridge.deleted", "bridge", id, bridgeToResponse(bridge, networkA, networkB), nil)
 
 	w.WriteHeader(http.StatusNoContent)
 }
 
 // ── Helpers ──────────────────────────────────────────────────────────
 
+// bridgeAllowed reports whether the caller holds perm on both networks of a
+// bridge. Handlers treat bridges the caller cannot read as not found.
+func bridgeAllowed(r *http.Request, networkAID, networkBID int64, perm string) bool {
+	grants := auth.GrantsFromContext(r.Context())
+	if grants == nil {
+		return true
+	}
+	return grants.HasOnNetwork(networkAID, perm) && grants.HasOnNetwork(networkBID, perm)
+}
+
 func bridgeToResponse(b *db.Bridge, netA, netB *db.Network) bridgeResponse {
 	resp := bridgeResponse{
 		ID:           b.ID,
@@ -316,7 +316,7 @@ func TestDeleteBridge_Success(t *testing.T) {
 	}
 
 	// Add the NFT rule so we can verify it gets removed.
-	mockNFT.AddNetworkBridge("wg0", "wg1", "bidirectional")
+	mockNFT.AddNetworkBridge(context.Background(), "wg0", "wg1", "bidirectional")
 
 	req := httptest.NewRequest("DELETE", fmt.Sprintf("/api/bridges/%d", id), nil)
 	req = authRequest(t, srv, req)
@@ -370,7 +370,7 @@ func TestDeleteNetwork_CascadeDeletesBridges(t *testing.T) {
 	}
 
 	// Add the NFT rule.
-	mockNFT.AddNetworkBridge("wg0", "wg1", "bidirectional")
+	mockNFT.AddNetworkBridge(context.Background(), "wg0", "wg1", "bidirectional")
 
 	// Delete network A — bridge should cascade-delete and NFT rules should be removed.
 	req := httptest.NewRequest("DELETE", fmt.Sprintf("/api/networks/%d", netAID), nil)
@@ -78,9 +78,10 @@ func (s *Server) handleDebugInfo(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Database stats.
-	tableCounts := s.db.TableCounts(r.Context(), []string{"networks", "peers", "peer_snapshots", "settings"})
+	tableCounts := s.db.TableCounts(r.Context(), []string{"networks", "peers", "settings"})
 	info["database"] = map[string]any{
-		"tables": tableCounts,
+		"tables":             tableCounts,
+		"time_series_tables": s.ts.TableCounts(r.Context(), []string{"peer_snapshots", "peer_snapshots_5m", "peer_snapshots_1h", "peer_snapshots_1d"}),
 	}
 
 	writeJSON(w, http.StatusOK, info)
@@ -59,11 +59,18 @@ func TestHandleDebugInfo_DevMode_ReturnsFields(t *testing.T) {
 	if !ok {
 		t.Fatal("expected database.tables to be a map")
 	}
-	for _, table := range []string{"networks", "peers", "peer_snapshots", "settings"} {
+	for _, table := range []string{"networks", "peers", "settings"} {
 		if _, ok := tables[table]; !ok {
 			t.Errorf("missing database table count for %q", table)
 		}
 	}
+	tsTables, ok := database["time_series_tables"].(map[string]any)
+	if !ok {
+		t.Fatal("expected database.time_series_tables to be a map")
+	}
+	if _, ok := tsTables["peer_snapshots"]; !ok {
+		t.Error("missing time-series table count for \"peer_snapshots\"")
+	}
 }
 
 func TestHandleDebugInfo_DevMode_IncludesWireGuard(t *testing.T) {
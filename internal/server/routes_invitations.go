@@ -0,0 +1,467 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/itsChris/wgpilot/internal/auth"
+	"github.com/itsChris/wgpilot/internal/db"
+	apperr "github.com/itsChris/wgpilot/internal/errors"
+	"github.com/itsChris/wgpilot/internal/wg"
+)
+
+type createInvitationRequest struct {
+	Name      string `json:"name"`       // prefilled peer name, empty to let the recipient choose
+	Email     string `json:"email"`      // prefilled peer email
+	ExpiresIn string `json:"expires_in"` // e.g. "72h", empty for never
+	SingleUse *bool  `json:"single_use"` // default true
+}
+
+type createInvitationResponse struct {
+	invitationResponse
+	Token string `json:"token"` // only returned on creation
+}
+
+type invitationResponse struct {
+	ID          int64   `json:"id"`
+	NetworkID   int64   `json:"network_id"`
+	TokenPrefix string  `json:"token_prefix"`
+	Name        string  `json:"name"`
+	Email       string  `json:"email"`
+	SingleUse   bool    `json:"single_use"`
+	ExpiresAt   *string `json:"expires_at"`
+	UseCount    int     `json:"use_count"`
+	LastUsedAt  *string `json:"last_used_at"`
+	LastUsedIP  string  `json:"last_used_ip"`
+	PeerID      *int64  `json:"peer_id"`
+	RevokedAt   *string `json:"revoked_at"`
+	CreatedAt   string  `json:"created_at"`
+	Usable      bool    `json:"usable"`
+}
+
+type invitationInfoResponse struct {
+	NetworkName string  `json:"network_name"`
+	Name        string  `json:"name"`
+	Email       string  `json:"email"`
+	ExpiresAt   *string `json:"expires_at"`
+}
+
+type redeemInvitationRequest struct {
+	PublicKey string `json:"public_key"`
+	Name      string `json:"name"` // required unless the invitation names the peer
+}
+
+type redeemInvitationResponse struct {
+	PeerID  int64  `json:"peer_id"`
+	Name    string `json:"name"`
+	Address string `json:"address"`
+	Config  string `json:"config"` // PrivateKey is a placeholder for the device's own key
+}
+
+// handleListInvitations lists a network's invitations, newest first.
+func (s *Server) handleListInvitations(w http.ResponseWriter, r *http.Request) {
+	networkID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("invalid network ID"), apperr.ErrValidation, http.StatusBadRequest, s.devMode)
+		return
+	}
+
+	invitations, err := s.db.ListInvitations(r.Context(), networkID)
+	if err != nil {
+		s.logger.Error("list_invitations_failed",
+			"error", err,
+			"operation", "list_invitations",
+			"component", "handler",
+			"network_id", networkID,
+		)
+		writeError(w, r, fmt.Errorf("failed to list invitations"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
+		return
+	}
+
+	now := time.Now()
+	resp := make([]invitationResponse, 0, len(invitations))
+	for i := range invitations {
+		resp = append(resp, invitationToResponse(&invitations[i], now))
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// handleCreateInvitation creates an invitation link for enrolling a peer in
+// a network. The token is returned once and only its hash is stored.
+func (s *Server) handleCreateInvitation(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	networkID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("invalid network ID"), apperr.ErrValidation, http.StatusBadRequest, s.devMode)
+		return
+	}
+
+	var req createInvitationRequest
+	if code, status, err := decodeJSON(r, &req); err != nil {
+		writeError(w, r, err, code, status, s.devMode)
+		return
+	}
+
+	// Validate.
+	var fields []fieldError
+	if req.Name != "" && !isValidName(req.Name) {
+		fields = append(fields, fieldError{Field: "name", Message: "1-64 alphanumeric characters, spaces, hyphens, underscores"})
+	}
+	if req.Email != "" && !isValidEmail(req.Email) {
+		fields = append(fields, fieldError{Field: "email", Message: "must be a valid email address"})
+	}
+	var expiresAt *time.Time
+	if req.ExpiresIn != "" {
+		d, err := time.ParseDuration(req.ExpiresIn)
+		if err != nil || d <= 0 {
+			fields = append(fields, fieldError{Field: "expires_in", Message: "invalid duration format (e.g. '72h')"})
+		} else {
+			t := time.Now().Add(d)
+			expiresAt = &t
+		}
+	}
+	if len(fields) > 0 {
+		writeValidationError(w, r, fields)
+		return
+	}
+
+	network, err := s.db.GetNetworkByID(ctx, networkID)
+	if err != nil {
+		s.logger.Error("get_network_failed",
+			"error", err,
+			"operation", "create_invitation",
+			"component", "handler",
+			"network_id", networkID,
+		)
+		writeError(w, r, fmt.Errorf("failed to get network"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
+		return
+	}
+	if network == nil {
+		writeError(w, r, fmt.Errorf("network %d not found", networkID), apperr.ErrNetworkNotFound, http.StatusNotFound, s.devMode)
+		return
+	}
+
+	token, hash, prefix, err := auth.GenerateInvitationToken()
+	if err != nil {
+		s.logger.Error("generate_invitation_token_failed",
+			"error", err,
+			"operation", "create_invitation",
+			"component", "handler",
+		)
+		writeError(w, r, fmt.Errorf("failed to generate invitation"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
+		return
+	}
+
+	singleUse := true
+	if req.SingleUse != nil {
+		singleUse = *req.SingleUse
+	}
+
+	id, err := s.db.CreateInvitation(ctx, &db.Invitation{
+		NetworkID:   networkID,
+		TokenHash:   hash,
+		TokenPrefix: prefix,
+		Name:        req.Name,
+		Email:       req.Email,
+		SingleUse:   singleUse,
+		ExpiresAt:   expiresAt,
+		CreatedBy:   callerID(r),
+	})
+	if err != nil {
+		s.logger.Error("create_invitation_failed",
+			"error", err,
+			"operation", "create_invitation",
+			"component", "handler",
+			"network_id", networkID,
+		)
+		writeError(w, r, fmt.Errorf("failed to create invitation"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
+		return
+	}
+
+	inv, err := s.db.GetInvitationByID(ctx, id)
+	if err != nil || inv == nil {
+		s.logger.Error("get_created_invitation_failed",
+			"error", err,
+			"operation", "create_invitation",
+			"component", "handler",
+			"invitation_id", id,
+		)
+		writeError(w, r, fmt.Errorf("failed to retrieve created invitation"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
+		return
+	}
+
+	s.logger.Info("invitation_created",
+		"invitation_id", id,
+		"network_id", networkID,
+		"single_use", singleUse,
+		"component", "handler",
+	)
+	s.auditNetworkf(r, networkID, "invitation.created", "invitation", "created invitation %s (id=%d) for network %q", prefix, id, network.Name)
+
+	writeJSON(w, http.StatusCreated, createInvitationResponse{
+		invitationResponse: invitationToResponse(inv, time.Now()),
+		Token:              token,
+	})
+}
+
+// handleRevokeInvitation stops an invitation from being redeemed. Peers
+// already enrolled with it are left alone.
+func (s *Server) handleRevokeInvitation(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	networkID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("invalid network ID"), apperr.ErrValidation, http.StatusBadRequest, s.devMode)
+		return
+	}
+
+	invitationID, err := strconv.ParseInt(r.PathValue("iid"), 10, 64)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("invalid invitation ID"), apperr.ErrValidation, http.StatusBadRequest, s.devMode)
+		return
+	}
+
+	inv, err := s.db.GetInvitationByID(ctx, invitationID)
+	if err != nil {
+		s.logger.Error("get_invitation_failed",
+			"error", err,
+			"operation", "revoke_invitation",
+			"component", "handler",
+			"invitation_id", invitationID,
+		)
+		writeError(w, r, fmt.Errorf("failed to get invitation"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
+		return
+	}
+	if inv == nil || inv.NetworkID != networkID {
+		writeError(w, r, fmt.Errorf("invitation %d not found in network %d", invitationID, networkID), apperr.ErrInvitationNotFound, http.StatusNotFound, s.devMode)
+		return
+	}
+
+	if _, err := s.db.RevokeInvitation(ctx, invitationID); err != nil {
+		s.logger.Error("revoke_invitation_failed",
+			"error", err,
+			"operation", "revoke_invitation",
+			"component", "handler",
+			"invitation_id", invitationID,
+		)
+		writeError(w, r, fmt.Errorf("failed to revoke invitation"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
+		return
+	}
+
+	s.logger.Info("invitation_revoked",
+		"invitation_id", invitationID,
+		"network_id", networkID,
+		"component", "handler",
+	)
+	s.auditNetworkf(r, networkID, "invitation.revoked", "invitation", "revoked invitation %s (id=%d)", inv.TokenPrefix, invitationID)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ── Public invitation routes ─────────────────────────────────────────
+
+// usableInvitation looks up the invitation for the {token} path value. It
+// writes a 404 and returns nil for unknown, revoked, expired and used-up
+// invitations alike, so that the response does not tell them apart.
+func (s *Server) usableInvitation(w http.ResponseWriter, r *http.Request) *db.Invitation {
+	inv, err := s.db.GetInvitationByHash(r.Context(), auth.HashInvitationToken(r.PathValue("token")))
+	if err != nil {
+		s.logger.Error("get_invitation_failed",
+			"error", err,
+			"operation", "invitation_lookup",
+			"component", "handler",
+		)
+		writeError(w, r, fmt.Errorf("failed to get invitation"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
+		return nil
+	}
+	if inv == nil || !inv.Usable(time.Now()) {
+		writeError(w, r, fmt.Errorf("invitation not found or no longer valid"), apperr.ErrInvitationNotFound, http.StatusNotFound, s.devMode)
+		return nil
+	}
+	return inv
+}
+
+// handleGetInvitation shows the recipient of an invitation what they are
+// enrolling in.
+func (s *Server) handleGetInvitation(w http.ResponseWriter, r *http.Request) {
+	if !s.allowAuthAttempt(w, r) {
+		return
+	}
+
+	inv := s.usableInvitation(w, r)
+	if inv == nil {
+		return
+	}
+
+	network, err := s.db.GetNetworkByID(r.Context(), inv.NetworkID)
+	if err != nil || network == nil {
+		writeError(w, r, fmt.Errorf("network %d not found", inv.NetworkID), apperr.ErrNetworkNotFound, http.StatusNotFound, s.devMode)
+		return
+	}
+
+	resp := invitationInfoResponse{
+		NetworkName: network.Name,
+		Name:        inv.Name,
+		Email:       inv.Email,
+	}
+	if inv.ExpiresAt != nil {
+		t := inv.ExpiresAt.Format(time.RFC3339)
+		resp.ExpiresAt = &t
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// handleRedeemInvitation enrolls the recipient's device as a client peer.
+// The device generates its own keypair and sends only the public key, so
+// the private key never reaches the server.
+func (s *Server) handleRedeemInvitation(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if !s.allowAuthAttempt(w, r) {
+		return
+	}
+
+	inv := s.usableInvitation(w, r)
+	if inv == nil {
+		return
+	}
+
+	var req redeemInvitationRequest
+	if code, status, err := decodeJSON(r, &req); err != nil {
+		writeError(w, r, err, code, status, s.devMode)
+		return
+	}
+
+	name := inv.Name
+	if name == "" {
+		name = req.Name
+	}
+
+	// Validate.
+	var fields []fieldError
+	if err := wg.ParseKey(req.PublicKey); err != nil {
+		fields = append(fields, fieldError{Field: "public_key", Message: "must be a base64-encoded WireGuard public key"})
+	}
+	if !isValidName(name) {
+		fields = append(fields, fieldError{Field: "name", Message: "1-64 alphanumeric characters, spaces, hyphens, underscores"})
+	}
+	if len(fields) > 0 {
+		writeValidationError(w, r, fields)
+		return
+	}
+
+	network, err := s.db.GetNetworkByID(ctx, inv.NetworkID)
+	if err != nil || network == nil {
+		writeError(w, r, fmt.Errorf("network %d not found", inv.NetworkID), apperr.ErrNetworkNotFound, http.StatusNotFound, s.devMode)
+		return
+	}
+
+	// Claim the invitation before provisioning so that two redemptions of
+	// a single-use link cannot both enroll a peer.
+	ip := auth.ClientIP(r)
+	claimed, err := s.db.ClaimInvitation(ctx, inv.ID, ip)
+	if err != nil {
+		s.logger.Error("claim_invitation_failed",
+			"error", err,
+			"operation", "redeem_invitation",
+			"component", "handler",
+			"invitation_id", inv.ID,
+		)
+		writeError(w, r, fmt.Errorf("failed to redeem invitation"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
+		return
+	}
+	if !claimed {
+		writeError(w, r, fmt.Errorf("invitation not found or no longer valid"), apperr.ErrInvitationNotFound, http.StatusNotFound, s.devMode)
+		return
+	}
+
+	peer, ok := s.provisionPeer(w, r, network, &db.Peer{
+		NetworkID: network.ID,
+		Name:      name,
+		Email:     inv.Email,
+		PublicKey: req.PublicKey,
+		Role:      "client",
+		Enabled:   true,
+	})
+	if !ok {
+		if err := s.db.ReleaseInvitation(ctx, inv.ID); err != nil {
+			s.logger.Error("release_invitation_failed",
+				"error", err,
+				"operation", "redeem_invitation",
+				"component", "handler",
+				"invitation_id", inv.ID,
+			)
+		}
+		return
+	}
+
+	if err := s.db.SetInvitationPeer(ctx, inv.ID, peer.ID); err != nil {
+		s.logger.Error("set_invitation_peer_failed",
+			"error", err,
+			"operation", "redeem_invitation",
+			"component", "handler",
+			"invitation_id", inv.ID,
+			"peer_id", peer.ID,
+		)
+	}
+
+	s.logger.Info("invitation_redeemed",
+		"invitation_id", inv.ID,
+		"network_id", network.ID,
+		"peer_id", peer.ID,
+		"remote_addr", r.RemoteAddr,
+		"component", "handler",
+	)
+	s.auditNetworkf(r, network.ID, "invitation.redeemed", "invitation", "invitation %s (id=%d) enrolled peer %q (id=%d) from %s", inv.TokenPrefix, inv.ID, peer.Name, peer.ID, ip)
+
+	conf, err := s.peerClientConfig(ctx, network, peer, "redeem_invitation")
+	if err != nil {
+		s.logger.Error("generate_config_failed",
+			"error", err,
+			"operation", "redeem_invitation",
+			"component", "handler",
+			"peer_id", peer.ID,
+		)
+	}
+
+	writeJSON(w, http.StatusCreated, redeemInvitationResponse{
+		PeerID:  peer.ID,
+		Name:    peer.Name,
+		Address: peer.AllowedIPs,
+		Config:  conf,
+	})
+}
+
+func invitationToResponse(inv *db.Invitation, now time.Time) invitationResponse {
+	resp := invitationResponse{
+		ID:          inv.ID,
+		NetworkID:   inv.NetworkID,
+		TokenPrefix: inv.TokenPrefix,
+		Name:        inv.Name,
+		Email:       inv.Email,
+		SingleUse:   inv.SingleUse,
+		UseCount:    inv.UseCount,
+		LastUsedIP:  inv.LastUsedIP,
+		CreatedAt:   inv.CreatedAt.Format(time.RFC3339),
+		Usable:      inv.Usable(now),
+	}
+	if inv.PeerID != 0 {
+		resp.PeerID = &inv.PeerID
+	}
+	if inv.ExpiresAt != nil {
+		s := inv.ExpiresAt.Format(time.RFC3339)
+		resp.ExpiresAt = &s
+	}
+	if inv.LastUsedAt != nil {
+		s := inv.LastUsedAt.Format(time.RFC3339)
+		resp.LastUsedAt = &s
+	}
+	if inv.RevokedAt != nil {
+		s := inv.RevokedAt.Format(time.RFC3339)
+		resp.RevokedAt = &s
+	}
+	return resp
+}
@@ -0,0 +1,155 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/itsChris/wgpilot/internal/auth"
+	"github.com/itsChris/wgpilot/internal/db"
+	"github.com/itsChris/wgpilot/internal/wg"
+)
+
+func TestInvitations_RedeemSingleUse(t *testing.T) {
+	srv, mockWG, _ := newTestServerWithWG(t)
+	netID := createTestNetwork(t, srv)
+	ctx := context.Background()
+
+	token, err := adminSession(t, srv)
+	if err != nil {
+		t.Fatalf("admin session: %v", err)
+	}
+	admin := &http.Cookie{Name: auth.CookieName, Value: token}
+	invitations := fmt.Sprintf("/api/networks/%d/invitations", netID)
+
+	w := sendJSON(t, srv, "POST", invitations, `{"email":"guest@example.com","expires_in":"72h"}`, admin)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create: expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var created createInvitationResponse
+	if err := json.NewDecoder(w.Body).Decode(&created); err != nil {
+		t.Fatalf("decode invitation: %v", err)
+	}
+	if !strings.HasPrefix(created.Token, "wgi_") || !created.SingleUse || created.ExpiresAt == nil {
+		t.Fatalf("expected a single-use expiring wgi_ token, got %+v", created)
+	}
+
+	w = sendWithCookie(t, srv, "GET", invitations, admin)
+	if strings.Contains(w.Body.String(), created.Token) {
+		t.Error("list must not return the token")
+	}
+
+	link := "/api/invitations/" + created.Token
+	w = sendJSON(t, srv, "GET", link, "", nil)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"network_name":"Test Network"`) {
+		t.Fatalf("info: expected 200 with the network name, got %d: %s", w.Code, w.Body.String())
+	}
+
+	_, pub, err := wg.GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("generate keypair: %v", err)
+	}
+	w = sendJSON(t, srv, "POST", link+"/redeem", fmt.Sprintf(`{"public_key":%q,"name":"Guest Laptop"}`, pub), nil)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("redeem: expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var redeemed redeemInvitationResponse
+	if err := json.NewDecoder(w.Body).Decode(&redeemed); err != nil {
+		t.Fatalf("decode redeem: %v", err)
+	}
+	if redeemed.Address != "10.0.0.2/32" || !strings.Contains(redeemed.Config, "PrivateKey = YOUR_PRIVATE_KEY") {
+		t.Errorf("expected an address and a config without the private key, got %+v", redeemed)
+	}
+
+	peer, err := srv.db.GetPeerByID(ctx, redeemed.PeerID)
+	if err != nil || peer == nil {
+		t.Fatalf("get peer: %v", err)
+	}
+	if peer.PublicKey != pub || peer.PrivateKey != "" || peer.Email != "guest@example.com" || peer.Role != "client" {
+		t.Errorf("expected a client peer with the device's key only, got %+v", peer)
+	}
+	if !slices.Contains(mockWG.CallMethods(), "ConfigureDevice") {
+		t.Error("expected the peer to be added to WireGuard")
+	}
+
+	// The server has no private key to put in a QR code.
+	qr := fmt.Sprintf("/api/networks/%d/peers/%d/qr", netID, peer.ID)
+	if w := sendWithCookie(t, srv, "GET", qr, admin); w.Code != http.StatusConflict {
+		t.Errorf("qr: expected 409, got %d", w.Code)
+	}
+
+	// A single-use link works once.
+	if w := sendJSON(t, srv, "POST", link+"/redeem", fmt.Sprintf(`{"public_key":%q,"name":"Second"}`, pub), nil); w.Code != http.StatusNotFound {
+		t.Errorf("second redeem: expected 404, got %d: %s", w.Code, w.Body.String())
+	}
+
+	inv, err := srv.db.GetInvitationByID(ctx, created.ID)
+	if err != nil || inv == nil {
+		t.Fatalf("get invitation: %v", err)
+	}
+	if inv.UseCount != 1 || inv.PeerID != peer.ID || inv.LastUsedIP != "192.0.2.1" {
+		t.Errorf("expected one recorded use enrolling peer %d, got %+v", peer.ID, inv)
+	}
+
+	entries, _, err := srv.db.ListAuditLog(ctx, 10, 0, db.AuditFilter{Action: "invitation.redeemed"})
+	if err != nil {
+		t.Fatalf("list audit: %v", err)
+	}
+	if len(entries) != 1 || entries[0].IPAddress == "" {
+		t.Errorf("expected one redemption audit entry with an IP, got %+v", entries)
+	}
+}
+
+func TestInvitations_Revoke(t *testing.T) {
+	srv, _, _ := newTestServerWithWG(t)
+	netID := createTestNetwork(t, srv)
+
+	token, err := adminSession(t, srv)
+	if err != nil {
+		t.Fatalf("admin session: %v", err)
+	}
+	admin := &http.Cookie{Name: auth.CookieName, Value: token}
+	invitations := fmt.Sprintf("/api/networks/%d/invitations", netID)
+
+	if w := sendJSON(t, srv, "POST", invitations, `{"expires_in":"soon"}`, admin); w.Code != http.StatusBadRequest {
+		t.Errorf("bad expiry: expected 400, got %d", w.Code)
+	}
+
+	w := sendJSON(t, srv, "POST", invitations, `{"name":"Kiosk","single_use":false}`, admin)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create: expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var created createInvitationResponse
+	if err := json.NewDecoder(w.Body).Decode(&created); err != nil {
+		t.Fatalf("decode invitation: %v", err)
+	}
+
+	if w := sendWithCookie(t, srv, "DELETE", fmt.Sprintf("%s/%d", invitations, created.ID+1), admin); w.Code != http.StatusNotFound {
+		t.Errorf("revoke unknown: expected 404, got %d", w.Code)
+	}
+	if w := sendWithCookie(t, srv, "DELETE", fmt.Sprintf("%s/%d", invitations, created.ID), admin); w.Code != http.StatusNoContent {
+		t.Fatalf("revoke: expected 204, got %d: %s", w.Code, w.Body.String())
+	}
+
+	_, pub, err := wg.GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("generate keypair: %v", err)
+	}
+	w = sendJSON(t, srv, "POST", "/api/invitations/"+created.Token+"/redeem", fmt.Sprintf(`{"public_key":%q}`, pub), nil)
+	if w.Code != http.StatusNotFound || !strings.Contains(w.Body.String(), "INVITATION_NOT_FOUND") {
+		t.Errorf("redeem revoked: expected 404 INVITATION_NOT_FOUND, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w = sendWithCookie(t, srv, "GET", invitations, admin)
+	var listed []invitationResponse
+	if err := json.NewDecoder(w.Body).Decode(&listed); err != nil {
+		t.Fatalf("decode invitations: %v", err)
+	}
+	if len(listed) != 1 || listed[0].RevokedAt == nil || listed[0].Usable {
+		t.Errorf("expected one revoked invitation, got %+v", listed)
+	}
+}
@@ -0,0 +1,101 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/itsChris/wgpilot/internal/auth"
+	"github.com/itsChris/wgpilot/internal/db"
+	apperr "github.com/itsChris/wgpilot/internal/errors"
+)
+
+// usesLDAP reports whether a password login for user (nil if there is no
+// local account) is checked against the directory. Local accounts always
+// use their local password, which keeps a break-glass admin usable while
+// the directory is down.
+func (s *Server) usesLDAP(user *db.User) bool {
+	if s.ldap.Authenticator == nil {
+		return false
+	}
+	if user == nil {
+		return s.ldap.ProvisionUsers
+	}
+	return user.AuthSource == db.AuthSourceLDAP
+}
+
+// ldapLogin verifies a password against the directory and returns the local
+// account, provisioning it on first login and syncing its role from group
+// membership. user is the account found by username, or nil.
+func (s *Server) ldapLogin(w http.ResponseWriter, r *http.Request, user *db.User, username, password string) (*db.User, bool) {
+	ctx := r.Context()
+
+	entry, err := s.ldap.Authenticator.Authenticate(ctx, username, password)
+	if errors.Is(err, auth.ErrLDAPInvalidCredentials) {
+		s.logger.Warn("auth_login_failed",
+			"user", username,
+			"remote_addr", r.RemoteAddr,
+			"reason", "ldap_invalid_credentials",
+			"component", "auth",
+		)
+		writeError(w, r, fmt.Errorf("invalid credentials"), apperr.ErrInvalidCredentials, http.StatusUnauthorized, s.devMode)
+		return nil, false
+	}
+	if err != nil {
+		s.logger.Error("ldap_login_failed",
+			"user", username,
+			"error", err,
+			"component", "auth",
+		)
+		writeError(w, r, fmt.Errorf("directory server is unavailable"), apperr.ErrInternal, http.StatusServiceUnavailable, s.devMode)
+		return nil, false
+	}
+
+	// DNs are case-insensitive; the lower-cased DN ties a directory entry
+	// to one account whatever case the username is typed in.
+	externalID := strings.ToLower(entry.DN)
+	if user == nil {
+		if user, err = s.db.GetUserByExternalID(ctx, db.AuthSourceLDAP, externalID); err != nil {
+			s.logger.Error("auth_login_db_error",
+				"error", err,
+				"component", "auth",
+			)
+			writeError(w, r, fmt.Errorf("internal error"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
+			return nil, false
+		}
+	}
+
+	role := roleForGroups(entry.Groups, s.ldap.RoleMapping, s.ldap.DefaultRole)
+	if role == "" && user != nil && len(s.ldap.RoleMapping) == 0 {
+		role = user.Role // roles are managed in wgpilot
+	}
+	if role == "" {
+		s.logger.Warn("ldap_login_denied",
+			"user", username,
+			"remote_addr", r.RemoteAddr,
+			"reason", "no_role",
+			"component", "auth",
+		)
+		s.auditf(r, "auth.ldap_denied", "user", "directory user %q has no wgpilot role", username)
+		writeError(w, r, fmt.Errorf("no wgpilot role is assigned to this account"), apperr.ErrForbidden, http.StatusForbidden, s.devMode)
+		return nil, false
+	}
+
+	if user == nil {
+		if user, err = s.provisionUser(r, db.AuthSourceLDAP, username, externalID, role); err != nil {
+			s.logger.Warn("ldap_provision_failed",
+				"user", username,
+				"error", err,
+				"component", "auth",
+			)
+			writeError(w, r, fmt.Errorf("account %q cannot be created", username), apperr.ErrValidation, http.StatusConflict, s.devMode)
+			return nil, false
+		}
+	} else if err := s.syncUserRole(r, user, role); err != nil {
+		s.logger.Error("update_user_role_failed", "error", err, "component", "auth", "user_id", user.ID)
+		writeError(w, r, fmt.Errorf("internal error"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
+		return nil, false
+	}
+	return user, true
+}
@@ -0,0 +1,139 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/itsChris/wgpilot/internal/auth"
+	"github.com/itsChris/wgpilot/internal/db"
+	"github.com/itsChris/wgpilot/internal/testutil"
+)
+
+const (
+	ldapAdminsDN = "cn=vpn-admins,ou=groups,dc=example,dc=com"
+	ldapAliceDN  = "uid=alice,ou=people,dc=example,dc=com"
+)
+
+func newTestServerForLDAP(t *testing.T) (*Server, *testutil.MockLDAPServer) {
+	t.Helper()
+	srv := newTestServerFor2FA(t)
+
+	dir, err := testutil.NewMockLDAPServer(false)
+	if err != nil {
+		t.Fatalf("NewMockLDAPServer: %v", err)
+	}
+	t.Cleanup(dir.Close)
+	dir.AddEntry("cn=svc,dc=example,dc=com", "svcpass", nil)
+	dir.AddEntry(ldapAliceDN, "alicepass", map[string][]string{"uid": {"alice"}, "memberOf": {ldapAdminsDN}})
+	dir.AddEntry("uid=bob,ou=people,dc=example,dc=com", "bobpass", map[string][]string{"uid": {"bob"}})
+
+	authenticator, err := auth.NewLDAPAuthenticator(auth.LDAPConfig{
+		URL:          dir.URL,
+		BindDN:       "cn=svc,dc=example,dc=com",
+		BindPassword: "svcpass",
+		BaseDN:       "dc=example,dc=com",
+	})
+	if err != nil {
+		t.Fatalf("NewLDAPAuthenticator: %v", err)
+	}
+	srv.ldap = LDAPConfig{
+		Authenticator:  authenticator,
+		RoleMapping:    map[string]string{"CN=VPN-Admins,OU=Groups,DC=example,DC=com": "admin"},
+		ProvisionUsers: true,
+	}
+	return srv, dir
+}
+
+func loginAs(t *testing.T, srv *Server, username, password string) *httptest.ResponseRecorder {
+	t.Helper()
+	return postJSON(t, srv, "/api/auth/login", `{"username":"`+username+`","password":"`+password+`"}`, nil)
+}
+
+func TestLDAP_ProvisionsUser(t *testing.T) {
+	srv, _ := newTestServerForLDAP(t)
+
+	w := loginAs(t, srv, "alice", "alicepass")
+	if w.Code != http.StatusOK || sessionCookieFrom(w) == nil {
+		t.Fatalf("expected a session, got %d: %s", w.Code, w.Body.String())
+	}
+	user, _ := srv.db.GetUserByUsername(context.Background(), "alice")
+	if user == nil || user.AuthSource != db.AuthSourceLDAP || user.Role != "admin" || user.ExternalID != ldapAliceDN {
+		t.Fatalf("unexpected user %+v", user)
+	}
+
+	if w := loginAs(t, srv, "alice", "wrong"); w.Code != http.StatusUnauthorized {
+		t.Errorf("wrong password: expected 401, got %d", w.Code)
+	}
+}
+
+func TestLDAP_DeniesUnmappedUser(t *testing.T) {
+	srv, _ := newTestServerForLDAP(t)
+
+	if w := loginAs(t, srv, "bob", "bobpass"); w.Code != http.StatusForbidden {
+		t.Fatalf("expected 403, got %d: %s", w.Code, w.Body.String())
+	}
+	if u, _ := srv.db.GetUserByUsername(context.Background(), "bob"); u != nil {
+		t.Error("expected no user to be provisioned")
+	}
+
+	srv.ldap.DefaultRole = "viewer"
+	if w := loginAs(t, srv, "bob", "bobpass"); w.Code != http.StatusOK {
+		t.Errorf("expected 200 with a default role, got %d", w.Code)
+	}
+}
+
+func TestLDAP_LocalAdminIsBreakGlass(t *testing.T) {
+	srv, dir := newTestServerForLDAP(t)
+	loginAs(t, srv, "alice", "alicepass")
+	dir.Close()
+
+	// The directory is down: local accounts still log in, directory
+	// accounts do not.
+	if w := loginAs(t, srv, "admin", "correctpassword"); w.Code != http.StatusOK {
+		t.Errorf("local admin: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := loginAs(t, srv, "alice", "alicepass"); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("directory user: expected 503, got %d", w.Code)
+	}
+}
+
+func TestLDAP_PerUserSelection(t *testing.T) {
+	srv, _ := newTestServerForLDAP(t)
+	srv.ldap.ProvisionUsers = false
+	srv.ldap.RoleMapping = nil
+
+	// Without provisioning only accounts marked as directory users log in.
+	if w := loginAs(t, srv, "bob", "bobpass"); w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 before bob is added, got %d", w.Code)
+	}
+
+	cookie := authCookie(t, srv)
+	w := postJSON(t, srv, "/api/users", `{"username":"bob","role":"viewer","auth_source":"ldap","password":"x"}`, cookie)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("directory user with a password: expected 400, got %d", w.Code)
+	}
+	w = postJSON(t, srv, "/api/users", `{"username":"bob","role":"viewer","auth_source":"ldap"}`, cookie)
+	if w.Code != http.StatusCreated || !strings.Contains(w.Body.String(), `"auth_source":"ldap"`) {
+		t.Fatalf("create: expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// Without a role mapping the role assigned in wgpilot is kept.
+	if w := loginAs(t, srv, "bob", "bobpass"); w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if u, _ := srv.db.GetUserByUsername(context.Background(), "bob"); u.Role != "viewer" {
+		t.Errorf("role = %q, want viewer", u.Role)
+	}
+}
+
+func TestLDAP_TwoFactorApplies(t *testing.T) {
+	srv, _ := newTestServerForLDAP(t)
+	srv.db.SetSetting(context.Background(), settingRequire2FAAdmin, "true")
+
+	if w := loginAs(t, srv, "alice", "alicepass"); w.Code != http.StatusAccepted {
+		t.Errorf("expected a two-factor challenge, got %d: %s", w.Code, w.Body.String())
+	}
+}
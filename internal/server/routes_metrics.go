@@ -1,90 +1,155 @@
 package server
 
 import (
+	"bytes"
+	"context"
+	"crypto/subtle"
 	"fmt"
 	"net/http"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
+
+	"github.com/itsChris/wgpilot/internal/auth"
+	"github.com/itsChris/wgpilot/internal/metrics"
+	"github.com/itsChris/wgpilot/internal/middleware"
 )
 
-// handleMetrics returns Prometheus exposition format metrics.
+// handleMetrics returns the metrics registry in the Prometheus exposition
+// format. WireGuard series come from the poller's cache, so a scrape does
+// not query the kernel. If a metrics token is configured, the request must
+// carry it as a bearer token, or be authenticated as a user or API key with
+// network:read. Callers whose network:read comes from network roles only
+// get the series of those networks. Without a token, anonymous callers get
+// no per-peer series, which name peers and carry their public keys.
 func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
-	var b strings.Builder
-
-	networks, err := s.db.ListNetworks(r.Context())
-	if err != nil {
-		http.Error(w, "# error listing networks", http.StatusInternalServerError)
+	grants := auth.GrantsFromContext(r.Context())
+	if grants == nil && s.metricsAuth != "" && !validMetricsToken(r, s.metricsAuth) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="metrics"`)
+		http.Error(w, "# unauthorized", http.StatusUnauthorized)
 		return
 	}
 
-	b.WriteString("# HELP wg_peers_total Total number of configured peers per network.\n")
-	b.WriteString("# TYPE wg_peers_total gauge\n")
-
-	b.WriteString("# HELP wg_peers_online Number of online peers per network.\n")
-	b.WriteString("# TYPE wg_peers_online gauge\n")
-
-	b.WriteString("# HELP wg_transfer_bytes_total Total transfer bytes per network and direction.\n")
-	b.WriteString("# TYPE wg_transfer_bytes_total counter\n")
-
-	b.WriteString("# HELP wg_peer_last_handshake_seconds Seconds since last handshake per peer.\n")
-	b.WriteString("# TYPE wg_peer_last_handshake_seconds gauge\n")
-
-	b.WriteString("# HELP wg_interface_up Whether the WireGuard interface is up.\n")
-	b.WriteString("# TYPE wg_interface_up gauge\n")
-
-	now := time.Now()
+	families := s.metrics.Gather()
+	if grants == nil && s.metricsAuth == "" {
+		families = withoutPeerSeries(families)
+	}
+	if grants != nil {
+		if ids := grants.NetworksWith(auth.PermNetworkRead); ids != nil {
+			ifaces, err := s.networkInterfaces(r.Context(), ids)
+			if err != nil {
+				s.logger.Error("metrics_list_networks_failed",
+					"error", err,
+					"error_type", fmt.Sprintf("%T", err),
+					"operation", "metrics",
+					"component", "server",
+				)
+				http.Error(w, "# error writing metrics", http.StatusInternalServerError)
+				return
+			}
+			families = networkFamilies(families, ifaces)
+		}
+	}
 
-	for _, net := range networks {
-		iface := net.Interface
+	var b bytes.Buffer
+	if err := metrics.WriteFamilies(&b, families); err != nil {
+		s.logger.Error("metrics_write_failed",
+			"error", err,
+			"error_type", fmt.Sprintf("%T", err),
+			"operation", "metrics",
+			"component", "server",
+		)
+		http.Error(w, "# error writing metrics", http.StatusInternalServerError)
+		return
+	}
 
-		if !net.Enabled || s.wgManager == nil {
-			fmt.Fprintf(&b, "wg_interface_up{network=%q} 0\n", iface)
-			continue
-		}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write(b.Bytes())
+}
 
-		statuses, err := s.wgManager.PeerStatus(iface)
-		if err != nil {
-			fmt.Fprintf(&b, "wg_interface_up{network=%q} 0\n", iface)
-			continue
+// httpMetrics registers the HTTP request metrics and returns the request
+// logger hook that records them.
+func (s *Server) httpMetrics() middleware.RequestObserver {
+	requests := metrics.NewCounterVec("wgpilot_http_requests_total",
+		"HTTP requests by method, route and status.", "method", "route", "status")
+	duration := metrics.NewHistogramVec("wgpilot_http_request_duration_seconds",
+		"HTTP request latency by method and route.", nil, "method", "route")
+	s.metrics.Register(requests)
+	s.metrics.Register(duration)
+
+	return func(method, route string, status int, d time.Duration) {
+		// Clients choose the method, so unknown ones share a label value.
+		switch method {
+		case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut,
+			http.MethodPatch, http.MethodDelete, http.MethodOptions:
+		default:
+			method = "OTHER"
 		}
+		requests.Inc(method, route, strconv.Itoa(status))
+		duration.Observe(d.Seconds(), method, route)
+	}
+}
 
-		// Look up peer names from DB.
-		peers, _ := s.db.ListPeersByNetworkID(r.Context(), net.ID)
-		nameByKey := make(map[string]string, len(peers))
-		for _, p := range peers {
-			nameByKey[p.PublicKey] = p.Name
-		}
+// validMetricsToken reports whether r carries the configured bearer token.
+func validMetricsToken(r *http.Request, token string) bool {
+	got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && subtle.ConstantTimeCompare([]byte(got), []byte(token)) == 1
+}
 
-		fmt.Fprintf(&b, "wg_interface_up{network=%q} 1\n", iface)
-		fmt.Fprintf(&b, "wg_peers_total{network=%q} %d\n", iface, len(statuses))
+// hasUserCredentials reports whether r carries a session cookie or an API
+// key, rather than the metrics token or nothing.
+func hasUserCredentials(r *http.Request) bool {
+	if _, err := r.Cookie(auth.CookieName); err == nil {
+		return true
+	}
+	return strings.HasPrefix(r.Header.Get("Authorization"), "Bearer wgp_")
+}
 
-		var online int
-		var totalRx, totalTx int64
-		for _, st := range statuses {
-			if st.Online {
-				online++
-			}
-			totalRx += st.TransferRx
-			totalTx += st.TransferTx
+// networkInterfaces returns the interface names of the networks with ids.
+func (s *Server) networkInterfaces(ctx context.Context, ids []int64) (map[string]bool, error) {
+	networks, err := s.db.ListNetworks(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ifaces := make(map[string]bool, len(ids))
+	for _, n := range networks {
+		if slices.Contains(ids, n.ID) {
+			ifaces[n.Interface] = true
+		}
+	}
+	return ifaces, nil
+}
 
-			peerLabel := nameByKey[st.PublicKey]
-			if peerLabel == "" {
-				peerLabel = st.PublicKey[:8] + "..."
-			}
+// withoutPeerSeries drops the samples labelled with a peer.
+func withoutPeerSeries(families []metrics.Family) []metrics.Family {
+	for i, f := range families {
+		families[i].Samples = slices.DeleteFunc(slices.Clone(f.Samples), func(smp metrics.Sample) bool {
+			return slices.ContainsFunc(smp.Labels, func(l metrics.Label) bool { return l.Name == "peer" })
+		})
+	}
+	return families
+}
 
-			if !st.LastHandshake.IsZero() {
-				seconds := now.Sub(st.LastHandshake).Seconds()
-				fmt.Fprintf(&b, "wg_peer_last_handshake_seconds{network=%q,peer=%q} %.0f\n",
-					iface, peerLabel, seconds)
+// networkFamilies keeps only the samples labelled with one of the network
+// interfaces in ifaces, dropping server-wide series and families left empty.
+func networkFamilies(families []metrics.Family, ifaces map[string]bool) []metrics.Family {
+	var kept []metrics.Family
+	for _, f := range families {
+		var samples []metrics.Sample
+		for _, smp := range f.Samples {
+			for _, l := range smp.Labels {
+				if l.Name == "network" && ifaces[l.Value] {
+					samples = append(samples, smp)
+					break
+				}
 			}
 		}
-
-		fmt.Fprintf(&b, "wg_peers_online{network=%q} %d\n", iface, online)
-		fmt.Fprintf(&b, "wg_transfer_bytes_total{network=%q,direction=\"rx\"} %d\n", iface, totalRx)
-		fmt.Fprintf(&b, "wg_transfer_bytes_total{network=%q,direction=\"tx\"} %d\n", iface, totalTx)
+		if len(samples) > 0 {
+			f.Samples = samples
+			kept = append(kept, f)
+		}
 	}
-
-	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
-	w.WriteHeader(http.StatusOK)
-	fmt.Fprint(w, b.String())
+	return kept
 }
@@ -8,10 +8,41 @@ import (
 	"testing"
 
 	"github.com/itsChris/wgpilot/internal/db"
+	"github.com/itsChris/wgpilot/internal/monitor"
 )
 
+// pollForMetrics registers a poller on the server's metrics registry and
+// runs one poll cycle, as main does at startup.
+func pollForMetrics(t *testing.T, srv *Server) {
+	t.Helper()
+	poller, err := monitor.NewPoller(srv.db, srv.ts, srv.wgManager, nil, srv.logger, 0)
+	if err != nil {
+		t.Fatalf("NewPoller: %v", err)
+	}
+	srv.metrics.Register(poller)
+	poller.Poll(context.Background())
+}
+
+// scrapeMetrics scrapes /metrics with the metrics token, setting one if
+// none is configured, so per-peer series are included.
+func scrapeMetrics(t *testing.T, srv *Server) string {
+	t.Helper()
+	if srv.metricsAuth == "" {
+		srv.metricsAuth = "scrape-secret"
+	}
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	req.Header.Set("Authorization", "Bearer "+srv.metricsAuth)
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	return w.Body.String()
+}
+
 func TestHandleMetrics_NoNetworks(t *testing.T) {
 	srv := newTestServerForMonitoring(t)
+	pollForMetrics(t, srv)
 
 	req := httptest.NewRequest("GET", "/metrics", nil)
 	w := httptest.NewRecorder()
@@ -56,36 +87,27 @@ func TestHandleMetrics_WithNetwork_ReturnsAllMetrics(t *testing.T) {
 	if err != nil {
 		t.Fatalf("create peer: %v", err)
 	}
+	pollForMetrics(t, srv)
 
-	req := httptest.NewRequest("GET", "/metrics", nil)
-	w := httptest.NewRecorder()
-	srv.ServeHTTP(w, req)
-
-	if w.Code != http.StatusOK {
-		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
-	}
-
-	body := w.Body.String()
+	body := scrapeMetrics(t, srv)
 
 	// Check all expected metrics are present.
+	peer := `{network="wg0",peer="My Phone",public_key="peer-public-key"}`
 	expectations := []string{
 		`wg_interface_up{network="wg0"} 1`,
-		`wg_peers_total{network="wg0"}`,
-		`wg_peers_online{network="wg0"}`,
-		`wg_transfer_bytes_total{network="wg0",direction="rx"}`,
-		`wg_transfer_bytes_total{network="wg0",direction="tx"}`,
-		`wg_peer_last_handshake_seconds{network="wg0"`,
+		`wg_peers_total{network="wg0"} 1`,
+		`wg_peers_online{network="wg0"} 1`,
+		`wg_peer_online` + peer + ` 1`,
+		`wg_peer_last_handshake_seconds` + peer,
+		`# TYPE wg_poll_duration_seconds histogram`,
+		`wg_poll_duration_seconds_count 1`,
+		`wg_last_poll_timestamp_seconds `,
 	}
 	for _, exp := range expectations {
 		if !strings.Contains(body, exp) {
 			t.Errorf("expected metrics output to contain %q, got:\n%s", exp, body)
 		}
 	}
-
-	// Verify peer name appears in labels (should use DB name "My Phone").
-	if !strings.Contains(body, `peer="My Phone"`) {
-		t.Errorf("expected peer label 'My Phone' in metrics, got:\n%s", body)
-	}
 }
 
 func TestHandleMetrics_DisabledNetwork_ShowsDown(t *testing.T) {
@@ -101,31 +123,92 @@ func TestHandleMetrics_DisabledNetwork_ShowsDown(t *testing.T) {
 	if err != nil {
 		t.Fatalf("create network: %v", err)
 	}
+	pollForMetrics(t, srv)
+
+	body := scrapeMetrics(t, srv)
+	if !strings.Contains(body, `wg_interface_up{network="wg1"} 0`) {
+		t.Errorf("expected wg_interface_up=0 for disabled network, got:\n%s", body)
+	}
+}
 
+func TestHandleMetrics_NoAuth_Required(t *testing.T) {
+	srv := newTestServerForMonitoring(t)
+
+	// Metrics endpoint should work without auth.
 	req := httptest.NewRequest("GET", "/metrics", nil)
 	w := httptest.NewRecorder()
 	srv.ServeHTTP(w, req)
 
 	if w.Code != http.StatusOK {
-		t.Fatalf("expected 200, got %d", w.Code)
+		t.Errorf("expected 200 without auth, got %d: %s", w.Code, w.Body.String())
 	}
+}
+
+func TestHandleMetrics_AnonymousWithoutPeerSeries(t *testing.T) {
+	srv := newTestServerForMonitoring(t)
+	ctx := context.Background()
 
+	if _, err := srv.db.CreateNetwork(ctx, &db.Network{
+		Name: "Test VPN", Interface: "wg0", Mode: "gateway",
+		Subnet: "10.0.0.0/24", ListenPort: 51820,
+		PrivateKey: "priv", PublicKey: "pub",
+		Enabled: true,
+	}); err != nil {
+		t.Fatalf("create network: %v", err)
+	}
+	if _, err := srv.db.CreatePeer(ctx, &db.Peer{
+		NetworkID: 1, Name: "My Phone", PublicKey: "peer-public-key",
+		PrivateKey: "peer-priv", AllowedIPs: "10.0.0.2/32", Enabled: true,
+	}); err != nil {
+		t.Fatalf("create peer: %v", err)
+	}
+	pollForMetrics(t, srv)
+
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
 	body := w.Body.String()
-	if !strings.Contains(body, `wg_interface_up{network="wg1"} 0`) {
-		t.Errorf("expected wg_interface_up=0 for disabled network, got:\n%s", body)
+	if strings.Contains(body, "My Phone") || strings.Contains(body, "peer-public-key") {
+		t.Errorf("expected no per-peer series without credentials, got:\n%s", body)
+	}
+	if !strings.Contains(body, `wg_peers_online{network="wg0"} 1`) {
+		t.Errorf("expected network series without credentials, got:\n%s", body)
+	}
+
+	req = httptest.NewRequest("GET", "/metrics", nil)
+	req.AddCookie(authCookie(t, srv))
+	w = httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+	if !strings.Contains(w.Body.String(), `peer="My Phone"`) {
+		t.Errorf("expected per-peer series for a logged-in admin, got:\n%s", w.Body.String())
 	}
 }
 
-func TestHandleMetrics_NoAuth_Required(t *testing.T) {
+func TestHandleMetrics_BearerToken(t *testing.T) {
 	srv := newTestServerForMonitoring(t)
+	srv.metricsAuth = "scrape-secret"
+
+	for _, header := range []string{"", "Bearer wrong", "scrape-secret"} {
+		req := httptest.NewRequest("GET", "/metrics", nil)
+		if header != "" {
+			req.Header.Set("Authorization", header)
+		}
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, req)
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("Authorization %q: expected 401, got %d", header, w.Code)
+		}
+	}
 
-	// Metrics endpoint should work without auth.
 	req := httptest.NewRequest("GET", "/metrics", nil)
+	req.Header.Set("Authorization", "Bearer scrape-secret")
 	w := httptest.NewRecorder()
 	srv.ServeHTTP(w, req)
-
 	if w.Code != http.StatusOK {
-		t.Errorf("expected 200 without auth, got %d: %s", w.Code, w.Body.String())
+		t.Errorf("expected 200 with token, got %d", w.Code)
 	}
 }
 
@@ -142,18 +225,42 @@ func TestHandleMetrics_TransferValues(t *testing.T) {
 	if err != nil {
 		t.Fatalf("create network: %v", err)
 	}
+	_, err = srv.db.CreatePeer(ctx, &db.Peer{
+		NetworkID: 1, Name: "My Phone", PublicKey: "peer-public-key",
+		PrivateKey: "peer-priv", AllowedIPs: "10.0.0.2/32", Enabled: true,
+	})
+	if err != nil {
+		t.Fatalf("create peer: %v", err)
+	}
+	pollForMetrics(t, srv)
 
-	req := httptest.NewRequest("GET", "/metrics", nil)
-	w := httptest.NewRecorder()
-	srv.ServeHTTP(w, req)
-
-	body := w.Body.String()
+	body := scrapeMetrics(t, srv)
 
 	// Mock returns ReceiveBytes=5000, TransmitBytes=3000.
-	if !strings.Contains(body, `wg_transfer_bytes_total{network="wg0",direction="rx"} 5000`) {
+	peer := `{network="wg0",peer="My Phone",public_key="peer-public-key"}`
+	if !strings.Contains(body, "# TYPE wg_peer_receive_bytes_total counter") {
+		t.Errorf("expected per-peer counters, got:\n%s", body)
+	}
+	if !strings.Contains(body, `wg_peer_receive_bytes_total`+peer+` 5000`) {
 		t.Errorf("expected rx=5000, got:\n%s", body)
 	}
-	if !strings.Contains(body, `wg_transfer_bytes_total{network="wg0",direction="tx"} 3000`) {
+	if !strings.Contains(body, `wg_peer_transmit_bytes_total`+peer+` 3000`) {
 		t.Errorf("expected tx=3000, got:\n%s", body)
 	}
 }
+
+func TestHandleMetrics_HTTPRequests(t *testing.T) {
+	srv := newTestServerForMonitoring(t)
+
+	req := httptest.NewRequest("GET", "/api/networks/7", nil)
+	req.AddCookie(authCookie(t, srv))
+	srv.ServeHTTP(httptest.NewRecorder(), req)
+
+	body := scrapeMetrics(t, srv)
+	if !strings.Contains(body, `wgpilot_http_requests_total{method="GET",route="/api/networks/{id}",status="404"} 1`) {
+		t.Errorf("expected request counted by route pattern, got:\n%s", body)
+	}
+	if !strings.Contains(body, `wgpilot_http_request_duration_seconds_count{method="GET",route="/api/networks/{id}"} 1`) {
+		t.Errorf("expected request latency histogram, got:\n%s", body)
+	}
+}
@@ -0,0 +1,267 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/itsChris/wgpilot/internal/auth"
+	"github.com/itsChris/wgpilot/internal/db"
+	apperr "github.com/itsChris/wgpilot/internal/errors"
+)
+
+// ── Request/Response types ───────────────────────────────────────────
+
+type setNetworkRoleRequest struct {
+	Role string `json:"role"`
+}
+
+type networkRoleResponse struct {
+	NetworkID   int64    `json:"network_id"`
+	NetworkName string   `json:"network_name"`
+	Role        string   `json:"role"`
+	Permissions []string `json:"permissions"`
+	CreatedAt   int64    `json:"created_at"`
+}
+
+// ── Handlers ─────────────────────────────────────────────────────────
+
+// handleListNetworkRoles returns the roles a user holds on single networks.
+func (s *Server) handleListNetworkRoles(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	user, ok := s.userFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	roles, err := s.db.ListNetworkRoles(ctx, user.ID)
+	if err != nil {
+		s.logger.Error("list_network_roles_failed", "error", err, "component", "handler", "user_id", user.ID)
+		writeError(w, r, fmt.Errorf("failed to list network roles"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
+		return
+	}
+
+	result := make([]networkRoleResponse, 0, len(roles))
+	for _, nr := range roles {
+		resp := networkRoleResponse{
+			NetworkID: nr.NetworkID,
+			Role:      nr.Role,
+			CreatedAt: nr.CreatedAt.Unix(),
+		}
+		if network, _ := s.db.GetNetworkByID(ctx, nr.NetworkID); network != nil {
+			resp.NetworkName = network.Name
+		}
+		perms, _ := rolePermissions(ctx, s.db, nr.Role)
+		resp.Permissions = auth.ScopePermissions(perms)
+		result = append(result, resp)
+	}
+
+	writeJSON(w, http.StatusOK, result)
+}
+
+// handleSetNetworkRole gives a user a role on one network. Only the
+// role's network, peer, device, bridge and audit permissions apply there,
+// and the caller must hold them on that network.
+func (s *Server) handleSetNetworkRole(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	user, ok := s.userFromPath(w, r)
+	if !ok {
+		return
+	}
+	network, ok := s.networkFromPath(w, r, "networkID")
+	if !ok {
+		return
+	}
+
+	var req setNetworkRoleRequest
+	if code, status, err := decodeJSON(r, &req); err != nil {
+		writeError(w, r, err, code, status, s.devMode)
+		return
+	}
+
+	perms, err := rolePermissions(ctx, s.db, req.Role)
+	if err != nil {
+		s.logger.Error("get_role_failed", "error", err, "component", "handler", "role", req.Role)
+		writeError(w, r, fmt.Errorf("failed to get role"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
+		return
+	}
+	if perms == nil {
+		writeValidationError(w, r, []fieldError{{Field: "role", Message: fmt.Sprintf("unknown role %q", req.Role)}})
+		return
+	}
+	scoped := auth.ScopePermissions(perms)
+	if len(scoped) == 0 {
+		writeValidationError(w, r, []fieldError{{Field: "role", Message: fmt.Sprintf("role %q has no permissions that apply to a network", req.Role)}})
+		return
+	}
+
+	existing, err := s.db.ListNetworkRoles(ctx, user.ID)
+	if err != nil {
+		s.logger.Error("list_network_roles_failed", "error", err, "component", "handler", "user_id", user.ID)
+		writeError(w, r, fmt.Errorf("failed to set network role"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
+		return
+	}
+	// A replaced role must be the caller's to give, too.
+	i := slices.IndexFunc(existing, func(nr db.NetworkRole) bool { return nr.NetworkID == network.ID })
+	if i >= 0 && !s.canGrantRoleOnNetwork(w, r, network.ID, existing[i].Role) {
+		return
+	}
+	if !s.canGrantOnNetwork(w, r, network.ID, scoped) {
+		return
+	}
+
+	if err := s.db.SetNetworkRole(ctx, &db.NetworkRole{
+		UserID:    user.ID,
+		NetworkID: network.ID,
+		Role:      req.Role,
+	}); err != nil {
+		s.logger.Error("set_network_role_failed", "error", err, "component", "handler", "user_id", user.ID, "network_id", network.ID)
+		writeError(w, r, fmt.Errorf("failed to set network role"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
+		return
+	}
+
+	s.logger.Info("network_role_set", "user_id", user.ID, "network_id", network.ID, "role", req.Role, "component", "handler")
+	s.auditNetworkf(r, network.ID, "user.network_role_set", "user", "user %q given role %s on network %q", user.Username, req.Role, network.Name)
+
+	resp := networkRoleResponse{
+		NetworkID:   network.ID,
+		NetworkName: network.Name,
+		Role:        req.Role,
+		Permissions: scoped,
+	}
+	if roles, _ := s.db.ListNetworkRoles(ctx, user.ID); roles != nil {
+		if i := slices.IndexFunc(roles, func(nr db.NetworkRole) bool { return nr.NetworkID == network.ID }); i >= 0 {
+			resp.CreatedAt = roles[i].CreatedAt.Unix()
+		}
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// handleDeleteNetworkRole removes a user's role on one network.
+func (s *Server) handleDeleteNetworkRole(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	user, ok := s.userFromPath(w, r)
+	if !ok {
+		return
+	}
+	network, ok := s.networkFromPath(w, r, "networkID")
+	if !ok {
+		return
+	}
+
+	existing, err := s.db.ListNetworkRoles(ctx, user.ID)
+	if err != nil {
+		s.logger.Error("list_network_roles_failed", "error", err, "component", "handler", "user_id", user.ID)
+		writeError(w, r, fmt.Errorf("failed to remove network role"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
+		return
+	}
+	i := slices.IndexFunc(existing, func(nr db.NetworkRole) bool { return nr.NetworkID == network.ID })
+	if i < 0 {
+		writeError(w, r, fmt.Errorf("user %d has no role on network %d", user.ID, network.ID), apperr.ErrRoleNotFound, http.StatusNotFound, s.devMode)
+		return
+	}
+	if !s.canGrantRoleOnNetwork(w, r, network.ID, existing[i].Role) {
+		return
+	}
+
+	if _, err := s.db.DeleteNetworkRole(ctx, user.ID, network.ID); err != nil {
+		s.logger.Error("delete_network_role_failed", "error", err, "component", "handler", "user_id", user.ID, "network_id", network.ID)
+		writeError(w, r, fmt.Errorf("failed to remove network role"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
+		return
+	}
+
+	s.logger.Info("network_role_removed", "user_id", user.ID, "network_id", network.ID, "component", "handler")
+	s.auditNetworkf(r, network.ID, "user.network_role_removed", "user", "user %q lost role %s on network %q", user.Username, existing[i].Role, network.Name)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ── Helpers ──────────────────────────────────────────────────────────
+
+// visibleNetworks keeps the networks on which the caller holds perm.
+func visibleNetworks(r *http.Request, perm string, networks []db.Network) []db.Network {
+	grants := auth.GrantsFromContext(r.Context())
+	if grants == nil {
+		return networks
+	}
+	ids := grants.NetworksWith(perm)
+	if ids == nil {
+		return networks
+	}
+	visible := make([]db.Network, 0, len(ids))
+	for _, n := range networks {
+		if slices.Contains(ids, n.ID) {
+			visible = append(visible, n)
+		}
+	}
+	return visible
+}
+
+// canGrantOnNetwork checks that the caller holds every permission in perms
+// on network id. It writes a 403 and returns false otherwise.
+func (s *Server) canGrantOnNetwork(w http.ResponseWriter, r *http.Request, id int64, perms []string) bool {
+	grants := auth.GrantsFromContext(r.Context())
+	for _, p := range perms {
+		if !grants.HasOnNetwork(id, p) {
+			writeError(w, r, fmt.Errorf("cannot grant permissions you do not have"), apperr.ErrForbidden, http.StatusForbidden, s.devMode)
+			return false
+		}
+	}
+	return true
+}
+
+// canGrantRoleOnNetwork is canGrantOnNetwork for the network permissions
+// of role. Roles that no longer exist can always be taken away.
+func (s *Server) canGrantRoleOnNetwork(w http.ResponseWriter, r *http.Request, id int64, role string) bool {
+	perms, err := rolePermissions(r.Context(), s.db, role)
+	if err != nil {
+		s.logger.Error("get_role_failed", "error", err, "component", "handler", "role", role)
+		writeError(w, r, fmt.Errorf("failed to get role"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
+		return false
+	}
+	return s.canGrantOnNetwork(w, r, id, auth.ScopePermissions(perms))
+}
+
+// userFromPath loads the user whose ID is in the "id" path value.
+func (s *Server) userFromPath(w http.ResponseWriter, r *http.Request) (*db.User, bool) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("invalid user ID"), apperr.ErrValidation, http.StatusBadRequest, s.devMode)
+		return nil, false
+	}
+	user, err := s.db.GetUserByID(r.Context(), id)
+	if err != nil {
+		s.logger.Error("get_user_failed", "error", err, "component", "handler", "user_id", id)
+		writeError(w, r, fmt.Errorf("failed to get user"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
+		return nil, false
+	}
+	if user == nil {
+		writeError(w, r, fmt.Errorf("user %d not found", id), apperr.ErrValidation, http.StatusNotFound, s.devMode)
+		return nil, false
+	}
+	return user, true
+}
+
+// networkFromPath loads the network whose ID is in the pathKey path value.
+func (s *Server) networkFromPath(w http.ResponseWriter, r *http.Request, pathKey string) (*db.Network, bool) {
+	id, err := strconv.ParseInt(r.PathValue(pathKey), 10, 64)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("invalid network ID"), apperr.ErrValidation, http.StatusBadRequest, s.devMode)
+		return nil, false
+	}
+	network, err := s.db.GetNetworkByID(r.Context(), id)
+	if err != nil {
+		s.logger.Error("get_network_failed", "error", err, "component", "handler", "network_id", id)
+		writeError(w, r, fmt.Errorf("failed to get network"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
+		return nil, false
+	}
+	if network == nil {
+		writeError(w, r, fmt.Errorf("network %d not found", id), apperr.ErrNetworkNotFound, http.StatusNotFound, s.devMode)
+		return nil, false
+	}
+	return network, true
+}
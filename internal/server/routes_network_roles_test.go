@@ -0,0 +1,304 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/itsChris/wgpilot/internal/db"
+)
+
+// setupDelegation creates networks alpha, beta and gamma and a member who
+// is admin on alpha and viewer on beta.
+func setupDelegation(t *testing.T, srv *Server) (member *http.Cookie, alpha, beta, gamma int64) {
+	t.Helper()
+	ctx := context.Background()
+	ids := make([]int64, 3)
+	for i, name := range []string{"alpha", "beta", "gamma"} {
+		id, err := srv.db.CreateNetwork(ctx, &db.Network{
+			Name: name, Interface: fmt.Sprintf("wg%d", i), Mode: "gateway",
+			Subnet: fmt.Sprintf("10.%d.0.0/24", i), ListenPort: 51820 + i,
+			PrivateKey: "priv", PublicKey: "pub", Enabled: true,
+		})
+		if err != nil {
+			t.Fatalf("create network %s: %v", name, err)
+		}
+		ids[i] = id
+	}
+
+	member = loginWithRole(t, srv, "mel", "member")
+	user, err := srv.db.GetUserByUsername(ctx, "mel")
+	if err != nil || user == nil {
+		t.Fatalf("GetUserByUsername: %v", err)
+	}
+	for _, nr := range []db.NetworkRole{
+		{UserID: user.ID, NetworkID: ids[0], Role: "admin"},
+		{UserID: user.ID, NetworkID: ids[1], Role: "viewer"},
+	} {
+		if err := srv.db.SetNetworkRole(ctx, &nr); err != nil {
+			t.Fatalf("SetNetworkRole: %v", err)
+		}
+	}
+	return member, ids[0], ids[1], ids[2]
+}
+
+func TestNetworkRoles_ScopeAccess(t *testing.T) {
+	srv := newTestServerFor2FA(t)
+	member, alpha, beta, gamma := setupDelegation(t, srv)
+
+	w := sendWithCookie(t, srv, "GET", "/api/networks", member)
+	if w.Code != http.StatusOK {
+		t.Fatalf("list networks: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var networks []struct {
+		ID int64 `json:"id"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&networks); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(networks) != 2 || networks[0].ID != alpha || networks[1].ID != beta {
+		t.Errorf("expected networks %d and %d, got %+v", alpha, beta, networks)
+	}
+
+	tests := []struct {
+		method, path string
+		want         int
+	}{
+		{"GET", fmt.Sprintf("/api/networks/%d", alpha), http.StatusOK},
+		{"GET", fmt.Sprintf("/api/networks/%d", beta), http.StatusOK},
+		{"GET", fmt.Sprintf("/api/networks/%d", gamma), http.StatusForbidden},
+		// Passing the permission check leaves the handler to 404 the peer.
+		{"DELETE", fmt.Sprintf("/api/networks/%d/peers/99", alpha), http.StatusNotFound},
+		{"DELETE", fmt.Sprintf("/api/networks/%d/peers/99", beta), http.StatusForbidden},
+		{"POST", "/api/networks", http.StatusForbidden},
+		{"GET", "/api/users", http.StatusForbidden},
+		{"GET", "/api/settings", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		if w := sendWithCookie(t, srv, tt.method, tt.path, member); w.Code != tt.want {
+			t.Errorf("%s %s: expected %d, got %d: %s", tt.method, tt.path, tt.want, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestNetworkRoles_APIKey(t *testing.T) {
+	srv := newTestServerFor2FA(t)
+	member, alpha, beta, gamma := setupDelegation(t, srv)
+
+	createKey := func(body string) string {
+		t.Helper()
+		w := sendJSON(t, srv, "POST", "/api/api-keys", body, member)
+		if w.Code != http.StatusCreated {
+			t.Fatalf("create key: expected 201, got %d: %s", w.Code, w.Body.String())
+		}
+		var key createAPIKeyResponse
+		json.NewDecoder(w.Body).Decode(&key)
+		return key.Key
+	}
+
+	// The key takes the member's global role, which grants nothing on
+	// networks; the member's network roles still apply to it.
+	key := createKey(`{"name":"ci"}`)
+	readOnly := createKey(`{"name":"ro","scopes":["network:read"]}`)
+	tests := []struct {
+		name, key, method, path string
+		want                    int
+	}{
+		{"admin network", key, "GET", fmt.Sprintf("/api/networks/%d", alpha), http.StatusOK},
+		{"viewer network", key, "GET", fmt.Sprintf("/api/networks/%d", beta), http.StatusOK},
+		{"other network", key, "GET", fmt.Sprintf("/api/networks/%d", gamma), http.StatusForbidden},
+		{"admin network write", key, "DELETE", fmt.Sprintf("/api/networks/%d/peers/99", alpha), http.StatusNotFound},
+		{"viewer network write", key, "DELETE", fmt.Sprintf("/api/networks/%d/peers/99", beta), http.StatusForbidden},
+		{"global", key, "GET", "/api/users", http.StatusForbidden},
+		// Scopes still narrow the network roles.
+		{"scoped read", readOnly, "GET", fmt.Sprintf("/api/networks/%d", alpha), http.StatusOK},
+		{"scoped write", readOnly, "DELETE", fmt.Sprintf("/api/networks/%d/peers/99", alpha), http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		if w := sendWithAPIKey(t, srv, tt.method, tt.path, tt.key, ""); w.Code != tt.want {
+			t.Errorf("%s: expected %d, got %d: %s", tt.name, tt.want, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestNetworkRoles_StatusAndAuditFiltered(t *testing.T) {
+	srv := newTestServerFor2FA(t)
+	member, alpha, beta, gamma := setupDelegation(t, srv)
+	ctx := context.Background()
+
+	for _, id := range []int64{alpha, gamma, 0} {
+		if err := srv.db.InsertAuditEntry(ctx, &db.AuditEntry{
+			Action: "network.updated", Resource: "network", NetworkID: id,
+		}); err != nil {
+			t.Fatalf("InsertAuditEntry: %v", err)
+		}
+	}
+
+	w := sendWithCookie(t, srv, "GET", "/api/status", member)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var status statusResponse
+	if err := json.NewDecoder(w.Body).Decode(&status); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	var seen []int64
+	for _, n := range status.Networks {
+		seen = append(seen, n.ID)
+	}
+	if !slices.Equal(seen, []int64{alpha, beta}) {
+		t.Errorf("status: expected networks %d and %d, got %v", alpha, beta, seen)
+	}
+
+	// Only alpha grants audit:read.
+	w = sendWithCookie(t, srv, "GET", "/api/audit-log", member)
+	if w.Code != http.StatusOK {
+		t.Fatalf("audit log: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var audit auditLogResponse
+	if err := json.NewDecoder(w.Body).Decode(&audit); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if audit.Total != 1 || len(audit.Entries) != 1 || audit.Entries[0].NetworkID != alpha {
+		t.Errorf("audit log: expected the alpha entry only, got %+v", audit)
+	}
+}
+
+func TestNetworkRoles_BridgesNeedBothNetworks(t *testing.T) {
+	srv := newTestServerFor2FA(t)
+	member, alpha, beta, gamma := setupDelegation(t, srv)
+	ctx := context.Background()
+
+	body := fmt.Sprintf(`{"network_a_id":%d,"network_b_id":%d,"direction":"bidirectional"}`, alpha, beta)
+	if w := sendJSON(t, srv, "POST", "/api/bridges", body, member); w.Code != http.StatusForbidden {
+		t.Errorf("bridge to a viewed network: expected 403, got %d: %s", w.Code, w.Body.String())
+	}
+	body = fmt.Sprintf(`{"network_a_id":%d,"network_b_id":%d,"direction":"bidirectional"}`, alpha, gamma+100)
+	if w := sendJSON(t, srv, "POST", "/api/bridges", body, member); w.Code != http.StatusForbidden {
+		t.Errorf("bridge to an unknown network: expected 403, got %d: %s", w.Code, w.Body.String())
+	}
+
+	ab, err := srv.db.CreateBridge(ctx, &db.Bridge{NetworkAID: alpha, NetworkBID: beta, Direction: "bidirectional", Enabled: true})
+	if err != nil {
+		t.Fatalf("CreateBridge: %v", err)
+	}
+	ag, err := srv.db.CreateBridge(ctx, &db.Bridge{NetworkAID: alpha, NetworkBID: gamma, Direction: "bidirectional", Enabled: true})
+	if err != nil {
+		t.Fatalf("CreateBridge: %v", err)
+	}
+
+	w := sendWithCookie(t, srv, "GET", "/api/bridges", member)
+	if w.Code != http.StatusOK {
+		t.Fatalf("list bridges: expected 200, got %d", w.Code)
+	}
+	var bridges []bridgeResponse
+	if err := json.NewDecoder(w.Body).Decode(&bridges); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(bridges) != 1 || bridges[0].ID != ab {
+		t.Errorf("expected only bridge %d, got %+v", ab, bridges)
+	}
+
+	tests := []struct {
+		method, path string
+		want         int
+	}{
+		{"GET", fmt.Sprintf("/api/bridges/%d", ab), http.StatusOK},
+		{"GET", fmt.Sprintf("/api/bridges/%d", ag), http.StatusNotFound},
+		{"DELETE", fmt.Sprintf("/api/bridges/%d", ab), http.StatusForbidden},
+		{"DELETE", fmt.Sprintf("/api/bridges/%d", ag), http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		if w := sendWithCookie(t, srv, tt.method, tt.path, member); w.Code != tt.want {
+			t.Errorf("%s %s: expected %d, got %d: %s", tt.method, tt.path, tt.want, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestNetworkRoles_Assignment(t *testing.T) {
+	srv := newTestServerFor2FA(t)
+	member, alpha, beta, _ := setupDelegation(t, srv)
+	admin := loginSession(t, srv, "admin", "correctpassword")
+	user, _ := srv.db.GetUserByUsername(context.Background(), "mel")
+	base := fmt.Sprintf("/api/users/%d/networks", user.ID)
+
+	w := sendWithCookie(t, srv, "GET", base, admin)
+	if w.Code != http.StatusOK {
+		t.Fatalf("list: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var roles []networkRoleResponse
+	if err := json.NewDecoder(w.Body).Decode(&roles); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(roles) != 2 || roles[0].NetworkName != "alpha" || roles[0].Role != "admin" {
+		t.Errorf("unexpected network roles %+v", roles)
+	}
+
+	// Promote beta from viewer to admin: the member can now write there.
+	betaPath := fmt.Sprintf("%s/%d", base, beta)
+	if w := sendJSON(t, srv, "PUT", betaPath, `{"role":"admin"}`, admin); w.Code != http.StatusOK {
+		t.Fatalf("set: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := sendWithCookie(t, srv, "DELETE", fmt.Sprintf("/api/networks/%d/peers/99", beta), member); w.Code != http.StatusNotFound {
+		t.Errorf("write after promotion: expected 404, got %d", w.Code)
+	}
+
+	tests := []struct {
+		name, body string
+		want       int
+	}{
+		{"unknown role", `{"role":"nope"}`, http.StatusBadRequest},
+		{"role without network permissions", `{"role":"member"}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		if w := sendJSON(t, srv, "PUT", betaPath, tt.body, admin); w.Code != tt.want {
+			t.Errorf("%s: expected %d, got %d: %s", tt.name, tt.want, w.Code, w.Body.String())
+		}
+	}
+	if w := sendJSON(t, srv, "PUT", base+"/999", `{"role":"viewer"}`, admin); w.Code != http.StatusNotFound {
+		t.Errorf("unknown network: expected 404, got %d", w.Code)
+	}
+
+	// Members cannot hand out network roles, not even on their own network.
+	if w := sendJSON(t, srv, "PUT", fmt.Sprintf("%s/%d", base, alpha), `{"role":"viewer"}`, member); w.Code != http.StatusForbidden {
+		t.Errorf("member assigning: expected 403, got %d", w.Code)
+	}
+
+	if w := sendWithCookie(t, srv, "DELETE", betaPath, admin); w.Code != http.StatusNoContent {
+		t.Fatalf("delete: expected 204, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := sendWithCookie(t, srv, "DELETE", betaPath, admin); w.Code != http.StatusNotFound {
+		t.Errorf("delete again: expected 404, got %d", w.Code)
+	}
+	if w := sendWithCookie(t, srv, "GET", fmt.Sprintf("/api/networks/%d", beta), member); w.Code != http.StatusForbidden {
+		t.Errorf("read after removal: expected 403, got %d", w.Code)
+	}
+}
+
+func TestNetworkRoles_MetricsFiltered(t *testing.T) {
+	srv := newTestServerForMonitoring(t)
+	member, _, _, _ := setupDelegation(t, srv)
+	pollForMetrics(t, srv)
+
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	req.AddCookie(member)
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	body := w.Body.String()
+	for _, want := range []string{`wg_interface_up{network="wg0"}`, `wg_interface_up{network="wg1"}`} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected %q in metrics", want)
+		}
+	}
+	if strings.Contains(body, `network="wg2"`) {
+		t.Errorf("metrics leak network wg2:\n%s", body)
+	}
+}
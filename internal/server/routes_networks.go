@@ -5,11 +5,14 @@ import (
 	"net"
 	"net/http"
 	"regexp"
+	"slices"
 	"strconv"
 	"strings"
 
+	"github.com/itsChris/wgpilot/internal/auth"
 	"github.com/itsChris/wgpilot/internal/db"
 	apperr "github.com/itsChris/wgpilot/internal/errors"
+	"github.com/itsChris/wgpilot/internal/events"
 	"github.com/itsChris/wgpilot/internal/wg"
 )
 
@@ -30,6 +33,8 @@ type updateNetworkRequest struct {
 	DNSServers       *string `json:"dns_servers"`
 	NATEnabled       *bool   `json:"nat_enabled"`
 	InterPeerRouting *bool   `json:"inter_peer_routing"`
+	DeviceLimit      *int    `json:"device_limit"`  // devices per user in the self-service portal, 0 disables it
+	EmailConfigs     *bool   `json:"email_configs"` // email new peers their config on creation
 }
 
 type networkResponse struct {
@@ -44,6 +49,8 @@ type networkResponse struct {
 	NATEnabled       bool   `json:"nat_enabled"`
 	InterPeerRouting bool   `json:"inter_peer_routing"`
 	Enabled          bool   `json:"enabled"`
+	DeviceLimit      int    `json:"device_limit"`
+	EmailConfigs     bool   `json:"email_configs"`
 	CreatedAt        int64  `json:"created_at"`
 	UpdatedAt        int64  `json:"updated_at"`
 }
@@ -60,6 +67,8 @@ type networkListItem struct {
 	NATEnabled       bool   `json:"nat_enabled"`
 	InterPeerRouting bool   `json:"inter_peer_routing"`
 	Enabled          bool   `json:"enabled"`
+	DeviceLimit      int    `json:"device_limit"`
+	EmailConfigs     bool   `json:"email_configs"`
 	PeerCount        int    `json:"peer_count"`
 	CreatedAt        int64  `json:"created_at"`
 	UpdatedAt        int64  `json:"updated_at"`
@@ -157,6 +166,9 @@ func (s *Server) validateUpdateNetwork(req updateNetworkRequest) []fieldError {
 	if req.DNSServers != nil && !isValidDNSServers(*req.DNSServers) {
 		errs = append(errs, fieldError{"dns_servers", "must be up to 3 valid IP addresses, comma-separated"})
 	}
+	if req.DeviceLimit != nil && (*req.DeviceLimit < 0 || *req.DeviceLimit > 100) {
+		errs = append(errs, fieldError{"device_limit", "must be between 0 and 100"})
+	}
 	return errs
 }
 
@@ -280,7 +292,7 @@ func (s *Server) handleCreateNetwork(w http.ResponseWriter, r *http.Request) {
 	// Apply nftables rules.
 	if s.nftManager != nil {
 		// Open the UDP listen port in the firewall.
-		if err := s.nftManager.OpenUDPPort(req.ListenPort); err != nil {
+		if err := s.nftManager.OpenUDPPort(ctx, req.ListenPort); err != nil {
 			s.logger.Error("open_udp_port_failed",
 				"error", err,
 				"error_type", fmt.Sprintf("%T", err),
@@ -295,7 +307,7 @@ func (s *Server) handleCreateNetwork(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 		if req.NATEnabled {
-			if err := s.nftManager.AddNATMasquerade(ifaceName, req.Subnet); err != nil {
+			if err := s.nftManager.AddNATMasquerade(ctx, ifaceName, req.Subnet); err != nil {
 				s.logger.Error("add_nat_failed",
 					"error", err,
 					"error_type", fmt.Sprintf("%T", err),
@@ -312,7 +324,7 @@ func (s *Server) handleCreateNetwork(w http.ResponseWriter, r *http.Request) {
 			}
 		}
 		if req.InterPeerRouting {
-			if err := s.nftManager.EnableInterPeerForwarding(ifaceName); err != nil {
+			if err := s.nftManager.EnableInterPeerForwarding(ctx, ifaceName); err != nil {
 				s.logger.Error("enable_forwarding_failed",
 					"error", err,
 					"error_type", fmt.Sprintf("%T", err),
@@ -366,12 +378,15 @@ func (s *Server) handleCreateNetwork(w http.ResponseWriter, r *http.Request) {
 		"mode", created.Mode,
 		"component", "handler",
 	)
-	s.auditf(r, "network.created", "network", "created network %q (id=%d, iface=%s)", created.Name, id, created.Interface)
+	s.auditNetworkf(r, id, "network.created", "network", "created network %q (id=%d, iface=%s)", created.Name, id, created.Interface)
+	s.events.Publish(events.Event{Type: events.TypeNetworkCreated, NetworkID: id, Data: networkToResponse(created)})
+	s.resourceChanged(r, "network.created", "network", id, nil, networkToResponse(created))
 
 	writeJSON(w, http.StatusCreated, networkToResponse(created))
 }
 
-// handleListNetworks lists all networks with peer counts.
+// handleListNetworks lists the networks the caller may see, with peer
+// counts.
 func (s *Server) handleListNetworks(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
@@ -387,6 +402,17 @@ func (s *Server) handleListNetworks(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	networks, err = s.listableNetworks(r, networks)
+	if err != nil {
+		s.logger.Error("list_owned_networks_failed",
+			"error", err,
+			"operation", "list_networks",
+			"component", "handler",
+		)
+		writeError(w, r, fmt.Errorf("failed to list networks"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
+		return
+	}
+
 	result := make([]networkListItem, 0, len(networks))
 	for _, n := range networks {
 		peers, err := s.db.ListPeersByNetworkID(ctx, n.ID)
@@ -401,6 +427,8 @@ func (s *Server) handleListNetworks(w http.ResponseWriter, r *http.Request) {
 			writeError(w, r, fmt.Errorf("failed to list peers"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
 			return
 		}
+		// Users who only see their own devices count only those.
+		peers = slices.DeleteFunc(peers, func(p db.Peer) bool { return !canAccessPeer(r, &p, auth.PermPeerRead) })
 		result = append(result, networkListItem{
 			ID:               n.ID,
 			Name:             n.Name,
@@ -413,6 +441,8 @@ func (s *Server) handleListNetworks(w http.ResponseWriter, r *http.Request) {
 			NATEnabled:       n.NATEnabled,
 			InterPeerRouting: n.InterPeerRouting,
 			Enabled:          n.Enabled,
+			DeviceLimit:      n.DeviceLimit,
+			EmailConfigs:     n.EmailConfigs,
 			PeerCount:        len(peers),
 			CreatedAt:        n.CreatedAt.Unix(),
 			UpdatedAt:        n.UpdatedAt.Unix(),
@@ -490,6 +520,8 @@ func (s *Server) handleUpdateNetwork(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	before := networkToResponse(network)
+
 	// Apply updates.
 	if req.Name != nil {
 		network.Name = *req.Name
@@ -497,12 +529,18 @@ func (s *Server) handleUpdateNetwork(w http.ResponseWriter, r *http.Request) {
 	if req.DNSServers != nil {
 		network.DNSServers = *req.DNSServers
 	}
+	if req.DeviceLimit != nil {
+		network.DeviceLimit = *req.DeviceLimit
+	}
+	if req.EmailConfigs != nil {
+		network.EmailConfigs = *req.EmailConfigs
+	}
 
 	// Handle NAT toggle.
 	if req.NATEnabled != nil && *req.NATEnabled != network.NATEnabled {
 		if s.nftManager != nil {
 			if *req.NATEnabled {
-				if err := s.nftManager.AddNATMasquerade(network.Interface, network.Subnet); err != nil {
+				if err := s.nftManager.AddNATMasquerade(ctx, network.Interface, network.Subnet); err != nil {
 					s.logger.Error("add_nat_failed",
 						"error", err,
 						"operation", "update_network",
@@ -513,7 +551,7 @@ func (s *Server) handleUpdateNetwork(w http.ResponseWriter, r *http.Request) {
 					return
 				}
 			} else {
-				if err := s.nftManager.RemoveNATMasquerade(network.Interface); err != nil {
+				if err := s.nftManager.RemoveNATMasquerade(ctx, network.Interface); err != nil {
 					s.logger.Error("remove_nat_failed",
 						"error", err,
 						"operation", "update_network",
@@ -532,7 +570,7 @@ func (s *Server) handleUpdateNetwork(w http.ResponseWriter, r *http.Request) {
 	if req.InterPeerRouting != nil && *req.InterPeerRouting != network.InterPeerRouting {
 		if s.nftManager != nil {
 			if *req.InterPeerRouting {
-				if err := s.nftManager.EnableInterPeerForwarding(network.Interface); err != nil {
+				if err := s.nftManager.EnableInterPeerForwarding(ctx, network.Interface); err != nil {
 					s.logger.Error("enable_forwarding_failed",
 						"error", err,
 						"operation", "update_network",
@@ -543,7 +581,7 @@ func (s *Server) handleUpdateNetwork(w http.ResponseWriter, r *http.Request) {
 					return
 				}
 			} else {
-				if err := s.nftManager.DisableInterPeerForwarding(network.Interface); err != nil {
+				if err := s.nftManager.DisableInterPeerForwarding(ctx, network.Interface); err != nil {
 					s.logger.Error("disable_forwarding_failed",
 						"error", err,
 						"operation", "update_network",
@@ -588,7 +626,9 @@ func (s *Server) handleUpdateNetwork(w http.ResponseWriter, r *http.Request) {
 		"network_name", updated.Name,
 		"component", "handler",
 	)
-	s.auditf(r, "network.updated", "network", "updated network %q (id=%d)", updated.Name, id)
+	s.auditNetworkf(r, id, "network.updated", "network", "updated network %q (id=%d)", updated.Name, id)
+	s.events.Publish(events.Event{Type: events.TypeNetworkUpdated, NetworkID: id, Data: networkToResponse(updated)})
+	s.resourceChanged(r, "network.updated", "network", id, before, networkToResponse(updated))
 
 	writeJSON(w, http.StatusOK, networkToResponse(updated))
 }
@@ -620,6 +660,20 @@ func (s *Server) handleDeleteNetwork(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Collect peer IDs up front so their time series can be removed too.
+	peers, err := s.db.ListPeersByNetworkID(ctx, id)
+	if err != nil {
+		s.logger.Error("delete_network_list_peers_failed",
+			"error", err,
+			"error_type", fmt.Sprintf("%T", err),
+			"operation", "delete_network",
+			"component", "handler",
+			"network_id", id,
+		)
+		writeError(w, r, fmt.Errorf("failed to list peers"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
+		return
+	}
+
 	// Remove bridge nftables rules before DB cascade deletes them.
 	if s.nftManager != nil {
 		bridges, err := s.db.ListBridgesByNetworkID(ctx, id)
@@ -640,7 +694,7 @@ func (s *Server) handleDeleteNetwork(w http.ResponseWriter, r *http.Request) {
 				if err != nil || other == nil {
 					continue
 				}
-				if err := s.nftManager.RemoveNetworkBridge(network.Interface, other.Interface); err != nil {
+				if err := s.nftManager.RemoveNetworkBridge(ctx, network.Interface, other.Interface); err != nil {
 					s.logger.Error("remove_bridge_nft_failed",
 						"error", err,
 						"operation", "delete_network",
@@ -656,7 +710,7 @@ func (s *Server) handleDeleteNetwork(w http.ResponseWriter, r *http.Request) {
 	// Remove nftables rules.
 	if s.nftManager != nil {
 		// Close the UDP listen port in the firewall.
-		if err := s.nftManager.CloseUDPPort(network.ListenPort); err != nil {
+		if err := s.nftManager.CloseUDPPort(ctx, network.ListenPort); err != nil {
 			s.logger.Error("close_udp_port_failed",
 				"error", err,
 				"operation", "delete_network",
@@ -666,7 +720,7 @@ func (s *Server) handleDeleteNetwork(w http.ResponseWriter, r *http.Request) {
 			)
 		}
 		if network.NATEnabled {
-			if err := s.nftManager.RemoveNATMasquerade(network.Interface); err != nil {
+			if err := s.nftManager.RemoveNATMasquerade(ctx, network.Interface); err != nil {
 				s.logger.Error("remove_nat_failed",
 					"error", err,
 					"operation", "delete_network",
@@ -676,7 +730,7 @@ func (s *Server) handleDeleteNetwork(w http.ResponseWriter, r *http.Request) {
 			}
 		}
 		if network.InterPeerRouting {
-			if err := s.nftManager.DisableInterPeerForwarding(network.Interface); err != nil {
+			if err := s.nftManager.DisableInterPeerForwarding(ctx, network.Interface); err != nil {
 				s.logger.Error("disable_forwarding_failed",
 					"error", err,
 					"operation", "delete_network",
@@ -714,6 +768,10 @@ func (s *Server) handleDeleteNetwork(w http.ResponseWriter, r *http.Request) {
 		writeError(w, r, fmt.Errorf("failed to delete network"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
 		return
 	}
+	for _, p := range peers {
+		s.deletePeerTimeSeries(ctx, p.ID, "delete_network")
+		s.resourceChanged(r, "peer.deleted", "peer", p.ID, peerToResponse(&p), nil)
+	}
 
 	s.logger.Info("network_deleted",
 		"network_id", id,
@@ -721,7 +779,9 @@ func (s *Server) handleDeleteNetwork(w http.ResponseWriter, r *http.Request) {
 		"interface", network.Interface,
 		"component", "handler",
 	)
-	s.auditf(r, "network.deleted", "network", "deleted network %q (id=%d, iface=%s)", network.Name, id, network.Interface)
+	s.auditNetworkf(r, id, "network.deleted", "network", "deleted network %q (id=%d, iface=%s)", network.Name, id, network.Interface)
+	s.events.Publish(events.Event{Type: events.TypeNetworkDeleted, NetworkID: id, Data: map[string]any{"name": network.Name, "interface": network.Interface}})
+	s.resourceChanged(r, "network.deleted", "network", id, networkToResponse(network), nil)
 
 	w.WriteHeader(http.StatusNoContent)
 }
@@ -747,6 +807,8 @@ func (s *Server) handleEnableNetwork(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	before := networkToResponse(network)
+
 	if network.Enabled {
 		writeJSON(w, http.StatusOK, networkToResponse(network))
 		return
@@ -793,16 +855,16 @@ func (s *Server) handleEnableNetwork(w http.ResponseWriter, r *http.Request) {
 
 	// Restore nftables rules.
 	if s.nftManager != nil {
-		if err := s.nftManager.OpenUDPPort(network.ListenPort); err != nil {
+		if err := s.nftManager.OpenUDPPort(ctx, network.ListenPort); err != nil {
 			s.logger.Error("open_udp_port_failed", "error", err, "operation", "enable_network", "component", "handler")
 		}
 		if network.NATEnabled {
-			if err := s.nftManager.AddNATMasquerade(network.Interface, network.Subnet); err != nil {
+			if err := s.nftManager.AddNATMasquerade(ctx, network.Interface, network.Subnet); err != nil {
 				s.logger.Error("add_nat_failed", "error", err, "operation", "enable_network", "component", "handler")
 			}
 		}
 		if network.InterPeerRouting {
-			if err := s.nftManager.EnableInterPeerForwarding(network.Interface); err != nil {
+			if err := s.nftManager.EnableInterPeerForwarding(ctx, network.Interface); err != nil {
 				s.logger.Error("enable_forwarding_failed", "error", err, "operation", "enable_network", "component", "handler")
 			}
 		}
@@ -821,7 +883,9 @@ func (s *Server) handleEnableNetwork(w http.ResponseWriter, r *http.Request) {
 	}
 
 	s.logger.Info("network_enabled", "network_id", id, "network_name", network.Name, "component", "handler")
-	s.auditf(r, "network.enabled", "network", "enabled network %q (id=%d)", network.Name, id)
+	s.auditNetworkf(r, id, "network.enabled", "network", "enabled network %q (id=%d)", network.Name, id)
+	s.events.Publish(events.Event{Type: events.TypeNetworkEnabled, NetworkID: id, Data: networkToResponse(updated)})
+	s.resourceChanged(r, "network.enabled", "network", id, before, networkToResponse(updated))
 	writeJSON(w, http.StatusOK, networkToResponse(updated))
 }
 
@@ -846,6 +910,8 @@ func (s *Server) handleDisableNetwork(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	before := networkToResponse(network)
+
 	if !network.Enabled {
 		writeJSON(w, http.StatusOK, networkToResponse(network))
 		return
@@ -853,16 +919,16 @@ func (s *Server) handleDisableNetwork(w http.ResponseWriter, r *http.Request) {
 
 	// Remove nftables rules.
 	if s.nftManager != nil {
-		if err := s.nftManager.CloseUDPPort(network.ListenPort); err != nil {
+		if err := s.nftManager.CloseUDPPort(ctx, network.ListenPort); err != nil {
 			s.logger.Error("close_udp_port_failed", "error", err, "operation", "disable_network", "component", "handler")
 		}
 		if network.NATEnabled {
-			if err := s.nftManager.RemoveNATMasquerade(network.Interface); err != nil {
+			if err := s.nftManager.RemoveNATMasquerade(ctx, network.Interface); err != nil {
 				s.logger.Error("remove_nat_failed", "error", err, "operation", "disable_network", "component", "handler")
 			}
 		}
 		if network.InterPeerRouting {
-			if err := s.nftManager.DisableInterPeerForwarding(network.Interface); err != nil {
+			if err := s.nftManager.DisableInterPeerForwarding(ctx, network.Interface); err != nil {
 				s.logger.Error("disable_forwarding_failed", "error", err, "operation", "disable_network", "component", "handler")
 			}
 		}
@@ -888,7 +954,9 @@ func (s *Server) handleDisableNetwork(w http.ResponseWriter, r *http.Request) {
 	}
 
 	s.logger.Info("network_disabled", "network_id", id, "network_name", network.Name, "component", "handler")
-	s.auditf(r, "network.disabled", "network", "disabled network %q (id=%d)", network.Name, id)
+	s.auditNetworkf(r, id, "network.disabled", "network", "disabled network %q (id=%d)", network.Name, id)
+	s.events.Publish(events.Event{Type: events.TypeNetworkDisabled, NetworkID: id, Data: networkToResponse(updated)})
+	s.resourceChanged(r, "network.disabled", "network", id, before, networkToResponse(updated))
 	writeJSON(w, http.StatusOK, networkToResponse(updated))
 }
 
@@ -966,6 +1034,32 @@ func (s *Server) handleExportNetwork(w http.ResponseWriter, r *http.Request) {
 
 // ── Helpers ──────────────────────────────────────────────────────────
 
+// listableNetworks keeps the networks the caller may read, plus those where
+// they hold the device permissions and own a device or may create one.
+func (s *Server) listableNetworks(r *http.Request, networks []db.Network) ([]db.Network, error) {
+	readable := visibleNetworks(r, auth.PermNetworkRead, networks)
+	grants := auth.GrantsFromContext(r.Context())
+	if len(readable) == len(networks) || !grants.HasOnAnyNetwork(auth.PermDeviceRead) {
+		return readable, nil
+	}
+	owned, err := s.db.ListOwnedNetworkIDs(r.Context(), callerID(r))
+	if err != nil {
+		return nil, err
+	}
+	var listable []db.Network
+	for _, n := range networks {
+		switch {
+		case slices.ContainsFunc(readable, func(v db.Network) bool { return v.ID == n.ID }):
+		case !grants.HasOnNetwork(n.ID, auth.PermDeviceRead):
+			continue
+		case n.DeviceLimit == 0 && !slices.Contains(owned, n.ID):
+			continue
+		}
+		listable = append(listable, n)
+	}
+	return listable, nil
+}
+
 func networkToResponse(n *db.Network) networkResponse {
 	return networkResponse{
 		ID:               n.ID,
@@ -979,6 +1073,8 @@ func networkToResponse(n *db.Network) networkResponse {
 		NATEnabled:       n.NATEnabled,
 		InterPeerRouting: n.InterPeerRouting,
 		Enabled:          n.Enabled,
+		DeviceLimit:      n.DeviceLimit,
+		EmailConfigs:     n.EmailConfigs,
 		CreatedAt:        n.CreatedAt.Unix(),
 		UpdatedAt:        n.UpdatedAt.Unix(),
 	}
@@ -58,6 +58,7 @@ func newTestServerWithWG(t *testing.T) (*Server, *testutil.MockWireGuardControll
 
 	srv, err := New(Config{
 		DB:          database,
+		TimeSeries:  newTestTimeSeries(t),
 		Logger:      logger,
 		JWTService:  jwtSvc,
 		Sessions:    sessions,
@@ -81,7 +82,7 @@ func newTestServerWithWG(t *testing.T) (*Server, *testutil.MockWireGuardControll
 // authRequest adds a valid JWT cookie to a request.
 func authRequest(t *testing.T, srv *Server, req *http.Request) *http.Request {
 	t.Helper()
-	token, err := srv.jwtService.Generate(1, "admin", "admin")
+	token, err := adminSession(t, srv)
 	if err != nil {
 		t.Fatalf("generate token: %v", err)
 	}
@@ -547,6 +548,7 @@ func TestDeleteNetwork_CascadeDeletesPeers(t *testing.T) {
 	if err != nil {
 		t.Fatalf("create peer: %v", err)
 	}
+	recordTestTraffic(t, srv, peerID)
 
 	req := httptest.NewRequest("DELETE", fmt.Sprintf("/api/networks/%d", netID), nil)
 	req = authRequest(t, srv, req)
@@ -565,6 +567,7 @@ func TestDeleteNetwork_CascadeDeletesPeers(t *testing.T) {
 	if peer != nil {
 		t.Error("expected peer to be cascade-deleted")
 	}
+	assertNoTimeSeries(t, srv)
 }
 
 func TestCreateNetwork_InterPeerRouting(t *testing.T) {
@@ -0,0 +1,220 @@
+package server
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/itsChris/wgpilot/internal/auth"
+	"github.com/itsChris/wgpilot/internal/db"
+	apperr "github.com/itsChris/wgpilot/internal/errors"
+)
+
+type authProvidersResponse struct {
+	Password bool `json:"password"`
+	OIDC     bool `json:"oidc"`
+}
+
+// ── Handlers ─────────────────────────────────────────────────────────
+
+// handleAuthProviders tells the login page which sign-in methods to offer.
+func (s *Server) handleAuthProviders(w http.ResponseWriter, r *http.Request) {
+	sso := s.oidc.Provider != nil
+	writeJSON(w, http.StatusOK, authProvidersResponse{
+		Password: !sso || !s.oidc.DisablePasswordLogin,
+		OIDC:     sso,
+	})
+}
+
+// handleOIDCLogin starts a single sign-on login by redirecting the browser
+// to the identity provider. The login state is also kept in a cookie so the
+// callback only completes logins started by the same browser.
+func (s *Server) handleOIDCLogin(w http.ResponseWriter, r *http.Request) {
+	if s.oidc.Provider == nil {
+		writeError(w, r, fmt.Errorf("single sign-on is not configured"), apperr.ErrInternal, http.StatusNotFound, s.devMode)
+		return
+	}
+
+	authURL, state, err := s.oidc.Provider.Begin(r.Context(), s.oidcRedirectURL(r))
+	if err != nil {
+		s.logger.Error("oidc_login_begin_failed",
+			"error", err,
+			"component", "auth",
+		)
+		writeError(w, r, fmt.Errorf("identity provider is unavailable"), apperr.ErrInternal, http.StatusBadGateway, s.devMode)
+		return
+	}
+
+	s.sessions.SetLoginStateCookie(w, state, int(auth.OIDCLoginTimeout.Seconds()))
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// handleOIDCCallback completes a single sign-on login. The user is looked up
+// by the provider's subject and provisioned on first login; their role is
+// derived from the ID token on every login. Failures redirect to the login
+// page with an error code rather than rendering JSON, since this endpoint is
+// reached by a browser navigation.
+func (s *Server) handleOIDCCallback(w http.ResponseWriter, r *http.Request) {
+	if s.oidc.Provider == nil {
+		writeError(w, r, fmt.Errorf("single sign-on is not configured"), apperr.ErrInternal, http.StatusNotFound, s.devMode)
+		return
+	}
+	if !s.allowAuthAttempt(w, r) {
+		return
+	}
+	ctx := r.Context()
+	q := r.URL.Query()
+
+	cookieState := s.sessions.LoginState(r)
+	s.sessions.SetLoginStateCookie(w, "", -1)
+
+	if errCode := q.Get("error"); errCode != "" {
+		s.logger.Warn("oidc_login_failed",
+			"remote_addr", r.RemoteAddr,
+			"reason", "provider_error",
+			"error", errCode,
+			"description", q.Get("error_description"),
+			"component", "auth",
+		)
+		s.oidcLoginFailed(w, r, "sso_failed")
+		return
+	}
+	state := q.Get("state")
+	if state == "" || subtle.ConstantTimeCompare([]byte(state), []byte(cookieState)) != 1 {
+		s.logger.Warn("oidc_login_failed",
+			"remote_addr", r.RemoteAddr,
+			"reason", "state_mismatch",
+			"component", "auth",
+		)
+		s.oidcLoginFailed(w, r, "sso_failed")
+		return
+	}
+
+	claims, err := s.oidc.Provider.Finish(ctx, state, q.Get("code"))
+	if err != nil {
+		s.logger.Warn("oidc_login_failed",
+			"remote_addr", r.RemoteAddr,
+			"reason", "token_rejected",
+			"error", err,
+			"component", "auth",
+		)
+		s.oidcLoginFailed(w, r, "sso_failed")
+		return
+	}
+
+	externalID := oidcExternalID(claims)
+	username := s.oidcUsername(claims)
+	role := s.oidcRole(claims)
+	if role == "" {
+		s.logger.Warn("oidc_login_denied",
+			"user", username,
+			"remote_addr", r.RemoteAddr,
+			"reason", "no_role",
+			"component", "auth",
+		)
+		s.auditf(r, "auth.sso_denied", "user", "single sign-on user %q has no wgpilot role", username)
+		s.oidcLoginFailed(w, r, "sso_denied")
+		return
+	}
+
+	user, err := s.db.GetUserByExternalID(ctx, db.AuthSourceOIDC, externalID)
+	if err != nil {
+		s.logger.Error("auth_login_db_error",
+			"error", err,
+			"component", "auth",
+		)
+		s.oidcLoginFailed(w, r, "sso_failed")
+		return
+	}
+	if user == nil {
+		user, err = s.provisionUser(r, db.AuthSourceOIDC, username, externalID, role)
+		if err != nil {
+			s.logger.Warn("oidc_provision_failed",
+				"user", username,
+				"error", err,
+				"component", "auth",
+			)
+			s.oidcLoginFailed(w, r, "sso_conflict")
+			return
+		}
+	} else if err := s.syncUserRole(r, user, role); err != nil {
+		s.logger.Error("update_user_role_failed", "error", err, "component", "auth", "user_id", user.ID)
+		s.oidcLoginFailed(w, r, "sso_failed")
+		return
+	}
+
+	// The identity provider is responsible for second factors, so local
+	// two-factor settings do not apply to single sign-on.
+	r = r.WithContext(auth.WithUser(ctx, challengeClaims(user)))
+	if !s.startSession(w, r, user) {
+		return
+	}
+	http.Redirect(w, r, "/", http.StatusFound)
+}
+
+// ── Helpers ──────────────────────────────────────────────────────────
+
+// oidcLoginFailed sends the browser back to the login page with an error code
+// the UI can show.
+func (s *Server) oidcLoginFailed(w http.ResponseWriter, r *http.Request, code string) {
+	http.Redirect(w, r, "/login?error="+url.QueryEscape(code), http.StatusFound)
+}
+
+// oidcRedirectURL returns the configured callback URL, or one on the host
+// the login was started from.
+func (s *Server) oidcRedirectURL(r *http.Request) string {
+	if s.oidc.RedirectURL != "" {
+		return s.oidc.RedirectURL
+	}
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host + "/api/auth/oidc/callback"
+}
+
+// oidcUsername picks the local username for an ID token: the configured
+// claim, then email, then the subject.
+func (s *Server) oidcUsername(claims jwt.MapClaims) string {
+	claim := s.oidc.UsernameClaim
+	if claim == "" {
+		claim = "preferred_username"
+	}
+	for _, name := range []string{claim, "email", "sub"} {
+		if v, ok := claims[name].(string); ok && v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// oidcRole maps the groups in an ID token to a role.
+func (s *Server) oidcRole(claims jwt.MapClaims) string {
+	claim := s.oidc.GroupsClaim
+	if claim == "" {
+		claim = "groups"
+	}
+	var groups []string
+	switch v := claims[claim].(type) {
+	case string:
+		groups = []string{v}
+	case []any:
+		for _, g := range v {
+			if g, ok := g.(string); ok {
+				groups = append(groups, g)
+			}
+		}
+	}
+	return roleForGroups(groups, s.oidc.RoleMapping, s.oidc.DefaultRole)
+}
+
+// oidcExternalID identifies a single sign-on user by issuer and subject, so
+// that subjects from different providers cannot collide.
+func oidcExternalID(claims jwt.MapClaims) string {
+	iss, _ := claims["iss"].(string)
+	sub, _ := claims["sub"].(string)
+	return iss + "#" + sub
+}
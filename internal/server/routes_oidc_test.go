@@ -0,0 +1,202 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/itsChris/wgpilot/internal/auth"
+	"github.com/itsChris/wgpilot/internal/db"
+	"github.com/itsChris/wgpilot/internal/testutil"
+)
+
+func newTestServerForOIDC(t *testing.T) (*Server, *testutil.MockOIDCIssuer) {
+	t.Helper()
+	srv := newTestServerFor2FA(t)
+
+	issuer, err := testutil.NewMockOIDCIssuer("wgpilot", "s3cret")
+	if err != nil {
+		t.Fatalf("NewMockOIDCIssuer: %v", err)
+	}
+	t.Cleanup(issuer.Close)
+
+	provider, err := auth.NewOIDCProvider(auth.OIDCConfig{Issuer: issuer.URL, ClientID: "wgpilot", ClientSecret: "s3cret"})
+	if err != nil {
+		t.Fatalf("NewOIDCProvider: %v", err)
+	}
+	srv.oidc = OIDCConfig{
+		Provider:    provider,
+		RoleMapping: map[string]string{"vpn-admins": "admin", "vpn-users": "viewer"},
+	}
+	return srv, issuer
+}
+
+// ssoLogin runs the browser side of a single sign-on login: it starts the
+// login, lets the mock issuer approve it and returns the callback response.
+func ssoLogin(t *testing.T, srv *Server) *httptest.ResponseRecorder {
+	t.Helper()
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, httptest.NewRequest("GET", "/api/auth/oidc/login", nil))
+	if w.Code != http.StatusFound {
+		t.Fatalf("oidc login: expected 302, got %d: %s", w.Code, w.Body.String())
+	}
+	var stateCookie *http.Cookie
+	for _, c := range w.Result().Cookies() {
+		if c.Name == auth.LoginStateCookieName {
+			stateCookie = c
+		}
+	}
+	if stateCookie == nil {
+		t.Fatal("expected a login state cookie")
+	}
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := client.Get(w.Header().Get("Location"))
+	if err != nil {
+		t.Fatalf("authorize: %v", err)
+	}
+	resp.Body.Close()
+	callback, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil || callback.Path != "/api/auth/oidc/callback" {
+		t.Fatalf("unexpected redirect %q", resp.Header.Get("Location"))
+	}
+
+	req := httptest.NewRequest("GET", callback.RequestURI(), nil)
+	req.AddCookie(stateCookie)
+	w = httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+	return w
+}
+
+func TestOIDC_ProvisionsUser(t *testing.T) {
+	srv, issuer := newTestServerForOIDC(t)
+	issuer.SetClaims(map[string]any{"sub": "42", "preferred_username": "alice", "groups": []string{"staff", "vpn-admins"}})
+
+	w := ssoLogin(t, srv)
+	if w.Code != http.StatusFound || w.Header().Get("Location") != "/" {
+		t.Fatalf("expected redirect to /, got %d %q", w.Code, w.Header().Get("Location"))
+	}
+	cookie := sessionCookieFrom(w)
+	if cookie == nil {
+		t.Fatal("expected a session cookie")
+	}
+
+	user, err := srv.db.GetUserByUsername(context.Background(), "alice")
+	if err != nil || user == nil {
+		t.Fatalf("expected alice to be provisioned: %v", err)
+	}
+	if user.Role != "admin" || user.AuthSource != db.AuthSourceOIDC || user.ExternalID != issuer.URL+"#42" {
+		t.Errorf("unexpected user %+v", user)
+	}
+	if user.PasswordHash != "" {
+		t.Error("expected no local password")
+	}
+
+	req := httptest.NewRequest("GET", "/api/auth/me", nil)
+	req.AddCookie(cookie)
+	w = httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("me: expected 200, got %d", w.Code)
+	}
+}
+
+func TestOIDC_SyncsRoleOnLogin(t *testing.T) {
+	srv, issuer := newTestServerForOIDC(t)
+	issuer.SetClaims(map[string]any{"sub": "42", "preferred_username": "alice", "groups": "vpn-admins"})
+	ssoLogin(t, srv)
+
+	issuer.SetClaims(map[string]any{"sub": "42", "preferred_username": "alice", "groups": []string{"vpn-users"}})
+	if w := ssoLogin(t, srv); sessionCookieFrom(w) == nil {
+		t.Fatalf("expected a session cookie, got %d %q", w.Code, w.Header().Get("Location"))
+	}
+	users, _ := srv.db.ListUsers(context.Background())
+	var alice *db.User
+	for i := range users {
+		if users[i].Username == "alice" {
+			alice = &users[i]
+		}
+	}
+	if len(users) != 2 || alice == nil || alice.Role != "viewer" {
+		t.Errorf("expected alice to be demoted to viewer, got %+v", users)
+	}
+}
+
+func TestOIDC_DeniesUnmappedUser(t *testing.T) {
+	srv, issuer := newTestServerForOIDC(t)
+	issuer.SetClaims(map[string]any{"sub": "7", "preferred_username": "mallory", "groups": []string{"staff"}})
+
+	w := ssoLogin(t, srv)
+	if w.Header().Get("Location") != "/login?error=sso_denied" || sessionCookieFrom(w) != nil {
+		t.Fatalf("expected login to be denied, got %d %q", w.Code, w.Header().Get("Location"))
+	}
+	if u, _ := srv.db.GetUserByUsername(context.Background(), "mallory"); u != nil {
+		t.Error("expected no user to be provisioned")
+	}
+
+	// A default role admits users without a matching group.
+	srv.oidc.DefaultRole = "viewer"
+	if w := ssoLogin(t, srv); sessionCookieFrom(w) == nil {
+		t.Fatalf("expected a session with a default role, got %q", w.Header().Get("Location"))
+	}
+}
+
+func TestOIDC_RefusesLocalUsername(t *testing.T) {
+	srv, issuer := newTestServerForOIDC(t)
+	issuer.SetClaims(map[string]any{"sub": "1", "preferred_username": "admin", "groups": []string{"vpn-admins"}})
+
+	w := ssoLogin(t, srv)
+	if w.Header().Get("Location") != "/login?error=sso_conflict" || sessionCookieFrom(w) != nil {
+		t.Fatalf("expected the local admin not to be taken over, got %q", w.Header().Get("Location"))
+	}
+}
+
+func TestOIDC_CallbackRequiresStateCookie(t *testing.T) {
+	srv, _ := newTestServerForOIDC(t)
+
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, httptest.NewRequest("GET", "/api/auth/oidc/login", nil))
+	loc, _ := url.Parse(w.Header().Get("Location"))
+	state := loc.Query().Get("state")
+
+	// A callback without the cookie set by the login, e.g. a login started
+	// by an attacker, is rejected.
+	w = httptest.NewRecorder()
+	srv.ServeHTTP(w, httptest.NewRequest("GET", "/api/auth/oidc/callback?code=x&state="+state, nil))
+	if w.Header().Get("Location") != "/login?error=sso_failed" || sessionCookieFrom(w) != nil {
+		t.Fatalf("expected callback to fail, got %d %q", w.Code, w.Header().Get("Location"))
+	}
+}
+
+func TestOIDC_DisablePasswordLogin(t *testing.T) {
+	srv, _ := newTestServerForOIDC(t)
+
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, httptest.NewRequest("GET", "/api/auth/providers", nil))
+	var providers authProvidersResponse
+	json.NewDecoder(w.Body).Decode(&providers)
+	if !providers.Password || !providers.OIDC {
+		t.Errorf("unexpected providers %+v", providers)
+	}
+
+	srv.oidc.DisablePasswordLogin = true
+	w = postJSON(t, srv, "/api/auth/login", `{"username":"admin","password":"correctpassword"}`, nil)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("expected 403, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestOIDC_NotConfigured(t *testing.T) {
+	srv := newTestServer(t)
+
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, httptest.NewRequest("GET", "/api/auth/oidc/login", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected 404, got %d", w.Code)
+	}
+}
@@ -0,0 +1,343 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/itsChris/wgpilot/internal/auth"
+	"github.com/itsChris/wgpilot/internal/db"
+	apperr "github.com/itsChris/wgpilot/internal/errors"
+	"github.com/itsChris/wgpilot/internal/notify"
+)
+
+// passwordResetLifetime is how long an emailed reset token stays valid.
+const passwordResetLifetime = time.Hour
+
+type passwordResetRequest struct {
+	Username string `json:"username"`
+}
+
+type confirmPasswordResetRequest struct {
+	Token       string `json:"token"`
+	NewPassword string `json:"new_password"`
+}
+
+// ── Handlers ─────────────────────────────────────────────────────────
+
+// handleRequestPasswordReset emails a one-time reset token to a local user
+// with an email address. The response is the same whether or not such a
+// user exists, so that it cannot be used to discover accounts.
+func (s *Server) handleRequestPasswordReset(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if !s.allowAuthAttempt(w, r) {
+		return
+	}
+
+	var req passwordResetRequest
+	if code, status, err := decodeJSON(r, &req); err != nil {
+		writeError(w, r, err, code, status, s.devMode)
+		return
+	}
+	if req.Username == "" {
+		writeError(w, r, fmt.Errorf("username is required"), apperr.ErrValidation, http.StatusBadRequest, s.devMode)
+		return
+	}
+	if s.mailer == nil {
+		writeError(w, r, fmt.Errorf("password reset by email is not available"), apperr.ErrSMTPNotConfigured, http.StatusConflict, s.devMode)
+		return
+	}
+
+	accepted := map[string]string{"status": "if the account has an email address, a reset link has been sent"}
+
+	user, err := s.db.GetUserByUsername(ctx, req.Username)
+	if err != nil {
+		s.logger.Error("password_reset_get_user_failed", "error", err, "component", "auth")
+		writeError(w, r, fmt.Errorf("internal error"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
+		return
+	}
+	if user == nil || user.AuthSource != db.AuthSourceLocal || user.Email == "" {
+		s.logger.Warn("password_reset_not_sent",
+			"user", req.Username,
+			"remote_addr", r.RemoteAddr,
+			"component", "auth",
+		)
+		writeJSON(w, http.StatusAccepted, accepted)
+		return
+	}
+
+	token, hash, err := auth.GenerateResetToken()
+	if err != nil {
+		s.logger.Error("password_reset_token_failed", "error", err, "component", "auth")
+		writeError(w, r, fmt.Errorf("internal error"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
+		return
+	}
+	expiresAt := time.Now().Add(passwordResetLifetime)
+	if _, err := s.db.CreatePasswordResetToken(ctx, &db.PasswordResetToken{
+		UserID:      user.ID,
+		TokenHash:   hash,
+		ExpiresAt:   expiresAt,
+		RequestedIP: r.RemoteAddr,
+	}); err != nil {
+		s.logger.Error("password_reset_create_failed", "error", err, "user_id", user.ID, "component", "auth")
+		writeError(w, r, fmt.Errorf("internal error"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
+		return
+	}
+
+	// The link is only built from the configured external URL: the request
+	// Host is chosen by the caller, who may not be the account owner.
+	var resetURL string
+	if s.externalURL != "" {
+		resetURL = strings.TrimRight(s.externalURL, "/") + "/reset-password?token=" + token
+	}
+	body := notify.PasswordResetEmail(user.Username, resetURL, token, expiresAt.UTC().Format(time.RFC1123))
+
+	r = r.WithContext(auth.WithUser(ctx, challengeClaims(user)))
+	if err := s.mailer.SendWithAttachments(ctx, []string{user.Email}, "wgpilot password reset", body, nil); err != nil {
+		s.logger.Error("password_reset_email_failed", "error", err, "user_id", user.ID, "component", "auth")
+		s.auditf(r, "auth.password_reset_email_failed", "user", "password reset email for user %q failed: %v", user.Username, err)
+		writeJSON(w, http.StatusAccepted, accepted)
+		return
+	}
+
+	s.logger.Info("password_reset_requested", "user", user.Username, "remote_addr", r.RemoteAddr, "component", "auth")
+	s.auditf(r, "auth.password_reset_requested", "user", "password reset link emailed to user %q", user.Username)
+
+	writeJSON(w, http.StatusAccepted, accepted)
+}
+
+// handleConfirmPasswordReset sets a new password with an emailed reset
+// token. The token works once; the account is unlocked and all of the
+// user's sessions are revoked.
+func (s *Server) handleConfirmPasswordReset(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if !s.allowAuthAttempt(w, r) {
+		return
+	}
+
+	var req confirmPasswordResetRequest
+	if code, status, err := decodeJSON(r, &req); err != nil {
+		writeError(w, r, err, code, status, s.devMode)
+		return
+	}
+	if req.Token == "" || req.NewPassword == "" {
+		writeError(w, r, fmt.Errorf("token and new_password required"), apperr.ErrValidation, http.StatusBadRequest, s.devMode)
+		return
+	}
+
+	invalid := func() {
+		s.logger.Warn("password_reset_invalid_token", "remote_addr", r.RemoteAddr, "component", "auth")
+		writeError(w, r, fmt.Errorf("reset token is invalid or has expired"), apperr.ErrResetTokenInvalid, http.StatusBadRequest, s.devMode)
+	}
+
+	reset, err := s.db.GetPasswordResetTokenByHash(ctx, auth.HashResetToken(req.Token))
+	if err != nil {
+		s.logger.Error("password_reset_get_token_failed", "error", err, "component", "auth")
+		writeError(w, r, fmt.Errorf("internal error"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
+		return
+	}
+	if reset == nil || !reset.Usable(time.Now()) {
+		invalid()
+		return
+	}
+	user, err := s.db.GetUserByID(ctx, reset.UserID)
+	if err != nil {
+		s.logger.Error("password_reset_get_user_failed", "error", err, "user_id", reset.UserID, "component", "auth")
+		writeError(w, r, fmt.Errorf("internal error"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
+		return
+	}
+	if user == nil || user.AuthSource != db.AuthSourceLocal {
+		invalid()
+		return
+	}
+
+	// Check the password before claiming the token, so that a rejected
+	// password does not use it up.
+	if !s.checkNewPassword(w, r, user, req.NewPassword) {
+		return
+	}
+	claimed, err := s.db.UsePasswordResetToken(ctx, reset.ID)
+	if err != nil {
+		s.logger.Error("password_reset_claim_failed", "error", err, "user_id", user.ID, "component", "auth")
+		writeError(w, r, fmt.Errorf("internal error"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
+		return
+	}
+	if !claimed {
+		invalid()
+		return
+	}
+
+	if err := s.setPassword(r, user, req.NewPassword); err != nil {
+		s.logger.Error("password_reset_update_failed", "error", err, "user_id", user.ID, "component", "auth")
+		writeError(w, r, fmt.Errorf("failed to update password"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
+		return
+	}
+	if err := s.db.UnlockUser(ctx, user.ID); err != nil {
+		s.logger.Error("password_reset_unlock_failed", "error", err, "user_id", user.ID, "component", "auth")
+	}
+	if _, err := s.db.DeleteUserSessions(ctx, user.ID, ""); err != nil {
+		s.logger.Error("password_reset_revoke_sessions_failed", "error", err, "user_id", user.ID, "component", "auth")
+	}
+
+	s.logger.Info("password_reset", "user", user.Username, "user_id", user.ID, "remote_addr", r.RemoteAddr, "component", "auth")
+	r = r.WithContext(auth.WithUser(ctx, challengeClaims(user)))
+	s.auditf(r, "auth.password_reset", "user", "user %q reset their password", user.Username)
+
+	writeJSON(w, http.StatusOK, map[string]string{"status": "password reset"})
+}
+
+// handleUnlockUser clears a user's failed logins and lockout.
+func (s *Server) handleUnlockUser(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("invalid user ID"), apperr.ErrValidation, http.StatusBadRequest, s.devMode)
+		return
+	}
+
+	user, err := s.db.GetUserByID(ctx, id)
+	if err != nil {
+		s.logger.Error("get_user_failed", "error", err, "component", "handler", "user_id", id)
+		writeError(w, r, fmt.Errorf("failed to get user"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
+		return
+	}
+	if user == nil {
+		writeError(w, r, fmt.Errorf("user %d not found", id), apperr.ErrValidation, http.StatusNotFound, s.devMode)
+		return
+	}
+
+	if err := s.db.UnlockUser(ctx, id); err != nil {
+		s.logger.Error("unlock_user_failed", "error", err, "component", "handler", "user_id", id)
+		writeError(w, r, fmt.Errorf("failed to unlock user"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
+		return
+	}
+	unlocked := *user
+	unlocked.FailedLogins, unlocked.LockedUntil = 0, nil
+
+	s.logger.Info("user_unlocked", "user_id", id, "username", user.Username, "component", "handler")
+	s.auditf(r, "user.unlocked", "user", "unlocked user %q", user.Username)
+	s.resourceChanged(r, "user.updated", "user", id, userToResponse(user), userToResponse(&unlocked))
+
+	writeJSON(w, http.StatusOK, userToResponse(&unlocked))
+}
+
+// ── Helpers ──────────────────────────────────────────────────────────
+
+// checkNewPassword checks a password a user wants to set against the
+// password policy and their recent passwords. On rejection it writes the
+// error response and returns false.
+func (s *Server) checkNewPassword(w http.ResponseWriter, r *http.Request, user *db.User, password string) bool {
+	if err := s.passwords.Validate(password); err != nil {
+		writeError(w, r, err, apperr.ErrWeakPassword, http.StatusBadRequest, s.devMode)
+		return false
+	}
+	if s.passwords.History <= 0 {
+		return true
+	}
+
+	hashes, err := s.db.ListPasswordHistory(r.Context(), user.ID, s.passwords.History-1)
+	if err != nil {
+		s.logger.Error("list_password_history_failed", "error", err, "user_id", user.ID, "component", "auth")
+		writeError(w, r, fmt.Errorf("internal error"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
+		return false
+	}
+	if s.passwords.Reused(password, append([]string{user.PasswordHash}, hashes...)) {
+		err := fmt.Errorf("%w: choose one that differs from the last %d", auth.ErrPasswordReused, s.passwords.History)
+		writeError(w, r, err, apperr.ErrWeakPassword, http.StatusBadRequest, s.devMode)
+		return false
+	}
+	return true
+}
+
+// setPassword hashes and stores a user's new password, keeping enough of
+// the previous ones for the reuse check, and clears a pending forced
+// change.
+func (s *Server) setPassword(r *http.Request, user *db.User, password string) error {
+	hash, err := auth.HashPassword(password)
+	if err != nil {
+		return err
+	}
+	return s.db.UpdateUserPassword(r.Context(), user.ID, hash, max(s.passwords.History-1, 0))
+}
+
+// checkRequiredPassword checks the new password of a login for a user who
+// must change theirs: without one the login is refused with
+// PASSWORD_CHANGE_REQUIRED, otherwise it must pass the policy. It runs
+// before the last credential check so a rejected password does not use up
+// a one-time code. On failure it writes the error response and returns
+// false.
+func (s *Server) checkRequiredPassword(w http.ResponseWriter, r *http.Request, user *db.User, password string) bool {
+	if !user.MustChangePassword {
+		return true
+	}
+	if password == "" {
+		writeError(w, r, fmt.Errorf("password change required, repeat the login with new_password"), apperr.ErrPasswordChangeRequired, http.StatusForbidden, s.devMode)
+		return false
+	}
+	return s.checkNewPassword(w, r, user, password)
+}
+
+// changeRequiredPassword sets the password checked by checkRequiredPassword
+// and revokes the user's other sessions. It must only run once every
+// factor of the login has been verified. On failure it writes the error
+// response and returns false.
+func (s *Server) changeRequiredPassword(w http.ResponseWriter, r *http.Request, user *db.User, password string) bool {
+	if !user.MustChangePassword {
+		return true
+	}
+	if err := s.setPassword(r, user, password); err != nil {
+		s.logger.Error("change_password_update_failed", "error", err, "user_id", user.ID, "component", "auth")
+		writeError(w, r, fmt.Errorf("failed to update password"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
+		return false
+	}
+	if _, err := s.db.DeleteUserSessions(r.Context(), user.ID, ""); err != nil {
+		s.logger.Error("change_password_revoke_sessions_failed", "error", err, "user_id", user.ID, "component", "auth")
+	}
+	user.MustChangePassword = false
+
+	s.logger.Info("password_changed", "user", user.Username, "user_id", user.ID, "remote_addr", r.RemoteAddr, "component", "auth")
+	r = r.WithContext(auth.WithUser(r.Context(), challengeClaims(user)))
+	s.auditf(r, "auth.password_changed", "user", "user %q changed their required password", user.Username)
+	return true
+}
+
+// finishLogin completes a login once every factor has been verified: a
+// required password change is applied and the session cookie issued.
+func (s *Server) finishLogin(w http.ResponseWriter, r *http.Request, user *db.User, newPassword string) bool {
+	if !s.changeRequiredPassword(w, r, user, newPassword) {
+		return false
+	}
+	if user.FailedLogins > 0 {
+		if err := s.db.UnlockUser(r.Context(), user.ID); err != nil {
+			s.logger.Error("auth_login_db_error",
+				"error", err,
+				"component", "auth",
+			)
+		}
+	}
+	return s.startSession(w, r, user)
+}
+
+// recordFailedLogin counts a failed password or second factor against a user
+// and locks the account once the lockout threshold is reached.
+func (s *Server) recordFailedLogin(r *http.Request, user *db.User) {
+	locked, err := s.db.RecordFailedLogin(r.Context(), user.ID, s.lockout.Threshold, s.lockout.Duration)
+	if err != nil {
+		s.logger.Error("record_failed_login_failed", "error", err, "user_id", user.ID, "component", "auth")
+		return
+	}
+	if !locked {
+		return
+	}
+	s.logger.Warn("auth_account_locked",
+		"user", user.Username,
+		"remote_addr", r.RemoteAddr,
+		"duration", s.lockout.Duration.String(),
+		"component", "auth",
+	)
+	r = r.WithContext(auth.WithUser(r.Context(), challengeClaims(user)))
+	s.auditf(r, "auth.account_locked", "user", "user %q locked for %s after %d failed logins", user.Username, s.lockout.Duration, s.lockout.Threshold)
+}
@@ -0,0 +1,226 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/itsChris/wgpilot/internal/auth"
+	"github.com/itsChris/wgpilot/internal/db"
+)
+
+func TestLogin_Lockout(t *testing.T) {
+	srv := newTestServerFor2FA(t)
+	srv.lockout = LockoutConfig{Threshold: 3, Duration: time.Hour}
+	ctx := context.Background()
+	admin := loginSession(t, srv, "admin", "correctpassword")
+	createTestUser(t, srv.db, "alice", "alicepassword")
+	alice, _ := srv.db.GetUserByUsername(ctx, "alice")
+
+	for i := 0; i < 3; i++ {
+		if w := loginAs(t, srv, "alice", "wrongpassword"); w.Code != http.StatusUnauthorized {
+			t.Fatalf("failure %d: expected 401, got %d", i+1, w.Code)
+		}
+	}
+
+	// Even the right password is refused while locked, exactly like a
+	// wrong one.
+	w := loginAs(t, srv, "alice", "alicepassword")
+	if w.Code != http.StatusUnauthorized || !strings.Contains(w.Body.String(), "INVALID_CREDENTIALS") || w.Header().Get("Retry-After") != "" {
+		t.Fatalf("locked: expected 401 INVALID_CREDENTIALS, got %d: %s", w.Code, w.Body.String())
+	}
+	entries, _, err := srv.db.ListAuditLog(ctx, 10, 0, db.AuditFilter{Action: "auth.account_locked"})
+	if err != nil {
+		t.Fatalf("list audit: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("expected the lockout audited once, got %d", len(entries))
+	}
+
+	w = sendWithCookie(t, srv, "POST", fmt.Sprintf("/api/users/%d/unlock", alice.ID), admin)
+	if w.Code != http.StatusOK {
+		t.Fatalf("unlock: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var unlocked userResponse
+	if err := json.NewDecoder(w.Body).Decode(&unlocked); err != nil {
+		t.Fatalf("decode user: %v", err)
+	}
+	if unlocked.LockedUntil != nil || unlocked.FailedLogins != 0 {
+		t.Errorf("expected an unlocked user, got %+v", unlocked)
+	}
+
+	loginSession(t, srv, "alice", "alicepassword")
+}
+
+func TestLogin_MustChangePassword(t *testing.T) {
+	srv := newTestServerFor2FA(t)
+	srv.passwords = auth.PasswordPolicy{History: 2}
+	admin := loginSession(t, srv, "admin", "correctpassword")
+
+	w := sendJSON(t, srv, "POST", "/api/users", `{"username":"bob","password":"password","role":"viewer"}`, admin)
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "WEAK_PASSWORD") {
+		t.Errorf("short password: expected 400 WEAK_PASSWORD, got %d: %s", w.Code, w.Body.String())
+	}
+	w = sendJSON(t, srv, "POST", "/api/users",
+		`{"username":"bob","password":"bobpassword1","role":"viewer","email":"bob@example.com","must_change_password":true}`, admin)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create user: expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var bob userResponse
+	if err := json.NewDecoder(w.Body).Decode(&bob); err != nil {
+		t.Fatalf("decode user: %v", err)
+	}
+	if !bob.MustChangePassword || bob.Email != "bob@example.com" {
+		t.Errorf("expected a forced change and an email, got %+v", bob)
+	}
+
+	w = loginAs(t, srv, "bob", "bobpassword1")
+	if w.Code != http.StatusForbidden || !strings.Contains(w.Body.String(), "PASSWORD_CHANGE_REQUIRED") {
+		t.Fatalf("login: expected 403 PASSWORD_CHANGE_REQUIRED, got %d: %s", w.Code, w.Body.String())
+	}
+	changeOnLogin := func(newPassword string) *http.Response {
+		return postJSON(t, srv, "/api/auth/login",
+			`{"username":"bob","password":"bobpassword1","new_password":"`+newPassword+`"}`, nil).Result()
+	}
+	if resp := changeOnLogin("bobpassword1"); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("reused password: expected 400, got %d", resp.StatusCode)
+	}
+	if resp := changeOnLogin("bobpassword2"); resp.StatusCode != http.StatusOK {
+		t.Fatalf("change on login: expected 200, got %d", resp.StatusCode)
+	}
+	session := loginSession(t, srv, "bob", "bobpassword2")
+
+	// The previous password is still remembered.
+	w = sendJSON(t, srv, "PUT", "/api/auth/password", `{"old_password":"bobpassword2","new_password":"bobpassword1"}`, session)
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "WEAK_PASSWORD") {
+		t.Errorf("reused password: expected 400 WEAK_PASSWORD, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := sendJSON(t, srv, "PUT", "/api/auth/password", `{"old_password":"bobpassword2","new_password":"bobpassword3"}`, session); w.Code != http.StatusOK {
+		t.Errorf("change password: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// Admins can require another change.
+	if w := sendJSON(t, srv, "PUT", fmt.Sprintf("/api/users/%d", bob.ID), `{"must_change_password":true}`, admin); w.Code != http.StatusOK {
+		t.Fatalf("require change: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := loginAs(t, srv, "bob", "bobpassword3"); w.Code != http.StatusForbidden {
+		t.Errorf("login: expected 403, got %d", w.Code)
+	}
+}
+
+func TestLogin_MustChangePasswordAfterSecondFactor(t *testing.T) {
+	srv := newTestServerFor2FA(t)
+	ctx := context.Background()
+	_, codes := enroll2FA(t, srv)
+	session := authCookie(t, srv)
+	if err := srv.db.SetPasswordChangeRequired(ctx, 1, true); err != nil {
+		t.Fatalf("SetPasswordChangeRequired: %v", err)
+	}
+
+	// The password alone only gets a challenge, even with new_password.
+	w := postJSON(t, srv, "/api/auth/login",
+		`{"username":"admin","password":"correctpassword","new_password":"newpassword1"}`, nil)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("login: expected 202, got %d: %s", w.Code, w.Body.String())
+	}
+	var challenge twoFactorChallengeResponse
+	if err := json.NewDecoder(w.Body).Decode(&challenge); err != nil {
+		t.Fatalf("decode challenge: %v", err)
+	}
+	if !challenge.PasswordChangeRequired {
+		t.Errorf("expected the challenge to ask for a new password, got %+v", challenge)
+	}
+	if w := sendWithCookie(t, srv, "GET", "/api/auth/me", session); w.Code != http.StatusOK {
+		t.Errorf("existing session: expected 200 before the second factor, got %d", w.Code)
+	}
+
+	// Without new_password the recovery code is not used up.
+	body := `{"challenge_token":"` + challenge.ChallengeToken + `","recovery_code":"` + codes[0] + `"`
+	if w := postJSON(t, srv, "/api/auth/login/2fa", body+`}`, nil); w.Code != http.StatusForbidden {
+		t.Fatalf("no new password: expected 403, got %d: %s", w.Code, w.Body.String())
+	}
+	w = postJSON(t, srv, "/api/auth/login/2fa", body+`,"new_password":"newpassword1"}`, nil)
+	if w.Code != http.StatusOK || sessionCookieFrom(w) == nil {
+		t.Fatalf("second factor: expected 200 with a session, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := sendWithCookie(t, srv, "GET", "/api/auth/me", session); w.Code != http.StatusUnauthorized {
+		t.Errorf("old session: expected 401, got %d", w.Code)
+	}
+	if w := loginAs(t, srv, "admin", "newpassword1"); w.Code != http.StatusAccepted {
+		t.Errorf("login with new password: expected 202, got %d", w.Code)
+	}
+}
+
+func TestPasswordReset(t *testing.T) {
+	srv := newTestServerFor2FA(t)
+	ctx := context.Background()
+	createTestUser(t, srv.db, "alice", "alicepassword")
+	alice, _ := srv.db.GetUserByUsername(ctx, "alice")
+	if err := srv.db.UpdateUserEmail(ctx, alice.ID, "alice@example.com"); err != nil {
+		t.Fatalf("UpdateUserEmail: %v", err)
+	}
+	session := loginSession(t, srv, "alice", "alicepassword")
+	if _, err := srv.db.RecordFailedLogin(ctx, alice.ID, 1, time.Hour); err != nil {
+		t.Fatalf("RecordFailedLogin: %v", err)
+	}
+
+	if w := postJSON(t, srv, "/api/auth/password-reset", `{"username":"alice"}`, nil); w.Code != http.StatusConflict {
+		t.Errorf("no mailer: expected 409, got %d", w.Code)
+	}
+	mailer := &mockMailer{}
+	srv.mailer = mailer
+	srv.externalURL = "https://vpn.example.com/"
+
+	// Unknown users get the same answer but no email.
+	if w := postJSON(t, srv, "/api/auth/password-reset", `{"username":"mallory"}`, nil); w.Code != http.StatusAccepted {
+		t.Errorf("unknown user: expected 202, got %d", w.Code)
+	}
+	if w := postJSON(t, srv, "/api/auth/password-reset", `{"username":"alice"}`, nil); w.Code != http.StatusAccepted {
+		t.Fatalf("request: expected 202, got %d: %s", w.Code, w.Body.String())
+	}
+	if len(mailer.to) != 1 || mailer.to[0][0] != "alice@example.com" {
+		t.Fatalf("expected one email to alice@example.com, got %v", mailer.to)
+	}
+	token := regexp.MustCompile(`wgr_[0-9a-f]{64}`).FindString(mailer.bodies[0])
+	if token == "" {
+		t.Fatalf("expected a reset token in the email, got %s", mailer.bodies[0])
+	}
+	// The link uses the configured URL, never the request Host.
+	if !strings.Contains(mailer.bodies[0], "https://vpn.example.com/reset-password?token="+token) ||
+		strings.Contains(mailer.bodies[0], "://example.com") {
+		t.Errorf("expected a link on the external URL, got %s", mailer.bodies[0])
+	}
+
+	confirm := func(password string) *http.Response {
+		return postJSON(t, srv, "/api/auth/password-reset/confirm",
+			`{"token":"`+token+`","new_password":"`+password+`"}`, nil).Result()
+	}
+	if resp := confirm("short"); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("weak password: expected 400, got %d", resp.StatusCode)
+	}
+	if resp := confirm("alicepassword2"); resp.StatusCode != http.StatusOK {
+		t.Fatalf("confirm: expected 200, got %d", resp.StatusCode)
+	}
+	if resp := confirm("alicepassword3"); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("reused token: expected 400, got %d", resp.StatusCode)
+	}
+
+	// Old sessions are revoked and the account is unlocked.
+	if w := sendWithCookie(t, srv, "GET", "/api/auth/me", session); w.Code != http.StatusUnauthorized {
+		t.Errorf("old session: expected 401, got %d", w.Code)
+	}
+	loginSession(t, srv, "alice", "alicepassword2")
+
+	entries, _, err := srv.db.ListAuditLog(ctx, 10, 0, db.AuditFilter{Action: "auth.password_reset"})
+	if err != nil {
+		t.Fatalf("list audit: %v", err)
+	}
+	if len(entries) != 1 || entries[0].UserID != alice.ID {
+		t.Errorf("expected the reset audited for alice, got %+v", entries)
+	}
+}
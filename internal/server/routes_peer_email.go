@@ -0,0 +1,146 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/itsChris/wgpilot/internal/auth"
+	"github.com/itsChris/wgpilot/internal/db"
+	apperr "github.com/itsChris/wgpilot/internal/errors"
+	"github.com/itsChris/wgpilot/internal/notify"
+	"github.com/itsChris/wgpilot/internal/wg"
+)
+
+// handleSendPeerConfig emails a peer its client config, attached as a .conf
+// file and inline as a QR code, at the peer's email address.
+func (s *Server) handleSendPeerConfig(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	networkID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("invalid network ID"), apperr.ErrValidation, http.StatusBadRequest, s.devMode)
+		return
+	}
+
+	peerID, err := strconv.ParseInt(r.PathValue("pid"), 10, 64)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("invalid peer ID"), apperr.ErrValidation, http.StatusBadRequest, s.devMode)
+		return
+	}
+
+	peer, err := s.db.GetPeerByID(ctx, peerID)
+	if err != nil {
+		s.logger.Error("get_peer_failed",
+			"error", err,
+			"operation", "send_peer_config",
+			"component", "handler",
+			"peer_id", peerID,
+		)
+		writeError(w, r, fmt.Errorf("failed to get peer"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
+		return
+	}
+	if peer == nil || peer.NetworkID != networkID || !canAccessPeer(r, peer, auth.PermPeerWrite) {
+		writeError(w, r, fmt.Errorf("peer %d not found in network %d", peerID, networkID), apperr.ErrPeerNotFound, http.StatusNotFound, s.devMode)
+		return
+	}
+	if peer.Email == "" {
+		writeValidationError(w, r, []fieldError{{Field: "email", Message: "peer has no email address"}})
+		return
+	}
+	if peer.PrivateKey == "" {
+		writeError(w, r, fmt.Errorf("peer %d enrolled with its own key; the server has no config to send", peerID), apperr.ErrPrivateKeyUnavailable, http.StatusConflict, s.devMode)
+		return
+	}
+
+	network, err := s.db.GetNetworkByID(ctx, networkID)
+	if err != nil || network == nil {
+		writeError(w, r, fmt.Errorf("network %d not found", networkID), apperr.ErrNetworkNotFound, http.StatusNotFound, s.devMode)
+		return
+	}
+
+	if err := s.emailPeerConfig(r, network, peer); err != nil {
+		if errors.Is(err, notify.ErrNotConfigured) {
+			writeError(w, r, fmt.Errorf("email is not configured; set the SMTP settings first"), apperr.ErrSMTPNotConfigured, http.StatusConflict, s.devMode)
+			return
+		}
+		writeError(w, r, fmt.Errorf("failed to send config email"), apperr.ErrEmailSendFailed, http.StatusBadGateway, s.devMode)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// emailPeerConfig sends peer its client config using the
+// peer_config_email_* templates. Both delivery and failure are logged and
+// recorded in the audit log.
+func (s *Server) emailPeerConfig(r *http.Request, network *db.Network, peer *db.Peer) error {
+	err := s.sendPeerConfig(r, network, peer)
+	if err != nil {
+		s.logger.Warn("peer_config_email_failed",
+			"error", err,
+			"error_type", fmt.Sprintf("%T", err),
+			"operation", "email_peer_config",
+			"component", "handler",
+			"peer_id", peer.ID,
+		)
+		s.auditNetworkf(r, network.ID, "peer.config_email_failed", "peer", "failed to email config of peer %q (id=%d) to %s: %v", peer.Name, peer.ID, peer.Email, err)
+		return err
+	}
+
+	s.logger.Info("peer_config_emailed",
+		"peer_id", peer.ID,
+		"network_id", network.ID,
+		"component", "handler",
+	)
+	s.auditNetworkf(r, network.ID, "peer.config_emailed", "peer", "emailed config of peer %q (id=%d) to %s", peer.Name, peer.ID, peer.Email)
+	return nil
+}
+
+func (s *Server) sendPeerConfig(r *http.Request, network *db.Network, peer *db.Peer) error {
+	ctx := r.Context()
+
+	if s.mailer == nil {
+		return notify.ErrNotConfigured
+	}
+
+	conf, err := s.peerClientConfig(ctx, network, peer, "email_peer_config")
+	if err != nil {
+		return fmt.Errorf("generate config: %w", err)
+	}
+	png, err := wg.GenerateQRCode(conf, 256)
+	if err != nil {
+		return fmt.Errorf("generate QR code: %w", err)
+	}
+
+	settings, err := s.db.ListSettings(ctx)
+	if err != nil {
+		return fmt.Errorf("load email templates: %w", err)
+	}
+	filename := fmt.Sprintf("wgpilot-%s.conf", safeFilename(peer.Name))
+	subject, body, err := notify.PeerConfigEmail(settings["peer_config_email_subject"], settings["peer_config_email_body"], notify.PeerConfigData{
+		PeerName:    peer.Name,
+		NetworkName: network.Name,
+		Address:     peer.AllowedIPs,
+		Filename:    filename,
+	})
+	if err != nil {
+		return err
+	}
+
+	return s.mailer.SendWithAttachments(ctx, []string{peer.Email}, subject, body, []notify.Attachment{
+		{
+			Filename:    "wgpilot-qr.png",
+			ContentType: "image/png",
+			Data:        png,
+			Inline:      true,
+			ContentID:   notify.PeerConfigQRContentID,
+		},
+		{
+			Filename:    filename,
+			ContentType: "text/plain; charset=utf-8",
+			Data:        []byte(conf),
+		},
+	})
+}
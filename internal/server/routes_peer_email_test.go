@@ -0,0 +1,153 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/itsChris/wgpilot/internal/auth"
+	"github.com/itsChris/wgpilot/internal/db"
+	"github.com/itsChris/wgpilot/internal/notify"
+)
+
+type mockMailer struct {
+	mu          sync.Mutex
+	err         error
+	to          [][]string
+	subjects    []string
+	bodies      []string
+	attachments [][]notify.Attachment
+}
+
+func (m *mockMailer) SendWithAttachments(ctx context.Context, to []string, subject, body string, attachments []notify.Attachment) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.err != nil {
+		return m.err
+	}
+	m.to = append(m.to, to)
+	m.subjects = append(m.subjects, subject)
+	m.bodies = append(m.bodies, body)
+	m.attachments = append(m.attachments, attachments)
+	return nil
+}
+
+func TestSendPeerConfig(t *testing.T) {
+	srv, _, _ := newTestServerWithWG(t)
+	mailer := &mockMailer{}
+	srv.mailer = mailer
+	netID := createTestNetwork(t, srv)
+	ctx := context.Background()
+
+	token, err := adminSession(t, srv)
+	if err != nil {
+		t.Fatalf("admin session: %v", err)
+	}
+	admin := &http.Cookie{Name: auth.CookieName, Value: token}
+	peers := fmt.Sprintf("/api/networks/%d/peers", netID)
+
+	w := sendJSON(t, srv, "POST", peers, `{"name":"Laptop","email":"alice@example.com","role":"client"}`, admin)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create: expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var laptop peerResponse
+	if err := json.NewDecoder(w.Body).Decode(&laptop); err != nil {
+		t.Fatalf("decode peer: %v", err)
+	}
+	if len(mailer.to) != 0 {
+		t.Fatalf("expected no email while the network does not send configs, got %d", len(mailer.to))
+	}
+
+	sendConfig := fmt.Sprintf("%s/%d/send-config", peers, laptop.ID)
+	if w := sendWithCookie(t, srv, "POST", sendConfig, admin); w.Code != http.StatusNoContent {
+		t.Fatalf("send config: expected 204, got %d: %s", w.Code, w.Body.String())
+	}
+	if len(mailer.to) != 1 || mailer.to[0][0] != "alice@example.com" {
+		t.Fatalf("expected one email to alice@example.com, got %v", mailer.to)
+	}
+	if got := mailer.attachments[0]; len(got) != 2 || !got[0].Inline || got[0].ContentType != "image/png" ||
+		got[1].Filename != "wgpilot-Laptop.conf" || !strings.Contains(string(got[1].Data), "[Interface]") {
+		t.Errorf("expected an inline QR code and the config attached, got %+v", got)
+	}
+
+	// Custom templates are used, and broken ones are rejected.
+	if w := sendJSON(t, srv, "PUT", "/api/settings", `{"peer_config_email_body":"{{.Nope}}"}`, admin); w.Code != http.StatusBadRequest {
+		t.Errorf("broken template: expected 400, got %d", w.Code)
+	}
+	if w := sendJSON(t, srv, "PUT", "/api/settings", `{"peer_config_email_subject":"VPN access: {{.PeerName}}"}`, admin); w.Code != http.StatusOK {
+		t.Fatalf("set template: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// Networks can send configs to new peers automatically.
+	if w := sendJSON(t, srv, "PUT", fmt.Sprintf("/api/networks/%d", netID), `{"email_configs":true}`, admin); w.Code != http.StatusOK {
+		t.Fatalf("enable email: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := sendJSON(t, srv, "POST", peers, `{"name":"Phone","email":"bob@example.com","role":"client"}`, admin); w.Code != http.StatusCreated {
+		t.Fatalf("create: expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	if len(mailer.subjects) != 2 || mailer.subjects[1] != "VPN access: Phone" {
+		t.Errorf("expected an email on creation with the custom subject, got %v", mailer.subjects)
+	}
+
+	// A failed delivery does not fail the creation but is audited.
+	mailer.err = errors.New("connection refused")
+	if w := sendJSON(t, srv, "POST", peers, `{"name":"Tablet","email":"carol@example.com","role":"client"}`, admin); w.Code != http.StatusCreated {
+		t.Fatalf("create: expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := sendWithCookie(t, srv, "POST", sendConfig, admin); w.Code != http.StatusBadGateway {
+		t.Errorf("failed send: expected 502, got %d", w.Code)
+	}
+
+	sent, _, err := srv.db.ListAuditLog(ctx, 10, 0, db.AuditFilter{Action: "peer.config_emailed"})
+	if err != nil {
+		t.Fatalf("list audit: %v", err)
+	}
+	failed, _, err := srv.db.ListAuditLog(ctx, 10, 0, db.AuditFilter{Action: "peer.config_email_failed"})
+	if err != nil {
+		t.Fatalf("list audit: %v", err)
+	}
+	if len(sent) != 2 || len(failed) != 2 {
+		t.Errorf("expected 2 delivered and 2 failed audit entries, got %d and %d", len(sent), len(failed))
+	}
+}
+
+func TestSendPeerConfig_Errors(t *testing.T) {
+	srv, _, _ := newTestServerWithWG(t)
+	netID := createTestNetwork(t, srv)
+	ctx := context.Background()
+
+	token, err := adminSession(t, srv)
+	if err != nil {
+		t.Fatalf("admin session: %v", err)
+	}
+	admin := &http.Cookie{Name: auth.CookieName, Value: token}
+
+	noEmail, err := srv.db.CreatePeer(ctx, &db.Peer{
+		NetworkID: netID, Name: "Printer", PrivateKey: "priv", PublicKey: "pub-1",
+		AllowedIPs: "10.0.0.2/32", Role: "client", Enabled: true,
+	})
+	if err != nil {
+		t.Fatalf("create peer: %v", err)
+	}
+	withEmail, err := srv.db.CreatePeer(ctx, &db.Peer{
+		NetworkID: netID, Name: "Laptop", Email: "alice@example.com", PrivateKey: "priv", PublicKey: "pub-2",
+		AllowedIPs: "10.0.0.3/32", Role: "client", Enabled: true,
+	})
+	if err != nil {
+		t.Fatalf("create peer: %v", err)
+	}
+
+	path := func(id int64) string { return fmt.Sprintf("/api/networks/%d/peers/%d/send-config", netID, id) }
+	if w := sendWithCookie(t, srv, "POST", path(noEmail), admin); w.Code != http.StatusBadRequest {
+		t.Errorf("no email: expected 400, got %d", w.Code)
+	}
+	w := sendWithCookie(t, srv, "POST", path(withEmail), admin)
+	if w.Code != http.StatusConflict || !strings.Contains(w.Body.String(), "SMTP_NOT_CONFIGURED") {
+		t.Errorf("no mailer: expected 409 SMTP_NOT_CONFIGURED, got %d: %s", w.Code, w.Body.String())
+	}
+}
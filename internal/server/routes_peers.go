@@ -1,6 +1,7 @@
 package server
 
 import (
+	"context"
 	"fmt"
 	"net"
 	"net/http"
@@ -8,8 +9,11 @@ import (
 	"strings"
 	"time"
 
+	"github.com/itsChris/wgpilot/internal/auth"
 	"github.com/itsChris/wgpilot/internal/db"
 	apperr "github.com/itsChris/wgpilot/internal/errors"
+	"github.com/itsChris/wgpilot/internal/events"
+	"github.com/itsChris/wgpilot/internal/geoip"
 	"github.com/itsChris/wgpilot/internal/wg"
 )
 
@@ -21,7 +25,12 @@ type createPeerRequest struct {
 	Role                string `json:"role"`
 	PersistentKeepalive int    `json:"persistent_keepalive"`
 	SiteNetworks        string `json:"site_networks"`
-	ExpiresIn           string `json:"expires_in"` // duration string, e.g. "720h" for 30 days
+	ExpiresIn           string `json:"expires_in"`        // duration string, e.g. "720h" for 30 days
+	QuotaBytes          int64  `json:"quota_bytes"`       // monthly rx+tx limit, 0 for unlimited
+	QuotaResetDay       int    `json:"quota_reset_day"`   // day of month the cycle starts (1-28)
+	QuotaAction         string `json:"quota_action"`      // "disable" (default) or "throttle"
+	AllowedCountries    string `json:"allowed_countries"` // comma-separated ISO codes, empty allows any
+	OwnerID             int64  `json:"owner_id"`          // user who owns the device, 0 for none
 }
 
 type updatePeerRequest struct {
@@ -31,6 +40,11 @@ type updatePeerRequest struct {
 	PersistentKeepalive *int    `json:"persistent_keepalive"`
 	Endpoint            *string `json:"endpoint"`
 	ExpiresIn           *string `json:"expires_in"` // duration string, empty string to clear
+	QuotaBytes          *int64  `json:"quota_bytes"`
+	QuotaResetDay       *int    `json:"quota_reset_day"`
+	QuotaAction         *string `json:"quota_action"`
+	AllowedCountries    *string `json:"allowed_countries"`
+	OwnerID             *int64  `json:"owner_id"` // 0 to clear
 }
 
 type peerResponse struct {
@@ -50,8 +64,30 @@ type peerResponse struct {
 	TransferRx          int64  `json:"transfer_rx"`
 	TransferTx          int64  `json:"transfer_tx"`
 	ExpiresAt           *int64 `json:"expires_at"`
+	QuotaBytes          int64  `json:"quota_bytes"`
+	QuotaResetDay       int    `json:"quota_reset_day"`
+	QuotaAction         string `json:"quota_action"`
+	AllowedCountries    string `json:"allowed_countries"`
+	OwnerID             *int64 `json:"owner_id"`
 	CreatedAt           int64  `json:"created_at"`
 	UpdatedAt           int64  `json:"updated_at"`
+
+	// Live remote address and its GeoIP location, set when listing peers.
+	RemoteEndpoint string            `json:"remote_endpoint,omitempty"`
+	Location       *locationResponse `json:"location,omitempty"`
+}
+
+// peerDetailResponse is returned for a single peer and adds its recent
+// endpoint roaming history.
+type peerDetailResponse struct {
+	peerResponse
+	EndpointHistory []endpointHistoryEntry `json:"endpoint_history"`
+}
+
+type endpointHistoryEntry struct {
+	Timestamp int64             `json:"timestamp"`
+	Endpoint  string            `json:"endpoint"`
+	Location  *locationResponse `json:"location,omitempty"`
 }
 
 // ── Validation ───────────────────────────────────────────────────────
@@ -111,6 +147,23 @@ func isValidSiteNetworks(s string) bool {
 	return true
 }
 
+// isValidCountries reports whether s is a comma-separated list of ISO
+// country codes (or empty).
+func isValidCountries(s string) bool {
+	_, err := geoip.ParseCountries(s)
+	return err == nil
+}
+
+// normalizeCountries upper-cases and trims a validated country list.
+func normalizeCountries(s string) string {
+	codes, _ := geoip.ParseCountries(s)
+	return strings.Join(codes, ",")
+}
+
+func isValidQuotaAction(action string) bool {
+	return action == db.QuotaActionDisable || action == db.QuotaActionThrottle
+}
+
 func (s *Server) validateCreatePeer(req createPeerRequest) []fieldError {
 	var errs []fieldError
 	if !isValidName(req.Name) {
@@ -128,6 +181,44 @@ func (s *Server) validateCreatePeer(req createPeerRequest) []fieldError {
 	if req.Role == "site-gateway" && !isValidSiteNetworks(req.SiteNetworks) {
 		errs = append(errs, fieldError{"site_networks", "must be valid CIDRs, comma-separated"})
 	}
+	if req.QuotaBytes < 0 {
+		errs = append(errs, fieldError{"quota_bytes", "must be zero (unlimited) or positive"})
+	}
+	if req.QuotaResetDay != 0 && (req.QuotaResetDay < 1 || req.QuotaResetDay > 28) {
+		errs = append(errs, fieldError{"quota_reset_day", "must be between 1 and 28"})
+	}
+	if req.QuotaAction != "" && !isValidQuotaAction(req.QuotaAction) {
+		errs = append(errs, fieldError{"quota_action", "must be disable or throttle"})
+	}
+	if !isValidCountries(req.AllowedCountries) {
+		errs = append(errs, fieldError{"allowed_countries", "must be two-letter ISO country codes, comma-separated"})
+	}
+	return errs
+}
+
+// validateSelfServicePeer rejects the settings only administrators may
+// choose for a device created in the self-service portal.
+func validateSelfServicePeer(req createPeerRequest) []fieldError {
+	const msg = "only administrators can set this"
+	var errs []fieldError
+	if req.Role != "client" {
+		errs = append(errs, fieldError{"role", "self-service devices must be clients"})
+	}
+	if req.SiteNetworks != "" {
+		errs = append(errs, fieldError{"site_networks", msg})
+	}
+	if req.ExpiresIn != "" {
+		errs = append(errs, fieldError{"expires_in", msg})
+	}
+	if req.QuotaBytes != 0 || req.QuotaResetDay != 0 || req.QuotaAction != "" {
+		errs = append(errs, fieldError{"quota_bytes", msg})
+	}
+	if req.AllowedCountries != "" {
+		errs = append(errs, fieldError{"allowed_countries", msg})
+	}
+	if req.OwnerID != 0 {
+		errs = append(errs, fieldError{"owner_id", msg})
+	}
 	return errs
 }
 
@@ -145,6 +236,18 @@ func (s *Server) validateUpdatePeer(req updatePeerRequest) []fieldError {
 	if req.Endpoint != nil && !isValidEndpoint(*req.Endpoint) {
 		errs = append(errs, fieldError{"endpoint", "must be a valid host:port"})
 	}
+	if req.QuotaBytes != nil && *req.QuotaBytes < 0 {
+		errs = append(errs, fieldError{"quota_bytes", "must be zero (unlimited) or positive"})
+	}
+	if req.QuotaResetDay != nil && (*req.QuotaResetDay < 1 || *req.QuotaResetDay > 28) {
+		errs = append(errs, fieldError{"quota_reset_day", "must be between 1 and 28"})
+	}
+	if req.QuotaAction != nil && !isValidQuotaAction(*req.QuotaAction) {
+		errs = append(errs, fieldError{"quota_action", "must be disable or throttle"})
+	}
+	if req.AllowedCountries != nil && !isValidCountries(*req.AllowedCountries) {
+		errs = append(errs, fieldError{"allowed_countries", "must be two-letter ISO country codes, comma-separated"})
+	}
 	return errs
 }
 
@@ -166,7 +269,18 @@ func (s *Server) handleCreatePeer(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if errs := s.validateCreatePeer(req); len(errs) > 0 {
+	// Callers who only hold the device permissions create a client device
+	// of their own.
+	selfService := !managesPeers(r, networkID, auth.PermPeerWrite)
+	if selfService && req.Role == "" {
+		req.Role = "client"
+	}
+
+	errs := s.validateCreatePeer(req)
+	if selfService {
+		errs = append(errs, validateSelfServicePeer(req)...)
+	}
+	if len(errs) > 0 {
 		writeValidationError(w, r, errs)
 		return
 	}
@@ -189,6 +303,63 @@ func (s *Server) handleCreatePeer(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	ownerID := req.OwnerID
+	if selfService {
+		ownerID = callerID(r)
+		if !s.withinDeviceLimit(w, r, network, ownerID) {
+			return
+		}
+	} else if !s.validOwner(w, r, ownerID) {
+		return
+	}
+
+	// Parse expiry.
+	var expiresAt *time.Time
+	if req.ExpiresIn != "" {
+		d, err := time.ParseDuration(req.ExpiresIn)
+		if err != nil {
+			writeValidationError(w, r, []fieldError{{Field: "expires_in", Message: "invalid duration format (e.g. '720h')"}})
+			return
+		}
+		t := time.Now().Add(d)
+		expiresAt = &t
+	}
+
+	created, ok := s.provisionPeer(w, r, network, &db.Peer{
+		NetworkID:           networkID,
+		Name:                req.Name,
+		Email:               req.Email,
+		PersistentKeepalive: req.PersistentKeepalive,
+		Role:                req.Role,
+		SiteNetworks:        req.SiteNetworks,
+		Enabled:             true,
+		ExpiresAt:           expiresAt,
+		QuotaBytes:          req.QuotaBytes,
+		QuotaResetDay:       req.QuotaResetDay,
+		QuotaAction:         req.QuotaAction,
+		AllowedCountries:    normalizeCountries(req.AllowedCountries),
+		OwnerID:             ownerID,
+	})
+	if !ok {
+		return
+	}
+
+	// A failed email is logged and audited but does not fail the creation.
+	if network.EmailConfigs && created.Email != "" {
+		s.emailPeerConfig(r, network, created)
+	}
+
+	writeJSON(w, http.StatusCreated, peerToResponse(created))
+}
+
+// provisionPeer allocates an address for peer, generates its keys, adds it
+// to the WireGuard interface and stores it. A peer that already has a public
+// key keeps it and gets no private key: its owner holds that. On failure it
+// writes the error response and returns false.
+func (s *Server) provisionPeer(w http.ResponseWriter, r *http.Request, network *db.Network, peer *db.Peer) (*db.Peer, bool) {
+	ctx := r.Context()
+	networkID := network.ID
+
 	// Allocate IP from subnet.
 	_, subnet, _ := net.ParseCIDR(network.Subnet) // already validated on creation
 	existingPeers, err := s.db.ListPeersByNetworkID(ctx, networkID)
@@ -201,11 +372,16 @@ func (s *Server) handleCreatePeer(w http.ResponseWriter, r *http.Request) {
 			"network_id", networkID,
 		)
 		writeError(w, r, fmt.Errorf("failed to list peers"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
-		return
+		return nil, false
 	}
 
 	var usedIPs []net.IP
 	for _, p := range existingPeers {
+		// Adding a second peer with the same key would replace the first.
+		if peer.PublicKey != "" && p.PublicKey == peer.PublicKey {
+			writeError(w, r, fmt.Errorf("a peer with this public key already exists in network %d", networkID), apperr.ErrPeerAlreadyExists, http.StatusConflict, s.devMode)
+			return nil, false
+		}
 		parts := strings.Split(p.AllowedIPs, ",")
 		for _, part := range parts {
 			part = strings.TrimSpace(part)
@@ -225,7 +401,7 @@ func (s *Server) handleCreatePeer(w http.ResponseWriter, r *http.Request) {
 			"network_id", networkID,
 		)
 		writeError(w, r, fmt.Errorf("failed to create IP allocator"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
-		return
+		return nil, false
 	}
 
 	allocatedIP, err := alloc.Allocate()
@@ -238,22 +414,24 @@ func (s *Server) handleCreatePeer(w http.ResponseWriter, r *http.Request) {
 			"subnet", network.Subnet,
 		)
 		writeError(w, r, fmt.Errorf("no available IPs in subnet %s", network.Subnet), apperr.ErrIPExhausted, http.StatusConflict, s.devMode)
-		return
+		return nil, false
 	}
 
 	// Generate peer keypair and preshared key.
-	peerPrivKey, peerPubKey, err := wg.GenerateKeyPair()
-	if err != nil {
-		s.logger.Error("generate_peer_keypair_failed",
-			"error", err,
-			"operation", "create_peer",
-			"component", "handler",
-		)
-		writeError(w, r, fmt.Errorf("failed to generate peer keypair"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
-		return
+	if peer.PublicKey == "" {
+		peer.PrivateKey, peer.PublicKey, err = wg.GenerateKeyPair()
+		if err != nil {
+			s.logger.Error("generate_peer_keypair_failed",
+				"error", err,
+				"operation", "create_peer",
+				"component", "handler",
+			)
+			writeError(w, r, fmt.Errorf("failed to generate peer keypair"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
+			return nil, false
+		}
 	}
 
-	presharedKey, err := wg.GeneratePresharedKey()
+	peer.PresharedKey, err = wg.GeneratePresharedKey()
 	if err != nil {
 		s.logger.Error("generate_preshared_key_failed",
 			"error", err,
@@ -261,50 +439,23 @@ func (s *Server) handleCreatePeer(w http.ResponseWriter, r *http.Request) {
 			"component", "handler",
 		)
 		writeError(w, r, fmt.Errorf("failed to generate preshared key"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
-		return
+		return nil, false
 	}
 
 	// Compute server-side AllowedIPs for this peer.
-	serverAllowedIPs := allocatedIP.String() + "/32"
-	if req.Role == "site-gateway" && req.SiteNetworks != "" {
-		serverAllowedIPs = serverAllowedIPs + ", " + req.SiteNetworks
-	}
-
-	// Parse expiry.
-	var expiresAt *time.Time
-	if req.ExpiresIn != "" {
-		d, err := time.ParseDuration(req.ExpiresIn)
-		if err != nil {
-			writeValidationError(w, r, []fieldError{{Field: "expires_in", Message: "invalid duration format (e.g. '720h')"}})
-			return
-		}
-		t := time.Now().Add(d)
-		expiresAt = &t
-	}
-
-	peer := &db.Peer{
-		NetworkID:           networkID,
-		Name:                req.Name,
-		Email:               req.Email,
-		PrivateKey:          peerPrivKey,
-		PublicKey:           peerPubKey,
-		PresharedKey:        presharedKey,
-		AllowedIPs:          serverAllowedIPs,
-		PersistentKeepalive: req.PersistentKeepalive,
-		Role:                req.Role,
-		SiteNetworks:        req.SiteNetworks,
-		Enabled:             true,
-		ExpiresAt:           expiresAt,
+	peer.AllowedIPs = allocatedIP.String() + "/32"
+	if peer.Role == "site-gateway" && peer.SiteNetworks != "" {
+		peer.AllowedIPs = peer.AllowedIPs + ", " + peer.SiteNetworks
 	}
 
 	// Add peer to WireGuard interface.
 	if s.wgManager != nil {
 		peerCfg := wg.PeerConfig{
-			Name:                req.Name,
-			PublicKey:           peerPubKey,
-			PresharedKey:        presharedKey,
-			AllowedIPs:          serverAllowedIPs,
-			PersistentKeepalive: req.PersistentKeepalive,
+			Name:                peer.Name,
+			PublicKey:           peer.PublicKey,
+			PresharedKey:        peer.PresharedKey,
+			AllowedIPs:          peer.AllowedIPs,
+			PersistentKeepalive: peer.PersistentKeepalive,
 		}
 		if err := s.wgManager.AddPeer(ctx, network.Interface, peerCfg); err != nil {
 			s.logger.Error("add_peer_wg_failed",
@@ -313,10 +464,10 @@ func (s *Server) handleCreatePeer(w http.ResponseWriter, r *http.Request) {
 				"operation", "create_peer",
 				"component", "handler",
 				"network_id", networkID,
-				"peer_name", req.Name,
+				"peer_name", peer.Name,
 			)
 			writeError(w, r, fmt.Errorf("failed to add peer to WireGuard"), apperr.ErrPeerAddFailed, http.StatusInternalServerError, s.devMode)
-			return
+			return nil, false
 		}
 	}
 
@@ -332,10 +483,10 @@ func (s *Server) handleCreatePeer(w http.ResponseWriter, r *http.Request) {
 		)
 		// Clean up WG peer on DB failure.
 		if s.wgManager != nil {
-			s.wgManager.RemovePeer(ctx, network.Interface, peerPubKey)
+			s.wgManager.RemovePeer(ctx, network.Interface, peer.PublicKey)
 		}
 		writeError(w, r, fmt.Errorf("failed to create peer"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
-		return
+		return nil, false
 	}
 
 	// Fetch created peer for timestamps.
@@ -348,7 +499,7 @@ func (s *Server) handleCreatePeer(w http.ResponseWriter, r *http.Request) {
 			"peer_id", peerID,
 		)
 		writeError(w, r, fmt.Errorf("failed to retrieve created peer"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
-		return
+		return nil, false
 	}
 
 	s.logger.Info("peer_created",
@@ -359,9 +510,11 @@ func (s *Server) handleCreatePeer(w http.ResponseWriter, r *http.Request) {
 		"allowed_ips", created.AllowedIPs,
 		"component", "handler",
 	)
-	s.auditf(r, "peer.created", "peer", "created peer %q (id=%d) in network %d", created.Name, peerID, networkID)
+	s.auditNetworkf(r, networkID, "peer.created", "peer", "created peer %q (id=%d) in network %d", created.Name, peerID, networkID)
+	s.events.Publish(events.Event{Type: events.TypePeerCreated, NetworkID: networkID, PeerID: peerID, Data: peerToResponse(created)})
+	s.resourceChanged(r, "peer.created", "peer", peerID, nil, peerToResponse(created))
 
-	writeJSON(w, http.StatusCreated, peerToResponse(created))
+	return created, true
 }
 
 // handleListPeers lists all peers for a network.
@@ -405,6 +558,7 @@ func (s *Server) handleListPeers(w http.ResponseWriter, r *http.Request) {
 
 	// Fetch live WireGuard status to enrich peer responses.
 	type liveStatus struct {
+		Endpoint      string
 		Online        bool
 		LastHandshake int64
 		TransferRx    int64
@@ -415,6 +569,7 @@ func (s *Server) handleListPeers(w http.ResponseWriter, r *http.Request) {
 		if statuses, err := s.wgManager.PeerStatus(network.Interface); err == nil {
 			for _, st := range statuses {
 				statusByKey[st.PublicKey] = liveStatus{
+					Endpoint:      st.Endpoint,
 					Online:        st.Online,
 					LastHandshake: st.LastHandshake.Unix(),
 					TransferRx:    st.TransferRx,
@@ -426,12 +581,17 @@ func (s *Server) handleListPeers(w http.ResponseWriter, r *http.Request) {
 
 	result := make([]peerResponse, 0, len(peers))
 	for _, p := range peers {
+		if !canAccessPeer(r, &p, auth.PermPeerRead) {
+			continue // callers with only the device permissions see their own
+		}
 		resp := peerToResponse(&p)
 		if st, ok := statusByKey[p.PublicKey]; ok {
 			resp.Online = st.Online
 			resp.LastHandshake = st.LastHandshake
 			resp.TransferRx = st.TransferRx
 			resp.TransferTx = st.TransferTx
+			resp.RemoteEndpoint = st.Endpoint
+			resp.Location = s.locate(st.Endpoint)
 		}
 		result = append(result, resp)
 	}
@@ -439,7 +599,11 @@ func (s *Server) handleListPeers(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, result)
 }
 
-// handleGetPeer returns a single peer.
+// endpointHistoryLimit caps the roaming history included in peer detail.
+const endpointHistoryLimit = 50
+
+// handleGetPeer returns a single peer with its recent endpoint history,
+// newest first.
 func (s *Server) handleGetPeer(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
@@ -466,12 +630,35 @@ func (s *Server) handleGetPeer(w http.ResponseWriter, r *http.Request) {
 		writeError(w, r, fmt.Errorf("failed to get peer"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
 		return
 	}
-	if peer == nil || peer.NetworkID != networkID {
+	if peer == nil || peer.NetworkID != networkID || !canAccessPeer(r, peer, auth.PermPeerRead) {
 		writeError(w, r, fmt.Errorf("peer %d not found in network %d", peerID, networkID), apperr.ErrPeerNotFound, http.StatusNotFound, s.devMode)
 		return
 	}
 
-	writeJSON(w, http.StatusOK, peerToResponse(peer))
+	endpoints, err := s.ts.ListPeerEndpoints(ctx, peerID, endpointHistoryLimit)
+	if err != nil {
+		s.logger.Error("list_endpoints_failed",
+			"error", err,
+			"operation", "get_peer",
+			"component", "handler",
+			"peer_id", peerID,
+		)
+		writeError(w, r, fmt.Errorf("failed to list endpoint history"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
+		return
+	}
+
+	resp := peerDetailResponse{
+		peerResponse:    peerToResponse(peer),
+		EndpointHistory: make([]endpointHistoryEntry, 0, len(endpoints)),
+	}
+	for _, e := range endpoints {
+		resp.EndpointHistory = append(resp.EndpointHistory, endpointHistoryEntry{
+			Timestamp: e.Timestamp.Unix(),
+			Endpoint:  e.Endpoint,
+			Location:  s.locate(e.Endpoint),
+		})
+	}
+	writeJSON(w, http.StatusOK, resp)
 }
 
 // handleUpdatePeer updates a peer's mutable fields.
@@ -517,6 +704,8 @@ func (s *Server) handleUpdatePeer(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	before := peerToResponse(peer)
+
 	network, err := s.db.GetNetworkByID(ctx, networkID)
 	if err != nil || network == nil {
 		writeError(w, r, fmt.Errorf("network %d not found", networkID), apperr.ErrNetworkNotFound, http.StatusNotFound, s.devMode)
@@ -532,6 +721,7 @@ func (s *Server) handleUpdatePeer(w http.ResponseWriter, r *http.Request) {
 	}
 	if req.Enabled != nil {
 		peer.Enabled = *req.Enabled
+		s.clearQuotaDisable(r, peer.ID)
 	}
 	if req.PersistentKeepalive != nil {
 		peer.PersistentKeepalive = *req.PersistentKeepalive
@@ -552,6 +742,24 @@ func (s *Server) handleUpdatePeer(w http.ResponseWriter, r *http.Request) {
 			peer.ExpiresAt = &t
 		}
 	}
+	if req.QuotaBytes != nil {
+		peer.QuotaBytes = *req.QuotaBytes
+	}
+	if req.QuotaResetDay != nil {
+		peer.QuotaResetDay = *req.QuotaResetDay
+	}
+	if req.QuotaAction != nil {
+		peer.QuotaAction = *req.QuotaAction
+	}
+	if req.AllowedCountries != nil {
+		peer.AllowedCountries = normalizeCountries(*req.AllowedCountries)
+	}
+	if req.OwnerID != nil {
+		if !s.validOwner(w, r, *req.OwnerID) {
+			return
+		}
+		peer.OwnerID = *req.OwnerID
+	}
 
 	// Update WireGuard peer if manager is available.
 	if s.wgManager != nil {
@@ -609,7 +817,9 @@ func (s *Server) handleUpdatePeer(w http.ResponseWriter, r *http.Request) {
 		"network_id", networkID,
 		"component", "handler",
 	)
-	s.auditf(r, "peer.updated", "peer", "updated peer %q (id=%d) in network %d", updated.Name, peerID, networkID)
+	s.auditNetworkf(r, networkID, "peer.updated", "peer", "updated peer %q (id=%d) in network %d", updated.Name, peerID, networkID)
+	s.events.Publish(events.Event{Type: events.TypePeerUpdated, NetworkID: networkID, PeerID: peerID, Data: peerToResponse(updated)})
+	s.resourceChanged(r, "peer.updated", "peer", peerID, before, peerToResponse(updated))
 
 	writeJSON(w, http.StatusOK, peerToResponse(updated))
 }
@@ -678,6 +888,7 @@ func (s *Server) handleDeletePeer(w http.ResponseWriter, r *http.Request) {
 		writeError(w, r, fmt.Errorf("failed to delete peer"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
 		return
 	}
+	s.deletePeerTimeSeries(ctx, peerID, "delete_peer")
 
 	s.logger.Info("peer_deleted",
 		"peer_id", peerID,
@@ -686,7 +897,9 @@ func (s *Server) handleDeletePeer(w http.ResponseWriter, r *http.Request) {
 		"public_key", peer.PublicKey,
 		"component", "handler",
 	)
-	s.auditf(r, "peer.deleted", "peer", "deleted peer %q (id=%d) from network %d", peer.Name, peerID, networkID)
+	s.auditNetworkf(r, networkID, "peer.deleted", "peer", "deleted peer %q (id=%d) from network %d", peer.Name, peerID, networkID)
+	s.events.Publish(events.Event{Type: events.TypePeerDeleted, NetworkID: networkID, PeerID: peerID, Data: map[string]any{"name": peer.Name, "public_key": peer.PublicKey}})
+	s.resourceChanged(r, "peer.deleted", "peer", peerID, peerToResponse(peer), nil)
 
 	w.WriteHeader(http.StatusNoContent)
 }
@@ -718,7 +931,7 @@ func (s *Server) handlePeerConfig(w http.ResponseWriter, r *http.Request) {
 		writeError(w, r, fmt.Errorf("failed to get peer"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
 		return
 	}
-	if peer == nil || peer.NetworkID != networkID {
+	if peer == nil || peer.NetworkID != networkID || !canAccessPeer(r, peer, auth.PermPeerWrite) {
 		writeError(w, r, fmt.Errorf("peer %d not found in network %d", peerID, networkID), apperr.ErrPeerNotFound, http.StatusNotFound, s.devMode)
 		return
 	}
@@ -729,12 +942,38 @@ func (s *Server) handlePeerConfig(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	conf, err := s.peerClientConfig(ctx, network, peer, "peer_config")
+	if err != nil {
+		s.logger.Error("generate_config_failed",
+			"error", err,
+			"error_type", fmt.Sprintf("%T", err),
+			"operation", "peer_config",
+			"component", "handler",
+			"peer_id", peerID,
+		)
+		writeError(w, r, fmt.Errorf("failed to generate config"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="wgpilot-%s.conf"`, safeFilename(peer.Name)))
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(conf))
+}
+
+// placeholderPrivateKey stands in for the private key in the config of a
+// peer that enrolled with its own keypair.
+const placeholderPrivateKey = "YOUR_PRIVATE_KEY"
+
+// peerClientConfig renders the client config for peer. Peers whose private
+// key the server does not hold get placeholderPrivateKey instead.
+func (s *Server) peerClientConfig(ctx context.Context, network *db.Network, peer *db.Peer, operation string) (string, error) {
 	// Build server endpoint.
 	publicIP, err := s.db.GetSetting(ctx, "public_ip")
 	if err != nil {
 		s.logger.Error("get_public_ip_failed",
 			"error", err,
-			"operation", "peer_config",
+			"operation", operation,
 			"component", "handler",
 		)
 	}
@@ -743,12 +982,17 @@ func (s *Server) handlePeerConfig(w http.ResponseWriter, r *http.Request) {
 	}
 	serverEndpoint := fmt.Sprintf("%s:%d", publicIP, network.ListenPort)
 
+	privateKey := peer.PrivateKey
+	if privateKey == "" {
+		privateKey = placeholderPrivateKey
+	}
+
 	// Compute client-side AllowedIPs based on mode.
 	clientAllowedIPs := wg.ComputeClientAllowedIPs(network.Mode, network.Subnet, peer.SiteNetworks)
 
-	conf, err := wg.GenerateClientConfig(wg.ClientConfigParams{
+	return wg.GenerateClientConfig(wg.ClientConfigParams{
 		PeerName:            peer.Name,
-		PeerPrivateKey:      peer.PrivateKey,
+		PeerPrivateKey:      privateKey,
 		PeerAddress:         peer.AllowedIPs,
 		DNSServers:          network.DNSServers,
 		ServerPublicKey:     network.PublicKey,
@@ -757,30 +1001,6 @@ func (s *Server) handlePeerConfig(w http.ResponseWriter, r *http.Request) {
 		AllowedIPs:          clientAllowedIPs,
 		PersistentKeepalive: peer.PersistentKeepalive,
 	})
-	if err != nil {
-		s.logger.Error("generate_config_failed",
-			"error", err,
-			"error_type", fmt.Sprintf("%T", err),
-			"operation", "peer_config",
-			"component", "handler",
-			"peer_id", peerID,
-		)
-		writeError(w, r, fmt.Errorf("failed to generate config"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
-		return
-	}
-
-	// Sanitize peer name for filename.
-	safeName := strings.Map(func(c rune) rune {
-		if (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') || c == '-' || c == '_' {
-			return c
-		}
-		return '-'
-	}, peer.Name)
-
-	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
-	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="wgpilot-%s.conf"`, safeName))
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte(conf))
 }
 
 // handlePeerQR returns a QR code PNG image for a peer's config.
@@ -810,7 +1030,7 @@ func (s *Server) handlePeerQR(w http.ResponseWriter, r *http.Request) {
 		writeError(w, r, fmt.Errorf("failed to get peer"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
 		return
 	}
-	if peer == nil || peer.NetworkID != networkID {
+	if peer == nil || peer.NetworkID != networkID || !canAccessPeer(r, peer, auth.PermPeerWrite) {
 		writeError(w, r, fmt.Errorf("peer %d not found in network %d", peerID, networkID), apperr.ErrPeerNotFound, http.StatusNotFound, s.devMode)
 		return
 	}
@@ -821,32 +1041,13 @@ func (s *Server) handlePeerQR(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	publicIP, err := s.db.GetSetting(ctx, "public_ip")
-	if err != nil {
-		s.logger.Error("get_public_ip_failed",
-			"error", err,
-			"operation", "peer_qr",
-			"component", "handler",
-		)
-	}
-	if publicIP == "" {
-		publicIP = "YOUR_SERVER_IP"
+	// A QR code with a placeholder key would import a broken tunnel.
+	if peer.PrivateKey == "" {
+		writeError(w, r, fmt.Errorf("peer %d enrolled with its own key; the server has no private key to encode", peerID), apperr.ErrPrivateKeyUnavailable, http.StatusConflict, s.devMode)
+		return
 	}
-	serverEndpoint := fmt.Sprintf("%s:%d", publicIP, network.ListenPort)
-
-	clientAllowedIPs := wg.ComputeClientAllowedIPs(network.Mode, network.Subnet, peer.SiteNetworks)
 
-	conf, err := wg.GenerateClientConfig(wg.ClientConfigParams{
-		PeerName:            peer.Name,
-		PeerPrivateKey:      peer.PrivateKey,
-		PeerAddress:         peer.AllowedIPs,
-		DNSServers:          network.DNSServers,
-		ServerPublicKey:     network.PublicKey,
-		PresharedKey:        peer.PresharedKey,
-		ServerEndpoint:      serverEndpoint,
-		AllowedIPs:          clientAllowedIPs,
-		PersistentKeepalive: peer.PersistentKeepalive,
-	})
+	conf, err := s.peerClientConfig(ctx, network, peer, "peer_qr")
 	if err != nil {
 		s.logger.Error("generate_config_failed",
 			"error", err,
@@ -876,6 +1077,93 @@ func (s *Server) handlePeerQR(w http.ResponseWriter, r *http.Request) {
 	w.Write(png)
 }
 
+// handleRotatePeerKeys gives a peer a new keypair and preshared key. The
+// old config stops working; the peer must download the new one.
+func (s *Server) handleRotatePeerKeys(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	networkID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("invalid network ID"), apperr.ErrValidation, http.StatusBadRequest, s.devMode)
+		return
+	}
+
+	peerID, err := strconv.ParseInt(r.PathValue("pid"), 10, 64)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("invalid peer ID"), apperr.ErrValidation, http.StatusBadRequest, s.devMode)
+		return
+	}
+
+	peer, err := s.db.GetPeerByID(ctx, peerID)
+	if err != nil {
+		s.logger.Error("get_peer_failed", "error", err, "operation", "rotate_peer_keys", "component", "handler", "peer_id", peerID)
+		writeError(w, r, fmt.Errorf("failed to get peer"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
+		return
+	}
+	if peer == nil || peer.NetworkID != networkID || !canAccessPeer(r, peer, auth.PermPeerWrite) {
+		writeError(w, r, fmt.Errorf("peer %d not found in network %d", peerID, networkID), apperr.ErrPeerNotFound, http.StatusNotFound, s.devMode)
+		return
+	}
+
+	before := peerToResponse(peer)
+
+	network, err := s.db.GetNetworkByID(ctx, networkID)
+	if err != nil || network == nil {
+		writeError(w, r, fmt.Errorf("network %d not found", networkID), apperr.ErrNetworkNotFound, http.StatusNotFound, s.devMode)
+		return
+	}
+
+	privateKey, publicKey, err := wg.GenerateKeyPair()
+	if err != nil {
+		s.logger.Error("generate_peer_keypair_failed", "error", err, "operation", "rotate_peer_keys", "component", "handler")
+		writeError(w, r, fmt.Errorf("failed to generate peer keypair"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
+		return
+	}
+	presharedKey, err := wg.GeneratePresharedKey()
+	if err != nil {
+		s.logger.Error("generate_preshared_key_failed", "error", err, "operation", "rotate_peer_keys", "component", "handler")
+		writeError(w, r, fmt.Errorf("failed to generate preshared key"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
+		return
+	}
+
+	oldPublicKey := peer.PublicKey
+	peer.PrivateKey, peer.PublicKey, peer.PresharedKey = privateKey, publicKey, presharedKey
+	if err := s.db.UpdatePeer(ctx, peer); err != nil {
+		s.logger.Error("update_peer_failed", "error", err, "operation", "rotate_peer_keys", "component", "handler", "peer_id", peerID)
+		writeError(w, r, fmt.Errorf("failed to update peer"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
+		return
+	}
+
+	// Swap the peer on the WireGuard interface.
+	if s.wgManager != nil && network.Enabled && peer.Enabled {
+		if rmErr := s.wgManager.RemovePeer(ctx, network.Interface, oldPublicKey); rmErr != nil {
+			s.logger.Error("remove_peer_wg_failed", "error", rmErr, "operation", "rotate_peer_keys", "component", "handler", "peer_id", peerID)
+		}
+		peerCfg := wg.PeerConfig{
+			Name:                peer.Name,
+			PublicKey:           peer.PublicKey,
+			PresharedKey:        peer.PresharedKey,
+			AllowedIPs:          peer.AllowedIPs,
+			Endpoint:            peer.Endpoint,
+			PersistentKeepalive: peer.PersistentKeepalive,
+		}
+		if addErr := s.wgManager.AddPeer(ctx, network.Interface, peerCfg); addErr != nil {
+			s.logger.Error("add_peer_wg_failed", "error", addErr, "operation", "rotate_peer_keys", "component", "handler", "peer_id", peerID)
+		}
+	}
+
+	updated, _ := s.db.GetPeerByID(ctx, peerID)
+	if updated == nil {
+		updated = peer
+	}
+
+	s.logger.Info("peer_keys_rotated", "peer_id", peerID, "peer_name", peer.Name, "network_id", networkID, "public_key", peer.PublicKey, "component", "handler")
+	s.auditNetworkf(r, networkID, "peer.keys_rotated", "peer", "rotated keys of peer %q (id=%d) in network %d", peer.Name, peerID, networkID)
+	s.events.Publish(events.Event{Type: events.TypePeerUpdated, NetworkID: networkID, PeerID: peerID, Data: peerToResponse(updated)})
+	s.resourceChanged(r, "peer.updated", "peer", peerID, before, peerToResponse(updated))
+	writeJSON(w, http.StatusOK, peerToResponse(updated))
+}
+
 // handleEnablePeer enables a peer and adds it to the WireGuard interface.
 func (s *Server) handleEnablePeer(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
@@ -903,6 +1191,9 @@ func (s *Server) handleEnablePeer(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	before := peerToResponse(peer)
+	s.clearQuotaDisable(r, peerID)
+
 	if peer.Enabled {
 		writeJSON(w, http.StatusOK, peerToResponse(peer))
 		return
@@ -942,7 +1233,9 @@ func (s *Server) handleEnablePeer(w http.ResponseWriter, r *http.Request) {
 	}
 
 	s.logger.Info("peer_enabled", "peer_id", peerID, "peer_name", peer.Name, "network_id", networkID, "component", "handler")
-	s.auditf(r, "peer.enabled", "peer", "enabled peer %q (id=%d) in network %d", peer.Name, peerID, networkID)
+	s.auditNetworkf(r, networkID, "peer.enabled", "peer", "enabled peer %q (id=%d) in network %d", peer.Name, peerID, networkID)
+	s.events.Publish(events.Event{Type: events.TypePeerEnabled, NetworkID: networkID, PeerID: peerID, Data: peerToResponse(updated)})
+	s.resourceChanged(r, "peer.enabled", "peer", peerID, before, peerToResponse(updated))
 	writeJSON(w, http.StatusOK, peerToResponse(updated))
 }
 
@@ -973,6 +1266,9 @@ func (s *Server) handleDisablePeer(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	before := peerToResponse(peer)
+	s.clearQuotaDisable(r, peerID)
+
 	if !peer.Enabled {
 		writeJSON(w, http.StatusOK, peerToResponse(peer))
 		return
@@ -1004,7 +1300,9 @@ func (s *Server) handleDisablePeer(w http.ResponseWriter, r *http.Request) {
 	}
 
 	s.logger.Info("peer_disabled", "peer_id", peerID, "peer_name", peer.Name, "network_id", networkID, "component", "handler")
-	s.auditf(r, "peer.disabled", "peer", "disabled peer %q (id=%d) in network %d", peer.Name, peerID, networkID)
+	s.auditNetworkf(r, networkID, "peer.disabled", "peer", "disabled peer %q (id=%d) in network %d", peer.Name, peerID, networkID)
+	s.events.Publish(events.Event{Type: events.TypePeerDisabled, NetworkID: networkID, PeerID: peerID, Data: peerToResponse(updated)})
+	s.resourceChanged(r, "peer.disabled", "peer", peerID, before, peerToResponse(updated))
 	writeJSON(w, http.StatusOK, peerToResponse(updated))
 }
 
@@ -1023,6 +1321,10 @@ func peerToResponse(p *db.Peer) peerResponse {
 		Role:                p.Role,
 		SiteNetworks:        p.SiteNetworks,
 		Enabled:             p.Enabled,
+		QuotaBytes:          p.QuotaBytes,
+		QuotaResetDay:       p.QuotaResetDay,
+		QuotaAction:         p.QuotaAction,
+		AllowedCountries:    p.AllowedCountries,
 		CreatedAt:           p.CreatedAt.Unix(),
 		UpdatedAt:           p.UpdatedAt.Unix(),
 	}
@@ -1030,5 +1332,84 @@ func peerToResponse(p *db.Peer) peerResponse {
 		ts := p.ExpiresAt.Unix()
 		resp.ExpiresAt = &ts
 	}
+	if p.OwnerID != 0 {
+		resp.OwnerID = &p.OwnerID
+	}
 	return resp
 }
+
+// managesPeers reports whether the caller holds perm on network id, as
+// opposed to only the device permissions for the peers they own.
+func managesPeers(r *http.Request, id int64, perm string) bool {
+	grants := auth.GrantsFromContext(r.Context())
+	return grants == nil || grants.HasOnNetwork(id, perm)
+}
+
+// canAccessPeer reports whether the caller may act on peer: with perm on its
+// network, or as its owner. Handlers report other peers as not found.
+func canAccessPeer(r *http.Request, peer *db.Peer, perm string) bool {
+	if managesPeers(r, peer.NetworkID, perm) {
+		return true
+	}
+	return peer.OwnerID != 0 && peer.OwnerID == callerID(r)
+}
+
+// callerID returns the authenticated caller's user ID, or 0 if unknown.
+func callerID(r *http.Request) int64 {
+	claims := auth.UserFromContext(r.Context())
+	if claims == nil {
+		return 0
+	}
+	id, _ := strconv.ParseInt(claims.Subject, 10, 64)
+	return id
+}
+
+// withinDeviceLimit checks that ownerID may create another device on
+// network. It writes the error response and returns false otherwise.
+func (s *Server) withinDeviceLimit(w http.ResponseWriter, r *http.Request, network *db.Network, ownerID int64) bool {
+	if network.DeviceLimit <= 0 || ownerID == 0 {
+		writeError(w, r, fmt.Errorf("network %q does not allow self-service devices", network.Name), apperr.ErrForbidden, http.StatusForbidden, s.devMode)
+		return false
+	}
+	n, err := s.db.CountPeersByOwner(r.Context(), network.ID, ownerID)
+	if err != nil {
+		s.logger.Error("count_owned_peers_failed", "error", err, "operation", "create_peer", "component", "handler", "network_id", network.ID, "owner_id", ownerID)
+		writeError(w, r, fmt.Errorf("failed to count devices"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
+		return false
+	}
+	if n >= network.DeviceLimit {
+		writeError(w, r, fmt.Errorf("device limit of %d reached on network %q", network.DeviceLimit, network.Name), apperr.ErrDeviceLimit, http.StatusConflict, s.devMode)
+		return false
+	}
+	return true
+}
+
+// validOwner checks that id, if set, is an existing user. It writes a
+// validation error and returns false otherwise.
+func (s *Server) validOwner(w http.ResponseWriter, r *http.Request, id int64) bool {
+	if id == 0 {
+		return true
+	}
+	user, err := s.db.GetUserByID(r.Context(), id)
+	if err != nil {
+		s.logger.Error("get_user_failed", "error", err, "component", "handler", "user_id", id)
+		writeError(w, r, fmt.Errorf("failed to get user"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
+		return false
+	}
+	if user == nil {
+		writeValidationError(w, r, []fieldError{{Field: "owner_id", Message: fmt.Sprintf("user %d does not exist", id)}})
+		return false
+	}
+	return true
+}
+
+// safeFilename replaces characters outside [A-Za-z0-9_-] in a peer name so
+// it can be used in a Content-Disposition filename.
+func safeFilename(name string) string {
+	return strings.Map(func(c rune) rune {
+		if (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') || c == '-' || c == '_' {
+			return c
+		}
+		return '-'
+	}, name)
+}
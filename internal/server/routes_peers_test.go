@@ -8,7 +8,9 @@ import (
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/itsChris/wgpilot/internal/auth"
 	"github.com/itsChris/wgpilot/internal/db"
 )
 
@@ -42,7 +44,8 @@ func TestCreatePeer_Success(t *testing.T) {
 		"name": "My Phone",
 		"email": "chris@example.com",
 		"role": "client",
-		"persistent_keepalive": 25
+		"persistent_keepalive": 25,
+		"allowed_countries": "ch, de"
 	}`
 	req := httptest.NewRequest("POST", fmt.Sprintf("/api/networks/%d/peers", netID), strings.NewReader(body))
 	req.Header.Set("Content-Type", "application/json")
@@ -84,6 +87,9 @@ func TestCreatePeer_Success(t *testing.T) {
 	if resp.NetworkID != netID {
 		t.Errorf("expected network_id=%d, got %d", netID, resp.NetworkID)
 	}
+	if resp.AllowedCountries != "CH,DE" {
+		t.Errorf("expected allowed_countries='CH,DE', got %q", resp.AllowedCountries)
+	}
 }
 
 func TestCreatePeer_ValidationErrors(t *testing.T) {
@@ -93,7 +99,8 @@ func TestCreatePeer_ValidationErrors(t *testing.T) {
 	body := `{
 		"name": "",
 		"role": "invalid",
-		"persistent_keepalive": -1
+		"persistent_keepalive": -1,
+		"allowed_countries": "Switzerland"
 	}`
 	req := httptest.NewRequest("POST", fmt.Sprintf("/api/networks/%d/peers", netID), strings.NewReader(body))
 	req.Header.Set("Content-Type", "application/json")
@@ -125,6 +132,9 @@ func TestCreatePeer_ValidationErrors(t *testing.T) {
 	if !fieldNames["role"] {
 		t.Error("expected field error for 'role'")
 	}
+	if !fieldNames["allowed_countries"] {
+		t.Error("expected field error for 'allowed_countries'")
+	}
 }
 
 func TestCreatePeer_NetworkNotFound(t *testing.T) {
@@ -253,6 +263,37 @@ func TestGetPeer_Found(t *testing.T) {
 	}
 }
 
+func TestGetPeer_EndpointHistory(t *testing.T) {
+	srv, _, _ := newTestServerWithWG(t)
+	netID := createTestNetwork(t, srv)
+	now := time.Now().Truncate(time.Second)
+	peerID := createSessionFixture(t, srv, netID, now)
+
+	req := httptest.NewRequest("GET", fmt.Sprintf("/api/networks/%d/peers/%d", netID, peerID), nil)
+	req = authRequest(t, srv, req)
+	w := httptest.NewRecorder()
+
+	srv.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var resp peerDetailResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if resp.Name != "Laptop" {
+		t.Errorf("expected name='Laptop', got %q", resp.Name)
+	}
+	if len(resp.EndpointHistory) != 2 {
+		t.Fatalf("expected 2 endpoint changes, got %+v", resp.EndpointHistory)
+	}
+	if latest := resp.EndpointHistory[0]; latest.Endpoint != "203.0.113.1:51820" || latest.Timestamp != now.Unix() {
+		t.Errorf("expected latest endpoint first, got %+v", latest)
+	}
+}
+
 func TestGetPeer_NotFound(t *testing.T) {
 	srv, _, _ := newTestServerWithWG(t)
 	netID := createTestNetwork(t, srv)
@@ -373,6 +414,40 @@ func TestUpdatePeer_NotFound(t *testing.T) {
 	}
 }
 
+// timeSeriesTables are the time-series tables holding per-peer rows.
+var timeSeriesTables = []string{
+	"peer_snapshots", "peer_traffic", "peer_traffic_daily", "peer_sessions", "peer_endpoints",
+}
+
+// recordTestTraffic writes two polls for peerID, filling its snapshots,
+// traffic totals, session and endpoint history.
+func recordTestTraffic(t *testing.T, srv *Server, peerID int64) {
+	t.Helper()
+	now := time.Now()
+	for _, at := range []time.Time{now.Add(-time.Minute), now} {
+		if err := srv.ts.InsertSnapshot(context.Background(), &db.PeerSnapshot{
+			PeerID: peerID, Timestamp: at, RxDelta: 100, TxDelta: 200, Online: true, Endpoint: "198.51.100.7:51820",
+		}); err != nil {
+			t.Fatalf("insert snapshot: %v", err)
+		}
+	}
+	for table, n := range srv.ts.TableCounts(context.Background(), timeSeriesTables) {
+		if n == 0 {
+			t.Fatalf("expected rows in %s", table)
+		}
+	}
+}
+
+// assertNoTimeSeries fails the test if any time-series rows are left.
+func assertNoTimeSeries(t *testing.T, srv *Server) {
+	t.Helper()
+	for table, n := range srv.ts.TableCounts(context.Background(), timeSeriesTables) {
+		if n != 0 {
+			t.Errorf("expected no rows in %s, got %d", table, n)
+		}
+	}
+}
+
 func TestDeletePeer_Success(t *testing.T) {
 	srv, _, _ := newTestServerWithWG(t)
 	netID := createTestNetwork(t, srv)
@@ -389,6 +464,7 @@ func TestDeletePeer_Success(t *testing.T) {
 	if err != nil {
 		t.Fatalf("create peer: %v", err)
 	}
+	recordTestTraffic(t, srv, peerID)
 
 	req := httptest.NewRequest("DELETE", fmt.Sprintf("/api/networks/%d/peers/%d", netID, peerID), nil)
 	req = authRequest(t, srv, req)
@@ -407,6 +483,7 @@ func TestDeletePeer_Success(t *testing.T) {
 	if peer != nil {
 		t.Error("expected peer to be deleted")
 	}
+	assertNoTimeSeries(t, srv)
 }
 
 func TestDeletePeer_NotFound(t *testing.T) {
@@ -810,3 +887,116 @@ func TestCreatePeer_SiteGateway_AllowedIPs(t *testing.T) {
 		t.Errorf("expected site_networks preserved, got %q", resp.SiteNetworks)
 	}
 }
+
+func TestPeers_SelfServicePortal(t *testing.T) {
+	srv, _, _ := newTestServerWithWG(t)
+	netID := createTestNetwork(t, srv)
+	ctx := context.Background()
+
+	token, err := adminSession(t, srv)
+	if err != nil {
+		t.Fatalf("admin session: %v", err)
+	}
+	admin := &http.Cookie{Name: auth.CookieName, Value: token}
+	user := loginWithRole(t, srv, "uma", "user")
+	uma, _ := srv.db.GetUserByUsername(ctx, "uma")
+
+	otherID, err := srv.db.CreatePeer(ctx, &db.Peer{
+		NetworkID: netID, Name: "Office", PublicKey: "office-pub-key",
+		AllowedIPs: "10.0.0.2/32", Role: "client", Enabled: true,
+	})
+	if err != nil {
+		t.Fatalf("create peer: %v", err)
+	}
+	peers := fmt.Sprintf("/api/networks/%d/peers", netID)
+
+	// Self-service creation is off until an admin sets a device limit.
+	if w := sendJSON(t, srv, "POST", peers, `{"name":"Laptop"}`, user); w.Code != http.StatusForbidden {
+		t.Fatalf("create without limit: expected 403, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := sendJSON(t, srv, "PUT", fmt.Sprintf("/api/networks/%d", netID), `{"device_limit":1}`, admin); w.Code != http.StatusOK {
+		t.Fatalf("set device limit: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w := sendWithCookie(t, srv, "GET", "/api/networks", user)
+	var networks []networkListItem
+	if err := json.NewDecoder(w.Body).Decode(&networks); err != nil {
+		t.Fatalf("decode networks: %v", err)
+	}
+	if len(networks) != 1 || networks[0].DeviceLimit != 1 || networks[0].PeerCount != 0 {
+		t.Errorf("expected the network with no devices of the user's own, got %+v", networks)
+	}
+
+	if w := sendJSON(t, srv, "POST", peers, `{"name":"Laptop","quota_bytes":1000}`, user); w.Code != http.StatusBadRequest {
+		t.Errorf("create with quota: expected 400, got %d", w.Code)
+	}
+	w = sendJSON(t, srv, "POST", peers, `{"name":"Laptop"}`, user)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create: expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var laptop peerResponse
+	if err := json.NewDecoder(w.Body).Decode(&laptop); err != nil {
+		t.Fatalf("decode peer: %v", err)
+	}
+	if laptop.OwnerID == nil || *laptop.OwnerID != uma.ID || laptop.Role != "client" {
+		t.Errorf("expected a client device owned by %d, got %+v", uma.ID, laptop)
+	}
+	w = sendJSON(t, srv, "POST", peers, `{"name":"Phone"}`, user)
+	if w.Code != http.StatusConflict || !strings.Contains(w.Body.String(), "DEVICE_LIMIT_REACHED") {
+		t.Errorf("create over limit: expected 409 DEVICE_LIMIT_REACHED, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w = sendWithCookie(t, srv, "GET", peers, user)
+	var listed []peerResponse
+	if err := json.NewDecoder(w.Body).Decode(&listed); err != nil {
+		t.Fatalf("decode peers: %v", err)
+	}
+	if len(listed) != 1 || listed[0].ID != laptop.ID {
+		t.Errorf("expected only the user's device, got %+v", listed)
+	}
+
+	own := fmt.Sprintf("%s/%d", peers, laptop.ID)
+	other := fmt.Sprintf("%s/%d", peers, otherID)
+	tests := []struct {
+		method, path string
+		want         int
+	}{
+		{"GET", own, http.StatusOK},
+		{"GET", own + "/config", http.StatusOK},
+		{"GET", own + "/qr", http.StatusOK},
+		{"GET", other, http.StatusNotFound},
+		{"GET", other + "/config", http.StatusNotFound},
+		{"POST", other + "/rotate-keys", http.StatusNotFound},
+		{"PUT", own, http.StatusForbidden},
+		{"DELETE", own, http.StatusForbidden},
+		{"POST", own + "/disable", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		if w := sendWithCookie(t, srv, tt.method, tt.path, user); w.Code != tt.want {
+			t.Errorf("%s %s: expected %d, got %d: %s", tt.method, tt.path, tt.want, w.Code, w.Body.String())
+		}
+	}
+
+	w = sendWithCookie(t, srv, "POST", own+"/rotate-keys", user)
+	if w.Code != http.StatusOK {
+		t.Fatalf("rotate keys: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var rotated peerResponse
+	if err := json.NewDecoder(w.Body).Decode(&rotated); err != nil {
+		t.Fatalf("decode peer: %v", err)
+	}
+	if rotated.PublicKey == laptop.PublicKey {
+		t.Error("expected a new public key after rotation")
+	}
+
+	// Admins hand existing peers to users.
+	if w := sendJSON(t, srv, "PUT", other, `{"owner_id":999}`, admin); w.Code != http.StatusBadRequest {
+		t.Errorf("unknown owner: expected 400, got %d", w.Code)
+	}
+	if w := sendJSON(t, srv, "PUT", other, fmt.Sprintf(`{"owner_id":%d}`, uma.ID), admin); w.Code != http.StatusOK {
+		t.Fatalf("assign owner: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := sendWithCookie(t, srv, "GET", other, user); w.Code != http.StatusOK {
+		t.Errorf("assigned peer: expected 200, got %d", w.Code)
+	}
+}
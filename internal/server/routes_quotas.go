@@ -0,0 +1,122 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/itsChris/wgpilot/internal/auth"
+	"github.com/itsChris/wgpilot/internal/db"
+	apperr "github.com/itsChris/wgpilot/internal/errors"
+)
+
+// ── Request/Response types ───────────────────────────────────────────
+
+type peerQuotaResponse struct {
+	PeerID         int64  `json:"peer_id"`
+	QuotaBytes     int64  `json:"quota_bytes"`
+	QuotaResetDay  int    `json:"quota_reset_day"`
+	QuotaAction    string `json:"quota_action"`
+	CycleStart     int64  `json:"cycle_start"`
+	CycleEnd       int64  `json:"cycle_end"`
+	UsedRx         int64  `json:"used_rx"`
+	UsedTx         int64  `json:"used_tx"`
+	UsedBytes      int64  `json:"used_bytes"`
+	Percent        int    `json:"percent"`
+	EnforcedAction string `json:"enforced_action"`
+}
+
+// ── Handlers ─────────────────────────────────────────────────────────
+
+// handlePeerQuota reports a peer's usage in the current billing cycle.
+func (s *Server) handlePeerQuota(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	networkID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("invalid network ID"), apperr.ErrValidation, http.StatusBadRequest, s.devMode)
+		return
+	}
+
+	peerID, err := strconv.ParseInt(r.PathValue("pid"), 10, 64)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("invalid peer ID"), apperr.ErrValidation, http.StatusBadRequest, s.devMode)
+		return
+	}
+
+	peer, err := s.db.GetPeerByID(ctx, peerID)
+	if err != nil {
+		s.logger.Error("get_peer_failed",
+			"error", err,
+			"operation", "peer_quota",
+			"component", "handler",
+			"peer_id", peerID,
+		)
+		writeError(w, r, fmt.Errorf("failed to get peer"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
+		return
+	}
+	if peer == nil || peer.NetworkID != networkID || !canAccessPeer(r, peer, auth.PermPeerRead) {
+		writeError(w, r, fmt.Errorf("peer %d not found in network %d", peerID, networkID), apperr.ErrPeerNotFound, http.StatusNotFound, s.devMode)
+		return
+	}
+
+	cycleStart := db.QuotaCycleStart(time.Now(), peer.QuotaResetDay)
+	rx, tx, err := s.ts.PeerUsageSince(ctx, peerID, cycleStart)
+	if err != nil {
+		s.logger.Error("peer_usage_failed",
+			"error", err,
+			"operation", "peer_quota",
+			"component", "handler",
+			"peer_id", peerID,
+		)
+		writeError(w, r, fmt.Errorf("failed to compute usage"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
+		return
+	}
+
+	state, err := s.db.GetPeerQuotaState(ctx, peerID)
+	if err != nil {
+		s.logger.Error("get_quota_state_failed",
+			"error", err,
+			"operation", "peer_quota",
+			"component", "handler",
+			"peer_id", peerID,
+		)
+		writeError(w, r, fmt.Errorf("failed to get quota state"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
+		return
+	}
+
+	resp := peerQuotaResponse{
+		PeerID:        peerID,
+		QuotaBytes:    peer.QuotaBytes,
+		QuotaResetDay: peer.QuotaResetDay,
+		QuotaAction:   peer.QuotaAction,
+		CycleStart:    cycleStart.Unix(),
+		CycleEnd:      cycleStart.AddDate(0, 1, 0).Unix(),
+		UsedRx:        rx,
+		UsedTx:        tx,
+		UsedBytes:     rx + tx,
+	}
+	if peer.QuotaBytes > 0 {
+		resp.Percent = int((rx + tx) * 100 / peer.QuotaBytes)
+	}
+	if state != nil && state.CycleStart.Equal(cycleStart) {
+		resp.EnforcedAction = state.EnforcedAction
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// clearQuotaDisable makes an admin's change to a peer's enabled state
+// override a quota disable, so a new billing cycle leaves it alone.
+// Failures are logged, not returned, since the change itself succeeded.
+func (s *Server) clearQuotaDisable(r *http.Request, peerID int64) {
+	if err := s.db.ClearPeerQuotaDisable(r.Context(), peerID); err != nil {
+		s.logger.Error("clear_quota_disable_failed",
+			"error", err,
+			"operation", "peer_enabled",
+			"component", "handler",
+			"peer_id", peerID,
+		)
+	}
+}
@@ -0,0 +1,164 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/itsChris/wgpilot/internal/db"
+)
+
+func TestCreatePeer_WithQuota(t *testing.T) {
+	srv, _, _ := newTestServerWithWG(t)
+	netID := createTestNetwork(t, srv)
+
+	body := `{"name": "Metered", "role": "client", "quota_bytes": 53687091200, "quota_reset_day": 15, "quota_action": "throttle"}`
+	req := httptest.NewRequest("POST", fmt.Sprintf("/api/networks/%d/peers", netID), strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req = authRequest(t, srv, req)
+	w := httptest.NewRecorder()
+
+	srv.ServeHTTP(w, req)
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp peerResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if resp.QuotaBytes != 53687091200 || resp.QuotaResetDay != 15 || resp.QuotaAction != "throttle" {
+		t.Errorf("unexpected quota fields: %+v", resp)
+	}
+}
+
+func TestCreatePeer_InvalidQuota(t *testing.T) {
+	srv, _, _ := newTestServerWithWG(t)
+	netID := createTestNetwork(t, srv)
+
+	body := `{"name": "Metered", "role": "client", "quota_bytes": -1, "quota_reset_day": 31, "quota_action": "block"}`
+	req := httptest.NewRequest("POST", fmt.Sprintf("/api/networks/%d/peers", netID), strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req = authRequest(t, srv, req)
+	w := httptest.NewRecorder()
+
+	srv.ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp validationErrorResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	fieldNames := map[string]bool{}
+	for _, f := range resp.Fields {
+		fieldNames[f.Field] = true
+	}
+	for _, f := range []string{"quota_bytes", "quota_reset_day", "quota_action"} {
+		if !fieldNames[f] {
+			t.Errorf("expected field error for %q", f)
+		}
+	}
+}
+
+func TestPeerQuota_Usage(t *testing.T) {
+	srv, _, _ := newTestServerWithWG(t)
+	netID := createTestNetwork(t, srv)
+	ctx := context.Background()
+
+	peerID, err := srv.db.CreatePeer(ctx, &db.Peer{
+		NetworkID:  netID,
+		Name:       "Metered",
+		PublicKey:  "peer-pub-key",
+		AllowedIPs: "10.0.0.2/32",
+		Role:       "client",
+		Enabled:    true,
+		QuotaBytes: 1000,
+	})
+	if err != nil {
+		t.Fatalf("create peer: %v", err)
+	}
+
+	cycleStart := db.QuotaCycleStart(time.Now(), 1)
+	for i, delta := range []int64{100, 200, 100} {
+		if err := srv.ts.InsertSnapshot(ctx, &db.PeerSnapshot{
+			PeerID:    peerID,
+			Timestamp: cycleStart.Add(time.Duration(i) * time.Minute),
+			RxDelta:   delta,
+			TxDelta:   delta,
+		}); err != nil {
+			t.Fatalf("insert snapshot: %v", err)
+		}
+	}
+
+	req := httptest.NewRequest("GET", fmt.Sprintf("/api/networks/%d/peers/%d/quota", netID, peerID), nil)
+	req = authRequest(t, srv, req)
+	w := httptest.NewRecorder()
+
+	srv.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp peerQuotaResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if resp.UsedBytes != 800 {
+		t.Errorf("expected used_bytes=800, got %d", resp.UsedBytes)
+	}
+	if resp.Percent != 80 {
+		t.Errorf("expected percent=80, got %d", resp.Percent)
+	}
+	if resp.CycleStart != cycleStart.Unix() {
+		t.Errorf("expected cycle_start=%d, got %d", cycleStart.Unix(), resp.CycleStart)
+	}
+}
+
+func TestDisablePeer_OverridesQuotaDisable(t *testing.T) {
+	srv, _, _ := newTestServerWithWG(t)
+	netID := createTestNetwork(t, srv)
+	ctx := context.Background()
+
+	peerID, err := srv.db.CreatePeer(ctx, &db.Peer{
+		NetworkID:  netID,
+		Name:       "Metered",
+		PublicKey:  "peer-pub-key",
+		AllowedIPs: "10.0.0.2/32",
+		Role:       "client",
+		QuotaBytes: 1000,
+	})
+	if err != nil {
+		t.Fatalf("create peer: %v", err)
+	}
+	if err := srv.db.UpsertPeerQuotaState(ctx, &db.PeerQuotaState{
+		PeerID:         peerID,
+		CycleStart:     db.QuotaCycleStart(time.Now(), 1),
+		WarnedPercent:  100,
+		EnforcedAction: db.QuotaActionDisable,
+	}); err != nil {
+		t.Fatalf("upsert quota state: %v", err)
+	}
+
+	req := httptest.NewRequest("POST", fmt.Sprintf("/api/networks/%d/peers/%d/disable", netID, peerID), nil)
+	req = authRequest(t, srv, req)
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	state, err := srv.db.GetPeerQuotaState(ctx, peerID)
+	if err != nil {
+		t.Fatalf("get quota state: %v", err)
+	}
+	if state.EnforcedAction != "" || state.WarnedPercent != 100 {
+		t.Errorf("expected the quota disable forgotten and the warning kept, got %+v", state)
+	}
+}
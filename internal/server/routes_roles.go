@@ -0,0 +1,325 @@
+package server
+
+import (
+	"cmp"
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/itsChris/wgpilot/internal/auth"
+	"github.com/itsChris/wgpilot/internal/db"
+	apperr "github.com/itsChris/wgpilot/internal/errors"
+)
+
+// roleNamePattern restricts custom role names to what fits in the
+// comma-free role columns and in config files.
+var roleNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,31}$`)
+
+// ── Request/Response types ───────────────────────────────────────────
+
+type createRoleRequest struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions"`
+}
+
+type updateRoleRequest struct {
+	Description *string   `json:"description"`
+	Permissions *[]string `json:"permissions"`
+}
+
+type roleResponse struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions"`
+	Builtin     bool     `json:"builtin"`
+	CreatedAt   int64    `json:"created_at,omitempty"`
+	UpdatedAt   int64    `json:"updated_at,omitempty"`
+}
+
+var builtinRoleDescriptions = map[string]string{
+	auth.RoleAdmin:  "Full access",
+	auth.RoleViewer: "Read-only access to networks, peers and settings",
+	auth.RoleMember: "No access beyond the user's network roles",
+	auth.RoleUser:   "Self-service access to the user's own devices",
+}
+
+// ── Validation ───────────────────────────────────────────────────────
+
+// validateRolePermissions requires at least one permission and rejects
+// unknown ones.
+func validateRolePermissions(perms []string) error {
+	if len(perms) == 0 {
+		return fmt.Errorf("at least one permission is required")
+	}
+	for _, p := range perms {
+		if !auth.ValidPermission(p) {
+			return fmt.Errorf("unknown permission %q", p)
+		}
+	}
+	return nil
+}
+
+// ── Handlers ─────────────────────────────────────────────────────────
+
+// handleListRoles returns the built-in roles followed by the custom ones.
+func (s *Server) handleListRoles(w http.ResponseWriter, r *http.Request) {
+	roles, err := s.db.ListRoles(r.Context())
+	if err != nil {
+		s.logger.Error("list_roles_failed", "error", err, "component", "handler")
+		writeError(w, r, fmt.Errorf("failed to list roles"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
+		return
+	}
+
+	builtins := auth.BuiltinRoles()
+	result := make([]roleResponse, 0, len(builtins)+len(roles))
+	for _, name := range builtins {
+		perms, _ := auth.BuiltinRole(name)
+		result = append(result, roleResponse{
+			Name:        name,
+			Description: builtinRoleDescriptions[name],
+			Permissions: perms,
+			Builtin:     true,
+		})
+	}
+	for _, role := range roles {
+		result = append(result, roleToResponse(&role))
+	}
+
+	writeJSON(w, http.StatusOK, result)
+}
+
+// handleListPermissions returns every permission a role can grant.
+func (s *Server) handleListPermissions(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, auth.Permissions)
+}
+
+// handleCreateRole creates a custom role. The caller must hold every
+// permission the role grants.
+func (s *Server) handleCreateRole(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var req createRoleRequest
+	if code, status, err := decodeJSON(r, &req); err != nil {
+		writeError(w, r, err, code, status, s.devMode)
+		return
+	}
+
+	var fields []fieldError
+	if !roleNamePattern.MatchString(req.Name) {
+		fields = append(fields, fieldError{Field: "name", Message: "name must be 1-32 lowercase letters, digits, '-' or '_'"})
+	} else if _, ok := auth.BuiltinRole(req.Name); ok {
+		fields = append(fields, fieldError{Field: "name", Message: "name is reserved for a built-in role"})
+	}
+	if err := validateRolePermissions(req.Permissions); err != nil {
+		fields = append(fields, fieldError{Field: "permissions", Message: err.Error()})
+	}
+	if len(fields) > 0 {
+		writeValidationError(w, r, fields)
+		return
+	}
+	if !s.canGrant(w, r, req.Permissions) {
+		return
+	}
+
+	existing, err := s.db.GetRole(ctx, req.Name)
+	if err != nil {
+		s.logger.Error("get_role_failed", "error", err, "component", "handler", "role", req.Name)
+		writeError(w, r, fmt.Errorf("failed to get role"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
+		return
+	}
+	if existing != nil {
+		writeError(w, r, fmt.Errorf("role %q already exists", req.Name), apperr.ErrValidation, http.StatusConflict, s.devMode)
+		return
+	}
+
+	if err := s.db.CreateRole(ctx, &db.Role{
+		Name:        req.Name,
+		Description: req.Description,
+		Permissions: req.Permissions,
+	}); err != nil {
+		s.logger.Error("create_role_failed", "error", err, "component", "handler", "role", req.Name)
+		writeError(w, r, fmt.Errorf("failed to create role"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
+		return
+	}
+
+	created, err := s.db.GetRole(ctx, req.Name)
+	if err != nil || created == nil {
+		s.logger.Error("get_created_role_failed", "error", err, "component", "handler", "role", req.Name)
+		writeError(w, r, fmt.Errorf("failed to retrieve created role"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
+		return
+	}
+
+	s.logger.Info("role_created", "role", req.Name, "permissions", req.Permissions, "component", "handler")
+	s.auditf(r, "role.created", "role", "created role %q (permissions=%v)", req.Name, req.Permissions)
+
+	writeJSON(w, http.StatusCreated, roleToResponse(created))
+}
+
+// handleUpdateRole updates a custom role. Changed permissions apply to its
+// users and API keys on their next request.
+func (s *Server) handleUpdateRole(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	role, ok := s.customRoleFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	var req updateRoleRequest
+	if code, status, err := decodeJSON(r, &req); err != nil {
+		writeError(w, r, err, code, status, s.devMode)
+		return
+	}
+
+	if req.Permissions != nil {
+		if err := validateRolePermissions(*req.Permissions); err != nil {
+			writeValidationError(w, r, []fieldError{{Field: "permissions", Message: err.Error()}})
+			return
+		}
+		// Both the old and the new permissions must be the caller's to give,
+		// so that nobody can widen or narrow a role beyond their own reach.
+		if !s.canGrant(w, r, role.Permissions) || !s.canGrant(w, r, *req.Permissions) {
+			return
+		}
+		role.Permissions = *req.Permissions
+	}
+	if req.Description != nil {
+		role.Description = *req.Description
+	}
+
+	if err := s.db.UpdateRole(ctx, role); err != nil {
+		s.logger.Error("update_role_failed", "error", err, "component", "handler", "role", role.Name)
+		writeError(w, r, fmt.Errorf("failed to update role"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
+		return
+	}
+
+	updated, _ := s.db.GetRole(ctx, role.Name)
+	if updated == nil {
+		updated = role
+	}
+
+	s.logger.Info("role_updated", "role", role.Name, "permissions", role.Permissions, "component", "handler")
+	s.auditf(r, "role.updated", "role", "updated role %q (permissions=%v)", role.Name, role.Permissions)
+
+	writeJSON(w, http.StatusOK, roleToResponse(updated))
+}
+
+// handleDeleteRole deletes a custom role that no user or API key has.
+func (s *Server) handleDeleteRole(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	role, ok := s.customRoleFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	n, err := s.db.CountRoleAssignments(ctx, role.Name)
+	if err != nil {
+		s.logger.Error("count_role_assignments_failed", "error", err, "component", "handler", "role", role.Name)
+		writeError(w, r, fmt.Errorf("failed to delete role"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
+		return
+	}
+	if n > 0 {
+		writeError(w, r, fmt.Errorf("role %q is assigned to %d users or API keys", role.Name, n), apperr.ErrRoleInUse, http.StatusConflict, s.devMode)
+		return
+	}
+
+	if err := s.db.DeleteRole(ctx, role.Name); err != nil {
+		s.logger.Error("delete_role_failed", "error", err, "component", "handler", "role", role.Name)
+		writeError(w, r, fmt.Errorf("failed to delete role"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
+		return
+	}
+
+	s.logger.Info("role_deleted", "role", role.Name, "component", "handler")
+	s.auditf(r, "role.deleted", "role", "deleted role %q", role.Name)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ── Helpers ──────────────────────────────────────────────────────────
+
+// customRoleFromPath loads the custom role named in the path. Built-in
+// roles are rejected, since they cannot be changed.
+func (s *Server) customRoleFromPath(w http.ResponseWriter, r *http.Request) (*db.Role, bool) {
+	name := r.PathValue("name")
+	if _, ok := auth.BuiltinRole(name); ok {
+		writeError(w, r, fmt.Errorf("built-in role %q cannot be changed", name), apperr.ErrValidation, http.StatusBadRequest, s.devMode)
+		return nil, false
+	}
+
+	role, err := s.db.GetRole(r.Context(), name)
+	if err != nil {
+		s.logger.Error("get_role_failed", "error", err, "component", "handler", "role", name)
+		writeError(w, r, fmt.Errorf("failed to get role"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
+		return nil, false
+	}
+	if role == nil {
+		writeError(w, r, fmt.Errorf("role %q not found", name), apperr.ErrRoleNotFound, http.StatusNotFound, s.devMode)
+		return nil, false
+	}
+	return role, true
+}
+
+// canGrant checks that the caller holds every permission in perms, so that
+// nobody can hand out more access than they have. It writes a 403 and
+// returns false otherwise.
+func (s *Server) canGrant(w http.ResponseWriter, r *http.Request, perms []string) bool {
+	if auth.CoversPermissions(auth.PermissionsFromContext(r.Context()), perms) {
+		return true
+	}
+	writeError(w, r, fmt.Errorf("cannot grant permissions you do not have"), apperr.ErrForbidden, http.StatusForbidden, s.devMode)
+	return false
+}
+
+// canGrantRole checks that role is a built-in or custom role whose
+// permissions the caller may grant. It writes an error and returns false
+// otherwise.
+func (s *Server) canGrantRole(w http.ResponseWriter, r *http.Request, field, role string) bool {
+	perms, err := rolePermissions(r.Context(), s.db, role)
+	if err != nil {
+		s.logger.Error("get_role_failed", "error", err, "component", "handler", "role", role)
+		writeError(w, r, fmt.Errorf("failed to get role"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
+		return false
+	}
+	if perms == nil {
+		writeValidationError(w, r, []fieldError{{Field: field, Message: fmt.Sprintf("unknown role %q", role)}})
+		return false
+	}
+	return s.canGrant(w, r, perms)
+}
+
+// rankedRoles orders role names from most to least privileged: admin, then
+// custom roles by name, then viewer, user and member.
+func rankedRoles(roles []string) []string {
+	rank := func(role string) int {
+		switch role {
+		case auth.RoleAdmin:
+			return 0
+		case auth.RoleViewer:
+			return 2
+		case auth.RoleUser:
+			return 3
+		case auth.RoleMember:
+			return 4
+		}
+		return 1
+	}
+	ranked := slices.Clone(roles)
+	slices.SortFunc(ranked, func(a, b string) int {
+		return cmp.Or(cmp.Compare(rank(a), rank(b)), strings.Compare(a, b))
+	})
+	return ranked
+}
+
+func roleToResponse(role *db.Role) roleResponse {
+	return roleResponse{
+		Name:        role.Name,
+		Description: role.Description,
+		Permissions: role.Permissions,
+		CreatedAt:   role.CreatedAt.Unix(),
+		UpdatedAt:   role.UpdatedAt.Unix(),
+	}
+}
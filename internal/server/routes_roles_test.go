@@ -0,0 +1,254 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func sendJSON(t *testing.T, srv *Server, method, path, body string, cookie *http.Cookie) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if cookie != nil {
+		req.AddCookie(cookie)
+	}
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+	return w
+}
+
+// loginWithRole creates a user with role and returns a session for them.
+func loginWithRole(t *testing.T, srv *Server, username, role string) *http.Cookie {
+	t.Helper()
+	createTestUser(t, srv.db, username, username+"password")
+	user, err := srv.db.GetUserByUsername(context.Background(), username)
+	if err != nil || user == nil {
+		t.Fatalf("GetUserByUsername: %v", err)
+	}
+	if err := srv.db.UpdateUserRole(context.Background(), user.ID, role); err != nil {
+		t.Fatalf("UpdateUserRole: %v", err)
+	}
+	return loginSession(t, srv, username, username+"password")
+}
+
+func TestRBAC_ViewerCannotMutate(t *testing.T) {
+	srv := newTestServerFor2FA(t)
+	viewer := loginWithRole(t, srv, "val", "viewer")
+
+	if w := sendWithCookie(t, srv, "GET", "/api/networks", viewer); w.Code != http.StatusOK {
+		t.Errorf("list networks: expected 200, got %d", w.Code)
+	}
+	tests := []struct {
+		method, path, body string
+	}{
+		{"POST", "/api/networks", `{"name":"x"}`},
+		{"DELETE", "/api/networks/1", ``},
+		{"POST", "/api/alerts", `{}`},
+		{"PUT", "/api/settings", `{}`},
+		{"GET", "/api/users", ``},
+		{"GET", "/api/audit-log", ``},
+		{"POST", "/api/roles", `{}`},
+		{"POST", "/api/setup/import", `{}`},
+	}
+	for _, tt := range tests {
+		if w := sendJSON(t, srv, tt.method, tt.path, tt.body, viewer); w.Code != http.StatusForbidden {
+			t.Errorf("%s %s: expected 403, got %d", tt.method, tt.path, w.Code)
+		}
+	}
+}
+
+func TestRoles_CRUD(t *testing.T) {
+	srv := newTestServerFor2FA(t)
+	admin := loginSession(t, srv, "admin", "correctpassword")
+
+	w := sendJSON(t, srv, "POST", "/api/roles", `{"name":"auditor","description":"Reads the audit log","permissions":["audit:read","network:read"]}`, admin)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create: expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w = sendWithCookie(t, srv, "GET", "/api/roles", admin)
+	var roles []roleResponse
+	if err := json.NewDecoder(w.Body).Decode(&roles); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(roles) != 5 || !roles[0].Builtin || roles[4].Name != "auditor" || roles[4].Builtin {
+		t.Fatalf("unexpected roles %+v", roles)
+	}
+
+	// A role change revokes the user's sessions.
+	before := loginWithRole(t, srv, "ann", "viewer")
+	if w := sendJSON(t, srv, "PUT", "/api/users/2", `{"role":"auditor"}`, admin); w.Code != http.StatusOK {
+		t.Fatalf("assign: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := sendWithCookie(t, srv, "GET", "/api/auth/me", before); w.Code != http.StatusUnauthorized {
+		t.Errorf("session before role change: expected 401, got %d", w.Code)
+	}
+	auditor := loginSession(t, srv, "ann", "annpassword")
+	if w := sendWithCookie(t, srv, "GET", "/api/audit-log", auditor); w.Code != http.StatusOK {
+		t.Errorf("audit log: expected 200, got %d", w.Code)
+	}
+	if w := sendWithCookie(t, srv, "GET", "/api/settings", auditor); w.Code != http.StatusForbidden {
+		t.Errorf("settings: expected 403, got %d", w.Code)
+	}
+
+	w = sendJSON(t, srv, "PUT", "/api/roles/auditor", `{"permissions":["audit:read","settings:read"]}`, admin)
+	if w.Code != http.StatusOK {
+		t.Fatalf("update: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := sendWithCookie(t, srv, "GET", "/api/settings", auditor); w.Code != http.StatusOK {
+		t.Errorf("settings after update: expected 200, got %d", w.Code)
+	}
+
+	if w := sendWithCookie(t, srv, "DELETE", "/api/roles/auditor", admin); w.Code != http.StatusConflict {
+		t.Errorf("delete in use: expected 409, got %d", w.Code)
+	}
+	sendJSON(t, srv, "PUT", "/api/users/2", `{"role":"viewer"}`, admin)
+	if w := sendWithCookie(t, srv, "DELETE", "/api/roles/auditor", admin); w.Code != http.StatusNoContent {
+		t.Errorf("delete: expected 204, got %d", w.Code)
+	}
+	if w := sendWithCookie(t, srv, "DELETE", "/api/roles/auditor", admin); w.Code != http.StatusNotFound {
+		t.Errorf("delete again: expected 404, got %d", w.Code)
+	}
+}
+
+func TestRoles_Validation(t *testing.T) {
+	srv := newTestServerFor2FA(t)
+	admin := loginSession(t, srv, "admin", "correctpassword")
+
+	tests := []struct {
+		name, body string
+	}{
+		{"built-in name", `{"name":"admin","permissions":["network:read"]}`},
+		{"bad name", `{"name":"Net Ops","permissions":["network:read"]}`},
+		{"no permissions", `{"name":"netops","permissions":[]}`},
+		{"unknown permission", `{"name":"netops","permissions":["network:delete"]}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := sendJSON(t, srv, "POST", "/api/roles", tt.body, admin); w.Code != http.StatusBadRequest {
+				t.Errorf("expected 400, got %d: %s", w.Code, w.Body.String())
+			}
+		})
+	}
+
+	if w := sendJSON(t, srv, "PUT", "/api/roles/viewer", `{"permissions":["*"]}`, admin); w.Code != http.StatusBadRequest {
+		t.Errorf("update built-in: expected 400, got %d", w.Code)
+	}
+	if w := sendWithCookie(t, srv, "DELETE", "/api/roles/admin", admin); w.Code != http.StatusBadRequest {
+		t.Errorf("delete built-in: expected 400, got %d", w.Code)
+	}
+}
+
+func TestRoles_NoEscalation(t *testing.T) {
+	srv := newTestServerFor2FA(t)
+	admin := loginSession(t, srv, "admin", "correctpassword")
+	w := sendJSON(t, srv, "POST", "/api/roles", `{"name":"usermgr","permissions":["user:*","role:*","network:read"]}`, admin)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create: expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	mgr := loginWithRole(t, srv, "mo", "usermgr")
+
+	if w := sendJSON(t, srv, "POST", "/api/roles", `{"name":"root","permissions":["*"]}`, mgr); w.Code != http.StatusForbidden {
+		t.Errorf("create wider role: expected 403, got %d", w.Code)
+	}
+	if w := sendJSON(t, srv, "PUT", "/api/roles/usermgr", `{"permissions":["settings:write"]}`, mgr); w.Code != http.StatusForbidden {
+		t.Errorf("widen own role: expected 403, got %d", w.Code)
+	}
+	if w := sendJSON(t, srv, "POST", "/api/users", `{"username":"eve","password":"evepassword","role":"admin"}`, mgr); w.Code != http.StatusForbidden {
+		t.Errorf("create admin: expected 403, got %d", w.Code)
+	}
+	if w := sendJSON(t, srv, "PUT", "/api/users/1", `{"role":"viewer"}`, mgr); w.Code != http.StatusForbidden {
+		t.Errorf("demote admin: expected 403, got %d", w.Code)
+	}
+	if w := sendJSON(t, srv, "PUT", "/api/users/2", `{"role":"admin"}`, mgr); w.Code != http.StatusBadRequest {
+		t.Errorf("change own role: expected 400, got %d", w.Code)
+	}
+
+	if w := sendJSON(t, srv, "POST", "/api/roles", `{"name":"reader","permissions":["network:read"]}`, mgr); w.Code != http.StatusCreated {
+		t.Errorf("create narrower role: expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := sendJSON(t, srv, "POST", "/api/users", `{"username":"rita","password":"ritapassword","role":"reader"}`, mgr); w.Code != http.StatusCreated {
+		t.Errorf("create user with narrower role: expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestAPIKey_CappedByCreator(t *testing.T) {
+	srv := newTestServerFor2FA(t)
+	admin := loginSession(t, srv, "admin", "correctpassword")
+	viewer := loginWithRole(t, srv, "val", "viewer")
+
+	if w := sendJSON(t, srv, "POST", "/api/api-keys", `{"name":"ci","role":"admin"}`, viewer); w.Code != http.StatusForbidden {
+		t.Errorf("viewer creating admin key: expected 403, got %d", w.Code)
+	}
+	w := sendJSON(t, srv, "POST", "/api/api-keys", `{"name":"ci"}`, viewer)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("viewer creating key: expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var viewerKey createAPIKeyResponse
+	json.NewDecoder(w.Body).Decode(&viewerKey)
+	if viewerKey.Role != "viewer" {
+		t.Errorf("expected the key to default to the creator's role, got %q", viewerKey.Role)
+	}
+
+	bob := loginWithRole(t, srv, "bob", "admin")
+	w = sendJSON(t, srv, "POST", "/api/api-keys", `{"name":"deploy","role":"admin"}`, bob)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("admin creating key: expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var key createAPIKeyResponse
+	json.NewDecoder(w.Body).Decode(&key)
+
+	withKey := func(path string) int {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("Authorization", "Bearer "+key.Key)
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, req)
+		return w.Code
+	}
+	if code := withKey("/api/users"); code != http.StatusOK {
+		t.Fatalf("admin key: expected 200, got %d", code)
+	}
+
+	// Demoting the creator caps the key at the creator's new role.
+	if w := sendJSON(t, srv, "PUT", "/api/users/3", `{"role":"viewer"}`, admin); w.Code != http.StatusOK {
+		t.Fatalf("demote: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if code := withKey("/api/users"); code != http.StatusForbidden {
+		t.Errorf("key of demoted user: expected 403, got %d", code)
+	}
+	if code := withKey("/api/networks"); code != http.StatusOK {
+		t.Errorf("key of demoted user reading networks: expected 200, got %d", code)
+	}
+
+	// Viewers cannot see or delete other users' keys.
+	if w := sendWithCookie(t, srv, "DELETE", "/api/api-keys/"+strconv.FormatInt(key.ID, 10), viewer); w.Code != http.StatusNotFound {
+		t.Errorf("delete other user's key: expected 404, got %d", w.Code)
+	}
+	if w := sendWithCookie(t, srv, "DELETE", "/api/api-keys/"+strconv.FormatInt(viewerKey.ID, 10), viewer); w.Code != http.StatusOK {
+		t.Errorf("delete own key: expected 200, got %d", w.Code)
+	}
+}
+
+func TestRoleForGroups_MostPrivilegedWins(t *testing.T) {
+	mapping := map[string]string{"ops": "operator", "audit": "auditor", "staff": "viewer", "root": "admin"}
+	tests := []struct {
+		groups []string
+		want   string
+	}{
+		{[]string{"staff", "ops"}, "operator"},
+		{[]string{"ops", "audit"}, "auditor"},
+		{[]string{"ops", "ROOT"}, "admin"},
+		{[]string{"staff"}, "viewer"},
+		{[]string{"other"}, "fallback"},
+	}
+	for _, tt := range tests {
+		if got := roleForGroups(tt.groups, mapping, "fallback"); got != tt.want {
+			t.Errorf("roleForGroups(%v) = %q, want %q", tt.groups, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package server
+
+import (
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/itsChris/wgpilot/internal/auth"
+	"github.com/itsChris/wgpilot/internal/db"
+	apperr "github.com/itsChris/wgpilot/internal/errors"
+)
+
+// ── Request/Response types ───────────────────────────────────────────
+
+type peerSessionResponse struct {
+	ID              int64  `json:"id"`
+	StartedAt       int64  `json:"started_at"`
+	LastSeenAt      int64  `json:"last_seen_at"`
+	EndedAt         *int64 `json:"ended_at"`
+	DurationSeconds int64  `json:"duration_seconds"`
+	Endpoint        string `json:"endpoint"`
+	RxBytes         int64  `json:"rx_bytes"`
+	TxBytes         int64  `json:"tx_bytes"`
+
+	Location *locationResponse `json:"location,omitempty"`
+}
+
+// ── Handlers ─────────────────────────────────────────────────────────
+
+// handlePeerSessions returns a peer's connection sessions, most recent first.
+// Query params: from, to (unix timestamps, default last 30 days), and
+// format=csv to download the sessions as a CSV file instead of JSON.
+func (s *Server) handlePeerSessions(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	networkID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("invalid network ID"), apperr.ErrValidation, http.StatusBadRequest, s.devMode)
+		return
+	}
+
+	peerID, err := strconv.ParseInt(r.PathValue("pid"), 10, 64)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("invalid peer ID"), apperr.ErrValidation, http.StatusBadRequest, s.devMode)
+		return
+	}
+
+	peer, err := s.db.GetPeerByID(ctx, peerID)
+	if err != nil {
+		s.logger.Error("get_peer_failed",
+			"error", err,
+			"operation", "peer_sessions",
+			"component", "handler",
+			"peer_id", peerID,
+		)
+		writeError(w, r, fmt.Errorf("failed to get peer"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
+		return
+	}
+	if peer == nil || peer.NetworkID != networkID || !canAccessPeer(r, peer, auth.PermPeerRead) {
+		writeError(w, r, fmt.Errorf("peer %d not found in network %d", peerID, networkID), apperr.ErrPeerNotFound, http.StatusNotFound, s.devMode)
+		return
+	}
+
+	q := r.URL.Query()
+
+	to := time.Now()
+	from := to.AddDate(0, 0, -30)
+	if v := q.Get("from"); v != "" {
+		if ts, err := strconv.ParseInt(v, 10, 64); err == nil {
+			from = time.Unix(ts, 0)
+		}
+	}
+	if v := q.Get("to"); v != "" {
+		if ts, err := strconv.ParseInt(v, 10, 64); err == nil {
+			to = time.Unix(ts, 0)
+		}
+	}
+
+	format := q.Get("format")
+	if format != "" && format != "json" && format != "csv" {
+		writeError(w, r, fmt.Errorf("format must be json or csv"), apperr.ErrValidation, http.StatusBadRequest, s.devMode)
+		return
+	}
+
+	sessions, err := s.ts.ListPeerSessions(ctx, peerID, from, to)
+	if err != nil {
+		s.logger.Error("list_sessions_failed",
+			"error", err,
+			"operation", "peer_sessions",
+			"component", "handler",
+			"peer_id", peerID,
+		)
+		writeError(w, r, fmt.Errorf("failed to list sessions"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
+		return
+	}
+
+	if format == "csv" {
+		s.writeSessionsCSV(w, peer, sessions)
+		return
+	}
+
+	result := make([]peerSessionResponse, 0, len(sessions))
+	for _, sess := range sessions {
+		resp := toSessionResponse(sess)
+		resp.Location = s.locate(sess.Endpoint)
+		result = append(result, resp)
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// writeSessionsCSV writes sessions as a CSV attachment with RFC 3339 UTC
+// timestamps. ended_at is empty for a session that is still open, and the
+// location columns are empty without a GeoIP database.
+func (s *Server) writeSessionsCSV(w http.ResponseWriter, peer *db.Peer, sessions []db.PeerSession) {
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="wgpilot-%s-sessions.csv"`, safeFilename(peer.Name)))
+	w.WriteHeader(http.StatusOK)
+
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"started_at", "ended_at", "duration_seconds", "endpoint", "rx_bytes", "tx_bytes", "country", "city", "asn", "as_org"})
+	for _, sess := range sessions {
+		resp := toSessionResponse(sess)
+		endedAt := ""
+		if sess.EndedAt != nil {
+			endedAt = sess.EndedAt.UTC().Format(time.RFC3339)
+		}
+		var country, city, asn, asOrg string
+		if loc := s.locate(sess.Endpoint); loc != nil {
+			country, city, asOrg = loc.Country, loc.City, loc.ASOrg
+			if loc.ASN != 0 {
+				asn = strconv.FormatUint(uint64(loc.ASN), 10)
+			}
+		}
+		cw.Write([]string{
+			sess.StartedAt.UTC().Format(time.RFC3339),
+			endedAt,
+			strconv.FormatInt(resp.DurationSeconds, 10),
+			sess.Endpoint,
+			strconv.FormatInt(sess.RxBytes, 10),
+			strconv.FormatInt(sess.TxBytes, 10),
+			country, city, asn, asOrg,
+		})
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		s.logger.Warn("write_sessions_csv_failed",
+			"error", err,
+			"operation", "peer_sessions",
+			"component", "handler",
+			"peer_id", peer.ID,
+		)
+	}
+}
+
+// toSessionResponse converts a session. The duration of an open session runs
+// up to the last time the peer was seen online.
+func toSessionResponse(sess db.PeerSession) peerSessionResponse {
+	resp := peerSessionResponse{
+		ID:         sess.ID,
+		StartedAt:  sess.StartedAt.Unix(),
+		LastSeenAt: sess.LastSeenAt.Unix(),
+		Endpoint:   sess.Endpoint,
+		RxBytes:    sess.RxBytes,
+		TxBytes:    sess.TxBytes,
+	}
+	end := sess.LastSeenAt
+	if sess.EndedAt != nil {
+		endedAt := sess.EndedAt.Unix()
+		resp.EndedAt = &endedAt
+		end = *sess.EndedAt
+	}
+	resp.DurationSeconds = int64(end.Sub(sess.StartedAt).Seconds())
+	return resp
+}
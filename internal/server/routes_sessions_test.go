@@ -0,0 +1,157 @@
+package server
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/itsChris/wgpilot/internal/db"
+)
+
+// createSessionFixture creates a peer with one closed and one open session.
+func createSessionFixture(t *testing.T, srv *Server, netID int64, now time.Time) int64 {
+	t.Helper()
+	ctx := context.Background()
+
+	peerID, err := srv.db.CreatePeer(ctx, &db.Peer{
+		NetworkID:  netID,
+		Name:       "Laptop",
+		PublicKey:  "peer-pub-key",
+		AllowedIPs: "10.0.0.2/32",
+		Role:       "client",
+		Enabled:    true,
+	})
+	if err != nil {
+		t.Fatalf("create peer: %v", err)
+	}
+
+	snapshots := []db.PeerSnapshot{
+		{Timestamp: now.Add(-3 * time.Hour), Online: true, Endpoint: "198.51.100.7:40000", RxDelta: 100, TxDelta: 10},
+		{Timestamp: now.Add(-2 * time.Hour), Online: true, RxDelta: 200, TxDelta: 20},
+		{Timestamp: now.Add(-time.Hour), Online: false},
+		{Timestamp: now, Online: true, Endpoint: "203.0.113.1:51820", RxDelta: 50, TxDelta: 5},
+	}
+	for i := range snapshots {
+		snapshots[i].PeerID = peerID
+		if err := srv.ts.InsertSnapshot(ctx, &snapshots[i]); err != nil {
+			t.Fatalf("insert snapshot: %v", err)
+		}
+	}
+	return peerID
+}
+
+func TestPeerSessions_JSON(t *testing.T) {
+	srv, _, _ := newTestServerWithWG(t)
+	netID := createTestNetwork(t, srv)
+	now := time.Now().Truncate(time.Second)
+	peerID := createSessionFixture(t, srv, netID, now)
+
+	req := httptest.NewRequest("GET", fmt.Sprintf("/api/networks/%d/peers/%d/sessions", netID, peerID), nil)
+	req = authRequest(t, srv, req)
+	w := httptest.NewRecorder()
+
+	srv.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp []peerSessionResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(resp) != 2 {
+		t.Fatalf("expected 2 sessions, got %d", len(resp))
+	}
+	if open := resp[0]; open.EndedAt != nil || open.Endpoint != "203.0.113.1:51820" {
+		t.Errorf("expected open session first, got %+v", open)
+	}
+	closed := resp[1]
+	if closed.EndedAt == nil || *closed.EndedAt != now.Add(-2*time.Hour).Unix() {
+		t.Errorf("expected session closed at last online snapshot, got %+v", closed)
+	}
+	if closed.DurationSeconds != 3600 || closed.RxBytes != 300 || closed.TxBytes != 30 {
+		t.Errorf("unexpected closed session: %+v", closed)
+	}
+}
+
+func TestPeerSessions_CSV(t *testing.T) {
+	srv, _, _ := newTestServerWithWG(t)
+	netID := createTestNetwork(t, srv)
+	now := time.Now().Truncate(time.Second)
+	peerID := createSessionFixture(t, srv, netID, now)
+
+	req := httptest.NewRequest("GET", fmt.Sprintf("/api/networks/%d/peers/%d/sessions?format=csv", netID, peerID), nil)
+	req = authRequest(t, srv, req)
+	w := httptest.NewRecorder()
+
+	srv.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/csv") {
+		t.Errorf("expected text/csv, got %q", ct)
+	}
+	if cd := w.Header().Get("Content-Disposition"); !strings.Contains(cd, "wgpilot-Laptop-sessions.csv") {
+		t.Errorf("unexpected Content-Disposition %q", cd)
+	}
+
+	records, err := csv.NewReader(w.Body).ReadAll()
+	if err != nil {
+		t.Fatalf("parse csv: %v", err)
+	}
+	if len(records) != 3 {
+		t.Fatalf("expected header and 2 rows, got %d", len(records))
+	}
+	if records[0][0] != "started_at" {
+		t.Errorf("unexpected header: %v", records[0])
+	}
+	if records[1][1] != "" {
+		t.Errorf("expected empty ended_at for open session, got %q", records[1][1])
+	}
+	want := []string{
+		now.Add(-3 * time.Hour).UTC().Format(time.RFC3339),
+		now.Add(-2 * time.Hour).UTC().Format(time.RFC3339),
+		"3600", "198.51.100.7:40000", "300", "30",
+	}
+	for i, v := range want {
+		if records[2][i] != v {
+			t.Errorf("column %d: expected %q, got %q", i, v, records[2][i])
+		}
+	}
+}
+
+func TestPeerSessions_Validation(t *testing.T) {
+	srv, _, _ := newTestServerWithWG(t)
+	netID := createTestNetwork(t, srv)
+	peerID := createSessionFixture(t, srv, netID, time.Now())
+
+	tests := []struct {
+		name string
+		path string
+		want int
+	}{
+		{"unknown peer", fmt.Sprintf("/api/networks/%d/peers/999/sessions", netID), http.StatusNotFound},
+		{"wrong network", fmt.Sprintf("/api/networks/%d/peers/%d/sessions", netID+1, peerID), http.StatusNotFound},
+		{"bad format", fmt.Sprintf("/api/networks/%d/peers/%d/sessions?format=xml", netID, peerID), http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tt.path, nil)
+			req = authRequest(t, srv, req)
+			w := httptest.NewRecorder()
+
+			srv.ServeHTTP(w, req)
+
+			if w.Code != tt.want {
+				t.Fatalf("expected %d, got %d: %s", tt.want, w.Code, w.Body.String())
+			}
+		})
+	}
+}
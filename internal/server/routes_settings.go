@@ -5,6 +5,7 @@ import (
 	"net/http"
 
 	apperr "github.com/itsChris/wgpilot/internal/errors"
+	"github.com/itsChris/wgpilot/internal/notify"
 )
 
 // sensitiveSettings are filtered from the GET /api/settings response.
@@ -20,16 +21,18 @@ var sensitiveSettings = map[string]bool{
 
 // allowedSettings are the only keys that can be updated via PUT /api/settings.
 var allowedSettings = map[string]bool{
-	"public_ip":    true,
-	"hostname":     true,
-	"dns_servers":  true,
-	"smtp_host":    true,
-	"smtp_port":    true,
-	"smtp_user":    true,
-	"smtp_pass":    true,
-	"smtp_from":    true,
-	"smtp_tls":     true,
-	"alert_email":  true,
+	"public_ip":                 true,
+	"hostname":                  true,
+	"dns_servers":               true,
+	"smtp_host":                 true,
+	"smtp_port":                 true,
+	"smtp_user":                 true,
+	"smtp_pass":                 true,
+	"smtp_from":                 true,
+	"smtp_tls":                  true,
+	"alert_email":               true,
+	"peer_config_email_subject": true,
+	"peer_config_email_body":    true,
 }
 
 // handleGetSettings returns all non-sensitive settings.
@@ -72,6 +75,12 @@ func (s *Server) handleUpdateSettings(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	// Email templates must render, or configs could not be sent.
+	if fields := validateEmailTemplates(req); len(fields) > 0 {
+		writeValidationError(w, r, fields)
+		return
+	}
+
 	// Save each setting.
 	for k, v := range req {
 		if err := s.db.SetSetting(ctx, k, v); err != nil {
@@ -87,3 +96,20 @@ func (s *Server) handleUpdateSettings(w http.ResponseWriter, r *http.Request) {
 	// Return updated settings.
 	s.handleGetSettings(w, r)
 }
+
+// validateEmailTemplates renders the peer config email templates in req
+// with empty data.
+func validateEmailTemplates(req map[string]string) []fieldError {
+	var errs []fieldError
+	if subject, ok := req["peer_config_email_subject"]; ok {
+		if _, _, err := notify.PeerConfigEmail(subject, "", notify.PeerConfigData{}); err != nil {
+			errs = append(errs, fieldError{"peer_config_email_subject", err.Error()})
+		}
+	}
+	if body, ok := req["peer_config_email_body"]; ok {
+		if _, _, err := notify.PeerConfigEmail("", body, notify.PeerConfigData{}); err != nil {
+			errs = append(errs, fieldError{"peer_config_email_body", err.Error()})
+		}
+	}
+	return errs
+}
@@ -13,6 +13,7 @@ import (
 	"github.com/itsChris/wgpilot/internal/auth"
 	"github.com/itsChris/wgpilot/internal/db"
 	apperr "github.com/itsChris/wgpilot/internal/errors"
+	"github.com/itsChris/wgpilot/internal/events"
 	"github.com/itsChris/wgpilot/internal/wg"
 )
 
@@ -184,8 +185,8 @@ func (s *Server) handleSetupStep1(w http.ResponseWriter, r *http.Request) {
 	if !isValidName(req.Username) {
 		errs = append(errs, fieldError{"username", "1-64 alphanumeric characters, hyphens, underscores"})
 	}
-	if len(req.Password) < auth.MinPasswordLength {
-		errs = append(errs, fieldError{"password", fmt.Sprintf("must be at least %d characters", auth.MinPasswordLength)})
+	if err := s.passwords.Validate(req.Password); err != nil {
+		errs = append(errs, fieldError{"password", err.Error()})
 	}
 	if len(errs) > 0 {
 		writeValidationError(w, r, errs)
@@ -255,7 +256,7 @@ func (s *Server) handleSetupStep1(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Issue JWT session.
-	token, err := s.jwtService.Generate(userID, req.Username, "admin")
+	token, err := s.issueSession(r, userID, req.Username, "admin")
 	if err != nil {
 		s.logger.Error("setup_step1_token_failed",
 			"error", err,
@@ -479,7 +480,7 @@ func (s *Server) handleSetupStep3(w http.ResponseWriter, r *http.Request) {
 	// Apply nftables rules.
 	if s.nftManager != nil {
 		// Open the UDP listen port in the firewall.
-		if portErr := s.nftManager.OpenUDPPort(req.ListenPort); portErr != nil {
+		if portErr := s.nftManager.OpenUDPPort(ctx, req.ListenPort); portErr != nil {
 			s.logger.Error("setup_step3_open_port_failed",
 				"error", portErr,
 				"port", req.ListenPort,
@@ -492,7 +493,7 @@ func (s *Server) handleSetupStep3(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 		if req.NATEnabled {
-			if natErr := s.nftManager.AddNATMasquerade(ifaceName, req.Subnet); natErr != nil {
+			if natErr := s.nftManager.AddNATMasquerade(ctx, ifaceName, req.Subnet); natErr != nil {
 				s.logger.Error("setup_step3_nat_failed",
 					"error", natErr,
 					"interface", ifaceName,
@@ -506,7 +507,7 @@ func (s *Server) handleSetupStep3(w http.ResponseWriter, r *http.Request) {
 			}
 		}
 		if req.InterPeerRouting {
-			if fwdErr := s.nftManager.EnableInterPeerForwarding(ifaceName); fwdErr != nil {
+			if fwdErr := s.nftManager.EnableInterPeerForwarding(ctx, ifaceName); fwdErr != nil {
 				s.logger.Error("setup_step3_forwarding_failed",
 					"error", fwdErr,
 					"interface", ifaceName,
@@ -922,10 +923,25 @@ func (s *Server) handleDetectPublicIP(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, map[string]string{"public_ip": ip})
 }
 
-// handleImportConfig imports a wg-quick configuration file.
+// handleImportConfig imports a wg-quick configuration file. Like the other
+// setup steps it is only available while setup is in progress.
 func (s *Server) handleImportConfig(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
+	complete, _, err := s.getSetupState(ctx)
+	if err != nil {
+		s.logger.Error("setup_import_state_check_failed",
+			"error", err,
+			"component", "setup",
+		)
+		writeError(w, r, fmt.Errorf("internal error"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
+		return
+	}
+	if complete {
+		writeError(w, r, fmt.Errorf("setup already completed"), apperr.ErrSetupComplete, http.StatusConflict, s.devMode)
+		return
+	}
+
 	var req struct {
 		Config string `json:"config"`
 		Name   string `json:"name"`
@@ -1024,11 +1040,34 @@ func (s *Server) handleImportConfig(w http.ResponseWriter, r *http.Request) {
 		"peers_imported", importedPeers,
 		"component", "handler",
 	)
-	s.auditf(r, "network.imported", "network", "imported network %q (id=%d) with %d peers", req.Name, netID, importedPeers)
+	s.auditNetworkf(r, netID, "network.imported", "network", "imported network %q (id=%d) with %d peers", req.Name, netID, importedPeers)
+	s.events.Publish(events.Event{Type: events.TypeNetworkImported, NetworkID: netID, Data: map[string]any{"name": req.Name, "peers": importedPeers}})
+	if created, _ := s.db.GetNetworkByID(ctx, netID); created != nil {
+		s.resourceChanged(r, "network.imported", "network", netID, nil, networkToResponse(created))
+	}
+	if peers, err := s.db.ListPeersByNetworkID(ctx, netID); err == nil {
+		for _, p := range peers {
+			s.resourceChanged(r, "peer.created", "peer", p.ID, nil, peerToResponse(&p))
+		}
+	}
+
+	// PreUp/PostUp/PreDown/PostDown are not run by wgpilot. Report them so
+	// the admin can move them to event hooks.
+	ignored := parsed.Commands()
+	if len(ignored) > 0 {
+		s.logger.Warn("import_commands_ignored",
+			"network_id", netID,
+			"commands", ignored,
+			"component", "handler",
+		)
+	} else {
+		ignored = []string{}
+	}
 
 	writeJSON(w, http.StatusCreated, map[string]any{
-		"network_id":     netID,
-		"interface":      ifaceName,
-		"peers_imported": importedPeers,
+		"network_id":       netID,
+		"interface":        ifaceName,
+		"peers_imported":   importedPeers,
+		"ignored_commands": ignored,
 	})
 }
@@ -272,7 +272,7 @@ func TestSetupStep2_RequiresStep1(t *testing.T) {
 	srv := newSetupTestServer(t)
 
 	// Create a valid token to bypass auth but not setup state.
-	token, err := srv.jwtService.Generate(1, "admin", "admin")
+	token, err := adminSession(t, srv)
 	if err != nil {
 		t.Fatalf("Generate: %v", err)
 	}
@@ -507,6 +507,7 @@ func TestSetupEndpoints_409AfterCompletion(t *testing.T) {
 		{"POST", "/api/setup/step/2", `{"public_ip":"1.2.3.4"}`, true},
 		{"POST", "/api/setup/step/3", `{"name":"X","mode":"gateway","subnet":"10.1.0.0/24","listen_port":51821}`, true},
 		{"POST", "/api/setup/step/4", `{"name":"X","role":"client"}`, true},
+		{"POST", "/api/setup/import", `{"config":"[Interface]"}`, true},
 	}
 
 	for _, tt := range tests {
@@ -530,7 +531,7 @@ func TestSetupGuard_BlocksAPIDuringSetup(t *testing.T) {
 	srv := newSetupTestServer(t)
 
 	// Generate a valid token to test the guard (not auth).
-	token, err := srv.jwtService.Generate(1, "admin", "admin")
+	token, err := adminSession(t, srv)
 	if err != nil {
 		t.Fatalf("Generate: %v", err)
 	}
@@ -563,7 +564,7 @@ func TestSetupGuard_AllowsAfterComplete(t *testing.T) {
 	}
 
 	// Generate a valid token.
-	token, err := srv.jwtService.Generate(1, "admin", "admin")
+	token, err := adminSession(t, srv)
 	if err != nil {
 		t.Fatalf("Generate: %v", err)
 	}
@@ -0,0 +1,423 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/itsChris/wgpilot/internal/auth"
+	"github.com/itsChris/wgpilot/internal/db"
+	apperr "github.com/itsChris/wgpilot/internal/errors"
+	"github.com/itsChris/wgpilot/internal/wg"
+)
+
+const (
+	defaultShareLinkLifetime = 24 * time.Hour
+	maxShareLinkLifetime     = 30 * 24 * time.Hour
+	maxShareLinkUses         = 100
+)
+
+type createShareLinkRequest struct {
+	ExpiresIn string `json:"expires_in"` // e.g. "1h", default 24h, at most 720h
+	MaxUses   int    `json:"max_uses"`   // downloads allowed, default 1
+}
+
+type createShareLinkResponse struct {
+	shareLinkResponse
+	Token     string `json:"token"`      // only returned on creation
+	ConfigURL string `json:"config_url"` // path of the public .conf download
+	QRURL     string `json:"qr_url"`     // path of the public QR code download
+}
+
+type shareLinkResponse struct {
+	ID          int64   `json:"id"`
+	PeerID      int64   `json:"peer_id"`
+	TokenPrefix string  `json:"token_prefix"`
+	MaxUses     int     `json:"max_uses"`
+	UseCount    int     `json:"use_count"`
+	ExpiresAt   string  `json:"expires_at"`
+	LastUsedAt  *string `json:"last_used_at"`
+	LastUsedIP  string  `json:"last_used_ip"`
+	RevokedAt   *string `json:"revoked_at"`
+	CreatedAt   string  `json:"created_at"`
+	Usable      bool    `json:"usable"`
+}
+
+// linkedPeer looks up the peer in the {id} and {pid} path values for the
+// share link routes. On failure it writes the error response and returns
+// nil.
+func (s *Server) linkedPeer(w http.ResponseWriter, r *http.Request, operation string) *db.Peer {
+	networkID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("invalid network ID"), apperr.ErrValidation, http.StatusBadRequest, s.devMode)
+		return nil
+	}
+
+	peerID, err := strconv.ParseInt(r.PathValue("pid"), 10, 64)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("invalid peer ID"), apperr.ErrValidation, http.StatusBadRequest, s.devMode)
+		return nil
+	}
+
+	peer, err := s.db.GetPeerByID(r.Context(), peerID)
+	if err != nil {
+		s.logger.Error("get_peer_failed",
+			"error", err,
+			"operation", operation,
+			"component", "handler",
+			"peer_id", peerID,
+		)
+		writeError(w, r, fmt.Errorf("failed to get peer"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
+		return nil
+	}
+	if peer == nil || peer.NetworkID != networkID || !canAccessPeer(r, peer, auth.PermPeerWrite) {
+		writeError(w, r, fmt.Errorf("peer %d not found in network %d", peerID, networkID), apperr.ErrPeerNotFound, http.StatusNotFound, s.devMode)
+		return nil
+	}
+	return peer
+}
+
+// handleListShareLinks lists a peer's share links, newest first.
+func (s *Server) handleListShareLinks(w http.ResponseWriter, r *http.Request) {
+	peer := s.linkedPeer(w, r, "list_share_links")
+	if peer == nil {
+		return
+	}
+
+	links, err := s.db.ListShareLinks(r.Context(), peer.ID)
+	if err != nil {
+		s.logger.Error("list_share_links_failed",
+			"error", err,
+			"operation", "list_share_links",
+			"component", "handler",
+			"peer_id", peer.ID,
+		)
+		writeError(w, r, fmt.Errorf("failed to list share links"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
+		return
+	}
+
+	now := time.Now()
+	resp := make([]shareLinkResponse, 0, len(links))
+	for i := range links {
+		resp = append(resp, shareLinkToResponse(&links[i], peer, now))
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// handleCreateShareLink creates a link that downloads a peer's config or QR
+// code without a session. The token is returned once and only its hash is
+// stored.
+func (s *Server) handleCreateShareLink(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	peer := s.linkedPeer(w, r, "create_share_link")
+	if peer == nil {
+		return
+	}
+
+	var req createShareLinkRequest
+	if code, status, err := decodeJSON(r, &req); err != nil {
+		writeError(w, r, err, code, status, s.devMode)
+		return
+	}
+
+	// Validate.
+	var fields []fieldError
+	lifetime := defaultShareLinkLifetime
+	if req.ExpiresIn != "" {
+		d, err := time.ParseDuration(req.ExpiresIn)
+		if err != nil || d <= 0 || d > maxShareLinkLifetime {
+			fields = append(fields, fieldError{Field: "expires_in", Message: "must be a duration up to 720h (e.g. '24h')"})
+		} else {
+			lifetime = d
+		}
+	}
+	if req.MaxUses == 0 {
+		req.MaxUses = 1
+	}
+	if req.MaxUses < 1 || req.MaxUses > maxShareLinkUses {
+		fields = append(fields, fieldError{Field: "max_uses", Message: fmt.Sprintf("must be between 1 and %d", maxShareLinkUses)})
+	}
+	if len(fields) > 0 {
+		writeValidationError(w, r, fields)
+		return
+	}
+
+	if peer.PrivateKey == "" {
+		writeError(w, r, fmt.Errorf("peer %d enrolled with its own key; the server has no config to share", peer.ID), apperr.ErrPrivateKeyUnavailable, http.StatusConflict, s.devMode)
+		return
+	}
+
+	token, hash, prefix, err := auth.GenerateShareToken()
+	if err != nil {
+		s.logger.Error("generate_share_token_failed",
+			"error", err,
+			"operation", "create_share_link",
+			"component", "handler",
+		)
+		writeError(w, r, fmt.Errorf("failed to generate share link"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
+		return
+	}
+
+	id, err := s.db.CreateShareLink(ctx, &db.ShareLink{
+		PeerID:      peer.ID,
+		TokenHash:   hash,
+		TokenPrefix: prefix,
+		PublicKey:   peer.PublicKey,
+		MaxUses:     req.MaxUses,
+		ExpiresAt:   time.Now().Add(lifetime),
+		CreatedBy:   callerID(r),
+	})
+	if err != nil {
+		s.logger.Error("create_share_link_failed",
+			"error", err,
+			"operation", "create_share_link",
+			"component", "handler",
+			"peer_id", peer.ID,
+		)
+		writeError(w, r, fmt.Errorf("failed to create share link"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
+		return
+	}
+
+	link, err := s.db.GetShareLinkByID(ctx, id)
+	if err != nil || link == nil {
+		s.logger.Error("get_created_share_link_failed",
+			"error", err,
+			"operation", "create_share_link",
+			"component", "handler",
+			"share_link_id", id,
+		)
+		writeError(w, r, fmt.Errorf("failed to retrieve created share link"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
+		return
+	}
+
+	s.logger.Info("share_link_created",
+		"share_link_id", id,
+		"peer_id", peer.ID,
+		"max_uses", req.MaxUses,
+		"component", "handler",
+	)
+	s.auditNetworkf(r, peer.NetworkID, "peer.share_link_created", "peer", "created share link %s (id=%d) for peer %q (id=%d), %d use(s) until %s",
+		prefix, id, peer.Name, peer.ID, req.MaxUses, link.ExpiresAt.Format(time.RFC3339))
+
+	writeJSON(w, http.StatusCreated, createShareLinkResponse{
+		shareLinkResponse: shareLinkToResponse(link, peer, time.Now()),
+		Token:             token,
+		ConfigURL:         "/api/share/" + token + "/config",
+		QRURL:             "/api/share/" + token + "/qr",
+	})
+}
+
+// handleRevokeShareLink stops a share link from being used.
+func (s *Server) handleRevokeShareLink(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	peer := s.linkedPeer(w, r, "revoke_share_link")
+	if peer == nil {
+		return
+	}
+
+	linkID, err := strconv.ParseInt(r.PathValue("lid"), 10, 64)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("invalid share link ID"), apperr.ErrValidation, http.StatusBadRequest, s.devMode)
+		return
+	}
+
+	link, err := s.db.GetShareLinkByID(ctx, linkID)
+	if err != nil {
+		s.logger.Error("get_share_link_failed",
+			"error", err,
+			"operation", "revoke_share_link",
+			"component", "handler",
+			"share_link_id", linkID,
+		)
+		writeError(w, r, fmt.Errorf("failed to get share link"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
+		return
+	}
+	if link == nil || link.PeerID != peer.ID {
+		writeError(w, r, fmt.Errorf("share link %d not found for peer %d", linkID, peer.ID), apperr.ErrShareLinkNotFound, http.StatusNotFound, s.devMode)
+		return
+	}
+
+	if _, err := s.db.RevokeShareLink(ctx, linkID); err != nil {
+		s.logger.Error("revoke_share_link_failed",
+			"error", err,
+			"operation", "revoke_share_link",
+			"component", "handler",
+			"share_link_id", linkID,
+		)
+		writeError(w, r, fmt.Errorf("failed to revoke share link"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
+		return
+	}
+
+	s.logger.Info("share_link_revoked",
+		"share_link_id", linkID,
+		"peer_id", peer.ID,
+		"component", "handler",
+	)
+	s.auditNetworkf(r, peer.NetworkID, "peer.share_link_revoked", "peer", "revoked share link %s (id=%d) for peer %q (id=%d)", link.TokenPrefix, linkID, peer.Name, peer.ID)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ── Public share link routes ─────────────────────────────────────────
+
+// handleSharedConfig serves a peer's .conf file through a share link.
+func (s *Server) handleSharedConfig(w http.ResponseWriter, r *http.Request) {
+	s.serveSharedPeer(w, r, false)
+}
+
+// handleSharedQR serves a peer's config QR code through a share link.
+func (s *Server) handleSharedQR(w http.ResponseWriter, r *http.Request) {
+	s.serveSharedPeer(w, r, true)
+}
+
+// serveSharedPeer serves the config or QR code of the peer behind the
+// {token} path value, counting one use of the link. Unknown, revoked,
+// expired and used-up links, and links to peers that have since been
+// disabled or rotated, all get the same 404.
+func (s *Server) serveSharedPeer(w http.ResponseWriter, r *http.Request, qr bool) {
+	ctx := r.Context()
+	operation := "shared_config"
+	if qr {
+		operation = "shared_qr"
+	}
+
+	if !s.allowAuthAttempt(w, r) {
+		return
+	}
+
+	notFound := func() {
+		writeError(w, r, fmt.Errorf("share link not found or no longer valid"), apperr.ErrShareLinkNotFound, http.StatusNotFound, s.devMode)
+	}
+
+	link, err := s.db.GetShareLinkByHash(ctx, auth.HashShareToken(r.PathValue("token")))
+	if err != nil {
+		s.logger.Error("get_share_link_failed",
+			"error", err,
+			"operation", operation,
+			"component", "handler",
+		)
+		writeError(w, r, fmt.Errorf("failed to get share link"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
+		return
+	}
+	if link == nil {
+		notFound()
+		return
+	}
+
+	peer, err := s.db.GetPeerByID(ctx, link.PeerID)
+	if err != nil {
+		s.logger.Error("get_peer_failed",
+			"error", err,
+			"operation", operation,
+			"component", "handler",
+			"peer_id", link.PeerID,
+		)
+		writeError(w, r, fmt.Errorf("failed to get peer"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
+		return
+	}
+	if !link.Usable(peer, time.Now()) {
+		notFound()
+		return
+	}
+
+	network, err := s.db.GetNetworkByID(ctx, peer.NetworkID)
+	if err != nil || network == nil {
+		notFound()
+		return
+	}
+
+	conf, err := s.peerClientConfig(ctx, network, peer, operation)
+	if err != nil {
+		s.logger.Error("generate_config_failed",
+			"error", err,
+			"operation", operation,
+			"component", "handler",
+			"peer_id", peer.ID,
+		)
+		writeError(w, r, fmt.Errorf("failed to generate config"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
+		return
+	}
+	var png []byte
+	if qr {
+		png, err = wg.GenerateQRCode(conf, 256)
+		if err != nil {
+			s.logger.Error("generate_qr_failed",
+				"error", err,
+				"operation", operation,
+				"component", "handler",
+				"peer_id", peer.ID,
+			)
+			writeError(w, r, fmt.Errorf("failed to generate QR code"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
+			return
+		}
+	}
+
+	// Count the use last, so that a failed download does not use up the link.
+	ip := auth.ClientIP(r)
+	claimed, err := s.db.ClaimShareLink(ctx, link.ID, ip)
+	if err != nil {
+		s.logger.Error("claim_share_link_failed",
+			"error", err,
+			"operation", operation,
+			"component", "handler",
+			"share_link_id", link.ID,
+		)
+		writeError(w, r, fmt.Errorf("failed to use share link"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
+		return
+	}
+	if !claimed {
+		notFound()
+		return
+	}
+
+	what := "config"
+	if qr {
+		what = "QR code"
+	}
+	s.logger.Info("share_link_used",
+		"share_link_id", link.ID,
+		"peer_id", peer.ID,
+		"remote_addr", r.RemoteAddr,
+		"component", "handler",
+	)
+	s.auditNetworkf(r, peer.NetworkID, "peer.share_link_used", "peer", "downloaded %s of peer %q (id=%d) through share link %s (id=%d) from %s",
+		what, peer.Name, peer.ID, link.TokenPrefix, link.ID, ip)
+
+	w.Header().Set("Cache-Control", "no-store")
+	if qr {
+		w.Header().Set("Content-Type", "image/png")
+		w.WriteHeader(http.StatusOK)
+		w.Write(png)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="wgpilot-%s.conf"`, safeFilename(peer.Name)))
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(conf))
+}
+
+func shareLinkToResponse(l *db.ShareLink, peer *db.Peer, now time.Time) shareLinkResponse {
+	resp := shareLinkResponse{
+		ID:          l.ID,
+		PeerID:      l.PeerID,
+		TokenPrefix: l.TokenPrefix,
+		MaxUses:     l.MaxUses,
+		UseCount:    l.UseCount,
+		ExpiresAt:   l.ExpiresAt.Format(time.RFC3339),
+		LastUsedIP:  l.LastUsedIP,
+		CreatedAt:   l.CreatedAt.Format(time.RFC3339),
+		Usable:      l.Usable(peer, now),
+	}
+	if l.LastUsedAt != nil {
+		s := l.LastUsedAt.Format(time.RFC3339)
+		resp.LastUsedAt = &s
+	}
+	if l.RevokedAt != nil {
+		s := l.RevokedAt.Format(time.RFC3339)
+		resp.RevokedAt = &s
+	}
+	return resp
+}
@@ -0,0 +1,154 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/itsChris/wgpilot/internal/auth"
+	"github.com/itsChris/wgpilot/internal/db"
+)
+
+// createShareLink creates a share link for peerID and returns it.
+func createShareLink(t *testing.T, srv *Server, cookie *http.Cookie, netID, peerID int64, body string) createShareLinkResponse {
+	t.Helper()
+	w := sendJSON(t, srv, "POST", fmt.Sprintf("/api/networks/%d/peers/%d/share-links", netID, peerID), body, cookie)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create share link: expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var link createShareLinkResponse
+	if err := json.NewDecoder(w.Body).Decode(&link); err != nil {
+		t.Fatalf("decode share link: %v", err)
+	}
+	return link
+}
+
+func TestShareLinks_Download(t *testing.T) {
+	srv, _, _ := newTestServerWithWG(t)
+	netID := createTestNetwork(t, srv)
+	ctx := context.Background()
+
+	token, err := adminSession(t, srv)
+	if err != nil {
+		t.Fatalf("admin session: %v", err)
+	}
+	admin := &http.Cookie{Name: auth.CookieName, Value: token}
+	peers := fmt.Sprintf("/api/networks/%d/peers", netID)
+
+	w := sendJSON(t, srv, "POST", peers, `{"name":"Laptop","role":"client"}`, admin)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create peer: expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var peer peerResponse
+	if err := json.NewDecoder(w.Body).Decode(&peer); err != nil {
+		t.Fatalf("decode peer: %v", err)
+	}
+
+	if w := sendJSON(t, srv, "POST", fmt.Sprintf("%s/%d/share-links", peers, peer.ID), `{"expires_in":"1000h"}`, admin); w.Code != http.StatusBadRequest {
+		t.Errorf("long expiry: expected 400, got %d", w.Code)
+	}
+
+	link := createShareLink(t, srv, admin, netID, peer.ID, `{"expires_in":"1h","max_uses":2}`)
+	if !strings.HasPrefix(link.Token, "wgs_") || link.ConfigURL != "/api/share/"+link.Token+"/config" {
+		t.Fatalf("unexpected share link %+v", link)
+	}
+
+	// Public downloads need no session and each counts one use.
+	w = sendJSON(t, srv, "GET", link.ConfigURL, "", nil)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "[Interface]") {
+		t.Fatalf("config: expected 200 with a config, got %d: %s", w.Code, w.Body.String())
+	}
+	w = sendJSON(t, srv, "GET", link.QRURL, "", nil)
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "image/png" {
+		t.Fatalf("qr: expected a PNG, got %d %q", w.Code, w.Header().Get("Content-Type"))
+	}
+	if w := sendJSON(t, srv, "GET", link.ConfigURL, "", nil); w.Code != http.StatusNotFound {
+		t.Errorf("used up: expected 404, got %d", w.Code)
+	}
+
+	entries, _, err := srv.db.ListAuditLog(ctx, 10, 0, db.AuditFilter{Action: "peer.share_link_used"})
+	if err != nil {
+		t.Fatalf("list audit: %v", err)
+	}
+	if len(entries) != 2 || !strings.HasSuffix(entries[0].Detail, "from 192.0.2.1") {
+		t.Errorf("expected two downloads audited with the downloader's IP, got %+v", entries)
+	}
+	stored, err := srv.db.GetShareLinkByID(ctx, link.ID)
+	if err != nil || stored == nil {
+		t.Fatalf("get share link: %v", err)
+	}
+	if stored.LastUsedIP != "192.0.2.1" {
+		t.Errorf("last used ip: expected 192.0.2.1, got %q", stored.LastUsedIP)
+	}
+
+	// Disabling or rotating the peer invalidates its links.
+	link = createShareLink(t, srv, admin, netID, peer.ID, `{"max_uses":5}`)
+	peerPath := fmt.Sprintf("%s/%d", peers, peer.ID)
+	if w := sendWithCookie(t, srv, "POST", peerPath+"/disable", admin); w.Code != http.StatusOK {
+		t.Fatalf("disable: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := sendJSON(t, srv, "GET", link.ConfigURL, "", nil); w.Code != http.StatusNotFound {
+		t.Errorf("disabled peer: expected 404, got %d", w.Code)
+	}
+	if w := sendWithCookie(t, srv, "POST", peerPath+"/enable", admin); w.Code != http.StatusOK {
+		t.Fatalf("enable: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := sendWithCookie(t, srv, "POST", peerPath+"/rotate-keys", admin); w.Code != http.StatusOK {
+		t.Fatalf("rotate keys: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := sendJSON(t, srv, "GET", link.ConfigURL, "", nil); w.Code != http.StatusNotFound {
+		t.Errorf("rotated peer: expected 404, got %d", w.Code)
+	}
+}
+
+func TestShareLinks_Revoke(t *testing.T) {
+	srv, _, _ := newTestServerWithWG(t)
+	netID := createTestNetwork(t, srv)
+	ctx := context.Background()
+
+	token, err := adminSession(t, srv)
+	if err != nil {
+		t.Fatalf("admin session: %v", err)
+	}
+	admin := &http.Cookie{Name: auth.CookieName, Value: token}
+
+	peerID, err := srv.db.CreatePeer(ctx, &db.Peer{
+		NetworkID: netID, Name: "Laptop", PrivateKey: "priv", PublicKey: "pub",
+		AllowedIPs: "10.0.0.2/32", Role: "client", Enabled: true,
+	})
+	if err != nil {
+		t.Fatalf("create peer: %v", err)
+	}
+	links := fmt.Sprintf("/api/networks/%d/peers/%d/share-links", netID, peerID)
+
+	link := createShareLink(t, srv, admin, netID, peerID, `{}`)
+	if link.MaxUses != 1 {
+		t.Errorf("expected single-use by default, got %d", link.MaxUses)
+	}
+
+	if w := sendWithCookie(t, srv, "DELETE", fmt.Sprintf("%s/%d", links, link.ID+1), admin); w.Code != http.StatusNotFound {
+		t.Errorf("revoke unknown: expected 404, got %d", w.Code)
+	}
+	if w := sendWithCookie(t, srv, "DELETE", fmt.Sprintf("%s/%d", links, link.ID), admin); w.Code != http.StatusNoContent {
+		t.Fatalf("revoke: expected 204, got %d: %s", w.Code, w.Body.String())
+	}
+	w := sendJSON(t, srv, "GET", link.ConfigURL, "", nil)
+	if w.Code != http.StatusNotFound || !strings.Contains(w.Body.String(), "SHARE_LINK_NOT_FOUND") {
+		t.Errorf("revoked: expected 404 SHARE_LINK_NOT_FOUND, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w = sendWithCookie(t, srv, "GET", links, admin)
+	if strings.Contains(w.Body.String(), link.Token) {
+		t.Error("list must not return the token")
+	}
+	var listed []shareLinkResponse
+	if err := json.NewDecoder(w.Body).Decode(&listed); err != nil {
+		t.Fatalf("decode share links: %v", err)
+	}
+	if len(listed) != 1 || listed[0].RevokedAt == nil || listed[0].Usable {
+		t.Errorf("expected one revoked link, got %+v", listed)
+	}
+}
@@ -2,14 +2,16 @@ package server
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"net/http"
 	"sort"
 	"strconv"
 	"time"
 
+	"github.com/itsChris/wgpilot/internal/auth"
+	"github.com/itsChris/wgpilot/internal/db"
 	apperr "github.com/itsChris/wgpilot/internal/errors"
+	"github.com/itsChris/wgpilot/internal/events"
 )
 
 // statusResponse is the JSON shape for GET /api/status.
@@ -36,9 +38,12 @@ type peerStatus struct {
 	TransferRx    int64  `json:"transfer_rx"`
 	TransferTx    int64  `json:"transfer_tx"`
 	Online        bool   `json:"online"`
+
+	Location *locationResponse `json:"location,omitempty"`
 }
 
-// handleStatus returns live interface stats from the kernel.
+// handleStatus returns live interface stats from the kernel for the
+// networks the caller may see.
 func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
 	networks, err := s.db.ListNetworks(r.Context())
 	if err != nil {
@@ -52,6 +57,8 @@ func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	networks = visibleNetworks(r, auth.PermNetworkRead, networks)
+
 	resp := statusResponse{Networks: make([]networkStatus, 0, len(networks))}
 
 	for _, net := range networks {
@@ -114,6 +121,7 @@ func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
 				TransferRx:    st.TransferRx,
 				TransferTx:    st.TransferTx,
 				Online:        st.Online,
+				Location:      s.locate(st.Endpoint),
 			}
 			if info, ok := peerByKey[st.PublicKey]; ok {
 				ps.ID = info.id
@@ -128,7 +136,9 @@ func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, resp)
 }
 
-// handleSSEEvents streams peer status updates via Server-Sent Events.
+// handleSSEEvents streams peer status updates via Server-Sent Events. Updates
+// come from the poller through the event bus, so connections don't query the
+// kernel or the database themselves.
 func (s *Server) handleSSEEvents(w http.ResponseWriter, r *http.Request) {
 	idStr := r.PathValue("id")
 	networkID, err := strconv.ParseInt(idStr, 10, 64)
@@ -153,31 +163,49 @@ func (s *Server) handleSSEEvents(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	rc := http.NewResponseController(w)
-
-	w.Header().Set("Content-Type", "text/event-stream")
-	w.Header().Set("Cache-Control", "no-cache")
-	w.Header().Set("Connection", "keep-alive")
+	filter := events.Filter{Topics: []string{events.TypeNetworkStatus}, NetworkID: networkID}
+	sub, _, _ := s.events.Subscribe(filter, 0)
+	defer sub.Close()
 
-	// Send initial status immediately.
-	s.sendSSEStatus(w, rc, network.Interface, networkID)
+	rc := http.NewResponseController(w)
+	setSSEHeaders(w)
+
+	// Send the last polled status immediately, or query the kernel if the
+	// poller hasn't published one yet.
+	if e, ok := s.events.Latest(filter); ok {
+		writeSSEEvent(w, 0, "status", e.Data)
+		rc.Flush()
+	} else {
+		s.sendSSEStatus(w, rc, network.Interface, networkID)
+	}
 
-	ticker := time.NewTicker(5 * time.Second)
-	defer ticker.Stop()
+	keepalive := time.NewTicker(sseKeepaliveInterval)
+	defer keepalive.Stop()
 
 	for {
 		select {
 		case <-r.Context().Done():
 			return
-		case <-ticker.C:
-			s.sendSSEStatus(w, rc, network.Interface, networkID)
+		case e, ok := <-sub.C:
+			if !ok {
+				return
+			}
+			writeSSEEvent(w, 0, "status", e.Data)
+			rc.Flush()
+		case <-keepalive.C:
+			fmt.Fprint(w, ": keepalive\n\n")
+			rc.Flush()
 		}
 	}
 }
 
-// handleNetworkStats returns aggregated peer snapshot data for a network.
-// Returns a flat array of {timestamp, transfer_rx, transfer_tx} entries
-// aggregated across all peers (or filtered by peer_id).
+// handleNetworkStats returns aggregated peer traffic for a network.
+// Returns a flat array of {timestamp, transfer_rx, transfer_tx, rx_bps, tx_bps}
+// entries aggregated across all peers (or filtered by peer_id). transfer_rx and
+// transfer_tx are the bytes transferred since each peer's previous snapshot,
+// unaffected by kernel counter resets; rx_bps and tx_bps are the matching rates.
+// Windows reaching back beyond raw snapshot retention are served from 5-minute,
+// hourly or daily rollups, with one entry per bucket.
 // Query params: from (unix timestamp), to (unix timestamp), peer_id (optional).
 func (s *Server) handleNetworkStats(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
@@ -232,34 +260,55 @@ func (s *Server) handleNetworkStats(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	// Raw snapshots are only kept for a short while; longer windows are
+	// served from the finest rollup that covers them.
+	resolution := db.SnapshotResolution(from, time.Now(), s.retention)
+
 	// Aggregate snapshots by timestamp across all peers into a flat array
 	// matching the frontend TransferStats[] type.
-	type tsKey = int64
-	aggregated := make(map[tsKey]*snapshotEntry)
+	aggregated := make(map[int64]*snapshotEntry)
 
 	for _, p := range peers {
 		if filterPeerID > 0 && p.ID != filterPeerID {
 			continue
 		}
 
-		snapshots, err := s.db.ListSnapshots(ctx, p.ID, from, to)
+		if resolution > 0 {
+			rollups, err := s.ts.ListSnapshotRollups(ctx, p.ID, resolution, from, to)
+			if err != nil {
+				s.logger.Error("stats_list_rollups_failed", "error", err, "operation", "network_stats", "component", "handler", "peer_id", p.ID, "resolution", resolution.String())
+				continue
+			}
+			for _, snap := range rollups {
+				addSnapshotEntry(aggregated, snap, int64(resolution/time.Second))
+			}
+			continue
+		}
+
+		snapshots, err := s.ts.ListSnapshots(ctx, p.ID, from, to)
 		if err != nil {
 			s.logger.Error("stats_list_snapshots_failed", "error", err, "operation", "network_stats", "component", "handler", "peer_id", p.ID)
 			continue
 		}
 
+		// Rates for the first snapshot in range are measured from the last
+		// snapshot before it.
+		var prevTS int64
+		prev, err := s.ts.GetLastSnapshotBefore(ctx, p.ID, from)
+		if err != nil {
+			s.logger.Error("stats_get_last_snapshot_failed", "error", err, "operation", "network_stats", "component", "handler", "peer_id", p.ID)
+		} else if prev != nil {
+			prevTS = prev.Timestamp.Unix()
+		}
+
 		for _, snap := range snapshots {
 			ts := snap.Timestamp.Unix()
-			if entry, ok := aggregated[ts]; ok {
-				entry.TransferRx += snap.RxBytes
-				entry.TransferTx += snap.TxBytes
-			} else {
-				aggregated[ts] = &snapshotEntry{
-					Timestamp:  ts,
-					TransferRx: snap.RxBytes,
-					TransferTx: snap.TxBytes,
-				}
+			var elapsed int64
+			if prevTS > 0 {
+				elapsed = ts - prevTS
 			}
+			addSnapshotEntry(aggregated, snap, elapsed)
+			prevTS = ts
 		}
 	}
 
@@ -276,8 +325,28 @@ func (s *Server) handleNetworkStats(w http.ResponseWriter, r *http.Request) {
 
 type snapshotEntry struct {
 	Timestamp  int64 `json:"timestamp"`
-	TransferRx int64 `json:"transfer_rx"`
+	TransferRx int64 `json:"transfer_rx"` // bytes since the previous snapshot
 	TransferTx int64 `json:"transfer_tx"`
+	RxBps      int64 `json:"rx_bps"`
+	TxBps      int64 `json:"tx_bps"`
+}
+
+// addSnapshotEntry adds a peer's traffic to the aggregated entry at the
+// snapshot's timestamp. elapsed is the length of the interval the snapshot
+// covers in seconds; rates are left out when it is unknown.
+func addSnapshotEntry(aggregated map[int64]*snapshotEntry, snap db.PeerSnapshot, elapsed int64) {
+	ts := snap.Timestamp.Unix()
+	entry, ok := aggregated[ts]
+	if !ok {
+		entry = &snapshotEntry{Timestamp: ts}
+		aggregated[ts] = entry
+	}
+	entry.TransferRx += snap.RxDelta
+	entry.TransferTx += snap.TxDelta
+	if elapsed > 0 {
+		entry.RxBps += snap.RxDelta * 8 / elapsed
+		entry.TxBps += snap.TxDelta * 8 / elapsed
+	}
 }
 
 func sortSnapshotEntries(entries []snapshotEntry) {
@@ -286,6 +355,8 @@ func sortSnapshotEntries(entries []snapshotEntry) {
 	})
 }
 
+// sendSSEStatus queries the kernel for a network's peer status and writes it
+// as a status event.
 func (s *Server) sendSSEStatus(w http.ResponseWriter, rc *http.ResponseController, iface string, networkID int64) {
 	if s.wgManager == nil {
 		return
@@ -313,13 +384,13 @@ func (s *Server) sendSSEStatus(w http.ResponseWriter, rc *http.ResponseControlle
 		}
 	}
 
-	events := make([]map[string]any, 0, len(statuses))
+	peerEvents := make([]map[string]any, 0, len(statuses))
 	for _, st := range statuses {
 		var peerID int64
 		if info, ok := peerByKey[st.PublicKey]; ok {
 			peerID = info.id
 		}
-		events = append(events, map[string]any{
+		peerEvents = append(peerEvents, map[string]any{
 			"peer_id":        peerID,
 			"online":         st.Online,
 			"last_handshake": st.LastHandshake.Unix(),
@@ -329,11 +400,6 @@ func (s *Server) sendSSEStatus(w http.ResponseWriter, rc *http.ResponseControlle
 		})
 	}
 
-	data, err := json.Marshal(events)
-	if err != nil {
-		return
-	}
-
-	fmt.Fprintf(w, "event: status\ndata: %s\n\n", data)
+	writeSSEEvent(w, 0, "status", peerEvents)
 	rc.Flush()
 }
@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
@@ -73,6 +74,7 @@ func newTestServerForMonitoring(t *testing.T) *Server {
 
 	srv, err := New(Config{
 		DB:          database,
+		TimeSeries:  newTestTimeSeries(t),
 		Logger:      logger,
 		JWTService:  jwtSvc,
 		Sessions:    sessions,
@@ -96,7 +98,7 @@ func newTestServerForMonitoring(t *testing.T) *Server {
 
 func authCookie(t *testing.T, srv *Server) *http.Cookie {
 	t.Helper()
-	token, err := srv.jwtService.Generate(1, "admin", "admin")
+	token, err := adminSession(t, srv)
 	if err != nil {
 		t.Fatalf("generate token: %v", err)
 	}
@@ -147,6 +149,7 @@ func newProdModeServer(t *testing.T) *Server {
 
 	srv, err := New(Config{
 		DB:          database,
+		TimeSeries:  newTestTimeSeries(t),
 		Logger:      logger,
 		JWTService:  jwtSvc,
 		Sessions:    sessions,
@@ -269,7 +272,7 @@ func TestHandleSSEEvents_ReceivesUpdates(t *testing.T) {
 	ts := httptest.NewServer(srv)
 	defer ts.Close()
 
-	token, err := srv.jwtService.Generate(1, "admin", "admin")
+	token, err := adminSession(t, srv)
 	if err != nil {
 		t.Fatalf("generate token: %v", err)
 	}
@@ -352,3 +355,109 @@ func TestHandleSSEEvents_NetworkNotFound(t *testing.T) {
 		t.Errorf("expected 404, got %d", w.Code)
 	}
 }
+
+func TestHandleNetworkStats_DeltasAndRates(t *testing.T) {
+	srv := newTestServerForMonitoring(t)
+	ctx := context.Background()
+
+	netID, err := srv.db.CreateNetwork(ctx, newTestNetwork())
+	if err != nil {
+		t.Fatalf("create network: %v", err)
+	}
+	peerID, err := srv.db.CreatePeer(ctx, &db.Peer{
+		NetworkID: netID, Name: "My Phone", PublicKey: "peer-public-key",
+		AllowedIPs: "10.0.0.2/32", Enabled: true,
+	})
+	if err != nil {
+		t.Fatalf("create peer: %v", err)
+	}
+
+	base := time.Now().Add(-time.Hour).Truncate(time.Minute)
+	snapshots := []db.PeerSnapshot{
+		{Timestamp: base.Add(-time.Minute), RxBytes: 9000, TxBytes: 9000}, // before range
+		{Timestamp: base, RxBytes: 9600, TxBytes: 9300, RxDelta: 600, TxDelta: 300},
+		{Timestamp: base.Add(time.Minute), RxBytes: 1200, TxBytes: 600, RxDelta: 1200, TxDelta: 600}, // counter reset
+	}
+	for i := range snapshots {
+		snapshots[i].PeerID = peerID
+		if err := srv.ts.InsertSnapshot(ctx, &snapshots[i]); err != nil {
+			t.Fatalf("insert snapshot: %v", err)
+		}
+	}
+
+	url := "/api/networks/1/stats?from=" + strconv.FormatInt(base.Unix(), 10)
+	req := httptest.NewRequest("GET", url, nil)
+	req.AddCookie(authCookie(t, srv))
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var resp []snapshotEntry
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(resp) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(resp))
+	}
+
+	want := []snapshotEntry{
+		{Timestamp: base.Unix(), TransferRx: 600, TransferTx: 300, RxBps: 80, TxBps: 40},
+		{Timestamp: base.Add(time.Minute).Unix(), TransferRx: 1200, TransferTx: 600, RxBps: 160, TxBps: 80},
+	}
+	for i, w := range want {
+		if resp[i] != w {
+			t.Errorf("entry %d: expected %+v, got %+v", i, w, resp[i])
+		}
+	}
+}
+
+func TestHandleNetworkStats_UsesRollupsForLongWindows(t *testing.T) {
+	srv := newTestServerForMonitoring(t)
+	ctx := context.Background()
+
+	netID, err := srv.db.CreateNetwork(ctx, newTestNetwork())
+	if err != nil {
+		t.Fatalf("create network: %v", err)
+	}
+	peerID, err := srv.db.CreatePeer(ctx, &db.Peer{
+		NetworkID: netID, Name: "My Phone", PublicKey: "peer-public-key",
+		AllowedIPs: "10.0.0.2/32", Enabled: true,
+	})
+	if err != nil {
+		t.Fatalf("create peer: %v", err)
+	}
+
+	// Two raw snapshots in the same 5-minute bucket, three days ago.
+	bucket := time.Now().Add(-72 * time.Hour).Truncate(5 * time.Minute)
+	for i := 0; i < 2; i++ {
+		if err := srv.ts.InsertSnapshot(ctx, &db.PeerSnapshot{
+			PeerID: peerID, Timestamp: bucket.Add(time.Duration(i) * time.Minute),
+			RxDelta: 15000, TxDelta: 7500, Online: true,
+		}); err != nil {
+			t.Fatalf("insert snapshot: %v", err)
+		}
+	}
+
+	from := time.Now().AddDate(0, 0, -7)
+	url := "/api/networks/1/stats?from=" + strconv.FormatInt(from.Unix(), 10)
+	req := httptest.NewRequest("GET", url, nil)
+	req.AddCookie(authCookie(t, srv))
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var resp []snapshotEntry
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	want := snapshotEntry{Timestamp: bucket.Unix(), TransferRx: 30000, TransferTx: 15000, RxBps: 800, TxBps: 400}
+	if len(resp) != 1 || resp[0] != want {
+		t.Fatalf("expected %+v, got %+v", want, resp)
+	}
+}
@@ -0,0 +1,111 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	apperr "github.com/itsChris/wgpilot/internal/errors"
+)
+
+// ── Request/Response types ───────────────────────────────────────────
+
+type peerTrafficResponse struct {
+	PeerID     int64  `json:"peer_id"`
+	Name       string `json:"name"`
+	LifetimeRx int64  `json:"lifetime_rx"`
+	LifetimeTx int64  `json:"lifetime_tx"`
+	TodayRx    int64  `json:"today_rx"`
+	TodayTx    int64  `json:"today_tx"`
+	MonthRx    int64  `json:"month_rx"`
+	MonthTx    int64  `json:"month_tx"`
+	UpdatedAt  int64  `json:"updated_at,omitempty"`
+}
+
+// ── Handlers ─────────────────────────────────────────────────────────
+
+// handleNetworkTraffic returns cumulative bytes transferred per peer: since
+// the peer was created, today and this calendar month (UTC). Unlike the
+// live counters in /api/status these survive interface recreation.
+func (s *Server) handleNetworkTraffic(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	networkID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("invalid network ID"), apperr.ErrValidation, http.StatusBadRequest, s.devMode)
+		return
+	}
+
+	network, err := s.db.GetNetworkByID(ctx, networkID)
+	if err != nil {
+		s.logger.Error("traffic_get_network_failed", "error", err, "operation", "network_traffic", "component", "handler", "network_id", networkID)
+		writeError(w, r, fmt.Errorf("failed to get network"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
+		return
+	}
+	if network == nil {
+		writeError(w, r, fmt.Errorf("network %d not found", networkID), apperr.ErrNetworkNotFound, http.StatusNotFound, s.devMode)
+		return
+	}
+
+	peers, err := s.db.ListPeersByNetworkID(ctx, networkID)
+	if err != nil {
+		s.logger.Error("traffic_list_peers_failed", "error", err, "operation", "network_traffic", "component", "handler", "network_id", networkID)
+		writeError(w, r, fmt.Errorf("failed to list peers"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
+		return
+	}
+
+	lifetime, err := s.ts.ListPeerTraffic(ctx)
+	if err != nil {
+		s.logger.Error("traffic_list_failed", "error", err, "operation", "network_traffic", "component", "handler", "network_id", networkID)
+		writeError(w, r, fmt.Errorf("failed to get traffic"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
+		return
+	}
+
+	now := time.Now().UTC()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+
+	result := make([]peerTrafficResponse, 0, len(peers))
+	for _, p := range peers {
+		entry := peerTrafficResponse{PeerID: p.ID, Name: p.Name}
+		if t, ok := lifetime[p.ID]; ok {
+			entry.LifetimeRx = t.LifetimeRx
+			entry.LifetimeTx = t.LifetimeTx
+			entry.UpdatedAt = t.UpdatedAt.Unix()
+
+			entry.TodayRx, entry.TodayTx, err = s.ts.PeerUsageSince(ctx, p.ID, today)
+			if err != nil {
+				s.logger.Error("traffic_peer_usage_failed", "error", err, "operation", "network_traffic", "component", "handler", "peer_id", p.ID)
+				writeError(w, r, fmt.Errorf("failed to compute usage"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
+				return
+			}
+			entry.MonthRx, entry.MonthTx, err = s.ts.PeerUsageSince(ctx, p.ID, month)
+			if err != nil {
+				s.logger.Error("traffic_peer_usage_failed", "error", err, "operation", "network_traffic", "component", "handler", "peer_id", p.ID)
+				writeError(w, r, fmt.Errorf("failed to compute usage"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
+				return
+			}
+		}
+		result = append(result, entry)
+	}
+
+	writeJSON(w, http.StatusOK, result)
+}
+
+// deletePeerTimeSeries removes a deleted peer's snapshots and traffic totals.
+// The time-series database has no foreign keys to cascade from, so handlers
+// call this after the peer is gone. Failures are logged but do not fail the
+// request; the orphaned rows only take up space.
+func (s *Server) deletePeerTimeSeries(ctx context.Context, peerID int64, operation string) {
+	if err := s.ts.DeletePeer(ctx, peerID); err != nil {
+		s.logger.Warn("delete_peer_time_series_failed",
+			"error", err,
+			"error_type", fmt.Sprintf("%T", err),
+			"operation", operation,
+			"component", "handler",
+			"peer_id", peerID,
+		)
+	}
+}
@@ -0,0 +1,141 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/itsChris/wgpilot/internal/db"
+)
+
+func TestNetworkTraffic_Totals(t *testing.T) {
+	srv, _, _ := newTestServerWithWG(t)
+	netID := createTestNetwork(t, srv)
+	ctx := context.Background()
+
+	peerID, err := srv.db.CreatePeer(ctx, &db.Peer{
+		NetworkID:  netID,
+		Name:       "Laptop",
+		PublicKey:  "peer-pub-key",
+		AllowedIPs: "10.0.0.2/32",
+		Role:       "client",
+		Enabled:    true,
+	})
+	if err != nil {
+		t.Fatalf("create peer: %v", err)
+	}
+	idleID, err := srv.db.CreatePeer(ctx, &db.Peer{
+		NetworkID:  netID,
+		Name:       "Idle",
+		PublicKey:  "idle-pub-key",
+		AllowedIPs: "10.0.0.3/32",
+		Role:       "client",
+		Enabled:    true,
+	})
+	if err != nil {
+		t.Fatalf("create peer: %v", err)
+	}
+
+	now := time.Now()
+	snapshots := []db.PeerSnapshot{
+		{Timestamp: now.AddDate(-1, 0, 0), RxDelta: 5000, TxDelta: 7000},
+		{Timestamp: now, RxDelta: 100, TxDelta: 200},
+	}
+	for i := range snapshots {
+		snapshots[i].PeerID = peerID
+		if err := srv.ts.InsertSnapshot(ctx, &snapshots[i]); err != nil {
+			t.Fatalf("insert snapshot: %v", err)
+		}
+	}
+
+	req := httptest.NewRequest("GET", fmt.Sprintf("/api/networks/%d/traffic", netID), nil)
+	req = authRequest(t, srv, req)
+	w := httptest.NewRecorder()
+
+	srv.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp []peerTrafficResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(resp) != 2 {
+		t.Fatalf("expected 2 peers, got %d", len(resp))
+	}
+
+	got := resp[0]
+	if got.PeerID != peerID {
+		t.Fatalf("expected peer %d first, got %d", peerID, got.PeerID)
+	}
+	if got.LifetimeRx != 5100 || got.LifetimeTx != 7200 {
+		t.Errorf("expected lifetime 5100/7200, got %d/%d", got.LifetimeRx, got.LifetimeTx)
+	}
+	if got.TodayRx != 100 || got.TodayTx != 200 {
+		t.Errorf("expected today 100/200, got %d/%d", got.TodayRx, got.TodayTx)
+	}
+	if got.MonthRx != 100 || got.MonthTx != 200 {
+		t.Errorf("expected month 100/200, got %d/%d", got.MonthRx, got.MonthTx)
+	}
+
+	if idle := resp[1]; idle.PeerID != idleID || idle.LifetimeRx != 0 || idle.TodayRx != 0 {
+		t.Errorf("expected zero totals for idle peer, got %+v", idle)
+	}
+}
+
+func TestNetworkTraffic_NotFound(t *testing.T) {
+	srv, _, _ := newTestServerWithWG(t)
+
+	req := httptest.NewRequest("GET", "/api/networks/999/traffic", nil)
+	req = authRequest(t, srv, req)
+	w := httptest.NewRecorder()
+
+	srv.ServeHTTP(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestNetworkTraffic_RemovedWithPeer(t *testing.T) {
+	srv, _, _ := newTestServerWithWG(t)
+	netID := createTestNetwork(t, srv)
+	ctx := context.Background()
+
+	peerID, err := srv.db.CreatePeer(ctx, &db.Peer{
+		NetworkID:  netID,
+		Name:       "Laptop",
+		PublicKey:  "peer-pub-key",
+		AllowedIPs: "10.0.0.2/32",
+		Role:       "client",
+		Enabled:    true,
+	})
+	if err != nil {
+		t.Fatalf("create peer: %v", err)
+	}
+	if err := srv.ts.InsertSnapshot(ctx, &db.PeerSnapshot{PeerID: peerID, Timestamp: time.Now(), RxDelta: 100}); err != nil {
+		t.Fatalf("insert snapshot: %v", err)
+	}
+
+	req := httptest.NewRequest("DELETE", fmt.Sprintf("/api/networks/%d/peers/%d", netID, peerID), nil)
+	req = authRequest(t, srv, req)
+	w := httptest.NewRecorder()
+
+	srv.ServeHTTP(w, req)
+
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d: %s", w.Code, w.Body.String())
+	}
+	traffic, err := srv.ts.GetPeerTraffic(ctx, peerID)
+	if err != nil {
+		t.Fatalf("get traffic: %v", err)
+	}
+	if traffic != nil {
+		t.Errorf("expected traffic removed with the peer, got %+v", traffic)
+	}
+}
@@ -0,0 +1,770 @@
+package server
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/itsChris/wgpilot/internal/auth"
+	"github.com/itsChris/wgpilot/internal/db"
+	apperr "github.com/itsChris/wgpilot/internal/errors"
+)
+
+// settingRequire2FAAdmin is the settings key that, when "true", requires
+// every admin to use a second factor.
+const settingRequire2FAAdmin = "require_2fa_admin"
+
+// ── Request/Response types ───────────────────────────────────────────
+
+// twoFactorChallengeResponse is returned by login when the password was
+// correct but a second factor is needed before a session is issued.
+type twoFactorChallengeResponse struct {
+	TwoFactorRequired  bool     `json:"two_factor_required"`
+	EnrollmentRequired bool     `json:"enrollment_required"`
+	Methods            []string `json:"methods"` // "totp", "webauthn"
+	ChallengeToken     string   `json:"challenge_token"`
+	// PasswordChangeRequired asks for new_password with the second factor.
+	PasswordChangeRequired bool `json:"password_change_required"`
+}
+
+type twoFactorLoginRequest struct {
+	ChallengeToken string `json:"challenge_token"`
+	Code           string `json:"code"`
+	RecoveryCode   string `json:"recovery_code"`
+	NewPassword    string `json:"new_password"` // sets a new password when a change is required
+}
+
+type twoFactorEnrollLoginResponse struct {
+	User          userInfo `json:"user"`
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+type twoFactorStatusResponse struct {
+	Enabled                bool `json:"enabled"`
+	Required               bool `json:"required"`
+	RecoveryCodesRemaining int  `json:"recovery_codes_remaining"`
+	WebAuthnCredentials    int  `json:"webauthn_credentials"`
+}
+
+type twoFactorSetupResponse struct {
+	Secret     string `json:"secret"`
+	OTPAuthURL string `json:"otpauth_url"`
+	QRCode     string `json:"qr_code"` // PNG data URI
+}
+
+type recoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+type twoFactorPolicy struct {
+	RequireForAdmins bool `json:"require_for_admins"`
+}
+
+// ── Login ────────────────────────────────────────────────────────────
+
+// handleLogin2FA completes a login with a TOTP code or a recovery code and
+// issues the session cookie.
+func (s *Server) handleLogin2FA(w http.ResponseWriter, r *http.Request) {
+	if !s.allowAuthAttempt(w, r) {
+		return
+	}
+
+	var req twoFactorLoginRequest
+	if code, status, err := decodeJSON(r, &req); err != nil {
+		writeError(w, r, err, code, status, s.devMode)
+		return
+	}
+
+	user, r, ok := s.challengeUser(w, r, req.ChallengeToken)
+	if !ok {
+		return
+	}
+	if !user.TOTPEnabled {
+		writeError(w, r, fmt.Errorf("two-factor authentication is not enabled"), apperr.Err2FANotEnabled, http.StatusBadRequest, s.devMode)
+		return
+	}
+	if !s.checkRequiredPassword(w, r, user, req.NewPassword) {
+		return
+	}
+	if !s.verifySecondFactor(w, r, user, req.Code, req.RecoveryCode, auth.UserFromContext(r.Context())) {
+		return
+	}
+	if !s.finishLogin(w, r, user, req.NewPassword) {
+		return
+	}
+
+	writeJSON(w, http.StatusOK, loginResponse{
+		User: userInfo{ID: user.ID, Username: user.Username},
+	})
+}
+
+// handleLogin2FASetup starts TOTP enrollment for a user who must enroll
+// before they can log in.
+func (s *Server) handleLogin2FASetup(w http.ResponseWriter, r *http.Request) {
+	var req twoFactorLoginRequest
+	if code, status, err := decodeJSON(r, &req); err != nil {
+		writeError(w, r, err, code, status, s.devMode)
+		return
+	}
+
+	user, r, ok := s.challengeUser(w, r, req.ChallengeToken)
+	if !ok {
+		return
+	}
+	if user.TOTPEnabled {
+		writeError(w, r, fmt.Errorf("two-factor authentication is already enabled"), apperr.Err2FAAlreadyEnabled, http.StatusConflict, s.devMode)
+		return
+	}
+	s.beginTOTPEnrollment(w, r, user)
+}
+
+// handleLogin2FAEnable confirms a login-time enrollment and issues the
+// session cookie. The response carries the recovery codes, shown once.
+func (s *Server) handleLogin2FAEnable(w http.ResponseWriter, r *http.Request) {
+	if !s.allowAuthAttempt(w, r) {
+		return
+	}
+
+	var req twoFactorLoginRequest
+	if code, status, err := decodeJSON(r, &req); err != nil {
+		writeError(w, r, err, code, status, s.devMode)
+		return
+	}
+
+	user, r, ok := s.challengeUser(w, r, req.ChallengeToken)
+	if !ok {
+		return
+	}
+	if user.TOTPEnabled {
+		writeError(w, r, fmt.Errorf("two-factor authentication is already enabled"), apperr.Err2FAAlreadyEnabled, http.StatusConflict, s.devMode)
+		return
+	}
+	if !s.checkRequiredPassword(w, r, user, req.NewPassword) {
+		return
+	}
+	codes, ok := s.confirmTOTPEnrollment(w, r, user, req.Code)
+	if !ok {
+		return
+	}
+	if !s.finishLogin(w, r, user, req.NewPassword) {
+		return
+	}
+
+	writeJSON(w, http.StatusOK, twoFactorEnrollLoginResponse{
+		User:          userInfo{ID: user.ID, Username: user.Username},
+		RecoveryCodes: codes,
+	})
+}
+
+// ── Self-service ─────────────────────────────────────────────────────
+
+// handleGet2FAStatus returns the current user's second factor state.
+func (s *Server) handleGet2FAStatus(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	user, ok := s.currentUser(w, r)
+	if !ok {
+		return
+	}
+	required, err := s.twoFactorRequired(ctx, user.Role)
+	if err != nil {
+		s.logger.Error("2fa_policy_read_failed", "error", err, "operation", "2fa_status", "component", "auth")
+		writeError(w, r, fmt.Errorf("internal error"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
+		return
+	}
+
+	resp := twoFactorStatusResponse{Enabled: user.TOTPEnabled, Required: required}
+	if user.TOTPEnabled {
+		n, err := s.db.CountRecoveryCodes(ctx, user.ID)
+		if err != nil {
+			s.logger.Error("count_recovery_codes_failed", "error", err, "user_id", user.ID, "component", "auth")
+			writeError(w, r, fmt.Errorf("internal error"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
+			return
+		}
+		resp.RecoveryCodesRemaining = n
+	}
+	n, err := s.db.CountWebAuthnCredentials(ctx, user.ID)
+	if err != nil {
+		s.logger.Error("count_webauthn_credentials_failed", "error", err, "user_id", user.ID, "component", "auth")
+		writeError(w, r, fmt.Errorf("internal error"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
+		return
+	}
+	resp.WebAuthnCredentials = n
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// handle2FASetup starts TOTP enrollment for the current user.
+func (s *Server) handle2FASetup(w http.ResponseWriter, r *http.Request) {
+	user, ok := s.currentUser(w, r)
+	if !ok {
+		return
+	}
+	if user.TOTPEnabled {
+		writeError(w, r, fmt.Errorf("two-factor authentication is already enabled"), apperr.Err2FAAlreadyEnabled, http.StatusConflict, s.devMode)
+		return
+	}
+	s.beginTOTPEnrollment(w, r, user)
+}
+
+// handle2FAEnable confirms the current user's enrollment with a code from
+// their authenticator app and returns their recovery codes.
+func (s *Server) handle2FAEnable(w http.ResponseWriter, r *http.Request) {
+	if !s.allowAuthAttempt(w, r) {
+		return
+	}
+
+	var req struct {
+		Code string `json:"code"`
+	}
+	if code, status, err := decodeJSON(r, &req); err != nil {
+		writeError(w, r, err, code, status, s.devMode)
+		return
+	}
+
+	user, ok := s.currentUser(w, r)
+	if !ok {
+		return
+	}
+	if user.TOTPEnabled {
+		writeError(w, r, fmt.Errorf("two-factor authentication is already enabled"), apperr.Err2FAAlreadyEnabled, http.StatusConflict, s.devMode)
+		return
+	}
+	codes, ok := s.confirmTOTPEnrollment(w, r, user, req.Code)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, recoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// handle2FADisable turns off the current user's TOTP second factor. It needs
+// the password and a current code, and is refused while policy requires 2FA
+// and the user has no security key to fall back on.
+func (s *Server) handle2FADisable(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if !s.allowAuthAttempt(w, r) {
+		return
+	}
+
+	var req struct {
+		Password     string `json:"password"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+	if code, status, err := decodeJSON(r, &req); err != nil {
+		writeError(w, r, err, code, status, s.devMode)
+		return
+	}
+
+	user, ok := s.currentUser(w, r)
+	if !ok {
+		return
+	}
+	if !user.TOTPEnabled {
+		writeError(w, r, fmt.Errorf("two-factor authentication is not enabled"), apperr.Err2FANotEnabled, http.StatusBadRequest, s.devMode)
+		return
+	}
+	required, err := s.twoFactorRequired(ctx, user.Role)
+	if err != nil {
+		s.logger.Error("2fa_policy_read_failed", "error", err, "operation", "2fa_disable", "component", "auth")
+		writeError(w, r, fmt.Errorf("internal error"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
+		return
+	}
+	if required {
+		n, err := s.db.CountWebAuthnCredentials(ctx, user.ID)
+		if err != nil {
+			s.logger.Error("count_webauthn_credentials_failed", "error", err, "user_id", user.ID, "component", "auth")
+			writeError(w, r, fmt.Errorf("internal error"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
+			return
+		}
+		if n == 0 {
+			writeError(w, r, fmt.Errorf("two-factor authentication is required for the %s role", user.Role), apperr.Err2FARequired, http.StatusForbidden, s.devMode)
+			return
+		}
+	}
+
+	if err := auth.VerifyPassword(user.PasswordHash, req.Password); err != nil {
+		s.logger.Warn("2fa_disable_wrong_password", "user", user.Username, "remote_addr", r.RemoteAddr, "component", "auth")
+		s.auditf(r, "auth.2fa_failed", "user", "wrong password disabling two-factor authentication for user %q", user.Username)
+		writeError(w, r, fmt.Errorf("invalid current password"), apperr.ErrInvalidCredentials, http.StatusUnauthorized, s.devMode)
+		return
+	}
+	if !s.verifySecondFactor(w, r, user, req.Code, req.RecoveryCode, nil) {
+		return
+	}
+
+	if err := s.db.DisableUserTOTP(ctx, user.ID); err != nil {
+		s.logger.Error("2fa_disable_failed", "error", err, "user_id", user.ID, "component", "auth")
+		writeError(w, r, fmt.Errorf("failed to disable two-factor authentication"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
+		return
+	}
+
+	s.logger.Info("2fa_disabled", "user", user.Username, "user_id", user.ID, "component", "auth")
+	s.auditf(r, "auth.2fa_disabled", "user", "user %q disabled two-factor authentication", user.Username)
+
+	writeJSON(w, http.StatusOK, map[string]string{"status": "two-factor authentication disabled"})
+}
+
+// handleRegenerateRecoveryCodes replaces the current user's recovery codes.
+// A current TOTP code is required.
+func (s *Server) handleRegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if !s.allowAuthAttempt(w, r) {
+		return
+	}
+
+	var req struct {
+		Code string `json:"code"`
+	}
+	if code, status, err := decodeJSON(r, &req); err != nil {
+		writeError(w, r, err, code, status, s.devMode)
+		return
+	}
+
+	user, ok := s.currentUser(w, r)
+	if !ok {
+		return
+	}
+	if !user.TOTPEnabled {
+		writeError(w, r, fmt.Errorf("two-factor authentication is not enabled"), apperr.Err2FANotEnabled, http.StatusBadRequest, s.devMode)
+		return
+	}
+	if req.Code == "" {
+		writeError(w, r, fmt.Errorf("code is required"), apperr.ErrValidation, http.StatusBadRequest, s.devMode)
+		return
+	}
+	if !s.verifySecondFactor(w, r, user, req.Code, "", nil) {
+		return
+	}
+
+	codes, hashes, err := auth.GenerateRecoveryCodes(auth.RecoveryCodeCount)
+	if err != nil {
+		s.logger.Error("generate_recovery_codes_failed", "error", err, "component", "auth")
+		writeError(w, r, fmt.Errorf("internal error"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
+		return
+	}
+	if err := s.db.ReplaceRecoveryCodes(ctx, user.ID, hashes); err != nil {
+		s.logger.Error("replace_recovery_codes_failed", "error", err, "user_id", user.ID, "component", "auth")
+		writeError(w, r, fmt.Errorf("failed to store recovery codes"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
+		return
+	}
+
+	s.logger.Info("2fa_recovery_codes_regenerated", "user", user.Username, "user_id", user.ID, "component", "auth")
+	s.auditf(r, "auth.2fa_recovery_codes_regenerated", "user", "user %q regenerated their recovery codes", user.Username)
+
+	writeJSON(w, http.StatusOK, recoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// ── Administration ───────────────────────────────────────────────────
+
+// handleReset2FA removes another user's second factors, TOTP and security
+// keys (admin only), e.g. after they lost their devices and recovery codes. If policy requires
+// 2FA for their role they must enroll again at their next login.
+func (s *Server) handleReset2FA(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("invalid user ID"), apperr.ErrValidation, http.StatusBadRequest, s.devMode)
+		return
+	}
+
+	user, err := s.db.GetUserByID(ctx, id)
+	if err != nil {
+		s.logger.Error("get_user_failed", "error", err, "component", "handler", "user_id", id)
+		writeError(w, r, fmt.Errorf("failed to get user"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
+		return
+	}
+	if user == nil {
+		writeError(w, r, fmt.Errorf("user %d not found", id), apperr.ErrValidation, http.StatusNotFound, s.devMode)
+		return
+	}
+
+	if err := s.db.DisableUserTOTP(ctx, id); err != nil {
+		s.logger.Error("2fa_reset_failed", "error", err, "component", "handler", "user_id", id)
+		writeError(w, r, fmt.Errorf("failed to reset two-factor authentication"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
+		return
+	}
+	if err := s.db.DeleteUserWebAuthnCredentials(ctx, id); err != nil {
+		s.logger.Error("2fa_reset_failed", "error", err, "component", "handler", "user_id", id)
+		writeError(w, r, fmt.Errorf("failed to reset two-factor authentication"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
+		return
+	}
+
+	before := userToResponse(user)
+	user.TOTPEnabled = false
+
+	s.logger.Info("2fa_reset", "user_id", id, "username", user.Username, "component", "handler")
+	s.auditf(r, "user.2fa_reset", "user", "reset two-factor authentication for user %q (id=%d)", user.Username, id)
+	s.resourceChanged(r, "user.updated", "user", id, before, userToResponse(user))
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleGet2FAPolicy returns the two-factor policy (admin only).
+func (s *Server) handleGet2FAPolicy(w http.ResponseWriter, r *http.Request) {
+	required, err := s.twoFactorRequired(r.Context(), "admin")
+	if err != nil {
+		s.logger.Error("2fa_policy_read_failed", "error", err, "operation", "get_2fa_policy", "component", "handler")
+		writeError(w, r, fmt.Errorf("failed to read two-factor policy"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
+		return
+	}
+	writeJSON(w, http.StatusOK, twoFactorPolicy{RequireForAdmins: required})
+}
+
+// handleUpdate2FAPolicy sets whether admins must use 2FA (admin only).
+// Admins without a second factor are made to enroll at their next login.
+func (s *Server) handleUpdate2FAPolicy(w http.ResponseWriter, r *http.Request) {
+	var req twoFactorPolicy
+	if code, status, err := decodeJSON(r, &req); err != nil {
+		writeError(w, r, err, code, status, s.devMode)
+		return
+	}
+
+	if err := s.db.SetSetting(r.Context(), settingRequire2FAAdmin, strconv.FormatBool(req.RequireForAdmins)); err != nil {
+		s.logger.Error("set_setting_failed", "error", err, "key", settingRequire2FAAdmin, "operation", "update_2fa_policy", "component", "handler")
+		writeError(w, r, fmt.Errorf("failed to save two-factor policy"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
+		return
+	}
+
+	s.logger.Info("2fa_policy_updated", "require_for_admins", req.RequireForAdmins, "component", "handler")
+	s.auditf(r, "settings.2fa_policy_updated", "settings", "two-factor authentication required for admins: %t", req.RequireForAdmins)
+
+	writeJSON(w, http.StatusOK, req)
+}
+
+// ── Helpers ──────────────────────────────────────────────────────────
+
+// twoFactorRequired reports whether policy requires a second factor for role.
+func (s *Server) twoFactorRequired(ctx context.Context, role string) (bool, error) {
+	if role != "admin" {
+		return false, nil
+	}
+	v, err := s.db.GetSetting(ctx, settingRequire2FAAdmin)
+	if err != nil {
+		return false, err
+	}
+	return v == "true", nil
+}
+
+// secondFactors lists the second factors user has set up.
+func (s *Server) secondFactors(ctx context.Context, user *db.User) ([]string, error) {
+	var methods []string
+	if user.TOTPEnabled {
+		methods = append(methods, "totp")
+	}
+	n, err := s.db.CountWebAuthnCredentials(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if n > 0 {
+		methods = append(methods, "webauthn")
+	}
+	return methods, nil
+}
+
+// allowAuthAttempt applies the login rate limit to a credential check,
+// writing a 429 response if the client is over it.
+func (s *Server) allowAuthAttempt(w http.ResponseWriter, r *http.Request) bool {
+	if s.rateLimiter.Allow(auth.ClientIP(r)) {
+		return true
+	}
+	s.logger.Warn("auth_rate_limited",
+		"remote_addr", r.RemoteAddr,
+		"path", r.URL.Path,
+		"component", "auth",
+	)
+	w.Header().Set("Retry-After", "60")
+	writeError(w, r, fmt.Errorf("too many login attempts"), apperr.ErrRateLimited, http.StatusTooManyRequests, s.devMode)
+	return false
+}
+
+// startSession issues a session cookie for user at the end of a login.
+func (s *Server) startSession(w http.ResponseWriter, r *http.Request, user *db.User) bool {
+	token, err := s.issueSession(r, user.ID, user.Username, user.Role)
+	if err != nil {
+		s.logger.Error("auth_token_generation_failed",
+			"error", err,
+			"component", "auth",
+		)
+		writeError(w, r, fmt.Errorf("internal error"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
+		return false
+	}
+
+	s.sessions.SetCookie(w, token, int(s.jwtService.TTL().Seconds()))
+
+	s.logger.Info("auth_login_success",
+		"user", user.Username,
+		"remote_addr", r.RemoteAddr,
+		"two_factor", user.TOTPEnabled,
+		"component", "auth",
+	)
+	s.auditf(r, "auth.login", "user", "user %q logged in", user.Username)
+	return true
+}
+
+// writeTwoFactorChallenge answers a correct password with a challenge token
+// instead of a session, for a user who has a second factor (methods) or must
+// enroll one.
+func (s *Server) writeTwoFactorChallenge(w http.ResponseWriter, r *http.Request, user *db.User, methods []string) {
+	token, err := s.jwtService.GenerateChallenge(user.ID, user.Username, user.Role)
+	if err != nil {
+		s.logger.Error("auth_token_generation_failed",
+			"error", err,
+			"component", "auth",
+		)
+		writeError(w, r, fmt.Errorf("internal error"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
+		return
+	}
+
+	r = r.WithContext(auth.WithUser(r.Context(), challengeClaims(user)))
+	s.logger.Info("auth_2fa_challenge",
+		"user", user.Username,
+		"remote_addr", r.RemoteAddr,
+		"methods", methods,
+		"enrollment_required", len(methods) == 0,
+		"component", "auth",
+	)
+	s.auditf(r, "auth.2fa_challenged", "user", "user %q passed the password step, second factor pending", user.Username)
+
+	writeJSON(w, http.StatusAccepted, twoFactorChallengeResponse{
+		TwoFactorRequired:      true,
+		EnrollmentRequired:     len(methods) == 0,
+		Methods:                methods,
+		ChallengeToken:         token,
+		PasswordChangeRequired: user.MustChangePassword,
+	})
+}
+
+// challengeUser resolves the user behind a login challenge token. The
+// returned request carries the user in its context so the remaining steps
+// are audited against them.
+func (s *Server) challengeUser(w http.ResponseWriter, r *http.Request, token string) (*db.User, *http.Request, bool) {
+	if token == "" {
+		writeError(w, r, fmt.Errorf("challenge_token is required"), apperr.ErrValidation, http.StatusBadRequest, s.devMode)
+		return nil, r, false
+	}
+	claims, err := s.jwtService.ValidateChallenge(token)
+	if err != nil {
+		s.logger.Warn("auth_invalid_challenge",
+			"remote_addr", r.RemoteAddr,
+			"error", err,
+			"component", "auth",
+		)
+		writeError(w, r, fmt.Errorf("login challenge expired or invalid"), apperr.ErrSessionExpired, http.StatusUnauthorized, s.devMode)
+		return nil, r, false
+	}
+	if s.challenges.Revoked(claims) {
+		s.logger.Warn("auth_invalid_challenge",
+			"remote_addr", r.RemoteAddr,
+			"error", "too many failed attempts",
+			"component", "auth",
+		)
+		writeError(w, r, fmt.Errorf("login challenge expired or invalid"), apperr.ErrSessionExpired, http.StatusUnauthorized, s.devMode)
+		return nil, r, false
+	}
+	r = r.WithContext(auth.WithUser(r.Context(), claims))
+
+	user, ok := s.userByClaims(w, r, claims)
+	if !ok {
+		return nil, r, false
+	}
+	if user.Locked(time.Now()) {
+		s.logger.Warn("auth_invalid_challenge",
+			"user", user.Username,
+			"remote_addr", r.RemoteAddr,
+			"error", "account locked",
+			"component", "auth",
+		)
+		writeError(w, r, fmt.Errorf("login challenge expired or invalid"), apperr.ErrSessionExpired, http.StatusUnauthorized, s.devMode)
+		return nil, r, false
+	}
+	return user, r, true
+}
+
+// currentUser loads the authenticated user of a protected request.
+func (s *Server) currentUser(w http.ResponseWriter, r *http.Request) (*db.User, bool) {
+	claims := auth.UserFromContext(r.Context())
+	if claims == nil {
+		writeError(w, r, fmt.Errorf("unauthorized"), apperr.ErrUnauthorized, http.StatusUnauthorized, s.devMode)
+		return nil, false
+	}
+	return s.userByClaims(w, r, claims)
+}
+
+func (s *Server) userByClaims(w http.ResponseWriter, r *http.Request, claims *auth.Claims) (*db.User, bool) {
+	userID, err := strconv.ParseInt(claims.Subject, 10, 64)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("invalid session"), apperr.ErrUnauthorized, http.StatusUnauthorized, s.devMode)
+		return nil, false
+	}
+	user, err := s.db.GetUserByID(r.Context(), userID)
+	if err != nil {
+		s.logger.Error("auth_get_user_failed", "error", err, "user_id", userID, "component", "auth")
+		writeError(w, r, fmt.Errorf("internal error"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
+		return nil, false
+	}
+	if user == nil {
+		writeError(w, r, fmt.Errorf("invalid session"), apperr.ErrUnauthorized, http.StatusUnauthorized, s.devMode)
+		return nil, false
+	}
+	return user, true
+}
+
+// beginTOTPEnrollment stores a new pending TOTP secret for user and returns
+// it with a QR code for their authenticator app.
+func (s *Server) beginTOTPEnrollment(w http.ResponseWriter, r *http.Request, user *db.User) {
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		s.logger.Error("generate_totp_secret_failed", "error", err, "component", "auth")
+		writeError(w, r, fmt.Errorf("internal error"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
+		return
+	}
+	uri := auth.TOTPURI(user.Username, secret)
+	png, err := auth.TOTPQRCode(uri, 256)
+	if err != nil {
+		s.logger.Error("generate_totp_qr_failed", "error", err, "component", "auth")
+		writeError(w, r, fmt.Errorf("internal error"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
+		return
+	}
+
+	if err := s.db.SetUserTOTPSecret(r.Context(), user.ID, secret); err != nil {
+		s.logger.Error("set_totp_secret_failed", "error", err, "user_id", user.ID, "component", "auth")
+		writeError(w, r, fmt.Errorf("failed to start enrollment"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
+		return
+	}
+
+	s.logger.Info("2fa_enrollment_started", "user", user.Username, "user_id", user.ID, "component", "auth")
+	s.auditf(r, "auth.2fa_enrollment_started", "user", "user %q started two-factor enrollment", user.Username)
+
+	writeJSON(w, http.StatusOK, twoFactorSetupResponse{
+		Secret:     secret,
+		OTPAuthURL: uri,
+		QRCode:     "data:image/png;base64," + base64.StdEncoding.EncodeToString(png),
+	})
+}
+
+// confirmTOTPEnrollment checks code against user's pending secret and, if
+// it matches, enables 2FA and returns freshly generated recovery codes.
+func (s *Server) confirmTOTPEnrollment(w http.ResponseWriter, r *http.Request, user *db.User, code string) ([]string, bool) {
+	ctx := r.Context()
+
+	if code == "" {
+		writeError(w, r, fmt.Errorf("code is required"), apperr.ErrValidation, http.StatusBadRequest, s.devMode)
+		return nil, false
+	}
+	totp, err := s.db.GetUserTOTP(ctx, user.ID)
+	if err != nil {
+		s.logger.Error("get_user_totp_failed", "error", err, "user_id", user.ID, "component", "auth")
+		writeError(w, r, fmt.Errorf("internal error"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
+		return nil, false
+	}
+	if totp == nil || totp.Secret == "" {
+		writeError(w, r, fmt.Errorf("two-factor enrollment has not been started"), apperr.Err2FANotEnabled, http.StatusBadRequest, s.devMode)
+		return nil, false
+	}
+
+	step, ok := auth.VerifyTOTP(totp.Secret, code, time.Now())
+	if !ok {
+		s.logger.Warn("2fa_enrollment_invalid_code", "user", user.Username, "remote_addr", r.RemoteAddr, "component", "auth")
+		s.auditf(r, "auth.2fa_failed", "user", "invalid code confirming two-factor enrollment for user %q", user.Username)
+		writeError(w, r, fmt.Errorf("invalid two-factor code"), apperr.ErrInvalid2FACode, http.StatusUnauthorized, s.devMode)
+		return nil, false
+	}
+
+	codes, hashes, err := auth.GenerateRecoveryCodes(auth.RecoveryCodeCount)
+	if err != nil {
+		s.logger.Error("generate_recovery_codes_failed", "error", err, "component", "auth")
+		writeError(w, r, fmt.Errorf("internal error"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
+		return nil, false
+	}
+	if err := s.db.EnableUserTOTP(ctx, user.ID, step, hashes); err != nil {
+		s.logger.Error("enable_totp_failed", "error", err, "user_id", user.ID, "component", "auth")
+		writeError(w, r, fmt.Errorf("failed to enable two-factor authentication"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
+		return nil, false
+	}
+	user.TOTPEnabled = true
+
+	s.logger.Info("2fa_enabled", "user", user.Username, "user_id", user.ID, "component", "auth")
+	s.auditf(r, "auth.2fa_enabled", "user", "user %q enabled two-factor authentication", user.Username)
+	return codes, true
+}
+
+// verifySecondFactor checks a TOTP code, or else a recovery code, for a
+// user with 2FA enabled. Each code is accepted only once. During login,
+// challenge is the login challenge: a rejected code counts toward the
+// user's lockout and, after auth.MaxChallengeFailures, revokes the challenge.
+func (s *Server) verifySecondFactor(w http.ResponseWriter, r *http.Request, user *db.User, code, recoveryCode string, challenge *auth.Claims) bool {
+	ctx := r.Context()
+
+	if code == "" && recoveryCode == "" {
+		writeError(w, r, fmt.Errorf("code or recovery_code is required"), apperr.ErrValidation, http.StatusBadRequest, s.devMode)
+		return false
+	}
+
+	var accepted bool
+	method := "totp"
+	if code != "" {
+		totp, err := s.db.GetUserTOTP(ctx, user.ID)
+		if err != nil || totp == nil {
+			s.logger.Error("get_user_totp_failed", "error", err, "user_id", user.ID, "component", "auth")
+			writeError(w, r, fmt.Errorf("internal error"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
+			return false
+		}
+		if step, ok := auth.VerifyTOTP(totp.Secret, code, time.Now()); ok {
+			accepted, err = s.db.UseTOTPStep(ctx, user.ID, step)
+			if err != nil {
+				s.logger.Error("use_totp_step_failed", "error", err, "user_id", user.ID, "component", "auth")
+				writeError(w, r, fmt.Errorf("internal error"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
+				return false
+			}
+		}
+	} else {
+		method = "recovery_code"
+		var err error
+		accepted, err = s.db.UseRecoveryCode(ctx, user.ID, auth.HashRecoveryCode(recoveryCode))
+		if err != nil {
+			s.logger.Error("use_recovery_code_failed", "error", err, "user_id", user.ID, "component", "auth")
+			writeError(w, r, fmt.Errorf("internal error"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
+			return false
+		}
+	}
+
+	if !accepted {
+		s.logger.Warn("2fa_verification_failed",
+			"user", user.Username,
+			"remote_addr", r.RemoteAddr,
+			"method", method,
+			"component", "auth",
+		)
+		s.auditf(r, "auth.2fa_failed", "user", "invalid %s for user %q", method, user.Username)
+		if challenge != nil {
+			s.recordFailedLogin(r, user)
+			if s.challenges.Fail(challenge) {
+				s.logger.Warn("auth_challenge_revoked",
+					"user", user.Username,
+					"remote_addr", r.RemoteAddr,
+					"component", "auth",
+				)
+			}
+		}
+		writeError(w, r, fmt.Errorf("invalid two-factor code"), apperr.ErrInvalid2FACode, http.StatusUnauthorized, s.devMode)
+		return false
+	}
+
+	if method == "recovery_code" {
+		s.logger.Info("2fa_recovery_code_used", "user", user.Username, "user_id", user.ID, "component", "auth")
+		s.auditf(r, "auth.2fa_recovery_code_used", "user", "user %q used a recovery code", user.Username)
+	} else {
+		s.auditf(r, "auth.2fa_verified", "user", "user %q verified a two-factor code", user.Username)
+	}
+	return true
+}
+
+func challengeClaims(user *db.User) *auth.Claims {
+	claims := &auth.Claims{Username: user.Username, Role: user.Role}
+	claims.Subject = strconv.FormatInt(user.ID, 10)
+	return claims
+}
@@ -0,0 +1,303 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/itsChris/wgpilot/internal/auth"
+	"github.com/itsChris/wgpilot/internal/db"
+)
+
+// newTestServerFor2FA returns a server with one admin user (id 1) and a
+// rate limit high enough for multi-step login flows.
+func newTestServerFor2FA(t *testing.T) *Server {
+	t.Helper()
+	srv := newTestServer(t)
+	createTestUser(t, srv.db, "admin", "correctpassword")
+
+	limiter, err := auth.NewLoginRateLimiter(100, time.Minute)
+	if err != nil {
+		t.Fatalf("NewLoginRateLimiter: %v", err)
+	}
+	t.Cleanup(func() { limiter.Stop() })
+	srv.rateLimiter = limiter
+	return srv
+}
+
+func postJSON(t *testing.T, srv *Server, path, body string, cookie *http.Cookie) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest("POST", path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if cookie != nil {
+		req.AddCookie(cookie)
+	}
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+	return w
+}
+
+func sessionCookieFrom(w *httptest.ResponseRecorder) *http.Cookie {
+	for _, c := range w.Result().Cookies() {
+		if c.Name == auth.CookieName && c.MaxAge > 0 {
+			return c
+		}
+	}
+	return nil
+}
+
+// enroll2FA runs the self-service enrollment for the admin user and returns
+// the TOTP secret and recovery codes.
+func enroll2FA(t *testing.T, srv *Server) (string, []string) {
+	t.Helper()
+	cookie := authCookie(t, srv)
+
+	w := postJSON(t, srv, "/api/auth/2fa/setup", `{}`, cookie)
+	if w.Code != http.StatusOK {
+		t.Fatalf("setup: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var setup twoFactorSetupResponse
+	json.NewDecoder(w.Body).Decode(&setup)
+	if setup.Secret == "" || !strings.HasPrefix(setup.QRCode, "data:image/png;base64,") {
+		t.Fatalf("unexpected setup response %+v", setup)
+	}
+
+	code, _ := auth.TOTPCode(setup.Secret, time.Now())
+	w = postJSON(t, srv, "/api/auth/2fa/enable", `{"code":"`+code+`"}`, cookie)
+	if w.Code != http.StatusOK {
+		t.Fatalf("enable: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var codes recoveryCodesResponse
+	json.NewDecoder(w.Body).Decode(&codes)
+	if len(codes.RecoveryCodes) != auth.RecoveryCodeCount {
+		t.Fatalf("expected %d recovery codes, got %d", auth.RecoveryCodeCount, len(codes.RecoveryCodes))
+	}
+	return setup.Secret, codes.RecoveryCodes
+}
+
+func loginForChallenge(t *testing.T, srv *Server) twoFactorChallengeResponse {
+	t.Helper()
+	w := postJSON(t, srv, "/api/auth/login", `{"username":"admin","password":"correctpassword"}`, nil)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("login: expected 202, got %d: %s", w.Code, w.Body.String())
+	}
+	if sessionCookieFrom(w) != nil {
+		t.Fatal("login must not issue a session before the second factor")
+	}
+	var challenge twoFactorChallengeResponse
+	json.NewDecoder(w.Body).Decode(&challenge)
+	return challenge
+}
+
+func TestLogin2FA_TOTP(t *testing.T) {
+	srv := newTestServerFor2FA(t)
+	secret, _ := enroll2FA(t, srv)
+
+	challenge := loginForChallenge(t, srv)
+	if !challenge.TwoFactorRequired || challenge.EnrollmentRequired || challenge.ChallengeToken == "" {
+		t.Fatalf("unexpected challenge %+v", challenge)
+	}
+
+	// The challenge token is not a session.
+	req := httptest.NewRequest("GET", "/api/auth/me", nil)
+	req.AddCookie(&http.Cookie{Name: auth.CookieName, Value: challenge.ChallengeToken})
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("expected challenge token to be rejected as a session, got %d", w.Code)
+	}
+
+	w = postJSON(t, srv, "/api/auth/login/2fa", `{"challenge_token":"`+challenge.ChallengeToken+`","code":"000000"}`, nil)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("wrong code: expected 401, got %d", w.Code)
+	}
+
+	// The enrollment consumed the current period's code, so use the next one.
+	code, _ := auth.TOTPCode(secret, time.Now().Add(30*time.Second))
+	body := `{"challenge_token":"` + challenge.ChallengeToken + `","code":"` + code + `"}`
+	w = postJSON(t, srv, "/api/auth/login/2fa", body, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if sessionCookieFrom(w) == nil {
+		t.Fatal("expected session cookie after second factor")
+	}
+
+	// The same code cannot be replayed.
+	w = postJSON(t, srv, "/api/auth/login/2fa", body, nil)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("replayed code: expected 401, got %d", w.Code)
+	}
+
+	entries, _, err := srv.db.ListAuditLog(req.Context(), 50, 0, db.AuditFilter{})
+	if err != nil {
+		t.Fatalf("ListAuditLog: %v", err)
+	}
+	actions := make(map[string]bool)
+	for _, e := range entries {
+		actions[e.Action] = true
+	}
+	for _, want := range []string{"auth.2fa_enrollment_started", "auth.2fa_enabled", "auth.2fa_challenged", "auth.2fa_failed", "auth.2fa_verified", "auth.login"} {
+		if !actions[want] {
+			t.Errorf("expected audit entry %q", want)
+		}
+	}
+}
+
+func TestLogin2FA_RecoveryCode(t *testing.T) {
+	srv := newTestServerFor2FA(t)
+	_, codes := enroll2FA(t, srv)
+
+	challenge := loginForChallenge(t, srv)
+	body := `{"challenge_token":"` + challenge.ChallengeToken + `","recovery_code":"` + strings.ToUpper(codes[0]) + `"}`
+	w := postJSON(t, srv, "/api/auth/login/2fa", body, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w = postJSON(t, srv, "/api/auth/login/2fa", body, nil)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("reused recovery code: expected 401, got %d", w.Code)
+	}
+
+	req := httptest.NewRequest("GET", "/api/auth/2fa", nil)
+	req.AddCookie(authCookie(t, srv))
+	w = httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+	var status twoFactorStatusResponse
+	json.NewDecoder(w.Body).Decode(&status)
+	if !status.Enabled || status.RecoveryCodesRemaining != auth.RecoveryCodeCount-1 {
+		t.Errorf("unexpected status %+v", status)
+	}
+}
+
+func TestLogin2FA_FailedCodesRevokeChallengeAndLock(t *testing.T) {
+	srv := newTestServerFor2FA(t)
+	srv.lockout = LockoutConfig{Threshold: 5, Duration: time.Hour}
+	secret, _ := enroll2FA(t, srv)
+
+	port := 40000
+	submit := func(token, code string) int {
+		t.Helper()
+		req := httptest.NewRequest("POST", "/api/auth/login/2fa", strings.NewReader(`{"challenge_token":"`+token+`","code":"`+code+`"}`))
+		req.Header.Set("Content-Type", "application/json")
+		// Every attempt comes from a new source port of the same client.
+		port++
+		req.RemoteAddr = fmt.Sprintf("192.0.2.1:%d", port)
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, req)
+		return w.Code
+	}
+	code, _ := auth.TOTPCode(secret, time.Now().Add(30*time.Second))
+
+	// A challenge is revoked after a few wrong codes; even the right code
+	// is then refused.
+	challenge := loginForChallenge(t, srv)
+	for i := 0; i < auth.MaxChallengeFailures; i++ {
+		if got := submit(challenge.ChallengeToken, "000000"); got != http.StatusUnauthorized {
+			t.Fatalf("failure %d: expected 401, got %d", i+1, got)
+		}
+	}
+	if got := submit(challenge.ChallengeToken, code); got != http.StatusUnauthorized {
+		t.Fatalf("revoked challenge: expected 401, got %d", got)
+	}
+
+	// Wrong codes count toward the lockout, which a correct password does
+	// not reset.
+	challenge = loginForChallenge(t, srv)
+	for i := auth.MaxChallengeFailures; i < srv.lockout.Threshold; i++ {
+		if got := submit(challenge.ChallengeToken, "000000"); got != http.StatusUnauthorized {
+			t.Fatalf("failure %d: expected 401, got %d", i+1, got)
+		}
+	}
+	if got := submit(challenge.ChallengeToken, code); got != http.StatusUnauthorized {
+		t.Fatalf("locked account: expected 401, got %d", got)
+	}
+	user, _ := srv.db.GetUserByUsername(context.Background(), "admin")
+	if !user.Locked(time.Now()) {
+		t.Fatalf("expected the account locked after %d failed codes", srv.lockout.Threshold)
+	}
+
+	// The rate limit applies per client, whatever the source port.
+	limiter, err := auth.NewLoginRateLimiter(2, time.Minute)
+	if err != nil {
+		t.Fatalf("NewLoginRateLimiter: %v", err)
+	}
+	t.Cleanup(func() { limiter.Stop() })
+	srv.rateLimiter = limiter
+	submit(challenge.ChallengeToken, "000000")
+	submit(challenge.ChallengeToken, "000000")
+	if got := submit(challenge.ChallengeToken, "000000"); got != http.StatusTooManyRequests {
+		t.Errorf("expected 429 from a new source port, got %d", got)
+	}
+}
+
+func TestLogin2FA_RequiredForAdminsForcesEnrollment(t *testing.T) {
+	srv := newTestServerFor2FA(t)
+
+	req := httptest.NewRequest("PUT", "/api/settings/2fa", strings.NewReader(`{"require_for_admins":true}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.AddCookie(authCookie(t, srv))
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("update policy: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	challenge := loginForChallenge(t, srv)
+	if !challenge.EnrollmentRequired {
+		t.Fatalf("expected enrollment to be required, got %+v", challenge)
+	}
+
+	w = postJSON(t, srv, "/api/auth/login/2fa/setup", `{"challenge_token":"`+challenge.ChallengeToken+`"}`, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("setup: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var setup twoFactorSetupResponse
+	json.NewDecoder(w.Body).Decode(&setup)
+
+	code, _ := auth.TOTPCode(setup.Secret, time.Now())
+	w = postJSON(t, srv, "/api/auth/login/2fa/enable", `{"challenge_token":"`+challenge.ChallengeToken+`","code":"`+code+`"}`, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("enable: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if sessionCookieFrom(w) == nil {
+		t.Fatal("expected session cookie after enrollment")
+	}
+	var resp twoFactorEnrollLoginResponse
+	json.NewDecoder(w.Body).Decode(&resp)
+	if resp.User.Username != "admin" || len(resp.RecoveryCodes) != auth.RecoveryCodeCount {
+		t.Errorf("unexpected response %+v", resp)
+	}
+
+	// While required, the admin cannot turn 2FA off.
+	next, _ := auth.TOTPCode(setup.Secret, time.Now().Add(30*time.Second))
+	w = postJSON(t, srv, "/api/auth/2fa/disable", `{"password":"correctpassword","code":"`+next+`"}`, authCookie(t, srv))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("disable while required: expected 403, got %d", w.Code)
+	}
+}
+
+func TestReset2FA(t *testing.T) {
+	srv := newTestServerFor2FA(t)
+	enroll2FA(t, srv)
+
+	req := httptest.NewRequest("DELETE", "/api/users/1/2fa", nil)
+	req.AddCookie(authCookie(t, srv))
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// Without 2FA the password alone logs in again.
+	w = postJSON(t, srv, "/api/auth/login", `{"username":"admin","password":"correctpassword"}`, nil)
+	if w.Code != http.StatusOK || sessionCookieFrom(w) == nil {
+		t.Errorf("expected direct login after reset, got %d: %s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,194 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/itsChris/wgpilot/internal/auth"
+	"github.com/itsChris/wgpilot/internal/db"
+	apperr "github.com/itsChris/wgpilot/internal/errors"
+)
+
+// ── Request/Response types ───────────────────────────────────────────
+
+type sessionResponse struct {
+	ID         string `json:"id"`
+	IP         string `json:"ip"`
+	UserAgent  string `json:"user_agent"`
+	CreatedAt  string `json:"created_at"`
+	LastSeenAt string `json:"last_seen_at"`
+	ExpiresAt  string `json:"expires_at"`
+	Current    bool   `json:"current"`
+}
+
+// ── Handlers ─────────────────────────────────────────────────────────
+
+// handleListSessions returns the current user's active sessions.
+func (s *Server) handleListSessions(w http.ResponseWriter, r *http.Request) {
+	user, ok := s.currentUser(w, r)
+	if !ok {
+		return
+	}
+	sessions, err := s.db.ListUserSessions(r.Context(), user.ID)
+	if err != nil {
+		s.logger.Error("list_sessions_failed", "error", err, "user_id", user.ID, "component", "auth")
+		writeError(w, r, fmt.Errorf("internal error"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
+		return
+	}
+
+	current := auth.UserFromContext(r.Context()).ID
+	resp := make([]sessionResponse, 0, len(sessions))
+	for i := range sessions {
+		resp = append(resp, sessionToResponse(&sessions[i], current))
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// handleRevokeSession logs out one of the current user's sessions.
+func (s *Server) handleRevokeSession(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id := r.PathValue("id")
+
+	user, ok := s.currentUser(w, r)
+	if !ok {
+		return
+	}
+	sess, err := s.db.GetUserSession(ctx, id)
+	if err != nil {
+		s.logger.Error("get_session_failed", "error", err, "user_id", user.ID, "component", "auth")
+		writeError(w, r, fmt.Errorf("internal error"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
+		return
+	}
+	if sess == nil || sess.UserID != user.ID {
+		writeError(w, r, fmt.Errorf("session not found"), apperr.ErrSessionNotFound, http.StatusNotFound, s.devMode)
+		return
+	}
+
+	if err := s.db.DeleteUserSession(ctx, id); err != nil {
+		s.logger.Error("revoke_session_failed", "error", err, "user_id", user.ID, "component", "auth")
+		writeError(w, r, fmt.Errorf("failed to revoke session"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
+		return
+	}
+	if id == auth.UserFromContext(ctx).ID {
+		s.sessions.ClearCookie(w)
+	}
+
+	s.logger.Info("session_revoked", "user", user.Username, "ip", sess.IP, "component", "auth")
+	s.auditf(r, "auth.session_revoked", "user", "user %q revoked their session from %s", user.Username, sess.IP)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleRevokeAllSessions logs the current user out everywhere. With
+// ?keep_current=true the session making the request stays logged in.
+func (s *Server) handleRevokeAllSessions(w http.ResponseWriter, r *http.Request) {
+	user, ok := s.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	var keep string
+	if r.URL.Query().Get("keep_current") == "true" {
+		keep = auth.UserFromContext(r.Context()).ID
+	}
+	n, err := s.db.DeleteUserSessions(r.Context(), user.ID, keep)
+	if err != nil {
+		s.logger.Error("revoke_sessions_failed", "error", err, "user_id", user.ID, "component", "auth")
+		writeError(w, r, fmt.Errorf("failed to revoke sessions"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
+		return
+	}
+	if keep == "" {
+		s.sessions.ClearCookie(w)
+	}
+
+	s.logger.Info("sessions_revoked", "user", user.Username, "count", n, "component", "auth")
+	s.auditf(r, "auth.sessions_revoked", "user", "user %q revoked %d sessions", user.Username, n)
+
+	writeJSON(w, http.StatusOK, map[string]int64{"revoked": n})
+}
+
+// handleRevokeUserSessions logs a user out everywhere (admin only).
+func (s *Server) handleRevokeUserSessions(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("invalid user ID"), apperr.ErrValidation, http.StatusBadRequest, s.devMode)
+		return
+	}
+
+	user, err := s.db.GetUserByID(ctx, id)
+	if err != nil {
+		s.logger.Error("get_user_failed", "error", err, "component", "handler", "user_id", id)
+		writeError(w, r, fmt.Errorf("failed to get user"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
+		return
+	}
+	if user == nil {
+		writeError(w, r, fmt.Errorf("user %d not found", id), apperr.ErrValidation, http.StatusNotFound, s.devMode)
+		return
+	}
+
+	n, err := s.db.DeleteUserSessions(ctx, id, "")
+	if err != nil {
+		s.logger.Error("revoke_sessions_failed", "error", err, "component", "handler", "user_id", id)
+		writeError(w, r, fmt.Errorf("failed to revoke sessions"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
+		return
+	}
+
+	s.logger.Info("user_sessions_revoked", "user_id", id, "username", user.Username, "count", n, "component", "handler")
+	s.auditf(r, "user.sessions_revoked", "user", "revoked %d sessions of user %q (id=%d)", n, user.Username, id)
+
+	writeJSON(w, http.StatusOK, map[string]int64{"revoked": n})
+}
+
+// ── Helpers ──────────────────────────────────────────────────────────
+
+// issueSession creates a session token for a user and records it, so that
+// the auth middleware accepts it until it expires or is revoked.
+func (s *Server) issueSession(r *http.Request, userID int64, username, role string) (string, error) {
+	token, claims, err := s.jwtService.GenerateSession(userID, username, role)
+	if err != nil {
+		return "", err
+	}
+	if err := s.db.CreateUserSession(r.Context(), &db.UserSession{
+		ID:        claims.ID,
+		UserID:    userID,
+		ExpiresAt: claims.ExpiresAt.Time,
+		IP:        auth.ClientIP(r),
+		UserAgent: r.UserAgent(),
+	}); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// revokeSessionFromCookie revokes the session whose token the request
+// carries, if any. It is used by logout, which is reachable without a
+// valid session.
+func (s *Server) revokeSessionFromCookie(r *http.Request) {
+	token, err := s.sessions.GetToken(r)
+	if err != nil {
+		return
+	}
+	claims, err := s.jwtService.Validate(token)
+	if err != nil || claims.ID == "" {
+		return
+	}
+	if err := s.db.DeleteUserSession(r.Context(), claims.ID); err != nil {
+		s.logger.Error("revoke_session_failed", "error", err, "user", claims.Username, "component", "auth")
+	}
+}
+
+func sessionToResponse(sess *db.UserSession, currentID string) sessionResponse {
+	return sessionResponse{
+		ID:         sess.ID,
+		IP:         sess.IP,
+		UserAgent:  sess.UserAgent,
+		CreatedAt:  sess.CreatedAt.Format(time.RFC3339),
+		LastSeenAt: sess.LastSeenAt.Format(time.RFC3339),
+		ExpiresAt:  sess.ExpiresAt.Format(time.RFC3339),
+		Current:    sess.ID == currentID,
+	}
+}
@@ -0,0 +1,169 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func sendWithCookie(t *testing.T, srv *Server, method, path string, cookie *http.Cookie) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, path, nil)
+	req.AddCookie(cookie)
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+	return w
+}
+
+func loginSession(t *testing.T, srv *Server, username, password string) *http.Cookie {
+	t.Helper()
+	w := loginAs(t, srv, username, password)
+	cookie := sessionCookieFrom(w)
+	if w.Code != http.StatusOK || cookie == nil {
+		t.Fatalf("login %s: expected a session, got %d: %s", username, w.Code, w.Body.String())
+	}
+	return cookie
+}
+
+func TestSessions_ListAndRevoke(t *testing.T) {
+	srv := newTestServerFor2FA(t)
+	laptop := loginSession(t, srv, "admin", "correctpassword")
+	phone := loginSession(t, srv, "admin", "correctpassword")
+
+	w := sendWithCookie(t, srv, "GET", "/api/auth/sessions", laptop)
+	if w.Code != http.StatusOK {
+		t.Fatalf("list: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var sessions []sessionResponse
+	if err := json.NewDecoder(w.Body).Decode(&sessions); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(sessions) != 2 {
+		t.Fatalf("expected 2 sessions, got %d", len(sessions))
+	}
+	var phoneID string
+	for _, s := range sessions {
+		if !s.Current {
+			phoneID = s.ID
+		}
+	}
+	if phoneID == "" || sessions[0].IP == "" {
+		t.Fatalf("unexpected sessions %+v", sessions)
+	}
+
+	if w := sendWithCookie(t, srv, "DELETE", "/api/auth/sessions/"+phoneID, laptop); w.Code != http.StatusNoContent {
+		t.Fatalf("revoke: expected 204, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := sendWithCookie(t, srv, "GET", "/api/auth/me", phone); w.Code != http.StatusUnauthorized {
+		t.Errorf("revoked session: expected 401, got %d", w.Code)
+	}
+	if w := sendWithCookie(t, srv, "GET", "/api/auth/me", laptop); w.Code != http.StatusOK {
+		t.Errorf("other session: expected 200, got %d", w.Code)
+	}
+}
+
+func TestSessions_CannotRevokeOtherUsersSession(t *testing.T) {
+	srv := newTestServerFor2FA(t)
+	createTestUser(t, srv.db, "bob", "bobpassword")
+	loginSession(t, srv, "bob", "bobpassword")
+	admin := loginSession(t, srv, "admin", "correctpassword")
+
+	bobs, _ := srv.db.ListUserSessions(context.Background(), 2)
+	if len(bobs) != 1 {
+		t.Fatalf("expected 1 session for bob, got %d", len(bobs))
+	}
+	if w := sendWithCookie(t, srv, "DELETE", "/api/auth/sessions/"+bobs[0].ID, admin); w.Code != http.StatusNotFound {
+		t.Errorf("expected 404, got %d", w.Code)
+	}
+}
+
+func TestSessions_LogOutEverywhere(t *testing.T) {
+	srv := newTestServerFor2FA(t)
+	laptop := loginSession(t, srv, "admin", "correctpassword")
+	phone := loginSession(t, srv, "admin", "correctpassword")
+	tablet := loginSession(t, srv, "admin", "correctpassword")
+
+	w := sendWithCookie(t, srv, "DELETE", "/api/auth/sessions?keep_current=true", laptop)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := sendWithCookie(t, srv, "GET", "/api/auth/me", phone); w.Code != http.StatusUnauthorized {
+		t.Errorf("phone: expected 401, got %d", w.Code)
+	}
+	if w := sendWithCookie(t, srv, "GET", "/api/auth/me", laptop); w.Code != http.StatusOK {
+		t.Errorf("kept session: expected 200, got %d", w.Code)
+	}
+
+	w = sendWithCookie(t, srv, "DELETE", "/api/auth/sessions", laptop)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	for _, c := range []*http.Cookie{laptop, tablet} {
+		if w := sendWithCookie(t, srv, "GET", "/api/auth/me", c); w.Code != http.StatusUnauthorized {
+			t.Errorf("expected 401 after logging out everywhere, got %d", w.Code)
+		}
+	}
+}
+
+func TestSessions_LogoutRevokesToken(t *testing.T) {
+	srv := newTestServerFor2FA(t)
+	cookie := loginSession(t, srv, "admin", "correctpassword")
+
+	if w := postJSON(t, srv, "/api/auth/logout", `{}`, cookie); w.Code != http.StatusOK {
+		t.Fatalf("logout: expected 200, got %d", w.Code)
+	}
+	// A copy of the token kept after logout no longer works.
+	if w := sendWithCookie(t, srv, "GET", "/api/auth/me", cookie); w.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401, got %d", w.Code)
+	}
+}
+
+func TestSessions_PasswordChangeRevokes(t *testing.T) {
+	srv := newTestServerFor2FA(t)
+	laptop := loginSession(t, srv, "admin", "correctpassword")
+	phone := loginSession(t, srv, "admin", "correctpassword")
+
+	req := httptest.NewRequest("PUT", "/api/auth/password", strings.NewReader(`{"old_password":"correctpassword","new_password":"newpassword123"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.AddCookie(laptop)
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("change password: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	for _, c := range []*http.Cookie{laptop, phone} {
+		if w := sendWithCookie(t, srv, "GET", "/api/auth/me", c); w.Code != http.StatusUnauthorized {
+			t.Errorf("expected 401 after a password change, got %d", w.Code)
+		}
+	}
+}
+
+func TestSessions_RevokedWithUser(t *testing.T) {
+	srv := newTestServerFor2FA(t)
+	createTestUser(t, srv.db, "bob", "bobpassword")
+	bob := loginSession(t, srv, "bob", "bobpassword")
+	admin := loginSession(t, srv, "admin", "correctpassword")
+
+	w := sendWithCookie(t, srv, "DELETE", "/api/users/2/sessions", admin)
+	if w.Code != http.StatusOK {
+		t.Fatalf("admin revoke: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := sendWithCookie(t, srv, "GET", "/api/auth/me", bob); w.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 after the admin revoked bob's sessions, got %d", w.Code)
+	}
+
+	bob = loginSession(t, srv, "bob", "bobpassword")
+	if w := sendWithCookie(t, srv, "DELETE", "/api/users/2", admin); w.Code != http.StatusNoContent {
+		t.Fatalf("delete user: expected 204, got %d", w.Code)
+	}
+	if left, _ := srv.db.ListUserSessions(context.Background(), 2); len(left) != 0 {
+		t.Errorf("expected bob's sessions to be deleted, %d left", len(left))
+	}
+	if w := sendWithCookie(t, srv, "GET", "/api/auth/me", bob); w.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 for a deleted user, got %d", w.Code)
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/itsChris/wgpilot/internal/auth"
 	"github.com/itsChris/wgpilot/internal/db"
@@ -13,22 +15,37 @@ import (
 // ── Request/Response types ───────────────────────────────────────────
 
 type createUserRequest struct {
-	Username string `json:"username"`
-	Password string `json:"password"`
-	Role     string `json:"role"`
+	Username           string `json:"username"`
+	Password           string `json:"password"`
+	Role               string `json:"role"`
+	AuthSource         string `json:"auth_source"` // "local" (default) or "ldap"
+	Email              string `json:"email"`
+	MustChangePassword bool   `json:"must_change_password"`
+}
+
+type updateUserRequest struct {
+	Role               *string `json:"role"`
+	Email              *string `json:"email"`
+	MustChangePassword *bool   `json:"must_change_password"`
 }
 
 type userResponse struct {
-	ID        int64  `json:"id"`
-	Username  string `json:"username"`
-	Role      string `json:"role"`
-	CreatedAt int64  `json:"created_at"`
-	UpdatedAt int64  `json:"updated_at"`
+	ID                 int64  `json:"id"`
+	Username           string `json:"username"`
+	Role               string `json:"role"`
+	TwoFactorEnabled   bool   `json:"two_factor_enabled"`
+	AuthSource         string `json:"auth_source"`
+	Email              string `json:"email"`
+	MustChangePassword bool   `json:"must_change_password"`
+	FailedLogins       int    `json:"failed_logins"`
+	LockedUntil        *int64 `json:"locked_until"` // set while the account is locked out
+	CreatedAt          int64  `json:"created_at"`
+	UpdatedAt          int64  `json:"updated_at"`
 }
 
 // ── Handlers ─────────────────────────────────────────────────────────
 
-// handleListUsers returns all users (admin only).
+// handleListUsers returns all users.
 func (s *Server) handleListUsers(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
@@ -47,7 +64,9 @@ func (s *Server) handleListUsers(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, result)
 }
 
-// handleCreateUser creates a new user (admin only).
+// handleCreateUser creates a new user with a role the caller may grant,
+// viewer by default. Directory users (auth_source "ldap") have no local
+// password.
 func (s *Server) handleCreateUser(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
@@ -61,15 +80,33 @@ func (s *Server) handleCreateUser(w http.ResponseWriter, r *http.Request) {
 		writeError(w, r, fmt.Errorf("username is required"), apperr.ErrValidation, http.StatusBadRequest, s.devMode)
 		return
 	}
-	if req.Password == "" || len(req.Password) < auth.MinPasswordLength {
-		writeError(w, r, fmt.Errorf("password must be at least %d characters", auth.MinPasswordLength), apperr.ErrValidation, http.StatusBadRequest, s.devMode)
+	switch req.AuthSource {
+	case "", db.AuthSourceLocal:
+		if err := s.passwords.Validate(req.Password); err != nil {
+			writeError(w, r, err, apperr.ErrWeakPassword, http.StatusBadRequest, s.devMode)
+			return
+		}
+	case db.AuthSourceLDAP:
+		if s.ldap.Authenticator == nil {
+			writeError(w, r, fmt.Errorf("LDAP authentication is not configured"), apperr.ErrValidation, http.StatusBadRequest, s.devMode)
+			return
+		}
+		if req.Password != "" || req.MustChangePassword {
+			writeError(w, r, fmt.Errorf("directory users cannot have a password"), apperr.ErrValidation, http.StatusBadRequest, s.devMode)
+			return
+		}
+	default:
+		writeError(w, r, fmt.Errorf("auth_source must be local or ldap"), apperr.ErrValidation, http.StatusBadRequest, s.devMode)
+		return
+	}
+	if !isValidEmail(req.Email) {
+		writeError(w, r, fmt.Errorf("invalid email address"), apperr.ErrValidation, http.StatusBadRequest, s.devMode)
 		return
 	}
 	if req.Role == "" {
-		req.Role = "viewer"
+		req.Role = auth.RoleViewer
 	}
-	if req.Role != "admin" && req.Role != "viewer" {
-		writeError(w, r, fmt.Errorf("role must be admin or viewer"), apperr.ErrValidation, http.StatusBadRequest, s.devMode)
+	if !s.canGrantRole(w, r, "role", req.Role) {
 		return
 	}
 
@@ -85,17 +122,23 @@ func (s *Server) handleCreateUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	hash, err := auth.HashPassword(req.Password)
-	if err != nil {
-		s.logger.Error("hash_password_failed", "error", err, "component", "handler")
-		writeError(w, r, fmt.Errorf("internal error"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
-		return
+	var hash string
+	if req.Password != "" {
+		hash, err = auth.HashPassword(req.Password)
+		if err != nil {
+			s.logger.Error("hash_password_failed", "error", err, "component", "handler")
+			writeError(w, r, fmt.Errorf("internal error"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
+			return
+		}
 	}
 
 	id, err := s.db.CreateUser(ctx, &db.User{
-		Username:     req.Username,
-		PasswordHash: hash,
-		Role:         req.Role,
+		Username:           req.Username,
+		PasswordHash:       hash,
+		Role:               req.Role,
+		AuthSource:         req.AuthSource,
+		Email:              req.Email,
+		MustChangePassword: req.MustChangePassword,
 	})
 	if err != nil {
 		s.logger.Error("create_user_failed", "error", err, "component", "handler")
@@ -112,11 +155,111 @@ func (s *Server) handleCreateUser(w http.ResponseWriter, r *http.Request) {
 
 	s.logger.Info("user_created", "user_id", id, "username", req.Username, "role", req.Role, "component", "handler")
 	s.auditf(r, "user.created", "user", "created user %q (id=%d, role=%s)", req.Username, id, req.Role)
+	s.resourceChanged(r, "user.created", "user", id, nil, userToResponse(created))
 
 	writeJSON(w, http.StatusCreated, userToResponse(created))
 }
 
-// handleDeleteUser deletes a user (admin only). Cannot delete self.
+// handleUpdateUser changes a user's role, email address or whether they
+// must change their password on the next login. To change the role the
+// caller must be able to grant both the old and the new role, and cannot
+// change their own; the user's sessions are then revoked so that they sign
+// in again with the new role.
+func (s *Server) handleUpdateUser(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("invalid user ID"), apperr.ErrValidation, http.StatusBadRequest, s.devMode)
+		return
+	}
+
+	var req updateUserRequest
+	if code, status, err := decodeJSON(r, &req); err != nil {
+		writeError(w, r, err, code, status, s.devMode)
+		return
+	}
+
+	user, err := s.db.GetUserByID(ctx, id)
+	if err != nil {
+		s.logger.Error("get_user_failed", "error", err, "component", "handler", "user_id", id)
+		writeError(w, r, fmt.Errorf("failed to get user"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
+		return
+	}
+	if user == nil {
+		writeError(w, r, fmt.Errorf("user %d not found", id), apperr.ErrValidation, http.StatusNotFound, s.devMode)
+		return
+	}
+
+	roleChanged := req.Role != nil && *req.Role != user.Role
+	emailChanged := req.Email != nil && *req.Email != user.Email
+	forceChanged := req.MustChangePassword != nil && *req.MustChangePassword != user.MustChangePassword
+	if !roleChanged && !emailChanged && !forceChanged {
+		writeJSON(w, http.StatusOK, userToResponse(user))
+		return
+	}
+	if roleChanged {
+		if claims := auth.UserFromContext(ctx); claims != nil && claims.Subject == strconv.FormatInt(id, 10) {
+			writeError(w, r, fmt.Errorf("cannot change your own role"), apperr.ErrValidation, http.StatusBadRequest, s.devMode)
+			return
+		}
+		if !s.canGrantRole(w, r, "role", user.Role) || !s.canGrantRole(w, r, "role", *req.Role) {
+			return
+		}
+	}
+	if emailChanged && !isValidEmail(*req.Email) {
+		writeError(w, r, fmt.Errorf("invalid email address"), apperr.ErrValidation, http.StatusBadRequest, s.devMode)
+		return
+	}
+	if forceChanged && user.AuthSource != db.AuthSourceLocal {
+		writeError(w, r, fmt.Errorf("directory users have no local password"), apperr.ErrValidation, http.StatusBadRequest, s.devMode)
+		return
+	}
+
+	before := userToResponse(user)
+	if emailChanged {
+		if err := s.db.UpdateUserEmail(ctx, id, *req.Email); err != nil {
+			s.logger.Error("update_user_email_failed", "error", err, "component", "handler", "user_id", id)
+			writeError(w, r, fmt.Errorf("failed to update user"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
+			return
+		}
+		s.auditf(r, "user.email_changed", "user", "email of user %q changed", user.Username)
+	}
+	if forceChanged {
+		if err := s.db.SetPasswordChangeRequired(ctx, id, *req.MustChangePassword); err != nil {
+			s.logger.Error("set_password_change_required_failed", "error", err, "component", "handler", "user_id", id)
+			writeError(w, r, fmt.Errorf("failed to update user"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
+			return
+		}
+		if *req.MustChangePassword {
+			s.auditf(r, "user.password_change_required", "user", "user %q must change their password on the next login", user.Username)
+		} else {
+			s.auditf(r, "user.password_change_cleared", "user", "user %q no longer has to change their password", user.Username)
+		}
+	}
+	if roleChanged {
+		if err := s.db.UpdateUserRole(ctx, id, *req.Role); err != nil {
+			s.logger.Error("update_user_role_failed", "error", err, "component", "handler", "user_id", id)
+			writeError(w, r, fmt.Errorf("failed to update user"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
+			return
+		}
+		if _, err := s.db.DeleteUserSessions(ctx, id, ""); err != nil {
+			s.logger.Error("revoke_user_sessions_failed", "error", err, "component", "handler", "user_id", id)
+		}
+		s.logger.Info("user_role_changed", "user_id", id, "username", user.Username, "role", *req.Role, "component", "handler")
+		s.auditf(r, "user.role_changed", "user", "role of user %q changed from %s to %s", user.Username, before.Role, *req.Role)
+	}
+
+	updated, _ := s.db.GetUserByID(ctx, id)
+	if updated == nil {
+		updated = user
+	}
+	s.resourceChanged(r, "user.updated", "user", id, before, userToResponse(updated))
+
+	writeJSON(w, http.StatusOK, userToResponse(updated))
+}
+
+// handleDeleteUser deletes a user. Cannot delete self.
 func (s *Server) handleDeleteUser(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
@@ -155,18 +298,104 @@ func (s *Server) handleDeleteUser(w http.ResponseWriter, r *http.Request) {
 
 	s.logger.Info("user_deleted", "user_id", id, "username", user.Username, "component", "handler")
 	s.auditf(r, "user.deleted", "user", "deleted user %q (id=%d)", user.Username, id)
+	s.resourceChanged(r, "user.deleted", "user", id, userToResponse(user), nil)
 
 	w.WriteHeader(http.StatusNoContent)
 }
 
 // ── Helpers ──────────────────────────────────────────────────────────
 
+// provisionUser creates the local account of a user who first logged in
+// through an external identity source. It refuses to take over an existing
+// account with the same name.
+func (s *Server) provisionUser(r *http.Request, source, username, externalID, role string) (*db.User, error) {
+	ctx := r.Context()
+	existing, err := s.db.GetUserByUsername(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return nil, fmt.Errorf("username %q is already taken", username)
+	}
+
+	// Without a password hash the account cannot log in with a local password.
+	id, err := s.db.CreateUser(ctx, &db.User{
+		Username:   username,
+		Role:       role,
+		AuthSource: source,
+		ExternalID: externalID,
+	})
+	if err != nil {
+		return nil, err
+	}
+	user, err := s.db.GetUserByID(ctx, id)
+	if err != nil || user == nil {
+		return nil, fmt.Errorf("get provisioned user %d: %w", id, err)
+	}
+
+	s.logger.Info("user_provisioned", "user_id", id, "username", username, "role", role, "source", source, "component", "auth")
+	r = r.WithContext(auth.WithUser(ctx, challengeClaims(user)))
+	s.auditf(r, "user.provisioned", "user", "provisioned %s user %q (id=%d, role=%s)", source, username, id, role)
+	s.resourceChanged(r, "user.created", "user", id, nil, userToResponse(user))
+	return user, nil
+}
+
+// syncUserRole updates the role of an externally managed user to the one
+// their identity source grants, if it changed. Sessions issued with the old
+// role are revoked.
+func (s *Server) syncUserRole(r *http.Request, user *db.User, role string) error {
+	if user.Role == role {
+		return nil
+	}
+	before := userToResponse(user)
+	if err := s.db.UpdateUserRole(r.Context(), user.ID, role); err != nil {
+		return err
+	}
+	if _, err := s.db.DeleteUserSessions(r.Context(), user.ID, ""); err != nil {
+		return err
+	}
+	user.Role = role
+	r = r.WithContext(auth.WithUser(r.Context(), challengeClaims(user)))
+	s.auditf(r, "user.role_synced", "user", "role of %s user %q changed from %s to %s", user.AuthSource, user.Username, before.Role, role)
+	s.resourceChanged(r, "user.updated", "user", user.ID, before, userToResponse(user))
+	return nil
+}
+
+// roleForGroups maps group names to a role. Names are compared without
+// regard to case, as LDAP DNs are. When groups map to several roles the most
+// privileged wins: admin, then custom roles by name, then viewer. With no
+// match defaultRole applies, and "" means the user has no access.
+func roleForGroups(groups []string, mapping map[string]string, defaultRole string) string {
+	var matched []string
+	for _, g := range groups {
+		for group, mapped := range mapping {
+			if strings.EqualFold(g, group) {
+				matched = append(matched, mapped)
+			}
+		}
+	}
+	if len(matched) == 0 {
+		return defaultRole
+	}
+	return rankedRoles(matched)[0]
+}
+
 func userToResponse(u *db.User) userResponse {
-	return userResponse{
-		ID:        u.ID,
-		Username:  u.Username,
-		Role:      u.Role,
-		CreatedAt: u.CreatedAt.Unix(),
-		UpdatedAt: u.UpdatedAt.Unix(),
+	resp := userResponse{
+		ID:                 u.ID,
+		Username:           u.Username,
+		Role:               u.Role,
+		TwoFactorEnabled:   u.TOTPEnabled,
+		AuthSource:         u.AuthSource,
+		Email:              u.Email,
+		MustChangePassword: u.MustChangePassword,
+		FailedLogins:       u.FailedLogins,
+		CreatedAt:          u.CreatedAt.Unix(),
+		UpdatedAt:          u.UpdatedAt.Unix(),
+	}
+	if u.Locked(time.Now()) {
+		t := u.LockedUntil.Unix()
+		resp.LockedUntil = &t
 	}
+	return resp
 }
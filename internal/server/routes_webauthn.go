@@ -0,0 +1,461 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/itsChris/wgpilot/internal/auth"
+	"github.com/itsChris/wgpilot/internal/db"
+	apperr "github.com/itsChris/wgpilot/internal/errors"
+)
+
+// ── Request/Response types ───────────────────────────────────────────
+
+type webauthnRegisterRequest struct {
+	Name       string                    `json:"name"`
+	Credential auth.RegistrationResponse `json:"credential"`
+}
+
+type webauthnLoginBeginRequest struct {
+	// ChallengeToken is set when WebAuthn is the second factor after a
+	// password; without it the login is passwordless.
+	ChallengeToken string `json:"challenge_token"`
+}
+
+type webauthnLoginFinishRequest struct {
+	Credential  auth.AssertionResponse `json:"credential"`
+	NewPassword string                 `json:"new_password"` // sets a new password when a change is required
+}
+
+type webauthnCredentialResponse struct {
+	ID        int64   `json:"id"`
+	Name      string  `json:"name"`
+	CreatedAt string  `json:"created_at"`
+	LastUsed  *string `json:"last_used"`
+}
+
+// ── Registration ─────────────────────────────────────────────────────
+
+// handleWebAuthnRegisterBegin returns the options for registering a new
+// security key or passkey for the current user.
+func (s *Server) handleWebAuthnRegisterBegin(w http.ResponseWriter, r *http.Request) {
+	user, ok := s.currentUser(w, r)
+	if !ok {
+		return
+	}
+	creds, ok := s.listWebAuthnCredentials(w, r, user.ID)
+	if !ok {
+		return
+	}
+	exclude := make([][]byte, 0, len(creds))
+	for _, c := range creds {
+		exclude = append(exclude, c.CredentialID)
+	}
+
+	challenge, ok := s.beginCeremony(w, r, auth.CeremonyRegister, user.ID)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, s.relyingParty(r).CreationOptions(auth.UserHandle(user.ID), user.Username, challenge, exclude))
+}
+
+// handleWebAuthnRegisterFinish verifies the authenticator's response and
+// stores the new credential.
+func (s *Server) handleWebAuthnRegisterFinish(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var req webauthnRegisterRequest
+	if code, status, err := decodeJSON(r, &req); err != nil {
+		writeError(w, r, err, code, status, s.devMode)
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if len(req.Name) > 64 {
+		writeError(w, r, fmt.Errorf("name must be at most 64 characters"), apperr.ErrValidation, http.StatusBadRequest, s.devMode)
+		return
+	}
+
+	user, ok := s.currentUser(w, r)
+	if !ok {
+		return
+	}
+	sess, ok := s.takeCeremony(w, r, req.Credential.Response.ClientDataJSON)
+	if !ok {
+		return
+	}
+	if sess.Ceremony != auth.CeremonyRegister || sess.UserID != user.ID {
+		writeError(w, r, fmt.Errorf("registration ceremony expired or invalid"), apperr.ErrSessionExpired, http.StatusUnauthorized, s.devMode)
+		return
+	}
+
+	verified, err := s.relyingParty(r).VerifyRegistration(&req.Credential, sess.Challenge)
+	if err != nil {
+		s.logger.Warn("webauthn_registration_failed",
+			"user", user.Username,
+			"remote_addr", r.RemoteAddr,
+			"error", err,
+			"component", "auth",
+		)
+		writeError(w, r, fmt.Errorf("security key registration failed: %w", err), apperr.ErrWebAuthnFailed, http.StatusBadRequest, s.devMode)
+		return
+	}
+
+	existing, err := s.db.GetWebAuthnCredential(ctx, verified.ID)
+	if err != nil {
+		s.logger.Error("get_webauthn_credential_failed", "error", err, "component", "auth")
+		writeError(w, r, fmt.Errorf("internal error"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
+		return
+	}
+	if existing != nil {
+		writeError(w, r, fmt.Errorf("security key is already registered"), apperr.ErrValidation, http.StatusConflict, s.devMode)
+		return
+	}
+
+	if req.Name == "" {
+		req.Name = "Security key"
+	}
+	cred := &db.WebAuthnCredential{
+		UserID:       user.ID,
+		CredentialID: verified.ID,
+		PublicKey:    verified.PublicKey,
+		SignCount:    verified.SignCount,
+		AAGUID:       verified.AAGUID,
+		Name:         req.Name,
+	}
+	id, err := s.db.CreateWebAuthnCredential(ctx, cred)
+	if err != nil {
+		s.logger.Error("create_webauthn_credential_failed", "error", err, "user_id", user.ID, "component", "auth")
+		writeError(w, r, fmt.Errorf("failed to store security key"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
+		return
+	}
+	cred.ID = id
+	cred.CreatedAt = time.Now()
+
+	s.logger.Info("webauthn_registered", "user", user.Username, "user_id", user.ID, "credential_id", id, "component", "auth")
+	s.auditf(r, "auth.webauthn_registered", "user", "user %q registered security key %q (id=%d)", user.Username, cred.Name, id)
+
+	writeJSON(w, http.StatusCreated, webauthnCredentialToResponse(cred))
+}
+
+// ── Credential management ────────────────────────────────────────────
+
+// handleListWebAuthnCredentials lists the current user's security keys.
+func (s *Server) handleListWebAuthnCredentials(w http.ResponseWriter, r *http.Request) {
+	user, ok := s.currentUser(w, r)
+	if !ok {
+		return
+	}
+	creds, ok := s.listWebAuthnCredentials(w, r, user.ID)
+	if !ok {
+		return
+	}
+	resp := make([]webauthnCredentialResponse, 0, len(creds))
+	for i := range creds {
+		resp = append(resp, webauthnCredentialToResponse(&creds[i]))
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// handleDeleteWebAuthnCredential removes one of the current user's security
+// keys. The last second factor cannot be removed while policy requires one.
+func (s *Server) handleDeleteWebAuthnCredential(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("invalid credential ID"), apperr.ErrValidation, http.StatusBadRequest, s.devMode)
+		return
+	}
+
+	user, ok := s.currentUser(w, r)
+	if !ok {
+		return
+	}
+	cred, err := s.db.GetWebAuthnCredentialByID(ctx, id)
+	if err != nil {
+		s.logger.Error("get_webauthn_credential_failed", "error", err, "credential_id", id, "component", "auth")
+		writeError(w, r, fmt.Errorf("internal error"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
+		return
+	}
+	if cred == nil || cred.UserID != user.ID {
+		writeError(w, r, fmt.Errorf("credential %d not found", id), apperr.ErrCredentialNotFound, http.StatusNotFound, s.devMode)
+		return
+	}
+
+	if !user.TOTPEnabled {
+		required, err := s.twoFactorRequired(ctx, user.Role)
+		if err != nil {
+			s.logger.Error("2fa_policy_read_failed", "error", err, "operation", "delete_webauthn_credential", "component", "auth")
+			writeError(w, r, fmt.Errorf("internal error"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
+			return
+		}
+		n, err := s.db.CountWebAuthnCredentials(ctx, user.ID)
+		if err != nil {
+			s.logger.Error("count_webauthn_credentials_failed", "error", err, "user_id", user.ID, "component", "auth")
+			writeError(w, r, fmt.Errorf("internal error"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
+			return
+		}
+		if required && n <= 1 {
+			writeError(w, r, fmt.Errorf("two-factor authentication is required for the %s role", user.Role), apperr.Err2FARequired, http.StatusForbidden, s.devMode)
+			return
+		}
+	}
+
+	if err := s.db.DeleteWebAuthnCredential(ctx, id); err != nil {
+		s.logger.Error("delete_webauthn_credential_failed", "error", err, "credential_id", id, "component", "auth")
+		writeError(w, r, fmt.Errorf("failed to delete security key"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
+		return
+	}
+
+	s.logger.Info("webauthn_removed", "user", user.Username, "user_id", user.ID, "credential_id", id, "component", "auth")
+	s.auditf(r, "auth.webauthn_removed", "user", "user %q removed security key %q (id=%d)", user.Username, cred.Name, id)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ── Login ────────────────────────────────────────────────────────────
+
+// handleWebAuthnLoginBegin returns the options for a WebAuthn login. With a
+// challenge token from the password step, the user's security keys are
+// offered as the second factor. Without one, any discoverable credential
+// (passkey) may be used, and user verification is required since it
+// replaces the password. Starting a login counts against the login rate
+// limit.
+func (s *Server) handleWebAuthnLoginBegin(w http.ResponseWriter, r *http.Request) {
+	if !s.allowAuthAttempt(w, r) {
+		return
+	}
+
+	var req webauthnLoginBeginRequest
+	if code, status, err := decodeJSON(r, &req); err != nil {
+		writeError(w, r, err, code, status, s.devMode)
+		return
+	}
+
+	rp := s.relyingParty(r)
+	if req.ChallengeToken == "" {
+		challenge, ok := s.beginCeremony(w, r, auth.CeremonyPasswordless, 0)
+		if !ok {
+			return
+		}
+		writeJSON(w, http.StatusOK, rp.RequestOptions(challenge, nil, "required"))
+		return
+	}
+
+	user, r, ok := s.challengeUser(w, r, req.ChallengeToken)
+	if !ok {
+		return
+	}
+	creds, ok := s.listWebAuthnCredentials(w, r, user.ID)
+	if !ok {
+		return
+	}
+	if len(creds) == 0 {
+		writeError(w, r, fmt.Errorf("no security keys are registered"), apperr.Err2FANotEnabled, http.StatusBadRequest, s.devMode)
+		return
+	}
+	allow := make([][]byte, 0, len(creds))
+	for _, c := range creds {
+		allow = append(allow, c.CredentialID)
+	}
+
+	challenge, ok := s.beginCeremony(w, r, auth.CeremonySecondFactor, user.ID)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, rp.RequestOptions(challenge, allow, "preferred"))
+}
+
+// handleWebAuthnLoginFinish verifies a WebAuthn assertion and issues the
+// session cookie. Account lockout and a required password change apply as
+// they do to password logins.
+func (s *Server) handleWebAuthnLoginFinish(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if !s.allowAuthAttempt(w, r) {
+		return
+	}
+
+	var req webauthnLoginFinishRequest
+	if code, status, err := decodeJSON(r, &req); err != nil {
+		writeError(w, r, err, code, status, s.devMode)
+		return
+	}
+
+	sess, ok := s.takeCeremony(w, r, req.Credential.Response.ClientDataJSON)
+	if !ok {
+		return
+	}
+	passwordless := sess.Ceremony == auth.CeremonyPasswordless
+	if !passwordless && sess.Ceremony != auth.CeremonySecondFactor {
+		writeError(w, r, fmt.Errorf("login ceremony expired or invalid"), apperr.ErrSessionExpired, http.StatusUnauthorized, s.devMode)
+		return
+	}
+
+	credID, err := req.Credential.CredentialID()
+	if err != nil {
+		writeError(w, r, fmt.Errorf("invalid credential id"), apperr.ErrValidation, http.StatusBadRequest, s.devMode)
+		return
+	}
+	cred, err := s.db.GetWebAuthnCredential(ctx, credID)
+	if err != nil {
+		s.logger.Error("get_webauthn_credential_failed", "error", err, "component", "auth")
+		writeError(w, r, fmt.Errorf("internal error"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
+		return
+	}
+	if cred == nil || (sess.UserID != 0 && cred.UserID != sess.UserID) {
+		s.logger.Warn("webauthn_login_failed",
+			"remote_addr", r.RemoteAddr,
+			"reason", "unknown_credential",
+			"component", "auth",
+		)
+		writeError(w, r, fmt.Errorf("security key is not registered"), apperr.ErrWebAuthnFailed, http.StatusUnauthorized, s.devMode)
+		return
+	}
+	if passwordless && req.Credential.Response.UserHandle != "" {
+		if id, err := req.Credential.UserID(); err != nil || id != cred.UserID {
+			writeError(w, r, fmt.Errorf("security key is not registered"), apperr.ErrWebAuthnFailed, http.StatusUnauthorized, s.devMode)
+			return
+		}
+	}
+
+	user, err := s.db.GetUserByID(ctx, cred.UserID)
+	if err != nil || user == nil {
+		s.logger.Error("auth_get_user_failed", "error", err, "user_id", cred.UserID, "component", "auth")
+		writeError(w, r, fmt.Errorf("internal error"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
+		return
+	}
+	r = r.WithContext(auth.WithUser(ctx, challengeClaims(user)))
+	// A locked account stays locked for its security keys too, refused
+	// like an unknown key.
+	if user.Locked(time.Now()) {
+		s.logger.Warn("webauthn_login_failed",
+			"user", user.Username,
+			"remote_addr", r.RemoteAddr,
+			"reason", "account_locked",
+			"component", "auth",
+		)
+		writeError(w, r, fmt.Errorf("security key is not registered"), apperr.ErrWebAuthnFailed, http.StatusUnauthorized, s.devMode)
+		return
+	}
+
+	signCount, err := s.relyingParty(r).VerifyAssertion(&req.Credential, sess.Challenge, cred.PublicKey, cred.SignCount, passwordless)
+	if err != nil {
+		s.logger.Warn("webauthn_login_failed",
+			"user", user.Username,
+			"remote_addr", r.RemoteAddr,
+			"reason", "verification_failed",
+			"error", err,
+			"component", "auth",
+		)
+		s.auditf(r, "auth.webauthn_failed", "user", "security key verification failed for user %q", user.Username)
+		writeError(w, r, fmt.Errorf("security key verification failed"), apperr.ErrWebAuthnFailed, http.StatusUnauthorized, s.devMode)
+		return
+	}
+	if err := s.db.UpdateWebAuthnCredentialUsage(ctx, cred.ID, signCount); err != nil {
+		s.logger.Error("update_webauthn_credential_failed", "error", err, "credential_id", cred.ID, "component", "auth")
+		writeError(w, r, fmt.Errorf("internal error"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
+		return
+	}
+
+	s.auditf(r, "auth.webauthn_verified", "user", "user %q verified security key %q (passwordless: %t)", user.Username, cred.Name, passwordless)
+	if !s.checkRequiredPassword(w, r, user, req.NewPassword) || !s.finishLogin(w, r, user, req.NewPassword) {
+		return
+	}
+
+	writeJSON(w, http.StatusOK, loginResponse{
+		User: userInfo{ID: user.ID, Username: user.Username},
+	})
+}
+
+// ── Helpers ──────────────────────────────────────────────────────────
+
+// relyingParty returns the configured relying party, filling in what is not
+// configured from the request: the ID from its host name and the allowed
+// origin from its host and scheme. Behind a TLS-terminating proxy the
+// origin must be configured.
+func (s *Server) relyingParty(r *http.Request) auth.RelyingParty {
+	rp := s.webauthn
+	if rp.Name == "" {
+		rp.Name = auth.TOTPIssuer
+	}
+	if rp.ID == "" {
+		rp.ID = r.Host
+		if host, _, err := net.SplitHostPort(r.Host); err == nil {
+			rp.ID = host
+		}
+	}
+	if len(rp.Origins) == 0 {
+		scheme := "http"
+		if r.TLS != nil {
+			scheme = "https"
+		}
+		rp.Origins = []string{scheme + "://" + r.Host}
+	}
+	return rp
+}
+
+// beginCeremony records a pending ceremony and returns its challenge.
+// Passwordless logins are recorded against the client's IP address, which
+// limits how many one client can have pending.
+func (s *Server) beginCeremony(w http.ResponseWriter, r *http.Request, ceremony string, userID int64) ([]byte, bool) {
+	challenge, err := auth.NewWebAuthnChallenge()
+	if err != nil {
+		s.logger.Error("webauthn_challenge_failed", "error", err, "component", "auth")
+		writeError(w, r, fmt.Errorf("internal error"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
+		return nil, false
+	}
+	sess := auth.WebAuthnSession{Challenge: challenge, Ceremony: ceremony, UserID: userID}
+	if ceremony == auth.CeremonyPasswordless {
+		sess.Client = auth.ClientIP(r)
+	}
+	if err := s.ceremonies.Put(sess); err != nil {
+		s.logger.Warn("webauthn_ceremony_rejected", "error", err, "remote_addr", r.RemoteAddr, "component", "auth")
+		w.Header().Set("Retry-After", "60")
+		writeError(w, r, err, apperr.ErrRateLimited, http.StatusTooManyRequests, s.devMode)
+		return nil, false
+	}
+	return challenge, true
+}
+
+// takeCeremony looks up and consumes the pending ceremony a response
+// belongs to, by the challenge in its client data.
+func (s *Server) takeCeremony(w http.ResponseWriter, r *http.Request, clientDataJSON string) (auth.WebAuthnSession, bool) {
+	challenge, err := auth.ClientDataChallenge(clientDataJSON)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("invalid credential response: %w", err), apperr.ErrValidation, http.StatusBadRequest, s.devMode)
+		return auth.WebAuthnSession{}, false
+	}
+	sess, ok := s.ceremonies.Take(challenge)
+	if !ok {
+		writeError(w, r, fmt.Errorf("ceremony expired or invalid"), apperr.ErrSessionExpired, http.StatusUnauthorized, s.devMode)
+		return auth.WebAuthnSession{}, false
+	}
+	return sess, true
+}
+
+func (s *Server) listWebAuthnCredentials(w http.ResponseWriter, r *http.Request, userID int64) ([]db.WebAuthnCredential, bool) {
+	creds, err := s.db.ListWebAuthnCredentials(r.Context(), userID)
+	if err != nil {
+		s.logger.Error("list_webauthn_credentials_failed", "error", err, "user_id", userID, "component", "auth")
+		writeError(w, r, fmt.Errorf("internal error"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
+		return nil, false
+	}
+	return creds, true
+}
+
+func webauthnCredentialToResponse(c *db.WebAuthnCredential) webauthnCredentialResponse {
+	resp := webauthnCredentialResponse{
+		ID:        c.ID,
+		Name:      c.Name,
+		CreatedAt: c.CreatedAt.Format(time.RFC3339),
+	}
+	if c.LastUsed != nil {
+		s := c.LastUsed.Format(time.RFC3339)
+		resp.LastUsed = &s
+	}
+	return resp
+}
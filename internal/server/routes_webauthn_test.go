@@ -0,0 +1,277 @@
+package server
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/itsChris/wgpilot/internal/auth"
+	"github.com/itsChris/wgpilot/internal/db"
+	"github.com/itsChris/wgpilot/internal/testutil"
+)
+
+// httptest requests are for http://example.com, which the relying party
+// defaults to.
+func newTestAuthenticator() *testutil.SoftAuthenticator {
+	return testutil.NewSoftAuthenticator("example.com", "http://example.com")
+}
+
+func decodeChallenge(t *testing.T, w *httptest.ResponseRecorder) []byte {
+	t.Helper()
+	var opts struct {
+		Challenge string `json:"challenge"`
+	}
+	json.NewDecoder(w.Body).Decode(&opts)
+	challenge, err := base64.RawURLEncoding.DecodeString(opts.Challenge)
+	if err != nil || len(challenge) == 0 {
+		t.Fatalf("invalid challenge %q: %v", opts.Challenge, err)
+	}
+	return challenge
+}
+
+// registerSecurityKey registers a credential on a for the admin user.
+func registerSecurityKey(t *testing.T, srv *Server, a *testutil.SoftAuthenticator) {
+	t.Helper()
+	cookie := authCookie(t, srv)
+
+	w := postJSON(t, srv, "/api/auth/webauthn/register/begin", `{}`, cookie)
+	if w.Code != http.StatusOK {
+		t.Fatalf("register begin: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	challenge := decodeChallenge(t, w)
+
+	resp, err := a.Register(challenge, auth.UserHandle(1))
+	if err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	w = postJSON(t, srv, "/api/auth/webauthn/register/finish", fmt.Sprintf(`{"name":"yubikey","credential":%s}`, resp), cookie)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("register finish: expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestWebAuthn_PasswordlessLogin(t *testing.T) {
+	srv := newTestServerFor2FA(t)
+	a := newTestAuthenticator()
+	registerSecurityKey(t, srv, a)
+
+	req := authRequest(t, srv, httptest.NewRequest("GET", "/api/auth/webauthn/credentials", nil))
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+	var creds []webauthnCredentialResponse
+	json.NewDecoder(w.Body).Decode(&creds)
+	if len(creds) != 1 || creds[0].Name != "yubikey" {
+		t.Fatalf("unexpected credentials %+v", creds)
+	}
+
+	w = postJSON(t, srv, "/api/auth/webauthn/login/begin", `{}`, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("login begin: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	challenge := decodeChallenge(t, w)
+	resp, _ := a.Assert(challenge, nil)
+	body := fmt.Sprintf(`{"credential":%s}`, resp)
+
+	w = postJSON(t, srv, "/api/auth/webauthn/login/finish", body, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("login finish: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if sessionCookieFrom(w) == nil {
+		t.Fatal("expected a session cookie")
+	}
+
+	// Each challenge can be answered once.
+	w = postJSON(t, srv, "/api/auth/webauthn/login/finish", body, nil)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("replay: expected 401, got %d", w.Code)
+	}
+}
+
+func TestWebAuthn_PasswordlessAccountState(t *testing.T) {
+	srv := newTestServerFor2FA(t)
+	a := newTestAuthenticator()
+	registerSecurityKey(t, srv, a)
+	ctx := context.Background()
+
+	passkeyLogin := func(extra string) *httptest.ResponseRecorder {
+		t.Helper()
+		w := postJSON(t, srv, "/api/auth/webauthn/login/begin", `{}`, nil)
+		resp, _ := a.Assert(decodeChallenge(t, w), nil)
+		return postJSON(t, srv, "/api/auth/webauthn/login/finish", fmt.Sprintf(`{"credential":%s%s}`, resp, extra), nil)
+	}
+
+	if _, err := srv.db.RecordFailedLogin(ctx, 1, 1, time.Hour); err != nil {
+		t.Fatalf("RecordFailedLogin: %v", err)
+	}
+	if w := passkeyLogin(""); w.Code != http.StatusUnauthorized || sessionCookieFrom(w) != nil {
+		t.Errorf("locked: expected 401 without a session, got %d: %s", w.Code, w.Body.String())
+	}
+	if err := srv.db.UnlockUser(ctx, 1); err != nil {
+		t.Fatalf("UnlockUser: %v", err)
+	}
+
+	if err := srv.db.SetPasswordChangeRequired(ctx, 1, true); err != nil {
+		t.Fatalf("SetPasswordChangeRequired: %v", err)
+	}
+	if w := passkeyLogin(""); w.Code != http.StatusForbidden || !strings.Contains(w.Body.String(), "PASSWORD_CHANGE_REQUIRED") {
+		t.Errorf("change required: expected 403 PASSWORD_CHANGE_REQUIRED, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := passkeyLogin(`,"new_password":"newpassword1"`); w.Code != http.StatusOK || sessionCookieFrom(w) == nil {
+		t.Fatalf("with new password: expected 200 with a session, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := loginAs(t, srv, "admin", "newpassword1"); w.Code != http.StatusAccepted {
+		t.Errorf("login with new password: expected 202, got %d", w.Code)
+	}
+}
+
+func TestWebAuthn_PasswordlessRequiresUserVerification(t *testing.T) {
+	srv := newTestServerFor2FA(t)
+	a := newTestAuthenticator()
+	registerSecurityKey(t, srv, a)
+	a.UserVerified = false
+
+	w := postJSON(t, srv, "/api/auth/webauthn/login/begin", `{}`, nil)
+	resp, _ := a.Assert(decodeChallenge(t, w), nil)
+	w = postJSON(t, srv, "/api/auth/webauthn/login/finish", fmt.Sprintf(`{"credential":%s}`, resp), nil)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 without user verification, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestWebAuthn_PasswordlessBeginIsLimitedPerClient(t *testing.T) {
+	srv := newTestServerFor2FA(t)
+	a := newTestAuthenticator()
+	registerSecurityKey(t, srv, a)
+	challenge := loginForChallenge(t, srv)
+
+	var w *httptest.ResponseRecorder
+	for i := 0; i < 20; i++ {
+		if w = postJSON(t, srv, "/api/auth/webauthn/login/begin", `{}`, nil); w.Code != http.StatusOK {
+			break
+		}
+	}
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected pending passwordless logins to be capped with 429, got %d", w.Code)
+	}
+
+	// Other ceremonies are unaffected.
+	w = postJSON(t, srv, "/api/auth/webauthn/login/begin", `{"challenge_token":"`+challenge.ChallengeToken+`"}`, nil)
+	if w.Code != http.StatusOK {
+		t.Errorf("second factor begin: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestWebAuthn_SecondFactor(t *testing.T) {
+	srv := newTestServerFor2FA(t)
+	a := newTestAuthenticator()
+	registerSecurityKey(t, srv, a)
+
+	challenge := loginForChallenge(t, srv)
+	if challenge.EnrollmentRequired || len(challenge.Methods) != 1 || challenge.Methods[0] != "webauthn" {
+		t.Fatalf("unexpected challenge %+v", challenge)
+	}
+
+	w := postJSON(t, srv, "/api/auth/webauthn/login/begin", `{"challenge_token":"`+challenge.ChallengeToken+`"}`, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("login begin: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var opts auth.CredentialRequestOptions
+	json.NewDecoder(w.Body).Decode(&opts)
+	if len(opts.AllowCredentials) != 1 || opts.UserVerification != "preferred" {
+		t.Fatalf("unexpected options %+v", opts)
+	}
+
+	// A security key without user verification is fine as a second factor.
+	a.UserVerified = false
+	raw, _ := base64.RawURLEncoding.DecodeString(opts.Challenge)
+	resp, _ := a.Assert(raw, nil)
+	w = postJSON(t, srv, "/api/auth/webauthn/login/finish", fmt.Sprintf(`{"credential":%s}`, resp), nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("login finish: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if sessionCookieFrom(w) == nil {
+		t.Fatal("expected a session cookie")
+	}
+}
+
+func TestWebAuthn_SecondFactorRejectsOtherUsersKey(t *testing.T) {
+	srv := newTestServerFor2FA(t)
+	a := newTestAuthenticator()
+	registerSecurityKey(t, srv, a)
+
+	// bob has a password and a key of his own; admin's key must not
+	// complete his login.
+	createTestUser(t, srv.db, "bob", "bobpassword1")
+	bob, _ := srv.db.GetUserByUsername(context.Background(), "bob")
+	if _, err := srv.db.CreateWebAuthnCredential(context.Background(), &db.WebAuthnCredential{
+		UserID: bob.ID, CredentialID: []byte("bob-key"), PublicKey: []byte{0xa0},
+	}); err != nil {
+		t.Fatalf("CreateWebAuthnCredential: %v", err)
+	}
+	w := postJSON(t, srv, "/api/auth/login", `{"username":"bob","password":"bobpassword1"}`, nil)
+	var challenge twoFactorChallengeResponse
+	json.NewDecoder(w.Body).Decode(&challenge)
+
+	w = postJSON(t, srv, "/api/auth/webauthn/login/begin", `{"challenge_token":"`+challenge.ChallengeToken+`"}`, nil)
+	resp, _ := a.Assert(decodeChallenge(t, w), nil)
+	w = postJSON(t, srv, "/api/auth/webauthn/login/finish", fmt.Sprintf(`{"credential":%s}`, resp), nil)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestWebAuthn_DeleteCredential(t *testing.T) {
+	srv := newTestServerFor2FA(t)
+	registerSecurityKey(t, srv, newTestAuthenticator())
+	ctx := context.Background()
+
+	creds, _ := srv.db.ListWebAuthnCredentials(ctx, 1)
+	path := fmt.Sprintf("/api/auth/webauthn/credentials/%d", creds[0].ID)
+
+	// The only second factor cannot be removed while policy requires one.
+	srv.db.SetSetting(ctx, settingRequire2FAAdmin, "true")
+	req := authRequest(t, srv, httptest.NewRequest("DELETE", path, nil))
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("expected 403 while 2FA is required, got %d", w.Code)
+	}
+
+	srv.db.SetSetting(ctx, settingRequire2FAAdmin, "false")
+	req = authRequest(t, srv, httptest.NewRequest("DELETE", path, nil))
+	w = httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d: %s", w.Code, w.Body.String())
+	}
+	if n, _ := srv.db.CountWebAuthnCredentials(ctx, 1); n != 0 {
+		t.Errorf("expected credential to be deleted, %d left", n)
+	}
+
+	// With no second factor left, login issues a session straight away.
+	w = postJSON(t, srv, "/api/auth/login", `{"username":"admin","password":"correctpassword"}`, nil)
+	if w.Code != http.StatusOK {
+		t.Errorf("login: expected 200, got %d", w.Code)
+	}
+}
+
+func TestReset2FA_RemovesSecurityKeys(t *testing.T) {
+	srv := newTestServerFor2FA(t)
+	registerSecurityKey(t, srv, newTestAuthenticator())
+
+	req := authRequest(t, srv, httptest.NewRequest("DELETE", "/api/users/1/2fa", nil))
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d: %s", w.Code, w.Body.String())
+	}
+	if n, _ := srv.db.CountWebAuthnCredentials(context.Background(), 1); n != 0 {
+		t.Errorf("expected security keys to be removed, %d left", n)
+	}
+}
@@ -0,0 +1,409 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/itsChris/wgpilot/internal/db"
+	apperr "github.com/itsChris/wgpilot/internal/errors"
+)
+
+// webhookDeliveriesLimit caps the delivery history returned per webhook.
+const webhookDeliveriesLimit = 100
+
+// ── Request/Response types ───────────────────────────────────────────
+
+type createWebhookRequest struct {
+	URL     string   `json:"url"`
+	Secret  string   `json:"secret"`
+	Events  []string `json:"events"`
+	Enabled *bool    `json:"enabled"`
+}
+
+type updateWebhookRequest struct {
+	URL     *string   `json:"url"`
+	Secret  *string   `json:"secret"`
+	Events  *[]string `json:"events"`
+	Enabled *bool     `json:"enabled"`
+}
+
+type webhookResponse struct {
+	ID        int64    `json:"id"`
+	URL       string   `json:"url"`
+	Secret    string   `json:"secret,omitempty"` // only returned on creation
+	Events    []string `json:"events"`
+	Enabled   bool     `json:"enabled"`
+	CreatedAt int64    `json:"created_at"`
+	UpdatedAt int64    `json:"updated_at"`
+}
+
+type webhookDeliveryResponse struct {
+	ID            int64  `json:"id"`
+	EventID       string `json:"event_id"`
+	EventType     string `json:"event_type"`
+	Status        string `json:"status"`
+	Attempts      int    `json:"attempts"`
+	NextAttemptAt *int64 `json:"next_attempt_at"`
+	LastStatus    int    `json:"last_status,omitempty"`
+	LastError     string `json:"last_error,omitempty"`
+	CreatedAt     int64  `json:"created_at"`
+	DeliveredAt   *int64 `json:"delivered_at"`
+}
+
+// ── Validation ───────────────────────────────────────────────────────
+
+// validateWebhookURL requires an absolute http or https URL.
+func validateWebhookURL(raw string) error {
+	if raw == "" {
+		return fmt.Errorf("url is required")
+	}
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return fmt.Errorf("url must be an absolute http or https URL")
+	}
+	return nil
+}
+
+// validateWebhookEvents checks each filter is "*", "<resource>.*" or a known
+// change type such as "peer.updated".
+func validateWebhookEvents(filters []string) error {
+	for _, f := range filters {
+		if f == "*" {
+			continue
+		}
+		resource, change, ok := strings.Cut(f, ".")
+		changes, known := webhookResources[resource]
+		if !ok || !known {
+			return fmt.Errorf("unknown event %q", f)
+		}
+		if change == "*" {
+			continue
+		}
+		valid := false
+		for _, c := range changes {
+			if c == change {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			return fmt.Errorf("unknown event %q", f)
+		}
+	}
+	return nil
+}
+
+// ── Handlers ─────────────────────────────────────────────────────────
+
+// handleListWebhooks returns all webhook subscriptions. Secrets are omitted.
+func (s *Server) handleListWebhooks(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	webhooks, err := s.db.ListWebhooks(ctx)
+	if err != nil {
+		s.logger.Error("list_webhooks_failed", "error", err, "component", "handler")
+		writeError(w, r, fmt.Errorf("failed to list webhooks"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
+		return
+	}
+
+	result := make([]webhookResponse, 0, len(webhooks))
+	for _, wh := range webhooks {
+		result = append(result, webhookToResponse(&wh))
+	}
+
+	writeJSON(w, http.StatusOK, result)
+}
+
+// handleCreateWebhook creates a webhook subscription. If no secret is given
+// one is generated; either way it is only returned in this response.
+func (s *Server) handleCreateWebhook(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var req createWebhookRequest
+	if code, status, err := decodeJSON(r, &req); err != nil {
+		writeError(w, r, err, code, status, s.devMode)
+		return
+	}
+
+	var fields []fieldError
+	if err := validateWebhookURL(req.URL); err != nil {
+		fields = append(fields, fieldError{Field: "url", Message: err.Error()})
+	}
+	if err := validateWebhookEvents(req.Events); err != nil {
+		fields = append(fields, fieldError{Field: "events", Message: err.Error()})
+	}
+	if len(fields) > 0 {
+		writeValidationError(w, r, fields)
+		return
+	}
+
+	secret := req.Secret
+	if secret == "" {
+		var err error
+		secret, err = generateWebhookSecret()
+		if err != nil {
+			s.logger.Error("generate_webhook_secret_failed", "error", err, "component", "handler")
+			writeError(w, r, fmt.Errorf("failed to generate secret"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
+			return
+		}
+	}
+
+	enabled := true
+	if req.Enabled != nil {
+		enabled = *req.Enabled
+	}
+
+	id, err := s.db.CreateWebhook(ctx, &db.Webhook{
+		URL:     req.URL,
+		Secret:  secret,
+		Events:  strings.Join(req.Events, ","),
+		Enabled: enabled,
+	})
+	if err != nil {
+		s.logger.Error("create_webhook_failed", "error", err, "component", "handler")
+		writeError(w, r, fmt.Errorf("failed to create webhook"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
+		return
+	}
+
+	created, err := s.db.GetWebhookByID(ctx, id)
+	if err != nil || created == nil {
+		s.logger.Error("get_created_webhook_failed", "error", err, "component", "handler", "webhook_id", id)
+		writeError(w, r, fmt.Errorf("failed to retrieve created webhook"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
+		return
+	}
+
+	s.logger.Info("webhook_created", "webhook_id", id, "url", req.URL, "component", "handler")
+	s.auditf(r, "webhook.created", "webhook", "created webhook (id=%d, url=%s)", id, req.URL)
+
+	resp := webhookToResponse(created)
+	resp.Secret = secret
+	writeJSON(w, http.StatusCreated, resp)
+}
+
+// handleUpdateWebhook updates a webhook's fields. Setting a secret rotates
+// it; the new value is not echoed back.
+func (s *Server) handleUpdateWebhook(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	wh, ok := s.webhookFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	var req updateWebhookRequest
+	if code, status, err := decodeJSON(r, &req); err != nil {
+		writeError(w, r, err, code, status, s.devMode)
+		return
+	}
+
+	var fields []fieldError
+	if req.URL != nil {
+		if err := validateWebhookURL(*req.URL); err != nil {
+			fields = append(fields, fieldError{Field: "url", Message: err.Error()})
+		}
+		wh.URL = *req.URL
+	}
+	if req.Events != nil {
+		if err := validateWebhookEvents(*req.Events); err != nil {
+			fields = append(fields, fieldError{Field: "events", Message: err.Error()})
+		}
+		wh.Events = strings.Join(*req.Events, ",")
+	}
+	if req.Secret != nil {
+		if *req.Secret == "" {
+			fields = append(fields, fieldError{Field: "secret", Message: "secret must not be empty"})
+		}
+		wh.Secret = *req.Secret
+	}
+	if len(fields) > 0 {
+		writeValidationError(w, r, fields)
+		return
+	}
+	if req.Enabled != nil {
+		wh.Enabled = *req.Enabled
+	}
+
+	if err := s.db.UpdateWebhook(ctx, wh); err != nil {
+		s.logger.Error("update_webhook_failed", "error", err, "component", "handler", "webhook_id", wh.ID)
+		writeError(w, r, fmt.Errorf("failed to update webhook"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
+		return
+	}
+
+	updated, _ := s.db.GetWebhookByID(ctx, wh.ID)
+	if updated == nil {
+		updated = wh
+	}
+
+	s.logger.Info("webhook_updated", "webhook_id", wh.ID, "component", "handler")
+	s.auditf(r, "webhook.updated", "webhook", "updated webhook (id=%d)", wh.ID)
+
+	writeJSON(w, http.StatusOK, webhookToResponse(updated))
+}
+
+// handleDeleteWebhook deletes a webhook and its delivery history.
+func (s *Server) handleDeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	wh, ok := s.webhookFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	if err := s.db.DeleteWebhook(ctx, wh.ID); err != nil {
+		s.logger.Error("delete_webhook_failed", "error", err, "component", "handler", "webhook_id", wh.ID)
+		writeError(w, r, fmt.Errorf("failed to delete webhook"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
+		return
+	}
+
+	s.logger.Info("webhook_deleted", "webhook_id", wh.ID, "component", "handler")
+	s.auditf(r, "webhook.deleted", "webhook", "deleted webhook (id=%d, url=%s)", wh.ID, wh.URL)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleListWebhookDeliveries returns the most recent deliveries for a
+// webhook, newest first.
+func (s *Server) handleListWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	wh, ok := s.webhookFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	deliveries, err := s.db.ListWebhookDeliveries(ctx, wh.ID, webhookDeliveriesLimit)
+	if err != nil {
+		s.logger.Error("list_webhook_deliveries_failed", "error", err, "component", "handler", "webhook_id", wh.ID)
+		writeError(w, r, fmt.Errorf("failed to list deliveries"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
+		return
+	}
+
+	result := make([]webhookDeliveryResponse, 0, len(deliveries))
+	for _, d := range deliveries {
+		result = append(result, webhookDeliveryToResponse(&d))
+	}
+
+	writeJSON(w, http.StatusOK, result)
+}
+
+// handleRedeliverWebhookDelivery queues a delivery to be sent again with
+// a fresh set of attempts. The payload and event ID are unchanged.
+func (s *Server) handleRedeliverWebhookDelivery(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	wh, ok := s.webhookFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	deliveryID, err := strconv.ParseInt(r.PathValue("deliveryID"), 10, 64)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("invalid delivery ID"), apperr.ErrValidation, http.StatusBadRequest, s.devMode)
+		return
+	}
+
+	del, err := s.db.GetWebhookDelivery(ctx, deliveryID)
+	if err != nil {
+		s.logger.Error("get_webhook_delivery_failed", "error", err, "component", "handler", "delivery_id", deliveryID)
+		writeError(w, r, fmt.Errorf("failed to get delivery"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
+		return
+	}
+	if del == nil || del.WebhookID != wh.ID {
+		writeError(w, r, fmt.Errorf("delivery %d not found", deliveryID), apperr.ErrWebhookNotFound, http.StatusNotFound, s.devMode)
+		return
+	}
+
+	if err := s.db.RedeliverWebhookDelivery(ctx, deliveryID, time.Now()); err != nil {
+		s.logger.Error("redeliver_webhook_failed", "error", err, "component", "handler", "delivery_id", deliveryID)
+		writeError(w, r, fmt.Errorf("failed to queue redelivery"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
+		return
+	}
+
+	updated, _ := s.db.GetWebhookDelivery(ctx, deliveryID)
+	if updated == nil {
+		updated = del
+	}
+
+	s.logger.Info("webhook_redelivery_queued", "webhook_id", wh.ID, "delivery_id", deliveryID, "component", "handler")
+	s.auditf(r, "webhook.redelivered", "webhook", "queued redelivery of %s (delivery id=%d) to webhook %d", del.EventID, deliveryID, wh.ID)
+
+	writeJSON(w, http.StatusAccepted, webhookDeliveryToResponse(updated))
+}
+
+// ── Helpers ──────────────────────────────────────────────────────────
+
+// webhookFromPath loads the webhook named by the {id} path value, writing
+// the error response and returning false if it cannot.
+func (s *Server) webhookFromPath(w http.ResponseWriter, r *http.Request) (*db.Webhook, bool) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("invalid webhook ID"), apperr.ErrValidation, http.StatusBadRequest, s.devMode)
+		return nil, false
+	}
+
+	wh, err := s.db.GetWebhookByID(r.Context(), id)
+	if err != nil {
+		s.logger.Error("get_webhook_failed", "error", err, "component", "handler", "webhook_id", id)
+		writeError(w, r, fmt.Errorf("failed to get webhook"), apperr.ErrInternal, http.StatusInternalServerError, s.devMode)
+		return nil, false
+	}
+	if wh == nil {
+		writeError(w, r, fmt.Errorf("webhook %d not found", id), apperr.ErrWebhookNotFound, http.StatusNotFound, s.devMode)
+		return nil, false
+	}
+	return wh, true
+}
+
+// generateWebhookSecret returns a random 32-byte hex signing secret.
+func generateWebhookSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generate webhook secret: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func webhookToResponse(wh *db.Webhook) webhookResponse {
+	events := []string{}
+	for _, e := range strings.Split(wh.Events, ",") {
+		if e = strings.TrimSpace(e); e != "" {
+			events = append(events, e)
+		}
+	}
+	return webhookResponse{
+		ID:        wh.ID,
+		URL:       wh.URL,
+		Events:    events,
+		Enabled:   wh.Enabled,
+		CreatedAt: wh.CreatedAt.Unix(),
+		UpdatedAt: wh.UpdatedAt.Unix(),
+	}
+}
+
+func webhookDeliveryToResponse(d *db.WebhookDelivery) webhookDeliveryResponse {
+	resp := webhookDeliveryResponse{
+		ID:         d.ID,
+		EventID:    d.EventID,
+		EventType:  d.EventType,
+		Status:     d.Status,
+		Attempts:   d.Attempts,
+		LastStatus: d.LastStatus,
+		LastError:  d.LastError,
+		CreatedAt:  d.CreatedAt.Unix(),
+	}
+	if d.Status == db.WebhookDeliveryPending {
+		ts := d.NextAttemptAt.Unix()
+		resp.NextAttemptAt = &ts
+	}
+	if !d.DeliveredAt.IsZero() {
+		ts := d.DeliveredAt.Unix()
+		resp.DeliveredAt = &ts
+	}
+	return resp
+}
@@ -0,0 +1,273 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/itsChris/wgpilot/internal/db"
+)
+
+// createTestWebhook creates a webhook through the API and returns the response.
+func createTestWebhook(t *testing.T, srv *Server, body string) webhookResponse {
+	t.Helper()
+	req := httptest.NewRequest("POST", "/api/webhooks", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req = authRequest(t, srv, req)
+	w := httptest.NewRecorder()
+
+	srv.ServeHTTP(w, req)
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp webhookResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	return resp
+}
+
+func TestWebhooks_CreateListUpdateDelete(t *testing.T) {
+	srv, _, _ := newTestServerWithWG(t)
+
+	created := createTestWebhook(t, srv, `{"url":"https://cmdb.example.com/hook","events":["peer.*","network.deleted"]}`)
+	if len(created.Secret) != 64 {
+		t.Errorf("expected generated secret in create response, got %q", created.Secret)
+	}
+	if !created.Enabled || len(created.Events) != 2 {
+		t.Errorf("unexpected webhook: %+v", created)
+	}
+
+	req := authRequest(t, srv, httptest.NewRequest("GET", "/api/webhooks", nil))
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+	var list []webhookResponse
+	json.NewDecoder(w.Body).Decode(&list)
+	if len(list) != 1 || list[0].Secret != "" {
+		t.Fatalf("expected one webhook without secret, got %+v", list)
+	}
+
+	body := `{"enabled":false,"events":[]}`
+	req = httptest.NewRequest("PUT", fmt.Sprintf("/api/webhooks/%d", created.ID), strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req = authRequest(t, srv, req)
+	w = httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("update: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var updated webhookResponse
+	json.NewDecoder(w.Body).Decode(&updated)
+	if updated.Enabled || len(updated.Events) != 0 || updated.Secret != "" {
+		t.Errorf("unexpected updated webhook: %+v", updated)
+	}
+
+	req = authRequest(t, srv, httptest.NewRequest("DELETE", fmt.Sprintf("/api/webhooks/%d", created.ID), nil))
+	w = httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("delete: expected 204, got %d", w.Code)
+	}
+
+	req = authRequest(t, srv, httptest.NewRequest("DELETE", fmt.Sprintf("/api/webhooks/%d", created.ID), nil))
+	w = httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for deleted webhook, got %d", w.Code)
+	}
+}
+
+func TestCreateWebhook_Validation(t *testing.T) {
+	srv, _, _ := newTestServerWithWG(t)
+
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"missing url", `{}`},
+		{"relative url", `{"url":"/hook"}`},
+		{"bad scheme", `{"url":"ftp://example.com/hook"}`},
+		{"unknown resource", `{"url":"https://example.com","events":["alert.created"]}`},
+		{"unknown change", `{"url":"https://example.com","events":["user.enabled"]}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/api/webhooks", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			req = authRequest(t, srv, req)
+			w := httptest.NewRecorder()
+
+			srv.ServeHTTP(w, req)
+
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("expected 400, got %d: %s", w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestUpdatePeer_EnqueuesWebhookWithBeforeAndAfter(t *testing.T) {
+	srv, _, _ := newTestServerWithWG(t)
+	ctx := context.Background()
+	netID := createTestNetwork(t, srv)
+
+	peerID, err := srv.db.CreatePeer(ctx, &db.Peer{
+		NetworkID: netID, Name: "Laptop", PublicKey: "peer-pub-key",
+		AllowedIPs: "10.0.0.2/32", Role: "client", Enabled: true,
+	})
+	if err != nil {
+		t.Fatalf("create peer: %v", err)
+	}
+	hook := createTestWebhook(t, srv, `{"url":"https://cmdb.example.com/hook","events":["peer.updated"]}`)
+
+	body := `{"name":"Work Laptop"}`
+	req := httptest.NewRequest("PUT", fmt.Sprintf("/api/networks/%d/peers/%d", netID, peerID), strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req = authRequest(t, srv, req)
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("update peer: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	deliveries, err := srv.db.ListWebhookDeliveries(ctx, hook.ID, 10)
+	if err != nil {
+		t.Fatalf("list deliveries: %v", err)
+	}
+	if len(deliveries) != 1 || deliveries[0].EventType != "peer.updated" {
+		t.Fatalf("expected one peer.updated delivery, got %+v", deliveries)
+	}
+
+	var payload struct {
+		ID         string       `json:"id"`
+		Type       string       `json:"type"`
+		Resource   string       `json:"resource"`
+		ResourceID int64        `json:"resource_id"`
+		UserID     int64        `json:"user_id"`
+		Before     peerResponse `json:"before"`
+		After      peerResponse `json:"after"`
+	}
+	if err := json.Unmarshal([]byte(deliveries[0].Payload), &payload); err != nil {
+		t.Fatalf("decode payload: %v", err)
+	}
+	if payload.ID != deliveries[0].EventID || payload.Resource != "peer" || payload.ResourceID != peerID || payload.UserID != 1 {
+		t.Errorf("unexpected payload envelope: %+v", payload)
+	}
+	if payload.Before.Name != "Laptop" || payload.After.Name != "Work Laptop" {
+		t.Errorf("expected before/after names, got %q -> %q", payload.Before.Name, payload.After.Name)
+	}
+}
+
+func TestDeletePeer_WebhookHasNullAfter(t *testing.T) {
+	srv, _, _ := newTestServerWithWG(t)
+	ctx := context.Background()
+	netID := createTestNetwork(t, srv)
+
+	peerID, _ := srv.db.CreatePeer(ctx, &db.Peer{
+		NetworkID: netID, Name: "Laptop", PublicKey: "peer-pub-key",
+		AllowedIPs: "10.0.0.2/32", Role: "client", Enabled: true,
+	})
+	hook := createTestWebhook(t, srv, `{"url":"https://cmdb.example.com/hook"}`)
+
+	req := authRequest(t, srv, httptest.NewRequest("DELETE", fmt.Sprintf("/api/networks/%d/peers/%d", netID, peerID), nil))
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("delete peer: expected 204, got %d: %s", w.Code, w.Body.String())
+	}
+
+	deliveries, _ := srv.db.ListWebhookDeliveries(ctx, hook.ID, 10)
+	if len(deliveries) != 1 || deliveries[0].EventType != "peer.deleted" {
+		t.Fatalf("expected one peer.deleted delivery, got %+v", deliveries)
+	}
+	var payload map[string]json.RawMessage
+	json.Unmarshal([]byte(deliveries[0].Payload), &payload)
+	if string(payload["after"]) != "null" || string(payload["before"]) == "null" {
+		t.Errorf("expected before state and null after, got %s", deliveries[0].Payload)
+	}
+}
+
+func TestRotateAPIKey_WebhookUpdatesOldKey(t *testing.T) {
+	srv := newTestServerFor2FA(t)
+	admin := loginSession(t, srv, "admin", "correctpassword")
+	ctx := context.Background()
+
+	hook := createTestWebhook(t, srv, `{"url":"https://cmdb.example.com/hook","events":["api_key.updated","user.updated"]}`)
+
+	w := sendJSON(t, srv, "POST", "/api/api-keys", `{"name":"deploy"}`, admin)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create key: expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var key createAPIKeyResponse
+	json.NewDecoder(w.Body).Decode(&key)
+	w = sendJSON(t, srv, "POST", fmt.Sprintf("/api/api-keys/%d/rotate", key.ID), `{"overlap":"1h"}`, admin)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("rotate: expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+
+	deliveries, _ := srv.db.ListWebhookDeliveries(ctx, hook.ID, 10)
+	if len(deliveries) != 1 || deliveries[0].EventType != "api_key.updated" {
+		t.Fatalf("expected one api_key.updated delivery, got %+v", deliveries)
+	}
+	var payload struct {
+		ResourceID int64          `json:"resource_id"`
+		Before     apiKeyResponse `json:"before"`
+		After      apiKeyResponse `json:"after"`
+	}
+	if err := json.Unmarshal([]byte(deliveries[0].Payload), &payload); err != nil {
+		t.Fatalf("decode payload: %v", err)
+	}
+	if payload.ResourceID != key.ID || payload.Before.ExpiresAt != nil || payload.After.ExpiresAt == nil {
+		t.Errorf("expected the old key's expiry set by the rotation, got %s", deliveries[0].Payload)
+	}
+}
+
+func TestRedeliverWebhookDelivery(t *testing.T) {
+	srv, _, _ := newTestServerWithWG(t)
+	ctx := context.Background()
+
+	hook := createTestWebhook(t, srv, `{"url":"https://cmdb.example.com/hook"}`)
+	other := createTestWebhook(t, srv, `{"url":"https://other.example.com/hook","events":["bridge.*"]}`)
+	srv.db.EnqueueWebhookEvent(ctx, "evt_1", "user.created", `{}`)
+	deliveries, _ := srv.db.ListWebhookDeliveries(ctx, hook.ID, 10)
+	if len(deliveries) != 1 {
+		t.Fatalf("expected 1 delivery, got %d", len(deliveries))
+	}
+	delID := deliveries[0].ID
+	srv.db.MarkWebhookAttemptFailed(ctx, delID, 500, "unexpected status 500", time.Time{})
+
+	// The delivery must belong to the webhook in the path.
+	req := authRequest(t, srv, httptest.NewRequest("POST", fmt.Sprintf("/api/webhooks/%d/deliveries/%d/redeliver", other.ID, delID), nil))
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for foreign delivery, got %d", w.Code)
+	}
+
+	req = authRequest(t, srv, httptest.NewRequest("POST", fmt.Sprintf("/api/webhooks/%d/deliveries/%d/redeliver", hook.ID, delID), nil))
+	w = httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp webhookDeliveryResponse
+	json.NewDecoder(w.Body).Decode(&resp)
+	if resp.Status != db.WebhookDeliveryPending || resp.Attempts != 0 || resp.NextAttemptAt == nil {
+		t.Errorf("expected delivery to be pending again, got %+v", resp)
+	}
+
+	req = authRequest(t, srv, httptest.NewRequest("GET", fmt.Sprintf("/api/webhooks/%d/deliveries", hook.ID), nil))
+	w = httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+	var list []webhookDeliveryResponse
+	json.NewDecoder(w.Body).Decode(&list)
+	if len(list) != 1 || list[0].EventID != "evt_1" {
+		t.Errorf("unexpected delivery history: %+v", list)
+	}
+}
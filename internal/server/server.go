@@ -1,15 +1,20 @@
 package server
 
 import (
+	"context"
 	"log/slog"
 	"net/http"
 	"time"
 
 	"github.com/itsChris/wgpilot/internal/auth"
 	"github.com/itsChris/wgpilot/internal/db"
+	"github.com/itsChris/wgpilot/internal/events"
+	"github.com/itsChris/wgpilot/internal/geoip"
 	"github.com/itsChris/wgpilot/internal/logging"
+	"github.com/itsChris/wgpilot/internal/metrics"
 	"github.com/itsChris/wgpilot/internal/middleware"
 	"github.com/itsChris/wgpilot/internal/nft"
+	"github.com/itsChris/wgpilot/internal/notify"
 	servermw "github.com/itsChris/wgpilot/internal/server/middleware"
 	"github.com/itsChris/wgpilot/internal/wg"
 )
@@ -17,12 +22,27 @@ import (
 // Server is the HTTP server that wires together all subsystems.
 type Server struct {
 	db          *db.DB
+	ts          *db.TimeSeries
 	logger      *slog.Logger
 	jwtService  *auth.JWTService
 	sessions    *auth.SessionManager
 	rateLimiter *auth.LoginRateLimiter
+	webauthn    auth.RelyingParty
+	oidc        OIDCConfig
+	ldap        LDAPConfig
+	passwords   auth.PasswordPolicy
+	lockout     LockoutConfig
+	ceremonies  *auth.WebAuthnSessions
+	challenges  *auth.ChallengeFailures
 	wgManager   *wg.Manager
 	nftManager  nft.NFTableManager
+	geo         *geoip.DB
+	mailer      Mailer
+	events      *events.Bus
+	metrics     *metrics.Registry
+	metricsAuth string
+	externalURL string
+	retention   time.Duration // how long raw snapshots are kept
 	devMode     bool
 	handler     http.Handler
 	mux         *http.ServeMux
@@ -34,47 +54,123 @@ type Server struct {
 
 // Config holds the dependencies for creating a new Server.
 type Config struct {
-	DB          *db.DB
-	Logger      *slog.Logger
-	JWTService  *auth.JWTService
-	Sessions    *auth.SessionManager
-	RateLimiter *auth.LoginRateLimiter
-	WGManager   *wg.Manager
-	NFTManager  nft.NFTableManager
-	DevMode     bool
-	Ring        *logging.RingBuffer
-	Version     string
+	DB           *db.DB
+	TimeSeries   *db.TimeSeries
+	Logger       *slog.Logger
+	JWTService   *auth.JWTService
+	Sessions     *auth.SessionManager
+	RateLimiter  *auth.LoginRateLimiter
+	WebAuthn     auth.RelyingParty   // optional; ID and origins default to the request host
+	OIDC         OIDCConfig          // optional; single sign-on
+	LDAP         LDAPConfig          // optional; directory password login
+	Passwords    auth.PasswordPolicy // optional; rules for local passwords
+	Lockout      LockoutConfig       // optional; per-account lockout after failed logins
+	WGManager    *wg.Manager
+	NFTManager   nft.NFTableManager
+	GeoIP        *geoip.DB         // optional; enables location enrichment
+	Mailer       Mailer            // optional; enables emailing peer configs
+	Events       *events.Bus       // optional; a private bus is created if nil
+	Metrics      *metrics.Registry // optional; a private registry is created if nil
+	MetricsToken string            // optional bearer token required on /metrics
+	ExternalURL  string            // optional; base URL for links in emails
+	RawRetention time.Duration     // optional; how long raw snapshots are kept
+	DevMode      bool
+	Ring         *logging.RingBuffer
+	Version      string
+}
+
+// Mailer sends email with attachments, such as peer configs.
+type Mailer interface {
+	SendWithAttachments(ctx context.Context, to []string, subject, body string, attachments []notify.Attachment) error
+}
+
+// OIDCConfig configures single sign-on with an OpenID Connect provider.
+// SSO is disabled when Provider is nil.
+type OIDCConfig struct {
+	Provider             *auth.OIDCProvider
+	RedirectURL          string            // optional; derived from the request host
+	UsernameClaim        string            // default "preferred_username"
+	GroupsClaim          string            // default "groups"
+	RoleMapping          map[string]string // group → role
+	DefaultRole          string            // role when no group matches; empty denies login
+	DisablePasswordLogin bool
+}
+
+// LDAPConfig configures password login against an LDAP or Active Directory
+// server. It is disabled when Authenticator is nil.
+type LDAPConfig struct {
+	Authenticator  *auth.LDAPAuthenticator
+	RoleMapping    map[string]string // group DN → role; empty leaves roles to wgpilot
+	DefaultRole    string            // role when no group matches; empty denies login
+	ProvisionUsers bool              // create accounts for directory users on first login
+}
+
+// LockoutConfig locks local accounts after repeated failed password
+// logins. Lockout is disabled when Threshold is 0.
+type LockoutConfig struct {
+	Threshold int           // consecutive failures that lock the account
+	Duration  time.Duration // how long the account stays locked
 }
 
 // New creates a Server, registers all routes, and builds the middleware chain.
 //
 // Middleware order (outermost → innermost):
 //
-//	recovery → security_headers → request_id → request_logger → max_body → auth → handler
+//	recovery → security_headers → request_id → tracing → request_logger → max_body → auth → handler
 //
 // Auth is applied per-route rather than globally so public endpoints
 // (health, login, setup) bypass it.
 func New(cfg Config) (*Server, error) {
+	if cfg.Events == nil {
+		cfg.Events = events.NewBus(0)
+	}
+	if cfg.Metrics == nil {
+		cfg.Metrics = metrics.NewRegistry()
+	}
+	if cfg.RawRetention <= 0 {
+		cfg.RawRetention = db.RawSnapshotRetention
+	}
 	s := &Server{
 		db:          cfg.DB,
+		ts:          cfg.TimeSeries,
 		logger:      cfg.Logger,
 		jwtService:  cfg.JWTService,
 		sessions:    cfg.Sessions,
 		rateLimiter: cfg.RateLimiter,
+		webauthn:    cfg.WebAuthn,
+		oidc:        cfg.OIDC,
+		ldap:        cfg.LDAP,
+		passwords:   cfg.Passwords,
+		lockout:     cfg.Lockout,
+		ceremonies:  auth.NewWebAuthnSessions(),
+		challenges:  auth.NewChallengeFailures(),
 		wgManager:   cfg.WGManager,
 		nftManager:  cfg.NFTManager,
+		geo:         cfg.GeoIP,
+		mailer:      cfg.Mailer,
+		events:      cfg.Events,
+		metrics:     cfg.Metrics,
+		metricsAuth: cfg.MetricsToken,
+		externalURL: cfg.ExternalURL,
+		retention:   cfg.RawRetention,
 		devMode:     cfg.DevMode,
 		mux:         http.NewServeMux(),
 		ring:        cfg.Ring,
 		startTime:   time.Now(),
 		version:     cfg.Version,
 	}
+	// Session tokens are only accepted while recorded in the database, so
+	// that they can be revoked.
+	if cfg.Sessions != nil {
+		cfg.Sessions.UseStore(&sessionStoreAdapter{db: cfg.DB})
+	}
 	s.registerRoutes()
 
 	// Build middleware chain (applied inside-out, listed outside-in).
 	var handler http.Handler = s.mux
 	handler = middleware.MaxBody(middleware.DefaultMaxBodySize)(handler)
-	handler = middleware.RequestLogger(cfg.Logger, cfg.DevMode)(handler)
+	handler = middleware.RequestLogger(cfg.Logger, cfg.DevMode, s.httpMetrics())(handler)
+	handler = middleware.Tracing(handler)
 	handler = middleware.RequestID(handler)
 	handler = servermw.SecurityHeaders(cfg.DevMode)(handler)
 	handler = middleware.Recovery(cfg.Logger)(handler)
@@ -20,6 +20,23 @@ func newDiscardLogger() *slog.Logger {
 	return slog.New(slog.NewTextHandler(io.Discard, nil))
 }
 
+// adminSession issues a session for user 1, creating it as an admin if it
+// does not exist yet, since permissions are resolved from the stored user.
+func adminSession(t *testing.T, srv *Server) (string, error) {
+	t.Helper()
+	ctx := context.Background()
+	user, err := srv.db.GetUserByID(ctx, 1)
+	if err != nil {
+		return "", err
+	}
+	if user == nil {
+		if _, err := srv.db.CreateUser(ctx, &db.User{Username: "admin", Role: "admin"}); err != nil {
+			return "", err
+		}
+	}
+	return srv.issueSession(httptest.NewRequest("GET", "/", nil), 1, "admin", "admin")
+}
+
 func newTestJWTSecret() []byte {
 	return []byte("test-secret-key-that-is-32-bytes!")
 }
@@ -57,6 +74,7 @@ func newTestServer(t *testing.T) *Server {
 
 	srv, err := New(Config{
 		DB:          database,
+		TimeSeries:  newTestTimeSeries(t),
 		Logger:      logger,
 		JWTService:  jwtSvc,
 		Sessions:    sessions,
@@ -78,6 +96,17 @@ func newTestServer(t *testing.T) *Server {
 	return srv
 }
 
+// newTestTimeSeries opens an in-memory time-series database for a test server.
+func newTestTimeSeries(t *testing.T) *db.TimeSeries {
+	t.Helper()
+	ts, err := db.NewTimeSeries(context.Background(), ":memory:", newDiscardLogger(), true)
+	if err != nil {
+		t.Fatalf("db.NewTimeSeries: %v", err)
+	}
+	t.Cleanup(func() { ts.Close() })
+	return ts
+}
+
 func TestRequestID_GeneratedInResponse(t *testing.T) {
 	srv := newTestServer(t)
 
@@ -143,6 +172,7 @@ func TestPanicInHandler_Returns500WithRequestID(t *testing.T) {
 
 	srv, err := New(Config{
 		DB:          database,
+		TimeSeries:  newTestTimeSeries(t),
 		Logger:      logger,
 		JWTService:  jwtSvc,
 		Sessions:    sessions,
@@ -263,7 +293,7 @@ func TestNotImplementedEndpoint_Returns501(t *testing.T) {
 	srv := newTestServer(t)
 
 	// Create a valid token to access a protected endpoint.
-	token, err := srv.jwtService.Generate(1, "admin", "admin")
+	token, err := adminSession(t, srv)
 	if err != nil {
 		t.Fatalf("generate token: %v", err)
 	}
@@ -0,0 +1,37 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/itsChris/wgpilot/internal/auth"
+	"github.com/itsChris/wgpilot/internal/db"
+)
+
+// Compile-time check that sessionStoreAdapter implements auth.SessionStore.
+var _ auth.SessionStore = (*sessionStoreAdapter)(nil)
+
+// sessionTouchInterval limits how often a session's last-seen time is
+// written, so that every request does not cost a database write.
+const sessionTouchInterval = time.Minute
+
+// sessionStoreAdapter adapts *db.DB to the auth.SessionStore interface.
+type sessionStoreAdapter struct {
+	db *db.DB
+}
+
+func (a *sessionStoreAdapter) ActiveSession(ctx context.Context, id string, userID int64, ip, userAgent string) (bool, error) {
+	sess, err := a.db.GetUserSession(ctx, id)
+	if err != nil {
+		return false, fmt.Errorf("get user session: %w", err)
+	}
+	if sess == nil || sess.UserID != userID {
+		return false, nil
+	}
+	if time.Since(sess.LastSeenAt) >= sessionTouchInterval || sess.IP != ip || sess.UserAgent != userAgent {
+		// Best effort: a failed write does not invalidate the session.
+		a.db.TouchUserSession(ctx, id, ip, userAgent)
+	}
+	return true, nil
+}
@@ -0,0 +1,86 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/itsChris/wgpilot/internal/auth"
+)
+
+// webhookResources lists the resources whose changes are delivered to
+// webhook subscribers, with the change types each one emits.
+var webhookResources = map[string][]string{
+	"network": {"created", "updated", "deleted", "enabled", "disabled", "imported"},
+	"peer":    {"created", "updated", "deleted", "enabled", "disabled"},
+	"bridge":  {"created", "updated", "deleted"},
+	"user":    {"created", "updated", "deleted"},
+	"api_key": {"created", "updated", "deleted"},
+}
+
+// webhookPayload is the JSON body POSTed to webhook subscribers. Before is
+// null for created resources and After is null for deleted ones.
+type webhookPayload struct {
+	ID         string `json:"id"`
+	Type       string `json:"type"`
+	Timestamp  int64  `json:"timestamp"`
+	Resource   string `json:"resource"`
+	ResourceID int64  `json:"resource_id"`
+	UserID     int64  `json:"user_id,omitempty"`
+	Before     any    `json:"before"`
+	After      any    `json:"after"`
+}
+
+// resourceChanged queues a change event for every webhook subscribed to
+// eventType. before and after are the API representations of the resource;
+// pass nil for the side that does not exist. Like auditf, errors are logged
+// but do not affect the request outcome.
+func (s *Server) resourceChanged(r *http.Request, eventType, resource string, resourceID int64, before, after any) {
+	payload := webhookPayload{
+		ID:         generateWebhookEventID(),
+		Type:       eventType,
+		Timestamp:  time.Now().Unix(),
+		Resource:   resource,
+		ResourceID: resourceID,
+		Before:     before,
+		After:      after,
+	}
+	if claims := auth.UserFromContext(r.Context()); claims != nil {
+		if id, err := strconv.ParseInt(claims.Subject, 10, 64); err == nil {
+			payload.UserID = id
+		}
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		s.logger.Error("webhook_payload_marshal_failed",
+			"error", err,
+			"event_type", eventType,
+			"component", "webhooks",
+		)
+		return
+	}
+
+	if _, err := s.db.EnqueueWebhookEvent(r.Context(), payload.ID, eventType, string(body)); err != nil {
+		s.logger.Error("webhook_enqueue_failed",
+			"error", err,
+			"event_type", eventType,
+			"resource_id", resourceID,
+			"component", "webhooks",
+		)
+	}
+}
+
+// generateWebhookEventID creates an event ID in the format "evt_<16 hex chars>".
+// Receivers use it to deduplicate redelivered events.
+func generateWebhookEventID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("evt_%d", time.Now().UnixNano())
+	}
+	return "evt_" + hex.EncodeToString(b)
+}
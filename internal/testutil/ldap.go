@@ -0,0 +1,467 @@
+package testutil
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"io"
+	"math/big"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LDAP result codes returned by the mock.
+const (
+	ldapSuccess            = 0
+	ldapProtocolError      = 2
+	ldapInvalidCredentials = 49
+	ldapInsufficientAccess = 50
+)
+
+// MockLDAPServer is an in-process LDAP directory for tests. It implements
+// simple bind, subtree search and StartTLS, which is what an authentication
+// backend needs. Like real servers it accepts a bind with a DN and an empty
+// password as an anonymous "unauthenticated bind", and it only answers
+// searches on bound connections.
+type MockLDAPServer struct {
+	// URL is ldap://127.0.0.1:port, or ldaps:// for a server started with
+	// TLS.
+	URL string
+
+	ln      net.Listener
+	tlsConf *tls.Config
+	pool    *x509.CertPool
+	wg      sync.WaitGroup
+
+	mu      sync.Mutex
+	entries []mockLDAPEntry
+	conns   map[net.Conn]struct{}
+	closed  bool
+}
+
+type mockLDAPEntry struct {
+	dn       string
+	password string
+	attrs    map[string][]string
+}
+
+// NewMockLDAPServer starts a mock directory on a loopback port. With ldaps
+// the listener speaks TLS from the start; either way StartTLS is offered,
+// using a self-signed certificate trusted by CertPool. Close it when done.
+func NewMockLDAPServer(ldaps bool) (*MockLDAPServer, error) {
+	cert, pool, err := selfSignedCert()
+	if err != nil {
+		return nil, err
+	}
+	m := &MockLDAPServer{
+		tlsConf: &tls.Config{Certificates: []tls.Certificate{cert}},
+		pool:    pool,
+		conns:   make(map[net.Conn]struct{}),
+	}
+	if ldaps {
+		m.ln, err = tls.Listen("tcp", "127.0.0.1:0", m.tlsConf)
+		m.URL = "ldaps://"
+	} else {
+		m.ln, err = net.Listen("tcp", "127.0.0.1:0")
+		m.URL = "ldap://"
+	}
+	if err != nil {
+		return nil, err
+	}
+	m.URL += m.ln.Addr().String()
+
+	m.wg.Add(1)
+	go m.serve()
+	return m, nil
+}
+
+// AddEntry adds a directory entry. An empty password means binding as the
+// entry is impossible, as for a group.
+func (m *MockLDAPServer) AddEntry(dn, password string, attrs map[string][]string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	lower := make(map[string][]string, len(attrs))
+	for k, v := range attrs {
+		lower[strings.ToLower(k)] = v
+	}
+	m.entries = append(m.entries, mockLDAPEntry{dn: dn, password: password, attrs: lower})
+}
+
+// CertPool returns a pool trusting the server's certificate.
+func (m *MockLDAPServer) CertPool() *x509.CertPool {
+	return m.pool
+}
+
+// Close stops the server and drops open connections.
+func (m *MockLDAPServer) Close() {
+	m.mu.Lock()
+	m.closed = true
+	for c := range m.conns {
+		c.Close()
+	}
+	m.mu.Unlock()
+	m.ln.Close()
+	m.wg.Wait()
+}
+
+func (m *MockLDAPServer) serve() {
+	defer m.wg.Done()
+	for {
+		conn, err := m.ln.Accept()
+		if err != nil {
+			return
+		}
+		m.mu.Lock()
+		if m.closed {
+			m.mu.Unlock()
+			conn.Close()
+			return
+		}
+		m.conns[conn] = struct{}{}
+		m.mu.Unlock()
+
+		m.wg.Add(1)
+		go func() {
+			defer m.wg.Done()
+			m.handle(conn)
+		}()
+	}
+}
+
+func (m *MockLDAPServer) handle(conn net.Conn) {
+	defer func() {
+		m.mu.Lock()
+		delete(m.conns, conn)
+		m.mu.Unlock()
+		conn.Close()
+	}()
+	r := bufio.NewReader(conn)
+	bound := ""
+
+	for {
+		raw, err := berRead(r)
+		if err != nil {
+			return
+		}
+		msg, _, err := berParse(raw)
+		if err != nil || len(msg.children) < 2 {
+			return
+		}
+		id := msg.children[0].value
+		op := msg.children[1]
+
+		switch op.tag {
+		case 0x60: // BindRequest
+			if len(op.children) < 3 {
+				return
+			}
+			dn, password := string(op.children[1].value), string(op.children[2].value)
+			code := ldapSuccess
+			switch {
+			case password == "":
+				bound = "" // anonymous or unauthenticated bind
+			case m.checkPassword(dn, password):
+				bound = dn
+			default:
+				bound, code = "", ldapInvalidCredentials
+			}
+			conn.Write(ldapMessage(id, 0x61, ldapResult(code)))
+
+		case 0x63: // SearchRequest
+			if bound == "" {
+				conn.Write(ldapMessage(id, 0x65, ldapResult(ldapInsufficientAccess)))
+				continue
+			}
+			for _, e := range m.search(op) {
+				conn.Write(ldapMessage(id, 0x64, e))
+			}
+			conn.Write(ldapMessage(id, 0x65, ldapResult(ldapSuccess)))
+
+		case 0x77: // ExtendedRequest
+			if len(op.children) == 0 || string(op.children[0].value) != "1.3.6.1.4.1.1466.20037" {
+				conn.Write(ldapMessage(id, 0x78, ldapResult(ldapProtocolError)))
+				continue
+			}
+			if _, ok := conn.(*tls.Conn); ok {
+				conn.Write(ldapMessage(id, 0x78, ldapResult(ldapProtocolError)))
+				continue
+			}
+			conn.Write(ldapMessage(id, 0x78, ldapResult(ldapSuccess)))
+			tlsConn := tls.Server(conn, m.tlsConf)
+			m.mu.Lock()
+			delete(m.conns, conn)
+			m.conns[tlsConn] = struct{}{}
+			m.mu.Unlock()
+			conn, r = tlsConn, bufio.NewReader(tlsConn)
+
+		default: // UnbindRequest or unsupported
+			return
+		}
+	}
+}
+
+func (m *MockLDAPServer) checkPassword(dn, password string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, e := range m.entries {
+		if strings.EqualFold(e.dn, dn) {
+			return e.password != "" && e.password == password
+		}
+	}
+	return false
+}
+
+// search returns the encoded SearchResultEntry operations for a request.
+func (m *MockLDAPServer) search(op *berNode) [][]byte {
+	if len(op.children) < 8 {
+		return nil
+	}
+	base := strings.ToLower(string(op.children[0].value))
+	filter := op.children[6]
+	var want []string
+	for _, a := range op.children[7].children {
+		want = append(want, strings.ToLower(string(a.value)))
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var out [][]byte
+	for _, e := range m.entries {
+		dn := strings.ToLower(e.dn)
+		if dn != base && !strings.HasSuffix(dn, ","+base) {
+			continue
+		}
+		if !matchFilter(filter, e) {
+			continue
+		}
+		var attrs [][]byte
+		for name, vals := range e.attrs {
+			if len(want) > 0 && !slices.Contains(want, name) {
+				continue
+			}
+			var encoded [][]byte
+			for _, v := range vals {
+				encoded = append(encoded, berTLV(0x04, []byte(v)))
+			}
+			attrs = append(attrs, berTLV(0x30, berTLV(0x04, []byte(name)), berTLV(0x31, encoded...)))
+		}
+		out = append(out, join(berTLV(0x04, []byte(e.dn)), berTLV(0x30, attrs...)))
+	}
+	return out
+}
+
+// matchFilter evaluates a BER-encoded filter against an entry. Extensible
+// matches are treated as equality on their attribute, which is how Active
+// Directory's transitive membership rule behaves for direct members.
+func matchFilter(f *berNode, e mockLDAPEntry) bool {
+	switch f.tag {
+	case 0xa0: // and
+		for _, c := range f.children {
+			if !matchFilter(c, e) {
+				return false
+			}
+		}
+		return true
+	case 0xa1: // or
+		for _, c := range f.children {
+			if matchFilter(c, e) {
+				return true
+			}
+		}
+		return false
+	case 0xa2: // not
+		return len(f.children) == 1 && !matchFilter(f.children[0], e)
+	case 0x87: // present
+		return len(e.attrs[strings.ToLower(string(f.value))]) > 0
+	case 0xa3, 0xa8: // equality, approx
+		if len(f.children) < 2 {
+			return false
+		}
+		return hasValue(e, string(f.children[0].value), func(v string) bool {
+			return strings.EqualFold(v, string(f.children[1].value))
+		})
+	case 0xa4: // substrings
+		if len(f.children) < 2 {
+			return false
+		}
+		return hasValue(e, string(f.children[0].value), func(v string) bool {
+			v = strings.ToLower(v)
+			for _, s := range f.children[1].children {
+				part := strings.ToLower(string(s.value))
+				switch s.tag {
+				case 0x80:
+					if !strings.HasPrefix(v, part) {
+						return false
+					}
+					v = v[len(part):]
+				case 0x81:
+					i := strings.Index(v, part)
+					if i < 0 {
+						return false
+					}
+					v = v[i+len(part):]
+				case 0x82:
+					if !strings.HasSuffix(v, part) {
+						return false
+					}
+				}
+			}
+			return true
+		})
+	case 0xa9: // extensible
+		var attr, value string
+		for _, c := range f.children {
+			switch c.tag {
+			case 0x82:
+				attr = string(c.value)
+			case 0x83:
+				value = string(c.value)
+			}
+		}
+		return hasValue(e, attr, func(v string) bool { return strings.EqualFold(v, value) })
+	}
+	return false
+}
+
+func hasValue(e mockLDAPEntry, attr string, match func(string) bool) bool {
+	for _, v := range e.attrs[strings.ToLower(attr)] {
+		if match(v) {
+			return true
+		}
+	}
+	return false
+}
+
+// ── BER ──────────────────────────────────────────────────────────────
+
+type berNode struct {
+	tag      byte
+	value    []byte
+	children []*berNode
+}
+
+func ldapMessage(id []byte, tag byte, content ...[]byte) []byte {
+	return berTLV(0x30, berTLV(0x02, id), berTLV(tag, content...))
+}
+
+func ldapResult(code int) []byte {
+	return join(berTLV(0x0a, []byte{byte(code)}), berTLV(0x04, nil), berTLV(0x04, nil))
+}
+
+func berTLV(tag byte, content ...[]byte) []byte {
+	body := join(content...)
+	n := len(body)
+	out := []byte{tag}
+	if n < 0x80 {
+		out = append(out, byte(n))
+	} else {
+		var b []byte
+		for ; n > 0; n >>= 8 {
+			b = append([]byte{byte(n)}, b...)
+		}
+		out = append(append(out, 0x80|byte(len(b))), b...)
+	}
+	return append(out, body...)
+}
+
+func join(parts ...[]byte) []byte {
+	var out []byte
+	for _, p := range parts {
+		out = append(out, p...)
+	}
+	return out
+}
+
+func berRead(r *bufio.Reader) ([]byte, error) {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	n := int(header[1])
+	if n&0x80 != 0 {
+		size := make([]byte, n&0x7f)
+		if _, err := io.ReadFull(r, size); err != nil {
+			return nil, err
+		}
+		header = append(header, size...)
+		n = 0
+		for _, b := range size {
+			n = n<<8 | int(b)
+		}
+	}
+	body := make([]byte, n)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, err
+	}
+	return append(header, body...), nil
+}
+
+func berParse(data []byte) (*berNode, []byte, error) {
+	if len(data) < 2 {
+		return nil, nil, errors.New("ber: truncated")
+	}
+	tag, n, data := data[0], int(data[1]), data[2:]
+	if n&0x80 != 0 {
+		size := n & 0x7f
+		if len(data) < size {
+			return nil, nil, errors.New("ber: truncated")
+		}
+		n = 0
+		for _, b := range data[:size] {
+			n = n<<8 | int(b)
+		}
+		data = data[size:]
+	}
+	if n > len(data) {
+		return nil, nil, errors.New("ber: truncated")
+	}
+	node := &berNode{tag: tag, value: data[:n]}
+	if tag&0x20 != 0 {
+		for content := data[:n]; len(content) > 0; {
+			child, rest, err := berParse(content)
+			if err != nil {
+				return nil, nil, err
+			}
+			node.children = append(node.children, child)
+			content = rest
+		}
+	}
+	return node, data[n:], nil
+}
+
+// selfSignedCert creates a certificate for 127.0.0.1 and localhost.
+func selfSignedCert() (tls.Certificate, *x509.CertPool, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, nil, err
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, nil, err
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return tls.Certificate{}, nil, err
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: cert}, pool, nil
+}
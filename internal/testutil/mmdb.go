@@ -0,0 +1,203 @@
+package testutil
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net/netip"
+	"os"
+	"sort"
+)
+
+// MMDBRecord maps a network to the data returned for addresses in it.
+// Data may hold map[string]any, []any, string, uint16, uint32, uint64 or
+// MMDBPointer values.
+type MMDBRecord struct {
+	Prefix netip.Prefix
+	Data   any
+}
+
+// MMDBPointer encodes a pointer to the data of the record at the given index,
+// exercising the reader's pointer handling.
+type MMDBPointer int
+
+// WriteMMDB writes a minimal IPv6 MaxMind DB file with the given record size
+// (24, 28 or 32 bits) for testing. IPv4 prefixes are stored in the ::/96
+// subtree as MaxMind databases do.
+func WriteMMDB(path, databaseType string, recordSize int, records []MMDBRecord) error {
+	type node struct {
+		child [2]int
+		data  [2]int
+	}
+	nodes := []node{{child: [2]int{-1, -1}, data: [2]int{-1, -1}}}
+
+	for i, rec := range records {
+		addr := rec.Prefix.Addr()
+		bits := rec.Prefix.Bits()
+		var ip [16]byte
+		if addr.Is4() {
+			a := addr.As4()
+			copy(ip[12:], a[:])
+			bits += 96
+		} else {
+			ip = addr.As16()
+		}
+
+		n := 0
+		for b := 0; b < bits; b++ {
+			bit := int(ip[b/8]>>(7-b%8)) & 1
+			if b == bits-1 {
+				nodes[n].data[bit] = i
+				break
+			}
+			if nodes[n].child[bit] == -1 {
+				nodes = append(nodes, node{child: [2]int{-1, -1}, data: [2]int{-1, -1}})
+				nodes[n].child[bit] = len(nodes) - 1
+			}
+			n = nodes[n].child[bit]
+		}
+	}
+
+	var data bytes.Buffer
+	offsets := make([]int, len(records))
+	for i, rec := range records {
+		offsets[i] = data.Len()
+		if err := encodeMMDB(&data, rec.Data, offsets); err != nil {
+			return fmt.Errorf("encode record %d: %w", i, err)
+		}
+	}
+
+	nodeCount := len(nodes)
+	var tree bytes.Buffer
+	for _, n := range nodes {
+		var recs [2]uint32
+		for b := 0; b < 2; b++ {
+			switch {
+			case n.child[b] != -1:
+				recs[b] = uint32(n.child[b])
+			case n.data[b] != -1:
+				recs[b] = uint32(nodeCount + 16 + offsets[n.data[b]])
+			default:
+				recs[b] = uint32(nodeCount)
+			}
+		}
+		switch recordSize {
+		case 24:
+			tree.Write([]byte{byte(recs[0] >> 16), byte(recs[0] >> 8), byte(recs[0]),
+				byte(recs[1] >> 16), byte(recs[1] >> 8), byte(recs[1])})
+		case 28:
+			tree.Write([]byte{byte(recs[0] >> 16), byte(recs[0] >> 8), byte(recs[0]),
+				byte(recs[0]>>24)<<4 | byte(recs[1]>>24)&0x0f,
+				byte(recs[1] >> 16), byte(recs[1] >> 8), byte(recs[1])})
+		case 32:
+			binary.Write(&tree, binary.BigEndian, recs)
+		default:
+			return fmt.Errorf("unsupported record size %d", recordSize)
+		}
+	}
+
+	var out bytes.Buffer
+	out.Write(tree.Bytes())
+	out.Write(make([]byte, 16))
+	out.Write(data.Bytes())
+	out.WriteString("\xab\xcd\xefMaxMind.com")
+	meta := map[string]any{
+		"node_count":                  uint32(nodeCount),
+		"record_size":                 uint16(recordSize),
+		"ip_version":                  uint16(6),
+		"database_type":               databaseType,
+		"binary_format_major_version": uint16(2),
+		"binary_format_minor_version": uint16(0),
+		"build_epoch":                 uint64(1700000000),
+		"languages":                   []any{"en"},
+		"description":                 map[string]any{"en": "wgpilot test database"},
+	}
+	if err := encodeMMDB(&out, meta, nil); err != nil {
+		return fmt.Errorf("encode metadata: %w", err)
+	}
+
+	return os.WriteFile(path, out.Bytes(), 0o644)
+}
+
+func encodeMMDB(w *bytes.Buffer, v any, offsets []int) error {
+	switch v := v.(type) {
+	case MMDBPointer:
+		p := offsets[v]
+		if p >= 2048 {
+			return fmt.Errorf("pointer offset %d too large", p)
+		}
+		w.Write([]byte{1<<5 | byte(p>>8), byte(p)})
+	case string:
+		writeMMDBControl(w, 2, len(v))
+		w.WriteString(v)
+	case uint16:
+		writeMMDBUint(w, 5, uint64(v))
+	case uint32:
+		writeMMDBUint(w, 6, uint64(v))
+	case uint64:
+		writeMMDBUint(w, 9, v)
+	case map[string]any:
+		writeMMDBControl(w, 7, len(v))
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			encodeMMDB(w, k, offsets)
+			if err := encodeMMDB(w, v[k], offsets); err != nil {
+				return err
+			}
+		}
+	case []any:
+		writeMMDBControl(w, 11, len(v))
+		for _, e := range v {
+			if err := encodeMMDB(w, e, offsets); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("unsupported type %T", v)
+	}
+	return nil
+}
+
+func writeMMDBUint(w *bytes.Buffer, typ int, n uint64) {
+	var b []byte
+	for ; n > 0; n >>= 8 {
+		b = append([]byte{byte(n)}, b...)
+	}
+	writeMMDBControl(w, typ, len(b))
+	w.Write(b)
+}
+
+func writeMMDBControl(w *bytes.Buffer, typ, size int) {
+	var ctrl byte
+	var ext []byte
+	if typ > 7 {
+		ext = []byte{byte(typ - 7)}
+	} else {
+		ctrl = byte(typ) << 5
+	}
+
+	var sizeBytes []byte
+	switch {
+	case size < 29:
+		ctrl |= byte(size)
+	case size < 285:
+		ctrl |= 29
+		sizeBytes = []byte{byte(size - 29)}
+	case size < 65821:
+		ctrl |= 30
+		s := size - 285
+		sizeBytes = []byte{byte(s >> 8), byte(s)}
+	default:
+		ctrl |= 31
+		s := size - 65821
+		sizeBytes = []byte{byte(s >> 16), byte(s >> 8), byte(s)}
+	}
+
+	w.WriteByte(ctrl)
+	w.Write(ext)
+	w.Write(sizeBytes)
+}
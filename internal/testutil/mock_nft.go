@@ -1,6 +1,7 @@
 package testutil
 
 import (
+	"context"
 	"fmt"
 	"sort"
 	"strings"
@@ -18,6 +19,7 @@ type MockNFTManager struct {
 	ForwardRules map[string]bool   // iface -> enabled
 	BridgeRules  map[string]string // "ifaceA:ifaceB" (sorted) -> direction
 	UDPPorts     map[int]bool      // port -> open
+	Throttles    map[string]uint64 // "iface:address" -> bytes per second
 
 	// Override functions for custom behavior.
 	AddNATMasqueradeFn           func(iface, subnet string) error
@@ -28,6 +30,8 @@ type MockNFTManager struct {
 	RemoveNetworkBridgeFn        func(ifaceA, ifaceB string) error
 	OpenUDPPortFn                func(port int) error
 	CloseUDPPortFn               func(port int) error
+	ThrottlePeerFn               func(iface, address string, bytesPerSec uint64) error
+	UnthrottlePeerFn             func(iface, address string) error
 	DumpRulesFn                  func() (string, error)
 }
 
@@ -38,10 +42,11 @@ func NewMockNFTManager() *MockNFTManager {
 		ForwardRules: make(map[string]bool),
 		BridgeRules:  make(map[string]string),
 		UDPPorts:     make(map[int]bool),
+		Throttles:    make(map[string]uint64),
 	}
 }
 
-func (m *MockNFTManager) AddNATMasquerade(iface, subnet string) error {
+func (m *MockNFTManager) AddNATMasquerade(_ context.Context, iface, subnet string) error {
 	m.mu.Lock()
 	m.Calls = append(m.Calls, MockCall{Method: "AddNATMasquerade", Args: []any{iface, subnet}})
 	m.NATRules[iface] = subnet
@@ -52,7 +57,7 @@ func (m *MockNFTManager) AddNATMasquerade(iface, subnet string) error {
 	return nil
 }
 
-func (m *MockNFTManager) RemoveNATMasquerade(iface string) error {
+func (m *MockNFTManager) RemoveNATMasquerade(_ context.Context, iface string) error {
 	m.mu.Lock()
 	m.Calls = append(m.Calls, MockCall{Method: "RemoveNATMasquerade", Args: []any{iface}})
 	delete(m.NATRules, iface)
@@ -63,7 +68,7 @@ func (m *MockNFTManager) RemoveNATMasquerade(iface string) error {
 	return nil
 }
 
-func (m *MockNFTManager) EnableInterPeerForwarding(iface string) error {
+func (m *MockNFTManager) EnableInterPeerForwarding(_ context.Context, iface string) error {
 	m.mu.Lock()
 	m.Calls = append(m.Calls, MockCall{Method: "EnableInterPeerForwarding", Args: []any{iface}})
 	m.ForwardRules[iface] = true
@@ -74,7 +79,7 @@ func (m *MockNFTManager) EnableInterPeerForwarding(iface string) error {
 	return nil
 }
 
-func (m *MockNFTManager) DisableInterPeerForwarding(iface string) error {
+func (m *MockNFTManager) DisableInterPeerForwarding(_ context.Context, iface string) error {
 	m.mu.Lock()
 	m.Calls = append(m.Calls, MockCall{Method: "DisableInterPeerForwarding", Args: []any{iface}})
 	delete(m.ForwardRules, iface)
@@ -85,7 +90,7 @@ func (m *MockNFTManager) DisableInterPeerForwarding(iface string) error {
 	return nil
 }
 
-func (m *MockNFTManager) AddNetworkBridge(ifaceA, ifaceB, direction string) error {
+func (m *MockNFTManager) AddNetworkBridge(_ context.Context, ifaceA, ifaceB, direction string) error {
 	m.mu.Lock()
 	key := sortedBridgeKey(ifaceA, ifaceB)
 	m.Calls = append(m.Calls, MockCall{Method: "AddNetworkBridge", Args: []any{ifaceA, ifaceB, direction}})
@@ -97,7 +102,7 @@ func (m *MockNFTManager) AddNetworkBridge(ifaceA, ifaceB, direction string) erro
 	return nil
 }
 
-func (m *MockNFTManager) RemoveNetworkBridge(ifaceA, ifaceB string) error {
+func (m *MockNFTManager) RemoveNetworkBridge(_ context.Context, ifaceA, ifaceB string) error {
 	m.mu.Lock()
 	key := sortedBridgeKey(ifaceA, ifaceB)
 	m.Calls = append(m.Calls, MockCall{Method: "RemoveNetworkBridge", Args: []any{ifaceA, ifaceB}})
@@ -109,7 +114,7 @@ func (m *MockNFTManager) RemoveNetworkBridge(ifaceA, ifaceB string) error {
 	return nil
 }
 
-func (m *MockNFTManager) OpenUDPPort(port int) error {
+func (m *MockNFTManager) OpenUDPPort(_ context.Context, port int) error {
 	m.mu.Lock()
 	m.Calls = append(m.Calls, MockCall{Method: "OpenUDPPort", Args: []any{port}})
 	m.UDPPorts[port] = true
@@ -120,7 +125,7 @@ func (m *MockNFTManager) OpenUDPPort(port int) error {
 	return nil
 }
 
-func (m *MockNFTManager) CloseUDPPort(port int) error {
+func (m *MockNFTManager) CloseUDPPort(_ context.Context, port int) error {
 	m.mu.Lock()
 	m.Calls = append(m.Calls, MockCall{Method: "CloseUDPPort", Args: []any{port}})
 	delete(m.UDPPorts, port)
@@ -131,6 +136,28 @@ func (m *MockNFTManager) CloseUDPPort(port int) error {
 	return nil
 }
 
+func (m *MockNFTManager) ThrottlePeer(_ context.Context, iface, address string, bytesPerSec uint64) error {
+	m.mu.Lock()
+	m.Calls = append(m.Calls, MockCall{Method: "ThrottlePeer", Args: []any{iface, address, bytesPerSec}})
+	m.Throttles[iface+":"+address] = bytesPerSec
+	m.mu.Unlock()
+	if m.ThrottlePeerFn != nil {
+		return m.ThrottlePeerFn(iface, address, bytesPerSec)
+	}
+	return nil
+}
+
+func (m *MockNFTManager) UnthrottlePeer(_ context.Context, iface, address string) error {
+	m.mu.Lock()
+	m.Calls = append(m.Calls, MockCall{Method: "UnthrottlePeer", Args: []any{iface, address}})
+	delete(m.Throttles, iface+":"+address)
+	m.mu.Unlock()
+	if m.UnthrottlePeerFn != nil {
+		return m.UnthrottlePeerFn(iface, address)
+	}
+	return nil
+}
+
 func (m *MockNFTManager) DumpRules() (string, error) {
 	m.mu.Lock()
 	m.Calls = append(m.Calls, MockCall{Method: "DumpRules"})
@@ -167,6 +194,9 @@ func (m *MockNFTManager) formatRulesLocked() string {
 	for key, dir := range m.BridgeRules {
 		lines = append(lines, fmt.Sprintf("BRIDGE %s %s", key, dir))
 	}
+	for key, rate := range m.Throttles {
+		lines = append(lines, fmt.Sprintf("THROTTLE %s %d", key, rate))
+	}
 	sort.Strings(lines)
 	return strings.Join(lines, "\n")
 }
@@ -0,0 +1,231 @@
+package testutil
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// SoftAuthenticator is a software WebAuthn authenticator holding ES256
+// credentials, for exercising registration and login ceremonies in tests.
+// Responses are returned as the JSON a browser would send.
+type SoftAuthenticator struct {
+	RPID   string
+	Origin string
+
+	// UserVerified sets the UV flag, as a PIN or biometric check would.
+	UserVerified bool
+	// Packed makes registration use "packed" self attestation instead of
+	// "none".
+	Packed bool
+	// Type overrides the client data type, to test ceremony confusion.
+	Type string
+
+	signCount uint32
+	creds     []softCredential
+}
+
+type softCredential struct {
+	id         []byte
+	key        *ecdsa.PrivateKey
+	userHandle []byte
+}
+
+// NewSoftAuthenticator creates an authenticator for the given relying party.
+func NewSoftAuthenticator(rpID, origin string) *SoftAuthenticator {
+	return &SoftAuthenticator{RPID: rpID, Origin: origin, UserVerified: true}
+}
+
+// CredentialIDs returns the IDs of the credentials created so far.
+func (a *SoftAuthenticator) CredentialIDs() [][]byte {
+	ids := make([][]byte, len(a.creds))
+	for i, c := range a.creds {
+		ids[i] = c.id
+	}
+	return ids
+}
+
+// Register creates a credential for userHandle and returns the registration
+// response for challenge.
+func (a *SoftAuthenticator) Register(challenge, userHandle []byte) ([]byte, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("generate credential key: %w", err)
+	}
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, fmt.Errorf("generate credential id: %w", err)
+	}
+	cred := softCredential{id: id, key: key, userHandle: userHandle}
+	a.creds = append(a.creds, cred)
+
+	cose := cborEncode(map[any]any{
+		1:  2,  // kty: EC2
+		3:  -7, // alg: ES256
+		-1: 1,  // crv: P-256
+		-2: key.X.FillBytes(make([]byte, 32)),
+		-3: key.Y.FillBytes(make([]byte, 32)),
+	})
+	attested := make([]byte, 16) // zero AAGUID
+	attested = binary.BigEndian.AppendUint16(attested, uint16(len(id)))
+	attested = append(attested, id...)
+	attested = append(attested, cose...)
+	authData := a.authData(0x40, attested)
+
+	clientData := a.clientData("webauthn.create", challenge)
+	stmt := map[any]any{}
+	format := "none"
+	if a.Packed {
+		sig, err := sign(key, authData, clientData)
+		if err != nil {
+			return nil, err
+		}
+		format = "packed"
+		stmt = map[any]any{"alg": -7, "sig": sig}
+	}
+	attObj := cborEncode(map[any]any{"fmt": format, "attStmt": stmt, "authData": authData})
+
+	return json.Marshal(map[string]any{
+		"id":    b64(id),
+		"rawId": b64(id),
+		"type":  "public-key",
+		"response": map[string]any{
+			"clientDataJSON":    b64(clientData),
+			"attestationObject": b64(attObj),
+		},
+	})
+}
+
+// Assert signs challenge with the credential credentialID, or with the most
+// recently created credential if credentialID is nil, and returns the login
+// response.
+func (a *SoftAuthenticator) Assert(challenge, credentialID []byte) ([]byte, error) {
+	if len(a.creds) == 0 {
+		return nil, fmt.Errorf("no credentials")
+	}
+	cred := a.creds[len(a.creds)-1]
+	if credentialID != nil {
+		found := false
+		for _, c := range a.creds {
+			if bytes.Equal(c.id, credentialID) {
+				cred, found = c, true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown credential %x", credentialID)
+		}
+	}
+
+	a.signCount++
+	authData := a.authData(0, nil)
+	clientData := a.clientData("webauthn.get", challenge)
+	sig, err := sign(cred.key, authData, clientData)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(map[string]any{
+		"id":    b64(cred.id),
+		"rawId": b64(cred.id),
+		"type":  "public-key",
+		"response": map[string]any{
+			"clientDataJSON":    b64(clientData),
+			"authenticatorData": b64(authData),
+			"signature":         b64(sig),
+			"userHandle":        b64(cred.userHandle),
+		},
+	})
+}
+
+func (a *SoftAuthenticator) authData(flags byte, attested []byte) []byte {
+	flags |= 0x01 // UP
+	if a.UserVerified {
+		flags |= 0x04
+	}
+	rpIDHash := sha256.Sum256([]byte(a.RPID))
+	b := append(rpIDHash[:], flags)
+	b = binary.BigEndian.AppendUint32(b, a.signCount)
+	return append(b, attested...)
+}
+
+func (a *SoftAuthenticator) clientData(typ string, challenge []byte) []byte {
+	if a.Type != "" {
+		typ = a.Type
+	}
+	b, _ := json.Marshal(map[string]any{
+		"type":        typ,
+		"challenge":   b64(challenge),
+		"origin":      a.Origin,
+		"crossOrigin": false,
+	})
+	return b
+}
+
+func sign(key *ecdsa.PrivateKey, authData, clientData []byte) ([]byte, error) {
+	clientDataHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(append([]byte(nil), authData...), clientDataHash[:]...))
+	sig, err := ecdsa.SignASN1(rand.Reader, key, digest[:])
+	if err != nil {
+		return nil, fmt.Errorf("sign assertion: %w", err)
+	}
+	return sig, nil
+}
+
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// cborEncode encodes ints, strings, byte strings and maps of them as
+// CBOR, with map keys in canonical order.
+func cborEncode(v any) []byte {
+	switch v := v.(type) {
+	case int:
+		if v < 0 {
+			return cborHead(1, uint64(-1-v))
+		}
+		return cborHead(0, uint64(v))
+	case string:
+		return append(cborHead(3, uint64(len(v))), v...)
+	case []byte:
+		return append(cborHead(2, uint64(len(v))), v...)
+	case map[any]any:
+		type entry struct{ k, v []byte }
+		entries := make([]entry, 0, len(v))
+		for k, val := range v {
+			entries = append(entries, entry{cborEncode(k), cborEncode(val)})
+		}
+		sort.Slice(entries, func(i, j int) bool {
+			if len(entries[i].k) != len(entries[j].k) {
+				return len(entries[i].k) < len(entries[j].k)
+			}
+			return bytes.Compare(entries[i].k, entries[j].k) < 0
+		})
+		b := cborHead(5, uint64(len(v)))
+		for _, e := range entries {
+			b = append(append(b, e.k...), e.v...)
+		}
+		return b
+	}
+	panic(fmt.Sprintf("cborEncode: unsupported type %T", v))
+}
+
+func cborHead(major byte, n uint64) []byte {
+	switch {
+	case n < 24:
+		return []byte{major<<5 | byte(n)}
+	case n <= 0xff:
+		return []byte{major<<5 | 24, byte(n)}
+	case n <= 0xffff:
+		return binary.BigEndian.AppendUint16([]byte{major<<5 | 25}, uint16(n))
+	case n <= 0xffffffff:
+		return binary.BigEndian.AppendUint32([]byte{major<<5 | 26}, uint32(n))
+	}
+	return binary.BigEndian.AppendUint64([]byte{major<<5 | 27}, n)
+}
@@ -0,0 +1,403 @@
+// Package tracing records OpenTelemetry-compatible spans and exports them
+// over OTLP/HTTP. HTTP requests start root spans; database queries, kernel
+// operations and firewall updates add child spans when their context
+// carries one. With no tracer installed every call is a cheap no-op.
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	queueSize     = 2048
+	batchSize     = 512
+	flushInterval = 5 * time.Second
+	// shutdownTimeout bounds the final export when Run stops.
+	shutdownTimeout = 5 * time.Second
+)
+
+// TraceID identifies a trace.
+type TraceID [16]byte
+
+// String returns the ID as 32 lowercase hex characters.
+func (id TraceID) String() string { return hex.EncodeToString(id[:]) }
+
+// SpanID identifies a span within a trace.
+type SpanID [8]byte
+
+// String returns the ID as 16 lowercase hex characters.
+func (id SpanID) String() string { return hex.EncodeToString(id[:]) }
+
+// SpanKind is the OTLP span kind.
+type SpanKind int
+
+// Span kinds, numbered as in the OTLP protocol.
+const (
+	KindInternal SpanKind = 1
+	KindServer   SpanKind = 2
+	KindClient   SpanKind = 3
+)
+
+// Attr is a span attribute. Value should be a string, bool, int, int64 or
+// float64; anything else is exported as its fmt representation.
+type Attr struct {
+	Key   string
+	Value any
+}
+
+// String returns a string attribute.
+func String(key, value string) Attr { return Attr{Key: key, Value: value} }
+
+// Int returns an integer attribute.
+func Int(key string, value int) Attr { return Attr{Key: key, Value: int64(value)} }
+
+// Bool returns a boolean attribute.
+func Bool(key string, value bool) Attr { return Attr{Key: key, Value: value} }
+
+// SpanContext is the part of a span that propagates to its children and,
+// through the traceparent header, across processes.
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Sampled bool
+}
+
+// IsValid reports whether sc has non-zero IDs.
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID != TraceID{} && sc.SpanID != SpanID{}
+}
+
+// Span is one timed operation. All methods are safe on a nil *Span, which
+// is what Start returns when tracing is disabled.
+type Span struct {
+	tracer   *Tracer
+	sc       SpanContext
+	parentID SpanID
+	kind     SpanKind
+	start    time.Time
+
+	mu     sync.Mutex
+	name   string
+	end    time.Time
+	attrs  []Attr
+	errMsg string
+	ended  bool
+}
+
+// Context returns the span's propagation context.
+func (s *Span) Context() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.sc
+}
+
+// SetName replaces the span name, e.g. once the HTTP route is known.
+func (s *Span) SetName(name string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.name = name
+	s.mu.Unlock()
+}
+
+// SetAttributes adds attributes to the span.
+func (s *Span) SetAttributes(attrs ...Attr) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.attrs = append(s.attrs, attrs...)
+	s.mu.Unlock()
+}
+
+// RecordError marks the span as failed. A nil err is ignored.
+func (s *Span) RecordError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.mu.Lock()
+	s.errMsg = err.Error()
+	s.mu.Unlock()
+}
+
+// End finishes the span and queues it for export if it is sampled.
+// Calls after the first are ignored.
+func (s *Span) End() {
+	s.endAt(time.Now())
+}
+
+// EndWithError records err, if any, and ends the span.
+func (s *Span) EndWithError(err error) {
+	s.RecordError(err)
+	s.End()
+}
+
+func (s *Span) endAt(t time.Time) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.end = t
+	s.mu.Unlock()
+
+	if s.sc.Sampled {
+		s.tracer.enqueue(s)
+	}
+}
+
+// ── Context ──────────────────────────────────────────────────────────
+
+type contextKey struct{}
+
+// ContextWithSpanContext returns a copy of ctx whose spans become children
+// of sc, e.g. a remote parent read from a traceparent header.
+func ContextWithSpanContext(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, contextKey{}, sc)
+}
+
+// SpanContextFromContext returns the span context stored in ctx, if any.
+func SpanContextFromContext(ctx context.Context) (SpanContext, bool) {
+	sc, ok := ctx.Value(contextKey{}).(SpanContext)
+	return sc, ok
+}
+
+// ── Tracer ───────────────────────────────────────────────────────────
+
+// Exporter sends finished spans to a tracing backend.
+type Exporter interface {
+	Export(ctx context.Context, spans []*Span) error
+}
+
+// Tracer creates spans and exports the sampled ones in batches.
+type Tracer struct {
+	exporter   Exporter
+	logger     *slog.Logger
+	sampleRate float64
+	queue      chan *Span
+	dropped    atomic.Int64
+}
+
+// global is the tracer used by the package-level functions.
+var global atomic.Pointer[Tracer]
+
+// SetGlobal installs t for the package-level functions. Passing nil
+// disables tracing.
+func SetGlobal(t *Tracer) {
+	global.Store(t)
+}
+
+// NewTracer creates a Tracer that records sampleRate (0 to 1) of new traces
+// and exports them through exporter. Call Run to start exporting.
+func NewTracer(exporter Exporter, logger *slog.Logger, sampleRate float64) (*Tracer, error) {
+	if exporter == nil {
+		return nil, fmt.Errorf("new tracer: exporter is required")
+	}
+	if logger == nil {
+		return nil, fmt.Errorf("new tracer: logger is required")
+	}
+	if sampleRate < 0 || sampleRate > 1 {
+		return nil, fmt.Errorf("new tracer: sample rate %v must be between 0 and 1", sampleRate)
+	}
+	return &Tracer{
+		exporter:   exporter,
+		logger:     logger.With("component", "tracing"),
+		sampleRate: sampleRate,
+		queue:      make(chan *Span, queueSize),
+	}, nil
+}
+
+// Run exports queued spans in batches until ctx is cancelled, then flushes
+// what is left.
+func (t *Tracer) Run(ctx context.Context) {
+	t.logger.Info("tracer_started", "sample_rate", t.sampleRate)
+
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	batch := make([]*Span, 0, batchSize)
+	flush := func(ctx context.Context) {
+		if len(batch) == 0 {
+			return
+		}
+		if err := t.exporter.Export(ctx, batch); err != nil {
+			t.logger.Warn("trace_export_failed",
+				"error", err,
+				"error_type", fmt.Sprintf("%T", err),
+				"operation", "export",
+				"spans", len(batch),
+			)
+		}
+		batch = make([]*Span, 0, batchSize)
+		if n := t.dropped.Swap(0); n > 0 {
+			t.logger.Warn("trace_spans_dropped", "spans", n, "operation", "export")
+		}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+		drain:
+			for {
+				select {
+				case s := <-t.queue:
+					batch = append(batch, s)
+				default:
+					break drain
+				}
+			}
+			flushCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+			flush(flushCtx)
+			cancel()
+			t.logger.Info("tracer_stopped")
+			return
+		case s := <-t.queue:
+			batch = append(batch, s)
+			if len(batch) >= batchSize {
+				flush(ctx)
+			}
+		case <-ticker.C:
+			flush(ctx)
+		}
+	}
+}
+
+// enqueue hands a finished span to Run without blocking the caller. When
+// the exporter falls behind, spans are dropped and counted.
+func (t *Tracer) enqueue(s *Span) {
+	select {
+	case t.queue <- s:
+	default:
+		t.dropped.Add(1)
+	}
+}
+
+// sampled decides whether a new trace is recorded. The decision is derived
+// from the trace ID, so it is stable for a given trace.
+func (t *Tracer) sampled(id TraceID) bool {
+	switch {
+	case t.sampleRate >= 1:
+		return true
+	case t.sampleRate <= 0:
+		return false
+	}
+	return float64(binary.BigEndian.Uint64(id[8:])>>11)/(1<<53) < t.sampleRate
+}
+
+func (t *Tracer) newSpan(ctx context.Context, name string, kind SpanKind, start time.Time, attrs []Attr) (context.Context, *Span) {
+	s := &Span{tracer: t, name: name, kind: kind, start: start, attrs: attrs}
+	if parent, ok := SpanContextFromContext(ctx); ok && parent.IsValid() {
+		s.sc.TraceID = parent.TraceID
+		s.sc.Sampled = parent.Sampled
+		s.parentID = parent.SpanID
+	} else {
+		rand.Read(s.sc.TraceID[:])
+		s.sc.Sampled = t.sampled(s.sc.TraceID)
+	}
+	rand.Read(s.sc.SpanID[:])
+	return ContextWithSpanContext(ctx, s.sc), s
+}
+
+// ── Package-level API ────────────────────────────────────────────────
+
+// Start begins a span, as a child of the span in ctx or as the root of a
+// new trace. It returns a nil span when tracing is disabled.
+func Start(ctx context.Context, name string, kind SpanKind, attrs ...Attr) (context.Context, *Span) {
+	t := global.Load()
+	if t == nil {
+		return ctx, nil
+	}
+	return t.newSpan(ctx, name, kind, time.Now(), attrs)
+}
+
+// StartChild begins a span only if ctx already carries a sampled one, so
+// background work outside any request does not produce stray root traces.
+func StartChild(ctx context.Context, name string, attrs ...Attr) (context.Context, *Span) {
+	t := global.Load()
+	if t == nil {
+		return ctx, nil
+	}
+	if parent, ok := SpanContextFromContext(ctx); !ok || !parent.Sampled {
+		return ctx, nil
+	}
+	return t.newSpan(ctx, name, KindInternal, time.Now(), attrs)
+}
+
+// Record adds a finished child span for an operation that was timed by the
+// caller, such as a database query. Like StartChild it does nothing unless
+// ctx carries a sampled span.
+func Record(ctx context.Context, name string, start time.Time, duration time.Duration, err error, attrs ...Attr) {
+	t := global.Load()
+	if t == nil {
+		return
+	}
+	if parent, ok := SpanContextFromContext(ctx); !ok || !parent.Sampled {
+		return
+	}
+	_, s := t.newSpan(ctx, name, KindClient, start, attrs)
+	s.RecordError(err)
+	s.endAt(start.Add(duration))
+}
+
+// ── W3C trace context ────────────────────────────────────────────────
+
+// FormatTraceparent returns sc as a W3C traceparent header value.
+func FormatTraceparent(sc SpanContext) string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return "00-" + sc.TraceID.String() + "-" + sc.SpanID.String() + "-" + flags
+}
+
+// ParseTraceparent parses a W3C traceparent header value.
+func ParseTraceparent(h string) (SpanContext, error) {
+	parts := strings.Split(strings.TrimSpace(h), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" {
+		return SpanContext{}, errors.New("traceparent: malformed header")
+	}
+	if parts[0] == "00" && len(parts) != 4 {
+		return SpanContext{}, errors.New("traceparent: malformed header")
+	}
+
+	var sc SpanContext
+	if err := decodeHex(sc.TraceID[:], parts[1]); err != nil {
+		return SpanContext{}, fmt.Errorf("traceparent: trace id: %w", err)
+	}
+	if err := decodeHex(sc.SpanID[:], parts[2]); err != nil {
+		return SpanContext{}, fmt.Errorf("traceparent: span id: %w", err)
+	}
+	var flags [1]byte
+	if err := decodeHex(flags[:], parts[3]); err != nil {
+		return SpanContext{}, fmt.Errorf("traceparent: flags: %w", err)
+	}
+	if !sc.IsValid() {
+		return SpanContext{}, errors.New("traceparent: zero trace or span id")
+	}
+	sc.Sampled = flags[0]&1 == 1
+	return sc, nil
+}
+
+func decodeHex(dst []byte, s string) error {
+	if len(s) != hex.EncodedLen(len(dst)) || strings.ToLower(s) != s {
+		return fmt.Errorf("expected %d lowercase hex characters", hex.EncodedLen(len(dst)))
+	}
+	_, err := hex.Decode(dst, []byte(s))
+	return err
+}
@@ -0,0 +1,229 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+type recordingExporter struct {
+	mu    sync.Mutex
+	spans []*Span
+}
+
+func (e *recordingExporter) Export(_ context.Context, spans []*Span) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = append(e.spans, spans...)
+	return nil
+}
+
+func (e *recordingExporter) all() []*Span {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]*Span(nil), e.spans...)
+}
+
+func testLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+// installTracer sets a global tracer for the test and returns it.
+// Spans are read straight from the queue instead of running Run.
+func installTracer(t *testing.T, rate float64) *Tracer {
+	t.Helper()
+	tr, err := NewTracer(&recordingExporter{}, testLogger(), rate)
+	if err != nil {
+		t.Fatalf("NewTracer: %v", err)
+	}
+	SetGlobal(tr)
+	t.Cleanup(func() { SetGlobal(nil) })
+	return tr
+}
+
+func queued(tr *Tracer) []*Span {
+	var spans []*Span
+	for {
+		select {
+		case s := <-tr.queue:
+			spans = append(spans, s)
+		default:
+			return spans
+		}
+	}
+}
+
+func TestStart_Disabled(t *testing.T) {
+	SetGlobal(nil)
+	ctx, span := Start(context.Background(), "noop", KindServer)
+	if span != nil {
+		t.Fatal("expected nil span without a tracer")
+	}
+	// Methods on a nil span must not panic.
+	span.SetAttributes(String("k", "v"))
+	span.EndWithError(errors.New("boom"))
+	if _, ok := SpanContextFromContext(ctx); ok {
+		t.Error("expected no span context")
+	}
+}
+
+func TestStart_ChildrenShareTrace(t *testing.T) {
+	tr := installTracer(t, 1)
+
+	ctx, root := Start(context.Background(), "GET", KindServer)
+	childCtx, child := StartChild(ctx, "wg.add_peer")
+	Record(childCtx, "db.exec", time.Now().Add(-time.Millisecond), time.Millisecond, errors.New("locked"))
+	child.End()
+	root.End()
+	root.End() // second End is ignored
+
+	spans := queued(tr)
+	if len(spans) != 3 {
+		t.Fatalf("expected 3 spans, got %d", len(spans))
+	}
+	query, wgSpan, server := spans[0], spans[1], spans[2]
+	if query.sc.TraceID != server.sc.TraceID || wgSpan.sc.TraceID != server.sc.TraceID {
+		t.Error("expected all spans in one trace")
+	}
+	if wgSpan.parentID != server.sc.SpanID || query.parentID != wgSpan.sc.SpanID {
+		t.Error("expected db span under wg span under server span")
+	}
+	if query.errMsg != "locked" || query.kind != KindClient {
+		t.Errorf("unexpected recorded span: %+v", query)
+	}
+}
+
+func TestStartChild_NeedsParent(t *testing.T) {
+	tr := installTracer(t, 1)
+
+	_, span := StartChild(context.Background(), "wg.reconcile")
+	span.End()
+	Record(context.Background(), "db.query", time.Now(), 0, nil)
+
+	if span != nil || len(queued(tr)) != 0 {
+		t.Error("expected no spans without a parent")
+	}
+}
+
+func TestSampling_ZeroRateKeepsIDs(t *testing.T) {
+	tr := installTracer(t, 0)
+
+	ctx, span := Start(context.Background(), "GET", KindServer)
+	if !span.Context().IsValid() || span.Context().Sampled {
+		t.Fatalf("expected valid unsampled span context, got %+v", span.Context())
+	}
+	_, child := StartChild(ctx, "db")
+	span.End()
+	if child != nil || len(queued(tr)) != 0 {
+		t.Error("expected unsampled trace not to be exported")
+	}
+}
+
+func TestTraceparent_RoundTrip(t *testing.T) {
+	h := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	sc, err := ParseTraceparent(h)
+	if err != nil {
+		t.Fatalf("ParseTraceparent: %v", err)
+	}
+	if !sc.Sampled || sc.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("unexpected span context %+v", sc)
+	}
+	if got := FormatTraceparent(sc); got != h {
+		t.Errorf("FormatTraceparent = %q, want %q", got, h)
+	}
+
+	for _, bad := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+	} {
+		if _, err := ParseTraceparent(bad); err == nil {
+			t.Errorf("expected error for %q", bad)
+		}
+	}
+}
+
+func TestOTLPExporter(t *testing.T) {
+	var got map[string]any
+	var auth string
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/traces" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		auth = r.Header.Get("Authorization")
+		json.NewDecoder(r.Body).Decode(&got)
+	}))
+	defer collector.Close()
+
+	exp, err := NewOTLPExporter(collector.URL, map[string]string{"Authorization": "Bearer k"}, "wgpilot", "1.2.3")
+	if err != nil {
+		t.Fatalf("NewOTLPExporter: %v", err)
+	}
+	tr := installTracer(t, 1)
+	ctx, root := Start(context.Background(), "GET /api/networks", KindServer, Int("http.response.status_code", 500))
+	Record(ctx, "db.query", time.Unix(0, 1000), time.Microsecond, errors.New("boom"), String("db.system", "sqlite"))
+	root.End()
+
+	if err := exp.Export(context.Background(), queued(tr)); err != nil {
+		t.Fatalf("Export: %v", err)
+	}
+	if auth != "Bearer k" {
+		t.Errorf("expected configured header, got %q", auth)
+	}
+
+	rs := got["resourceSpans"].([]any)[0].(map[string]any)
+	resource := rs["resource"].(map[string]any)["attributes"].([]any)[0].(map[string]any)
+	if resource["key"] != "service.name" || resource["value"].(map[string]any)["stringValue"] != "wgpilot" {
+		t.Errorf("unexpected resource attribute %v", resource)
+	}
+	spans := rs["scopeSpans"].([]any)[0].(map[string]any)["spans"].([]any)
+	query := spans[0].(map[string]any)
+	if query["name"] != "db.query" || query["startTimeUnixNano"] != "1000" || query["endTimeUnixNano"] != "2000" {
+		t.Errorf("unexpected query span %v", query)
+	}
+	if query["parentSpanId"] != spans[1].(map[string]any)["spanId"] || len(query["traceId"].(string)) != 32 {
+		t.Errorf("expected hex IDs linking query to root, got %v", query)
+	}
+	if query["status"].(map[string]any)["code"] != float64(2) {
+		t.Errorf("expected error status, got %v", query["status"])
+	}
+
+	if _, err := NewOTLPExporter("localhost:4318", nil, "wgpilot", ""); err == nil {
+		t.Error("expected error for endpoint without scheme")
+	}
+}
+
+func TestTracer_RunFlushesOnShutdown(t *testing.T) {
+	exp := &recordingExporter{}
+	tr, err := NewTracer(exp, testLogger(), 1)
+	if err != nil {
+		t.Fatalf("NewTracer: %v", err)
+	}
+	SetGlobal(tr)
+	t.Cleanup(func() { SetGlobal(nil) })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		tr.Run(ctx)
+		close(done)
+	}()
+
+	_, span := Start(context.Background(), "GET", KindServer)
+	span.End()
+	cancel()
+	<-done
+
+	if len(exp.all()) != 1 {
+		t.Errorf("expected the queued span to be exported on shutdown, got %d", len(exp.all()))
+	}
+}
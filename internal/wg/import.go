@@ -17,6 +17,13 @@ type ImportedConfig struct {
 	DNSServers  string
 	MTU         int
 
+	// Commands wg-quick runs around interface changes. wgpilot does not
+	// run them; use event hooks instead.
+	PreUp    []string
+	PostUp   []string
+	PreDown  []string
+	PostDown []string
+
 	// Peer sections
 	Peers []ImportedPeer
 }
@@ -86,6 +93,14 @@ func ParseWgQuickConfig(r io.Reader) (*ImportedConfig, error) {
 				if n, err := strconv.Atoi(value); err == nil {
 					cfg.MTU = n
 				}
+			case "preup":
+				cfg.PreUp = append(cfg.PreUp, value)
+			case "postup":
+				cfg.PostUp = append(cfg.PostUp, value)
+			case "predown":
+				cfg.PreDown = append(cfg.PreDown, value)
+			case "postdown":
+				cfg.PostDown = append(cfg.PostDown, value)
 			}
 		case "peer":
 			if currentPeer == nil {
@@ -123,3 +138,23 @@ func ParseWgQuickConfig(r io.Reader) (*ImportedConfig, error) {
 
 	return cfg, nil
 }
+
+// Commands returns the PreUp, PostUp, PreDown and PostDown lines in wg-quick
+// syntax, e.g. "PostUp = iptables -A FORWARD -i %i -j ACCEPT".
+func (c *ImportedConfig) Commands() []string {
+	var lines []string
+	for _, group := range []struct {
+		key  string
+		cmds []string
+	}{
+		{"PreUp", c.PreUp},
+		{"PostUp", c.PostUp},
+		{"PreDown", c.PreDown},
+		{"PostDown", c.PostDown},
+	} {
+		for _, cmd := range group.cmds {
+			lines = append(lines, group.key+" = "+cmd)
+		}
+	}
+	return lines
+}
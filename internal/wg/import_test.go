@@ -0,0 +1,40 @@
+package wg
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseWgQuickConfig_Commands(t *testing.T) {
+	conf := `[Interface]
+PrivateKey = yAnz5TF+lXXJte14tji3zlMNq+hd2rYUIgJBgB3fBmk=
+Address = 10.0.0.1/24
+PostUp = iptables -A FORWARD -i %i -j ACCEPT
+PostUp = iptables -t nat -A POSTROUTING -o eth0 -j MASQUERADE
+PostDown = iptables -D FORWARD -i %i -j ACCEPT
+
+[Peer]
+PublicKey = xTIBA5rboUvnH4htodjb6e697QjLERt1NAB4mZqp8Dg=
+AllowedIPs = 10.0.0.2/32
+`
+	cfg, err := ParseWgQuickConfig(strings.NewReader(conf))
+	if err != nil {
+		t.Fatalf("ParseWgQuickConfig: %v", err)
+	}
+	if len(cfg.PostUp) != 2 || len(cfg.PostDown) != 1 || len(cfg.PreUp) != 0 {
+		t.Fatalf("unexpected commands: up=%v down=%v", cfg.PostUp, cfg.PostDown)
+	}
+
+	want := []string{
+		"PostUp = iptables -A FORWARD -i %i -j ACCEPT",
+		"PostUp = iptables -t nat -A POSTROUTING -o eth0 -j MASQUERADE",
+		"PostDown = iptables -D FORWARD -i %i -j ACCEPT",
+	}
+	got := cfg.Commands()
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Commands() = %q, want %q", got, want)
+	}
+	if len(cfg.Peers) != 1 {
+		t.Errorf("expected 1 peer, got %d", len(cfg.Peers))
+	}
+}
@@ -8,7 +8,9 @@ import (
 	"sync"
 	"time"
 
+	"github.com/itsChris/wgpilot/internal/events"
 	"github.com/itsChris/wgpilot/internal/logging"
+	"github.com/itsChris/wgpilot/internal/tracing"
 )
 
 // Manager coordinates WireGuard interface and peer lifecycle operations.
@@ -16,6 +18,7 @@ type Manager struct {
 	wg     WireGuardController
 	link   LinkManager
 	logger *slog.Logger
+	events *events.Bus
 
 	mu sync.Mutex
 }
@@ -38,9 +41,19 @@ func NewManager(wg WireGuardController, link LinkManager, logger *slog.Logger) (
 	}, nil
 }
 
+// SetEventBus makes Reconcile publish the corrections it makes on bus.
+func (m *Manager) SetEventBus(bus *events.Bus) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.events = bus
+}
+
 // CreateInterface creates a WireGuard network interface, assigns an address,
 // configures the device, and brings it up.
-func (m *Manager) CreateInterface(ctx context.Context, network NetworkConfig) error {
+func (m *Manager) CreateInterface(ctx context.Context, network NetworkConfig) (err error) {
+	ctx, span := tracing.StartChild(ctx, "wg.create_interface", tracing.String("wg.interface", network.Interface))
+	defer func() { span.EndWithError(err) }()
+
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	return m.createInterface(ctx, network)
@@ -142,7 +155,10 @@ func (m *Manager) createInterface(ctx context.Context, network NetworkConfig) er
 
 // DeleteInterface tears down a WireGuard interface: removes all peers,
 // brings the interface down, and deletes it.
-func (m *Manager) DeleteInterface(ctx context.Context, name string) error {
+func (m *Manager) DeleteInterface(ctx context.Context, name string) (err error) {
+	ctx, span := tracing.StartChild(ctx, "wg.delete_interface", tracing.String("wg.interface", name))
+	defer func() { span.EndWithError(err) }()
+
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	return m.deleteInterface(ctx, name)
@@ -219,7 +235,10 @@ func (m *Manager) deleteInterface(ctx context.Context, name string) error {
 }
 
 // AddPeer adds a peer to a WireGuard interface.
-func (m *Manager) AddPeer(ctx context.Context, iface string, peer PeerConfig) error {
+func (m *Manager) AddPeer(ctx context.Context, iface string, peer PeerConfig) (err error) {
+	ctx, span := tracing.StartChild(ctx, "wg.add_peer", tracing.String("wg.interface", iface))
+	defer func() { span.EndWithError(err) }()
+
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	return m.addPeer(ctx, iface, peer)
@@ -271,7 +290,10 @@ func (m *Manager) addPeer(ctx context.Context, iface string, peer PeerConfig) er
 }
 
 // RemovePeer removes a peer from a WireGuard interface by its public key.
-func (m *Manager) RemovePeer(ctx context.Context, iface string, publicKey string) error {
+func (m *Manager) RemovePeer(ctx context.Context, iface string, publicKey string) (err error) {
+	ctx, span := tracing.StartChild(ctx, "wg.remove_peer", tracing.String("wg.interface", iface))
+	defer func() { span.EndWithError(err) }()
+
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
@@ -308,7 +330,10 @@ func (m *Manager) RemovePeer(ctx context.Context, iface string, publicKey string
 }
 
 // UpdatePeer updates an existing peer's configuration on a WireGuard interface.
-func (m *Manager) UpdatePeer(ctx context.Context, iface string, peer PeerConfig) error {
+func (m *Manager) UpdatePeer(ctx context.Context, iface string, peer PeerConfig) (err error) {
+	ctx, span := tracing.StartChild(ctx, "wg.update_peer", tracing.String("wg.interface", iface))
+	defer func() { span.EndWithError(err) }()
+
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
@@ -6,12 +6,17 @@ import (
 	"log/slog"
 	"net"
 
+	"github.com/itsChris/wgpilot/internal/events"
 	"github.com/itsChris/wgpilot/internal/logging"
+	"github.com/itsChris/wgpilot/internal/tracing"
 )
 
 // Reconcile compares database state against kernel state and corrects any mismatches.
 // The database is always the source of truth.
-func (m *Manager) Reconcile(ctx context.Context, store NetworkStore) error {
+func (m *Manager) Reconcile(ctx context.Context, store NetworkStore) (err error) {
+	ctx, span := tracing.StartChild(ctx, "wg.reconcile")
+	defer func() { span.EndWithError(err) }()
+
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
@@ -69,6 +74,8 @@ func (m *Manager) Reconcile(ctx context.Context, store NetworkStore) error {
 						"interface", network.Interface,
 						"operation", "reconcile",
 					)
+				} else {
+					m.publishCorrection(network.ID, network.Interface, "tearing_down", 0, "")
 				}
 			}
 			continue
@@ -92,6 +99,7 @@ func (m *Manager) Reconcile(ctx context.Context, store NetworkStore) error {
 				)
 				continue
 			}
+			m.publishCorrection(network.ID, network.Interface, "recreating", 0, "")
 		}
 
 		// Sync peers
@@ -122,9 +130,28 @@ func (m *Manager) Reconcile(ctx context.Context, store NetworkStore) error {
 	}
 
 	l.Info("reconciliation_complete", "operation", "reconcile")
+	m.events.Publish(events.Event{
+		Type: events.TypeReconcileCompleted,
+		Data: map[string]any{"networks": len(networks)},
+	})
 	return nil
 }
 
+// publishCorrection publishes a reconcile.corrected event. action matches the
+// "action" attribute of the corresponding log event.
+func (m *Manager) publishCorrection(networkID int64, iface, action string, peerID int64, publicKey string) {
+	m.events.Publish(events.Event{
+		Type:      events.TypeReconcileCorrected,
+		NetworkID: networkID,
+		PeerID:    peerID,
+		Data: map[string]any{
+			"interface":  iface,
+			"action":     action,
+			"public_key": publicKey,
+		},
+	})
+}
+
 // syncPeers compares DB peers against kernel peers for a single interface
 // and corrects mismatches.
 func (m *Manager) syncPeers(ctx context.Context, l *slog.Logger, iface string, networkID int64, dev *DeviceInfo, dbPeers []PeerConfig) {
@@ -169,6 +196,8 @@ func (m *Manager) syncPeers(ctx context.Context, l *slog.Logger, iface string, n
 						"peer_id", dbPeer.ID,
 						"operation", "reconcile",
 					)
+				} else {
+					m.publishCorrection(networkID, iface, "removing_from_kernel", dbPeer.ID, dbPeer.PublicKey)
 				}
 			}
 			continue
@@ -192,6 +221,8 @@ func (m *Manager) syncPeers(ctx context.Context, l *slog.Logger, iface string, n
 					"peer_name", dbPeer.Name,
 					"operation", "reconcile",
 				)
+			} else {
+				m.publishCorrection(networkID, iface, "adding_to_kernel", dbPeer.ID, dbPeer.PublicKey)
 			}
 			continue
 		}
@@ -212,6 +243,8 @@ func (m *Manager) syncPeers(ctx context.Context, l *slog.Logger, iface string, n
 					"peer_id", dbPeer.ID,
 					"operation", "reconcile",
 				)
+			} else {
+				m.publishCorrection(networkID, iface, "updating_kernel", dbPeer.ID, dbPeer.PublicKey)
 			}
 		}
 
@@ -244,6 +277,8 @@ func (m *Manager) syncPeers(ctx context.Context, l *slog.Logger, iface string, n
 						"public_key", kp.PublicKey,
 						"operation", "reconcile",
 					)
+				} else {
+					m.publishCorrection(networkID, iface, "removing_from_kernel", 0, kp.PublicKey)
 				}
 			}
 		}
@@ -323,7 +358,7 @@ func formatIPNets(nets []net.IPNet) string {
 // all enabled bridges. This is separate from WG device reconciliation because
 // bridge rules span nft (not wg) and the two packages are independent.
 func ReconcileBridges(ctx context.Context, store NetworkStore, nftMgr interface {
-	AddNetworkBridge(ifaceA, ifaceB, direction string) error
+	AddNetworkBridge(ctx context.Context, ifaceA, ifaceB, direction string) error
 }, logger *slog.Logger) error {
 	l := logger.With("component", "reconcile_bridges")
 
@@ -360,7 +395,7 @@ func ReconcileBridges(ctx context.Context, store NetworkStore, nftMgr interface
 			"operation", "reconcile_bridges",
 		)
 
-		if err := nftMgr.AddNetworkBridge(bridge.InterfaceA, bridge.InterfaceB, bridge.Direction); err != nil {
+		if err := nftMgr.AddNetworkBridge(ctx, bridge.InterfaceA, bridge.InterfaceB, bridge.Direction); err != nil {
 			l.Error("reconcile_bridge_add_failed",
 				"error", err,
 				"bridge_id", bridge.ID,
@@ -5,6 +5,7 @@ import (
 	"net"
 	"testing"
 
+	"github.com/itsChris/wgpilot/internal/events"
 	"github.com/itsChris/wgpilot/internal/testutil"
 	"github.com/itsChris/wgpilot/internal/wg"
 )
@@ -128,6 +129,57 @@ func TestReconcile_MissingPeer(t *testing.T) {
 	}
 }
 
+func TestReconcile_PublishesCorrections(t *testing.T) {
+	store := &testutil.MockNetworkStore{
+		ListNetworksFn: func(ctx context.Context) ([]wg.NetworkConfig, error) {
+			return []wg.NetworkConfig{
+				{ID: 1, Interface: "wg0", Subnet: "10.0.0.0/24", ListenPort: 51820, Enabled: true},
+			}, nil
+		},
+		ListPeersByNetworkIDFn: func(ctx context.Context, networkID int64) ([]wg.PeerConfig, error) {
+			return []wg.PeerConfig{
+				{ID: 1, Name: "peer1", PublicKey: "peer1-pubkey", AllowedIPs: "10.0.0.2/32", Enabled: true},
+			}, nil
+		},
+	}
+	mockWG := &testutil.MockWireGuardController{
+		DevicesFn: func() ([]*wg.DeviceInfo, error) {
+			return []*wg.DeviceInfo{{Name: "wg0"}}, nil
+		},
+	}
+
+	mgr, err := wg.NewManager(mockWG, &testutil.MockLinkManager{}, testLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	bus := events.NewBus(0)
+	mgr.SetEventBus(bus)
+	sub, _, _ := bus.Subscribe(events.Filter{Topics: []string{"reconcile"}}, 0)
+
+	if err := mgr.Reconcile(context.Background(), store); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	sub.Close()
+	var received []events.Event
+	for e := range sub.C {
+		received = append(received, e)
+	}
+	if len(received) != 2 {
+		t.Fatalf("expected 2 reconcile events, got %d", len(received))
+	}
+	e := received[0]
+	if e.Type != events.TypeReconcileCorrected || e.NetworkID != 1 || e.PeerID != 1 {
+		t.Errorf("unexpected correction event: %+v", e)
+	}
+	if data, _ := e.Data.(map[string]any); data["action"] != "adding_to_kernel" {
+		t.Errorf("expected adding_to_kernel action, got %v", e.Data)
+	}
+	if received[1].Type != events.TypeReconcileCompleted {
+		t.Errorf("expected reconcile.completed last, got %s", received[1].Type)
+	}
+}
+
 func TestReconcile_ConfigMismatch(t *testing.T) {
 	// DB peer has different AllowedIPs than kernel
 	_, subnet32, _ := net.ParseCIDR("10.0.0.2/32")